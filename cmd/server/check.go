@@ -0,0 +1,53 @@
+package server
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/internal/config"
+)
+
+// Check performs a readiness request against a running gateway and fails
+// unless it answers 200 OK, for container HEALTHCHECK directives and deploy
+// scripts. The address defaults to the server port in config.yaml.
+func Check(args []string) error {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	url := fs.String("url", "", "health URL to request (default from config.yaml)")
+	timeout := fs.Duration("timeout", 5*time.Second, "request timeout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *url == "" {
+		cfgSvc, err := config.NewService("config.yaml")
+		if err != nil {
+			return err
+		}
+		*url = healthURL(cfgSvc.Get().Server)
+	}
+
+	client := &http.Client{Timeout: *timeout}
+	resp, err := client.Get(*url)
+	if err != nil {
+		return fmt.Errorf("health check failed: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("health check failed: %s returned %s", *url, resp.Status)
+	}
+	fmt.Printf("ok: %s\n", *url)
+	return nil
+}
+
+// healthURL returns the local health endpoint of a server. A wildcard host
+// is reached through the loopback address.
+func healthURL(cfg config.ServerConfig) string {
+	host := cfg.Host
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	return fmt.Sprintf("http://%s:%d/health", host, cfg.Port)
+}
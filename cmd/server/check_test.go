@@ -0,0 +1,35 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/X0Ken/openai-gateway/internal/config"
+)
+
+func TestCheck(t *testing.T) {
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	if err := Check([]string{"-url", srv.URL + "/health"}); err != nil {
+		t.Errorf("Expected a healthy instance to pass, got %v", err)
+	}
+
+	status = http.StatusServiceUnavailable
+	if err := Check([]string{"-url", srv.URL + "/health"}); err == nil {
+		t.Error("Expected an unhealthy instance to fail")
+	}
+}
+
+func TestHealthURL(t *testing.T) {
+	if got := healthURL(config.ServerConfig{Host: "0.0.0.0", Port: 8080}); got != "http://127.0.0.1:8080/health" {
+		t.Errorf("Expected loopback URL, got %s", got)
+	}
+	if got := healthURL(config.ServerConfig{Host: "10.0.0.5", Port: 9000}); got != "http://10.0.0.5:9000/health" {
+		t.Errorf("Expected configured host, got %s", got)
+	}
+}
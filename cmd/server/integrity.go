@@ -0,0 +1,66 @@
+package server
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/X0Ken/openai-gateway/internal/config"
+	"github.com/X0Ken/openai-gateway/pkg/database"
+)
+
+// Integrity checks the configured database and prints a summary. It fails
+// when problems remain, so it can gate scripted maintenance.
+func Integrity(args []string) error {
+	fs := flag.NewFlagSet("integrity", flag.ContinueOnError)
+	repair := fs.Bool("repair", false, "delete orphan rows")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfgSvc, err := config.NewService("config.yaml")
+	if err != nil {
+		return err
+	}
+
+	db, err := database.New(cfgSvc.Get().Database.Path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	report, err := db.CheckIntegrity(*repair)
+	if err != nil {
+		return err
+	}
+
+	printIntegrityReport(os.Stdout, report)
+	if !report.OK() {
+		return fmt.Errorf("database integrity check failed")
+	}
+	return nil
+}
+
+// printIntegrityReport writes a human-readable integrity summary
+func printIntegrityReport(w io.Writer, report *database.IntegrityReport) {
+	if len(report.Errors) == 0 {
+		fmt.Fprintln(w, "integrity_check: ok")
+	}
+	for _, message := range report.Errors {
+		fmt.Fprintf(w, "integrity_check: %s\n", message)
+	}
+
+	if len(report.Orphans) == 0 {
+		fmt.Fprintln(w, "orphans: none")
+	}
+	for _, o := range report.Orphans {
+		fmt.Fprintf(w, "orphans: %d rows in %s with %s missing from %s\n", o.Count, o.Table, o.Column, o.Parent)
+	}
+
+	if report.Repaired > 0 {
+		fmt.Fprintf(w, "repaired: deleted %d orphan rows\n", report.Repaired)
+	} else if len(report.Orphans) > 0 {
+		fmt.Fprintln(w, "run with -repair to delete orphan rows")
+	}
+}
@@ -1,22 +1,53 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
 	"time"
 
 	"github.com/X0Ken/openai-gateway/internal/admin"
+	"github.com/X0Ken/openai-gateway/internal/adminguard"
+	"github.com/X0Ken/openai-gateway/internal/alert"
 	"github.com/X0Ken/openai-gateway/internal/api"
 	"github.com/X0Ken/openai-gateway/internal/auth"
+	"github.com/X0Ken/openai-gateway/internal/backup"
+	"github.com/X0Ken/openai-gateway/internal/bootstrap"
+	"github.com/X0Ken/openai-gateway/internal/breaker"
+	"github.com/X0Ken/openai-gateway/internal/budget"
+	"github.com/X0Ken/openai-gateway/internal/certs"
 	"github.com/X0Ken/openai-gateway/internal/channel"
+	"github.com/X0Ken/openai-gateway/internal/chaos"
+	"github.com/X0Ken/openai-gateway/internal/cluster"
 	"github.com/X0Ken/openai-gateway/internal/config"
+	"github.com/X0Ken/openai-gateway/internal/dedup"
+	"github.com/X0Ken/openai-gateway/internal/flags"
 	"github.com/X0Ken/openai-gateway/internal/metrics"
 	"github.com/X0Ken/openai-gateway/internal/model"
+	"github.com/X0Ken/openai-gateway/internal/probe"
+	"github.com/X0Ken/openai-gateway/internal/quota"
+	"github.com/X0Ken/openai-gateway/internal/reconcile"
+	"github.com/X0Ken/openai-gateway/internal/replay"
 	"github.com/X0Ken/openai-gateway/internal/router"
+	"github.com/X0Ken/openai-gateway/internal/scheduler"
+	"github.com/X0Ken/openai-gateway/internal/scim"
 	"github.com/X0Ken/openai-gateway/internal/session"
+	"github.com/X0Ken/openai-gateway/internal/slo"
+	"github.com/X0Ken/openai-gateway/internal/statuspage"
+	"github.com/X0Ken/openai-gateway/internal/timeout"
 	"github.com/X0Ken/openai-gateway/internal/web"
+	"github.com/X0Ken/openai-gateway/pkg/blob"
 	"github.com/X0Ken/openai-gateway/pkg/database"
 	"github.com/X0Ken/openai-gateway/pkg/health"
+	"github.com/X0Ken/openai-gateway/pkg/s3"
+	"github.com/X0Ken/openai-gateway/pkg/store"
 	"github.com/gin-gonic/gin"
 )
 
@@ -25,39 +56,244 @@ func Run() error {
 	// Load configuration
 	cfgSvc, err := config.NewService("config.yaml")
 	if err != nil {
-		log.Printf("Warning: failed to load config file, using defaults: %v", err)
+		return err
 	}
 	cfg := cfgSvc.Get()
 
 	// Initialize database
-	db, err := database.New(cfg.Database.Path)
+	db, err := database.Open(cfg.Database.Path)
 	if err != nil {
 		return err
 	}
 	defer db.Close()
+	if err := migrateSchema(db, cfg.Database); err != nil {
+		return err
+	}
+
+	// Initialize state stores shared between replicas
+	stores, err := store.New(db, store.Options{
+		Backend:       cfg.Cluster.Store,
+		RedisAddr:     cfg.Cluster.Redis.Addr,
+		RedisPassword: cfg.Cluster.Redis.Password,
+		RedisDB:       cfg.Cluster.Redis.DB,
+	})
+	if err != nil {
+		return err
+	}
+	defer stores.Close()
+
+	// Seed an empty database on first start
+	reconciler := reconcile.NewReconciler(db)
+	bootstrapOpts := bootstrap.OptionsFromEnv(bootstrap.Options{
+		Enabled: cfg.Bootstrap.Enabled,
+		File:    cfg.Bootstrap.File,
+	})
+	if bootstrapOpts.Active() {
+		result, err := bootstrap.Run(db, reconciler, bootstrapOpts)
+		if err != nil {
+			return err
+		}
+		logBootstrap(result)
+	}
+
+	// Background jobs run once every component is wired, and stop before the
+	// stores and database close
+	jobs := scheduler.New()
+	defer jobs.Stop()
 
 	// Initialize managers
 	channelMgr := channel.NewManager(db)
-	sessionMgr := session.NewManager(db, cfg.Session.IdleTimeout)
-	sessionMgr.Start()
-	defer sessionMgr.Stop()
+	reconciler.SetChannelManager(channelMgr)
+	if err := channel.ValidateProxyURL(cfg.Upstream.Proxy); err != nil {
+		return fmt.Errorf("invalid upstream proxy: %w", err)
+	}
+	transportOpts := channel.TransportOptions{
+		MaxIdleConnsPerHost: cfg.Upstream.MaxIdleConnsPerHost,
+		IdleConnTimeout:     time.Duration(cfg.Upstream.IdleConnTimeout) * time.Second,
+		TLSHandshakeTimeout: time.Duration(cfg.Upstream.TLSHandshakeTimeout) * time.Second,
+		Timeout:             time.Duration(cfg.Upstream.Timeout) * time.Second,
+		Proxy:               cfg.Upstream.Proxy,
+	}
+	if cfg.Chaos.Enabled {
+		transportOpts.Wrap = chaos.New(chaosFaults(cfg.Chaos)).Wrap
+		log.Printf("WARNING: chaos testing is enabled, injecting faults into upstream requests. Never enable it in production.")
+	}
+	channelMgr.SetTransportOptions(transportOpts)
+	channelMgr.SetRetryPolicy(retryPolicy(cfg.Upstream.Retry))
+	sessionMgr := session.NewManager(stores.Sessions, cfg.Session.IdleTimeout)
+	jobs.Add(scheduler.Job{
+		Name:     "session_cleanup",
+		Interval: session.CleanupInterval,
+		Jitter:   session.CleanupInterval / 10,
+		Run: func(context.Context) error {
+			return sessionMgr.CleanupExpired()
+		},
+	})
+
+	if usage := cfg.Usage; usage.RollupAfterDays > 0 || usage.DailyAfterDays > 0 {
+		jobs.Add(scheduler.Job{
+			Name:     "usage_rollup",
+			Interval: time.Hour,
+			Jitter:   time.Hour / 10,
+			Run: func(context.Context) error {
+				return rollupUsage(db, usage, time.Now())
+			},
+		})
+	}
+
+	if b := cfg.Backup; b.Enabled {
+		opts := backup.Options{Dir: b.Dir, Keep: b.Keep}
+		if b.S3.Bucket != "" {
+			client, err := s3.New(s3.Config{
+				Endpoint:        b.S3.Endpoint,
+				Region:          b.S3.Region,
+				Bucket:          b.S3.Bucket,
+				AccessKeyID:     b.S3.AccessKeyID,
+				SecretAccessKey: b.S3.SecretAccessKey,
+				PathStyle:       b.S3.PathStyle,
+			})
+			if err != nil {
+				return fmt.Errorf("backup: %w", err)
+			}
+			opts.Remote = blob.NewS3(client, b.S3.Prefix)
+		}
+		backups := backup.NewRunner(db, opts)
+		backupInterval := time.Duration(b.IntervalHours) * time.Hour
+		jobs.Add(scheduler.Job{
+			Name:     "database_backup",
+			Interval: backupInterval,
+			Jitter:   backupInterval / 10,
+			Run: func(ctx context.Context) error {
+				_, err := backups.Run(ctx)
+				return err
+			},
+		})
+	}
 
 	// Initialize router engine
 	routerEngine := router.NewEngine(db)
+	routerEngine.SetStores(stores.Sessions, stores.Metrics)
+	routerEngine.SetPreferPreviousChannel(cfg.Session.PreferPreviousChannel)
+	if cfg.Routing.Seed != 0 {
+		routerEngine.SetRand(router.NewRand(cfg.Routing.Seed))
+	}
+	routerEngine.SetDebug(cfg.Routing.Debug)
+	if cost := cfg.Routing.CostOptimization; cost.Enabled {
+		routerEngine.SetCostPolicy(router.NewCostPolicy(router.CostPolicyOptions{
+			LatencyTarget: time.Duration(cost.LatencyTargetMs) * time.Millisecond,
+			RecoverRatio:  cost.RecoverRatio,
+			Window:        time.Duration(cost.Window) * time.Second,
+			MinSamples:    cost.MinSamples,
+		}))
+	}
+	if cold := cfg.Routing.ColdStart; cold.Enabled {
+		routerEngine.SetColdStart(router.ColdStartOptions{
+			Observations: cold.Observations,
+			Bonus:        cold.Bonus,
+			MaxShare:     cold.MaxShare,
+		})
+	}
 
 	// Initialize health checker
 	healthChecker := health.NewChecker(
 		time.Duration(cfg.HealthCheck.Interval)*time.Second,
 		time.Duration(cfg.HealthCheck.Timeout)*time.Second,
 	)
-	healthChecker.Start()
-	defer healthChecker.Stop()
+	healthChecker.SetStateStore(stores.State)
+	healthChecker.SetFailureThreshold(cfg.HealthCheck.UnhealthyThreshold)
+	if cfg.HealthCheck.Active {
+		if err := healthChecker.SetProber(db, channelMgr.Probe); err != nil {
+			return err
+		}
+	}
+	if err := channelMgr.SetHealthChecker(healthChecker); err != nil {
+		return err
+	}
+	routerEngine.AddHealthSource(healthChecker)
+	healthInterval := time.Duration(cfg.HealthCheck.Interval) * time.Second
+	jobs.Add(scheduler.Job{
+		Name:     "health_check",
+		Interval: healthInterval,
+		Jitter:   healthInterval / 10,
+		Run:      healthChecker.CheckAll,
+	})
+
+	// Apply the settings that can change without a restart when config.yaml
+	// is edited
+	cfgSvc.Subscribe(func(old, cfg *config.Config) {
+		if cfg.Session.IdleTimeout != old.Session.IdleTimeout {
+			sessionMgr.SetIdleTimeout(cfg.Session.IdleTimeout)
+			log.Printf("Session idle timeout set to %d minutes", cfg.Session.IdleTimeout)
+		}
+		if h := cfg.HealthCheck; h.Interval != old.HealthCheck.Interval || h.Timeout != old.HealthCheck.Timeout {
+			interval := time.Duration(h.Interval) * time.Second
+			healthChecker.SetTiming(interval, time.Duration(h.Timeout)*time.Second)
+			jobs.Reschedule("health_check", interval, interval/10)
+			log.Printf("Health checks set to every %ds with a %ds timeout", h.Interval, h.Timeout)
+		}
+		if n := cfg.HealthCheck.UnhealthyThreshold; n != old.HealthCheck.UnhealthyThreshold {
+			healthChecker.SetFailureThreshold(n)
+			log.Printf("Health check unhealthy threshold set to %d", n)
+		}
+		if r := cfg.Upstream.Retry; !reflect.DeepEqual(r, old.Upstream.Retry) {
+			channelMgr.SetRetryPolicy(retryPolicy(r))
+			log.Printf("Upstream retry policy set to %d attempts, %dms initial delay", r.MaxAttempts, r.InitialDelayMs)
+		}
+	})
+	if err := cfgSvc.Watch(); err != nil {
+		return err
+	}
+	defer cfgSvc.Stop()
+
+	// Circuit breakers take failing channels out of routing until a probe
+	// or request succeeds again
+	var breakers *breaker.Breakers
+	if br := cfg.Breaker; br.Enabled {
+		breakers = breaker.New(breaker.Options{
+			ConsecutiveFailures: br.ConsecutiveFailures,
+			ErrorRate:           br.ErrorRate,
+			MinRequests:         br.MinRequests,
+			Window:              time.Duration(br.Window) * time.Second,
+			OpenDuration:        time.Duration(br.OpenDuration) * time.Second,
+			ProbeTimeout:        time.Duration(cfg.HealthCheck.Timeout) * time.Second,
+		})
+		breakers.SetProber(db, channelMgr.Probe)
+		routerEngine.AddHealthSource(breakers)
+		jobs.Add(scheduler.Job{
+			Name:     "circuit_breaker",
+			Interval: breaker.PollInterval,
+			Run:      breakers.ProbeOpen,
+		})
+	}
 
-	// Setup Gin
-	r := gin.Default()
+	// Setup Gin. Panics are recovered by api.Recovery, inside the metrics
+	// middleware so recovered requests are counted as 500s.
+	r := gin.New()
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		return fmt.Errorf("invalid server trusted_proxies: %w", err)
+	}
+	r.Use(gin.Logger())
 
 	// Apply metrics middleware
+	if err := metrics.Configure(metrics.LabelOptions{
+		DisableModelLabel: cfg.Metrics.DisableModelLabel,
+		ModelGroups:       cfg.Metrics.ModelGroups,
+	}); err != nil {
+		return err
+	}
 	r.Use(metrics.Middleware())
+	r.Use(api.Recovery())
+
+	// Cluster membership, published through the shared store
+	clusterRegistry := cluster.NewRegistry(stores.Members)
+	r.Use(clusterRegistry.Middleware())
+	jobs.Add(scheduler.Job{
+		Name:      "cluster_heartbeat",
+		Interval:  cluster.HeartbeatInterval,
+		Immediate: true,
+		Run:       clusterRegistry.Heartbeat,
+		Final:     clusterRegistry.Leave,
+	})
 
 	// Health check endpoint
 	r.GET("/health", func(c *gin.Context) {
@@ -71,29 +307,373 @@ func Run() error {
 		r.GET("/metrics", metrics.Handler())
 	}
 
+	// Push metrics to StatsD or an OTLP collector
+	if cfg.Metrics.Exporter != "" {
+		pusher, err := metrics.NewPusher(metrics.PushOptions{
+			Exporter: cfg.Metrics.Exporter,
+			Endpoint: cfg.Metrics.Endpoint,
+			Interval: time.Duration(cfg.Metrics.PushInterval) * time.Second,
+			Prefix:   cfg.Metrics.Prefix,
+		})
+		if err != nil {
+			return err
+		}
+		// A final push after the other jobs stopped sends their last counts
+		push := func(context.Context) error { return pusher.Push() }
+		jobs.Add(scheduler.Job{
+			Name:     "metrics_push",
+			Interval: pusher.Interval(),
+			Run:      push,
+			Final:    push,
+		})
+	}
+
 	// Initialize auth middleware
 	authMiddleware := auth.NewMiddleware(db)
 
+	// Alerts
+	notifier := alert.NewNotifier(cfg.Alerts.WebhookURL)
+
+	// Provider status pages
+	var statusMonitor *statuspage.Monitor
+	if pages := cfg.StatusPages; len(pages.Providers) > 0 {
+		providers := make([]statuspage.Provider, 0, len(pages.Providers))
+		for _, p := range pages.Providers {
+			providers = append(providers, statuspage.Provider{
+				Name:       p.Name,
+				URL:        p.URL,
+				Channels:   p.Channels,
+				Components: p.Components,
+			})
+		}
+		statusMonitor = statuspage.NewMonitor(providers, pages.MinImpact, notifier)
+		pollInterval := time.Duration(pages.Interval) * time.Second
+		jobs.Add(scheduler.Job{
+			Name:      "status_pages",
+			Interval:  pollInterval,
+			Jitter:    pollInterval / 10,
+			Immediate: true,
+			Run: func(ctx context.Context) error {
+				statusMonitor.Poll(ctx)
+				return nil
+			},
+		})
+		routerEngine.SetIncidentSource(statusMonitor)
+	}
+
+	// Feature flags gating new behaviors
+	featureFlags := flags.New(db)
+
 	// OpenAI API routes
 	apiHandler := api.NewHandler(routerEngine, channelMgr, db)
+	apiHandler.SetMetricsStore(stores.Metrics)
+	apiHandler.SetNotifier(notifier)
+	apiHandler.SetFeatureFlags(featureFlags)
+	quotaChecker := quota.New(db)
+	quotaChecker.SetRateLimits(stores.RateLimits)
+	apiHandler.SetQuota(quotaChecker)
+	apiHandler.SetStreamUsage(cfg.Usage.StreamUsage)
+	apiHandler.SetStreamHeartbeat(time.Duration(cfg.Server.StreamHeartbeat) * time.Second)
+	apiHandler.SetBufferLimit(int64(cfg.Upstream.MaxBufferedResponseKB) * 1024)
+	if rc := cfg.Replay; rc.Capture {
+		recorder, err := replay.NewRecorder(replay.Options{
+			File:          rc.File,
+			SampleRate:    rc.SampleRate,
+			RedactContent: rc.RedactContent,
+		})
+		if err != nil {
+			return err
+		}
+		defer recorder.Close()
+		apiHandler.SetCapture(recorder)
+		log.Printf("Capturing %.0f%% of requests to %s for replay", rc.SampleRate*100, rc.File)
+	}
+	if cfg.ErrorBudget.Enabled {
+		apiHandler.SetErrorBudget(budget.NewTracker(budget.Options{
+			Window:      time.Duration(cfg.ErrorBudget.Window) * time.Second,
+			Threshold:   cfg.ErrorBudget.Threshold,
+			MinRequests: cfg.ErrorBudget.MinRequests,
+		}, stores.RateLimits, stores.State, notifier))
+	}
+	if cfg.Dedup.Enabled {
+		apiHandler.SetDeduplicator(dedup.New(dedup.Options{
+			Window:   time.Duration(cfg.Dedup.WindowMs) * time.Millisecond,
+			Coalesce: cfg.Dedup.Coalesce,
+		}))
+	}
+	if cfg.Quality.Enabled {
+		apiHandler.EnableQualitySignals()
+	}
+	if breakers != nil {
+		apiHandler.SetBreakers(breakers)
+	}
 	openaiGroup := r.Group("/v1")
+	openaiGroup.Use(timeout.Middleware(time.Duration(cfg.Server.ProxyTimeout) * time.Second))
 	apiHandler.RegisterRoutes(openaiGroup, authMiddleware)
 
 	// Admin API routes
 	adminHandler := admin.NewHandler(channelMgr, sessionMgr, db)
+	adminHandler.SetMetricsStore(stores.Metrics)
+	adminHandler.SetHealthChecker(healthChecker)
+	if breakers != nil {
+		adminHandler.SetBreakers(breakers)
+	}
+	adminHandler.SetClusterRegistry(clusterRegistry)
+	adminHandler.SetFeatureFlags(featureFlags)
+	if statusMonitor != nil {
+		adminHandler.SetStatusMonitor(statusMonitor)
+	}
+	if cfg.Probes.Enabled {
+		probeRunner := probe.NewRunner(db, healthChecker, probe.Options{
+			Timeout:   time.Duration(cfg.Probes.Timeout) * time.Second,
+			Retention: time.Duration(cfg.Probes.RetentionHours) * time.Hour,
+		})
+		jobs.Add(scheduler.Job{
+			Name:     "probes",
+			Interval: probe.PollInterval,
+			Jitter:   probe.PollInterval / 10,
+			Run: func(ctx context.Context) error {
+				probeRunner.RunDue(ctx, time.Now())
+				return nil
+			},
+		})
+		adminHandler.SetProbeRunner(probeRunner)
+	}
+	if len(cfg.SLO.Objectives) > 0 {
+		objectives := make([]slo.Objective, 0, len(cfg.SLO.Objectives))
+		for _, o := range cfg.SLO.Objectives {
+			objectives = append(objectives, slo.Objective{
+				Name:             o.Name,
+				Model:            o.Model,
+				Type:             o.Type,
+				Target:           o.Target,
+				LatencyThreshold: time.Duration(o.LatencyThresholdMs) * time.Millisecond,
+			})
+		}
+		evaluationInterval := time.Duration(cfg.SLO.EvaluationInterval) * time.Second
+		evaluator := slo.NewEvaluator(objectives, evaluationInterval, notifier)
+		jobs.Add(scheduler.Job{
+			Name:      "slo_evaluation",
+			Interval:  evaluationInterval,
+			Immediate: true,
+			Run: func(context.Context) error {
+				evaluator.Evaluate(time.Now())
+				return nil
+			},
+		})
+		adminHandler.SetSLOEvaluator(evaluator)
+	}
+	adminGuard, err := adminguard.New(adminguard.Options{
+		MutationLimit: cfg.Admin.MutationLimit,
+		Window:        time.Duration(cfg.Admin.RateLimitWindow) * time.Second,
+		AllowedIPs:    cfg.Admin.AllowedIPs,
+	}, stores.RateLimits)
+	if err != nil {
+		return err
+	}
 	adminGroup := r.Group("/api")
+	adminGroup.Use(timeout.Middleware(time.Duration(cfg.Server.AdminTimeout) * time.Second))
+	adminGroup.Use(adminGuard.AllowIPs())
+	adminGroup.Use(authMiddleware.RequireAdmin())
+	adminGroup.Use(adminGuard.LimitMutations())
 	adminHandler.RegisterRoutes(adminGroup)
 
 	// Model management routes
 	modelHandler := model.NewHandler(db)
-	modelGroup := r.Group("/api")
-	modelHandler.RegisterRoutes(modelGroup)
+	modelHandler.RegisterRoutes(adminGroup)
+
+	// Declarative state routes
+	stateHandler := reconcile.NewHandler(reconciler)
+	stateHandler.RegisterRoutes(adminGroup)
+
+	// Sync state from a mounted ConfigMap/Secret directory
+	if cfg.Kubernetes.Enabled {
+		stateWatcher := reconcile.NewWatcher(reconciler, cfg.Kubernetes.ConfigDir)
+		if err := stateWatcher.Start(); err != nil {
+			return err
+		}
+		defer stateWatcher.Stop()
+	}
+
+	// SCIM user provisioning
+	if cfg.SCIM.Enabled {
+		scimHandler := scim.NewHandler(db, cfg.SCIM.Token)
+		scimGroup := r.Group("/scim/v2")
+		scimHandler.RegisterRoutes(scimGroup)
+	}
 
 	// Web UI
 	webHandler := web.NewHandler()
 	webHandler.RegisterRoutes(r)
 
+	// Terminate TLS with a certificate reloaded as it is rotated
+	var tlsConfig *tls.Config
+	if t := cfg.Server.TLS; t.Enabled {
+		certReloader, err := certs.NewReloader(t.CertFile, t.KeyFile)
+		if err != nil {
+			return err
+		}
+		tlsConfig = certReloader.TLSConfig()
+		if t.ReloadInterval > 0 {
+			reloadInterval := time.Duration(t.ReloadInterval) * time.Second
+			jobs.Add(scheduler.Job{
+				Name:     "tls_reload",
+				Interval: reloadInterval,
+				Jitter:   reloadInterval / 10,
+				Run:      certReloader.Reload,
+			})
+		}
+	}
+
+	jobs.Start()
+
 	addr := fmt.Sprintf("%s:%d", cfg.Server.Host, cfg.Server.Port)
-	log.Printf("Server starting on %s", addr)
-	return r.Run(addr)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	if tlsConfig != nil {
+		log.Printf("Server starting on %s with TLS", addr)
+	} else {
+		log.Printf("Server starting on %s", addr)
+	}
+
+	// Drain requests in flight on SIGTERM or SIGINT, then stop the
+	// background jobs and close the stores and database as Run returns
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	drain := time.Duration(cfg.Server.ShutdownTimeout) * time.Second
+
+	if t := cfg.Server.TLS; t.Enabled && t.RedirectHTTP {
+		redirectAddr := fmt.Sprintf("%s:%d", cfg.Server.Host, t.HTTPPort)
+		redirectLn, err := net.Listen("tcp", redirectAddr)
+		if err != nil {
+			return err
+		}
+		log.Printf("Redirecting HTTP on %s to HTTPS", redirectAddr)
+		go func() {
+			if err := serve(ctx, newServer(cfg.Server, redirectHTTPS(cfg.Server.Port), nil), redirectLn, drain); err != nil {
+				log.Printf("HTTP redirect server failed: %v", err)
+			}
+		}()
+	}
+
+	return serve(ctx, newServer(cfg.Server, r, tlsConfig), ln, drain)
+}
+
+// newServer creates an HTTP server that gives clients the configured time to
+// send their requests, so slow or stalled clients cannot hold connections
+// open. There is no write timeout, since it would cut off streams.
+func newServer(cfg config.ServerConfig, handler http.Handler, tlsConfig *tls.Config) *http.Server {
+	return &http.Server{
+		Handler:           handler,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: time.Duration(cfg.ReadHeaderTimeout) * time.Second,
+		ReadTimeout:       time.Duration(cfg.ReadTimeout) * time.Second,
+	}
+}
+
+// logBootstrap reports what bootstrapping seeded. Generated credentials are
+// logged once, since they cannot be retrieved later.
+func logBootstrap(result *bootstrap.Result) {
+	if !result.Seeded {
+		log.Printf("Bootstrap skipped: database already has data")
+		return
+	}
+	log.Printf("Bootstrap: seeded empty database with %d state changes", len(result.Changes))
+	if result.GeneratedAdminToken != "" {
+		log.Printf("Bootstrap: generated admin token %s", result.GeneratedAdminToken)
+	}
+	if result.GeneratedUserAPIKey != "" {
+		log.Printf("Bootstrap: generated API key for user %q: %s", bootstrap.UserName, result.GeneratedUserAPIKey)
+	}
+}
+
+// rollupUsage replaces usage logs older than usage.RollupAfterDays with
+// hourly aggregates, and merges hourly aggregates older than
+// usage.DailyAfterDays into daily ones
+func rollupUsage(db *database.DB, usage config.UsageConfig, now time.Time) error {
+	if usage.RollupAfterDays > 0 {
+		n, err := db.RollupUsageLogs(now.AddDate(0, 0, -usage.RollupAfterDays))
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			log.Printf("Rolled up %d usage logs into hourly aggregates", n)
+		}
+	}
+	if usage.DailyAfterDays > 0 {
+		n, err := db.RollupHourlyUsage(now.AddDate(0, 0, -usage.DailyAfterDays))
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			log.Printf("Merged %d hourly usage aggregates into daily ones", n)
+		}
+	}
+	return nil
+}
+
+// chaosFaults converts the configured chaos faults
+func chaosFaults(cfg config.ChaosConfig) []chaos.Fault {
+	faults := make([]chaos.Fault, 0, len(cfg.Faults))
+	for _, f := range cfg.Faults {
+		faults = append(faults, chaos.Fault{
+			Channels:       f.Channels,
+			Latency:        time.Duration(f.LatencyMs) * time.Millisecond,
+			LatencyRate:    f.LatencyRate,
+			ErrorRate:      f.ErrorRate,
+			ErrorStatus:    f.ErrorStatus,
+			DropRate:       f.DropRate,
+			DropAfterBytes: f.DropAfterBytes,
+		})
+	}
+	return faults
+}
+
+// retryPolicy converts the configured upstream retry policy
+func retryPolicy(cfg config.RetryConfig) channel.RetryPolicy {
+	return channel.RetryPolicy{
+		MaxAttempts:       cfg.MaxAttempts,
+		InitialDelay:      time.Duration(cfg.InitialDelayMs) * time.Millisecond,
+		Multiplier:        cfg.Multiplier,
+		MaxDelay:          time.Duration(cfg.MaxDelayMs) * time.Millisecond,
+		RetryableStatuses: cfg.RetryableStatuses,
+	}
+}
+
+// migrateSchema applies pending migrations when auto_migrate is on, and
+// otherwise refuses to run against an outdated schema. A schema newer than
+// this build is only warned about, since migrations add to it.
+func migrateSchema(db *database.DB, cfg config.DatabaseConfig) error {
+	if cfg.AutoMigrate {
+		run, err := db.Migrate()
+		if err != nil {
+			return fmt.Errorf("failed to run migrations: %w", err)
+		}
+		for _, m := range run {
+			log.Printf("Applied migration %s", m)
+		}
+	} else {
+		pending, err := db.PendingMigrations()
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			return fmt.Errorf("database has %d pending migrations, run gateway migrate", len(pending))
+		}
+	}
+
+	version, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	migrations, err := database.Migrations()
+	if err != nil {
+		return err
+	}
+	if latest := migrations[len(migrations)-1].Version; version > latest {
+		log.Printf("Warning: database schema version %d is newer than this gateway's %d", version, latest)
+	}
+	return nil
 }
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/X0Ken/openai-gateway/internal/config"
+	"github.com/X0Ken/openai-gateway/pkg/database"
+)
+
+// Migrate applies or reverts schema migrations of the configured database.
+// Its first argument is up, the default, down or status.
+func Migrate(args []string) error {
+	action := "up"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		action, args = args[0], args[1:]
+	}
+	if action != "up" && action != "down" && action != "status" {
+		return fmt.Errorf("unknown migrate action %q, expected up, down or status", action)
+	}
+
+	fs := flag.NewFlagSet("migrate "+action, flag.ContinueOnError)
+	to := fs.Int("to", -1, "version to migrate to (up defaults to the latest)")
+	steps := fs.Int("steps", 1, "number of migrations down reverts when -to is not set")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfgSvc, err := config.NewService("config.yaml")
+	if err != nil {
+		return err
+	}
+
+	db, err := database.Open(cfgSvc.Get().Database.Path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	statuses, err := db.MigrationStatus()
+	if err != nil {
+		return err
+	}
+	if action == "status" {
+		printMigrationStatus(os.Stdout, statuses)
+		return nil
+	}
+
+	current, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	target, err := migrationTarget(action, statuses, *to, *steps)
+	if err != nil {
+		return err
+	}
+	if action == "up" && target < current {
+		return fmt.Errorf("version %d is below the current %d, use migrate down", target, current)
+	}
+	if action == "down" && target > current {
+		return fmt.Errorf("version %d is above the current %d, use migrate up", target, current)
+	}
+
+	run, err := db.MigrateTo(target)
+	for _, m := range run {
+		if action == "up" {
+			fmt.Printf("applied %s\n", m)
+		} else {
+			fmt.Printf("reverted %s\n", m)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if len(run) == 0 {
+		fmt.Printf("schema is at version %d, nothing to do\n", current)
+	}
+	return nil
+}
+
+// migrationTarget returns the version an up or down run migrates to. Up
+// defaults to the latest migration; down defaults to reverting steps of the
+// applied ones.
+func migrationTarget(action string, statuses []database.MigrationStatus, to, steps int) (int, error) {
+	if to >= 0 {
+		return to, nil
+	}
+	if action == "up" {
+		if len(statuses) == 0 {
+			return 0, nil
+		}
+		return statuses[len(statuses)-1].Version, nil
+	}
+
+	if steps < 1 {
+		return 0, fmt.Errorf("steps must be at least 1")
+	}
+	var applied []int
+	for _, s := range statuses {
+		if s.Applied {
+			applied = append(applied, s.Version)
+		}
+	}
+	if steps >= len(applied) {
+		return 0, nil
+	}
+	return applied[len(applied)-steps-1], nil
+}
+
+// printMigrationStatus writes each migration and when it was applied
+func printMigrationStatus(w io.Writer, statuses []database.MigrationStatus) {
+	for _, s := range statuses {
+		if s.Applied {
+			fmt.Fprintf(w, "%s: applied %s\n", s.Migration, s.AppliedAt.Format("2006-01-02 15:04:05"))
+		} else {
+			fmt.Fprintf(w, "%s: pending\n", s.Migration)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+)
+
+func TestMigrationTarget(t *testing.T) {
+	statuses := []database.MigrationStatus{
+		{Migration: database.Migration{Version: 1}, Applied: true},
+		{Migration: database.Migration{Version: 2}, Applied: true},
+		{Migration: database.Migration{Version: 3}, Applied: true},
+		{Migration: database.Migration{Version: 4}},
+	}
+
+	tests := []struct {
+		action    string
+		to, steps int
+		want      int
+	}{
+		{"up", -1, 1, 4},
+		{"up", 3, 1, 3},
+		{"down", -1, 1, 2},
+		{"down", -1, 2, 1},
+		{"down", -1, 5, 0},
+		{"down", 1, 1, 1},
+	}
+	for _, tt := range tests {
+		got, err := migrationTarget(tt.action, statuses, tt.to, tt.steps)
+		if err != nil || got != tt.want {
+			t.Errorf("%s -to %d -steps %d: expected %d, got %d (%v)", tt.action, tt.to, tt.steps, tt.want, got, err)
+		}
+	}
+
+	if _, err := migrationTarget("down", statuses, -1, 0); err == nil {
+		t.Error("Expected zero steps to be rejected")
+	}
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+
+	"github.com/X0Ken/openai-gateway/internal/replay"
+)
+
+// Replay sends the requests of a capture file to another gateway and prints
+// a summary of the responses. With -follow it tails the file, replaying
+// production traffic as it is captured, until interrupted.
+func Replay(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	file := fs.String("file", "./capture.jsonl", "capture file to replay")
+	target := fs.String("target", "", "base URL of the gateway to replay against")
+	key := fs.String("key", os.Getenv("REPLAY_API_KEY"), "API key for the target gateway (default $REPLAY_API_KEY)")
+	rate := fs.Float64("rate", 0, "requests per second; 0 keeps the recorded pace")
+	speed := fs.Float64("speed", 1, "multiplier of the recorded pace when -rate is 0")
+	concurrency := fs.Int("concurrency", 8, "maximum requests in flight")
+	follow := fs.Bool("follow", false, "keep replaying records as they are captured")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *target == "" {
+		return fmt.Errorf("-target is required")
+	}
+	if *key == "" {
+		return fmt.Errorf("-key or REPLAY_API_KEY is required")
+	}
+	if *rate < 0 || *speed <= 0 {
+		return fmt.Errorf("-rate cannot be negative and -speed must be positive")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	records := make(chan replay.Record)
+	read := make(chan error, 1)
+	go func() { read <- replay.Read(ctx, *file, *follow, records) }()
+
+	summary := replay.NewReplayer(replay.ReplayOptions{
+		Target:      *target,
+		APIKey:      *key,
+		Rate:        *rate,
+		Speed:       *speed,
+		Concurrency: *concurrency,
+	}).Run(ctx, records)
+
+	printReplaySummary(os.Stdout, summary)
+	return <-read
+}
+
+// printReplaySummary writes a human-readable replay summary
+func printReplaySummary(w io.Writer, s *replay.Summary) {
+	fmt.Fprintf(w, "sent: %d\n", s.Sent)
+	fmt.Fprintf(w, "failed: %d\n", s.Failed)
+
+	codes := make([]int, 0, len(s.Statuses))
+	for code := range s.Statuses {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		fmt.Fprintf(w, "status %d: %d\n", code, s.Statuses[code])
+	}
+
+	fmt.Fprintf(w, "latency: p50 %s, p95 %s, max %s\n", s.P50, s.P95, s.Max)
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/internal/api"
+)
+
+// cutoffGrace is how long requests cut off at the end of a drain have to
+// write their final response before their connections are closed
+const cutoffGrace = 5 * time.Second
+
+// serve runs srv on ln, over TLS when srv has a TLS configuration, until
+// ctx is cancelled, then shuts it down gracefully. The listener is closed
+// at once and requests in flight get up to drain to finish. Requests still
+// running then, such as long streams, are cancelled with
+// api.ErrShuttingDown so they end with an error event instead of a dropped
+// connection, and their connections are closed after cutoffGrace.
+func serve(ctx context.Context, srv *http.Server, ln net.Listener, drain time.Duration) error {
+	base, cutOff := context.WithCancelCause(context.Background())
+	defer cutOff(nil)
+	srv.BaseContext = func(net.Listener) context.Context { return base }
+
+	served := make(chan error, 1)
+	go func() {
+		if srv.TLSConfig != nil {
+			served <- srv.ServeTLS(ln, "", "")
+		} else {
+			served <- srv.Serve(ln)
+		}
+	}()
+
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("Shutting down: draining requests in flight for up to %s", drain)
+	drainCtx, cancel := context.WithTimeout(context.Background(), drain)
+	defer cancel()
+	err := srv.Shutdown(drainCtx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		log.Printf("Drain timeout reached: cutting off the remaining requests")
+		cutOff(api.ErrShuttingDown)
+
+		graceCtx, cancel := context.WithTimeout(context.Background(), cutoffGrace)
+		defer cancel()
+		if err = srv.Shutdown(graceCtx); err != nil {
+			err = srv.Close()
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	log.Printf("Server stopped")
+	return nil
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/internal/api"
+)
+
+// startServe serves handler until the returned cancel is called, reporting
+// serve's result on the returned channel
+func startServe(t *testing.T, handler http.Handler, drain time.Duration) (string, context.CancelFunc, <-chan error) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- serve(ctx, &http.Server{Handler: handler}, ln, drain) }()
+	return "http://" + ln.Addr().String(), cancel, done
+}
+
+func TestServeDrainsRequestsInFlight(t *testing.T) {
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("done"))
+	})
+	url, shutdown, done := startServe(t, handler, 5*time.Second)
+
+	type result struct {
+		body string
+		err  error
+	}
+	results := make(chan result, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err != nil {
+			results <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		results <- result{string(body), err}
+	}()
+
+	<-started
+	shutdown()
+	if res := <-results; res.err != nil || res.body != "done" {
+		t.Errorf("Expected the request in flight to complete, got %q, %v", res.body, res.err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Expected a clean shutdown, got %v", err)
+	}
+
+	// New connections are refused
+	if _, err := http.Get(url); err == nil {
+		t.Error("Expected requests after the shutdown to fail")
+	}
+}
+
+func TestServeCutsOffRequestsAfterDrain(t *testing.T) {
+	started := make(chan struct{})
+	cause := make(chan error, 1)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		close(started)
+		<-r.Context().Done()
+		cause <- context.Cause(r.Context())
+		w.Write([]byte("cut off"))
+	})
+	url, shutdown, done := startServe(t, handler, 100*time.Millisecond)
+
+	go func() {
+		if resp, err := http.Get(url); err == nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+	}()
+
+	<-started
+	start := time.Now()
+	shutdown()
+	select {
+	case err := <-cause:
+		if !errors.Is(err, api.ErrShuttingDown) {
+			t.Errorf("Expected the request cancelled with ErrShuttingDown, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the request to be cancelled after the drain timeout")
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Expected a clean shutdown, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > cutoffGrace {
+		t.Errorf("Expected shutdown to finish once the request ended, took %s", elapsed)
+	}
+}
@@ -0,0 +1,23 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// redirectHTTPS redirects every request to the same URL over HTTPS on port
+func redirectHTTPS(port int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(port))
+		}
+		// Permanent, and keeping the method and body, so API clients
+		// retry the same request over HTTPS
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
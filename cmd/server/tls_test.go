@@ -0,0 +1,70 @@
+package server
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/internal/config"
+)
+
+func TestRedirectHTTPS(t *testing.T) {
+	tests := []struct {
+		port   int
+		target string
+		want   string
+	}{
+		{443, "http://gateway.example.com/v1/models?x=1", "https://gateway.example.com/v1/models?x=1"},
+		{443, "http://gateway.example.com:80/v1/models", "https://gateway.example.com/v1/models"},
+		{8443, "http://gateway.example.com:8080/health", "https://gateway.example.com:8443/health"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		redirectHTTPS(tt.port).ServeHTTP(w, httptest.NewRequest("POST", tt.target, nil))
+		if w.Code != http.StatusPermanentRedirect || w.Header().Get("Location") != tt.want {
+			t.Errorf("%s: expected 308 to %s, got %d to %s", tt.target, tt.want, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
+
+func TestServerClosesSlowClients(t *testing.T) {
+	srv := newServer(config.ServerConfig{ReadHeaderTimeout: 1, ReadTimeout: 1}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A response may outlast the read timeout
+		for range 3 {
+			time.Sleep(500 * time.Millisecond)
+			w.Write([]byte("tick\n"))
+			w.(http.Flusher).Flush()
+		}
+	}), nil)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	// A client that never finishes its headers is cut off
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("GET / HTTP/1.1\r\nHost: gateway\r\n"))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadAll(conn); err != nil {
+		t.Errorf("Expected the server to close the connection, got %v", err)
+	}
+
+	resp, err := http.Get("http://" + ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil || string(body) != "tick\ntick\ntick\n" {
+		t.Errorf("Expected the whole response, got %q, %v", body, err)
+	}
+}
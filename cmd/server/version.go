@@ -0,0 +1,13 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/X0Ken/openai-gateway/internal/version"
+)
+
+// Version prints the build version
+func Version(args []string) error {
+	fmt.Println(version.Get())
+	return nil
+}
@@ -0,0 +1,95 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+// defaultAnalyticsRange is the time range reported when ?from= is omitted
+const defaultAnalyticsRange = 24 * time.Hour
+
+// GetAnalytics returns chat completion aggregates: request counts, average
+// prompt and completion sizes and finish reasons. Query parameters:
+// model, user_id and end_user filter, from and to (RFC 3339) bound the
+// range, interval (e.g. 1h, 24h) sets the bucket width and
+// group_by=model,user,end_user splits buckets.
+func (h *Handler) GetAnalytics(c *gin.Context) {
+	q := database.AnalyticsQuery{
+		Model:    c.Query("model"),
+		EndUser:  c.Query("end_user"),
+		To:       time.Now(),
+		Interval: time.Hour,
+	}
+
+	if value := c.Query("user_id"); value != "" {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id"})
+			return
+		}
+		q.UserID = id
+	}
+
+	if value := c.Query("to"); value != "" {
+		to, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to, expected RFC 3339"})
+			return
+		}
+		q.To = to
+	}
+	q.From = q.To.Add(-defaultAnalyticsRange)
+	if value := c.Query("from"); value != "" {
+		from, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from, expected RFC 3339"})
+			return
+		}
+		q.From = from
+	}
+	if !q.From.Before(q.To) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return
+	}
+
+	if value := c.Query("interval"); value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval < time.Hour || interval%time.Hour != 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "interval must be a whole number of hours"})
+			return
+		}
+		q.Interval = interval
+	}
+
+	if value := c.Query("group_by"); value != "" {
+		for _, group := range strings.Split(value, ",") {
+			switch strings.TrimSpace(group) {
+			case "model":
+				q.ByModel = true
+			case "user":
+				q.ByUser = true
+			case "end_user":
+				q.ByEndUser = true
+			default:
+				c.JSON(http.StatusBadRequest, gin.H{"error": "group_by must list model, user or end_user"})
+				return
+			}
+		}
+	}
+
+	buckets, err := h.db.QueryAnalytics(q)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if buckets == nil {
+		buckets = []*database.AnalyticsBucket{}
+	}
+
+	c.JSON(http.StatusOK, buckets)
+}
@@ -0,0 +1,201 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/internal/auth"
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+// CreateAPIKeyRequest represents an API key creation request. Keys without
+// expires_at never expire; keys without allowed_models may call every model
+// their user may.
+type CreateAPIKeyRequest struct {
+	Name          string     `json:"name" binding:"required"`
+	ExpiresAt     *time.Time `json:"expires_at"`
+	AllowedModels []string   `json:"allowed_models"`
+}
+
+// UpdateAPIKeyRequest represents an API key update request. Omitted fields
+// are left unchanged.
+type UpdateAPIKeyRequest struct {
+	Name          *string    `json:"name"`
+	Enabled       *bool      `json:"enabled"`
+	ExpiresAt     *time.Time `json:"expires_at"`
+	AllowedModels *[]string  `json:"allowed_models"`
+}
+
+// lookupKeyOwner loads the user named by the ID parameter, writing an error
+// response and returning nil when it cannot
+func (h *Handler) lookupKeyOwner(c *gin.Context) *database.User {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return nil
+	}
+
+	user, err := h.db.GetUser(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil
+	}
+	if user == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return nil
+	}
+	return user
+}
+
+// lookupAPIKey loads the key named by the key_id parameter of the user named
+// by the ID parameter, writing an error response and returning nil when it
+// cannot
+func (h *Handler) lookupAPIKey(c *gin.Context) *database.APIKey {
+	user := h.lookupKeyOwner(c)
+	if user == nil {
+		return nil
+	}
+
+	id, err := strconv.ParseInt(c.Param("key_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid API key ID"})
+		return nil
+	}
+
+	key, err := h.db.GetAPIKey(user.ID, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil
+	}
+	if key == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return nil
+	}
+	return key
+}
+
+// CreateAPIKey generates an additional API key for a user. Its value is only
+// returned in this response.
+func (h *Handler) CreateAPIKey(c *gin.Context) {
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user := h.lookupKeyOwner(c)
+	if user == nil {
+		return
+	}
+
+	value, err := auth.GenerateAPIKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	key := &database.APIKey{
+		UserID:        user.ID,
+		Name:          req.Name,
+		Key:           value,
+		Enabled:       true,
+		ExpiresAt:     req.ExpiresAt,
+		AllowedModels: req.AllowedModels,
+	}
+	if err := h.db.CreateAPIKey(key); err != nil {
+		c.JSON(database.StatusForError(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := h.recordAudit(c, "create", "api_key", key.ID, nil, gin.H{"user_id": user.ID, "name": key.Name, "expires_at": key.ExpiresAt}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, key)
+}
+
+// ListAPIKeys lists a user's API keys, the primary key first, without their
+// values
+func (h *Handler) ListAPIKeys(c *gin.Context) {
+	user := h.lookupKeyOwner(c)
+	if user == nil {
+		return
+	}
+
+	keys, err := h.db.ListAPIKeys(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// UpdateAPIKey renames, disables or re-enables an API key, or changes its
+// expiry or allowed models
+func (h *Handler) UpdateAPIKey(c *gin.Context) {
+	var req UpdateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	key := h.lookupAPIKey(c)
+	if key == nil {
+		return
+	}
+	before := *key
+
+	if req.Name != nil {
+		key.Name = *req.Name
+	}
+	if req.Enabled != nil {
+		key.Enabled = *req.Enabled
+	}
+	if req.ExpiresAt != nil {
+		key.ExpiresAt = req.ExpiresAt
+	}
+	if req.AllowedModels != nil {
+		key.AllowedModels = *req.AllowedModels
+	}
+
+	if err := h.db.UpdateAPIKey(key); err != nil {
+		c.JSON(database.StatusForError(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := h.recordAudit(c, "update", "api_key", key.ID, before, key); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, key)
+}
+
+// RevokeAPIKey deletes an API key, rejecting requests made with it at once.
+// A user's primary key is rotated instead.
+func (h *Handler) RevokeAPIKey(c *gin.Context) {
+	key := h.lookupAPIKey(c)
+	if key == nil {
+		return
+	}
+	if key.Primary {
+		c.JSON(http.StatusConflict, gin.H{"error": "the primary key cannot be revoked, rotate or disable it instead"})
+		return
+	}
+
+	if err := h.db.DeleteAPIKey(key.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := h.recordAudit(c, "delete", "api_key", key.ID, key, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,76 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+// Audit log limits
+const (
+	defaultAuditLimit = 50
+	maxAuditLimit     = 500
+)
+
+// recordAudit appends an audit entry for an admin action, snapshotting the
+// before and after states as JSON
+func (h *Handler) recordAudit(c *gin.Context, action, targetType string, targetID int64, before, after any) (*database.AuditEntry, error) {
+	entry := &database.AuditEntry{
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Actor:      c.ClientIP(),
+	}
+
+	var err error
+	if entry.Before, err = json.Marshal(before); err != nil {
+		return nil, err
+	}
+	if entry.After, err = json.Marshal(after); err != nil {
+		return nil, err
+	}
+
+	if err := h.db.CreateAuditEntry(entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// ListAudit lists recent audit entries, optionally for one target given by
+// ?target_type=channel&target_id=1
+func (h *Handler) ListAudit(c *gin.Context) {
+	limit := defaultAuditLimit
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+			return
+		}
+		limit = min(n, maxAuditLimit)
+	}
+
+	targetType := c.Query("target_type")
+	var targetID int64
+	if targetType != "" {
+		id, err := strconv.ParseInt(c.Query("target_id"), 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "target_id is required with target_type"})
+			return
+		}
+		targetID = id
+	}
+
+	entries, err := h.db.ListAuditEntries(targetType, targetID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if entries == nil {
+		entries = []*database.AuditEntry{}
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
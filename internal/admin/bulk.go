@@ -0,0 +1,141 @@
+package admin
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/X0Ken/openai-gateway/internal/auth"
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+// maxBulkUsers caps the number of users accepted by a single bulk request
+const maxBulkUsers = 1000
+
+// BulkUserEntry describes one user in a bulk provisioning request. When
+// APIKey is empty a key is generated for the user.
+type BulkUserEntry struct {
+	Name   string `json:"name"`
+	APIKey string `json:"api_key"`
+}
+
+// BulkCreateUsersRequest represents a bulk user provisioning request
+type BulkCreateUsersRequest struct {
+	Users []BulkUserEntry `json:"users" binding:"required"`
+}
+
+// BulkCreateUsersResponse lists the created users. Generated API keys are
+// only ever returned here, so callers must distribute them immediately.
+type BulkCreateUsersResponse struct {
+	Created int              `json:"created"`
+	Users   []*database.User `json:"users"`
+}
+
+// BulkCreateUsers creates many users at once from a JSON body or a CSV upload
+// (Content-Type: text/csv) with a header row containing "name" and
+// optionally "api_key". The batch is created atomically.
+func (h *Handler) BulkCreateUsers(c *gin.Context) {
+	var entries []BulkUserEntry
+	if strings.HasPrefix(c.ContentType(), "text/csv") {
+		parsed, err := parseBulkUsersCSV(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		entries = parsed
+	} else {
+		var req BulkCreateUsersRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		entries = req.Users
+	}
+
+	if len(entries) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no users provided"})
+		return
+	}
+	if len(entries) > maxBulkUsers {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("at most %d users per request", maxBulkUsers)})
+		return
+	}
+
+	users := make([]*database.User, 0, len(entries))
+	for _, entry := range entries {
+		apiKey := strings.TrimSpace(entry.APIKey)
+		if apiKey == "" {
+			generated, err := auth.GenerateAPIKey()
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			apiKey = generated
+		}
+
+		users = append(users, &database.User{
+			APIKey: apiKey,
+			Name:   strings.TrimSpace(entry.Name),
+		})
+	}
+
+	if err := h.db.CreateUsers(users); err != nil {
+		c.JSON(database.StatusForError(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, BulkCreateUsersResponse{
+		Created: len(users),
+		Users:   users,
+	})
+}
+
+// parseBulkUsersCSV reads bulk user entries from CSV with a header row
+func parseBulkUsersCSV(r io.Reader) ([]BulkUserEntry, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+
+	nameCol, keyCol := -1, -1
+	for i, col := range header {
+		switch strings.ToLower(strings.TrimSpace(col)) {
+		case "name":
+			nameCol = i
+		case "api_key":
+			keyCol = i
+		}
+	}
+	if nameCol < 0 {
+		return nil, fmt.Errorf("CSV header must contain a name column")
+	}
+
+	var entries []BulkUserEntry
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CSV: %w", err)
+		}
+
+		entry := BulkUserEntry{Name: record[nameCol]}
+		if keyCol >= 0 {
+			entry.APIKey = record[keyCol]
+		}
+		entries = append(entries, entry)
+
+		if len(entries) > maxBulkUsers {
+			return nil, fmt.Errorf("at most %d users per request", maxBulkUsers)
+		}
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,30 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/X0Ken/openai-gateway/internal/cluster"
+	"github.com/gin-gonic/gin"
+)
+
+// ClusterStatus lists the gateway replicas and which one answered
+type ClusterStatus struct {
+	InstanceID string             `json:"instance_id"`
+	Instances  []cluster.Instance `json:"instances"`
+}
+
+// GetClusterStatus returns the replicas that sent a heartbeat recently with
+// their versions, uptime and request rates
+func (h *Handler) GetClusterStatus(c *gin.Context) {
+	if h.cluster == nil {
+		c.JSON(http.StatusOK, ClusterStatus{Instances: []cluster.Instance{}})
+		return
+	}
+
+	instances, err := h.cluster.Instances(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, ClusterStatus{InstanceID: h.cluster.ID(), Instances: instances})
+}
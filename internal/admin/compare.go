@@ -0,0 +1,101 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/X0Ken/openai-gateway/internal/metrics"
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/X0Ken/openai-gateway/pkg/health"
+	"github.com/gin-gonic/gin"
+)
+
+// ChannelComparison is one row of the channel comparison for a model
+type ChannelComparison struct {
+	ChannelID        int64                  `json:"channel_id"`
+	ChannelName      string                 `json:"channel_name"`
+	BackendModelName string                 `json:"backend_model_name"`
+	Weight           int                    `json:"weight"`
+	Enabled          bool                   `json:"enabled"`
+	Status           string                 `json:"status,omitempty"`
+	Latency          metrics.LatencySummary `json:"latency"`
+	LatencyAvg       float64                `json:"latency_avg"`
+	ErrorRate        float64                `json:"error_rate"`
+	RequestCount     int64                  `json:"request_count"`
+	PromptTokens     float64                `json:"prompt_tokens"`
+	CompletionTokens float64                `json:"completion_tokens"`
+	Health           *health.ChannelHealth  `json:"health"`
+}
+
+// CompareChannels returns side-by-side statistics for every channel serving
+// the model given by ?model=
+func (h *Handler) CompareChannels(c *gin.Context) {
+	name := c.Query("model")
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "model is required"})
+		return
+	}
+
+	model, err := h.db.GetModelByName(name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if model == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "model not found"})
+		return
+	}
+
+	mappings, err := h.db.GetModelChannelsByModel(model.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows := []ChannelComparison{}
+	for _, mc := range mappings {
+		ch, err := h.channelMgr.Get(mc.ChannelID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if ch == nil {
+			continue
+		}
+
+		row, err := h.compareChannel(ch, mc, model.Name)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		rows = append(rows, row)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"model": model.Name, "channels": rows})
+}
+
+// compareChannel gathers the statistics of one channel serving a model
+func (h *Handler) compareChannel(ch *database.Channel, mc *database.ModelChannel, model string) (ChannelComparison, error) {
+	row := ChannelComparison{
+		ChannelID:        ch.ID,
+		ChannelName:      ch.Name,
+		BackendModelName: mc.BackendModelName,
+		Weight:           mc.Weight,
+		Enabled:          ch.Enabled,
+		Status:           ch.Status,
+		Latency:          metrics.ChannelLatencySummary(ch.Name, model),
+	}
+	row.PromptTokens, row.CompletionTokens = metrics.ChannelTokens(ch.Name, model)
+
+	m, err := h.channelMetrics(ch.ID)
+	if err != nil {
+		return row, err
+	}
+	row.LatencyAvg = m.LatencyAvg
+	row.ErrorRate = m.ErrorRate
+	row.RequestCount = m.RequestCount
+
+	if h.health != nil {
+		row.Health = h.health.GetStatus(ch.ID)
+	}
+	return row, nil
+}
@@ -0,0 +1,197 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/X0Ken/openai-gateway/internal/flags"
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+// CreateFeatureFlagRequest represents a feature flag creation request. Flags
+// are created disabled unless enabled is true.
+type CreateFeatureFlagRequest struct {
+	Name           string  `json:"name" binding:"required"`
+	Description    string  `json:"description"`
+	Enabled        bool    `json:"enabled"`
+	RolloutPercent int     `json:"rollout_percent" binding:"min=0,max=100"`
+	UserIDs        []int64 `json:"user_ids"`
+}
+
+// UpdateFeatureFlagRequest represents a feature flag update request. Omitted
+// fields are left unchanged; user_ids, when present, replaces the list.
+type UpdateFeatureFlagRequest struct {
+	Name           *string  `json:"name"`
+	Description    *string  `json:"description"`
+	Enabled        *bool    `json:"enabled"`
+	RolloutPercent *int     `json:"rollout_percent" binding:"omitempty,min=0,max=100"`
+	UserIDs        *[]int64 `json:"user_ids"`
+}
+
+// CreateFeatureFlag creates a new feature flag
+func (h *Handler) CreateFeatureFlag(c *gin.Context) {
+	var req CreateFeatureFlagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	flag := &database.FeatureFlag{
+		Name:           req.Name,
+		Description:    req.Description,
+		Enabled:        req.Enabled,
+		RolloutPercent: req.RolloutPercent,
+		UserIDs:        req.UserIDs,
+	}
+	if flag.UserIDs == nil {
+		flag.UserIDs = []int64{}
+	}
+	if err := h.db.CreateFeatureFlag(flag); err != nil {
+		c.JSON(database.StatusForError(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := h.recordAudit(c, "create", "feature_flag", flag.ID, nil, flag); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.featureFlags.Invalidate()
+
+	c.JSON(http.StatusCreated, flag)
+}
+
+// ListFeatureFlags lists all feature flags
+func (h *Handler) ListFeatureFlags(c *gin.Context) {
+	list, err := h.db.ListFeatureFlags()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if list == nil {
+		list = []*database.FeatureFlag{}
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+// lookupFeatureFlag loads the flag named by the ID parameter, writing an
+// error response and returning nil when it cannot
+func (h *Handler) lookupFeatureFlag(c *gin.Context) *database.FeatureFlag {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid feature flag ID"})
+		return nil
+	}
+
+	flag, err := h.db.GetFeatureFlag(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil
+	}
+	if flag == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "feature flag not found"})
+		return nil
+	}
+	return flag
+}
+
+// GetFeatureFlag gets a feature flag by ID
+func (h *Handler) GetFeatureFlag(c *gin.Context) {
+	flag := h.lookupFeatureFlag(c)
+	if flag == nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, flag)
+}
+
+// UpdateFeatureFlag updates a feature flag, e.g. to turn it off or widen its
+// rollout
+func (h *Handler) UpdateFeatureFlag(c *gin.Context) {
+	var req UpdateFeatureFlagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	flag := h.lookupFeatureFlag(c)
+	if flag == nil {
+		return
+	}
+	before := *flag
+
+	if req.Name != nil {
+		flag.Name = *req.Name
+	}
+	if req.Description != nil {
+		flag.Description = *req.Description
+	}
+	if req.Enabled != nil {
+		flag.Enabled = *req.Enabled
+	}
+	if req.RolloutPercent != nil {
+		flag.RolloutPercent = *req.RolloutPercent
+	}
+	if req.UserIDs != nil {
+		flag.UserIDs = *req.UserIDs
+		if flag.UserIDs == nil {
+			flag.UserIDs = []int64{}
+		}
+	}
+
+	if err := h.db.UpdateFeatureFlag(flag); err != nil {
+		c.JSON(database.StatusForError(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := h.recordAudit(c, "update", "feature_flag", flag.ID, before, flag); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.featureFlags.Invalidate()
+
+	c.JSON(http.StatusOK, flag)
+}
+
+// DeleteFeatureFlag deletes a feature flag, turning it off everywhere
+func (h *Handler) DeleteFeatureFlag(c *gin.Context) {
+	flag := h.lookupFeatureFlag(c)
+	if flag == nil {
+		return
+	}
+
+	if err := h.db.DeleteFeatureFlag(flag.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := h.recordAudit(c, "delete", "feature_flag", flag.ID, flag, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.featureFlags.Invalidate()
+
+	c.Status(http.StatusNoContent)
+}
+
+// EvaluateFeatureFlag reports whether a flag is on for ?user_id=N, read
+// straight from the database
+func (h *Handler) EvaluateFeatureFlag(c *gin.Context) {
+	var userID int64
+	if value := c.Query("user_id"); value != "" {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id"})
+			return
+		}
+		userID = id
+	}
+
+	flag := h.lookupFeatureFlag(c)
+	if flag == nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"name": flag.Name, "user_id": userID, "enabled": flags.Evaluate(flag, userID)})
+}
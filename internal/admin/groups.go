@@ -0,0 +1,324 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+// CreateGroupRequest represents a group creation request. Zero leaves a
+// limit unlimited.
+type CreateGroupRequest struct {
+	Name              string  `json:"name" binding:"required"`
+	Description       string  `json:"description"`
+	MonthlyTokens     int64   `json:"monthly_tokens" binding:"min=0"`
+	MonthlyCost       float64 `json:"monthly_cost" binding:"min=0"`
+	RequestsPerMinute int     `json:"requests_per_minute" binding:"min=0"`
+}
+
+// UpdateGroupRequest represents a group update request. Omitted fields are
+// left unchanged.
+type UpdateGroupRequest struct {
+	Name              *string  `json:"name" binding:"omitempty,min=1"`
+	Description       *string  `json:"description"`
+	MonthlyTokens     *int64   `json:"monthly_tokens" binding:"omitempty,min=0"`
+	MonthlyCost       *float64 `json:"monthly_cost" binding:"omitempty,min=0"`
+	RequestsPerMinute *int     `json:"requests_per_minute" binding:"omitempty,min=0"`
+}
+
+// AddGroupMemberRequest represents a request adding a user to a group
+type AddGroupMemberRequest struct {
+	UserID int64 `json:"user_id" binding:"required"`
+}
+
+// CreateGroup creates a new group
+func (h *Handler) CreateGroup(c *gin.Context) {
+	var req CreateGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	group := &database.Group{
+		Name:              req.Name,
+		Description:       req.Description,
+		MonthlyTokens:     req.MonthlyTokens,
+		MonthlyCost:       req.MonthlyCost,
+		RequestsPerMinute: req.RequestsPerMinute,
+	}
+	if err := h.db.CreateGroup(group); err != nil {
+		c.JSON(database.StatusForError(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := h.recordAudit(c, "create_group", "group", group.ID, nil, group); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, group)
+}
+
+// ListGroups lists all groups
+func (h *Handler) ListGroups(c *gin.Context) {
+	groups, err := h.db.ListGroups()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if groups == nil {
+		groups = []*database.Group{}
+	}
+
+	c.JSON(http.StatusOK, groups)
+}
+
+// lookupGroup loads the group named by the ID parameter, writing an error
+// response and returning nil when it cannot
+func (h *Handler) lookupGroup(c *gin.Context) *database.Group {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid group ID"})
+		return nil
+	}
+
+	group, err := h.db.GetGroup(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil
+	}
+	if group == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "group not found"})
+		return nil
+	}
+	return group
+}
+
+// GetGroup gets a group by ID
+func (h *Handler) GetGroup(c *gin.Context) {
+	group := h.lookupGroup(c)
+	if group == nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, group)
+}
+
+// UpdateGroup updates a group's name, description and limits
+func (h *Handler) UpdateGroup(c *gin.Context) {
+	var req UpdateGroupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	group := h.lookupGroup(c)
+	if group == nil {
+		return
+	}
+	before := *group
+
+	if req.Name != nil {
+		group.Name = *req.Name
+	}
+	if req.Description != nil {
+		group.Description = *req.Description
+	}
+	if req.MonthlyTokens != nil {
+		group.MonthlyTokens = *req.MonthlyTokens
+	}
+	if req.MonthlyCost != nil {
+		group.MonthlyCost = *req.MonthlyCost
+	}
+	if req.RequestsPerMinute != nil {
+		group.RequestsPerMinute = *req.RequestsPerMinute
+	}
+
+	if err := h.db.UpdateGroup(group); err != nil {
+		c.JSON(database.StatusForError(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := h.recordAudit(c, "update_group", "group", group.ID, before, group); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, group)
+}
+
+// DeleteGroup deletes a group. Its members are kept, without the group's
+// limits.
+func (h *Handler) DeleteGroup(c *gin.Context) {
+	group := h.lookupGroup(c)
+	if group == nil {
+		return
+	}
+
+	if err := h.db.DeleteGroup(group.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := h.recordAudit(c, "delete_group", "group", group.ID, group, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetGroupQuota returns the usage of a group's members in the current
+// month against the group's shared limits
+func (h *Handler) GetGroupQuota(c *gin.Context) {
+	group := h.lookupGroup(c)
+	if group == nil {
+		return
+	}
+
+	status, err := h.quota.GroupStatus(group)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// ResetGroupQuota restarts a group's monthly count now, so its members can
+// use the full shared quota again before the month ends
+func (h *Handler) ResetGroupQuota(c *gin.Context) {
+	group := h.lookupGroup(c)
+	if group == nil {
+		return
+	}
+
+	before, err := h.quota.GroupStatus(group)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	now := time.Now()
+	if _, err := h.db.ResetGroupQuota(group.ID, now); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	group.ResetAt = &now
+
+	if _, err := h.recordAudit(c, "reset_group_quota", "group", group.ID, before, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	status, err := h.quota.GroupStatus(group)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// ListGroupMembers lists the users in a group
+func (h *Handler) ListGroupMembers(c *gin.Context) {
+	group := h.lookupGroup(c)
+	if group == nil {
+		return
+	}
+
+	users, err := h.db.ListGroupMembers(group.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if users == nil {
+		users = []*database.User{}
+	}
+
+	c.JSON(http.StatusOK, users)
+}
+
+// AddGroupMember adds a user to a group
+func (h *Handler) AddGroupMember(c *gin.Context) {
+	var req AddGroupMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	group := h.lookupGroup(c)
+	if group == nil {
+		return
+	}
+	user, err := h.db.GetUser(req.UserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if user == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	if err := h.db.AddGroupMember(group.ID, user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := h.recordAudit(c, "add_group_member", "group", group.ID, nil, req); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RemoveGroupMember removes a user from a group
+func (h *Handler) RemoveGroupMember(c *gin.Context) {
+	group := h.lookupGroup(c)
+	if group == nil {
+		return
+	}
+	userID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	found, err := h.db.RemoveGroupMember(group.ID, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user is not a member of the group"})
+		return
+	}
+
+	if _, err := h.recordAudit(c, "remove_group_member", "group", group.ID, AddGroupMemberRequest{UserID: userID}, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListUserGroups lists the groups a user belongs to
+func (h *Handler) ListUserGroups(c *gin.Context) {
+	user := h.lookupKeyOwner(c)
+	if user == nil {
+		return
+	}
+
+	groups, err := h.db.ListUserGroups(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if groups == nil {
+		groups = []*database.Group{}
+	}
+
+	c.JSON(http.StatusOK, groups)
+}
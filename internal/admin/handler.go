@@ -1,13 +1,23 @@
 package admin
 
 import (
+	"encoding/json"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/X0Ken/openai-gateway/internal/breaker"
 	"github.com/X0Ken/openai-gateway/internal/channel"
+	"github.com/X0Ken/openai-gateway/internal/cluster"
+	"github.com/X0Ken/openai-gateway/internal/flags"
+	"github.com/X0Ken/openai-gateway/internal/probe"
+	"github.com/X0Ken/openai-gateway/internal/quota"
 	"github.com/X0Ken/openai-gateway/internal/session"
+	"github.com/X0Ken/openai-gateway/internal/slo"
+	"github.com/X0Ken/openai-gateway/internal/statuspage"
 	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/X0Ken/openai-gateway/pkg/health"
+	"github.com/X0Ken/openai-gateway/pkg/store"
 )
 
 // Handler handles admin API requests
@@ -15,6 +25,17 @@ type Handler struct {
 	channelMgr *channel.Manager
 	sessionMgr *session.Manager
 	db         *database.DB
+	metrics    store.Metrics
+	health     *health.Checker
+	breakers   *breaker.Breakers
+	slos       *slo.Evaluator
+	status     *statuspage.Monitor
+	probes     *probe.Runner
+	cluster    *cluster.Registry
+	// featureFlags is invalidated after flag changes so this replica sees
+	// them at once
+	featureFlags *flags.Flags
+	quota        *quota.Checker
 }
 
 // NewHandler creates a new admin handler
@@ -23,33 +44,185 @@ func NewHandler(channelMgr *channel.Manager, sessionMgr *session.Manager, db *da
 		channelMgr: channelMgr,
 		sessionMgr: sessionMgr,
 		db:         db,
+		metrics:    db,
+		quota:      quota.New(db),
 	}
 }
 
+// SetHealthChecker sets the checker whose channel health is reported by the
+// comparison view and the channel health endpoints
+func (h *Handler) SetHealthChecker(checker *health.Checker) {
+	h.health = checker
+}
+
+// SetBreakers sets the circuit breakers reported by the channel health
+// endpoint
+func (h *Handler) SetBreakers(b *breaker.Breakers) {
+	h.breakers = b
+}
+
+// SetSLOEvaluator sets the evaluator whose objectives are reported by the
+// SLO status endpoint
+func (h *Handler) SetSLOEvaluator(evaluator *slo.Evaluator) {
+	h.slos = evaluator
+}
+
+// SetStatusMonitor sets the monitor whose provider incidents are reported by
+// the provider status endpoint
+func (h *Handler) SetStatusMonitor(monitor *statuspage.Monitor) {
+	h.status = monitor
+}
+
+// SetProbeRunner sets the runner used to run probes on demand
+func (h *Handler) SetProbeRunner(runner *probe.Runner) {
+	h.probes = runner
+}
+
+// SetClusterRegistry sets the registry whose replicas are reported by the
+// cluster status endpoint
+func (h *Handler) SetClusterRegistry(registry *cluster.Registry) {
+	h.cluster = registry
+}
+
+// SetFeatureFlags sets the flag cache to refresh after flag changes
+func (h *Handler) SetFeatureFlags(f *flags.Flags) {
+	h.featureFlags = f
+}
+
 // RegisterRoutes registers admin routes
 func (h *Handler) RegisterRoutes(r *gin.RouterGroup) {
 	// Channel management
 	r.POST("/channels", h.CreateChannel)
 	r.GET("/channels", h.ListChannels)
+	r.GET("/channels/compare", h.CompareChannels)
+	r.GET("/channels/quality", h.ListChannelQuality)
 	r.GET("/channels/:id", h.GetChannel)
 	r.PUT("/channels/:id", h.UpdateChannel)
 	r.DELETE("/channels/:id", h.DeleteChannel)
+	r.GET("/channels/:id/health", h.GetChannelHealth)
+	r.GET("/channels/:id/metrics", h.GetChannelMetrics)
+	r.POST("/channels/:id/metrics/reset", h.ResetChannelMetrics)
+	r.POST("/channels/:id/test", h.TestChannel)
 
 	// User management
 	r.POST("/users", h.CreateUser)
+	r.POST("/users/bulk", h.BulkCreateUsers)
 	r.GET("/users", h.ListUsers)
 	r.GET("/users/:id", h.GetUser)
+	r.PUT("/users/:id", h.UpdateUser)
 	r.DELETE("/users/:id", h.DeleteUser)
+	r.POST("/users/:id/rotate-key", h.RotateUserKey)
+	r.GET("/users/:id/key-rotations", h.ListKeyRotations)
+	r.POST("/users/:id/keys", h.CreateAPIKey)
+	r.GET("/users/:id/keys", h.ListAPIKeys)
+	r.PUT("/users/:id/keys/:key_id", h.UpdateAPIKey)
+	r.DELETE("/users/:id/keys/:key_id", h.RevokeAPIKey)
+	r.GET("/users/:id/quota", h.GetQuota)
+	r.PUT("/users/:id/quota", h.SetQuota)
+	r.POST("/users/:id/quota/reset", h.ResetQuota)
+	r.DELETE("/users/:id/quota", h.DeleteQuota)
+	r.GET("/users/:id/groups", h.ListUserGroups)
+
+	// User groups
+	r.POST("/groups", h.CreateGroup)
+	r.GET("/groups", h.ListGroups)
+	r.GET("/groups/:id", h.GetGroup)
+	r.PUT("/groups/:id", h.UpdateGroup)
+	r.DELETE("/groups/:id", h.DeleteGroup)
+	r.GET("/groups/:id/quota", h.GetGroupQuota)
+	r.POST("/groups/:id/quota/reset", h.ResetGroupQuota)
+	r.GET("/groups/:id/members", h.ListGroupMembers)
+	r.POST("/groups/:id/members", h.AddGroupMember)
+	r.DELETE("/groups/:id/members/:user_id", h.RemoveGroupMember)
 
 	// Session management
 	r.GET("/sessions", h.ListSessions)
 	r.DELETE("/sessions/:id", h.DeleteSession)
+
+	// Routing rules
+	r.POST("/routing-rules", h.CreateRoutingRule)
+	r.GET("/routing-rules", h.ListRoutingRules)
+	r.GET("/routing-rules/:id", h.GetRoutingRule)
+	r.PUT("/routing-rules/:id", h.UpdateRoutingRule)
+	r.DELETE("/routing-rules/:id", h.DeleteRoutingRule)
+
+	// Service level objectives
+	r.GET("/slos", h.ListSLOs)
+
+	// Synthetic probes
+	r.POST("/probes", h.CreateProbe)
+	r.GET("/probes", h.ListProbes)
+	r.GET("/probes/:id", h.GetProbe)
+	r.PUT("/probes/:id", h.UpdateProbe)
+	r.DELETE("/probes/:id", h.DeleteProbe)
+	r.GET("/probes/:id/results", h.ListProbeResults)
+	r.POST("/probes/:id/run", h.RunProbe)
+
+	// Provider status pages
+	r.GET("/provider-status", h.ListProviderStatus)
+
+	// Audit log
+	r.GET("/audit", h.ListAudit)
+
+	// Usage analytics
+	r.GET("/stats/analytics", h.GetAnalytics)
+
+	// Token usage
+	r.GET("/usage", h.GetUsage)
+	r.GET("/usage/logs", h.ListUsageLogs)
+
+	// Token prices
+	r.POST("/prices", h.CreateModelPrice)
+	r.GET("/prices", h.ListModelPrices)
+	r.GET("/prices/:id", h.GetModelPrice)
+	r.PUT("/prices/:id", h.UpdateModelPrice)
+	r.DELETE("/prices/:id", h.DeleteModelPrice)
+
+	// Admin tokens
+	r.POST("/admin-tokens", h.CreateAdminToken)
+	r.GET("/admin-tokens", h.ListAdminTokens)
+	r.DELETE("/admin-tokens/:id", h.DeleteAdminToken)
+
+	// Database maintenance
+	r.GET("/integrity", h.CheckIntegrity)
+	r.POST("/integrity/repair", h.RepairIntegrity)
+
+	// Channel health
+	r.GET("/health/channels", h.ListChannelHealth)
+
+	// Cluster status
+	r.GET("/cluster", h.GetClusterStatus)
+
+	// Feature flags
+	r.POST("/flags", h.CreateFeatureFlag)
+	r.GET("/flags", h.ListFeatureFlags)
+	r.GET("/flags/:id", h.GetFeatureFlag)
+	r.PUT("/flags/:id", h.UpdateFeatureFlag)
+	r.DELETE("/flags/:id", h.DeleteFeatureFlag)
+	r.GET("/flags/:id/evaluate", h.EvaluateFeatureFlag)
+
+	// Build information
+	r.GET("/version", h.Version)
 }
 
 // CreateUserRequest represents a user creation request
 type CreateUserRequest struct {
-	APIKey string `json:"api_key" binding:"required"`
-	Name   string `json:"name"`
+	APIKey        string            `json:"api_key" binding:"required"`
+	Name          string            `json:"name"`
+	Metadata      json.RawMessage   `json:"metadata"`
+	Labels        map[string]string `json:"labels"`
+	AllowedModels []string          `json:"allowed_models"`
+}
+
+// UpdateUserRequest represents a user update request. Omitted fields are
+// left unchanged; labels, when present, replace the existing set.
+type UpdateUserRequest struct {
+	Name     *string           `json:"name"`
+	Enabled  *bool             `json:"enabled"`
+	Metadata json.RawMessage   `json:"metadata"`
+	Labels   map[string]string `json:"labels"`
+	// AllowedModels, when present, replaces the list; [] allows every model
+	AllowedModels *[]string `json:"allowed_models"`
 }
 
 // CreateUser creates a new user
@@ -60,28 +233,49 @@ func (h *Handler) CreateUser(c *gin.Context) {
 		return
 	}
 
+	if err := validateLabels(req.Labels); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	user := &database.User{
-		APIKey: req.APIKey,
-		Name:   req.Name,
+		APIKey:   req.APIKey,
+		Name:     req.Name,
+		Metadata:      req.Metadata,
+		Labels:        req.Labels,
+		AllowedModels: req.AllowedModels,
 	}
 
 	if err := h.db.CreateUser(user); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(database.StatusForError(err), gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusCreated, user)
 }
 
-// ListUsers lists all users
+// ListUsers lists all users, optionally filtered by label=key=value selectors
 func (h *Handler) ListUsers(c *gin.Context) {
+	selector, err := parseLabelSelector(c.QueryArray("label"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	users, err := h.db.ListUsers()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, users)
+	matched := make([]*database.User, 0, len(users))
+	for _, user := range users {
+		if user.MatchLabels(selector) {
+			matched = append(matched, user)
+		}
+	}
+
+	c.JSON(http.StatusOK, matched)
 }
 
 // GetUser gets a user by ID
@@ -106,6 +300,60 @@ func (h *Handler) GetUser(c *gin.Context) {
 	c.JSON(http.StatusOK, user)
 }
 
+// UpdateUser updates a user's name, enabled state, metadata or labels
+func (h *Handler) UpdateUser(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	var req UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := validateLabels(req.Labels); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.db.GetUser(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if user == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	if req.Name != nil {
+		user.Name = *req.Name
+	}
+	if req.Enabled != nil {
+		user.Enabled = *req.Enabled
+	}
+	if req.Metadata != nil {
+		user.Metadata = req.Metadata
+	}
+	if req.Labels != nil {
+		user.Labels = req.Labels
+	}
+	if req.AllowedModels != nil {
+		user.AllowedModels = *req.AllowedModels
+	}
+
+	if err := h.db.UpdateUser(user); err != nil {
+		c.JSON(database.StatusForError(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
 // DeleteUser deletes a user
 func (h *Handler) DeleteUser(c *gin.Context) {
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
@@ -132,7 +380,7 @@ func (h *Handler) CreateChannel(c *gin.Context) {
 
 	ch, err := h.channelMgr.Create(&req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(channel.StatusForError(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -188,13 +436,41 @@ func (h *Handler) UpdateChannel(c *gin.Context) {
 
 	ch, err := h.channelMgr.Update(id, &req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(channel.StatusForError(err), gin.H{"error": err.Error()})
 		return
 	}
 
+	if req.MigrateSessions > 0 {
+		migrated, err := h.migrateSessions(ch.ID, req.MigrateSessions)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Header("X-Migrated-Sessions", strconv.Itoa(migrated))
+	}
+
 	c.JSON(http.StatusOK, ch)
 }
 
+// migrateSessions ends a fraction of a channel's sticky sessions and clears
+// the channel from their users' history, so previous-channel preference does
+// not send them straight back. It returns the number of sessions ended.
+func (h *Handler) migrateSessions(channelID int64, fraction float64) (int, error) {
+	migrated, err := h.sessionMgr.MigrateChannel(channelID, fraction)
+	if err != nil {
+		return 0, err
+	}
+	for _, s := range migrated {
+		if s.SessionKey != "" {
+			continue
+		}
+		if err := h.db.ForgetUserChannel(s.UserID, channelID); err != nil {
+			return 0, err
+		}
+	}
+	return len(migrated), nil
+}
+
 // DeleteChannel deletes a channel
 func (h *Handler) DeleteChannel(c *gin.Context) {
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
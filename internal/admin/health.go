@@ -0,0 +1,72 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/X0Ken/openai-gateway/internal/breaker"
+	"github.com/X0Ken/openai-gateway/pkg/health"
+	"github.com/gin-gonic/gin"
+)
+
+// ChannelHealthResponse is the health of a channel as seen by routing: its
+// health check status and its circuit breaker
+type ChannelHealthResponse struct {
+	health.ChannelHealth
+	Name string `json:"name"`
+	// Breaker is the channel's circuit breaker, or null when circuit
+	// breakers are disabled
+	Breaker *breaker.Status `json:"breaker"`
+}
+
+// GetChannelHealth returns the health of a channel
+func (h *Handler) GetChannelHealth(c *gin.Context) {
+	id, ok := h.lookupChannelID(c)
+	if !ok {
+		return
+	}
+	ch, err := h.channelMgr.Get(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if ch == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "channel not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, h.channelHealth(id, ch.Name))
+}
+
+// ListChannelHealth returns the health of every channel
+func (h *Handler) ListChannelHealth(c *gin.Context) {
+	channels, err := h.channelMgr.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp := make([]ChannelHealthResponse, 0, len(channels))
+	for _, ch := range channels {
+		resp = append(resp, h.channelHealth(ch.ID, ch.Name))
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// channelHealth collects the health of a channel. Channels the checker does
+// not track, such as disabled ones, are unknown.
+func (h *Handler) channelHealth(id int64, name string) ChannelHealthResponse {
+	resp := ChannelHealthResponse{
+		ChannelHealth: health.ChannelHealth{ChannelID: id, Status: health.StatusUnknown},
+		Name:          name,
+	}
+	if h.health != nil {
+		if status := h.health.GetStatus(id); status != nil {
+			resp.ChannelHealth = *status
+		}
+	}
+	if h.breakers != nil {
+		status := h.breakers.Status(id)
+		resp.Breaker = &status
+	}
+	return resp
+}
@@ -0,0 +1,37 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CheckIntegrity runs the database integrity check and reports orphan rows
+// without changing anything
+func (h *Handler) CheckIntegrity(c *gin.Context) {
+	report, err := h.db.CheckIntegrity(false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// RepairIntegrity deletes orphan rows and records the repair in the audit
+// log. Errors reported by SQLite's integrity check are left to the operator.
+func (h *Handler) RepairIntegrity(c *gin.Context) {
+	report, err := h.db.CheckIntegrity(true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if report.Repaired > 0 {
+		if _, err := h.recordAudit(c, "repair_integrity", "database", 0, report.Orphans, gin.H{"repaired": report.Repaired}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, report)
+}
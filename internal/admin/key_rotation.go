@@ -0,0 +1,109 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/internal/auth"
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+// maxKeyGracePeriod caps how long a rotated key keeps working
+const maxKeyGracePeriod = 30 * 24 * time.Hour
+
+// RotateKeyRequest represents an API key rotation request
+type RotateKeyRequest struct {
+	// GracePeriodSeconds keeps the old key valid for this long; zero revokes
+	// it immediately
+	GracePeriodSeconds int64 `json:"grace_period_seconds"`
+}
+
+// RotateKeyResponse carries the new key, which is only returned here
+type RotateKeyResponse struct {
+	UserID             int64     `json:"user_id"`
+	APIKey             string    `json:"api_key"`
+	OldKeyHint         string    `json:"old_key_hint"`
+	OldKeyValidUntil   time.Time `json:"old_key_valid_until"`
+	GracePeriodSeconds int64     `json:"grace_period_seconds"`
+}
+
+// RotateUserKey replaces a user's API key with a generated one. The old key
+// keeps working for the requested grace period so running clients can be
+// switched over without an outage.
+func (h *Handler) RotateUserKey(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	var req RotateKeyRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	grace := time.Duration(req.GracePeriodSeconds) * time.Second
+	if req.GracePeriodSeconds < 0 || grace > maxKeyGracePeriod {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "grace_period_seconds must be between 0 and " + strconv.Itoa(int(maxKeyGracePeriod.Seconds()))})
+		return
+	}
+
+	newKey, err := auth.GenerateAPIKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	rotation, err := h.db.RotateUserAPIKey(id, newKey, grace, c.ClientIP())
+	if err != nil {
+		c.JSON(database.StatusForError(err), gin.H{"error": err.Error()})
+		return
+	}
+	if rotation == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	after := gin.H{"rotation_id": rotation.ID, "old_key_hint": rotation.OldKeyHint, "grace_expires_at": rotation.GraceExpiresAt}
+	if _, err := h.recordAudit(c, "rotate_key", "user", id, nil, after); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, RotateKeyResponse{
+		UserID:             id,
+		APIKey:             newKey,
+		OldKeyHint:         rotation.OldKeyHint,
+		OldKeyValidUntil:   rotation.GraceExpiresAt,
+		GracePeriodSeconds: req.GracePeriodSeconds,
+	})
+}
+
+// ListKeyRotations lists a user's API key rotations, most recent first
+func (h *Handler) ListKeyRotations(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	user, err := h.db.GetUser(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if user == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	rotations, err := h.db.ListKeyRotations(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rotations)
+}
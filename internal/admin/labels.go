@@ -0,0 +1,40 @@
+package admin
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// labelKeyPattern restricts label keys to identifier-like names such as env or team.tier
+var labelKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_.\-/]{1,63}$`)
+
+// maxLabelValueLen bounds label values
+const maxLabelValueLen = 256
+
+// validateLabels checks label keys and values
+func validateLabels(labels map[string]string) error {
+	for k, v := range labels {
+		if !labelKeyPattern.MatchString(k) {
+			return fmt.Errorf("invalid label key %q", k)
+		}
+		if len(v) > maxLabelValueLen {
+			return fmt.Errorf("label %q value exceeds %d characters", k, maxLabelValueLen)
+		}
+	}
+	return nil
+}
+
+// parseLabelSelector parses key=value query values into a selector that
+// matches users carrying all of the given labels
+func parseLabelSelector(values []string) (map[string]string, error) {
+	selector := make(map[string]string, len(values))
+	for _, value := range values {
+		k, v, ok := strings.Cut(value, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid label selector %q, expected key=value", value)
+		}
+		selector[k] = v
+	}
+	return selector, nil
+}
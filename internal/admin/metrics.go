@@ -0,0 +1,101 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/X0Ken/openai-gateway/pkg/store"
+	"github.com/gin-gonic/gin"
+)
+
+// SetMetricsStore reads and resets channel metrics in the given store, such
+// as one shared by the replicas of a cluster
+func (h *Handler) SetMetricsStore(metrics store.Metrics) {
+	h.metrics = metrics
+}
+
+// channelMetrics returns the routing metrics of a channel, reporting a
+// channel without recorded requests as zeroed metrics
+func (h *Handler) channelMetrics(id int64) (*database.ChannelMetrics, error) {
+	m, err := h.metrics.GetChannelMetrics(id)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		m = &database.ChannelMetrics{ChannelID: id}
+	}
+	return m, nil
+}
+
+// lookupChannelID parses the channel ID parameter and checks the channel
+// exists, writing an error response and returning false otherwise
+func (h *Handler) lookupChannelID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid channel ID"})
+		return 0, false
+	}
+
+	ch, err := h.channelMgr.Get(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return 0, false
+	}
+	if ch == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "channel not found"})
+		return 0, false
+	}
+	return id, true
+}
+
+// GetChannelMetrics returns the routing metrics of a channel
+func (h *Handler) GetChannelMetrics(c *gin.Context) {
+	id, ok := h.lookupChannelID(c)
+	if !ok {
+		return
+	}
+
+	m, err := h.channelMetrics(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, m)
+}
+
+// ResetChannelMetrics clears the routing metrics of a channel, e.g. after a
+// provider incident skewed its error rate, and records the values it had in
+// the audit log
+func (h *Handler) ResetChannelMetrics(c *gin.Context) {
+	id, ok := h.lookupChannelID(c)
+	if !ok {
+		return
+	}
+
+	before, err := h.channelMetrics(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.metrics.ResetChannelMetrics(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	after, err := h.channelMetrics(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	entry, err := h.recordAudit(c, "reset_metrics", "channel", id, before, after)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, entry)
+}
@@ -0,0 +1,152 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+// ModelPriceRequest represents a model price creation request, in USD per
+// 1K tokens
+type ModelPriceRequest struct {
+	BackendModel string  `json:"backend_model" binding:"required"`
+	InputPrice   float64 `json:"input_price"`
+	OutputPrice  float64 `json:"output_price"`
+}
+
+// UpdateModelPriceRequest represents a model price update request. Omitted
+// fields are left unchanged.
+type UpdateModelPriceRequest struct {
+	BackendModel *string  `json:"backend_model"`
+	InputPrice   *float64 `json:"input_price"`
+	OutputPrice  *float64 `json:"output_price"`
+}
+
+// validPrice reports whether a price has a backend model and no negative rate
+func validPrice(p *database.ModelPrice) bool {
+	return p.BackendModel != "" && p.InputPrice >= 0 && p.OutputPrice >= 0
+}
+
+// CreateModelPrice sets the price of a backend model's tokens
+func (h *Handler) CreateModelPrice(c *gin.Context) {
+	var req ModelPriceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	price := &database.ModelPrice{
+		BackendModel: req.BackendModel,
+		InputPrice:   req.InputPrice,
+		OutputPrice:  req.OutputPrice,
+	}
+	if !validPrice(price) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "prices must not be negative"})
+		return
+	}
+
+	if err := h.db.CreateModelPrice(price); err != nil {
+		c.JSON(database.StatusForError(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, price)
+}
+
+// ListModelPrices lists all model prices
+func (h *Handler) ListModelPrices(c *gin.Context) {
+	prices, err := h.db.ListModelPrices()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if prices == nil {
+		prices = []*database.ModelPrice{}
+	}
+
+	c.JSON(http.StatusOK, prices)
+}
+
+// lookupModelPrice loads the price named by the ID parameter, writing an
+// error response and returning nil when it cannot
+func (h *Handler) lookupModelPrice(c *gin.Context) *database.ModelPrice {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid price ID"})
+		return nil
+	}
+
+	price, err := h.db.GetModelPrice(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil
+	}
+	if price == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "price not found"})
+		return nil
+	}
+	return price
+}
+
+// GetModelPrice gets a model price by ID
+func (h *Handler) GetModelPrice(c *gin.Context) {
+	price := h.lookupModelPrice(c)
+	if price == nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, price)
+}
+
+// UpdateModelPrice updates a model price. Usage already logged keeps the
+// cost computed with the previous price.
+func (h *Handler) UpdateModelPrice(c *gin.Context) {
+	var req UpdateModelPriceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	price := h.lookupModelPrice(c)
+	if price == nil {
+		return
+	}
+
+	if req.BackendModel != nil {
+		price.BackendModel = *req.BackendModel
+	}
+	if req.InputPrice != nil {
+		price.InputPrice = *req.InputPrice
+	}
+	if req.OutputPrice != nil {
+		price.OutputPrice = *req.OutputPrice
+	}
+	if !validPrice(price) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "backend_model cannot be empty and prices must not be negative"})
+		return
+	}
+
+	if err := h.db.UpdateModelPrice(price); err != nil {
+		c.JSON(database.StatusForError(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, price)
+}
+
+// DeleteModelPrice deletes a model price
+func (h *Handler) DeleteModelPrice(c *gin.Context) {
+	price := h.lookupModelPrice(c)
+	if price == nil {
+		return
+	}
+
+	if err := h.db.DeleteModelPrice(price.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
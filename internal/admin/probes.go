@@ -0,0 +1,281 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+// Probe history limits
+const (
+	defaultProbeResults = 100
+	maxProbeResults     = 1000
+)
+
+// defaultProbeInterval is how often a probe runs when no interval is given
+const defaultProbeInterval = 300
+
+// CreateProbeRequest represents a probe creation request. Probes are enabled
+// unless enabled is false.
+type CreateProbeRequest struct {
+	Name            string `json:"name" binding:"required"`
+	Model           string `json:"model" binding:"required"`
+	Prompt          string `json:"prompt" binding:"required"`
+	Expect          string `json:"expect"`
+	MaxLatencyMs    int    `json:"max_latency_ms"`
+	IntervalSeconds int    `json:"interval_seconds"`
+	Enabled         *bool  `json:"enabled"`
+}
+
+// UpdateProbeRequest represents a probe update request. Omitted fields are
+// left unchanged.
+type UpdateProbeRequest struct {
+	Name            *string `json:"name"`
+	Model           *string `json:"model"`
+	Prompt          *string `json:"prompt"`
+	Expect          *string `json:"expect"`
+	MaxLatencyMs    *int    `json:"max_latency_ms"`
+	IntervalSeconds *int    `json:"interval_seconds"`
+	Enabled         *bool   `json:"enabled"`
+}
+
+// errInvalidProbe is returned when a probe refers to a missing model or has
+// invalid settings
+var errInvalidProbe = errors.New("invalid probe")
+
+// validateProbe checks that a probe's model exists and its limits are positive
+func (h *Handler) validateProbe(p *database.Probe) error {
+	if p.Name == "" || p.Prompt == "" {
+		return fmt.Errorf("%w: name and prompt cannot be empty", errInvalidProbe)
+	}
+	if p.IntervalSeconds <= 0 {
+		return fmt.Errorf("%w: interval_seconds must be positive", errInvalidProbe)
+	}
+	if p.MaxLatencyMs < 0 {
+		return fmt.Errorf("%w: max_latency_ms must not be negative", errInvalidProbe)
+	}
+
+	model, err := h.db.GetModelByName(p.Model)
+	if err != nil {
+		return err
+	}
+	if model == nil {
+		return fmt.Errorf("%w: model %q not found", errInvalidProbe, p.Model)
+	}
+	return nil
+}
+
+// statusForProbeError maps a probe error to an HTTP status code
+func statusForProbeError(err error) int {
+	if errors.Is(err, errInvalidProbe) {
+		return http.StatusBadRequest
+	}
+	return database.StatusForError(err)
+}
+
+// CreateProbe creates a new probe
+func (h *Handler) CreateProbe(c *gin.Context) {
+	var req CreateProbeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	probe := &database.Probe{
+		Name:            req.Name,
+		Model:           req.Model,
+		Prompt:          req.Prompt,
+		Expect:          req.Expect,
+		MaxLatencyMs:    req.MaxLatencyMs,
+		IntervalSeconds: req.IntervalSeconds,
+		Enabled:         req.Enabled == nil || *req.Enabled,
+	}
+	if probe.IntervalSeconds == 0 {
+		probe.IntervalSeconds = defaultProbeInterval
+	}
+	if err := h.validateProbe(probe); err != nil {
+		c.JSON(statusForProbeError(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.db.CreateProbe(probe); err != nil {
+		c.JSON(database.StatusForError(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, probe)
+}
+
+// ListProbes lists all probes
+func (h *Handler) ListProbes(c *gin.Context) {
+	probes, err := h.db.ListProbes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if probes == nil {
+		probes = []*database.Probe{}
+	}
+
+	c.JSON(http.StatusOK, probes)
+}
+
+// lookupProbe loads the probe named by the ID parameter, writing an error
+// response and returning nil when it cannot
+func (h *Handler) lookupProbe(c *gin.Context) *database.Probe {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid probe ID"})
+		return nil
+	}
+
+	probe, err := h.db.GetProbe(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil
+	}
+	if probe == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "probe not found"})
+		return nil
+	}
+	return probe
+}
+
+// GetProbe gets a probe by ID
+func (h *Handler) GetProbe(c *gin.Context) {
+	probe := h.lookupProbe(c)
+	if probe == nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, probe)
+}
+
+// UpdateProbe updates a probe
+func (h *Handler) UpdateProbe(c *gin.Context) {
+	var req UpdateProbeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	probe := h.lookupProbe(c)
+	if probe == nil {
+		return
+	}
+
+	if req.Name != nil {
+		probe.Name = *req.Name
+	}
+	if req.Model != nil {
+		probe.Model = *req.Model
+	}
+	if req.Prompt != nil {
+		probe.Prompt = *req.Prompt
+	}
+	if req.Expect != nil {
+		probe.Expect = *req.Expect
+	}
+	if req.MaxLatencyMs != nil {
+		probe.MaxLatencyMs = *req.MaxLatencyMs
+	}
+	if req.IntervalSeconds != nil {
+		probe.IntervalSeconds = *req.IntervalSeconds
+	}
+	if req.Enabled != nil {
+		probe.Enabled = *req.Enabled
+	}
+
+	if err := h.validateProbe(probe); err != nil {
+		c.JSON(statusForProbeError(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.db.UpdateProbe(probe); err != nil {
+		c.JSON(database.StatusForError(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, probe)
+}
+
+// DeleteProbe deletes a probe and its history
+func (h *Handler) DeleteProbe(c *gin.Context) {
+	probe := h.lookupProbe(c)
+	if probe == nil {
+		return
+	}
+
+	if err := h.db.DeleteProbe(probe.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListProbeResults returns a probe's most recent results, newest first.
+// Query parameters: channel_id filters and limit (at most 1000) bounds them.
+func (h *Handler) ListProbeResults(c *gin.Context) {
+	probe := h.lookupProbe(c)
+	if probe == nil {
+		return
+	}
+
+	var channelID int64
+	if value := c.Query("channel_id"); value != "" {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid channel_id"})
+			return
+		}
+		channelID = id
+	}
+
+	limit := defaultProbeResults
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > maxProbeResults {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxProbeResults)})
+			return
+		}
+		limit = n
+	}
+
+	results, err := h.db.ListProbeResults(probe.ID, channelID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if results == nil {
+		results = []*database.ProbeResult{}
+	}
+
+	c.JSON(http.StatusOK, results)
+}
+
+// RunProbe runs a probe against every channel of its model immediately and
+// returns the results, which are also recorded in its history
+func (h *Handler) RunProbe(c *gin.Context) {
+	if h.probes == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "probes are not enabled"})
+		return
+	}
+
+	probe := h.lookupProbe(c)
+	if probe == nil {
+		return
+	}
+
+	results, err := h.probes.Run(c.Request.Context(), probe)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, results)
+}
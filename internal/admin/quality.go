@@ -0,0 +1,54 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/X0Ken/openai-gateway/internal/metrics"
+	"github.com/X0Ken/openai-gateway/internal/quality"
+	"github.com/gin-gonic/gin"
+)
+
+// ChannelQuality reports the quality signals raised by a channel's
+// successful responses since the process started
+type ChannelQuality struct {
+	ChannelID   int64  `json:"channel_id"`
+	ChannelName string `json:"channel_name"`
+	Checked     int64  `json:"checked"`
+	// Signals and Rates hold, for each signal, how many checked responses
+	// raised it and which fraction of them did
+	Signals map[string]int64   `json:"signals"`
+	Rates   map[string]float64 `json:"rates"`
+}
+
+// ListChannelQuality returns the quality signals of every channel, so
+// backends returning degraded content with a 200 status stand out
+func (h *Handler) ListChannelQuality(c *gin.Context) {
+	channels, err := h.channelMgr.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows := []ChannelQuality{}
+	for _, ch := range channels {
+		checked, signals := metrics.ChannelQuality(ch.Name)
+		row := ChannelQuality{
+			ChannelID:   ch.ID,
+			ChannelName: ch.Name,
+			Checked:     int64(checked),
+			Signals:     make(map[string]int64),
+			Rates:       make(map[string]float64),
+		}
+		for _, signal := range quality.Signals {
+			row.Signals[signal] = int64(signals[signal])
+			if checked > 0 {
+				row.Rates[signal] = signals[signal] / checked
+			} else {
+				row.Rates[signal] = 0
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	c.JSON(http.StatusOK, rows)
+}
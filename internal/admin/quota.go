@@ -0,0 +1,127 @@
+package admin
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+// SetQuotaRequest represents a request setting a user's monthly limits.
+// Zero leaves a budget unlimited.
+type SetQuotaRequest struct {
+	MonthlyTokens int64   `json:"monthly_tokens" binding:"min=0"`
+	MonthlyCost   float64 `json:"monthly_cost" binding:"min=0"`
+}
+
+// writeQuotaStatus responds with a user's usage against its quota
+func (h *Handler) writeQuotaStatus(c *gin.Context, userID int64) {
+	status, err := h.quota.Status(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if status == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user has no quota"})
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// GetQuota returns a user's limits and usage in the current month
+func (h *Handler) GetQuota(c *gin.Context) {
+	user := h.lookupKeyOwner(c)
+	if user == nil {
+		return
+	}
+	h.writeQuotaStatus(c, user.ID)
+}
+
+// SetQuota sets a user's monthly token and cost limits
+func (h *Handler) SetQuota(c *gin.Context) {
+	var req SetQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user := h.lookupKeyOwner(c)
+	if user == nil {
+		return
+	}
+
+	before, err := h.db.GetUserQuota(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	quota := &database.UserQuota{UserID: user.ID, MonthlyTokens: req.MonthlyTokens, MonthlyCost: req.MonthlyCost}
+	if err := h.db.SetUserQuota(quota); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := h.recordAudit(c, "set_quota", "user", user.ID, before, req); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.writeQuotaStatus(c, user.ID)
+}
+
+// ResetQuota restarts a user's monthly count now, so it can use its full
+// quota again before the month ends
+func (h *Handler) ResetQuota(c *gin.Context) {
+	user := h.lookupKeyOwner(c)
+	if user == nil {
+		return
+	}
+
+	before, err := h.quota.Status(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	found, err := h.db.ResetUserQuota(user.ID, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "user has no quota"})
+		return
+	}
+
+	if _, err := h.recordAudit(c, "reset_quota", "user", user.ID, before, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.writeQuotaStatus(c, user.ID)
+}
+
+// DeleteQuota removes a user's quota, making it unlimited
+func (h *Handler) DeleteQuota(c *gin.Context) {
+	user := h.lookupKeyOwner(c)
+	if user == nil {
+		return
+	}
+
+	before, err := h.db.GetUserQuota(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.db.DeleteUserQuota(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := h.recordAudit(c, "delete_quota", "user", user.ID, before, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
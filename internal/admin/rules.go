@@ -0,0 +1,213 @@
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+// CreateRoutingRuleRequest represents a routing rule creation request.
+// Rules are enabled unless enabled is false.
+type CreateRoutingRuleRequest struct {
+	Name       string                  `json:"name" binding:"required"`
+	Priority   int                     `json:"priority"`
+	Enabled    *bool                   `json:"enabled"`
+	Model      string                  `json:"model"`
+	Conditions database.RuleConditions `json:"conditions"`
+	ChannelID  int64                   `json:"channel_id" binding:"required"`
+}
+
+// UpdateRoutingRuleRequest represents a routing rule update request. Omitted
+// fields are left unchanged; conditions, when present, replace the existing set.
+type UpdateRoutingRuleRequest struct {
+	Name       *string                  `json:"name"`
+	Priority   *int                     `json:"priority"`
+	Enabled    *bool                    `json:"enabled"`
+	Model      *string                  `json:"model"`
+	Conditions *database.RuleConditions `json:"conditions"`
+	ChannelID  *int64                   `json:"channel_id"`
+}
+
+// errInvalidRule is returned when a routing rule refers to missing resources
+// or has contradictory conditions
+var errInvalidRule = errors.New("invalid routing rule")
+
+// validateRoutingRule checks that a rule's channel and model exist and its
+// prompt token bounds are ordered
+func (h *Handler) validateRoutingRule(rule *database.RoutingRule) error {
+	ch, err := h.db.GetChannel(rule.ChannelID)
+	if err != nil {
+		return err
+	}
+	if ch == nil {
+		return fmt.Errorf("%w: channel %d not found", errInvalidRule, rule.ChannelID)
+	}
+
+	if rule.Model != "" {
+		model, err := h.db.GetModelByName(rule.Model)
+		if err != nil {
+			return err
+		}
+		if model == nil {
+			return fmt.Errorf("%w: model %q not found", errInvalidRule, rule.Model)
+		}
+	}
+
+	cond := rule.Conditions
+	if cond.MinPromptTokens < 0 || cond.MaxPromptTokens < 0 {
+		return fmt.Errorf("%w: prompt token bounds must not be negative", errInvalidRule)
+	}
+	if cond.MaxPromptTokens > 0 && cond.MinPromptTokens > cond.MaxPromptTokens {
+		return fmt.Errorf("%w: min_prompt_tokens exceeds max_prompt_tokens", errInvalidRule)
+	}
+	if err := validateLabels(cond.UserLabels); err != nil {
+		return fmt.Errorf("%w: %v", errInvalidRule, err)
+	}
+	return nil
+}
+
+// statusForRuleError maps a routing rule error to an HTTP status code
+func statusForRuleError(err error) int {
+	if errors.Is(err, errInvalidRule) {
+		return http.StatusBadRequest
+	}
+	return database.StatusForError(err)
+}
+
+// CreateRoutingRule creates a new routing rule
+func (h *Handler) CreateRoutingRule(c *gin.Context) {
+	var req CreateRoutingRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule := &database.RoutingRule{
+		Name:       req.Name,
+		Priority:   req.Priority,
+		Enabled:    req.Enabled == nil || *req.Enabled,
+		Model:      req.Model,
+		Conditions: req.Conditions,
+		ChannelID:  req.ChannelID,
+	}
+	if err := h.validateRoutingRule(rule); err != nil {
+		c.JSON(statusForRuleError(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.db.CreateRoutingRule(rule); err != nil {
+		c.JSON(database.StatusForError(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, rule)
+}
+
+// ListRoutingRules lists all routing rules in evaluation order
+func (h *Handler) ListRoutingRules(c *gin.Context) {
+	rules, err := h.db.ListRoutingRules()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if rules == nil {
+		rules = []*database.RoutingRule{}
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
+
+// lookupRoutingRule loads the rule named by the ID parameter, writing an
+// error response and returning nil when it cannot
+func (h *Handler) lookupRoutingRule(c *gin.Context) *database.RoutingRule {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid routing rule ID"})
+		return nil
+	}
+
+	rule, err := h.db.GetRoutingRule(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil
+	}
+	if rule == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "routing rule not found"})
+		return nil
+	}
+	return rule
+}
+
+// GetRoutingRule gets a routing rule by ID
+func (h *Handler) GetRoutingRule(c *gin.Context) {
+	rule := h.lookupRoutingRule(c)
+	if rule == nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, rule)
+}
+
+// UpdateRoutingRule updates a routing rule
+func (h *Handler) UpdateRoutingRule(c *gin.Context) {
+	var req UpdateRoutingRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule := h.lookupRoutingRule(c)
+	if rule == nil {
+		return
+	}
+
+	if req.Name != nil {
+		rule.Name = *req.Name
+	}
+	if req.Priority != nil {
+		rule.Priority = *req.Priority
+	}
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	}
+	if req.Model != nil {
+		rule.Model = *req.Model
+	}
+	if req.Conditions != nil {
+		rule.Conditions = *req.Conditions
+	}
+	if req.ChannelID != nil {
+		rule.ChannelID = *req.ChannelID
+	}
+
+	if err := h.validateRoutingRule(rule); err != nil {
+		c.JSON(statusForRuleError(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.db.UpdateRoutingRule(rule); err != nil {
+		c.JSON(database.StatusForError(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, rule)
+}
+
+// DeleteRoutingRule deletes a routing rule
+func (h *Handler) DeleteRoutingRule(c *gin.Context) {
+	rule := h.lookupRoutingRule(c)
+	if rule == nil {
+		return
+	}
+
+	if err := h.db.DeleteRoutingRule(rule.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
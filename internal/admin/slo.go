@@ -0,0 +1,18 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/X0Ken/openai-gateway/internal/slo"
+	"github.com/gin-gonic/gin"
+)
+
+// ListSLOs returns the current burn rates and firing alerts of every
+// configured objective
+func (h *Handler) ListSLOs(c *gin.Context) {
+	if h.slos == nil {
+		c.JSON(http.StatusOK, []slo.Status{})
+		return
+	}
+	c.JSON(http.StatusOK, h.slos.Status())
+}
@@ -0,0 +1,18 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/X0Ken/openai-gateway/internal/statuspage"
+	"github.com/gin-gonic/gin"
+)
+
+// ListProviderStatus returns the incidents declared on each configured
+// provider status page, for dashboard banners
+func (h *Handler) ListProviderStatus(c *gin.Context) {
+	if h.status == nil {
+		c.JSON(http.StatusOK, []statuspage.ProviderStatus{})
+		return
+	}
+	c.JSON(http.StatusOK, h.status.Status())
+}
@@ -0,0 +1,131 @@
+package admin
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/internal/channel"
+	"github.com/X0Ken/openai-gateway/internal/provider"
+	"github.com/gin-gonic/gin"
+)
+
+// channelTestTimeout bounds a manual test request to a channel
+const channelTestTimeout = 30 * time.Second
+
+// ChannelTestRequest is a manual test request to a channel
+type ChannelTestRequest struct {
+	// Model is the backend model name; it defaults to the first model
+	// mapped to the channel
+	Model string `json:"model"`
+	// Prompt is sent as a single user message
+	Prompt string `json:"prompt"`
+}
+
+// ChannelTestResult reports the backend's answer to a manual test request
+type ChannelTestResult struct {
+	ChannelID  int64           `json:"channel_id"`
+	Model      string          `json:"model"`
+	StatusCode int             `json:"status_code,omitempty"`
+	Latency    float64         `json:"latency"`
+	Response   json.RawMessage `json:"response,omitempty"`
+	Error      string          `json:"error,omitempty"`
+}
+
+// TestChannel sends a chat completion directly to a channel, bypassing the
+// router, so credentials of any channel, including test-only ones, can be
+// validated without user traffic
+func (h *Handler) TestChannel(c *gin.Context) {
+	id, ok := h.lookupChannelID(c)
+	if !ok {
+		return
+	}
+
+	var req ChannelTestRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.Prompt == "" {
+		req.Prompt = "ping"
+	}
+
+	ch, err := h.channelMgr.Get(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Model == "" {
+		mappings, err := h.db.GetModelChannelsByChannel(id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if len(mappings) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "model is required for a channel without model mappings"})
+			return
+		}
+		req.Model = mappings[0].BackendModelName
+	}
+
+	payload, err := json.Marshal(gin.H{
+		"model":      req.Model,
+		"messages":   []gin.H{{"role": "user", "content": req.Prompt}},
+		"max_tokens": 16,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	adapter := provider.For(ch)
+	httpReq, err := adapter.NewRequest(c.Request.Context(), ch, channel.OperationChat, req.Model, payload, ch.APIKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	result := ChannelTestResult{ChannelID: id, Model: req.Model}
+	shared, err := h.channelMgr.Client(ch)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// Reuse the channel's connections under the test's own deadline
+	client := *shared
+	client.Timeout = channelTestTimeout
+	start := time.Now()
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		result.Latency = time.Since(start).Seconds()
+		result.Error = err.Error()
+		c.JSON(http.StatusOK, result)
+		return
+	}
+	defer resp.Body.Close()
+
+	if err := adapter.ConvertResponse(resp, channel.OperationChat, payload); err != nil {
+		result.Latency = time.Since(start).Seconds()
+		result.StatusCode = resp.StatusCode
+		result.Error = err.Error()
+		c.JSON(http.StatusOK, result)
+		return
+	}
+	body, err := io.ReadAll(resp.Body)
+	result.Latency = time.Since(start).Seconds()
+	result.StatusCode = resp.StatusCode
+	switch {
+	case err != nil:
+		result.Error = err.Error()
+	case json.Valid(body):
+		result.Response = body
+	default:
+		result.Error = string(body)
+	}
+
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,80 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/X0Ken/openai-gateway/internal/auth"
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+// CreateAdminTokenRequest represents an admin token creation request
+type CreateAdminTokenRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// CreateAdminToken generates a new admin token. Its value is only returned
+// in this response. Creating the first token closes the admin API to
+// requests without one.
+func (h *Handler) CreateAdminToken(c *gin.Context) {
+	var req CreateAdminTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	value, err := auth.GenerateAdminToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	token := &database.AdminToken{Name: req.Name, Token: value}
+	if err := h.db.CreateAdminToken(token); err != nil {
+		c.JSON(database.StatusForError(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := h.recordAudit(c, "create", "admin_token", token.ID, nil, gin.H{"name": token.Name}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, token)
+}
+
+// ListAdminTokens lists admin tokens without their values
+func (h *Handler) ListAdminTokens(c *gin.Context) {
+	tokens, err := h.db.ListAdminTokens()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if tokens == nil {
+		tokens = []*database.AdminToken{}
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// DeleteAdminToken revokes an admin token. Deleting the last token opens the
+// admin API again.
+func (h *Handler) DeleteAdminToken(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid admin token ID"})
+		return
+	}
+
+	if err := h.db.DeleteAdminToken(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := h.recordAudit(c, "delete", "admin_token", id, nil, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,174 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+// defaultUsageRange is the time range reported when ?from= is omitted
+const defaultUsageRange = 30 * 24 * time.Hour
+
+// Usage log listing limits
+const (
+	defaultUsageLogs = 100
+	maxUsageLogs     = 1000
+)
+
+// UsageReport is the token usage and cost over a time range: in total, per
+// user and model, per user, per user and API key and per channel
+type UsageReport struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	database.UsageSummary
+	Usage    []*database.UsageSummary `json:"usage"`
+	Users    []*database.UsageSummary `json:"users"`
+	Keys     []*database.UsageSummary `json:"keys"`
+	Channels []*database.UsageSummary `json:"channels"`
+}
+
+// parseUsageTime parses a usage range bound given as RFC 3339 or as a date
+func parseUsageTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
+
+// usageQuery reads the user_id, api_key_id, model, tag, from and to
+// filters, writing an error response and returning false when they are
+// invalid
+func usageQuery(c *gin.Context) (database.UsageQuery, bool) {
+	q := database.UsageQuery{
+		Model: c.Query("model"),
+		To:    time.Now(),
+	}
+
+	if value := c.Query("user_id"); value != "" {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id"})
+			return q, false
+		}
+		q.UserID = id
+	}
+
+	if value := c.Query("api_key_id"); value != "" {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid api_key_id"})
+			return q, false
+		}
+		q.APIKeyID = id
+	}
+
+	for _, tag := range c.QueryArray("tag") {
+		key, _, _ := strings.Cut(tag, "=")
+		if key == "" || strings.Contains(tag, ",") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid tag, expected key or key=value"})
+			return q, false
+		}
+		q.Tags = append(q.Tags, tag)
+	}
+
+	if value := c.Query("to"); value != "" {
+		to, err := parseUsageTime(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to, expected RFC 3339 or YYYY-MM-DD"})
+			return q, false
+		}
+		q.To = to
+	}
+	q.From = q.To.Add(-defaultUsageRange)
+	if value := c.Query("from"); value != "" {
+		from, err := parseUsageTime(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from, expected RFC 3339 or YYYY-MM-DD"})
+			return q, false
+		}
+		q.From = from
+	}
+	if !q.From.Before(q.To) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return q, false
+	}
+
+	return q, true
+}
+
+// GetUsage returns token usage and cost totals per user and model, per user,
+// per user and API key and per channel, for billing.
+// Query parameters: user_id, api_key_id, model and tag filter, from and to (RFC 3339 or
+// YYYY-MM-DD) bound the range, which defaults to the last 30 days.
+func (h *Handler) GetUsage(c *gin.Context) {
+	q, ok := usageQuery(c)
+	if !ok {
+		return
+	}
+
+	report := UsageReport{From: q.From, To: q.To}
+	groupings := []struct {
+		into   *[]*database.UsageSummary
+		groups []string
+	}{
+		{&report.Usage, []string{database.UsageByUser, database.UsageByModel}},
+		{&report.Users, []string{database.UsageByUser}},
+		{&report.Keys, []string{database.UsageByUser, database.UsageByAPIKey}},
+		{&report.Channels, []string{database.UsageByChannel}},
+	}
+	for _, g := range groupings {
+		summaries, err := h.db.SummarizeUsage(q, g.groups...)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if summaries == nil {
+			summaries = []*database.UsageSummary{}
+		}
+		*g.into = summaries
+	}
+
+	totals, err := h.db.SummarizeUsage(q)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	report.UsageSummary = *totals[0]
+
+	c.JSON(http.StatusOK, report)
+}
+
+// ListUsageLogs returns the most recent usage logs, newest first. It takes
+// the filters of GetUsage, and limit (at most 1000) bounds the entries.
+func (h *Handler) ListUsageLogs(c *gin.Context) {
+	q, ok := usageQuery(c)
+	if !ok {
+		return
+	}
+
+	limit := defaultUsageLogs
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 || n > maxUsageLogs {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxUsageLogs)})
+			return
+		}
+		limit = n
+	}
+
+	logs, err := h.db.ListUsageLogs(q, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if logs == nil {
+		logs = []*database.UsageLog{}
+	}
+
+	c.JSON(http.StatusOK, logs)
+}
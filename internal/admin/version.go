@@ -0,0 +1,13 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/X0Ken/openai-gateway/internal/version"
+	"github.com/gin-gonic/gin"
+)
+
+// Version returns the build information of this replica
+func (h *Handler) Version(c *gin.Context) {
+	c.JSON(http.StatusOK, version.Get())
+}
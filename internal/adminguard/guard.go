@@ -0,0 +1,134 @@
+// Package adminguard protects the admin API from scripted abuse: admin
+// requests can be restricted to an IP allowlist, and mutations are rate
+// limited per admin token so a leaked credential cannot hammer the database.
+package adminguard
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/internal/metrics"
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/X0Ken/openai-gateway/pkg/store"
+	"github.com/gin-gonic/gin"
+)
+
+// Options configures the admin guard
+type Options struct {
+	// MutationLimit is the number of mutating requests allowed per caller
+	// in each window; zero disables the limit
+	MutationLimit int64
+	// Window is the length of the fixed rate limit window
+	Window time.Duration
+	// AllowedIPs lists the addresses and CIDR ranges admin requests may come
+	// from; empty allows every address
+	AllowedIPs []string
+}
+
+// Guard enforces the admin IP allowlist and mutation rate limit. Counts live
+// in the shared stores so replicas enforce one limit.
+type Guard struct {
+	opts     Options
+	allowed  []netip.Prefix
+	counters store.RateLimits
+}
+
+// New creates an admin guard, rejecting malformed allowlist entries
+func New(opts Options, counters store.RateLimits) (*Guard, error) {
+	if opts.Window <= 0 {
+		opts.Window = time.Minute
+	}
+
+	allowed := make([]netip.Prefix, 0, len(opts.AllowedIPs))
+	for _, entry := range opts.AllowedIPs {
+		prefix, err := parsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid admin allowed_ips entry %q: %w", entry, err)
+		}
+		allowed = append(allowed, prefix)
+	}
+
+	return &Guard{opts: opts, allowed: allowed, counters: counters}, nil
+}
+
+// parsePrefix parses a CIDR range or a single address
+func parsePrefix(entry string) (netip.Prefix, error) {
+	if strings.Contains(entry, "/") {
+		prefix, err := netip.ParsePrefix(entry)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(entry)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()), nil
+}
+
+// AllowIPs rejects requests from addresses outside the allowlist. It runs
+// before authentication, so rejected requests never reach the database.
+func (g *Guard) AllowIPs() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if len(g.allowed) == 0 || g.allows(c.ClientIP()) {
+			c.Next()
+			return
+		}
+		metrics.RecordAdminRejection(metrics.AdminRejectionIP)
+		log.Printf("Admin request %s %s from %s rejected: address not allowed", c.Request.Method, c.Request.URL.Path, c.ClientIP())
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin API is not available from this address"})
+	}
+}
+
+// allows reports whether ip is in the allowlist
+func (g *Guard) allows(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range g.allowed {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// LimitMutations rate limits requests other than GET and HEAD, per admin
+// token or, while the admin API is open, per client address. It runs after
+// authentication so callers are told apart by their token.
+func (g *Guard) LimitMutations() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if g.opts.MutationLimit <= 0 || c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+
+		caller := "ip:" + c.ClientIP()
+		if value, ok := c.Get("admin_token"); ok {
+			if token, ok := value.(*database.AdminToken); ok {
+				caller = "token:" + strconv.FormatInt(token.ID, 10)
+			}
+		}
+
+		count, err := g.counters.Incr(c.Request.Context(), "adminlimit:"+caller, g.opts.Window)
+		if err != nil {
+			// Fail open: the store being down must not lock admins out
+			log.Printf("Failed to count admin request for %s: %v", caller, err)
+			c.Next()
+			return
+		}
+		if count > g.opts.MutationLimit {
+			metrics.RecordAdminRejection(metrics.AdminRejectionRateLimit)
+			log.Printf("Admin request %s %s by %s rejected: over %d mutations per %s", c.Request.Method, c.Request.URL.Path, caller, g.opts.MutationLimit, g.opts.Window)
+			c.Header("Retry-After", strconv.Itoa(int(g.opts.Window.Seconds())))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": fmt.Sprintf("admin rate limit of %d changes per %s exceeded", g.opts.MutationLimit, g.opts.Window)})
+			return
+		}
+		c.Next()
+	}
+}
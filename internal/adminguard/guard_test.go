@@ -0,0 +1,85 @@
+package adminguard
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/X0Ken/openai-gateway/pkg/store"
+	"github.com/gin-gonic/gin"
+)
+
+// serve sends a request from addr and returns the response status
+func serve(r *gin.Engine, method, addr string) int {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, "/api/channels", nil)
+	req.RemoteAddr = addr + ":40000"
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+// newEngine serves a guarded admin route. A positive tokenID authenticates
+// every request as that admin token.
+func newEngine(t *testing.T, opts Options, tokenID int64) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	guard, err := New(opts, store.NewMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.Use(guard.AllowIPs())
+	r.Use(func(c *gin.Context) {
+		if tokenID > 0 {
+			c.Set("admin_token", &database.AdminToken{ID: tokenID})
+		}
+	})
+	r.Use(guard.LimitMutations())
+	r.Any("/api/channels", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	return r
+}
+
+func TestAllowIPs(t *testing.T) {
+	r := newEngine(t, Options{AllowedIPs: []string{"10.0.0.0/8", "192.168.1.5", "::1"}}, 0)
+
+	tests := []struct {
+		addr string
+		want int
+	}{
+		{"10.1.2.3", http.StatusOK},
+		{"192.168.1.5", http.StatusOK},
+		{"192.168.1.6", http.StatusForbidden},
+		{"[::1]", http.StatusOK},
+		{"203.0.113.9", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if got := serve(r, "GET", tt.addr); got != tt.want {
+			t.Errorf("Request from %s: expected %d, got %d", tt.addr, tt.want, got)
+		}
+	}
+
+	if _, err := New(Options{AllowedIPs: []string{"10.0.0.0/33"}}, store.NewMemory()); err == nil {
+		t.Error("Expected an invalid allowlist entry to be rejected")
+	}
+}
+
+func TestLimitMutations(t *testing.T) {
+	r := newEngine(t, Options{MutationLimit: 2, Window: time.Minute}, 7)
+
+	for i := 0; i < 2; i++ {
+		if got := serve(r, "POST", "10.0.0.1"); got != http.StatusOK {
+			t.Fatalf("Mutation %d: expected 200, got %d", i+1, got)
+		}
+	}
+	// The limit follows the token across addresses
+	if got := serve(r, "DELETE", "10.0.0.2"); got != http.StatusTooManyRequests {
+		t.Errorf("Expected the third mutation to be limited, got %d", got)
+	}
+	// Reads are not limited
+	if got := serve(r, "GET", "10.0.0.1"); got != http.StatusOK {
+		t.Errorf("Expected reads to pass, got %d", got)
+	}
+}
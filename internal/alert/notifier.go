@@ -0,0 +1,79 @@
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Alert types
+const (
+	TypeErrorBudget       = "error_budget_exceeded"
+	TypeChannelAuthFailed = "channel_auth_failed"
+	TypeSLOBurnRate       = "slo_burn_rate"
+	TypeProviderIncident  = "provider_incident"
+)
+
+// Alert is the payload posted to the alert webhook
+type Alert struct {
+	Type    string         `json:"type"`
+	Subject string         `json:"subject"`
+	Message string         `json:"message"`
+	Time    time.Time      `json:"time"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// Notifier delivers alerts to a webhook. Every alert is also logged, so a
+// notifier without a webhook URL still leaves a trace.
+type Notifier struct {
+	webhookURL string
+	client     *http.Client
+}
+
+// NewNotifier creates a notifier; an empty webhook URL only logs alerts
+func NewNotifier(webhookURL string) *Notifier {
+	return &Notifier{
+		webhookURL: webhookURL,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Notify logs the alert and posts it to the webhook in the background
+func (n *Notifier) Notify(a Alert) {
+	if a.Time.IsZero() {
+		a.Time = time.Now().UTC()
+	}
+	log.Printf("Alert [%s] %s: %s", a.Type, a.Subject, a.Message)
+
+	if n == nil || n.webhookURL == "" {
+		return
+	}
+
+	go func() {
+		if err := n.send(a); err != nil {
+			log.Printf("Failed to deliver alert [%s] %s: %v", a.Type, a.Subject, err)
+		}
+	}()
+}
+
+// send posts an alert to the webhook
+func (n *Notifier) send(a Alert) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+
+	resp, err := n.client.Post(n.webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+)
+
+// completionSummary holds the parts of a completion response or chunk that
+// analytics aggregate
+type completionSummary struct {
+	Choices []struct {
+		Index        int     `json:"index"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *Usage `json:"usage"`
+}
+
+// finishReason returns the finish reason of the first choice, if reported
+func (s *completionSummary) finishReason() string {
+	for _, choice := range s.Choices {
+		if choice.Index == 0 && choice.FinishReason != nil {
+			return *choice.FinishReason
+		}
+	}
+	return ""
+}
+
+// scanFinishReason extracts the finish reason of the first choice from a
+// completion response body
+func scanFinishReason(body []byte) string {
+	var summary completionSummary
+	if err := json.Unmarshal(body, &summary); err != nil {
+		return ""
+	}
+	return summary.finishReason()
+}
+
+// recordAnalytics adds a successful chat completion to the analytics
+// aggregates. hasUsage is false when the backend did not report usage.
+func (h *Handler) recordAnalytics(userID int64, model, endUser, finishReason string, usage Usage, hasUsage bool) {
+	stats := database.CompletionStats{
+		Model:        model,
+		UserID:       userID,
+		EndUser:      endUser,
+		FinishReason: finishReason,
+		At:           time.Now(),
+	}
+	if hasUsage {
+		stats.HasUsage = true
+		stats.PromptTokens = usage.PromptTokens
+		stats.CompletionTokens = usage.CompletionTokens
+	}
+	if err := h.db.RecordCompletionStats(stats); err != nil {
+		log.Printf("Failed to record analytics: user=%d model=%s: %v", userID, model, err)
+	}
+}
+
+// analyticsObserver collects the finish reason and usage of a streamed chat
+// completion and records them once the stream ends successfully
+type analyticsObserver struct {
+	h            *Handler
+	info         StreamInfo
+	finishReason string
+	usage        Usage
+	hasUsage     bool
+}
+
+// newAnalyticsObserver is the stream observer factory for analytics
+func (h *Handler) newAnalyticsObserver(info StreamInfo) StreamObserver {
+	return &analyticsObserver{h: h, info: info}
+}
+
+// ObserveEvent picks the finish reason and usage out of a chunk
+func (o *analyticsObserver) ObserveEvent(data []byte) {
+	if len(data) == 0 || data[0] != '{' {
+		return
+	}
+	var chunk completionSummary
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		return
+	}
+	if reason := chunk.finishReason(); reason != "" {
+		o.finishReason = reason
+	}
+	if chunk.Usage != nil {
+		o.usage, o.hasUsage = *chunk.Usage, true
+	}
+}
+
+// StreamEnded records the stream unless it failed
+func (o *analyticsObserver) StreamEnded(err error) {
+	if err != nil {
+		return
+	}
+	o.h.recordAnalytics(o.info.UserID, o.info.Model, o.info.EndUser, o.finishReason, o.usage, o.hasUsage)
+}
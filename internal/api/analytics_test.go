@@ -0,0 +1,77 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+func TestChatCompletionsRecordAnalytics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler, db, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hi\"},\"finish_reason\":null}]}\n\n"))
+			w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{},\"finish_reason\":\"length\"}]}\n\n"))
+			w.Write([]byte("data: {\"choices\":[],\"usage\":{\"prompt_tokens\":30,\"completion_tokens\":20,\"total_tokens\":50}}\n\n"))
+			w.Write([]byte("data: [DONE]\n\n"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}],"usage":{"prompt_tokens":10,"completion_tokens":4,"total_tokens":14}}`))
+	}))
+	defer mockBackend.Close()
+
+	db.UpdateChannel(&database.Channel{ID: 1, Name: "test-chan", BaseURL: mockBackend.URL, APIKey: "sk-test", Weight: 10, Enabled: true})
+
+	for _, stream := range []bool{false, true} {
+		body, _ := json.Marshal(ChatCompletionRequest{
+			Model:    "gpt-3.5-turbo",
+			Messages: []ChatCompletionMessage{{Role: "user", Content: "test"}},
+			Stream:   stream,
+			User:     "customer-a",
+		})
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBuffer(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Set("user_id", int64(1))
+		handler.ChatCompletions(c)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200 (stream=%v), got %d", stream, w.Code)
+		}
+	}
+
+	buckets, err := db.QueryAnalytics(database.AnalyticsQuery{UserID: 1, Interval: 24 * time.Hour})
+	if err != nil {
+		t.Fatalf("Failed to query analytics: %v", err)
+	}
+	if len(buckets) != 1 {
+		t.Fatalf("Expected one bucket, got %+v", buckets)
+	}
+	b := buckets[0]
+	if b.Requests != 2 || b.UsageRequests != 2 || b.PromptTokens != 40 || b.CompletionTokens != 24 {
+		t.Errorf("Unexpected totals %+v", b)
+	}
+	if b.FinishReasons["stop"] != 1 || b.FinishReasons["length"] != 1 {
+		t.Errorf("Expected one stop and one length finish, got %v", b.FinishReasons)
+	}
+
+	buckets, _ = db.QueryAnalytics(database.AnalyticsQuery{EndUser: "customer-a", Interval: 24 * time.Hour, ByEndUser: true})
+	if len(buckets) != 1 || buckets[0].EndUser != "customer-a" || buckets[0].Requests != 2 {
+		t.Errorf("Expected both requests attributed to customer-a, got %+v", buckets)
+	}
+}
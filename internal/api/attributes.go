@@ -0,0 +1,62 @@
+package api
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/X0Ken/openai-gateway/internal/router"
+	"github.com/gin-gonic/gin"
+)
+
+// RoutingRuleHeader names the routing rule that chose the channel, when one did
+const RoutingRuleHeader = "X-Gateway-Routing-Rule"
+
+// SessionKeyHeader sets the stickiness key of a request, overriding its
+// "user" field
+const SessionKeyHeader = "X-Session-Key"
+
+// PinHeader pins a request to a channel: requests with the same pin are
+// routed to the same channel of the model, for reproducible evaluations
+const PinHeader = "X-Gateway-Pin"
+
+// maxSessionKeyLength bounds the session keys stored with sessions
+const maxSessionKeyLength = 256
+
+// maxPinLength bounds the pins accepted in PinHeader
+const maxPinLength = 256
+
+// routeAttributes describes a chat request to routing rules
+func routeAttributes(req *ChatCompletionRequest) router.Attributes {
+	return router.Attributes{
+		PromptTokens: estimatePromptTokens(req.Model, req.Messages),
+		HasTools:     req.Extra.has("tools") || req.Extra.has("functions"),
+		HasImages:    slices.ContainsFunc(req.Messages, ChatCompletionMessage.hasImages),
+	}
+}
+
+// sessionKey returns the key a request's sticky session is scoped to: the
+// X-Session-Key header, else the OpenAI "user" field of the request.
+// Platforms proxying many end users through one API key get affinity per end
+// user this way.
+func sessionKey(c *gin.Context, user string) (string, error) {
+	if len(user) > maxSessionKeyLength {
+		return "", errors.New("user must be at most 256 bytes")
+	}
+	key := c.GetHeader(SessionKeyHeader)
+	if key == "" {
+		key = user
+	}
+	if len(key) > maxSessionKeyLength {
+		return "", errors.New("session key must be at most 256 bytes")
+	}
+	return key, nil
+}
+
+// routingPin returns the pin of a request from PinHeader, or "" when unset
+func routingPin(c *gin.Context) (string, error) {
+	pin := c.GetHeader(PinHeader)
+	if len(pin) > maxPinLength {
+		return "", errors.New("pin must be at most 256 bytes")
+	}
+	return pin, nil
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRouteAttributes(t *testing.T) {
+	tests := []struct {
+		body       string
+		wantTools  bool
+		wantImages bool
+	}{
+		{`{"model":"gpt-4","messages":[{"role":"user","content":"hi"}]}`, false, false},
+		{`{"model":"gpt-4","messages":[{"role":"user","content":"hi"}],"tools":[{"type":"function","function":{"name":"f"}}]}`, true, false},
+		{`{"model":"gpt-4","messages":[{"role":"user","content":"hi"}],"functions":[{"name":"f"}]}`, true, false},
+		{`{"model":"gpt-4","messages":[{"role":"user","content":"hi"}],"tools":null}`, false, false},
+		{`{"model":"gpt-4","messages":[{"role":"user","content":[{"type":"text","text":"hi"}]}]}`, false, false},
+		{`{"model":"gpt-4","messages":[{"role":"user","content":[{"type":"text","text":"hi"},{"type":"image_url","image_url":{"url":"https://example.com/a.png"}}]}]}`, false, true},
+	}
+	for _, tt := range tests {
+		var req ChatCompletionRequest
+		if err := json.Unmarshal([]byte(tt.body), &req); err != nil {
+			t.Fatalf("Failed to decode %s: %v", tt.body, err)
+		}
+		attrs := routeAttributes(&req)
+		if attrs.HasTools != tt.wantTools {
+			t.Errorf("%s: HasTools = %v, want %v", tt.body, attrs.HasTools, tt.wantTools)
+		}
+		if attrs.HasImages != tt.wantImages {
+			t.Errorf("%s: HasImages = %v, want %v", tt.body, attrs.HasImages, tt.wantImages)
+		}
+		if attrs.PromptTokens == 0 {
+			t.Errorf("%s: expected a prompt token estimate", tt.body)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/internal/auth"
+	"github.com/X0Ken/openai-gateway/internal/channel"
+	"github.com/X0Ken/openai-gateway/internal/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// maxHeldUpload bounds the form parts held in memory while looking for the
+// model field of an audio upload. It matches OpenAI's 25 MB file limit.
+const maxHeldUpload = 25 << 20
+
+// maxModelField bounds the model field of an audio upload
+const maxModelField = 1 << 10
+
+// errUploadTooLarge is returned when the parts before the model field of an
+// audio upload exceed maxHeldUpload
+var errUploadTooLarge = fmt.Errorf("parts before the model field exceed %d bytes", maxHeldUpload)
+
+// heldPart is a form part read before the model field
+type heldPart struct {
+	header textproto.MIMEHeader
+	data   []byte
+}
+
+// AudioTranscriptions handles audio transcription requests
+func (h *Handler) AudioTranscriptions(c *gin.Context) {
+	h.forwardAudioUpload(c, channel.OperationTranscriptions)
+}
+
+// AudioTranslations handles audio translation requests
+func (h *Handler) AudioTranslations(c *gin.Context) {
+	h.forwardAudioUpload(c, channel.OperationTranslations)
+}
+
+// forwardAudioUpload forwards a multipart/form-data audio upload. The form is
+// read up to its model field, which is rewritten to the backend model name,
+// and the rest of the upload, normally the file, is streamed to the backend
+// as it arrives. Parts sent before the model field are held in memory, up to
+// maxHeldUpload. The backend's response, JSON or text depending on
+// response_format, is returned unchanged.
+func (h *Handler) forwardAudioUpload(c *gin.Context, op channel.Operation) {
+	userID, exists := auth.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	form, err := c.Request.MultipartReader()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "request must be multipart/form-data"})
+		return
+	}
+	model, held, err := readUntilModel(form)
+	if errors.Is(err, errUploadTooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !allowModel(c, model) {
+		return
+	}
+
+	routeResult, err := h.router.Route(userID, model)
+	if err != nil {
+		recordOutcome(model, err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+
+	release, err := h.limiter.Acquire(c.Request.Context(), routeResult.Channel.ID, userID, routeResult.Channel.MaxConcurrency)
+	if err != nil {
+		recordOutcome(model, err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "channel is at its concurrency limit"})
+		return
+	}
+	defer release()
+
+	// The form is re-encoded into a pipe as the backend reads it. Closing
+	// the read end stops the writer if the request fails before the whole
+	// form was sent.
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	writer := multipart.NewWriter(pw)
+	go func() {
+		pw.CloseWithError(writeAudioForm(writer, held, routeResult.BackendModelName, form))
+	}()
+
+	start := time.Now()
+	resp, err := h.sendUpstreamStream(upstreamContext(c), routeResult.Channel, op, routeResult.BackendModelName, pr, writer.FormDataContentType())
+	duration := time.Since(start)
+	h.observeUpstream(routeResult.Channel, err)
+
+	metrics.RecordChannelLatency(routeResult.Channel.Name, model, duration)
+	h.router.ObserveLatency(duration)
+	recordOutcome(model, err)
+
+	if err != nil {
+		h.recordForwardError(routeResult.Channel, duration, err)
+		writeForwardError(c, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	h.metrics.UpdateChannelMetrics(routeResult.Channel.ID, duration.Seconds(), true)
+	h.recordUsage(requestInfo(c, model, routeResult.Channel, routeResult.BackendModelName, ""), Usage{})
+	// Label unlabelled transcripts by their format, which is not known
+	// before the response since the form is streamed
+	body := bufio.NewReader(resp.Body)
+	first, _ := body.Peek(1)
+	fallback := transcriptContentType(0)
+	if len(first) > 0 {
+		fallback = transcriptContentType(first[0])
+	}
+	c.DataFromReader(http.StatusOK, resp.ContentLength, responseContentType(resp.Header.Get("Content-Type"), fallback), body, nil)
+}
+
+// readUntilModel reads form parts up to and including the model field and
+// returns the model with the parts that preceded it
+func readUntilModel(form *multipart.Reader) (string, []heldPart, error) {
+	var held []heldPart
+	var size int
+	for {
+		part, err := form.NextPart()
+		if err == io.EOF {
+			return "", nil, errors.New("model is required")
+		}
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid multipart form: %w", err)
+		}
+
+		if part.FormName() == "model" {
+			data, err := io.ReadAll(io.LimitReader(part, maxModelField))
+			if err != nil {
+				return "", nil, fmt.Errorf("invalid multipart form: %w", err)
+			}
+			model := strings.TrimSpace(string(data))
+			if model == "" {
+				return "", nil, errors.New("model is required")
+			}
+			return model, held, nil
+		}
+
+		data, err := io.ReadAll(io.LimitReader(part, int64(maxHeldUpload-size+1)))
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid multipart form: %w", err)
+		}
+		size += len(data)
+		if size > maxHeldUpload {
+			return "", nil, errUploadTooLarge
+		}
+		held = append(held, heldPart{header: part.Header, data: data})
+	}
+}
+
+// writeAudioForm writes the held parts, the model field set to the backend
+// model name and the remaining parts of form, copying each as it is read
+func writeAudioForm(writer *multipart.Writer, held []heldPart, backendModelName string, form *multipart.Reader) error {
+	for _, part := range held {
+		w, err := writer.CreatePart(part.header)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(part.data); err != nil {
+			return err
+		}
+	}
+	if err := writer.WriteField("model", backendModelName); err != nil {
+		return err
+	}
+
+	for {
+		part, err := form.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		w, err := writer.CreatePart(part.Header)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(w, part); err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+// AudioSpeech handles text-to-speech requests. The backend's audio is
+// streamed back to the client as it is generated.
+func (h *Handler) AudioSpeech(c *gin.Context) {
+	userID, exists := auth.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	// Decode generically so parameters such as voice and response_format
+	// reach the backend untouched
+	var body map[string]json.RawMessage
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var model string
+	if err := json.Unmarshal(body["model"], &model); err != nil || model == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "model is required"})
+		return
+	}
+
+	if !allowModel(c, model) {
+		return
+	}
+
+	routeResult, err := h.router.Route(userID, model)
+	if err != nil {
+		recordOutcome(model, err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+
+	release, err := h.limiter.Acquire(c.Request.Context(), routeResult.Channel.ID, userID, routeResult.Channel.MaxConcurrency)
+	if err != nil {
+		recordOutcome(model, err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "channel is at its concurrency limit"})
+		return
+	}
+	defer release()
+
+	modelJSON, err := json.Marshal(routeResult.BackendModelName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	body["model"] = modelJSON
+
+	start := time.Now()
+	resp, err := h.sendUpstream(upstreamContext(c), routeResult.Channel, channel.OperationSpeech, routeResult.BackendModelName, body)
+	duration := time.Since(start)
+	h.observeUpstream(routeResult.Channel, err)
+
+	metrics.RecordChannelLatency(routeResult.Channel.Name, model, duration)
+	h.router.ObserveLatency(duration)
+	recordOutcome(model, err)
+
+	if err != nil {
+		h.recordForwardError(routeResult.Channel, duration, err)
+		writeForwardError(c, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	h.metrics.UpdateChannelMetrics(routeResult.Channel.ID, duration.Seconds(), true)
+	h.recordUsage(requestInfo(c, model, routeResult.Channel, routeResult.BackendModelName, ""), Usage{})
+
+	var format string
+	json.Unmarshal(body["response_format"], &format)
+	c.Header("Content-Type", responseContentType(resp.Header.Get("Content-Type"), speechContentType(format)))
+	c.Status(http.StatusOK)
+	copyBinary(c.Writer, resp.Body)
+}
+
+// copyBinary copies a binary backend response to the client, flushing after
+// every write so audio can be played while it is generated
+func copyBinary(w http.ResponseWriter, body io.Reader) (int64, error) {
+	bufp := streamBuffers.Get().(*[]byte)
+	defer streamBuffers.Put(bufp)
+
+	buf := *bufp
+	flusher, _ := w.(http.Flusher)
+	var written int64
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			m, werr := w.Write(buf[:n])
+			written += int64(m)
+			if werr != nil {
+				return written, werr
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+// setupAudioModel maps a whisper model to the backend's whisper-1 on channel 1
+func setupAudioModel(db *database.DB, baseURL string) {
+	db.UpdateChannel(&database.Channel{ID: 1, Name: "test-chan", BaseURL: baseURL, APIKey: "sk-test", Weight: 10, Enabled: true})
+	model := &database.Model{Name: "whisper"}
+	db.CreateModel(model)
+	db.AddModelChannel(&database.ModelChannel{ModelID: model.ID, ChannelID: 1, BackendModelName: "whisper-1", Weight: 10})
+}
+
+func TestAudioTranscriptionForwardsUpload(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler, db, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/audio/transcriptions" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		if r.ContentLength != -1 {
+			t.Errorf("Expected the upload to be streamed, got Content-Length %d", r.ContentLength)
+		}
+		form, err := r.MultipartReader()
+		if err != nil {
+			t.Fatalf("Expected a multipart body: %v", err)
+		}
+		var fields []string
+		for {
+			part, err := form.NextPart()
+			if err == io.EOF {
+				break
+			}
+			data, _ := io.ReadAll(part)
+			fields = append(fields, part.FormName()+"="+string(data))
+			if part.FormName() == "file" && part.FileName() != "speech.mp3" {
+				t.Errorf("Expected the file name to be kept, got %q", part.FileName())
+			}
+		}
+		if got := strings.Join(fields, " "); got != "file=ID3audio model=whisper-1 response_format=text" {
+			t.Errorf("Unexpected form %q", got)
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte("Hello there\n"))
+	}))
+	defer mockBackend.Close()
+	setupAudioModel(db, mockBackend.URL)
+
+	// The file comes before the model, as some SDKs send it
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	file, _ := form.CreateFormFile("file", "speech.mp3")
+	file.Write([]byte("ID3audio"))
+	form.WriteField("model", "whisper")
+	form.WriteField("response_format", "text")
+	form.Close()
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/v1/audio/transcriptions", &body)
+	c.Request.Header.Set("Content-Type", form.FormDataContentType())
+	c.Set("user_id", int64(1))
+	handler.AudioTranscriptions(c)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w.Body.String() != "Hello there\n" || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("Expected the backend's text response, got %s %q", w.Header().Get("Content-Type"), w.Body.String())
+	}
+
+	// A form without a model is rejected before reaching a backend
+	body.Reset()
+	form = multipart.NewWriter(&body)
+	form.WriteField("response_format", "json")
+	form.Close()
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/v1/audio/translations", &body)
+	c.Request.Header.Set("Content-Type", form.FormDataContentType())
+	c.Set("user_id", int64(1))
+	handler.AudioTranslations(c)
+
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "model is required") {
+		t.Errorf("Expected 400 for a missing model, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestAudioSpeechStreamsAudio(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler, db, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/audio/speech" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		var req map[string]string
+		json.NewDecoder(r.Body).Decode(&req)
+		if req["model"] != "whisper-1" || req["voice"] != "alloy" {
+			t.Errorf("Unexpected request %v", req)
+		}
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Write([]byte{0xff, 0xfb, 0x90})
+		w.(http.Flusher).Flush()
+		w.Write([]byte{0x00, 0x01})
+	}))
+	defer mockBackend.Close()
+	setupAudioModel(db, mockBackend.URL)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/v1/audio/speech", strings.NewReader(`{"model":"whisper","input":"Hello","voice":"alloy"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("user_id", int64(1))
+	handler.AudioSpeech(c)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Content-Type") != "audio/mpeg" || !bytes.Equal(w.Body.Bytes(), []byte{0xff, 0xfb, 0x90, 0x00, 0x01}) {
+		t.Errorf("Expected the backend's audio, got %s %x", w.Header().Get("Content-Type"), w.Body.Bytes())
+	}
+}
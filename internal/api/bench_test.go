@@ -0,0 +1,183 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/internal/auth"
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+// overheadBudget is the most latency the gateway may add to a non-streaming
+// request on top of the backend round trip. It covers auth, routing,
+// marshaling and metrics bookkeeping, and is kept loose enough to hold on
+// slow CI machines while still catching order-of-magnitude regressions.
+const overheadBudget = 5 * time.Millisecond
+
+var benchRequestBody = []byte(`{"model":"gpt-3.5-turbo","messages":[{"role":"user","content":"Hello, how are you today?"}]}`)
+
+const benchResponseBody = `{"id":"chatcmpl-1","object":"chat.completion","created":1,"model":"gpt-3.5-turbo","choices":[{"index":0,"message":{"role":"assistant","content":"I am fine, thank you."},"finish_reason":"stop"}],"usage":{"prompt_tokens":9,"completion_tokens":7,"total_tokens":16}}`
+
+// newBenchBackend serves a fixed completion, streamed as 50 chunks when requested
+func newBenchBackend() *httptest.Server {
+	chunk := []byte("data: {\"id\":\"chatcmpl-1\",\"object\":\"chat.completion.chunk\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"token \"}}]}\n\n")
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+
+		if req.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			for i := 0; i < 50; i++ {
+				w.Write(chunk)
+			}
+			w.Write([]byte("data: [DONE]\n\n"))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(benchResponseBody))
+	}))
+}
+
+// setupBenchGateway wires the chat endpoint behind auth against a local backend
+func setupBenchGateway(tb testing.TB) (*gin.Engine, *httptest.Server, func()) {
+	gin.SetMode(gin.TestMode)
+
+	handler, db, cleanup := setupTestHandler(tb)
+	backend := newBenchBackend()
+
+	db.UpdateChannel(&database.Channel{
+		ID:      1,
+		Name:    "test-chan",
+		BaseURL: backend.URL,
+		APIKey:  "sk-test",
+		Weight:  10,
+		Enabled: true,
+	})
+
+	r := gin.New()
+	handler.RegisterRoutes(r.Group("/v1"), auth.NewMiddleware(db))
+
+	return r, backend, func() {
+		backend.Close()
+		cleanup()
+	}
+}
+
+// serveChat sends one chat completion through the gateway
+func serveChat(tb testing.TB, r *gin.Engine, body []byte) {
+	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer test-key")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		tb.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// callBackend sends one chat completion straight to the backend
+func callBackend(tb testing.TB, url string, body []byte) {
+	resp, err := http.Post(url+"/v1/chat/completions", "application/json", bytes.NewReader(body))
+	if err != nil {
+		tb.Fatalf("Backend request failed: %v", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+}
+
+func BenchmarkBackendDirect(b *testing.B) {
+	_, backend, cleanup := setupBenchGateway(b)
+	defer cleanup()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		callBackend(b, backend.URL, benchRequestBody)
+	}
+}
+
+func BenchmarkChatCompletions(b *testing.B) {
+	r, _, cleanup := setupBenchGateway(b)
+	defer cleanup()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		serveChat(b, r, benchRequestBody)
+	}
+}
+
+func BenchmarkChatCompletionsStream(b *testing.B) {
+	r, _, cleanup := setupBenchGateway(b)
+	defer cleanup()
+
+	body := []byte(`{"model":"gpt-3.5-turbo","stream":true,"messages":[{"role":"user","content":"Hello"}]}`)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		serveChat(b, r, body)
+	}
+}
+
+func BenchmarkRoute(b *testing.B) {
+	handler, _, cleanup := setupTestHandler(b)
+	defer cleanup()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := handler.router.Route(1, "gpt-3.5-turbo"); err != nil {
+			b.Fatalf("Route failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkMarshalRequest(b *testing.B) {
+	var req ChatCompletionRequest
+	json.Unmarshal(benchRequestBody, &req)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := json.Marshal(&req); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// TestOverheadBudget fails when the latency the gateway adds to a request
+// exceeds overheadBudget. Wall-clock timings are unreliable on a loaded
+// machine, so it only runs when GATEWAY_OVERHEAD_BUDGET is set.
+func TestOverheadBudget(t *testing.T) {
+	if os.Getenv("GATEWAY_OVERHEAD_BUDGET") == "" {
+		t.Skip("set GATEWAY_OVERHEAD_BUDGET to check the overhead budget")
+	}
+
+	r, backend, cleanup := setupBenchGateway(t)
+	defer cleanup()
+
+	direct := testing.Benchmark(func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			callBackend(b, backend.URL, benchRequestBody)
+		}
+	})
+	gateway := testing.Benchmark(func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			serveChat(b, r, benchRequestBody)
+		}
+	})
+
+	overhead := time.Duration(gateway.NsPerOp() - direct.NsPerOp())
+	t.Logf("backend %v/op, gateway %v/op, overhead %v/op",
+		time.Duration(direct.NsPerOp()), time.Duration(gateway.NsPerOp()), overhead)
+
+	if overhead > overheadBudget {
+		t.Errorf("Gateway overhead %v exceeds budget %v", overhead, overheadBudget)
+	}
+}
@@ -0,0 +1,227 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultBufferLimit is the largest non-streaming response read whole
+// before it is sent, when none is configured
+const DefaultBufferLimit = 1 << 20
+
+// errInvalidJSON is returned when a backend's non-streaming response is not
+// a JSON document
+var errInvalidJSON = errors.New("backend returned invalid JSON")
+
+// readBody reads a non-streaming backend response whole when it is at most
+// limit bytes, so it can be checked and inspected before it is sent. A body
+// whose Content-Length is over the limit, or that grows past it, is read no
+// further and returned as a largeBody, to be copied to the client as it is
+// read. A limit of 0 or less reads every body whole. The response body is
+// closed unless a largeBody is returned.
+func readBody(resp *http.Response, limit int64) ([]byte, *largeBody, error) {
+	if limit > 0 && resp.ContentLength > limit {
+		return nil, &largeBody{r: resp.Body, body: resp.Body, size: resp.ContentLength}, nil
+	}
+
+	r := io.Reader(resp.Body)
+	if limit > 0 {
+		r = io.LimitReader(resp.Body, limit+1)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		resp.Body.Close()
+		return nil, nil, err
+	}
+	if limit > 0 && int64(len(data)) > limit {
+		return nil, &largeBody{r: io.MultiReader(bytes.NewReader(data), resp.Body), body: resp.Body, size: resp.ContentLength}, nil
+	}
+	resp.Body.Close()
+
+	if !json.Valid(data) {
+		return nil, nil, errInvalidJSON
+	}
+	return data, nil, nil
+}
+
+// largeBody is a non-streaming backend response too large to hold in
+// memory. It is copied to the client with its usage and finish reason
+// picked out on the way.
+type largeBody struct {
+	r    io.Reader
+	body io.ReadCloser
+	// size is the body's Content-Length, or -1 when unknown
+	size    int64
+	scanner usageScanner
+}
+
+// Close closes the backend response
+func (b *largeBody) Close() error {
+	return b.body.Close()
+}
+
+// Usage returns the top-level usage of the copied response, if reported
+func (b *largeBody) Usage() (Usage, bool) {
+	return b.scanner.usage, b.scanner.hasUsage
+}
+
+// FinishReason returns the finish reason of the copied response's first choice
+func (b *largeBody) FinishReason() string {
+	return b.scanner.finishReason
+}
+
+// copyTo answers the request with the body. The status is sent before the
+// body is read, so a backend failing midway leaves the client a truncated
+// response, which a known Content-Length lets it detect. errClientGone is
+// returned when the client stops reading.
+func (b *largeBody) copyTo(c *gin.Context) error {
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	if b.size >= 0 {
+		c.Header("Content-Length", strconv.FormatInt(b.size, 10))
+	}
+	c.Status(http.StatusOK)
+
+	bufp := streamBuffers.Get().(*[]byte)
+	defer streamBuffers.Put(bufp)
+	buf := *bufp
+
+	for {
+		n, err := b.r.Read(buf)
+		if n > 0 {
+			b.scanner.Write(buf[:n])
+			if _, werr := c.Writer.Write(buf[:n]); werr != nil {
+				return errClientGone
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("backend response broken: %w", err)
+		}
+	}
+
+	if !b.scanner.complete() {
+		return errInvalidJSON
+	}
+	return nil
+}
+
+// Limits of what usageScanner keeps of a response
+const (
+	maxScannedString = 32
+	maxScannedUsage  = 64 * 1024
+)
+
+// usageScanner follows a completion response as it is written, picking out
+// the top-level usage object and the first choice's finish reason without
+// holding the rest. It tracks just enough of the JSON grammar to tell keys
+// from values and strings from structure; the response is not validated
+// beyond its brackets being balanced.
+type usageScanner struct {
+	depth    int
+	started  bool
+	inString bool
+	escaped  bool
+	// isValue is set while reading a string that follows a colon
+	isValue    bool
+	afterColon bool
+	str        []byte
+	// keys holds the last key read at each depth up to choice objects
+	keys [4]string
+
+	inUsage      bool
+	usageData    []byte
+	usage        Usage
+	hasUsage     bool
+	finishReason string
+}
+
+// Write scans p. It never fails.
+func (s *usageScanner) Write(p []byte) (int, error) {
+	for _, b := range p {
+		s.scan(b)
+	}
+	return len(p), nil
+}
+
+// complete reports whether a whole JSON object or array was scanned
+func (s *usageScanner) complete() bool {
+	return s.started && s.depth == 0 && !s.inString
+}
+
+// scan advances the scanner by one byte
+func (s *usageScanner) scan(b byte) {
+	if s.inUsage {
+		s.usageData = append(s.usageData, b)
+		if len(s.usageData) > maxScannedUsage {
+			s.inUsage, s.usageData = false, nil
+		}
+	}
+
+	if s.inString {
+		switch {
+		case s.escaped:
+			s.escaped = false
+		case b == '\\':
+			s.escaped = true
+		case b == '"':
+			s.inString = false
+			s.endString()
+			return
+		}
+		if len(s.str) < maxScannedString {
+			s.str = append(s.str, b)
+		}
+		return
+	}
+
+	switch b {
+	case '"':
+		s.inString, s.isValue = true, s.afterColon
+		s.str = s.str[:0]
+	case ':':
+		s.afterColon = true
+	case ',':
+		s.afterColon = false
+	case '{', '[':
+		s.depth++
+		s.started = true
+		if b == '{' && s.depth == 2 && s.afterColon && s.keys[1] == "usage" {
+			s.inUsage, s.usageData = true, append(s.usageData[:0], b)
+		}
+		s.afterColon = false
+	case '}', ']':
+		s.depth--
+		s.afterColon = false
+		if s.inUsage && s.depth == 1 {
+			s.inUsage = false
+			var usage Usage
+			if json.Unmarshal(s.usageData, &usage) == nil {
+				s.usage, s.hasUsage = usage, true
+			}
+		}
+	}
+}
+
+// endString records a key read at a tracked depth, or the first choice's
+// finish reason
+func (s *usageScanner) endString() {
+	if s.depth < 1 || s.depth >= len(s.keys) {
+		return
+	}
+	if !s.isValue {
+		s.keys[s.depth] = string(s.str)
+		return
+	}
+	if s.depth == 3 && s.keys[1] == "choices" && s.keys[3] == "finish_reason" && s.finishReason == "" {
+		s.finishReason = string(s.str)
+	}
+}
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/X0Ken/openai-gateway/internal/metrics"
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestUsageScanner(t *testing.T) {
+	body := `{"id":"x","choices":[{"index":0,"message":{"role":"assistant","content":"the \"usage\": {\"prompt_tokens\": 99}","finish_reason":"fake"},"finish_reason":"length"},{"index":1,"finish_reason":"stop"}],` +
+		`"usage":{"prompt_tokens":3,"completion_tokens":4,"total_tokens":7,"completion_tokens_details":{"reasoning_tokens":1}}}`
+
+	// Bytes arrive one at a time, splitting every key and value
+	var s usageScanner
+	for i := range len(body) {
+		s.Write([]byte{body[i]})
+	}
+	if !s.complete() {
+		t.Error("Expected the whole document to be scanned")
+	}
+	if want := (Usage{PromptTokens: 3, CompletionTokens: 4, TotalTokens: 7}); !s.hasUsage || s.usage != want {
+		t.Errorf("Expected usage %+v, got %+v (found %v)", want, s.usage, s.hasUsage)
+	}
+	if s.finishReason != "length" {
+		t.Errorf("Expected the first choice's finish reason, got %q", s.finishReason)
+	}
+
+	var truncated usageScanner
+	truncated.Write([]byte(body[:len(body)/2]))
+	if truncated.complete() || truncated.hasUsage {
+		t.Error("Expected a truncated document to be incomplete")
+	}
+}
+
+// largeCompletion returns a chat completion with content of n bytes
+func largeCompletion(n int) string {
+	return `{"id":"chatcmpl-1","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":"` + strings.Repeat("a", n) +
+		`"},"finish_reason":"stop"}],"usage":{"prompt_tokens":10,"completion_tokens":500,"total_tokens":510}}`
+}
+
+func TestLargeResponseCopiedAsRead(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler, db, cleanup := setupTestHandler(t)
+	defer cleanup()
+	handler.SetBufferLimit(1024)
+
+	// The first response has a Content-Length, the second is chunked
+	upstream := largeCompletion(100 * 1024)
+	requests := 0
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		if requests == 1 {
+			w.Header().Set("Content-Length", strconv.Itoa(len(upstream)))
+		}
+		w.Write([]byte(upstream))
+	}))
+	defer mockBackend.Close()
+
+	db.UpdateChannel(&database.Channel{ID: 1, Name: "test-chan", BaseURL: mockBackend.URL, APIKey: "sk-test", Weight: 10, Enabled: true})
+
+	for _, chunked := range []bool{false, true} {
+		body, _ := json.Marshal(ChatCompletionRequest{
+			Model:    "gpt-3.5-turbo",
+			Messages: []ChatCompletionMessage{{Role: "user", Content: "test"}},
+		})
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBuffer(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Set("user_id", int64(1))
+		handler.ChatCompletions(c)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200 (chunked=%v), got %d", chunked, w.Code)
+		}
+		if w.Body.String() != upstream {
+			t.Errorf("Expected the upstream body verbatim (chunked=%v), got %d bytes", chunked, w.Body.Len())
+		}
+		if got := w.Header().Get("Content-Length"); !chunked && got != strconv.Itoa(len(upstream)) {
+			t.Errorf("Expected the backend's Content-Length, got %q", got)
+		}
+	}
+
+	logs, err := db.ListUsageLogs(database.UsageQuery{UserID: 1}, 10)
+	if err != nil {
+		t.Fatalf("Failed to list usage logs: %v", err)
+	}
+	if len(logs) != 2 || logs[0].TotalTokens != 510 || logs[1].CompletionTokens != 500 {
+		t.Errorf("Expected the usage of both large responses recorded, got %+v", logs)
+	}
+}
+
+func TestLargeResponseBrokenMidway(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler, db, cleanup := setupTestHandler(t)
+	defer cleanup()
+	handler.SetBufferLimit(1024)
+
+	upstream := largeCompletion(100 * 1024)
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Length", strconv.Itoa(len(upstream)))
+		w.Write([]byte(upstream[:len(upstream)/2]))
+		w.(http.Flusher).Flush()
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	}))
+	defer mockBackend.Close()
+
+	db.UpdateChannel(&database.Channel{ID: 1, Name: "test-chan", BaseURL: mockBackend.URL, APIKey: "sk-test", Weight: 10, Enabled: true})
+	errorsBefore := testutil.ToFloat64(metrics.ErrorCounter.WithLabelValues("channel", "test-chan"))
+
+	body, _ := json.Marshal(ChatCompletionRequest{
+		Model:    "gpt-3.5-turbo",
+		Messages: []ChatCompletionMessage{{Role: "user", Content: "test"}},
+	})
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBuffer(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("user_id", int64(1))
+	handler.ChatCompletions(c)
+
+	// The status went out with the start of the body; the client is left
+	// short of the Content-Length it was promised
+	if w.Code != http.StatusOK || w.Body.Len() >= len(upstream) {
+		t.Errorf("Expected a truncated 200 response, got %d with %d of %d bytes", w.Code, w.Body.Len(), len(upstream))
+	}
+	if got := w.Header().Get("Content-Length"); got != strconv.Itoa(len(upstream)) {
+		t.Errorf("Expected the backend's Content-Length, got %q", got)
+	}
+
+	logs, _ := db.ListUsageLogs(database.UsageQuery{UserID: 1}, 10)
+	if len(logs) != 0 {
+		t.Errorf("Expected no usage from a broken response, got %+v", logs)
+	}
+	if got := testutil.ToFloat64(metrics.ErrorCounter.WithLabelValues("channel", "test-chan")) - errorsBefore; got != 1 {
+		t.Errorf("Expected the broken response counted against the channel, got %v errors", got)
+	}
+}
@@ -1,19 +1,31 @@
 package api
 
 import (
-	"bufio"
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/X0Ken/openai-gateway/internal/alert"
 	"github.com/X0Ken/openai-gateway/internal/auth"
+	"github.com/X0Ken/openai-gateway/internal/breaker"
+	"github.com/X0Ken/openai-gateway/internal/budget"
 	"github.com/X0Ken/openai-gateway/internal/channel"
+	"github.com/X0Ken/openai-gateway/internal/dedup"
+	"github.com/X0Ken/openai-gateway/internal/fairshare"
+	"github.com/X0Ken/openai-gateway/internal/flags"
 	"github.com/X0Ken/openai-gateway/internal/metrics"
+	"github.com/X0Ken/openai-gateway/internal/provider"
+	"github.com/X0Ken/openai-gateway/internal/quota"
+	"github.com/X0Ken/openai-gateway/internal/replay"
 	"github.com/X0Ken/openai-gateway/internal/router"
 	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/X0Ken/openai-gateway/pkg/store"
 	"github.com/gin-gonic/gin"
 )
 
@@ -22,56 +34,209 @@ type Handler struct {
 	router     *router.Engine
 	channelMgr *channel.Manager
 	db         *database.DB
+	metrics    store.Metrics
+	budget     *budget.Tracker
+	breakers   *breaker.Breakers
+	dedup      *dedup.Deduplicator
+	limiter    *fairshare.Limiter
+	notifier   *alert.Notifier
+	keys       *channel.KeyPool
+	flags      *flags.Flags
+	quota      *quota.Checker
+	capture    *replay.Recorder
+	quality    bool
+	// streamUsage requests usage from backends on every stream, so streams
+	// are accounted for even when clients do not ask for usage
+	streamUsage bool
+	// heartbeat is how long a stream may be silent before a ping comment
+	// is sent; 0 disables pings
+	heartbeat time.Duration
+	// bufferLimit is the largest non-streaming response read whole before
+	// it is sent; larger ones are copied to the client as they are read
+	bufferLimit int64
+
+	authFailures    authFailures
+	streamObservers []StreamObserverFactory
 }
 
 // NewHandler creates a new API handler
 func NewHandler(router *router.Engine, channelMgr *channel.Manager, db *database.DB) *Handler {
-	return &Handler{
+	h := &Handler{
 		router:     router,
 		channelMgr: channelMgr,
 		db:         db,
+		metrics:    db,
+		limiter:    fairshare.NewLimiter(),
+		keys:       channel.NewKeyPool(),
+
+		bufferLimit: DefaultBufferLimit,
 	}
+	h.AddStreamObserver(h.newAnalyticsObserver)
+	h.AddStreamObserver(h.newUsageObserver)
+	return h
+}
+
+// SetMetricsStore records channel metrics in the given store, such as one
+// shared by the replicas of a cluster
+func (h *Handler) SetMetricsStore(metrics store.Metrics) {
+	h.metrics = metrics
+}
+
+// SetErrorBudget enables per-user error budget tracking on authenticated routes
+func (h *Handler) SetErrorBudget(tracker *budget.Tracker) {
+	h.budget = tracker
+}
+
+// SetBreakers feeds the outcome of every upstream request to the channels'
+// circuit breakers
+func (h *Handler) SetBreakers(b *breaker.Breakers) {
+	h.breakers = b
+}
+
+// SetDeduplicator enables detection of duplicate requests on authenticated routes
+func (h *Handler) SetDeduplicator(d *dedup.Deduplicator) {
+	h.dedup = d
+}
+
+// SetNotifier sets the notifier used to raise channel alerts
+func (h *Handler) SetNotifier(notifier *alert.Notifier) {
+	h.notifier = notifier
+}
+
+// SetQuota enables monthly quota enforcement on routes that call a model
+func (h *Handler) SetQuota(checker *quota.Checker) {
+	h.quota = checker
+}
+
+// SetCapture records a sample of the requests to routes that call a model,
+// for replay against another gateway
+func (h *Handler) SetCapture(recorder *replay.Recorder) {
+	h.capture = recorder
+}
+
+// SetStreamUsage makes streamed chat completions and completions request a
+// usage chunk from the backend. It is removed from the stream of clients that did not set
+// stream_options.include_usage.
+func (h *Handler) SetStreamUsage(enabled bool) {
+	h.streamUsage = enabled
+}
+
+// SetStreamHeartbeat sends a ": ping" comment on streams silent for d, so
+// proxies do not close them while a slow backend is thinking
+func (h *Handler) SetStreamHeartbeat(d time.Duration) {
+	h.heartbeat = d
+}
+
+// SetBufferLimit sets the largest non-streaming response, in bytes, read
+// whole before it is sent. Larger responses are copied to the client as
+// they are read, with their usage picked out on the way. 0 reads every
+// response whole.
+func (h *Handler) SetBufferLimit(n int64) {
+	h.bufferLimit = n
+}
+
+// SetFeatureFlags sets the flags gating new request handling behaviors
+func (h *Handler) SetFeatureFlags(f *flags.Flags) {
+	h.flags = f
+}
+
+// featureEnabled reports whether the named feature flag is on for the
+// request's user. Every flag is off until SetFeatureFlags is called.
+func (h *Handler) featureEnabled(c *gin.Context, name string) bool {
+	return h.flags.Enabled(name, c.GetInt64("user_id"))
 }
 
 // RegisterRoutes registers OpenAI API routes
 func (h *Handler) RegisterRoutes(r *gin.RouterGroup, authMiddleware *auth.Middleware) {
 	// OpenAI compatible endpoints
-	r.GET("/models", h.ListModels)
+	r.Use(Tracing())
+	r.GET("/models", authMiddleware.OptionalAuth(), h.ListModels)
 
 	authenticated := r.Group("/")
 	authenticated.Use(authMiddleware.RequireAuth())
+	if h.budget != nil {
+		authenticated.Use(h.budget.Middleware())
+	}
+	if h.dedup != nil {
+		authenticated.Use(h.dedup.Middleware())
+	}
+	{
+		authenticated.POST("/token-count", h.TokenCount)
+		authenticated.POST("/preflight", h.Preflight)
+	}
+
+	// Routes that call a model count against the user's quota
+	metered := authenticated.Group("/")
+	metered.Use(Tags())
+	if h.quota != nil {
+		metered.Use(h.quota.Middleware())
+	}
+	if h.capture != nil {
+		metered.Use(h.capture.Middleware())
+	}
 	{
-		authenticated.POST("/chat/completions", h.ChatCompletions)
+		metered.POST("/chat/completions", h.ChatCompletions)
+		metered.POST("/completions", h.Completions)
+		metered.POST("/embeddings", h.Embeddings)
+		metered.POST("/audio/transcriptions", h.AudioTranscriptions)
+		metered.POST("/audio/translations", h.AudioTranslations)
+		metered.POST("/audio/speech", h.AudioSpeech)
 	}
 }
 
 // ChatCompletionRequest represents an OpenAI chat completion request
 type ChatCompletionRequest struct {
-	Model    string                  `json:"model" binding:"required"`
-	Messages []ChatCompletionMessage `json:"messages" binding:"required"`
-	Stream   bool                    `json:"stream,omitempty"`
+	Model         string                  `json:"model" binding:"required"`
+	Messages      []ChatCompletionMessage `json:"messages" binding:"required"`
+	Stream        bool                    `json:"stream,omitempty"`
+	StreamOptions *StreamOptions          `json:"stream_options,omitempty"`
+	// User is the caller's identifier for its end user, used as the
+	// stickiness key and forwarded to the backend
+	User string `json:"user,omitempty"`
+	// Extra holds members the gateway does not model, such as tools,
+	// tool_choice, response_format or sampling parameters. They are
+	// inspected by routing rules and forwarded to the backend unchanged.
+	Extra extraFields `json:"-"`
+}
+
+// StreamOptions represents options for streaming responses
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
 }
 
 // ChatCompletionMessage represents a message in the conversation
 type ChatCompletionMessage struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
+	// Parts holds content given as an array of parts, such as text and
+	// image_url parts. It is forwarded unchanged in place of Content, which
+	// then holds the text of the text parts.
+	Parts json.RawMessage `json:"-"`
+	Extra extraFields     `json:"-"`
+
+	// nullContent records a null or missing content in a decoded message
+	nullContent bool
 }
 
 // ChatCompletionResponse represents an OpenAI chat completion response
 type ChatCompletionResponse struct {
-	ID      string   `json:"id"`
-	Object  string   `json:"object"`
-	Created int64    `json:"created"`
-	Model   string   `json:"model"`
-	Choices []Choice `json:"choices"`
-	Usage   Usage    `json:"usage"`
+	ID                string      `json:"id"`
+	Object            string      `json:"object"`
+	Created           int64       `json:"created"`
+	Model             string      `json:"model"`
+	SystemFingerprint string      `json:"system_fingerprint,omitempty"`
+	Choices           []Choice    `json:"choices"`
+	Usage             Usage       `json:"usage"`
+	Extra             extraFields `json:"-"`
 }
 
 // Choice represents a completion choice
 type Choice struct {
-	Index   int                   `json:"index"`
-	Message ChatCompletionMessage `json:"message"`
+	Index        int                   `json:"index"`
+	Message      ChatCompletionMessage `json:"message"`
+	Logprobs     json.RawMessage       `json:"logprobs,omitempty"`
+	FinishReason string                `json:"finish_reason,omitempty"`
+	Extra        extraFields           `json:"-"`
 }
 
 // Usage represents token usage
@@ -95,126 +260,372 @@ func (h *Handler) ChatCompletions(c *gin.Context) {
 		return
 	}
 
+	attrs := routeAttributes(&req)
+	var err error
+	attrs.SessionKey, err = sessionKey(c, req.User)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	attrs.Pin, err = routingPin(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !allowModel(c, req.Model) {
+		return
+	}
+
 	// Route to best channel
-	routeResult, err := h.router.Route(userID, req.Model)
+	routeResult, err := h.router.RouteRequest(userID, req.Model, attrs)
 	if err != nil {
+		recordOutcome(req.Model, err)
 		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
 		return
 	}
+	if routeResult.Rule != "" {
+		c.Header(RoutingRuleHeader, routeResult.Rule)
+	}
+
+	// Drop the oldest messages to fit the context window when opted in
+	if truncationEnabled(c, routeResult.Model) {
+		var dropped int
+		req.Messages, dropped = truncateMessages(req.Model, req.Messages, routeResult.Model.ContextWindow)
+		if dropped > 0 {
+			c.Header(TruncatedHeader, strconv.Itoa(dropped))
+		}
+	}
+	setEstimatedTokens(c, &req)
+
+	// Wait for a slot when the channel is at its concurrency limit; waiting
+	// requests are served round-robin across users
+	release, err := h.limiter.Acquire(c.Request.Context(), routeResult.Channel.ID, userID, routeResult.Channel.MaxConcurrency)
+	if err != nil {
+		recordOutcome(req.Model, err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "channel is at its concurrency limit"})
+		return
+	}
+	defer release()
 
 	// Handle streaming vs non-streaming
 	if req.Stream {
-		// Streaming mode
-		start := time.Now()
-		err := h.forwardStreamRequest(c, routeResult.Channel, routeResult.BackendModelName, &req)
-		duration := time.Since(start)
-
-		// Update metrics
-		metrics.RecordChannelLatency(routeResult.Channel.Name, req.Model, duration)
+		// Streaming mode. A stream that breaks or fails with a 5xx status
+		// before any content reached the client is retried once on
+		// another channel.
+		err := h.serveStream(c, routeResult, &req, true)
+		if retryableStream(c, err) {
+			// The failed channel's slot is not held through the retry
+			release()
+			err = h.retryStream(c, userID, attrs, routeResult, &req, err)
+		}
+		recordOutcome(req.Model, err)
 
 		if err != nil {
-			metrics.RecordChannelError(routeResult.Channel.Name)
-			h.db.UpdateChannelMetrics(routeResult.Channel.ID, duration.Seconds(), false)
-			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			writeStreamFailure(c, err)
 			return
 		}
-
-		h.db.UpdateChannelMetrics(routeResult.Channel.ID, duration.Seconds(), true)
 	} else {
 		// Non-streaming mode
 		start := time.Now()
-		resp, err := h.forwardRequest(routeResult.Channel, routeResult.BackendModelName, &req)
+		var body []byte
+		var large *largeBody
+		var usage Usage
+		var hasUsage bool
+		var finishReason string
+		var err error
+		if routeResult.StreamMode == database.StreamModeAlways {
+			var resp *ChatCompletionResponse
+			resp, err = h.forwardAggregatedRequest(upstreamContext(c), routeResult.Channel, routeResult.BackendModelName, &req)
+			if err == nil {
+				usage, hasUsage = resp.Usage, true
+				if len(resp.Choices) > 0 {
+					finishReason = resp.Choices[0].FinishReason
+				}
+				body, err = json.Marshal(resp)
+			}
+		} else {
+			body, large, err = h.forwardRawRequest(upstreamContext(c), routeResult.Channel, routeResult.BackendModelName, &req)
+			if large != nil {
+				// Too large to hold: the response is sent as it is read
+				defer large.Close()
+				err = large.copyTo(c)
+				usage, hasUsage = large.Usage()
+				finishReason = large.FinishReason()
+			} else {
+				usage, hasUsage = scanUsage(body)
+				finishReason = scanFinishReason(body)
+			}
+		}
 		duration := time.Since(start)
+		h.observeUpstream(routeResult.Channel, err)
 
 		// Update metrics
 		metrics.RecordChannelLatency(routeResult.Channel.Name, req.Model, duration)
+		h.router.ObserveLatency(duration)
+		recordOutcome(req.Model, err)
 
+		if errors.Is(err, errClientGone) {
+			log.Printf("Client disconnected from response on channel %s for model %s", routeResult.Channel.Name, req.Model)
+			return
+		}
 		if err != nil {
-			metrics.RecordChannelError(routeResult.Channel.Name)
-			h.db.UpdateChannelMetrics(routeResult.Channel.ID, duration.Seconds(), false)
-			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			h.recordForwardError(routeResult.Channel, duration, err)
+			if large != nil {
+				// The status was sent with the start of the body
+				log.Printf("Response on channel %s for model %s broke after it started: %v", routeResult.Channel.Name, req.Model, err)
+				return
+			}
+			writeForwardError(c, err)
 			return
 		}
 
-		h.db.UpdateChannelMetrics(routeResult.Channel.ID, duration.Seconds(), true)
-		c.JSON(http.StatusOK, resp)
+		metrics.RecordTokens(routeResult.Channel.Name, req.Model, usage.PromptTokens, usage.CompletionTokens)
+		h.metrics.UpdateChannelMetrics(routeResult.Channel.ID, duration.Seconds(), true)
+		h.recordAnalytics(userID, req.Model, req.User, finishReason, usage, hasUsage)
+		if hasUsage {
+			h.recordUsage(requestInfo(c, req.Model, routeResult.Channel, routeResult.BackendModelName, req.User), usage)
+		}
+		if large == nil {
+			h.checkQuality(routeResult.Channel.Name, &req, body)
+			c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+		}
+	}
+}
+
+// forwardRawRequest forwards the request to the backend channel and returns
+// the response body unparsed, so fields unknown to the gateway reach the
+// client. A body over the handler's buffer limit is returned unread as a
+// largeBody instead.
+func (h *Handler) forwardRawRequest(ctx context.Context, ch *database.Channel, backendModelName string, req *ChatCompletionRequest) ([]byte, *largeBody, error) {
+	forwardReq := *req
+	forwardReq.Model = backendModelName
+
+	resp, err := h.sendChatRequest(ctx, ch, &forwardReq)
+	if err != nil {
+		return nil, nil, err
 	}
+	return readBody(resp, h.bufferLimit)
 }
 
 // forwardRequest forwards the request to the backend channel
-func (h *Handler) forwardRequest(channel *database.Channel, backendModelName string, req *ChatCompletionRequest) (*ChatCompletionResponse, error) {
+func (h *Handler) forwardRequest(ctx context.Context, ch *database.Channel, backendModelName string, req *ChatCompletionRequest) (*ChatCompletionResponse, error) {
 	// Prepare request body with backend-specific model name
 	forwardReq := *req
 	forwardReq.Model = backendModelName
-	body, err := json.Marshal(forwardReq)
+
+	resp, err := h.sendChatRequest(ctx, ch, &forwardReq)
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 
-	// Create request
-	url := channel.BaseURL + "/chat/completions"
-	httpReq, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	// Parse response
+	var result ChatCompletionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// sendChatRequest sends a prepared chat request to the backend channel and
+// returns the response once the backend has accepted it with 200 OK
+func (h *Handler) sendChatRequest(ctx context.Context, ch *database.Channel, forwardReq *ChatCompletionRequest) (*http.Response, error) {
+	return h.sendUpstream(ctx, ch, channel.OperationChat, forwardReq.Model, forwardReq)
+}
+
+// sendUpstream posts a JSON payload for an operation to the backend channel
+// and returns the response once the backend has accepted it with 200 OK. The
+// trace in ctx is propagated, and the backend's request ID is logged with it.
+func (h *Handler) sendUpstream(ctx context.Context, ch *database.Channel, op channel.Operation, backendModelName string, payload any) (*http.Response, error) {
+	body, err := json.Marshal(payload)
 	if err != nil {
 		return nil, err
 	}
+	return h.send(ctx, ch, op, backendModelName, body, nil)
+}
 
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+channel.APIKey)
+// sendUpstreamStream sends a body read from r with the given content type,
+// such as a multipart upload, streaming it to the backend without buffering
+func (h *Handler) sendUpstreamStream(ctx context.Context, ch *database.Channel, op channel.Operation, backendModelName string, r io.ReadCloser, contentType string) (*http.Response, error) {
+	return h.send(ctx, ch, op, backendModelName, nil, func(req *http.Request) {
+		req.Body = r
+		req.GetBody = nil
+		req.ContentLength = -1
+		req.Header.Set("Content-Type", contentType)
+	})
+}
+
+// send sends body to the channel, retrying retryable failures on the same
+// channel under its retry policy. Each attempt takes the channel's next API
+// key. Bodies streamed by prepare cannot be read twice and are sent once.
+func (h *Handler) send(ctx context.Context, ch *database.Channel, op channel.Operation, backendModelName string, body []byte, prepare func(*http.Request)) (*http.Response, error) {
+	policy := h.channelMgr.RetryPolicy(ch)
+	for attempt := 1; ; attempt++ {
+		resp, err := h.sendOnce(ctx, ch, op, backendModelName, body, prepare)
+		if err == nil || body == nil || attempt >= policy.MaxAttempts {
+			return resp, err
+		}
+		delay, ok := h.retryDelay(ctx, ch, policy, attempt, err)
+		if !ok {
+			return nil, err
+		}
+
+		log.Printf("Retrying request on channel %s in %s after attempt %d of %d failed: %v", ch.Name, delay, attempt, policy.MaxAttempts, err)
+		metrics.RecordUpstreamRetry(ch.Name)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+	}
+}
+
+// sendOnce builds the upstream request for body in the channel's API, lets
+// prepare adjust it and sends it. Non-200 responses are returned as
+// UpstreamErrors.
+func (h *Handler) sendOnce(ctx context.Context, ch *database.Channel, op channel.Operation, backendModelName string, body []byte, prepare func(*http.Request)) (*http.Response, error) {
+	// Create request in the channel's API
+	adapter := provider.For(ch)
+	apiKey := h.keys.Next(ch)
+	httpReq, err := adapter.NewRequest(ctx, ch, op, backendModelName, body, apiKey)
+	if errors.Is(err, provider.ErrUnsupported) {
+		return nil, unsupportedError(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if prepare != nil {
+		prepare(httpReq)
+	}
+	trace := traceFrom(ctx)
+	setTraceHeaders(httpReq, trace)
 
 	// Send request
-	client := &http.Client{Timeout: 60 * time.Second}
+	client, err := h.channelMgr.Client(ch)
+	if err != nil {
+		return nil, err
+	}
 	resp, err := client.Do(httpReq)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	if err := adapter.ConvertResponse(resp, op, body); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	h.observeKey(ch, apiKey, resp, time.Now())
+	if trace != nil {
+		log.Printf("Upstream response: request_id=%s trace_id=%s channel=%s status=%d upstream_request_id=%s",
+			trace.RequestID, trace.TraceID, ch.Name, resp.StatusCode, upstreamRequestID(resp.Header))
+	}
 
 	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("backend error: %s", string(body))
+		return nil, &UpstreamError{StatusCode: resp.StatusCode, ContentType: resp.Header.Get("Content-Type"), RetryAfter: resp.Header.Get("Retry-After"), Body: body}
 	}
 
-	// Parse response
-	var result ChatCompletionResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, err
+	return resp, nil
+}
+
+// serveStream streams a chat completion from a route's channel and records
+// the attempt in the channel's metrics. retryable tells whether a failure
+// before any content may still be retried on another channel.
+func (h *Handler) serveStream(c *gin.Context, route *router.RouteResult, req *ChatCompletionRequest, retryable bool) error {
+	start := time.Now()
+	streamEnded := metrics.StreamStarted(route.Channel.Name, req.Model)
+	var err error
+	if route.StreamMode == database.StreamModeNever {
+		err = h.forwardTranscodedStream(c, route.Channel, route.BackendModelName, req)
+	} else {
+		maxDuration := time.Duration(route.Model.MaxStreamSeconds) * time.Second
+		err = h.forwardStreamRequest(c, route.Channel, route.BackendModelName, req, maxDuration, retryable)
+	}
+	streamEnded()
+	duration := time.Since(start)
+	if err != nil && c.Request.Context().Err() != nil {
+		err = stoppedStream(c)
+		if errors.Is(err, ErrShuttingDown) {
+			log.Printf("Stream on channel %s for model %s cut off by shutdown", route.Channel.Name, req.Model)
+		} else {
+			log.Printf("Client disconnected from stream on channel %s for model %s", route.Channel.Name, req.Model)
+		}
 	}
+	h.observeUpstream(route.Channel, err)
 
-	return &result, nil
-}
+	metrics.RecordStreamedBytes(route.Channel.Name, req.Model, c.Writer.Size())
 
-// forwardStreamRequest forwards the request to the backend channel and streams the response
-func (h *Handler) forwardStreamRequest(c *gin.Context, channel *database.Channel, backendModelName string, req *ChatCompletionRequest) error {
-	// Prepare request body with backend-specific model name and stream enabled
-	forwardReq := *req
-	forwardReq.Model = backendModelName
-	forwardReq.Stream = true
-	body, err := json.Marshal(forwardReq)
+	// Update metrics
+	metrics.RecordChannelLatency(route.Channel.Name, req.Model, duration)
+	h.router.ObserveLatency(duration)
+
+	if errors.Is(err, errClientGone) || errors.Is(err, ErrShuttingDown) {
+		return err
+	}
 	if err != nil {
+		h.recordForwardError(route.Channel, duration, err)
 		return err
 	}
 
-	// Create request
-	url := channel.BaseURL + "/chat/completions"
-	httpReq, err := http.NewRequest("POST", url, bytes.NewReader(body))
-	if err != nil {
+	h.metrics.UpdateChannelMetrics(route.Channel.ID, duration.Seconds(), true)
+	return nil
+}
+
+// retryStream retries a stream that failed before any content on another
+// channel serving the model. err, the failure being retried, is returned
+// when no other channel can take the request.
+func (h *Handler) retryStream(c *gin.Context, userID int64, attrs router.Attributes, failed *router.RouteResult, req *ChatCompletionRequest, err error) error {
+	attrs.Exclude = append(attrs.Exclude, failed.Channel.ID)
+	route, routeErr := h.router.RouteRequest(userID, req.Model, attrs)
+	if routeErr != nil {
+		return err
+	}
+	release, acquireErr := h.limiter.Acquire(c.Request.Context(), route.Channel.ID, userID, route.Channel.MaxConcurrency)
+	if acquireErr != nil {
 		return err
 	}
+	defer release()
 
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+channel.APIKey)
+	log.Printf("Stream on channel %s failed before any content, retrying on %s: %v", failed.Channel.Name, route.Channel.Name, err)
+	metrics.RecordStreamRetry(failed.Channel.Name)
+	if route.Rule != "" {
+		c.Header(RoutingRuleHeader, route.Rule)
+	}
+	return h.serveStream(c, route, req, false)
+}
 
-	// Send request
-	client := &http.Client{Timeout: 60 * time.Second}
-	resp, err := client.Do(httpReq)
+// forwardStreamRequest forwards the request to the backend channel and streams
+// the response. A positive maxDuration caps how long the stream may run.
+// While the stream is retryable, heartbeats wait for its first content.
+func (h *Handler) forwardStreamRequest(c *gin.Context, ch *database.Channel, backendModelName string, req *ChatCompletionRequest, maxDuration time.Duration, retryable bool) error {
+	// Prepare request body with backend-specific model name and stream enabled
+	forwardReq := *req
+	forwardReq.Model = backendModelName
+	forwardReq.Stream = true
+	injectUsage := h.streamUsage && (req.StreamOptions == nil || !req.StreamOptions.IncludeUsage)
+	if injectUsage {
+		forwardReq.StreamOptions = &StreamOptions{IncludeUsage: true}
+	}
+
+	resp, err := h.sendChatRequest(streamContext(c), ch, &forwardReq)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("backend error: %s", string(body))
+	// A backend that ignored the stream flag answers with a complete
+	// response, which is replayed to the client as a stream
+	if isJSONResponse(resp.Header.Get("Content-Type")) {
+		var result ChatCompletionResponse
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return err
+		}
+		log.Printf("Channel %s answered a stream with a complete response, replaying it as a stream", ch.Name)
+		return writeSyntheticStream(c, &result, h.newStreamObservers(c, ch, backendModelName, req))
 	}
 
 	// Set SSE headers
@@ -222,23 +633,24 @@ func (h *Handler) forwardStreamRequest(c *gin.Context, channel *database.Channel
 	c.Header("Cache-Control", "no-cache")
 	c.Header("Connection", "keep-alive")
 
-	// Stream the response
-	reader := bufio.NewReader(resp.Body)
-	for {
-		line, err := reader.ReadString('\n')
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return err
-		}
-
-		// Forward the line to the client
-		c.Writer.Write([]byte(line))
-		c.Writer.Flush()
+	// Stream the response, holding it back until the first content
+	guard := newStreamGuard(resp.Body)
+	if maxDuration > 0 {
+		stop := guard.limit(maxDuration, resp.Body)
+		defer stop()
 	}
-
-	return nil
+	observers := h.newStreamObservers(c, ch, backendModelName, req)
+	var body io.Reader = guard
+	if injectUsage {
+		body = newUsageStripper(guard, observers)
+	}
+	w, stopHeartbeat := startHeartbeat(c.Writer, h.heartbeat, retryable)
+	_, err = copyStream(w, body, observers)
+	stopHeartbeat()
+	if guard.expired.Load() {
+		log.Printf("Stream on channel %s for model %s cut off after %s", ch.Name, req.Model, maxDuration)
+	}
+	return err
 }
 
 // Model represents an OpenAI model
@@ -249,6 +661,17 @@ type Model struct {
 	OwnedBy string `json:"owned_by"`
 }
 
+// allowModel checks that the request's credential may call model, writing
+// a 404 and returning false when it may not. The model is reported as
+// missing so its existence is not disclosed.
+func allowModel(c *gin.Context, model string) bool {
+	if auth.ModelAllowed(c, model) {
+		return true
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("model %s does not exist or is not available to this API key", model)})
+	return false
+}
+
 // ListModelsResponse represents the models list response
 type ListModelsResponse struct {
 	Object string  `json:"object"`
@@ -264,9 +687,12 @@ func (h *Handler) ListModels(c *gin.Context) {
 		return
 	}
 
-	// Build response
+	// Build response, listing only the models the caller may use
 	var models []Model
 	for _, m := range modelsList {
+		if !auth.ModelAllowed(c, m.Name) {
+			continue
+		}
 		models = append(models, Model{
 			ID:      m.Name,
 			Object:  "model",
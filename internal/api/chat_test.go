@@ -9,12 +9,15 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/X0Ken/openai-gateway/internal/channel"
+	"github.com/X0Ken/openai-gateway/internal/metrics"
 	"github.com/X0Ken/openai-gateway/internal/router"
 	"github.com/X0Ken/openai-gateway/pkg/database"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
-func setupTestHandler(t *testing.T) (*Handler, *database.DB, func()) {
+func setupTestHandler(t testing.TB) (*Handler, *database.DB, func()) {
 	dbPath := "/tmp/test_chat.db"
 	db, err := database.New(dbPath)
 	if err != nil {
@@ -26,14 +29,14 @@ func setupTestHandler(t *testing.T) (*Handler, *database.DB, func()) {
 	db.CreateUser(user)
 
 	// Create test channel
-	channel := &database.Channel{
+	ch := &database.Channel{
 		Name:    "test-chan",
 		BaseURL: "https://api.openai.com",
 		APIKey:  "sk-test",
 		Weight:  10,
 		Enabled: true,
 	}
-	db.CreateChannel(channel)
+	db.CreateChannel(ch)
 
 	// Create test model
 	model := &database.Model{Name: "gpt-3.5-turbo"}
@@ -42,14 +45,14 @@ func setupTestHandler(t *testing.T) (*Handler, *database.DB, func()) {
 	// Create model-channel mapping
 	mc := &database.ModelChannel{
 		ModelID:          model.ID,
-		ChannelID:        channel.ID,
+		ChannelID:        ch.ID,
 		BackendModelName: "gpt-3.5-turbo",
 		Weight:           10,
 	}
 	db.AddModelChannel(mc)
 
 	routerEngine := router.NewEngine(db)
-	handler := NewHandler(routerEngine, nil, db)
+	handler := NewHandler(routerEngine, channel.NewManager(db), db)
 
 	cleanup := func() {
 		db.Close()
@@ -127,6 +130,14 @@ func TestChatCompletionRequestStreamField(t *testing.T) {
 	if !strings.Contains(body, "data:") {
 		t.Error("Expected SSE format with 'data:' prefix")
 	}
+
+	// Stream metrics are recorded and the stream is no longer active
+	if got := testutil.ToFloat64(metrics.StreamedBytes.WithLabelValues("test-chan", "gpt-3.5-turbo")); got < float64(len(body)) {
+		t.Errorf("Expected at least %d streamed bytes, got %v", len(body), got)
+	}
+	if got := testutil.ToFloat64(metrics.ActiveStreams.WithLabelValues("test-chan", "gpt-3.5-turbo")); got != 0 {
+		t.Errorf("Expected no active streams, got %v", got)
+	}
 }
 
 func TestChatCompletionRequestNonStream(t *testing.T) {
@@ -301,3 +312,219 @@ func TestChatCompletionRequestStreamFalse(t *testing.T) {
 		t.Errorf("Expected JSON response for stream=false, got Content-Type: %s", contentType)
 	}
 }
+
+func TestChatCompletionForwardsTools(t *testing.T) {
+	// Test that fields the gateway does not model reach the backend
+	gin.SetMode(gin.TestMode)
+
+	handler, db, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	var received map[string]json.RawMessage
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"test-id","object":"chat.completion","created":1,"model":"gpt-3.5-turbo","choices":[{"index":0,"message":{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"weather","arguments":"{}"}}]},"finish_reason":"tool_calls"}],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`))
+	}))
+	defer mockBackend.Close()
+	db.UpdateChannel(&database.Channel{ID: 1, Name: "test-chan", BaseURL: mockBackend.URL, APIKey: "sk-test", Weight: 10, Enabled: true})
+
+	w := postChat(handler, `{"model":"gpt-3.5-turbo","messages":[{"role":"user","content":"Weather?"}],"tools":[{"type":"function","function":{"name":"weather","parameters":{"type":"object"}}}],"tool_choice":"required","temperature":0.5,"max_tokens":64}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	for name, want := range map[string]string{
+		"tools":       `[{"type":"function","function":{"name":"weather","parameters":{"type":"object"}}}]`,
+		"tool_choice": `"required"`,
+		"temperature": `0.5`,
+		"max_tokens":  `64`,
+	} {
+		if string(received[name]) != want {
+			t.Errorf("Expected %s %s to be forwarded, got %s", name, want, received[name])
+		}
+	}
+	if !strings.Contains(w.Body.String(), `"tool_calls":[{"id":"call_1"`) {
+		t.Errorf("Expected the tool calls in the response, got %s", w.Body.String())
+	}
+}
+
+func TestChatCompletionForwardsContentParts(t *testing.T) {
+	// Test that vision requests reach the backend unmodified
+	gin.SetMode(gin.TestMode)
+
+	handler, db, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	var received struct {
+		Messages []json.RawMessage `json:"messages"`
+	}
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"test-id","object":"chat.completion","created":1,"model":"gpt-3.5-turbo","choices":[{"index":0,"message":{"role":"assistant","content":"A cat."},"finish_reason":"stop"}]}`))
+	}))
+	defer mockBackend.Close()
+	db.UpdateChannel(&database.Channel{ID: 1, Name: "test-chan", BaseURL: mockBackend.URL, APIKey: "sk-test", Weight: 10, Enabled: true})
+
+	message := `{"role":"user","content":[{"type":"text","text":"What is this?"},{"type":"image_url","image_url":{"url":"https://example.com/cat.png"}}]}`
+	w := postChat(handler, `{"model":"gpt-3.5-turbo","messages":[`+message+`]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(received.Messages) != 1 || string(received.Messages[0]) != message {
+		t.Errorf("Expected the message to be forwarded unchanged, got %s", received.Messages)
+	}
+}
+
+func TestChatCompletionTranscodedStream(t *testing.T) {
+	// Test that streaming clients are served from a non-streaming backend
+	gin.SetMode(gin.TestMode)
+
+	handler, db, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ChatCompletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if req.Stream {
+			t.Error("Expected stream to be false for a backend without streaming support")
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ChatCompletionResponse{
+			ID:      "test-id",
+			Object:  "chat.completion",
+			Created: 1234567890,
+			Model:   "gpt-3.5-turbo",
+			Choices: []Choice{{Index: 0, Message: ChatCompletionMessage{Role: "assistant", Content: "Hello!"}}},
+			Usage:   Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+		})
+	}))
+	defer mockBackend.Close()
+
+	handler.db.UpdateChannel(&database.Channel{
+		ID:      1,
+		Name:    "test-chan",
+		BaseURL: mockBackend.URL,
+		APIKey:  "sk-test",
+		Weight:  10,
+		Enabled: true,
+	})
+	if _, err := db.Exec("UPDATE model_channels SET stream_mode = ?", database.StreamModeNever); err != nil {
+		t.Fatalf("Failed to set stream mode: %v", err)
+	}
+
+	reqBody := ChatCompletionRequest{
+		Model:    "gpt-3.5-turbo",
+		Messages: []ChatCompletionMessage{{Role: "user", Content: "test"}},
+		Stream:   true,
+	}
+	jsonBody, _ := json.Marshal(reqBody)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBuffer(jsonBody))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("user_id", int64(1))
+
+	handler.ChatCompletions(c)
+
+	if w.Header().Get("Content-Type") != "text/event-stream" {
+		t.Errorf("Expected Content-Type text/event-stream, got %s", w.Header().Get("Content-Type"))
+	}
+
+	body := w.Body.String()
+	if !strings.Contains(body, `"object":"chat.completion.chunk"`) {
+		t.Errorf("Expected a synthesized chunk, got %s", body)
+	}
+	if !strings.Contains(body, `"content":"Hello!"`) {
+		t.Errorf("Expected content in delta, got %s", body)
+	}
+	if !strings.HasSuffix(body, "data: [DONE]\n\n") {
+		t.Errorf("Expected stream to end with [DONE], got %s", body)
+	}
+}
+
+func TestChatCompletionAggregatedStream(t *testing.T) {
+	// Test that non-streaming clients are served from a stream-only backend
+	gin.SetMode(gin.TestMode)
+
+	handler, db, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ChatCompletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if !req.Stream {
+			t.Error("Expected stream to be true for a stream-only backend")
+		}
+		if req.StreamOptions == nil || !req.StreamOptions.IncludeUsage {
+			t.Error("Expected stream_options.include_usage to be requested")
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"id\":\"test-id\",\"object\":\"chat.completion.chunk\",\"created\":1234567890,\"model\":\"gpt-3.5-turbo\",\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"Hel\"},\"finish_reason\":null}]}\n\n"))
+		w.Write([]byte("data: {\"id\":\"test-id\",\"object\":\"chat.completion.chunk\",\"created\":1234567890,\"model\":\"gpt-3.5-turbo\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"lo!\"},\"finish_reason\":\"stop\"}]}\n\n"))
+		w.Write([]byte("data: {\"id\":\"test-id\",\"object\":\"chat.completion.chunk\",\"created\":1234567890,\"model\":\"gpt-3.5-turbo\",\"choices\":[],\"usage\":{\"prompt_tokens\":10,\"completion_tokens\":2,\"total_tokens\":12}}\n\n"))
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer mockBackend.Close()
+
+	handler.db.UpdateChannel(&database.Channel{
+		ID:      1,
+		Name:    "test-chan",
+		BaseURL: mockBackend.URL,
+		APIKey:  "sk-test",
+		Weight:  10,
+		Enabled: true,
+	})
+	if _, err := db.Exec("UPDATE model_channels SET stream_mode = ?", database.StreamModeAlways); err != nil {
+		t.Fatalf("Failed to set stream mode: %v", err)
+	}
+
+	reqBody := ChatCompletionRequest{
+		Model:    "gpt-3.5-turbo",
+		Messages: []ChatCompletionMessage{{Role: "user", Content: "test"}},
+	}
+	jsonBody, _ := json.Marshal(reqBody)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBuffer(jsonBody))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("user_id", int64(1))
+
+	handler.ChatCompletions(c)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp ChatCompletionResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+
+	if resp.Object != "chat.completion" {
+		t.Errorf("Expected object 'chat.completion', got '%s'", resp.Object)
+	}
+	if len(resp.Choices) != 1 || resp.Choices[0].Message.Content != "Hello!" {
+		t.Errorf("Expected assembled content 'Hello!', got %+v", resp.Choices)
+	}
+	if resp.Choices[0].FinishReason != "stop" {
+		t.Errorf("Expected finish reason 'stop', got '%s'", resp.Choices[0].FinishReason)
+	}
+	if resp.Usage.TotalTokens != 12 {
+		t.Errorf("Expected total tokens 12, got %d", resp.Usage.TotalTokens)
+	}
+}
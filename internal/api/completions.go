@@ -0,0 +1,201 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/internal/auth"
+	"github.com/X0Ken/openai-gateway/internal/channel"
+	"github.com/X0Ken/openai-gateway/internal/metrics"
+	"github.com/X0Ken/openai-gateway/internal/router"
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+// CompletionsRequest represents a legacy OpenAI text completion request
+type CompletionsRequest struct {
+	Model string `json:"model" binding:"required"`
+	// Prompt is a string, an array of strings or token arrays, and is
+	// forwarded unchanged
+	Prompt        json.RawMessage `json:"prompt" binding:"required"`
+	Stream        bool            `json:"stream,omitempty"`
+	StreamOptions *StreamOptions  `json:"stream_options,omitempty"`
+	User          string          `json:"user,omitempty"`
+	// Extra holds sampling parameters such as max_tokens, suffix or echo,
+	// which are forwarded to the backend
+	Extra extraFields `json:"-"`
+}
+
+// UnmarshalJSON decodes a request, keeping unknown members in Extra
+func (r *CompletionsRequest) UnmarshalJSON(data []byte) error {
+	type plain CompletionsRequest
+	extra, err := unmarshalWithExtra(data, (*plain)(r))
+	r.Extra = extra
+	return err
+}
+
+// MarshalJSON encodes a request including its unknown members
+func (r CompletionsRequest) MarshalJSON() ([]byte, error) {
+	type plain CompletionsRequest
+	return marshalWithExtra(plain(r), r.Extra)
+}
+
+// Completions handles legacy text completion requests. They are routed like
+// chat completions, but stream_mode transcoding does not apply: the backend
+// is asked for the mode the client requested.
+func (h *Handler) Completions(c *gin.Context) {
+	userID, exists := auth.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	var req CompletionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	key, err := sessionKey(c, req.User)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	pin, err := routingPin(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !allowModel(c, req.Model) {
+		return
+	}
+
+	routeResult, err := h.router.RouteRequest(userID, req.Model, router.Attributes{SessionKey: key, Pin: pin})
+	if err != nil {
+		recordOutcome(req.Model, err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	if routeResult.Rule != "" {
+		c.Header(RoutingRuleHeader, routeResult.Rule)
+	}
+
+	release, err := h.limiter.Acquire(c.Request.Context(), routeResult.Channel.ID, userID, routeResult.Channel.MaxConcurrency)
+	if err != nil {
+		recordOutcome(req.Model, err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "channel is at its concurrency limit"})
+		return
+	}
+	defer release()
+
+	start := time.Now()
+	var body []byte
+	var large *largeBody
+	if req.Stream {
+		streamEnded := metrics.StreamStarted(routeResult.Channel.Name, req.Model)
+		err = h.forwardCompletionsStream(c, routeResult.Channel, routeResult.BackendModelName, &req)
+		streamEnded()
+		metrics.RecordStreamedBytes(routeResult.Channel.Name, req.Model, c.Writer.Size())
+		if err != nil && c.Request.Context().Err() != nil {
+			err = stoppedStream(c)
+		}
+	} else {
+		body, large, err = h.forwardCompletions(upstreamContext(c), routeResult.Channel, routeResult.BackendModelName, &req)
+		if large != nil {
+			// Too large to hold: the response is sent as it is read
+			defer large.Close()
+			err = large.copyTo(c)
+		}
+	}
+	duration := time.Since(start)
+	h.observeUpstream(routeResult.Channel, err)
+
+	metrics.RecordChannelLatency(routeResult.Channel.Name, req.Model, duration)
+	h.router.ObserveLatency(duration)
+	recordOutcome(req.Model, err)
+
+	if errors.Is(err, errClientGone) {
+		return
+	}
+	if err != nil {
+		if !errors.Is(err, ErrShuttingDown) {
+			h.recordForwardError(routeResult.Channel, duration, err)
+		}
+		if req.Stream {
+			writeStreamFailure(c, err)
+		} else if large != nil {
+			// The status was sent with the start of the body
+			log.Printf("Response on channel %s for model %s broke after it started: %v", routeResult.Channel.Name, req.Model, err)
+		} else {
+			writeForwardError(c, err)
+		}
+		return
+	}
+
+	h.metrics.UpdateChannelMetrics(routeResult.Channel.ID, duration.Seconds(), true)
+	if !req.Stream {
+		usage, hasUsage := scanUsage(body)
+		if large != nil {
+			usage, hasUsage = large.Usage()
+		}
+		metrics.RecordTokens(routeResult.Channel.Name, req.Model, usage.PromptTokens, usage.CompletionTokens)
+		if hasUsage {
+			h.recordUsage(requestInfo(c, req.Model, routeResult.Channel, routeResult.BackendModelName, req.User), usage)
+		}
+		if large == nil {
+			c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+		}
+	}
+}
+
+// forwardCompletions forwards a non-streaming completion request and returns
+// the backend's response body unparsed, or unread as a largeBody when it is
+// over the handler's buffer limit
+func (h *Handler) forwardCompletions(ctx context.Context, ch *database.Channel, backendModelName string, req *CompletionsRequest) ([]byte, *largeBody, error) {
+	forwardReq := *req
+	forwardReq.Model = backendModelName
+
+	resp, err := h.sendUpstream(ctx, ch, channel.OperationCompletions, backendModelName, &forwardReq)
+	if err != nil {
+		return nil, nil, err
+	}
+	return readBody(resp, h.bufferLimit)
+}
+
+// forwardCompletionsStream forwards a streaming completion request and
+// copies the backend's SSE stream to the client, recording its usage
+func (h *Handler) forwardCompletionsStream(c *gin.Context, ch *database.Channel, backendModelName string, req *CompletionsRequest) error {
+	forwardReq := *req
+	forwardReq.Model = backendModelName
+	forwardReq.Stream = true
+	injectUsage := h.streamUsage && (req.StreamOptions == nil || !req.StreamOptions.IncludeUsage)
+	if injectUsage {
+		forwardReq.StreamOptions = &StreamOptions{IncludeUsage: true}
+	}
+
+	resp, err := h.sendUpstream(streamContext(c), ch, channel.OperationCompletions, backendModelName, &forwardReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+
+	observers := []StreamObserver{h.newUsageObserver(requestInfo(c, req.Model, ch, backendModelName, req.User))}
+	var body io.Reader = resp.Body
+	if injectUsage {
+		body = newUsageStripper(resp.Body, observers)
+	}
+	w, stopHeartbeat := startHeartbeat(c.Writer, h.heartbeat, false)
+	_, err = copyStream(w, body, observers)
+	stopHeartbeat()
+	return err
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+func TestCompletionsForwardsLegacyRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler, db, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	upstream := `{"id":"cmpl-1","object":"text_completion","choices":[{"text":" world","index":0,"finish_reason":"stop"}],"usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}}`
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/completions" {
+			t.Errorf("Expected /v1/completions, got %s", r.URL.Path)
+		}
+		var req map[string]any
+		json.NewDecoder(r.Body).Decode(&req)
+		if req["max_tokens"] != float64(5) || req["prompt"] != "Hello" {
+			t.Errorf("Expected prompt and max_tokens forwarded, got %v", req)
+		}
+
+		if req["stream"] == true {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: {\"choices\":[{\"text\":\" world\",\"index\":0}]}\n\ndata: [DONE]\n\n"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(upstream))
+	}))
+	defer mockBackend.Close()
+
+	db.UpdateChannel(&database.Channel{ID: 1, Name: "test-chan", BaseURL: mockBackend.URL, APIKey: "sk-test", Weight: 10, Enabled: true})
+
+	send := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/v1/completions", bytes.NewBufferString(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Set("user_id", int64(1))
+		handler.Completions(c)
+		return w
+	}
+
+	w := send(`{"model":"gpt-3.5-turbo","prompt":"Hello","max_tokens":5}`)
+	if w.Code != http.StatusOK || w.Body.String() != upstream {
+		t.Errorf("Expected the upstream body verbatim, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = send(`{"model":"gpt-3.5-turbo","prompt":"Hello","max_tokens":5,"stream":true}`)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "data: [DONE]") {
+		t.Errorf("Expected the stream relayed, got %d %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Expected text/event-stream, got %s", ct)
+	}
+
+	if w := send(`{"model":"gpt-3.5-turbo"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without a prompt, got %d", w.Code)
+	}
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"mime"
+	"strings"
+)
+
+// speechContentTypes maps speech response formats to their media types, for
+// backends that do not label the audio they return
+var speechContentTypes = map[string]string{
+	"mp3":  "audio/mpeg",
+	"opus": "audio/ogg",
+	"aac":  "audio/aac",
+	"flac": "audio/flac",
+	"wav":  "audio/wav",
+	"pcm":  "audio/pcm",
+}
+
+// speechContentType returns the media type of speech in a response format,
+// which defaults to mp3
+func speechContentType(format string) string {
+	if contentType, ok := speechContentTypes[format]; ok {
+		return contentType
+	}
+	return speechContentTypes["mp3"]
+}
+
+// transcriptContentType guesses the media type of a transcription response
+// from its first byte: the json formats start with an object, the others
+// are text
+func transcriptContentType(first byte) string {
+	if first == '{' {
+		return "application/json; charset=utf-8"
+	}
+	return "text/plain; charset=utf-8"
+}
+
+// responseContentType returns the Content-Type to send a client for an
+// upstream response labelled header. A missing, malformed or generic
+// application/octet-stream header is replaced by fallback, and text and JSON
+// types without a charset are labelled UTF-8, which is what the API returns.
+func responseContentType(header, fallback string) string {
+	mediaType, params, err := mime.ParseMediaType(header)
+	if err != nil || mediaType == "application/octet-stream" {
+		return fallback
+	}
+	if _, ok := params["charset"]; !ok && isTextual(mediaType) {
+		params["charset"] = "utf-8"
+	}
+	if formatted := mime.FormatMediaType(mediaType, params); formatted != "" {
+		return formatted
+	}
+	return fallback
+}
+
+// isTextual reports whether a media type carries text
+func isTextual(mediaType string) bool {
+	return strings.HasPrefix(mediaType, "text/") || mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// isJSONResponse reports whether a Content-Type header labels a JSON body
+func isJSONResponse(header string) bool {
+	mediaType, _, err := mime.ParseMediaType(header)
+	return err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"))
+}
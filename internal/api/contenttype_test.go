@@ -0,0 +1,62 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+func TestResponseContentType(t *testing.T) {
+	tests := []struct {
+		header, fallback, want string
+	}{
+		{"audio/mpeg", "audio/wav", "audio/mpeg"},
+		{"", "audio/wav", "audio/wav"},
+		{"application/octet-stream", "audio/ogg", "audio/ogg"},
+		{"not a type;", "text/plain; charset=utf-8", "text/plain; charset=utf-8"},
+		{"text/plain", "", "text/plain; charset=utf-8"},
+		{"text/vtt; charset=iso-8859-1", "", "text/vtt; charset=iso-8859-1"},
+		{"application/json", "", "application/json; charset=utf-8"},
+		{"application/problem+json", "", "application/problem+json; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		if got := responseContentType(tt.header, tt.fallback); got != tt.want {
+			t.Errorf("responseContentType(%q, %q) = %q, want %q", tt.header, tt.fallback, got, tt.want)
+		}
+	}
+
+	if got := speechContentType("flac"); got != "audio/flac" {
+		t.Errorf("Expected audio/flac for flac speech, got %s", got)
+	}
+	if got := speechContentType(""); got != "audio/mpeg" {
+		t.Errorf("Expected mp3 speech by default, got %s", got)
+	}
+}
+
+func TestStreamAnsweredWithJSONIsReplayed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler, db, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id": "chatcmpl-1", "object": "chat.completion", "model": "gpt-3.5-turbo", "choices": [{"index": 0, "message": {"role": "assistant", "content": "Hello"}, "finish_reason": "stop"}], "usage": {"prompt_tokens": 3, "completion_tokens": 1, "total_tokens": 4}}`)
+	}))
+	defer mockBackend.Close()
+	db.UpdateChannel(&database.Channel{ID: 1, Name: "test-chan", BaseURL: mockBackend.URL, APIKey: "sk-test", Weight: 10, Enabled: true})
+
+	w := postChat(handler, `{"model": "gpt-3.5-turbo", "messages": [{"role": "user", "content": "hi"}], "stream": true}`)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected an SSE response, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, `"content":"Hello"`) || !strings.HasSuffix(body, "data: [DONE]\n\n") {
+		t.Errorf("Expected the response replayed as a stream, got %s", body)
+	}
+}
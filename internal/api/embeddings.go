@@ -0,0 +1,338 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/internal/auth"
+	"github.com/X0Ken/openai-gateway/internal/channel"
+	"github.com/X0Ken/openai-gateway/internal/metrics"
+	"github.com/X0Ken/openai-gateway/internal/router"
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/X0Ken/openai-gateway/pkg/workerpool"
+	"github.com/gin-gonic/gin"
+)
+
+// EmbeddingResponse represents an OpenAI embeddings response
+type EmbeddingResponse struct {
+	Object string          `json:"object"`
+	Data   []EmbeddingData `json:"data"`
+	Model  string          `json:"model"`
+	Usage  EmbeddingUsage  `json:"usage"`
+}
+
+// EmbeddingData represents one embedding. The vector is kept raw so float
+// and base64 encodings pass through unchanged.
+type EmbeddingData struct {
+	Object    string          `json:"object"`
+	Embedding json.RawMessage `json:"embedding"`
+	Index     int             `json:"index"`
+}
+
+// EmbeddingUsage represents token usage of an embeddings request
+type EmbeddingUsage struct {
+	PromptTokens int `json:"prompt_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+// embeddingBatch is the input of one upstream embeddings call
+type embeddingBatch struct {
+	input  json.RawMessage
+	offset int
+}
+
+// Embeddings handles embeddings requests. Input arrays larger than the
+// channel's max_batch_size are split into several upstream calls whose
+// results are merged in order.
+func (h *Handler) Embeddings(c *gin.Context) {
+	userID, exists := auth.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	// Decode generically so parameters such as dimensions and
+	// encoding_format reach the backend untouched
+	var body map[string]json.RawMessage
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var model string
+	if err := json.Unmarshal(body["model"], &model); err != nil || model == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "model is required"})
+		return
+	}
+	if len(bytes.TrimSpace(body["input"])) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "input is required"})
+		return
+	}
+
+	pin, err := routingPin(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !allowModel(c, model) {
+		return
+	}
+
+	routeResult, err := h.router.RouteRequest(userID, model, router.Attributes{Pin: pin})
+	if err != nil {
+		recordOutcome(model, err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+
+	release, err := h.limiter.Acquire(c.Request.Context(), routeResult.Channel.ID, userID, routeResult.Channel.MaxConcurrency)
+	if err != nil {
+		recordOutcome(model, err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "channel is at its concurrency limit"})
+		return
+	}
+	defer release()
+
+	batches, err := splitEmbeddingInput(body["input"], routeResult.Channel.MaxBatchSize)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	start := time.Now()
+	resp, err := h.forwardEmbeddings(upstreamContext(c), routeResult.Channel, routeResult.BackendModelName, body, batches)
+	// Vectors shortened on request are not comparable to the model's own
+	if _, shortened := body["dimensions"]; err == nil && !shortened {
+		err = h.checkDimensions(routeResult, resp)
+	}
+	duration := time.Since(start)
+	h.observeUpstream(routeResult.Channel, err)
+
+	metrics.RecordChannelLatency(routeResult.Channel.Name, model, duration)
+	h.router.ObserveLatency(duration)
+	recordOutcome(model, err)
+
+	if err != nil {
+		h.recordForwardError(routeResult.Channel, duration, err)
+		writeForwardError(c, err)
+		return
+	}
+
+	h.metrics.UpdateChannelMetrics(routeResult.Channel.ID, duration.Seconds(), true)
+	h.recordUsage(requestInfo(c, model, routeResult.Channel, routeResult.BackendModelName, ""), Usage{PromptTokens: resp.Usage.PromptTokens, TotalTokens: resp.Usage.TotalTokens})
+	c.JSON(http.StatusOK, resp)
+}
+
+// embeddingBatchConcurrency bounds the number of batches of one request sent
+// upstream in parallel
+const embeddingBatchConcurrency = 4
+
+// forwardEmbeddings sends the batches upstream and merges the results in
+// order, shifting indexes by the batch offset and summing usage. Batches run
+// in parallel unless the channel limits its concurrency, in which case they
+// run one after another so the request holds a single slot. The first batch
+// to fail cancels the others.
+func (h *Handler) forwardEmbeddings(ctx context.Context, ch *database.Channel, backendModelName string, body map[string]json.RawMessage, batches []embeddingBatch) (*EmbeddingResponse, error) {
+	modelJSON, err := json.Marshal(backendModelName)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := embeddingBatchConcurrency
+	if ch.MaxConcurrency > 0 {
+		limit = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	indexes := make([]int, len(batches))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	results := make([]EmbeddingResponse, len(batches))
+	errs := make([]error, len(batches))
+	workerpool.Run(ctx, limit, indexes, func(ctx context.Context, i int) error {
+		payload := make(map[string]json.RawMessage, len(body))
+		for k, v := range body {
+			payload[k] = v
+		}
+		payload["model"] = modelJSON
+		payload["input"] = batches[i].input
+
+		resp, err := h.sendUpstream(ctx, ch, channel.OperationEmbeddings, backendModelName, payload)
+		if err == nil {
+			err = json.NewDecoder(resp.Body).Decode(&results[i])
+			resp.Body.Close()
+		}
+		if err != nil {
+			errs[i] = err
+			cancel()
+		}
+		return nil
+	})
+
+	// Report the failure that cancelled the others rather than the
+	// cancellation it caused
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return nil, err
+		}
+	}
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	merged := &EmbeddingResponse{Object: "list", Data: []EmbeddingData{}}
+	for i, result := range results {
+		if merged.Model == "" {
+			merged.Model = result.Model
+		}
+		for _, d := range result.Data {
+			d.Index += batches[i].offset
+			merged.Data = append(merged.Data, d)
+		}
+		merged.Usage.PromptTokens += result.Usage.PromptTokens
+		merged.Usage.TotalTokens += result.Usage.TotalTokens
+	}
+
+	return merged, nil
+}
+
+// errDimensionMismatch is returned when a backend's embeddings differ in
+// length from those of the model's other backends. Returning them would mix
+// incomparable vectors in the client's store.
+var errDimensionMismatch = errors.New("embedding dimensions differ from the model's other backends")
+
+// checkDimensions compares the length of a response's embeddings with the
+// dimensions known for the model, recording them for the mapping when none
+// are known yet
+func (h *Handler) checkDimensions(route *router.RouteResult, resp *EmbeddingResponse) error {
+	observed := embeddingDimensions(resp)
+	if observed == 0 {
+		return nil
+	}
+
+	for attempt := 0; ; attempt++ {
+		mappings, err := h.db.GetModelChannelsByModel(route.Model.ID)
+		if err != nil {
+			log.Printf("Failed to check embedding dimensions of model %s: %v", route.Model.Name, err)
+			return nil
+		}
+		expected, own := 0, 0
+		for _, mc := range mappings {
+			if mc.ChannelID == route.Channel.ID {
+				own = mc.Dimensions
+			} else if expected == 0 {
+				expected = mc.Dimensions
+			}
+		}
+		if own != 0 {
+			expected = own
+		}
+
+		if expected != 0 {
+			if observed != expected {
+				return fmt.Errorf("%w: channel %s returned %d dimensions, model %s has %d", errDimensionMismatch, route.Channel.Name, observed, route.Model.Name, expected)
+			}
+			if own != 0 {
+				return nil
+			}
+		}
+
+		recorded, err := h.db.RecordModelChannelDimensions(route.Model.ID, route.Channel.ID, observed)
+		if err != nil {
+			log.Printf("Failed to record embedding dimensions of model %s: %v", route.Model.Name, err)
+			return nil
+		}
+		if recorded {
+			log.Printf("Recorded %d embedding dimensions for model %s on channel %s", observed, route.Model.Name, route.Channel.Name)
+			return nil
+		}
+		// Another request recorded dimensions first; compare with them
+		if attempt > 0 {
+			return nil
+		}
+	}
+}
+
+// embeddingDimensions returns the length of a response's first embedding,
+// or 0 if it has none or its encoding is not recognized
+func embeddingDimensions(resp *EmbeddingResponse) int {
+	if len(resp.Data) == 0 {
+		return 0
+	}
+	raw := bytes.TrimSpace(resp.Data[0].Embedding)
+	if len(raw) == 0 {
+		return 0
+	}
+
+	switch raw[0] {
+	case '[':
+		var values []json.RawMessage
+		if err := json.Unmarshal(raw, &values); err != nil {
+			return 0
+		}
+		return len(values)
+	case '"':
+		// base64 encoding packs little-endian float32 values
+		var encoded string
+		if err := json.Unmarshal(raw, &encoded); err != nil {
+			return 0
+		}
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return 0
+		}
+		return len(decoded) / 4
+	}
+	return 0
+}
+
+// splitEmbeddingInput splits an input array into batches of at most maxBatch
+// items. A single string, a single token array, or an array within the limit
+// is sent as one batch.
+func splitEmbeddingInput(input json.RawMessage, maxBatch int) ([]embeddingBatch, error) {
+	single := []embeddingBatch{{input: input}}
+
+	trimmed := bytes.TrimSpace(input)
+	if maxBatch <= 0 || len(trimmed) == 0 || trimmed[0] != '[' {
+		return single, nil
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(trimmed, &items); err != nil {
+		return nil, err
+	}
+	if len(items) <= maxBatch {
+		return single, nil
+	}
+
+	// An array of numbers is one tokenized input, not a batch
+	if first := bytes.TrimSpace(items[0]); len(first) > 0 && first[0] != '"' && first[0] != '[' {
+		return single, nil
+	}
+
+	var batches []embeddingBatch
+	for start := 0; start < len(items); start += maxBatch {
+		end := min(start+maxBatch, len(items))
+		chunk, err := json.Marshal(items[start:end])
+		if err != nil {
+			return nil, err
+		}
+		batches = append(batches, embeddingBatch{input: chunk, offset: start})
+	}
+	return batches, nil
+}
@@ -0,0 +1,218 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+func TestSplitEmbeddingInput(t *testing.T) {
+	tests := []struct {
+		input   string
+		max     int
+		batches int
+	}{
+		{`"hello"`, 2, 1},
+		{`["a", "b"]`, 2, 1},
+		{`["a", "b", "c", "d", "e"]`, 2, 3},
+		{`["a", "b", "c"]`, 0, 1},
+		{`[1, 2, 3, 4, 5]`, 2, 1},
+		{`[[1, 2], [3], [4], [5]]`, 3, 2},
+	}
+	for _, tt := range tests {
+		batches, err := splitEmbeddingInput(json.RawMessage(tt.input), tt.max)
+		if err != nil {
+			t.Fatalf("splitEmbeddingInput(%s): %v", tt.input, err)
+		}
+		if len(batches) != tt.batches {
+			t.Errorf("splitEmbeddingInput(%s, %d) = %d batches, want %d", tt.input, tt.max, len(batches), tt.batches)
+		}
+	}
+}
+
+func TestEmbeddingsSplitsLargeBatches(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler, db, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	var (
+		mu    sync.Mutex
+		calls []int
+	)
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/embeddings" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		var req struct {
+			Input      []string `json:"input"`
+			Dimensions int      `json:"dimensions"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Dimensions != 8 {
+			t.Errorf("Expected dimensions to be forwarded, got %d", req.Dimensions)
+		}
+		mu.Lock()
+		calls = append(calls, len(req.Input))
+		mu.Unlock()
+
+		resp := EmbeddingResponse{Object: "list", Model: "text-embedding-3-small"}
+		for i, in := range req.Input {
+			resp.Data = append(resp.Data, EmbeddingData{Object: "embedding", Embedding: json.RawMessage(fmt.Sprintf(`[%q]`, in)), Index: i})
+		}
+		resp.Usage = EmbeddingUsage{PromptTokens: len(req.Input), TotalTokens: len(req.Input)}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer mockBackend.Close()
+
+	db.UpdateChannel(&database.Channel{ID: 1, Name: "test-chan", BaseURL: mockBackend.URL, APIKey: "sk-test", Weight: 10, Enabled: true, MaxBatchSize: 2})
+
+	body := `{"model": "gpt-3.5-turbo", "input": ["a", "b", "c", "d", "e"], "dimensions": 8}`
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/v1/embeddings", bytes.NewBufferString(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("user_id", int64(1))
+	handler.Embeddings(c)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	// Batches run in parallel, so only their sizes are compared
+	sort.Sort(sort.Reverse(sort.IntSlice(calls)))
+	if fmt.Sprint(calls) != "[2 2 1]" {
+		t.Errorf("Expected upstream batches [2 2 1], got %v", calls)
+	}
+
+	var resp EmbeddingResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(resp.Data) != 5 {
+		t.Fatalf("Expected 5 embeddings, got %d", len(resp.Data))
+	}
+	for i, d := range resp.Data {
+		want := fmt.Sprintf(`[%q]`, string(rune('a'+i)))
+		if d.Index != i || string(d.Embedding) != want {
+			t.Errorf("Embedding %d: got index %d embedding %s, want %s", i, d.Index, d.Embedding, want)
+		}
+	}
+	if resp.Usage.PromptTokens != 5 || resp.Usage.TotalTokens != 5 {
+		t.Errorf("Expected summed usage of 5, got %+v", resp.Usage)
+	}
+}
+
+func TestEmbeddingBatchesRespectChannelConcurrency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler, db, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	var (
+		mu             sync.Mutex
+		inFlight, peak int
+	)
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Input []string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+
+		mu.Lock()
+		inFlight++
+		if inFlight > peak {
+			peak = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(50 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+
+		resp := EmbeddingResponse{Object: "list", Model: "text-embedding-3-small"}
+		for i := range req.Input {
+			resp.Data = append(resp.Data, EmbeddingData{Object: "embedding", Embedding: json.RawMessage(`[0.1]`), Index: i})
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer mockBackend.Close()
+
+	for _, tt := range []struct {
+		maxConcurrency int
+		wantPeak       int
+	}{
+		{0, 3},
+		{5, 1},
+	} {
+		peak = 0
+		db.UpdateChannel(&database.Channel{ID: 1, Name: "test-chan", BaseURL: mockBackend.URL, APIKey: "sk-test", Weight: 10, Enabled: true, MaxBatchSize: 1, MaxConcurrency: tt.maxConcurrency})
+
+		body := `{"model": "gpt-3.5-turbo", "input": ["a", "b", "c"]}`
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/v1/embeddings", bytes.NewBufferString(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Set("user_id", int64(1))
+		handler.Embeddings(c)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("max_concurrency %d: expected 200, got %d: %s", tt.maxConcurrency, w.Code, w.Body.String())
+		}
+		if peak != tt.wantPeak {
+			t.Errorf("max_concurrency %d: expected %d batches in flight, got %d", tt.maxConcurrency, tt.wantPeak, peak)
+		}
+	}
+}
+
+func TestEmbeddingDimensionsAreEnforced(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler, db, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	embedding := `[0.1, 0.2, 0.3]`
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"object": "list", "data": [{"object": "embedding", "embedding": %s, "index": 0}], "usage": {"prompt_tokens": 1, "total_tokens": 1}}`, embedding)
+	}))
+	defer mockBackend.Close()
+	db.UpdateChannel(&database.Channel{ID: 1, Name: "test-chan", BaseURL: mockBackend.URL, APIKey: "sk-test", Weight: 10, Enabled: true})
+
+	embed := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/v1/embeddings", bytes.NewBufferString(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Set("user_id", int64(1))
+		handler.Embeddings(c)
+		return w
+	}
+
+	// The first response teaches the mapping its dimensions
+	if w := embed(`{"model": "gpt-3.5-turbo", "input": "hi"}`); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	mappings, _ := db.GetModelChannelsByModel(1)
+	if len(mappings) != 1 || mappings[0].Dimensions != 3 {
+		t.Fatalf("Expected 3 dimensions to be recorded, got %+v", mappings)
+	}
+
+	// A backend that changes them is rejected, as base64 too
+	embedding = `"AAAAAAAAAAA="`
+	if w := embed(`{"model": "gpt-3.5-turbo", "input": "hi", "encoding_format": "base64"}`); w.Code != http.StatusBadGateway {
+		t.Errorf("Expected 502 for 2 dimensions, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Unless the client asked for shortened vectors
+	if w := embed(`{"model": "gpt-3.5-turbo", "input": "hi", "dimensions": 2}`); w.Code != http.StatusOK {
+		t.Errorf("Expected 200 for requested dimensions, got %d: %s", w.Code, w.Body.String())
+	}
+}
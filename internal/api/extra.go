@@ -0,0 +1,253 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// extraFields holds JSON object members the gateway does not model, so
+// fields added by providers or newer API versions survive a decode and
+// re-encode instead of being silently dropped
+type extraFields map[string]json.RawMessage
+
+// knownFields caches the JSON member names of struct types
+var knownFields sync.Map // reflect.Type -> []string
+
+// jsonFieldNames returns the JSON member names of the struct v points to
+func jsonFieldNames(v any) []string {
+	t := reflect.TypeOf(v).Elem()
+	if names, ok := knownFields.Load(t); ok {
+		return names.([]string)
+	}
+
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		switch name {
+		case "-":
+			continue
+		case "":
+			name = field.Name
+		}
+		names = append(names, name)
+	}
+	knownFields.Store(t, names)
+	return names
+}
+
+// has reports whether a member is present and not null
+func (e extraFields) has(name string) bool {
+	value, ok := e[name]
+	return ok && !bytes.Equal(bytes.TrimSpace(value), []byte("null"))
+}
+
+// unmarshalWithExtra decodes data into v, a pointer to a struct type without
+// its own UnmarshalJSON, and returns the members v does not declare
+func unmarshalWithExtra(data []byte, v any) (extraFields, error) {
+	if err := json.Unmarshal(data, v); err != nil {
+		return nil, err
+	}
+
+	var all extraFields
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+	for _, name := range jsonFieldNames(v) {
+		delete(all, name)
+	}
+	if len(all) == 0 {
+		return nil, nil
+	}
+	return all, nil
+}
+
+// marshalWithExtra encodes v, a struct without its own MarshalJSON, and adds
+// the extra members
+func marshalWithExtra(v any, extra extraFields) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || len(extra) == 0 {
+		return data, err
+	}
+
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+	for name, value := range extra {
+		if _, ok := all[name]; !ok {
+			all[name] = value
+		}
+	}
+	return json.Marshal(all)
+}
+
+// UnmarshalJSON decodes a request, keeping unknown members in Extra
+func (r *ChatCompletionRequest) UnmarshalJSON(data []byte) error {
+	type plain ChatCompletionRequest
+	extra, err := unmarshalWithExtra(data, (*plain)(r))
+	r.Extra = extra
+	return err
+}
+
+// MarshalJSON encodes a request including its unknown members, so tools,
+// sampling parameters and other fields reach the backend unchanged
+func (r ChatCompletionRequest) MarshalJSON() ([]byte, error) {
+	type plain ChatCompletionRequest
+	return marshalWithExtra(plain(r), r.Extra)
+}
+
+// UnmarshalJSON decodes a response, keeping unknown members in Extra
+func (r *ChatCompletionResponse) UnmarshalJSON(data []byte) error {
+	type plain ChatCompletionResponse
+	extra, err := unmarshalWithExtra(data, (*plain)(r))
+	r.Extra = extra
+	return err
+}
+
+// MarshalJSON encodes a response including its unknown members
+func (r ChatCompletionResponse) MarshalJSON() ([]byte, error) {
+	type plain ChatCompletionResponse
+	return marshalWithExtra(plain(r), r.Extra)
+}
+
+// UnmarshalJSON decodes a choice, keeping unknown members in Extra
+func (ch *Choice) UnmarshalJSON(data []byte) error {
+	type plain Choice
+	extra, err := unmarshalWithExtra(data, (*plain)(ch))
+	ch.Extra = extra
+	return err
+}
+
+// MarshalJSON encodes a choice including its unknown members
+func (ch Choice) MarshalJSON() ([]byte, error) {
+	type plain Choice
+	return marshalWithExtra(plain(ch), ch.Extra)
+}
+
+// UnmarshalJSON decodes a message, keeping unknown members such as
+// tool_calls or refusal in Extra. Content given as an array of parts is kept
+// in Parts. A null or missing content is remembered so it is encoded as null
+// again.
+func (m *ChatCompletionMessage) UnmarshalJSON(data []byte) error {
+	type plain ChatCompletionMessage
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return err
+	}
+	content := bytes.TrimSpace(members["content"])
+
+	var parts []contentPart
+	if len(content) > 0 && content[0] == '[' {
+		if err := json.Unmarshal(content, &parts); err != nil {
+			return err
+		}
+		// Decode the other members without the array
+		delete(members, "content")
+		var err error
+		if data, err = json.Marshal(members); err != nil {
+			return err
+		}
+	}
+
+	extra, err := unmarshalWithExtra(data, (*plain)(m))
+	if err != nil {
+		return err
+	}
+	m.Extra = extra
+	m.Parts = nil
+	if parts != nil {
+		m.Parts = content
+		m.Content = partsText(parts)
+	}
+	m.nullContent = content == nil || string(content) == "null"
+	return nil
+}
+
+// MarshalJSON encodes a message including its unknown members
+func (m ChatCompletionMessage) MarshalJSON() ([]byte, error) {
+	type plain ChatCompletionMessage
+	switch {
+	case len(m.Parts) > 0:
+		return marshalWithExtra(struct {
+			plain
+			Content json.RawMessage `json:"content"`
+		}{plain: plain(m), Content: m.Parts}, m.Extra)
+	case m.nullContent && m.Content == "":
+		// Assistant messages carrying tool calls have null content, which
+		// some backends require to stay null
+		return marshalWithExtra(struct {
+			plain
+			Content *string `json:"content"`
+		}{plain: plain(m)}, m.Extra)
+	}
+	return marshalWithExtra(plain(m), m.Extra)
+}
+
+// contentPart holds the fields of a message content part the gateway reads
+type contentPart struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// partsText joins the text of the text parts of a message
+func partsText(parts []contentPart) string {
+	var texts []string
+	for _, part := range parts {
+		if part.Type == "text" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// hasImages reports whether a message's content includes an image part
+func (m ChatCompletionMessage) hasImages() bool {
+	if len(m.Parts) == 0 {
+		return false
+	}
+	var parts []contentPart
+	if err := json.Unmarshal(m.Parts, &parts); err != nil {
+		return false
+	}
+	for _, part := range parts {
+		if part.Type == "image_url" {
+			return true
+		}
+	}
+	return false
+}
+
+// UnmarshalJSON decodes a stream chunk, keeping unknown members in Extra
+func (c *ChatCompletionChunk) UnmarshalJSON(data []byte) error {
+	type plain ChatCompletionChunk
+	extra, err := unmarshalWithExtra(data, (*plain)(c))
+	c.Extra = extra
+	return err
+}
+
+// MarshalJSON encodes a stream chunk including its unknown members
+func (c ChatCompletionChunk) MarshalJSON() ([]byte, error) {
+	type plain ChatCompletionChunk
+	return marshalWithExtra(plain(c), c.Extra)
+}
+
+// UnmarshalJSON decodes a chunk choice, keeping unknown members in Extra
+func (ch *ChunkChoice) UnmarshalJSON(data []byte) error {
+	type plain ChunkChoice
+	extra, err := unmarshalWithExtra(data, (*plain)(ch))
+	ch.Extra = extra
+	return err
+}
+
+// MarshalJSON encodes a chunk choice including its unknown members
+func (ch ChunkChoice) MarshalJSON() ([]byte, error) {
+	type plain ChunkChoice
+	return marshalWithExtra(plain(ch), ch.Extra)
+}
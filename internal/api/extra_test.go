@@ -0,0 +1,160 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestResponseRoundTripPreservesUnknownFields(t *testing.T) {
+	upstream := `{"id":"chatcmpl-1","object":"chat.completion","created":1,"model":"gpt-4o","system_fingerprint":"fp_1","service_tier":"default","choices":[{"index":0,"message":{"role":"assistant","content":"","refusal":"no","tool_calls":[{"id":"call_1"}]},"logprobs":{"content":[]},"finish_reason":"tool_calls"}],"usage":{"prompt_tokens":1,"completion_tokens":2,"total_tokens":3}}`
+
+	var resp ChatCompletionResponse
+	if err := json.Unmarshal([]byte(upstream), &resp); err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if resp.SystemFingerprint != "fp_1" || string(resp.Choices[0].Logprobs) != `{"content":[]}` {
+		t.Errorf("Expected modelled fields to decode, got %+v", resp)
+	}
+
+	out, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+
+	var want, got map[string]any
+	json.Unmarshal([]byte(upstream), &want)
+	json.Unmarshal(out, &got)
+	wantJSON, _ := json.Marshal(want)
+	gotJSON, _ := json.Marshal(got)
+	if string(wantJSON) != string(gotJSON) {
+		t.Errorf("Round trip changed the response:\nwant %s\ngot  %s", wantJSON, gotJSON)
+	}
+}
+
+func TestAggregateStreamKeepsFingerprintAndLogprobs(t *testing.T) {
+	stream := strings.Join([]string{
+		`data: {"id":"c1","object":"chat.completion.chunk","model":"gpt-4o","system_fingerprint":"fp_1","choices":[{"index":0,"delta":{"role":"assistant","content":"Hi"},"logprobs":{"content":[{"token":"Hi"}]},"finish_reason":null}]}`,
+		`data: {"id":"c1","object":"chat.completion.chunk","model":"gpt-4o","system_fingerprint":"fp_1","choices":[{"index":0,"delta":{"content":"!"},"logprobs":{"content":[{"token":"!"}]},"finish_reason":"stop"}]}`,
+		`data: [DONE]`,
+	}, "\n\n")
+
+	resp, err := aggregateStream(strings.NewReader(stream))
+	if err != nil {
+		t.Fatalf("aggregateStream: %v", err)
+	}
+	if resp.SystemFingerprint != "fp_1" {
+		t.Errorf("Expected system_fingerprint fp_1, got %q", resp.SystemFingerprint)
+	}
+	if got := string(resp.Choices[0].Logprobs); got != `{"content":[{"token":"Hi"},{"token":"!"}]}` {
+		t.Errorf("Expected merged logprobs, got %s", got)
+	}
+	if resp.Choices[0].Message.Content != "Hi!" || resp.Choices[0].FinishReason != "stop" {
+		t.Errorf("Unexpected choice: %+v", resp.Choices[0])
+	}
+}
+
+func TestAggregateStreamAssemblesToolCalls(t *testing.T) {
+	stream := strings.Join([]string{
+		`data: {"id":"c1","object":"chat.completion.chunk","model":"gpt-4o","choices":[{"index":0,"delta":{"role":"assistant","content":null,"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"weather","arguments":""}}]},"finish_reason":null}]}`,
+		`data: {"id":"c1","object":"chat.completion.chunk","model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":"}}]},"finish_reason":null}]}`,
+		`data: {"id":"c1","object":"chat.completion.chunk","model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":1,"id":"call_2","type":"function","function":{"name":"time","arguments":"{}"}}]},"finish_reason":null}]}`,
+		`data: {"id":"c1","object":"chat.completion.chunk","model":"gpt-4o","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Paris\"}"}}]},"finish_reason":"tool_calls"}]}`,
+		`data: [DONE]`,
+	}, "\n\n")
+
+	resp, err := aggregateStream(strings.NewReader(stream))
+	if err != nil {
+		t.Fatalf("aggregateStream: %v", err)
+	}
+	msg, err := json.Marshal(resp.Choices[0].Message)
+	if err != nil {
+		t.Fatalf("Failed to encode message: %v", err)
+	}
+
+	want := `{"content":null,"role":"assistant","tool_calls":[{"id":"call_1","type":"function","function":{"name":"weather","arguments":"{\"city\":\"Paris\"}"}},{"id":"call_2","type":"function","function":{"name":"time","arguments":"{}"}}]}`
+	if string(msg) != want {
+		t.Errorf("Unexpected message:\nwant %s\ngot  %s", want, msg)
+	}
+	if resp.Choices[0].FinishReason != "tool_calls" {
+		t.Errorf("Expected finish reason tool_calls, got %q", resp.Choices[0].FinishReason)
+	}
+
+	refusal := `data: {"id":"c2","choices":[{"index":0,"delta":{"role":"assistant","refusal":"I can't"}}]}` + "\n\n" +
+		`data: {"id":"c2","choices":[{"index":0,"delta":{"refusal":" help."},"finish_reason":"stop"}]}`
+	resp, err = aggregateStream(strings.NewReader(refusal))
+	if err != nil {
+		t.Fatalf("aggregateStream: %v", err)
+	}
+	if got := string(resp.Choices[0].Message.Extra["refusal"]); got != `"I can't help."` {
+		t.Errorf("Expected the refusal concatenated, got %s", got)
+	}
+}
+
+func TestAggregateStreamRejectsUnfinishedStreams(t *testing.T) {
+	truncated := `data: {"id":"c1","choices":[{"index":0,"delta":{"role":"assistant","content":"Hal"}}]}` + "\n\n"
+	_, err := aggregateStream(strings.NewReader(truncated))
+	var broken *brokenStreamError
+	if !errors.As(err, &broken) || !errors.Is(err, errStreamIncomplete) {
+		t.Errorf("Expected an incomplete stream error, got %v", err)
+	}
+
+	failed := truncated + `data: {"error":{"message":"overloaded","type":"server_error"}}` + "\n\n"
+	_, err = aggregateStream(strings.NewReader(failed))
+	var upstreamErr *UpstreamError
+	if !errors.As(err, &upstreamErr) || !strings.Contains(string(upstreamErr.Body), "overloaded") {
+		t.Errorf("Expected the error event as an upstream error, got %v", err)
+	}
+}
+
+func TestRequestRoundTripPreservesUnknownFields(t *testing.T) {
+	client := `{"model":"gpt-4o","messages":[{"role":"user","content":"Weather?"},{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"weather","arguments":"{}"}}]},{"role":"tool","tool_call_id":"call_1","content":"Sunny"}],"tools":[{"type":"function","function":{"name":"weather","parameters":{"type":"object"}}}],"tool_choice":"auto","response_format":{"type":"json_object"},"temperature":0.2,"top_p":0.9,"max_tokens":100,"seed":7}`
+
+	var req ChatCompletionRequest
+	if err := json.Unmarshal([]byte(client), &req); err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	out, err := json.Marshal(req)
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+
+	var want, got map[string]any
+	json.Unmarshal([]byte(client), &want)
+	json.Unmarshal(out, &got)
+	wantJSON, _ := json.Marshal(want)
+	gotJSON, _ := json.Marshal(got)
+	if string(wantJSON) != string(gotJSON) {
+		t.Errorf("Round trip changed the request:\nwant %s\ngot  %s", wantJSON, gotJSON)
+	}
+}
+
+func TestMessageContentParts(t *testing.T) {
+	client := `{"role":"user","content":[{"type":"text","text":"What is this?"},{"type":"image_url","image_url":{"url":"data:image/png;base64,AAAA","detail":"high"}},{"type":"text","text":"Be brief."}],"name":"alice"}`
+
+	var msg ChatCompletionMessage
+	if err := json.Unmarshal([]byte(client), &msg); err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if msg.Content != "What is this?\nBe brief." || !msg.hasImages() {
+		t.Errorf("Unexpected decoded message %+v", msg)
+	}
+
+	out, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	var want, got map[string]any
+	json.Unmarshal([]byte(client), &want)
+	json.Unmarshal(out, &got)
+	wantJSON, _ := json.Marshal(want)
+	gotJSON, _ := json.Marshal(got)
+	if string(wantJSON) != string(gotJSON) {
+		t.Errorf("Round trip changed the message:\nwant %s\ngot  %s", wantJSON, gotJSON)
+	}
+
+	if err := json.Unmarshal([]byte(`{"role":"user","content":[1]}`), &msg); err == nil {
+		t.Error("Expected malformed content parts to be rejected")
+	}
+}
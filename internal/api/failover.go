@@ -0,0 +1,292 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxStreamEvent bounds a single SSE event read from a backend stream
+const maxStreamEvent = 4 << 20
+
+// errStreamIncomplete is returned when a backend stream ends without [DONE]
+// or a finish reason
+var errStreamIncomplete = errors.New("backend stream ended before completion")
+
+// errStreamTooLong is returned when a stream reaches its model's duration
+// cap before sending any content
+var errStreamTooLong = errors.New("backend stream exceeded the model's maximum duration before sending content")
+
+// errClientGone is returned when a stream ends because its client
+// disconnected. It is not held against the channel.
+var errClientGone = errors.New("client disconnected during the stream")
+
+// ErrShuttingDown is the cause the server cancels requests with when they
+// are still running after the drain timeout of a graceful shutdown. Streams
+// cut off by it end with an error event and are not held against the
+// channel.
+var ErrShuttingDown = errors.New("gateway is shutting down")
+
+// stoppedStream returns why a stream whose request was cancelled ended:
+// ErrShuttingDown when the server cut it off, errClientGone otherwise
+func stoppedStream(c *gin.Context) error {
+	if errors.Is(context.Cause(c.Request.Context()), ErrShuttingDown) {
+		return ErrShuttingDown
+	}
+	return errClientGone
+}
+
+// brokenStreamError reports a backend stream that failed after the backend
+// accepted the request: the connection dropped, the stream ended early or an
+// event was malformed
+type brokenStreamError struct {
+	err error
+}
+
+func (e *brokenStreamError) Error() string {
+	return "backend stream broken: " + e.err.Error()
+}
+
+func (e *brokenStreamError) Unwrap() error {
+	return e.err
+}
+
+// streamEvent holds the fields of a chunk the guard checks
+type streamEvent struct {
+	ID      string `json:"id"`
+	Model   string `json:"model"`
+	Created int64  `json:"created"`
+	Choices []struct {
+		Delta struct {
+			Content   *string         `json:"content"`
+			ToolCalls json.RawMessage `json:"tool_calls"`
+			Refusal   *string         `json:"refusal"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// streamGuard reads a backend event stream one whole event at a time,
+// checking that each event's data is JSON. Events are held back until the
+// first one carrying content, so a stream that breaks before any content
+// leaves the client untouched and can be retried on another channel.
+// Events are forwarded unchanged.
+type streamGuard struct {
+	reader *bufio.Reader
+	out    bytes.Buffer
+	err    error
+
+	// content is set once an event carried content, releasing held events
+	content bool
+	// complete is set by [DONE] or a finish reason
+	complete bool
+	// expired is set once the stream reached its duration cap
+	expired atomic.Bool
+
+	// id, model and created are taken from the chunks, for the final chunk
+	// of a stream cut off at its duration cap
+	id      string
+	model   string
+	created int64
+}
+
+// newStreamGuard returns a guard reading a backend event stream
+func newStreamGuard(body io.Reader) *streamGuard {
+	return &streamGuard{reader: bufio.NewReader(body)}
+}
+
+// Read returns checked events, reading from the backend as needed. Errors
+// other than io.EOF are brokenStreamErrors.
+func (g *streamGuard) Read(p []byte) (int, error) {
+	for (g.out.Len() == 0 || !g.content) && g.err == nil {
+		if err := g.next(); err != nil {
+			switch {
+			case err == io.EOF:
+				g.err = err
+			case g.expired.Load():
+				g.err = g.cutOff()
+			default:
+				g.err = &brokenStreamError{err: err}
+			}
+		}
+	}
+	if g.out.Len() > 0 && (g.content || g.err == io.EOF) {
+		return g.out.Read(p)
+	}
+	return 0, g.err
+}
+
+// next reads and checks one event. It returns io.EOF at the end of a
+// complete stream.
+func (g *streamGuard) next() error {
+	raw, data, err := g.readEvent()
+	if err == io.EOF {
+		if !g.complete {
+			return errStreamIncomplete
+		}
+		return io.EOF
+	}
+	if err != nil {
+		return err
+	}
+
+	if data != nil {
+		if err := g.check(data); err != nil {
+			return err
+		}
+	}
+	g.out.Write(raw)
+	return nil
+}
+
+// check inspects the data of an event
+func (g *streamGuard) check(data []byte) error {
+	if string(data) == "[DONE]" {
+		g.complete = true
+		return nil
+	}
+
+	var event streamEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return fmt.Errorf("malformed stream event %.100q", data)
+	}
+	if event.Error != nil {
+		return fmt.Errorf("backend stream error: %s", event.Error.Message)
+	}
+	if event.ID != "" {
+		g.id, g.model, g.created = event.ID, event.Model, event.Created
+	}
+	for _, choice := range event.Choices {
+		delta := choice.Delta
+		if delta.Content != nil && *delta.Content != "" ||
+			len(delta.ToolCalls) > 0 && string(delta.ToolCalls) != "null" ||
+			delta.Refusal != nil && *delta.Refusal != "" {
+			g.content = true
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			g.complete = true
+		}
+	}
+	return nil
+}
+
+// limit caps the stream's duration: once d has passed, body, the backend
+// stream being read, is closed and the stream ends as if the backend had
+// stopped at a length limit. The returned function stops the timer.
+func (g *streamGuard) limit(d time.Duration, body io.Closer) func() bool {
+	timer := time.AfterFunc(d, func() {
+		g.expired.Store(true)
+		body.Close()
+	})
+	return timer.Stop
+}
+
+// cutOff ends a stream stopped at its duration cap. Once content was sent
+// the stream is finished with a length finish reason and [DONE]. Otherwise
+// the held events are dropped and errStreamTooLong is returned, which is not
+// retried since another channel could loop as well.
+func (g *streamGuard) cutOff() error {
+	if !g.content {
+		g.out.Reset()
+		return errStreamTooLong
+	}
+	if !g.complete {
+		chunk, _ := json.Marshal(gin.H{
+			"id":      g.id,
+			"object":  "chat.completion.chunk",
+			"created": g.created,
+			"model":   g.model,
+			"choices": []gin.H{{"index": 0, "delta": gin.H{}, "finish_reason": "length"}},
+		})
+		fmt.Fprintf(&g.out, "data: %s\n\n", chunk)
+	}
+	g.out.WriteString("data: [DONE]\n\n")
+	return io.EOF
+}
+
+// readEvent reads the next SSE event, returning its raw bytes and its data.
+// Events without data, such as comments, have nil data. An event the
+// backend left unterminated at the end of the stream is returned whole.
+func (g *streamGuard) readEvent() ([]byte, []byte, error) {
+	var raw, data []byte
+	for {
+		line, err := g.reader.ReadBytes('\n')
+		if err != nil && (err != io.EOF || len(line) == 0) {
+			if err == io.EOF && len(raw) > 0 {
+				return raw, data, nil
+			}
+			return nil, nil, err
+		}
+		raw = append(raw, line...)
+		if len(raw) > maxStreamEvent {
+			return nil, nil, fmt.Errorf("stream event exceeds %d bytes", maxStreamEvent)
+		}
+
+		line = bytes.TrimRight(line, "\r\n")
+		if len(line) == 0 {
+			return raw, data, nil
+		}
+		if value, ok := bytes.CutPrefix(line, []byte("data:")); ok {
+			if data != nil {
+				data = append(data, '\n')
+			}
+			data = append(data, bytes.TrimPrefix(value, []byte(" "))...)
+		}
+		if err == io.EOF {
+			return raw, data, nil
+		}
+	}
+}
+
+// retryableStream reports whether a stream broke or was refused with a 5xx
+// status before any of it reached the client, so it can be retried on
+// another channel
+func retryableStream(c *gin.Context, err error) bool {
+	if c.Writer.Written() || c.Request.Context().Err() != nil {
+		return false
+	}
+	var broken *brokenStreamError
+	var upstreamErr *UpstreamError
+	return errors.As(err, &broken) || errors.As(err, &upstreamErr) && upstreamErr.StatusCode >= http.StatusInternalServerError
+}
+
+// clearStreamHeaders removes the SSE headers of a stream that failed before
+// writing anything, so the error response gets its own content type
+func clearStreamHeaders(c *gin.Context) {
+	for _, name := range []string{"Content-Type", "Cache-Control", "Connection"} {
+		c.Writer.Header().Del(name)
+	}
+}
+
+// writeStreamFailure responds to the client after a failed stream: with a
+// final error event when part of the stream was already sent, or with an
+// error response otherwise
+func writeStreamFailure(c *gin.Context, err error) {
+	if c.Writer.Written() {
+		writeStreamError(c, err)
+		return
+	}
+	clearStreamHeaders(c)
+	writeForwardError(c, err)
+}
+
+// writeStreamError ends a stream that failed midway with an error event and
+// [DONE], so the client can tell the partial response from a complete one
+func writeStreamError(c *gin.Context, err error) {
+	body, _ := json.Marshal(gin.H{"error": gin.H{"message": err.Error(), "type": "server_error", "param": nil, "code": "stream_interrupted"}})
+	fmt.Fprintf(c.Writer, "data: %s\n\n", body)
+	fmt.Fprint(c.Writer, "data: [DONE]\n\n")
+	c.Writer.Flush()
+}
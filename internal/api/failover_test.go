@@ -0,0 +1,255 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	roleChunk    = `data: {"choices":[{"index":0,"delta":{"role":"assistant","content":""}}]}` + "\n\n"
+	contentChunk = `data: {"choices":[{"index":0,"delta":{"content":"Hello"}}]}` + "\n\n"
+	finishChunk  = `data: {"choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}` + "\n\n"
+	doneEvent    = "data: [DONE]\n\n"
+)
+
+func TestStreamGuard(t *testing.T) {
+	tests := []struct {
+		name    string
+		stream  string
+		wantOut string
+		broken  bool
+		// wantErr is the cause of the broken stream, or nil for any cause
+		wantErr error
+	}{
+		{"complete", roleChunk + ": keep-alive\n\n" + contentChunk + finishChunk + doneEvent, roleChunk + ": keep-alive\n\n" + contentChunk + finishChunk + doneEvent, false, nil},
+		{"finish reason without [DONE]", roleChunk + contentChunk + finishChunk, roleChunk + contentChunk + finishChunk, false, nil},
+		{"empty completion", roleChunk + finishChunk + doneEvent, roleChunk + finishChunk + doneEvent, false, nil},
+		{"ended before content", roleChunk, "", true, errStreamIncomplete},
+		{"ended after content", roleChunk + contentChunk, roleChunk + contentChunk, true, errStreamIncomplete},
+		{"malformed before content", roleChunk + "data: {\"choices\n\n" + contentChunk, "", true, nil},
+		{"error event", roleChunk + `data: {"error":{"message":"overloaded"}}` + "\n\n", "", true, nil},
+	}
+	for _, tt := range tests {
+		out, err := io.ReadAll(newStreamGuard(strings.NewReader(tt.stream)))
+		if string(out) != tt.wantOut {
+			t.Errorf("%s: expected output %q, got %q", tt.name, tt.wantOut, out)
+		}
+		var broken *brokenStreamError
+		switch {
+		case !tt.broken && err != nil:
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		case tt.broken && !errors.As(err, &broken):
+			t.Errorf("%s: expected a broken stream error, got %v", tt.name, err)
+		case tt.wantErr != nil && !errors.Is(err, tt.wantErr):
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.wantErr, err)
+		}
+	}
+}
+
+// streamBackend returns a backend streaming the given events
+func streamBackend(events ...string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range events {
+			w.Write([]byte(event))
+			w.(http.Flusher).Flush()
+		}
+	}))
+}
+
+func TestStreamRetriedBeforeContent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler, db, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	broken := streamBackend(roleChunk)
+	defer broken.Close()
+	healthy := streamBackend(roleChunk, contentChunk, finishChunk, doneEvent)
+	defer healthy.Close()
+
+	db.UpdateChannel(&database.Channel{ID: 1, Name: "test-chan", BaseURL: broken.URL, APIKey: "sk-test", Weight: 10, Enabled: true})
+	backup := &database.Channel{Name: "backup", BaseURL: healthy.URL, APIKey: "sk-test", Weight: 10, Enabled: true}
+	db.CreateChannel(backup)
+	db.AddModelChannel(&database.ModelChannel{ModelID: 1, ChannelID: backup.ID, BackendModelName: "gpt-3.5-turbo", Weight: 10})
+	// Pin the user to the broken channel
+	db.CreateSession(&database.Session{UserID: 1, ChannelID: 1})
+
+	w := postChat(handler, `{"model":"gpt-3.5-turbo","messages":[{"role":"user","content":"hi"}],"stream":true}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if want := roleChunk + contentChunk + finishChunk + doneEvent; w.Body.String() != want {
+		t.Errorf("Expected only the retried stream, got %q", w.Body.String())
+	}
+}
+
+func TestStreamRetryReleasesFailedChannel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler, db, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	broken := streamBackend(roleChunk)
+	defer broken.Close()
+	// The backup checks that the broken channel's only slot is free again
+	freed := make(chan bool, 1)
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 100*time.Millisecond)
+		defer cancel()
+		release, err := handler.limiter.Acquire(ctx, 1, 2, 1)
+		if err == nil {
+			release()
+		}
+		freed <- err == nil
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(roleChunk + contentChunk + finishChunk + doneEvent))
+	}))
+	defer healthy.Close()
+
+	db.UpdateChannel(&database.Channel{ID: 1, Name: "test-chan", BaseURL: broken.URL, APIKey: "sk-test", Weight: 10, Enabled: true, MaxConcurrency: 1})
+	backup := &database.Channel{Name: "backup", BaseURL: healthy.URL, APIKey: "sk-test", Weight: 10, Enabled: true}
+	db.CreateChannel(backup)
+	db.AddModelChannel(&database.ModelChannel{ModelID: 1, ChannelID: backup.ID, BackendModelName: "gpt-3.5-turbo", Weight: 10})
+	db.CreateSession(&database.Session{UserID: 1, ChannelID: 1})
+
+	w := postChat(handler, `{"model":"gpt-3.5-turbo","messages":[{"role":"user","content":"hi"}],"stream":true}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if !<-freed {
+		t.Error("Expected the failed channel's slot to be released before the retry")
+	}
+	if _, ok := w.Header()[RoutingRuleHeader]; ok {
+		t.Errorf("Expected no routing rule header without a rule, got %q", w.Header().Get(RoutingRuleHeader))
+	}
+}
+
+func TestStreamBrokenWithoutRetry(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler, db, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	// With no other channel, a stream broken before content is an error
+	// response
+	broken := streamBackend(roleChunk)
+	defer broken.Close()
+	db.UpdateChannel(&database.Channel{ID: 1, Name: "test-chan", BaseURL: broken.URL, APIKey: "sk-test", Weight: 10, Enabled: true})
+
+	w := postChat(handler, `{"model":"gpt-3.5-turbo","messages":[{"role":"user","content":"hi"}],"stream":true}`)
+	if w.Code != http.StatusBadGateway || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		t.Errorf("Expected a 502 JSON error, got %d %s: %s", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+	}
+
+	// Once content was sent, the stream ends with an error event
+	interrupted := streamBackend(roleChunk, contentChunk)
+	defer interrupted.Close()
+	db.UpdateChannel(&database.Channel{ID: 1, Name: "test-chan", BaseURL: interrupted.URL, APIKey: "sk-test", Weight: 10, Enabled: true})
+
+	w = postChat(handler, `{"model":"gpt-3.5-turbo","messages":[{"role":"user","content":"hi"}],"stream":true}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	body := w.Body.String()
+	if !strings.HasPrefix(body, roleChunk+contentChunk) || !strings.Contains(body, `"code":"stream_interrupted"`) || !strings.HasSuffix(body, doneEvent) {
+		t.Errorf("Expected the content followed by an error event and [DONE], got %q", body)
+	}
+}
+
+func TestCompletionsStreamError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler, db, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	// The backend promises more than it sends, so reading fails mid-stream
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Content-Length", "10000")
+		w.Write([]byte(`data: {"choices":[{"index":0,"text":"Hel"}]}` + "\n\n"))
+	}))
+	defer mockBackend.Close()
+	db.UpdateChannel(&database.Channel{ID: 1, Name: "test-chan", BaseURL: mockBackend.URL, APIKey: "sk-test", Weight: 10, Enabled: true})
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/v1/completions", strings.NewReader(`{"model":"gpt-3.5-turbo","prompt":"hi","stream":true}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("user_id", int64(1))
+	handler.Completions(c)
+
+	body := w.Body.String()
+	if !strings.Contains(body, `"text":"Hel"`) || !strings.Contains(body, `data: {"error":`) || !strings.HasSuffix(body, doneEvent) {
+		t.Errorf("Expected the partial stream followed by an error event and [DONE], got %q", body)
+	}
+}
+
+func TestStreamGuardLimit(t *testing.T) {
+	idChunk := `data: {"id":"chatcmpl-1","created":1700000000,"model":"gpt-4o","choices":[{"index":0,"delta":{"content":"Hello"}}]}` + "\n\n"
+
+	// A stream still running at its cap ends with a length finish reason
+	pr, pw := io.Pipe()
+	go pw.Write([]byte(roleChunk + idChunk))
+	guard := newStreamGuard(pr)
+	defer guard.limit(50*time.Millisecond, pr)()
+	out, err := io.ReadAll(guard)
+	if err != nil {
+		t.Fatalf("Expected the stream to end cleanly, got %v", err)
+	}
+	finish := `data: {"choices":[{"delta":{},"finish_reason":"length","index":0}],"created":1700000000,"id":"chatcmpl-1","model":"gpt-4o","object":"chat.completion.chunk"}` + "\n\n"
+	if want := roleChunk + idChunk + finish + doneEvent; string(out) != want {
+		t.Errorf("Expected %q, got %q", want, out)
+	}
+
+	// Before any content, the held events are dropped
+	pr, pw = io.Pipe()
+	go pw.Write([]byte(roleChunk))
+	guard = newStreamGuard(pr)
+	defer guard.limit(50*time.Millisecond, pr)()
+	out, err = io.ReadAll(guard)
+	if len(out) != 0 || !errors.Is(err, errStreamTooLong) {
+		t.Errorf("Expected errStreamTooLong and no output, got %v %q", err, out)
+	}
+	var broken *brokenStreamError
+	if errors.As(err, &broken) {
+		t.Error("Expected a stream cut off at its cap not to be retried")
+	}
+}
+
+func TestStreamMaxDuration(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler, db, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	// The backend sends content and then never finishes
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(roleChunk + contentChunk))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer mockBackend.Close()
+	db.UpdateChannel(&database.Channel{ID: 1, Name: "test-chan", BaseURL: mockBackend.URL, APIKey: "sk-test", Weight: 10, Enabled: true})
+	db.UpdateModel(&database.Model{ID: 1, Name: "gpt-3.5-turbo", MaxStreamSeconds: 1})
+
+	w := postChat(handler, `{"model":"gpt-3.5-turbo","messages":[{"role":"user","content":"hi"}],"stream":true}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	body := w.Body.String()
+	if !strings.HasPrefix(body, roleChunk+contentChunk) || !strings.Contains(body, `"finish_reason":"length"`) || !strings.HasSuffix(body, doneEvent) {
+		t.Errorf("Expected the stream to end with a length finish reason, got %q", body)
+	}
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// heartbeatComment is the SSE comment sent on an idle stream. Clients
+// ignore comments, but proxies see traffic and keep the connection open.
+const heartbeatComment = ": ping\n\n"
+
+// heartbeatWriter sends heartbeatComment to the client whenever a stream has
+// been silent for an interval. Writes are serialized with the stream's own.
+type heartbeatWriter struct {
+	http.ResponseWriter
+	flusher  http.Flusher
+	interval time.Duration
+
+	mu      sync.Mutex
+	last    time.Time
+	started bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// startHeartbeat starts heartbeats on w, returning a writer the stream must
+// write through. Heartbeats stop when stop is called, which waits for a
+// heartbeat being written. With a zero interval or a writer that cannot
+// flush, w is returned unchanged and stop does nothing.
+//
+// With deferred set, heartbeats start only after the stream's first write:
+// a stream that fails before writing anything can then still be retried on
+// another channel, which a ping sent to the client would rule out.
+func startHeartbeat(w http.ResponseWriter, interval time.Duration, deferred bool) (http.ResponseWriter, func()) {
+	flusher, ok := w.(http.Flusher)
+	if interval <= 0 || !ok {
+		return w, func() {}
+	}
+
+	hw := &heartbeatWriter{
+		ResponseWriter: w,
+		flusher:        flusher,
+		interval:       interval,
+		last:           time.Now(),
+		started:        !deferred,
+		stop:           make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+	go hw.run()
+	return hw, func() {
+		close(hw.stop)
+		<-hw.done
+	}
+}
+
+// run writes a heartbeat each time the stream has been silent for the
+// interval
+func (hw *heartbeatWriter) run() {
+	defer close(hw.done)
+
+	ticker := time.NewTicker(hw.interval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-hw.stop:
+			return
+		case now := <-ticker.C:
+			hw.mu.Lock()
+			if hw.started && now.Sub(hw.last) >= hw.interval {
+				if _, err := hw.ResponseWriter.Write([]byte(heartbeatComment)); err == nil {
+					hw.flusher.Flush()
+				}
+				hw.last = now
+			}
+			hw.mu.Unlock()
+		}
+	}
+}
+
+// Write writes stream data, postponing the next heartbeat
+func (hw *heartbeatWriter) Write(p []byte) (int, error) {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+	hw.last = time.Now()
+	hw.started = true
+	return hw.ResponseWriter.Write(p)
+}
+
+// Flush flushes stream data to the client
+func (hw *heartbeatWriter) Flush() {
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+	hw.flusher.Flush()
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+func TestStreamHeartbeat(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler, db, cleanup := setupTestHandler(t)
+	defer cleanup()
+	handler.SetStreamHeartbeat(50 * time.Millisecond)
+
+	// The backend pauses for a while after its first content
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(roleChunk + contentChunk))
+		w.(http.Flusher).Flush()
+		time.Sleep(300 * time.Millisecond)
+		w.Write([]byte(finishChunk + doneEvent))
+	}))
+	defer mockBackend.Close()
+	db.UpdateChannel(&database.Channel{ID: 1, Name: "test-chan", BaseURL: mockBackend.URL, APIKey: "sk-test", Weight: 10, Enabled: true})
+
+	w := postChat(handler, `{"model":"gpt-3.5-turbo","messages":[{"role":"user","content":"hi"}],"stream":true}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	body := w.Body.String()
+	if !strings.HasPrefix(body, roleChunk+contentChunk+heartbeatComment) {
+		t.Errorf("Expected pings while the backend was silent, got %q", body)
+	}
+	if !strings.HasSuffix(body, finishChunk+doneEvent) {
+		t.Errorf("Expected the stream to follow the pings intact, got %q", body)
+	}
+}
+
+func TestStreamHeartbeatKeepsRetry(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler, db, cleanup := setupTestHandler(t)
+	defer cleanup()
+	handler.SetStreamHeartbeat(50 * time.Millisecond)
+
+	// The first backend stays silent for several intervals, then breaks
+	silent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(roleChunk))
+		w.(http.Flusher).Flush()
+		time.Sleep(300 * time.Millisecond)
+	}))
+	defer silent.Close()
+	// The backup thinks for a while before its first content
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.(http.Flusher).Flush()
+		time.Sleep(300 * time.Millisecond)
+		w.Write([]byte(roleChunk + contentChunk + finishChunk + doneEvent))
+	}))
+	defer slow.Close()
+
+	db.UpdateChannel(&database.Channel{ID: 1, Name: "test-chan", BaseURL: silent.URL, APIKey: "sk-test", Weight: 10, Enabled: true})
+	backup := &database.Channel{Name: "backup", BaseURL: slow.URL, APIKey: "sk-test", Weight: 10, Enabled: true}
+	db.CreateChannel(backup)
+	db.AddModelChannel(&database.ModelChannel{ModelID: 1, ChannelID: backup.ID, BackendModelName: "gpt-3.5-turbo", Weight: 10})
+	// Pin the user to the silent channel
+	db.CreateSession(&database.Session{UserID: 1, ChannelID: 1})
+
+	w := postChat(handler, `{"model":"gpt-3.5-turbo","messages":[{"role":"user","content":"hi"}],"stream":true}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// No ping went out before the failure, so the stream was retried; the
+	// retry cannot be retried again and pings while the backup is silent
+	body := w.Body.String()
+	if !strings.HasPrefix(body, heartbeatComment) || !strings.HasSuffix(body, roleChunk+contentChunk+finishChunk+doneEvent) {
+		t.Errorf("Expected pings followed by the retried stream, got %q", body)
+	}
+	if strings.Count(body, roleChunk) != 1 {
+		t.Errorf("Expected only the retried stream's content, got %q", body)
+	}
+}
+
+func TestStreamCancelledOnClientDisconnect(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler, db, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	backendCancelled := make(chan struct{})
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(roleChunk + contentChunk))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+		close(backendCancelled)
+	}))
+	defer mockBackend.Close()
+	db.UpdateChannel(&database.Channel{ID: 1, Name: "test-chan", BaseURL: mockBackend.URL, APIKey: "sk-test", Weight: 10, Enabled: true})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"gpt-3.5-turbo","messages":[{"role":"user","content":"hi"}],"stream":true}`)).WithContext(ctx)
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("user_id", int64(1))
+
+	time.AfterFunc(200*time.Millisecond, cancel)
+	done := make(chan struct{})
+	go func() {
+		handler.ChatCompletions(c)
+		close(done)
+	}()
+
+	select {
+	case <-backendCancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the backend request to be cancelled when the client disconnected")
+	}
+	<-done
+
+	// The disconnect is not held against the channel
+	m, _ := db.GetChannelMetrics(1)
+	if m != nil && m.ErrorRate > 0 {
+		t.Errorf("Expected no channel error for a client disconnect, got error rate %v", m.ErrorRate)
+	}
+}
+
+func TestStreamCutOffByShutdown(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler, db, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(roleChunk + contentChunk))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer mockBackend.Close()
+	db.UpdateChannel(&database.Channel{ID: 1, Name: "test-chan", BaseURL: mockBackend.URL, APIKey: "sk-test", Weight: 10, Enabled: true})
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"gpt-3.5-turbo","messages":[{"role":"user","content":"hi"}],"stream":true}`)).WithContext(ctx)
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("user_id", int64(1))
+
+	time.AfterFunc(200*time.Millisecond, func() { cancel(ErrShuttingDown) })
+	handler.ChatCompletions(c)
+
+	// The client sees the stream end with an error event rather than a
+	// dropped connection
+	body := w.Body.String()
+	if !strings.HasPrefix(body, roleChunk+contentChunk) || !strings.Contains(body, ErrShuttingDown.Error()) || !strings.HasSuffix(body, doneEvent) {
+		t.Errorf("Expected the content followed by a shutdown error event and [DONE], got %q", body)
+	}
+
+	// The shutdown is not held against the channel
+	m, _ := db.GetChannelMetrics(1)
+	if m != nil && m.ErrorRate > 0 {
+		t.Errorf("Expected no channel error for a shutdown, got error rate %v", m.ErrorRate)
+	}
+}
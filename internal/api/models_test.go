@@ -0,0 +1,75 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/X0Ken/openai-gateway/internal/auth"
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+func TestAllowedModels(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler, db, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	db.CreateModel(&database.Model{Name: "gpt-4"})
+	db.CreateModel(&database.Model{Name: "gpt-4o"})
+	user, _ := db.GetUser(1)
+	user.AllowedModels = []string{"gpt-4*"}
+	if err := db.UpdateUser(user); err != nil {
+		t.Fatal(err)
+	}
+	db.CreateAPIKey(&database.APIKey{UserID: 1, Name: "narrow", Key: "sk-narrow", Enabled: true, AllowedModels: []string{"gpt-4o", "gpt-3.5-turbo"}})
+
+	r := gin.New()
+	handler.RegisterRoutes(r.Group("/v1"), auth.NewMiddleware(db))
+
+	listModels := func(key string) []string {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/v1/models", nil)
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var resp ListModelsResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Failed to decode models: %v: %s", err, w.Body.String())
+		}
+		var names []string
+		for _, m := range resp.Data {
+			names = append(names, m.ID)
+		}
+		return names
+	}
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"", "gpt-3.5-turbo,gpt-4,gpt-4o"},
+		{"test-key", "gpt-4,gpt-4o"},
+		// A key only narrows its user's models
+		{"sk-narrow", "gpt-4o"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(listModels(tt.key), ","); got != tt.want {
+			t.Errorf("Models for key %q: expected %s, got %s", tt.key, tt.want, got)
+		}
+	}
+
+	// Calling a model outside the list is rejected as if it did not exist
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model": "gpt-3.5-turbo", "messages": [{"role": "user", "content": "hi"}]}`))
+	req.Header.Set("Authorization", "Bearer test-key")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "not available") {
+		t.Errorf("Expected 404 for a model outside the list, got %d: %s", w.Code, w.Body.String())
+	}
+}
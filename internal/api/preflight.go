@@ -0,0 +1,104 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/X0Ken/openai-gateway/internal/auth"
+	"github.com/X0Ken/openai-gateway/internal/quota"
+	"github.com/gin-gonic/gin"
+)
+
+// PreflightRequest describes a planned request. The prompt size is given as
+// prompt_tokens, or estimated from messages when prompt_tokens is zero.
+type PreflightRequest struct {
+	Model        string                  `json:"model" binding:"required"`
+	PromptTokens int                     `json:"prompt_tokens" binding:"min=0"`
+	MaxTokens    int                     `json:"max_tokens" binding:"min=0"`
+	Messages     []ChatCompletionMessage `json:"messages"`
+}
+
+// PreflightCheck is the outcome of one check of a planned request
+type PreflightCheck struct {
+	Name    string `json:"name"`
+	Allowed bool   `json:"allowed"`
+	Message string `json:"message,omitempty"`
+}
+
+// PreflightResponse reports whether a planned request would be accepted now.
+// Allowed is set when every check passes.
+type PreflightResponse struct {
+	Model        string           `json:"model"`
+	PromptTokens int              `json:"prompt_tokens"`
+	Allowed      bool             `json:"allowed"`
+	Checks       []PreflightCheck `json:"checks"`
+}
+
+// Preflight handles checking a planned request against the limits the
+// gateway enforces, so batch schedulers can plan submissions. Nothing is
+// routed, counted or sent upstream.
+func (h *Handler) Preflight(c *gin.Context) {
+	var req PreflightRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.PromptTokens == 0 && len(req.Messages) > 0 {
+		req.PromptTokens = estimatePromptTokens(req.Model, req.Messages)
+	}
+
+	model, channels, err := h.router.Available(req.Model)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Models the caller may not use are reported as missing
+	if model != nil && !auth.ModelAllowed(c, req.Model) {
+		model, channels = nil, 0
+	}
+
+	resp := PreflightResponse{Model: req.Model, PromptTokens: req.PromptTokens, Allowed: true}
+	check := func(name string, allowed bool, message string) {
+		resp.Checks = append(resp.Checks, PreflightCheck{Name: name, Allowed: allowed, Message: message})
+		resp.Allowed = resp.Allowed && allowed
+	}
+
+	switch {
+	case model == nil:
+		check("model", false, "model not found: "+req.Model)
+	case channels == 0:
+		check("model", false, "no channel can currently serve the model")
+	default:
+		check("model", true, fmt.Sprintf("%d of the model's channels can take requests", channels))
+	}
+
+	if model != nil && model.ContextWindow > 0 {
+		tokens := req.PromptTokens + req.MaxTokens
+		switch {
+		case tokens <= model.ContextWindow:
+			check("context_window", true, "")
+		case truncationEnabled(c, model) && req.MaxTokens < model.ContextWindow:
+			check("context_window", true, fmt.Sprintf("%d tokens exceed the context window of %d, the oldest messages will be dropped", tokens, model.ContextWindow))
+		default:
+			check("context_window", false, fmt.Sprintf("%d tokens exceed the context window of %d", tokens, model.ContextWindow))
+		}
+	}
+
+	if h.quota != nil {
+		statuses, err := h.quota.Statuses(c.GetInt64("user_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		switch exhausted := quota.Exhausted(statuses); {
+		case len(statuses) == 0:
+		case exhausted != nil:
+			check("quota", false, exhausted.Message())
+		default:
+			check("quota", true, "")
+		}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
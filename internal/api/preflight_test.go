@@ -0,0 +1,85 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+func postPreflight(handler *Handler, body string, headers ...string) PreflightResponse {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/v1/preflight", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	for i := 0; i+1 < len(headers); i += 2 {
+		c.Request.Header.Set(headers[i], headers[i+1])
+	}
+	c.Set("user_id", int64(1))
+	handler.Preflight(c)
+
+	var resp PreflightResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return resp
+}
+
+func TestPreflight(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler, db, cleanup := setupTestHandler(t)
+	defer cleanup()
+	db.UpdateModel(&database.Model{ID: 1, Name: "gpt-3.5-turbo", ContextWindow: 1000})
+
+	resp := postPreflight(handler, `{"model":"gpt-3.5-turbo","prompt_tokens":600,"max_tokens":300}`)
+	if !resp.Allowed || len(resp.Checks) != 2 {
+		t.Errorf("Expected the request to be allowed, got %+v", resp)
+	}
+
+	resp = postPreflight(handler, `{"model":"gpt-3.5-turbo","prompt_tokens":900,"max_tokens":300}`)
+	if resp.Allowed || resp.Checks[1].Name != "context_window" || resp.Checks[1].Allowed {
+		t.Errorf("Expected the context window check to fail, got %+v", resp)
+	}
+
+	// Truncation makes room for the completion
+	resp = postPreflight(handler, `{"model":"gpt-3.5-turbo","prompt_tokens":900,"max_tokens":300}`, TruncateHeader, "true")
+	if !resp.Allowed {
+		t.Errorf("Expected truncation to allow the request, got %+v", resp)
+	}
+
+	// The prompt is estimated from messages
+	resp = postPreflight(handler, `{"model":"gpt-3.5-turbo","messages":[{"role":"user","content":"Hello there"}]}`)
+	if resp.PromptTokens == 0 || !resp.Allowed {
+		t.Errorf("Expected an estimated prompt, got %+v", resp)
+	}
+
+	resp = postPreflight(handler, `{"model":"unknown"}`)
+	if resp.Allowed || resp.Checks[0].Name != "model" {
+		t.Errorf("Expected an unknown model to be refused, got %+v", resp)
+	}
+
+	db.UpdateChannel(&database.Channel{ID: 1, Name: "test-chan", BaseURL: "https://api.openai.com", APIKey: "sk-test", Weight: 10, Enabled: false})
+	resp = postPreflight(handler, `{"model":"gpt-3.5-turbo"}`)
+	if resp.Allowed || resp.Checks[0].Allowed {
+		t.Errorf("Expected a model without channels to be refused, got %+v", resp)
+	}
+}
+
+func TestPreflightRejectsInvalidRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler, _, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/v1/preflight", strings.NewReader(`{"model":"gpt-3.5-turbo","prompt_tokens":-1}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	handler.Preflight(c)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400, got %d", w.Code)
+	}
+}
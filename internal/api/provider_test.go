@@ -0,0 +1,132 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+func TestAnthropicChannel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler, db, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" || r.Header.Get("X-Api-Key") != "sk-ant" {
+			t.Errorf("Unexpected request %s with key %q", r.URL.Path, r.Header.Get("X-Api-Key"))
+		}
+		var req struct {
+			Model     string `json:"model"`
+			MaxTokens int    `json:"max_tokens"`
+			Stream    bool   `json:"stream"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Model != "gpt-3.5-turbo" || req.MaxTokens == 0 {
+			t.Errorf("Unexpected Messages request %+v", req)
+		}
+
+		if req.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"id\":\"msg_2\",\"model\":\"claude\",\"usage\":{\"input_tokens\":4}}}\n\n"))
+			w.Write([]byte("event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"Hi there\"}}\n\n"))
+			w.Write([]byte("event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"end_turn\"},\"usage\":{\"output_tokens\":2}}\n\n"))
+			w.Write([]byte("event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","model":"claude","content":[{"type":"text","text":"Hello!"}],"stop_reason":"end_turn","usage":{"input_tokens":5,"output_tokens":3}}`))
+	}))
+	defer mockBackend.Close()
+
+	db.UpdateChannel(&database.Channel{ID: 1, Name: "test-chan", Type: database.ChannelTypeAnthropic, BaseURL: mockBackend.URL, APIKey: "sk-ant", Weight: 10, Enabled: true})
+
+	send := func(path string, handle gin.HandlerFunc, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", path, bytes.NewBufferString(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Set("user_id", int64(1))
+		handle(c)
+		return w
+	}
+
+	w := send("/v1/chat/completions", handler.ChatCompletions, `{"model":"gpt-3.5-turbo","messages":[{"role":"user","content":"hi"}]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp ChatCompletionResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Choices) != 1 || resp.Choices[0].Message.Content != "Hello!" || resp.Choices[0].FinishReason != "stop" || resp.Usage.TotalTokens != 8 {
+		t.Errorf("Unexpected converted response %s", w.Body.String())
+	}
+
+	w = send("/v1/chat/completions", handler.ChatCompletions, `{"model":"gpt-3.5-turbo","messages":[{"role":"user","content":"hi"}],"stream":true,"stream_options":{"include_usage":true}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	stream := w.Body.String()
+	if !strings.Contains(stream, `"content":"Hi there"`) || !strings.Contains(stream, `"total_tokens":6`) || !strings.HasSuffix(stream, "data: [DONE]\n\n") {
+		t.Errorf("Unexpected converted stream %s", stream)
+	}
+
+	// Operations the Messages API cannot serve are rejected as client errors
+	w = send("/v1/embeddings", handler.Embeddings, `{"model":"gpt-3.5-turbo","input":"hi"}`)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "anthropic channels do not support embeddings") {
+		t.Errorf("Expected 400 for embeddings, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestGeminiChannel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler, db, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Goog-Api-Key") != "goog-key" {
+			t.Errorf("Unexpected key %q", r.Header.Get("X-Goog-Api-Key"))
+		}
+		switch r.URL.Path {
+		case "/v1beta/models/gemini-2.5-flash:streamGenerateContent":
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: {\"candidates\":[{\"content\":{\"role\":\"model\",\"parts\":[{\"text\":\"Hi there\"}]},\"finishReason\":\"STOP\"}],\"usageMetadata\":{\"promptTokenCount\":4,\"candidatesTokenCount\":2}}\r\n\r\n"))
+		case "/v1beta/models/gemini-2.5-flash:generateContent":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"candidates":[{"content":{"role":"model","parts":[{"text":"Hello!"}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":5,"candidatesTokenCount":3}}`))
+		default:
+			t.Errorf("Unexpected request %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer mockBackend.Close()
+
+	db.UpdateChannel(&database.Channel{ID: 1, Name: "test-chan", Type: database.ChannelTypeGemini, BaseURL: mockBackend.URL, APIKey: "goog-key", Weight: 10, Enabled: true})
+	db.UpdateModelChannel(&database.ModelChannel{ModelID: 1, ChannelID: 1, BackendModelName: "gemini-2.5-flash", Weight: 10})
+
+	w := postChat(handler, `{"model":"gpt-3.5-turbo","messages":[{"role":"user","content":"hi"}]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp ChatCompletionResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Choices) != 1 || resp.Choices[0].Message.Content != "Hello!" || resp.Usage.TotalTokens != 8 {
+		t.Errorf("Unexpected converted response %s", w.Body.String())
+	}
+
+	w = postChat(handler, `{"model":"gpt-3.5-turbo","messages":[{"role":"user","content":"hi"}],"stream":true,"stream_options":{"include_usage":true}}`)
+	stream := w.Body.String()
+	if w.Code != http.StatusOK || !strings.Contains(stream, `"content":"Hi there"`) || !strings.Contains(stream, `"total_tokens":6`) || !strings.HasSuffix(stream, "data: [DONE]\n\n") {
+		t.Errorf("Unexpected converted stream %d: %s", w.Code, stream)
+	}
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+
+	"github.com/X0Ken/openai-gateway/internal/metrics"
+	"github.com/X0Ken/openai-gateway/internal/quality"
+)
+
+// maxQualityContent bounds the streamed content buffered for quality
+// checks. Longer responses are checked on their start only.
+const maxQualityContent = 64 << 10
+
+// EnableQualitySignals computes quality signals for every successful chat
+// completion and records them per channel
+func (h *Handler) EnableQualitySignals() {
+	h.quality = true
+	h.AddStreamObserver(h.newQualityObserver)
+}
+
+// responseFormat returns the type of a request's response_format, if any
+func responseFormat(req *ChatCompletionRequest) string {
+	if !req.Extra.has("response_format") {
+		return ""
+	}
+	var format struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(req.Extra["response_format"], &format); err != nil {
+		return ""
+	}
+	return format.Type
+}
+
+// jsonFormat reports whether a response_format type asks for JSON output
+func jsonFormat(format string) bool {
+	return format == "json_object" || format == "json_schema"
+}
+
+// recordQuality records the quality signals of a response served on a
+// channel, logging degraded ones
+func recordQuality(channel, model string, r quality.Response) {
+	signals := quality.Evaluate(r)
+	metrics.RecordQuality(channel, signals)
+	if len(signals) > 0 {
+		log.Printf("Quality signals: channel=%s model=%s signals=%s", channel, model, strings.Join(signals, ","))
+	}
+}
+
+// qualityMessage holds the parts of a message or delta quality checks use
+type qualityMessage struct {
+	Content   *string         `json:"content"`
+	ToolCalls json.RawMessage `json:"tool_calls"`
+	Refusal   *string         `json:"refusal"`
+}
+
+// qualityChoices holds the first-choice messages of a response or chunk
+type qualityChoices struct {
+	Choices []struct {
+		Index   int            `json:"index"`
+		Message qualityMessage `json:"message"`
+		Delta   qualityMessage `json:"delta"`
+	} `json:"choices"`
+}
+
+// first returns the message or delta of the first choice
+func (q *qualityChoices) first(delta bool) (qualityMessage, bool) {
+	for _, choice := range q.Choices {
+		if choice.Index == 0 {
+			if delta {
+				return choice.Delta, true
+			}
+			return choice.Message, true
+		}
+	}
+	return qualityMessage{}, false
+}
+
+// addTo adds a message or delta to the response being checked
+func (m qualityMessage) addTo(r *quality.Response) {
+	if m.Content != nil {
+		r.Content += *m.Content
+	}
+	if len(m.ToolCalls) > 0 && string(m.ToolCalls) != "null" {
+		r.ToolCalls = true
+	}
+	if m.Refusal != nil && *m.Refusal != "" {
+		r.Refusal = true
+	}
+}
+
+// checkQuality records the quality signals of a chat completion response body
+func (h *Handler) checkQuality(channel string, req *ChatCompletionRequest, body []byte) {
+	if !h.quality {
+		return
+	}
+	r := quality.Response{JSON: jsonFormat(responseFormat(req))}
+	var resp qualityChoices
+	if err := json.Unmarshal(body, &resp); err == nil {
+		if message, ok := resp.first(false); ok {
+			message.addTo(&r)
+		}
+	}
+	recordQuality(channel, req.Model, r)
+}
+
+// qualityObserver collects the first choice of a streamed chat completion
+// and records its quality signals once the stream ends successfully
+type qualityObserver struct {
+	info     StreamInfo
+	response quality.Response
+}
+
+// newQualityObserver is the stream observer factory for quality signals
+func (h *Handler) newQualityObserver(info StreamInfo) StreamObserver {
+	return &qualityObserver{info: info, response: quality.Response{JSON: jsonFormat(info.ResponseFormat)}}
+}
+
+// ObserveEvent adds a chunk's delta to the response
+func (o *qualityObserver) ObserveEvent(data []byte) {
+	if len(data) == 0 || data[0] != '{' {
+		return
+	}
+	var chunk qualityChoices
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		return
+	}
+	delta, ok := chunk.first(true)
+	if !ok {
+		return
+	}
+	delta.addTo(&o.response)
+	if len(o.response.Content) > maxQualityContent {
+		o.response.Content = o.response.Content[:maxQualityContent]
+		o.response.Partial = true
+	}
+}
+
+// StreamEnded records the quality signals unless the stream failed
+func (o *qualityObserver) StreamEnded(err error) {
+	if err != nil {
+		return
+	}
+	recordQuality(o.info.Channel, o.info.Model, o.response)
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/X0Ken/openai-gateway/internal/metrics"
+	"github.com/X0Ken/openai-gateway/internal/quality"
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+// postChat sends a raw chat completion request body to the handler
+func postChat(handler *Handler, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("user_id", int64(1))
+	handler.ChatCompletions(c)
+	return w
+}
+
+func TestQualitySignalsRecorded(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler, db, cleanup := setupTestHandler(t)
+	defer cleanup()
+	handler.EnableQualitySignals()
+
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Stream bool `json:"stream"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err == nil && req.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"I'm sorry, but I can't \"}}]}\n\n"))
+			w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"do that.\"}}]}\n\ndata: [DONE]\n\n"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"x","choices":[{"index":0,"message":{"role":"assistant","content":"{\"answer\": [1,"},"finish_reason":"length"}]}`))
+	}))
+	defer mockBackend.Close()
+
+	db.UpdateChannel(&database.Channel{ID: 1, Name: "quality-chan", BaseURL: mockBackend.URL, APIKey: "sk-test", Weight: 10, Enabled: true})
+
+	w := postChat(handler, `{"model":"gpt-3.5-turbo","messages":[{"role":"user","content":"json please"}],"response_format":{"type":"json_object"}}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	w = postChat(handler, `{"model":"gpt-3.5-turbo","messages":[{"role":"user","content":"hi"}],"stream":true}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	checked, signals := metrics.ChannelQuality("quality-chan")
+	if checked != 2 {
+		t.Errorf("Expected 2 checked responses, got %v", checked)
+	}
+	if signals[quality.SignalTruncatedJSON] != 1 || signals[quality.SignalRefusal] != 1 || signals[quality.SignalEmpty] != 0 {
+		t.Errorf("Unexpected signals %v", signals)
+	}
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"strings"
+
+	"github.com/X0Ken/openai-gateway/internal/auth"
+	"github.com/X0Ken/openai-gateway/internal/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// Recovery returns a middleware that turns a panic in a later handler into
+// an OpenAI-style 500 error. The panic is logged with its stack trace, the
+// route, the caller and the request ID, which is also returned to the client
+// so a report can be matched to the log. Streams that already started end
+// with an error event instead.
+func Recovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			// The server aborts the connection silently for this value
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+
+			requestID := recoveryRequestID(c)
+			route := c.FullPath()
+			userID, _ := auth.GetUserID(c)
+			metrics.RecordPanic(route)
+			log.Printf("Panic serving %s %s: request_id=%s user_id=%d: %v\n%s",
+				c.Request.Method, route, requestID, userID, v, debug.Stack())
+
+			message := fmt.Sprintf("internal server error (request ID %s)", requestID)
+			if c.Writer.Written() {
+				if strings.HasPrefix(c.Writer.Header().Get("Content-Type"), "text/event-stream") {
+					writeStreamError(c, errors.New(message))
+				}
+				c.Abort()
+				return
+			}
+			clearStreamHeaders(c)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": gin.H{
+				"message": message,
+				"type":    "server_error",
+				"param":   nil,
+				"code":    "internal_error",
+			}})
+		}()
+		c.Next()
+	}
+}
+
+// recoveryRequestID returns the request ID of the request's trace. Routes
+// outside the traced API get one for the panic, echoed in the response.
+func recoveryRequestID(c *gin.Context) string {
+	if trace := traceFrom(c.Request.Context()); trace != nil {
+		return trace.RequestID
+	}
+	trace := newTrace(c.Request.Header)
+	c.Header(RequestIDHeader, trace.RequestID)
+	return trace.RequestID
+}
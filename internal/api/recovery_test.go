@@ -0,0 +1,67 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/X0Ken/openai-gateway/internal/metrics"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRecovery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(Recovery())
+	r.Use(Tracing())
+	r.GET("/v1/boom", func(c *gin.Context) {
+		panic("boom")
+	})
+	r.GET("/v1/stream", func(c *gin.Context) {
+		c.Header("Content-Type", "text/event-stream")
+		c.Writer.WriteString(roleChunk)
+		panic("boom")
+	})
+
+	before := testutil.ToFloat64(metrics.Panics.WithLabelValues("/v1/boom"))
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/v1/boom", nil)
+	req.Header.Set(RequestIDHeader, "req-123")
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected 500, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Error struct {
+			Message string `json:"message"`
+			Type    string `json:"type"`
+			Code    string `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Expected a JSON error, got %q", w.Body.String())
+	}
+	if resp.Error.Type != "server_error" || resp.Error.Code != "internal_error" || !strings.Contains(resp.Error.Message, "req-123") {
+		t.Errorf("Unexpected error %+v", resp.Error)
+	}
+	if w.Header().Get(RequestIDHeader) != "req-123" {
+		t.Errorf("Expected the request ID header, got %q", w.Header().Get(RequestIDHeader))
+	}
+	if got := testutil.ToFloat64(metrics.Panics.WithLabelValues("/v1/boom")); got != before+1 {
+		t.Errorf("Expected the panic to be counted, got %v", got-before)
+	}
+
+	// A stream that already started ends with an error event
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/v1/stream", nil))
+	body := w.Body.String()
+	if !strings.HasPrefix(body, roleChunk) || !strings.Contains(body, "internal server error") || !strings.HasSuffix(body, doneEvent) {
+		t.Errorf("Expected the stream to end with an error event, got %q", body)
+	}
+}
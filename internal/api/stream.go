@@ -0,0 +1,61 @@
+package api
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// streamBufferSize is the size of the buffers used to copy streamed responses
+const streamBufferSize = 32 * 1024
+
+// streamBuffers recycles copy buffers between streams
+var streamBuffers = sync.Pool{
+	New: func() any {
+		buf := make([]byte, streamBufferSize)
+		return &buf
+	},
+}
+
+// flushWriter flushes the client connection after every write that completes
+// a line, so SSE events reach the client as soon as the backend sends them.
+// Writes are passed through unchanged, so CRLF line endings and lines longer
+// than the copy buffer are forwarded intact.
+type flushWriter struct {
+	w       io.Writer
+	flusher http.Flusher
+}
+
+// Write writes p and flushes if it contains a newline
+func (fw *flushWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	if n > 0 && bytes.IndexByte(p[:n], '\n') >= 0 {
+		fw.flusher.Flush()
+	}
+	return n, err
+}
+
+// copyStream copies a streamed backend response to the client, flushing at
+// line boundaries, and returns the number of bytes written. Observers see
+// each event as it is written.
+func copyStream(w http.ResponseWriter, body io.Reader, observers []StreamObserver) (int64, error) {
+	bufp := streamBuffers.Get().(*[]byte)
+	defer streamBuffers.Put(bufp)
+
+	dst := io.Writer(w)
+	if flusher, ok := w.(http.Flusher); ok {
+		dst = &flushWriter{w: w, flusher: flusher}
+	}
+
+	tee := newStreamTee(dst, observers)
+	if tee != nil {
+		dst = tee
+	}
+
+	n, err := io.CopyBuffer(dst, body, *bufp)
+	if tee != nil {
+		tee.close(err)
+	}
+	return n, err
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// countingRecorder counts flushes of a response recorder
+type countingRecorder struct {
+	*httptest.ResponseRecorder
+	flushes int
+}
+
+func (r *countingRecorder) Flush() {
+	r.flushes++
+	r.ResponseRecorder.Flush()
+}
+
+func TestCopyStream(t *testing.T) {
+	longLine := "data: " + strings.Repeat("x", 3*streamBufferSize) + "\r\n\r\n"
+	input := "data: {\"id\":\"1\"}\r\n\r\n" + longLine + "data: [DONE]\n\n"
+
+	w := &countingRecorder{ResponseRecorder: httptest.NewRecorder()}
+	n, err := copyStream(w, strings.NewReader(input), nil)
+	if err != nil {
+		t.Fatalf("copyStream failed: %v", err)
+	}
+
+	if n != int64(len(input)) {
+		t.Errorf("Expected %d bytes copied, got %d", len(input), n)
+	}
+	if w.Body.String() != input {
+		t.Error("Streamed body does not match input")
+	}
+	if w.flushes == 0 {
+		t.Error("Expected the stream to be flushed")
+	}
+}
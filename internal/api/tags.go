@@ -0,0 +1,115 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TagsHeader carries client-defined attribution tags as comma-separated k=v pairs
+const TagsHeader = "X-Gateway-Tags"
+
+// Limits on client-supplied tags, keeping log lines and usage rows bounded
+const (
+	maxTags        = 10
+	maxTagKeyLen   = 64
+	maxTagValueLen = 128
+)
+
+// tagsContextKey is the gin context key holding the parsed request tags
+const tagsContextKey = "gateway_tags"
+
+// tagKeyPattern restricts tag keys to identifier-like names
+var tagKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_.\-]+$`)
+
+// ErrInvalidTags is returned when the tags header is malformed or exceeds limits
+var ErrInvalidTags = errors.New("invalid " + TagsHeader + " header")
+
+// ParseTags parses a header value such as "feature=search, team=growth".
+// An empty value yields no tags.
+func ParseTags(header string) (map[string]string, error) {
+	tags := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return tags, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+
+		if !ok || key == "" {
+			return nil, fmt.Errorf("%w: expected key=value, got %q", ErrInvalidTags, pair)
+		}
+		if len(key) > maxTagKeyLen || !tagKeyPattern.MatchString(key) {
+			return nil, fmt.Errorf("%w: invalid key %q", ErrInvalidTags, key)
+		}
+		if len(value) > maxTagValueLen || strings.ContainsFunc(value, isControl) {
+			return nil, fmt.Errorf("%w: invalid value for %q", ErrInvalidTags, key)
+		}
+		if _, dup := tags[key]; dup {
+			return nil, fmt.Errorf("%w: duplicate key %q", ErrInvalidTags, key)
+		}
+
+		tags[key] = value
+		if len(tags) > maxTags {
+			return nil, fmt.Errorf("%w: at most %d tags are allowed", ErrInvalidTags, maxTags)
+		}
+	}
+
+	return tags, nil
+}
+
+// FormatTags renders tags in canonical form, sorted by key
+func FormatTags(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + tags[k]
+	}
+	return strings.Join(pairs, ",")
+}
+
+// Tags returns a middleware that parses the tags header of metered
+// requests, rejecting a malformed one, and logs the tags of each tagged
+// request once it is served. The tags are also recorded with its usage.
+func Tags() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tags, err := ParseTags(c.GetHeader(TagsHeader))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.Set(tagsContextKey, tags)
+
+		c.Next()
+
+		if len(tags) > 0 {
+			log.Printf("Tagged request: user=%d path=%s status=%d tags=%s", c.GetInt64("user_id"), c.FullPath(), c.Writer.Status(), FormatTags(tags))
+		}
+	}
+}
+
+// GetTags returns the tags attached to the request, if any
+func GetTags(c *gin.Context) map[string]string {
+	if tags, ok := c.Get(tagsContextKey); ok {
+		return tags.(map[string]string)
+	}
+	return nil
+}
+
+// isControl reports whether r is a control character
+func isControl(r rune) bool {
+	return r < 0x20 || r == 0x7f
+}
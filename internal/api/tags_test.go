@@ -0,0 +1,111 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseTags(t *testing.T) {
+	tags, err := ParseTags(" feature=search , team=growth,empty=")
+	if err != nil {
+		t.Fatalf("Failed to parse tags: %v", err)
+	}
+
+	if tags["feature"] != "search" || tags["team"] != "growth" || tags["empty"] != "" {
+		t.Errorf("Unexpected tags: %v", tags)
+	}
+
+	if got := FormatTags(tags); got != "empty=,feature=search,team=growth" {
+		t.Errorf("Unexpected canonical form: %s", got)
+	}
+}
+
+func TestParseTagsInvalid(t *testing.T) {
+	tooMany := make([]string, maxTags+1)
+	for i := range tooMany {
+		tooMany[i] = "k" + strings.Repeat("x", i) + "=v"
+	}
+
+	tests := []string{
+		"novalue",
+		"=value",
+		"bad key=v",
+		"a=1,a=2",
+		"k=" + strings.Repeat("v", maxTagValueLen+1),
+		"k=line\nbreak",
+		strings.Join(tooMany, ","),
+	}
+
+	for _, header := range tests {
+		if _, err := ParseTags(header); err == nil {
+			t.Errorf("Expected error for %q", header)
+		}
+	}
+}
+
+func TestTagsMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var got map[string]string
+	r := gin.New()
+	r.POST("/v1/embeddings", Tags(), func(c *gin.Context) {
+		got = GetTags(c)
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest("POST", "/v1/embeddings", strings.NewReader(`{}`))
+	req.Header.Set(TagsHeader, "feature=search")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || got["feature"] != "search" {
+		t.Errorf("Expected tags passed on, got %d with %v", w.Code, got)
+	}
+
+	got = nil
+	req = httptest.NewRequest("POST", "/v1/embeddings", strings.NewReader(`{}`))
+	req.Header.Set(TagsHeader, "feature")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest || got != nil {
+		t.Errorf("Expected a malformed header rejected before the handler, got %d", w.Code)
+	}
+}
+
+func TestTagsRecordedWithUsage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler, db, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"c1","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}],"usage":{"prompt_tokens":1,"completion_tokens":1,"total_tokens":2}}`))
+	}))
+	defer mockBackend.Close()
+	db.UpdateChannel(&database.Channel{ID: 1, Name: "test-chan", BaseURL: mockBackend.URL, APIKey: "sk-test", Weight: 10, Enabled: true})
+
+	r := gin.New()
+	r.POST("/v1/chat/completions", func(c *gin.Context) { c.Set("user_id", int64(1)) }, Tags(), handler.ChatCompletions)
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"gpt-3.5-turbo","messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TagsHeader, "team=growth, feature=search")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	logs, err := db.ListUsageLogs(database.UsageQuery{Tags: []string{"team=growth"}}, 10)
+	if err != nil {
+		t.Fatalf("Failed to list usage logs: %v", err)
+	}
+	if len(logs) != 1 || logs[0].Tags != "feature=search,team=growth" {
+		t.Errorf("Expected the usage row tagged, got %+v", logs)
+	}
+}
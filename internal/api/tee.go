@@ -0,0 +1,173 @@
+package api
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+// maxObservedLine bounds the SSE line buffered for observers. Longer lines
+// still reach the client, but the event they belong to is not observed.
+const maxObservedLine = 1 << 20
+
+// StreamInfo describes a streamed response to its observers
+type StreamInfo struct {
+	UserID int64
+	// APIKeyID is the user's API key the request was made with
+	APIKeyID int64
+	// EndUser is the request's OpenAI "user" field, if any
+	EndUser   string
+	Model     string
+	Channel   string
+	ChannelID int64
+	// BackendModel is the model name sent to the channel
+	BackendModel string
+	// Tags are the request's attribution tags in the canonical form of
+	// FormatTags, if any
+	Tags string
+	// ResponseFormat is the type of the requested response_format, if any
+	ResponseFormat string
+}
+
+// StreamObserver receives the events of a streamed response as they are sent
+// to the client. Observers are called synchronously from the copy loop, so
+// they must not block; slow work such as moderation should be handed off.
+type StreamObserver interface {
+	// ObserveEvent is called with the data of each SSE event, without the
+	// "data:" prefix, including the final [DONE]. data is only valid for the
+	// duration of the call.
+	ObserveEvent(data []byte)
+	// StreamEnded is called once when the stream ends, with the error that
+	// ended it, if any
+	StreamEnded(err error)
+}
+
+// StreamObserverFactory creates the observer for one stream. It may return
+// nil to skip the stream.
+type StreamObserverFactory func(info StreamInfo) StreamObserver
+
+// AddStreamObserver registers a factory whose observers see every streamed
+// chat completion
+func (h *Handler) AddStreamObserver(factory StreamObserverFactory) {
+	h.streamObservers = append(h.streamObservers, factory)
+}
+
+// newStreamObservers creates the observers for a stream served on a channel
+func (h *Handler) newStreamObservers(c *gin.Context, ch *database.Channel, backendModelName string, req *ChatCompletionRequest) []StreamObserver {
+	if len(h.streamObservers) == 0 {
+		return nil
+	}
+
+	info := requestInfo(c, req.Model, ch, backendModelName, req.User)
+	info.ResponseFormat = responseFormat(req)
+	var observers []StreamObserver
+	for _, factory := range h.streamObservers {
+		if observer := factory(info); observer != nil {
+			observers = append(observers, observer)
+		}
+	}
+	return observers
+}
+
+// streamTee writes a stream to the client unchanged while splitting it into
+// SSE events for observers. Only the current line and event are buffered, so
+// memory stays bounded however long the stream runs.
+type streamTee struct {
+	w         io.Writer
+	observers []StreamObserver
+
+	line     []byte
+	overflow bool
+	event    []byte
+	hasData  bool
+	broken   bool
+}
+
+// newStreamTee returns a tee writing to w, or nil without observers
+func newStreamTee(w io.Writer, observers []StreamObserver) *streamTee {
+	if len(observers) == 0 {
+		return nil
+	}
+	return &streamTee{w: w, observers: observers}
+}
+
+// Write writes p to the client and feeds what was written to observers
+func (t *streamTee) Write(p []byte) (int, error) {
+	n, err := t.w.Write(p)
+	t.scan(p[:n])
+	return n, err
+}
+
+// scan splits written bytes into lines
+func (t *streamTee) scan(p []byte) {
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			t.appendLine(p)
+			return
+		}
+		t.appendLine(p[:i])
+		t.endLine()
+		p = p[i+1:]
+	}
+}
+
+// appendLine buffers part of the current line, up to maxObservedLine
+func (t *streamTee) appendLine(p []byte) {
+	if t.overflow {
+		return
+	}
+	if len(t.line)+len(p) > maxObservedLine {
+		t.overflow = true
+		t.line = t.line[:0]
+		return
+	}
+	t.line = append(t.line, p...)
+}
+
+// endLine handles a complete line: data lines are added to the current
+// event, a blank line dispatches it, and other fields and comments are ignored
+func (t *streamTee) endLine() {
+	line := bytes.TrimSuffix(t.line, []byte("\r"))
+	switch {
+	case t.overflow:
+		t.broken = true
+	case len(line) == 0:
+		t.dispatch()
+	case bytes.HasPrefix(line, []byte("data:")):
+		value := bytes.TrimPrefix(line[len("data:"):], []byte(" "))
+		if t.hasData {
+			t.event = append(t.event, '\n')
+		}
+		t.event = append(t.event, value...)
+		t.hasData = true
+	}
+	t.line = t.line[:0]
+	t.overflow = false
+}
+
+// dispatch passes the current event to observers and starts the next one
+func (t *streamTee) dispatch() {
+	if t.hasData && !t.broken {
+		for _, observer := range t.observers {
+			observer.ObserveEvent(t.event)
+		}
+	}
+	t.event = t.event[:0]
+	t.hasData = false
+	t.broken = false
+}
+
+// close dispatches an event left unterminated by the backend and notifies
+// observers that the stream ended
+func (t *streamTee) close(err error) {
+	if len(t.line) > 0 || t.overflow {
+		t.endLine()
+	}
+	t.dispatch()
+	for _, observer := range t.observers {
+		observer.StreamEnded(err)
+	}
+}
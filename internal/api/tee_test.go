@@ -0,0 +1,126 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+// recordingObserver collects the events of a stream
+type recordingObserver struct {
+	info   StreamInfo
+	events []string
+	ended  bool
+	err    error
+}
+
+func (o *recordingObserver) ObserveEvent(data []byte) {
+	o.events = append(o.events, string(data))
+}
+
+func (o *recordingObserver) StreamEnded(err error) {
+	o.ended = true
+	o.err = err
+}
+
+func TestStreamTeeSplitsEvents(t *testing.T) {
+	var client bytes.Buffer
+	observer := &recordingObserver{}
+	tee := newStreamTee(&client, []StreamObserver{observer})
+
+	input := ": keepalive\r\n" +
+		"data: {\"a\":1}\r\n\r\n" +
+		"event: message\n" +
+		"data: line one\n" +
+		"data: line two\n\n" +
+		"data: [DONE]"
+
+	// Split writes at awkward places, including inside CRLF
+	for _, chunk := range []string{input[:5], input[5:16], input[16:40], input[40:]} {
+		tee.Write([]byte(chunk))
+	}
+	tee.close(nil)
+
+	if client.String() != input {
+		t.Errorf("Expected the client to receive the stream unchanged, got %q", client.String())
+	}
+	want := []string{`{"a":1}`, "line one\nline two", "[DONE]"}
+	if strings.Join(observer.events, "|") != strings.Join(want, "|") {
+		t.Errorf("Expected events %q, got %q", want, observer.events)
+	}
+	if !observer.ended || observer.err != nil {
+		t.Errorf("Expected a clean end, got ended=%v err=%v", observer.ended, observer.err)
+	}
+}
+
+func TestStreamTeeSkipsOversizedEvents(t *testing.T) {
+	var client bytes.Buffer
+	observer := &recordingObserver{}
+	tee := newStreamTee(&client, []StreamObserver{observer})
+
+	tee.Write([]byte("data: " + strings.Repeat("x", maxObservedLine) + "\n\n"))
+	tee.Write([]byte("data: small\n\n"))
+	tee.close(errors.New("backend closed"))
+
+	if len(observer.events) != 1 || observer.events[0] != "small" {
+		t.Errorf("Expected only the small event, got %d events", len(observer.events))
+	}
+	if client.Len() != len("data: ")+maxObservedLine+2+len("data: small\n\n") {
+		t.Errorf("Expected the oversized event to reach the client, got %d bytes", client.Len())
+	}
+	if observer.err == nil {
+		t.Error("Expected the stream error to reach observers")
+	}
+}
+
+func TestStreamObserversSeeChatStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler, db, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"Hi\"}}]}\n\ndata: [DONE]\n\n"))
+	}))
+	defer mockBackend.Close()
+
+	db.UpdateChannel(&database.Channel{ID: 1, Name: "test-chan", BaseURL: mockBackend.URL, APIKey: "sk-test", Weight: 10, Enabled: true})
+
+	var observers []*recordingObserver
+	handler.AddStreamObserver(func(info StreamInfo) StreamObserver {
+		o := &recordingObserver{info: info}
+		observers = append(observers, o)
+		return o
+	})
+
+	body, _ := json.Marshal(ChatCompletionRequest{
+		Model:    "gpt-3.5-turbo",
+		Messages: []ChatCompletionMessage{{Role: "user", Content: "test"}},
+		Stream:   true,
+	})
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBuffer(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("user_id", int64(1))
+	handler.ChatCompletions(c)
+
+	if len(observers) != 1 {
+		t.Fatalf("Expected one observer, got %d", len(observers))
+	}
+	o := observers[0]
+	if o.info != (StreamInfo{UserID: 1, Model: "gpt-3.5-turbo", Channel: "test-chan", ChannelID: 1, BackendModel: "gpt-3.5-turbo"}) {
+		t.Errorf("Unexpected stream info %+v", o.info)
+	}
+	if len(o.events) != 2 || o.events[1] != "[DONE]" || !o.ended {
+		t.Errorf("Expected the chunk and [DONE], got %q (ended=%v)", o.events, o.ended)
+	}
+}
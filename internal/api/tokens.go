@@ -0,0 +1,67 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/X0Ken/openai-gateway/internal/tokenizer"
+	"github.com/gin-gonic/gin"
+)
+
+// EstimatedTokensHeader reports the gateway's prompt token estimate on chat responses
+const EstimatedTokensHeader = "X-Gateway-Estimated-Tokens"
+
+// TokenCountRequest represents a token count request. Either messages or
+// input may be given; both are counted when present.
+type TokenCountRequest struct {
+	Model    string                  `json:"model" binding:"required"`
+	Messages []ChatCompletionMessage `json:"messages"`
+	Input    string                  `json:"input"`
+}
+
+// TokenCountResponse represents a token count estimate
+type TokenCountResponse struct {
+	Model        string `json:"model"`
+	Encoding     string `json:"encoding"`
+	PromptTokens int    `json:"prompt_tokens"`
+	Estimated    bool   `json:"estimated"`
+}
+
+// estimatePromptTokens estimates the prompt tokens of chat messages for a model
+func estimatePromptTokens(model string, messages []ChatCompletionMessage) int {
+	msgs := make([]tokenizer.Message, len(messages))
+	for i, m := range messages {
+		msgs[i] = tokenizer.Message{Role: m.Role, Content: m.Content}
+	}
+	return tokenizer.ForModel(model).CountMessages(msgs)
+}
+
+// TokenCount handles prompt token estimation
+func (h *Handler) TokenCount(c *gin.Context) {
+	var req TokenCountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	encoding := tokenizer.ForModel(req.Model)
+	tokens := 0
+	if len(req.Messages) > 0 {
+		tokens += estimatePromptTokens(req.Model, req.Messages)
+	}
+	if req.Input != "" {
+		tokens += encoding.Count(req.Input)
+	}
+
+	c.JSON(http.StatusOK, TokenCountResponse{
+		Model:        req.Model,
+		Encoding:     encoding.Name,
+		PromptTokens: tokens,
+		Estimated:    true,
+	})
+}
+
+// setEstimatedTokens sets the estimated tokens header on a chat response
+func setEstimatedTokens(c *gin.Context, req *ChatCompletionRequest) {
+	c.Header(EstimatedTokensHeader, strconv.Itoa(estimatePromptTokens(req.Model, req.Messages)))
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+func TestTokenCount(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler, _, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	body := `{"model": "gpt-4o", "messages": [{"role": "user", "content": "Hello, how are you today?"}]}`
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/v1/token-count", bytes.NewBufferString(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	handler.TokenCount(c)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp TokenCountResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Encoding != "o200k_base" || !resp.Estimated {
+		t.Errorf("Unexpected response: %+v", resp)
+	}
+	if resp.PromptTokens < 10 || resp.PromptTokens > 20 {
+		t.Errorf("Expected roughly 14 prompt tokens, got %d", resp.PromptTokens)
+	}
+}
+
+func TestChatCompletionsSetsEstimatedTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler, db, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"test","object":"chat.completion","choices":[]}`))
+	}))
+	defer mockBackend.Close()
+
+	db.UpdateChannel(&database.Channel{ID: 1, Name: "test-chan", BaseURL: mockBackend.URL, APIKey: "sk-test", Weight: 10, Enabled: true})
+
+	req := ChatCompletionRequest{
+		Model:    "gpt-3.5-turbo",
+		Messages: []ChatCompletionMessage{{Role: "user", Content: "Hello!"}},
+	}
+	jsonBody, _ := json.Marshal(req)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBuffer(jsonBody))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("user_id", int64(1))
+	handler.ChatCompletions(c)
+
+	want := strconv.Itoa(estimatePromptTokens(req.Model, req.Messages))
+	if got := w.Header().Get(EstimatedTokensHeader); got != want {
+		t.Errorf("Expected %s %s, got %q", EstimatedTokensHeader, want, got)
+	}
+}
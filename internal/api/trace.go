@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+
+	"github.com/X0Ken/openai-gateway/internal/channel"
+	"github.com/gin-gonic/gin"
+)
+
+// Tracing headers
+const (
+	// RequestIDHeader carries the gateway's correlation ID. A client-supplied
+	// value is kept; otherwise one is generated. It is echoed in the response.
+	RequestIDHeader = "X-Request-Id"
+	// TraceparentHeader is the W3C Trace Context header
+	TraceparentHeader = "traceparent"
+	// ClientRequestIDHeader forwards the correlation ID to OpenAI-compatible
+	// backends, which record it alongside their own request ID
+	ClientRequestIDHeader = "X-Client-Request-Id"
+)
+
+// upstreamRequestIDHeaders are the response headers backends report their
+// own request ID in, in order of preference
+var upstreamRequestIDHeaders = []string{"X-Request-Id", "Request-Id", "Apim-Request-Id"}
+
+// maxRequestIDLen bounds client-supplied request IDs, which are logged and
+// forwarded upstream
+const maxRequestIDLen = 128
+
+// requestIDPattern restricts client-supplied request IDs to printable,
+// header-safe characters
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9_.:\-]+$`)
+
+// traceparentPattern matches a version 00 traceparent header
+var traceparentPattern = regexp.MustCompile(`^00-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})$`)
+
+// Trace identifies a request across the client, the gateway and the backend
+type Trace struct {
+	RequestID string
+	TraceID   string
+	// Flags are the W3C trace flags, such as "01" when sampled
+	Flags string
+}
+
+// traceContextKey is the context key holding the request's Trace
+type traceContextKey struct{}
+
+// Tracing returns a middleware that assigns each request a Trace, continuing
+// the client's traceparent and request ID when they are valid
+func Tracing() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		trace := newTrace(c.Request.Header)
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), traceContextKey{}, trace))
+		c.Header(RequestIDHeader, trace.RequestID)
+		c.Next()
+	}
+}
+
+// newTrace builds the Trace of an incoming request from its headers
+func newTrace(header http.Header) *Trace {
+	trace := &Trace{RequestID: header.Get(RequestIDHeader), Flags: "00"}
+	if len(trace.RequestID) > maxRequestIDLen || !requestIDPattern.MatchString(trace.RequestID) {
+		trace.RequestID = randomHex(16)
+	}
+
+	// An all-zero trace ID is invalid and restarts the trace
+	if m := traceparentPattern.FindStringSubmatch(header.Get(TraceparentHeader)); m != nil && m[1] != zeroTraceID {
+		trace.TraceID = m[1]
+		trace.Flags = m[3]
+	} else {
+		trace.TraceID = randomHex(16)
+	}
+	return trace
+}
+
+// zeroTraceID is the invalid all-zero trace ID
+const zeroTraceID = "00000000000000000000000000000000"
+
+// traceFrom returns the Trace stored in ctx, or nil when the request was not
+// traced
+func traceFrom(ctx context.Context) *Trace {
+	trace, _ := ctx.Value(traceContextKey{}).(*Trace)
+	return trace
+}
+
+// upstreamContext returns the context for backend calls made on behalf of the
+// request. It carries the request's trace but not its cancellation, so
+// backend calls run to completion even if the client goes away.
+func upstreamContext(c *gin.Context) context.Context {
+	return context.WithoutCancel(c.Request.Context())
+}
+
+// streamContext returns the context for a streamed backend call. Unlike
+// upstreamContext it is cancelled when the client disconnects, as nobody is
+// left to read the rest of the stream, and the upstream timeout does not
+// limit how long the stream is read.
+func streamContext(c *gin.Context) context.Context {
+	return channel.Streaming(c.Request.Context())
+}
+
+// setTraceHeaders propagates the trace to a backend request. Each backend
+// call is a new span with its own parent ID.
+func setTraceHeaders(req *http.Request, trace *Trace) {
+	if trace == nil {
+		return
+	}
+	req.Header.Set(TraceparentHeader, "00-"+trace.TraceID+"-"+randomHex(8)+"-"+trace.Flags)
+	req.Header.Set(ClientRequestIDHeader, trace.RequestID)
+}
+
+// upstreamRequestID returns the backend's own ID for a response, if reported
+func upstreamRequestID(header http.Header) string {
+	for _, name := range upstreamRequestIDHeaders {
+		if id := header.Get(name); id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// randomHex returns n random bytes encoded as hex
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
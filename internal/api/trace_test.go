@@ -0,0 +1,105 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+func TestNewTrace(t *testing.T) {
+	header := http.Header{}
+	header.Set(RequestIDHeader, "client-req-1")
+	header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	trace := newTrace(header)
+	if trace.RequestID != "client-req-1" {
+		t.Errorf("Expected client request ID to be kept, got %q", trace.RequestID)
+	}
+	if trace.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || trace.Flags != "01" {
+		t.Errorf("Expected client trace to be continued, got %+v", trace)
+	}
+
+	header.Set(RequestIDHeader, "bad id\n")
+	header.Set(TraceparentHeader, "00-"+zeroTraceID+"-00f067aa0ba902b7-01")
+	trace = newTrace(header)
+	if len(trace.RequestID) != 32 || trace.RequestID == "bad id\n" {
+		t.Errorf("Expected a generated request ID, got %q", trace.RequestID)
+	}
+	if len(trace.TraceID) != 32 || trace.TraceID == zeroTraceID || trace.Flags != "00" {
+		t.Errorf("Expected a new trace, got %+v", trace)
+	}
+}
+
+func TestTracePropagatesUpstream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler, db, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	var upstreamHeader http.Header
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamHeader = r.Header.Clone()
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Request-Id", "req_upstream123")
+		w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-3.5-turbo","choices":[{"index":0,"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`))
+	}))
+	defer mockBackend.Close()
+
+	db.UpdateChannel(&database.Channel{ID: 1, Name: "test-chan", BaseURL: mockBackend.URL, APIKey: "sk-test", Weight: 10, Enabled: true})
+
+	r := gin.New()
+	r.POST("/v1/chat/completions", Tracing(), func(c *gin.Context) {
+		c.Set("user_id", int64(1))
+		handler.ChatCompletions(c)
+	})
+
+	body, _ := json.Marshal(ChatCompletionRequest{
+		Model:    "gpt-3.5-turbo",
+		Messages: []ChatCompletionMessage{{Role: "user", Content: "test"}},
+	})
+	req := httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(RequestIDHeader, "client-req-1")
+	req.Header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get(RequestIDHeader); got != "client-req-1" {
+		t.Errorf("Expected request ID to be echoed, got %q", got)
+	}
+	if got := upstreamHeader.Get(ClientRequestIDHeader); got != "client-req-1" {
+		t.Errorf("Expected request ID to be forwarded, got %q", got)
+	}
+
+	traceparent := upstreamHeader.Get(TraceparentHeader)
+	m := traceparentPattern.FindStringSubmatch(traceparent)
+	if m == nil || m[1] != "4bf92f3577b34da6a3ce929d0e0e4736" || m[3] != "01" {
+		t.Errorf("Expected the client trace to be forwarded, got %q", traceparent)
+	}
+	if strings.Contains(traceparent, "00f067aa0ba902b7") {
+		t.Errorf("Expected a new parent ID for the upstream call, got %q", traceparent)
+	}
+}
+
+func TestUpstreamRequestID(t *testing.T) {
+	header := http.Header{}
+	if id := upstreamRequestID(header); id != "" {
+		t.Errorf("Expected no upstream request ID, got %q", id)
+	}
+	header.Set("Request-Id", "req_anthropic")
+	if id := upstreamRequestID(header); id != "req_anthropic" {
+		t.Errorf("Expected request-id fallback, got %q", id)
+	}
+	header.Set("X-Request-Id", "req_openai")
+	if id := upstreamRequestID(header); id != "req_openai" {
+		t.Errorf("Expected x-request-id to be preferred, got %q", id)
+	}
+}
@@ -0,0 +1,426 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+// ChatCompletionChunk represents a streamed chat completion chunk
+type ChatCompletionChunk struct {
+	ID                string        `json:"id"`
+	Object            string        `json:"object"`
+	Created           int64         `json:"created"`
+	Model             string        `json:"model"`
+	SystemFingerprint string        `json:"system_fingerprint,omitempty"`
+	Choices           []ChunkChoice `json:"choices"`
+	Usage             *Usage        `json:"usage,omitempty"`
+	Extra             extraFields   `json:"-"`
+}
+
+// ChunkChoice represents a choice delta in a streamed chunk
+type ChunkChoice struct {
+	Index        int                   `json:"index"`
+	Delta        ChatCompletionMessage `json:"delta"`
+	Logprobs     json.RawMessage       `json:"logprobs,omitempty"`
+	FinishReason *string               `json:"finish_reason"`
+	Extra        extraFields           `json:"-"`
+}
+
+// forwardTranscodedStream serves a streaming client from a backend that does
+// not support streaming: the request is sent non-streaming and the complete
+// response is replayed to the client as a single SSE chunk followed by [DONE]
+func (h *Handler) forwardTranscodedStream(c *gin.Context, ch *database.Channel, backendModelName string, req *ChatCompletionRequest) error {
+	nonStreamReq := *req
+	nonStreamReq.Stream = false
+	// Backends reject stream_options on requests that do not stream
+	nonStreamReq.StreamOptions = nil
+
+	resp, err := h.forwardRequest(upstreamContext(c), ch, backendModelName, &nonStreamReq)
+	if err != nil {
+		return err
+	}
+
+	return writeSyntheticStream(c, resp, h.newStreamObservers(c, ch, backendModelName, req))
+}
+
+// writeSyntheticStream writes a complete response as an SSE stream, feeding
+// it to observers like a streamed backend response
+func writeSyntheticStream(c *gin.Context, resp *ChatCompletionResponse, observers []StreamObserver) error {
+	chunk := ChatCompletionChunk{
+		ID:                resp.ID,
+		Object:            "chat.completion.chunk",
+		Created:           resp.Created,
+		Model:             resp.Model,
+		SystemFingerprint: resp.SystemFingerprint,
+		Usage:             &resp.Usage,
+		Extra:             resp.Extra,
+	}
+	for _, choice := range resp.Choices {
+		finishReason := choice.FinishReason
+		if finishReason == "" {
+			finishReason = "stop"
+		}
+		chunk.Choices = append(chunk.Choices, ChunkChoice{
+			Index:        choice.Index,
+			Delta:        choice.Message,
+			Logprobs:     choice.Logprobs,
+			FinishReason: &finishReason,
+			Extra:        choice.Extra,
+		})
+	}
+
+	data, err := json.Marshal(chunk)
+	if err != nil {
+		return err
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+
+	w := io.Writer(c.Writer)
+	tee := newStreamTee(c.Writer, observers)
+	if tee != nil {
+		w = tee
+	}
+
+	fmt.Fprintf(w, "data: %s\n\n", data)
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	c.Writer.Flush()
+
+	if tee != nil {
+		tee.close(nil)
+	}
+
+	return nil
+}
+
+// forwardAggregatedRequest serves a non-streaming client from a backend that
+// is only reliable in stream mode: the request is sent streaming with usage
+// reporting enabled and the chunks are assembled into a complete response
+func (h *Handler) forwardAggregatedRequest(ctx context.Context, ch *database.Channel, backendModelName string, req *ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	forwardReq := *req
+	forwardReq.Model = backendModelName
+	forwardReq.Stream = true
+	forwardReq.StreamOptions = &StreamOptions{IncludeUsage: true}
+
+	resp, err := h.sendChatRequest(ctx, ch, &forwardReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return aggregateStream(resp.Body)
+}
+
+// aggregateStream assembles SSE chat completion chunks into a complete
+// response. A stream that breaks or ends without [DONE] or a finish reason
+// is a brokenStreamError, and an error event is returned as an
+// UpstreamError, as streamGuard does for streaming clients.
+func aggregateStream(body io.Reader) (*ChatCompletionResponse, error) {
+	result := &ChatCompletionResponse{Object: "chat.completion"}
+	choices := make(map[int]*Choice)
+	messages := make(map[int]*messageAccumulator)
+	var order []int
+	var complete bool
+
+	reader := bufio.NewReader(body)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, &brokenStreamError{err: err}
+		}
+
+		data, ok := strings.CutPrefix(strings.TrimSpace(line), "data:")
+		data = strings.TrimSpace(data)
+		if ok && data == "[DONE]" {
+			complete = true
+		}
+		if ok && data != "" && data != "[DONE]" {
+			var chunk ChatCompletionChunk
+			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+				return nil, &brokenStreamError{err: fmt.Errorf("invalid stream chunk: %w", err)}
+			}
+			if _, failed := chunk.Extra["error"]; failed {
+				return nil, &UpstreamError{StatusCode: http.StatusBadGateway, ContentType: "application/json", Body: []byte(data)}
+			}
+
+			if result.ID == "" {
+				result.ID = chunk.ID
+				result.Created = chunk.Created
+				result.Model = chunk.Model
+				result.SystemFingerprint = chunk.SystemFingerprint
+				result.Extra = chunk.Extra
+			}
+			if chunk.Usage != nil {
+				result.Usage = *chunk.Usage
+			}
+
+			for _, delta := range chunk.Choices {
+				choice, exists := choices[delta.Index]
+				if !exists {
+					choice = &Choice{Index: delta.Index}
+					choices[delta.Index] = choice
+					messages[delta.Index] = &messageAccumulator{}
+					order = append(order, delta.Index)
+				}
+				if delta.Delta.Role != "" {
+					choice.Message.Role = delta.Delta.Role
+				}
+				choice.Message.Content += delta.Delta.Content
+				if err := messages[delta.Index].add(delta.Delta.Extra); err != nil {
+					return nil, fmt.Errorf("invalid stream delta: %w", err)
+				}
+				if delta.Logprobs != nil {
+					logprobs, mergeErr := mergeLogprobs(choice.Logprobs, delta.Logprobs)
+					if mergeErr != nil {
+						return nil, fmt.Errorf("invalid stream logprobs: %w", mergeErr)
+					}
+					choice.Logprobs = logprobs
+				}
+				for name, value := range delta.Extra {
+					if choice.Extra == nil {
+						choice.Extra = make(extraFields)
+					}
+					choice.Extra[name] = value
+				}
+				if delta.FinishReason != nil {
+					choice.FinishReason = *delta.FinishReason
+					complete = complete || *delta.FinishReason != ""
+				}
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	if result.ID == "" {
+		return nil, fmt.Errorf("backend stream contained no chunks")
+	}
+	if !complete {
+		return nil, &brokenStreamError{err: errStreamIncomplete}
+	}
+
+	for _, index := range order {
+		choice := choices[index]
+		if err := messages[index].finish(&choice.Message); err != nil {
+			return nil, err
+		}
+		result.Choices = append(result.Choices, *choice)
+	}
+
+	return result, nil
+}
+
+// mergeLogprobs appends the token entries of a streamed logprobs delta to
+// those accumulated so far
+func mergeLogprobs(acc, delta json.RawMessage) (json.RawMessage, error) {
+	if string(delta) == "null" {
+		return acc, nil
+	}
+	if acc == nil {
+		return delta, nil
+	}
+
+	var merged, next map[string][]json.RawMessage
+	if err := json.Unmarshal(acc, &merged); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(delta, &next); err != nil {
+		return nil, err
+	}
+	for key, entries := range next {
+		merged[key] = append(merged[key], entries...)
+	}
+	return json.Marshal(merged)
+}
+
+// messageAccumulator assembles the message members of a streamed choice that
+// ChatCompletionMessage keeps in Extra. Tool calls arrive in pieces keyed by
+// index, their arguments split across chunks, and refusals arrive like
+// content. Other members take their last value.
+type messageAccumulator struct {
+	toolCalls  []*toolCallAccumulator
+	refusal    strings.Builder
+	hasRefusal bool
+	extra      extraFields
+}
+
+// toolCallAccumulator assembles one streamed tool call
+type toolCallAccumulator struct {
+	index     int
+	id        string
+	typ       string
+	name      string
+	arguments strings.Builder
+	// extra and functionExtra hold unknown members of the call and its function
+	extra         extraFields
+	functionExtra extraFields
+}
+
+// add merges the extra members of a message delta
+func (m *messageAccumulator) add(extra extraFields) error {
+	for name, value := range extra {
+		switch name {
+		case "tool_calls":
+			var calls []extraFields
+			if err := json.Unmarshal(value, &calls); err != nil {
+				return fmt.Errorf("tool_calls: %w", err)
+			}
+			for i, call := range calls {
+				if err := m.addToolCall(i, call); err != nil {
+					return err
+				}
+			}
+		case "refusal":
+			var refusal *string
+			if err := json.Unmarshal(value, &refusal); err != nil {
+				return fmt.Errorf("refusal: %w", err)
+			}
+			if refusal != nil {
+				m.refusal.WriteString(*refusal)
+				m.hasRefusal = true
+			}
+		default:
+			if m.extra == nil {
+				m.extra = make(extraFields)
+			}
+			m.extra[name] = value
+		}
+	}
+	return nil
+}
+
+// addToolCall merges a tool call delta into the call with the same index,
+// taken from its position when the backend sends none
+func (m *messageAccumulator) addToolCall(position int, delta extraFields) error {
+	index := position
+	if raw, ok := delta["index"]; ok {
+		if err := json.Unmarshal(raw, &index); err != nil {
+			return fmt.Errorf("tool call index: %w", err)
+		}
+	}
+
+	var call *toolCallAccumulator
+	for _, c := range m.toolCalls {
+		if c.index == index {
+			call = c
+			break
+		}
+	}
+	if call == nil {
+		call = &toolCallAccumulator{index: index}
+		m.toolCalls = append(m.toolCalls, call)
+	}
+
+	for name, value := range delta {
+		var err error
+		switch name {
+		case "index":
+		case "id":
+			err = firstString(&call.id, value)
+		case "type":
+			err = firstString(&call.typ, value)
+		case "function":
+			var function extraFields
+			if err = json.Unmarshal(value, &function); err != nil {
+				break
+			}
+			for fname, fvalue := range function {
+				switch fname {
+				case "name":
+					err = firstString(&call.name, fvalue)
+				case "arguments":
+					var arguments string
+					err = json.Unmarshal(fvalue, &arguments)
+					call.arguments.WriteString(arguments)
+				default:
+					if call.functionExtra == nil {
+						call.functionExtra = make(extraFields)
+					}
+					call.functionExtra[fname] = fvalue
+				}
+				if err != nil {
+					break
+				}
+			}
+		default:
+			if call.extra == nil {
+				call.extra = make(extraFields)
+			}
+			call.extra[name] = value
+		}
+		if err != nil {
+			return fmt.Errorf("tool call %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// firstString sets *dst from a JSON string unless it is already set
+func firstString(dst *string, value json.RawMessage) error {
+	if *dst != "" {
+		return nil
+	}
+	return json.Unmarshal(value, dst)
+}
+
+// finish stores the assembled members in the message. A message carrying
+// tool calls without content keeps a null content, as a backend would send.
+func (m *messageAccumulator) finish(msg *ChatCompletionMessage) error {
+	if len(m.toolCalls) == 0 && !m.hasRefusal && len(m.extra) == 0 {
+		return nil
+	}
+	if msg.Extra == nil {
+		msg.Extra = make(extraFields)
+	}
+	for name, value := range m.extra {
+		msg.Extra[name] = value
+	}
+	if m.hasRefusal {
+		refusal, err := json.Marshal(m.refusal.String())
+		if err != nil {
+			return err
+		}
+		msg.Extra["refusal"] = refusal
+	}
+
+	if len(m.toolCalls) > 0 {
+		calls := make([]json.RawMessage, len(m.toolCalls))
+		for i, call := range m.toolCalls {
+			function, err := marshalWithExtra(struct {
+				Name      string `json:"name,omitempty"`
+				Arguments string `json:"arguments"`
+			}{call.name, call.arguments.String()}, call.functionExtra)
+			if err != nil {
+				return err
+			}
+			if calls[i], err = marshalWithExtra(struct {
+				ID       string          `json:"id,omitempty"`
+				Type     string          `json:"type,omitempty"`
+				Function json.RawMessage `json:"function"`
+			}{call.id, call.typ, function}, call.extra); err != nil {
+				return err
+			}
+		}
+		toolCalls, err := json.Marshal(calls)
+		if err != nil {
+			return err
+		}
+		msg.Extra["tool_calls"] = toolCalls
+		if msg.Content == "" {
+			msg.nullContent = true
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"strconv"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+// Truncation headers. TruncateHeader opts a request in or out of truncation,
+// overriding the model's setting; TruncatedHeader reports how many messages
+// were dropped.
+const (
+	TruncateHeader  = "X-Gateway-Truncate"
+	TruncatedHeader = "X-Gateway-Truncated-Messages"
+)
+
+// truncationEnabled reports whether a request should be truncated to fit the
+// model's context window
+func truncationEnabled(c *gin.Context, model *database.Model) bool {
+	if model == nil || model.ContextWindow <= 0 {
+		return false
+	}
+	if enabled, err := strconv.ParseBool(c.GetHeader(TruncateHeader)); err == nil {
+		return enabled
+	}
+	return model.Truncate
+}
+
+// truncateMessages drops the oldest messages until the estimated prompt fits
+// within limit tokens. System messages and the final message are always kept,
+// so the result may still exceed the limit. It returns the remaining messages
+// and the number dropped.
+func truncateMessages(model string, messages []ChatCompletionMessage, limit int) ([]ChatCompletionMessage, int) {
+	kept := messages
+	dropped := 0
+	for estimatePromptTokens(model, kept) > limit {
+		i := oldestDroppable(kept)
+		if i < 0 {
+			break
+		}
+		next := make([]ChatCompletionMessage, 0, len(kept)-1)
+		next = append(next, kept[:i]...)
+		kept = append(next, kept[i+1:]...)
+		dropped++
+	}
+	return kept, dropped
+}
+
+// oldestDroppable returns the index of the oldest message that is neither a
+// system message nor the final message, or -1 if there is none
+func oldestDroppable(messages []ChatCompletionMessage) int {
+	for i := 0; i < len(messages)-1; i++ {
+		if messages[i].Role != "system" {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+func TestTruncateMessagesKeepsSystemAndLatest(t *testing.T) {
+	long := strings.Repeat("lorem ipsum dolor sit amet ", 20)
+	messages := []ChatCompletionMessage{
+		{Role: "system", Content: "You are helpful."},
+		{Role: "user", Content: long},
+		{Role: "assistant", Content: long},
+		{Role: "user", Content: "And now?"},
+	}
+
+	limit := estimatePromptTokens("gpt-4", []ChatCompletionMessage{messages[0], messages[3]}) + 5
+	kept, dropped := truncateMessages("gpt-4", messages, limit)
+	if dropped != 2 {
+		t.Fatalf("Expected 2 dropped messages, got %d", dropped)
+	}
+	if len(kept) != 2 || kept[0].Role != "system" || kept[1].Content != "And now?" {
+		t.Errorf("Expected system and latest message to be kept, got %+v", kept)
+	}
+	if len(messages) != 4 {
+		t.Error("Expected the input slice to be left unchanged")
+	}
+
+	// Nothing is dropped when the conversation already fits
+	if _, dropped := truncateMessages("gpt-4", messages, 100000); dropped != 0 {
+		t.Errorf("Expected no truncation, got %d dropped", dropped)
+	}
+
+	// The final message is kept even if it alone exceeds the limit
+	kept, _ = truncateMessages("gpt-4", messages, 1)
+	if len(kept) != 2 {
+		t.Errorf("Expected system and final message to remain, got %d messages", len(kept))
+	}
+}
+
+func TestChatCompletionsTruncatesWhenOptedIn(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler, db, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	var received ChatCompletionRequest
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"test","object":"chat.completion","choices":[]}`))
+	}))
+	defer mockBackend.Close()
+
+	db.UpdateChannel(&database.Channel{ID: 1, Name: "test-chan", BaseURL: mockBackend.URL, APIKey: "sk-test", Weight: 10, Enabled: true})
+	model, _ := db.GetModelByName("gpt-3.5-turbo")
+	model.ContextWindow = 50
+	db.UpdateModel(model)
+
+	long := strings.Repeat("lorem ipsum dolor sit amet ", 20)
+	send := func(header string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(ChatCompletionRequest{
+			Model: "gpt-3.5-turbo",
+			Messages: []ChatCompletionMessage{
+				{Role: "system", Content: "Be brief."},
+				{Role: "user", Content: long},
+				{Role: "user", Content: "Hi"},
+			},
+		})
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBuffer(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		if header != "" {
+			c.Request.Header.Set(TruncateHeader, header)
+		}
+		c.Set("user_id", int64(1))
+		handler.ChatCompletions(c)
+		return w
+	}
+
+	// The model does not opt in, so messages are forwarded unchanged
+	send("")
+	if len(received.Messages) != 3 {
+		t.Errorf("Expected 3 forwarded messages, got %d", len(received.Messages))
+	}
+
+	w := send("true")
+	if len(received.Messages) != 2 {
+		t.Errorf("Expected 2 forwarded messages after truncation, got %d", len(received.Messages))
+	}
+	if got := w.Header().Get(TruncatedHeader); got != "1" {
+		t.Errorf("Expected %s 1, got %q", TruncatedHeader, got)
+	}
+}
@@ -0,0 +1,280 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/internal/alert"
+	"github.com/X0Ken/openai-gateway/internal/channel"
+	"github.com/X0Ken/openai-gateway/internal/metrics"
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+// authFailureThreshold is the number of consecutive 401/403 responses after
+// which a channel is marked auth_failed
+const authFailureThreshold = 3
+
+// Rate limit penalty bounds, used when the backend's Retry-After is missing
+// or implausibly long
+const (
+	defaultRateLimitPenalty = 30 * time.Second
+	maxRateLimitPenalty     = 10 * time.Minute
+)
+
+// UpstreamError is returned when the backend answers with a non-200 status
+type UpstreamError struct {
+	StatusCode  int
+	ContentType string
+	RetryAfter  string
+	Body        []byte
+}
+
+func (e *UpstreamError) Error() string {
+	return fmt.Sprintf("backend error: %s", string(e.Body))
+}
+
+// unsupportedError returns the error for a request the channel's API
+// cannot express. It is answered as a client error, since another request
+// could succeed on the same channel.
+func unsupportedError(err error) *UpstreamError {
+	body, _ := json.Marshal(gin.H{"error": gin.H{"message": err.Error(), "type": "invalid_request_error", "param": nil, "code": nil}})
+	return &UpstreamError{StatusCode: http.StatusBadRequest, ContentType: "application/json", Body: body}
+}
+
+// isAuthFailure reports whether err is a 401 or 403 from the backend
+func isAuthFailure(err error) bool {
+	var upstreamErr *UpstreamError
+	if !errors.As(err, &upstreamErr) {
+		return false
+	}
+	return upstreamErr.StatusCode == http.StatusUnauthorized || upstreamErr.StatusCode == http.StatusForbidden
+}
+
+// passthroughStatuses are upstream client errors returned to the caller
+// unchanged: they describe a problem with the request, not the channel
+var passthroughStatuses = map[int]bool{
+	http.StatusBadRequest:          true,
+	http.StatusNotFound:            true,
+	http.StatusUnprocessableEntity: true,
+	http.StatusTooManyRequests:     true,
+}
+
+// isChannelFailure reports whether err should count against the channel.
+// Only 5xx responses and transport errors such as timeouts do; any other
+// upstream status means the backend itself is working.
+func isChannelFailure(err error) bool {
+	var upstreamErr *UpstreamError
+	if errors.As(err, &upstreamErr) {
+		return upstreamErr.StatusCode >= http.StatusInternalServerError
+	}
+	return true
+}
+
+// retryAfterDuration parses a Retry-After header given in seconds or as an
+// HTTP date, falling back to defaultRateLimitPenalty
+func retryAfterDuration(value string, now time.Time) time.Duration {
+	d := defaultRateLimitPenalty
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		d = time.Duration(seconds) * time.Second
+	} else if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		d = t.Sub(now)
+	}
+	return min(d, maxRateLimitPenalty)
+}
+
+// retryDelay returns how long to wait before retrying a failed attempt on
+// the channel, and whether to retry it at all. Transport errors and the
+// policy's retryable statuses are retried. A Retry-After longer than the
+// policy's MaxDelay ends the retries, unless a rate limited request can move
+// to another of the channel's keys.
+func (h *Handler) retryDelay(ctx context.Context, ch *database.Channel, policy channel.RetryPolicy, attempt int, err error) (time.Duration, bool) {
+	if ctx.Err() != nil {
+		return 0, false
+	}
+	delay := policy.Delay(attempt)
+
+	var upstreamErr *UpstreamError
+	if !errors.As(err, &upstreamErr) {
+		var urlErr *url.Error
+		return delay, errors.As(err, &urlErr)
+	}
+	if !policy.Retryable(upstreamErr.StatusCode) {
+		return 0, false
+	}
+	if upstreamErr.RetryAfter == "" {
+		return delay, true
+	}
+	now := time.Now()
+	if upstreamErr.StatusCode == http.StatusTooManyRequests && h.keys.Available(ch, now) > 0 {
+		return delay, true
+	}
+	if wait := retryAfterDuration(upstreamErr.RetryAfter, now); wait > delay {
+		return wait, wait <= policy.MaxDelay
+	}
+	return delay, true
+}
+
+// Rate limit headers reported by OpenAI-compatible backends
+const (
+	headerRemainingRequests = "X-Ratelimit-Remaining-Requests"
+	headerRemainingTokens   = "X-Ratelimit-Remaining-Tokens"
+	headerResetRequests     = "X-Ratelimit-Reset-Requests"
+	headerResetTokens       = "X-Ratelimit-Reset-Tokens"
+)
+
+// parseRateLimit reads the remaining quota from a backend response's rate
+// limit headers, preferring the request limit over the token limit
+func parseRateLimit(header http.Header) (channel.RateLimit, bool) {
+	for _, names := range [][2]string{
+		{headerRemainingRequests, headerResetRequests},
+		{headerRemainingTokens, headerResetTokens},
+	} {
+		remaining, err := strconv.ParseInt(header.Get(names[0]), 10, 64)
+		if err != nil {
+			continue
+		}
+		// Resets are durations such as "1s" or "6m0s"
+		reset, _ := time.ParseDuration(header.Get(names[1]))
+		return channel.RateLimit{Remaining: remaining, Reset: reset}, true
+	}
+	return channel.RateLimit{}, false
+}
+
+// observeKey records the quota a backend reported for the key a request
+// used, and cools the key down until Retry-After when it was rate limited
+func (h *Handler) observeKey(ch *database.Channel, apiKey string, resp *http.Response, now time.Time) {
+	if limit, ok := parseRateLimit(resp.Header); ok {
+		h.keys.Observe(ch.ID, apiKey, limit, now)
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		h.keys.Cooldown(ch.ID, apiKey, now.Add(retryAfterDuration(resp.Header.Get("Retry-After"), now)))
+	}
+}
+
+// recordForwardError updates channel metrics after a failed forward. A
+// rate limited channel is penalized in routing until its Retry-After passes,
+// once none of its keys is left outside cooldown.
+func (h *Handler) recordForwardError(ch *database.Channel, duration time.Duration, err error) {
+	var upstreamErr *UpstreamError
+	if errors.As(err, &upstreamErr) && upstreamErr.StatusCode == http.StatusTooManyRequests {
+		now := time.Now()
+		if h.keys.Available(ch, now) == 0 {
+			h.router.Penalize(ch.ID, retryAfterDuration(upstreamErr.RetryAfter, now))
+		}
+	}
+
+	if !isChannelFailure(err) {
+		h.metrics.UpdateChannelMetrics(ch.ID, duration.Seconds(), true)
+		return
+	}
+	metrics.RecordChannelError(ch.Name)
+	h.metrics.UpdateChannelMetrics(ch.ID, duration.Seconds(), false)
+}
+
+// recordOutcome records a request's outcome for availability SLOs. Upstream
+// client errors passed through to the caller are the caller's fault and
+// count as successes. Streams abandoned by their client or cut off by a
+// shutdown are not counted.
+func recordOutcome(model string, err error) {
+	if errors.Is(err, errClientGone) || errors.Is(err, ErrShuttingDown) {
+		return
+	}
+	var upstreamErr *UpstreamError
+	success := err == nil || errors.As(err, &upstreamErr) && passthroughStatuses[upstreamErr.StatusCode]
+	metrics.RecordModelRequest(model, success)
+}
+
+// writeForwardError responds to the client after a failed forward, passing
+// upstream client errors through with their original status and body.
+// Requests cut off by a shutdown get 503.
+func writeForwardError(c *gin.Context, err error) {
+	if errors.Is(err, ErrShuttingDown) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	var upstreamErr *UpstreamError
+	if errors.As(err, &upstreamErr) && passthroughStatuses[upstreamErr.StatusCode] {
+		contentType := responseContentType(upstreamErr.ContentType, "application/json; charset=utf-8")
+		if upstreamErr.RetryAfter != "" {
+			c.Header("Retry-After", upstreamErr.RetryAfter)
+		}
+		c.Data(upstreamErr.StatusCode, contentType, upstreamErr.Body)
+		return
+	}
+	c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+}
+
+// authFailures counts consecutive credential rejections per channel
+type authFailures struct {
+	mu     sync.Mutex
+	counts map[int64]int
+}
+
+// observe records the outcome of a backend call and reports whether the
+// channel has just reached the auth failure threshold
+func (a *authFailures) observe(channelID int64, authFailed bool) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !authFailed {
+		delete(a.counts, channelID)
+		return false
+	}
+
+	if a.counts == nil {
+		a.counts = make(map[int64]int)
+	}
+	a.counts[channelID]++
+	if a.counts[channelID] < authFailureThreshold {
+		return false
+	}
+	delete(a.counts, channelID)
+	return true
+}
+
+// observeUpstream records the outcome of an upstream request in the
+// channel's circuit breaker. It also tracks credential rejections and marks
+// the channel auth_failed after repeated 401/403 responses, raising an alert.
+func (h *Handler) observeUpstream(ch *database.Channel, err error) {
+	h.recordBreaker(ch, err)
+	if !h.authFailures.observe(ch.ID, isAuthFailure(err)) {
+		return
+	}
+
+	if err := h.db.SetChannelStatus(ch.ID, database.ChannelStatusAuthFailed); err != nil {
+		log.Printf("Failed to mark channel %s auth_failed: %v", ch.Name, err)
+		return
+	}
+
+	h.notifier.Notify(alert.Alert{
+		Type:    alert.TypeChannelAuthFailed,
+		Subject: ch.Name,
+		Message: fmt.Sprintf("channel %s rejected its credentials %d times in a row and was removed from routing; update its API key to restore it", ch.Name, authFailureThreshold),
+		Details: map[string]any{
+			"channel_id": ch.ID,
+			"error":      err.Error(),
+		},
+	})
+}
+
+// recordBreaker counts a request in the channel's circuit breaker. Only
+// failures counted against the channel trip it; requests abandoned by their
+// client or cut off by a shutdown are left out.
+func (h *Handler) recordBreaker(ch *database.Channel, err error) {
+	if h.breakers == nil || errors.Is(err, errClientGone) || errors.Is(err, ErrShuttingDown) || errors.Is(err, context.Canceled) {
+		return
+	}
+	if err != nil && !isChannelFailure(err) {
+		err = nil
+	}
+	h.breakers.Record(ch, err)
+}
@@ -0,0 +1,341 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/internal/channel"
+	"github.com/X0Ken/openai-gateway/internal/metrics"
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRepeatedAuthFailuresMarkChannel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler, db, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error":{"message":"invalid api key"}}`))
+	}))
+	defer mockBackend.Close()
+
+	db.UpdateChannel(&database.Channel{ID: 1, Name: "test-chan", BaseURL: mockBackend.URL, APIKey: "sk-test", Weight: 10, Enabled: true})
+
+	send := func() int {
+		body, _ := json.Marshal(ChatCompletionRequest{
+			Model:    "gpt-3.5-turbo",
+			Messages: []ChatCompletionMessage{{Role: "user", Content: "test"}},
+		})
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBuffer(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Set("user_id", int64(1))
+		handler.ChatCompletions(c)
+		return w.Code
+	}
+
+	for i := 0; i < authFailureThreshold-1; i++ {
+		send()
+	}
+	ch, _ := db.GetChannel(1)
+	if ch.AuthFailed() {
+		t.Fatalf("Expected channel to stay routable before %d failures", authFailureThreshold)
+	}
+
+	send()
+	ch, _ = db.GetChannel(1)
+	if !ch.AuthFailed() {
+		t.Fatalf("Expected channel status %q, got %q", database.ChannelStatusAuthFailed, ch.Status)
+	}
+
+	// The channel is no longer routed to
+	if code := send(); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 once the only channel is auth_failed, got %d", code)
+	}
+}
+
+func TestAuthFailuresResetOnOtherOutcome(t *testing.T) {
+	var a authFailures
+	for i := 0; i < authFailureThreshold-1; i++ {
+		if a.observe(1, true) {
+			t.Fatal("Threshold reached too early")
+		}
+	}
+	a.observe(1, false)
+	for i := 0; i < authFailureThreshold-1; i++ {
+		if a.observe(1, true) {
+			t.Fatal("Expected a success to reset the consecutive count")
+		}
+	}
+	if !a.observe(1, true) {
+		t.Error("Expected threshold to be reached")
+	}
+}
+
+func TestUpstreamClientErrorsPassThrough(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler, db, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	status := http.StatusUnprocessableEntity
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(`{"error":{"message":"upstream says no"}}`))
+	}))
+	defer mockBackend.Close()
+
+	db.UpdateChannel(&database.Channel{ID: 1, Name: "test-chan", BaseURL: mockBackend.URL, APIKey: "sk-test", Weight: 10, Enabled: true})
+
+	send := func() *httptest.ResponseRecorder {
+		body, _ := json.Marshal(ChatCompletionRequest{
+			Model:    "gpt-3.5-turbo",
+			Messages: []ChatCompletionMessage{{Role: "user", Content: "test"}},
+		})
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBuffer(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Set("user_id", int64(1))
+		handler.ChatCompletions(c)
+		return w
+	}
+
+	w := send()
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected upstream status 422, got %d", w.Code)
+	}
+	if w.Body.String() != `{"error":{"message":"upstream says no"}}` {
+		t.Errorf("Expected upstream body, got %s", w.Body.String())
+	}
+
+	m, _ := db.GetChannelMetrics(1)
+	if m == nil || m.SuccessCount != m.RequestCount {
+		t.Errorf("Expected no channel penalty for a client error, got %+v", m)
+	}
+
+	status = http.StatusInternalServerError
+	if w := send(); w.Code != http.StatusBadGateway {
+		t.Errorf("Expected 502 for an upstream 5xx, got %d", w.Code)
+	}
+	m, _ = db.GetChannelMetrics(1)
+	if m == nil || m.RequestCount-m.SuccessCount != 1 {
+		t.Errorf("Expected the 5xx to count against the channel, got %+v", m)
+	}
+}
+
+func TestUpstreamRateLimitPassesThrough(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler, db, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Retry-After", "12")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error":{"message":"rate limit reached"}}`))
+	}))
+	defer mockBackend.Close()
+
+	db.UpdateChannel(&database.Channel{ID: 1, Name: "test-chan", BaseURL: mockBackend.URL, APIKey: "sk-test", Weight: 10, Enabled: true})
+
+	body, _ := json.Marshal(ChatCompletionRequest{
+		Model:    "gpt-3.5-turbo",
+		Messages: []ChatCompletionMessage{{Role: "user", Content: "test"}},
+	})
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBuffer(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("user_id", int64(1))
+	handler.ChatCompletions(c)
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429, got %d", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "12" {
+		t.Errorf("Expected Retry-After 12, got %q", got)
+	}
+	if w.Body.String() != `{"error":{"message":"rate limit reached"}}` {
+		t.Errorf("Expected upstream body, got %s", w.Body.String())
+	}
+}
+
+func TestRetryAfterDuration(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", defaultRateLimitPenalty},
+		{"5", 5 * time.Second},
+		{"86400", maxRateLimitPenalty},
+		{now.Add(time.Minute).Format(http.TimeFormat), time.Minute},
+		{"soon", defaultRateLimitPenalty},
+	}
+	for _, tt := range tests {
+		if got := retryAfterDuration(tt.value, now); got != tt.want {
+			t.Errorf("retryAfterDuration(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimitedKeyCoolsDown(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler, db, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	var keysUsed []string
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		keysUsed = append(keysUsed, key)
+		w.Header().Set("Content-Type", "application/json")
+		if key == "sk-limited" {
+			w.Header().Set("Retry-After", "60")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error":{"message":"rate limit reached"}}`))
+			return
+		}
+		w.Header().Set("X-Ratelimit-Remaining-Requests", "99")
+		w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-3.5-turbo","choices":[{"index":0,"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`))
+	}))
+	defer mockBackend.Close()
+
+	db.UpdateChannel(&database.Channel{ID: 1, Name: "test-chan", BaseURL: mockBackend.URL, APIKey: "sk-limited", APIKeys: []string{"sk-spare"}, Weight: 10, Enabled: true})
+
+	codes := make([]int, 3)
+	for i := range codes {
+		body, _ := json.Marshal(ChatCompletionRequest{
+			Model:    "gpt-3.5-turbo",
+			Messages: []ChatCompletionMessage{{Role: "user", Content: "test"}},
+		})
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBuffer(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Set("user_id", int64(1))
+		handler.ChatCompletions(c)
+		codes[i] = w.Code
+	}
+
+	want := []string{"sk-limited", "sk-spare", "sk-spare"}
+	if strings.Join(keysUsed, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected keys %v, got %v", want, keysUsed)
+	}
+	if codes[1] != http.StatusOK || codes[2] != http.StatusOK {
+		t.Errorf("Expected requests on the spare key to succeed, got %v", codes)
+	}
+}
+
+func TestRetriesOnSameChannel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler, db, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	// The backend answers with the queued statuses, then succeeds
+	var statuses []int
+	var retryAfter string
+	hits := 0
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("Content-Type", "application/json")
+		if len(statuses) > 0 {
+			status := statuses[0]
+			statuses = statuses[1:]
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(status)
+			w.Write([]byte(`{"error":{"message":"backend error"}}`))
+			return
+		}
+		w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","model":"gpt-3.5-turbo","choices":[{"index":0,"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`))
+	}))
+	defer mockBackend.Close()
+
+	ch := &database.Channel{ID: 1, Name: "test-chan", BaseURL: mockBackend.URL, APIKey: "sk-test", Weight: 10, Enabled: true}
+	db.UpdateChannel(ch)
+	policy := channel.DefaultRetryPolicy()
+	policy.MaxAttempts = 3
+	policy.InitialDelay = time.Millisecond
+	policy.MaxDelay = 10 * time.Millisecond
+	handler.channelMgr.SetRetryPolicy(policy)
+
+	send := func(queued ...int) int {
+		statuses, hits = queued, 0
+		body, _ := json.Marshal(ChatCompletionRequest{
+			Model:    "gpt-3.5-turbo",
+			Messages: []ChatCompletionMessage{{Role: "user", Content: "test"}},
+		})
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBuffer(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Set("user_id", int64(1))
+		handler.ChatCompletions(c)
+		return w.Code
+	}
+
+	retries := testutil.ToFloat64(metrics.UpstreamRetries.WithLabelValues("test-chan"))
+	if code := send(http.StatusServiceUnavailable, http.StatusBadGateway); code != http.StatusOK || hits != 3 {
+		t.Errorf("Expected success on the third attempt, got %d after %d attempts", code, hits)
+	}
+	if got := testutil.ToFloat64(metrics.UpstreamRetries.WithLabelValues("test-chan")) - retries; got != 2 {
+		t.Errorf("Expected 2 retries recorded, got %v", got)
+	}
+
+	if code := send(http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable); code != http.StatusBadGateway || hits != 3 {
+		t.Errorf("Expected 502 after 3 attempts, got %d after %d attempts", code, hits)
+	}
+
+	if code := send(http.StatusBadRequest); code != http.StatusBadRequest || hits != 1 {
+		t.Errorf("Expected a 400 not to be retried, got %d after %d attempts", code, hits)
+	}
+
+	// A Retry-After beyond the policy's max delay is not waited for
+	retryAfter = "60"
+	if code := send(http.StatusServiceUnavailable); code != http.StatusBadGateway || hits != 1 {
+		t.Errorf("Expected a long Retry-After not to be retried, got %d after %d attempts", code, hits)
+	}
+	retryAfter = ""
+
+	// The channel's override replaces the configured attempts
+	ch.RetryPolicy = &database.RetryPolicy{MaxAttempts: 1}
+	db.UpdateChannel(ch)
+	if code := send(http.StatusServiceUnavailable); code != http.StatusBadGateway || hits != 1 {
+		t.Errorf("Expected the channel's single attempt, got %d after %d attempts", code, hits)
+	}
+}
+
+func TestParseRateLimit(t *testing.T) {
+	header := http.Header{}
+	if _, ok := parseRateLimit(header); ok {
+		t.Error("Expected no rate limit without headers")
+	}
+
+	header.Set("X-Ratelimit-Remaining-Tokens", "4000")
+	if limit, ok := parseRateLimit(header); !ok || limit.Remaining != 4000 {
+		t.Errorf("Expected token limit fallback, got %+v", limit)
+	}
+
+	header.Set("X-Ratelimit-Remaining-Requests", "59")
+	header.Set("X-Ratelimit-Reset-Requests", "6m0s")
+	limit, ok := parseRateLimit(header)
+	if !ok || limit.Remaining != 59 || limit.Reset != 6*time.Minute {
+		t.Errorf("Expected request limit, got %+v", limit)
+	}
+}
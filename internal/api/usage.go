@@ -0,0 +1,186 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+
+	"github.com/X0Ken/openai-gateway/internal/metrics"
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+// usageKey is the JSON key of the usage object in a response body
+var usageKey = []byte(`"usage"`)
+
+// scanUsage extracts the top-level usage object from a completion response
+// without decoding the rest of the body. Providers put usage after the
+// choices, so the last unescaped "usage" key followed by an object is taken;
+// the same key inside message content is always escaped.
+func scanUsage(body []byte) (Usage, bool) {
+	end := len(body)
+	for {
+		i := bytes.LastIndex(body[:end], usageKey)
+		if i < 0 {
+			return Usage{}, false
+		}
+		end = i
+
+		if i > 0 && body[i-1] == '\\' {
+			continue
+		}
+		rest := bytes.TrimLeft(body[i+len(usageKey):], " \t\r\n")
+		if len(rest) == 0 || rest[0] != ':' {
+			continue
+		}
+		rest = bytes.TrimLeft(rest[1:], " \t\r\n")
+		if len(rest) == 0 || rest[0] != '{' {
+			continue
+		}
+
+		var usage Usage
+		if err := json.NewDecoder(bytes.NewReader(rest)).Decode(&usage); err != nil {
+			continue
+		}
+		return usage, true
+	}
+}
+
+// requestInfo describes a request served on a channel, for the usage log
+// and stream observers
+func requestInfo(c *gin.Context, model string, ch *database.Channel, backendModel, endUser string) StreamInfo {
+	return StreamInfo{
+		UserID:       c.GetInt64("user_id"),
+		APIKeyID:     c.GetInt64("api_key_id"),
+		EndUser:      endUser,
+		Model:        model,
+		Channel:      ch.Name,
+		ChannelID:    ch.ID,
+		BackendModel: backendModel,
+		Tags:         FormatTags(GetTags(c)),
+	}
+}
+
+// recordUsage adds a request's token usage to the usage log
+func (h *Handler) recordUsage(info StreamInfo, usage Usage) {
+	total := usage.TotalTokens
+	if total == 0 {
+		total = usage.PromptTokens + usage.CompletionTokens
+	}
+	entry := &database.UsageLog{
+		UserID:           info.UserID,
+		APIKeyID:         info.APIKeyID,
+		Model:            info.Model,
+		ChannelID:        info.ChannelID,
+		BackendModel:     info.BackendModel,
+		EndUser:          info.EndUser,
+		Tags:             info.Tags,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		TotalTokens:      total,
+	}
+	if err := h.db.CreateUsageLog(entry); err != nil {
+		log.Printf("Failed to record usage: user=%d model=%s: %v", info.UserID, info.Model, err)
+	}
+}
+
+// usageObserver records the usage chunk of a streamed response. Backends
+// only send one when the client sets stream_options.include_usage.
+type usageObserver struct {
+	h        *Handler
+	info     StreamInfo
+	usage    Usage
+	hasUsage bool
+}
+
+// newUsageObserver is the stream observer factory for the usage log
+func (h *Handler) newUsageObserver(info StreamInfo) StreamObserver {
+	return &usageObserver{h: h, info: info}
+}
+
+// ObserveEvent picks the usage out of a chunk
+func (o *usageObserver) ObserveEvent(data []byte) {
+	if usage, ok := scanUsage(data); ok {
+		o.usage, o.hasUsage = usage, true
+	}
+}
+
+// StreamEnded records the usage if it was reported. The usage chunk comes
+// last, so tokens it reports were spent even if the stream then failed.
+func (o *usageObserver) StreamEnded(err error) {
+	if o.hasUsage {
+		metrics.RecordTokens(o.info.Channel, o.info.Model, o.usage.PromptTokens, o.usage.CompletionTokens)
+		o.h.recordUsage(o.info, o.usage)
+	}
+}
+
+// usageStripper removes the usage chunk from a stream whose usage only the
+// gateway asked for, passing it to the stream's observers instead. Other
+// events reach the client unchanged, one whole event at a time.
+type usageStripper struct {
+	r         *bufio.Reader
+	observers []StreamObserver
+	event     []byte
+	out       []byte
+	err       error
+}
+
+// newUsageStripper returns a reader stripping the usage chunk from body
+func newUsageStripper(body io.Reader, observers []StreamObserver) *usageStripper {
+	return &usageStripper{r: bufio.NewReader(body), observers: observers}
+}
+
+// Read returns the next events, reading lines from the backend until an
+// event is complete
+func (s *usageStripper) Read(p []byte) (int, error) {
+	for len(s.out) == 0 && s.err == nil {
+		line, err := s.r.ReadSlice('\n')
+		s.event = append(s.event, line...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		s.err = err
+		if err != nil || len(bytes.TrimSpace(line)) == 0 {
+			s.endEvent()
+		}
+	}
+	if len(s.out) == 0 {
+		return 0, s.err
+	}
+	n := copy(p, s.out)
+	s.out = s.out[n:]
+	return n, nil
+}
+
+// endEvent queues the buffered event for the client unless it is the usage
+// chunk
+func (s *usageStripper) endEvent() {
+	event := s.event
+	s.event = s.event[:0]
+
+	data := bytes.TrimSpace(event)
+	if bytes.HasPrefix(data, []byte("data:")) {
+		data = bytes.TrimSpace(data[len("data:"):])
+		if isUsageChunk(data) {
+			for _, observer := range s.observers {
+				observer.ObserveEvent(data)
+			}
+			return
+		}
+	}
+	s.out = event
+}
+
+// isUsageChunk reports whether data is a chunk carrying only usage, which
+// has no choices
+func isUsageChunk(data []byte) bool {
+	if _, ok := scanUsage(data); !ok {
+		return false
+	}
+	var chunk struct {
+		Choices []json.RawMessage `json:"choices"`
+	}
+	return json.Unmarshal(data, &chunk) == nil && len(chunk.Choices) == 0
+}
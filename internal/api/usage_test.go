@@ -0,0 +1,208 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/X0Ken/openai-gateway/internal/metrics"
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestScanUsage(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		want  Usage
+		found bool
+	}{
+		{
+			name:  "trailing usage",
+			body:  `{"id":"x","choices":[],"usage":{"prompt_tokens":3,"completion_tokens":4,"total_tokens":7}}`,
+			want:  Usage{PromptTokens: 3, CompletionTokens: 4, TotalTokens: 7},
+			found: true,
+		},
+		{
+			name:  "usage key inside content is ignored",
+			body:  `{"usage": {"prompt_tokens": 1, "completion_tokens": 2, "total_tokens": 3}, "choices":[{"message":{"content":"the \"usage\": {\"prompt_tokens\": 99}"}}]}`,
+			want:  Usage{PromptTokens: 1, CompletionTokens: 2, TotalTokens: 3},
+			found: true,
+		},
+		{
+			name: "no usage",
+			body: `{"id":"x","choices":[]}`,
+		},
+		{
+			name: "null usage",
+			body: `{"id":"x","usage":null}`,
+		},
+	}
+	for _, tt := range tests {
+		got, found := scanUsage([]byte(tt.body))
+		if found != tt.found || got != tt.want {
+			t.Errorf("%s: scanUsage = %+v, %v; want %+v, %v", tt.name, got, found, tt.want, tt.found)
+		}
+	}
+}
+
+func TestNonStreamingResponsePassesThroughRaw(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler, db, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	upstream := `{"id":"chatcmpl-1","object":"chat.completion","system_fingerprint":"fp_1","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"logprobs":null,"finish_reason":"stop"}],"usage":{"prompt_tokens":5,"completion_tokens":2,"total_tokens":7}}`
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(upstream))
+	}))
+	defer mockBackend.Close()
+
+	db.UpdateChannel(&database.Channel{ID: 1, Name: "test-chan", BaseURL: mockBackend.URL, APIKey: "sk-test", Weight: 10, Enabled: true})
+
+	before := testutil.ToFloat64(metrics.TokensTotal.WithLabelValues("test-chan", "gpt-3.5-turbo", "completion"))
+
+	body, _ := json.Marshal(ChatCompletionRequest{
+		Model:    "gpt-3.5-turbo",
+		Messages: []ChatCompletionMessage{{Role: "user", Content: "test"}},
+	})
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBuffer(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("user_id", int64(1))
+	handler.ChatCompletions(c)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	if w.Body.String() != upstream {
+		t.Errorf("Expected the upstream body verbatim, got %s", w.Body.String())
+	}
+
+	after := testutil.ToFloat64(metrics.TokensTotal.WithLabelValues("test-chan", "gpt-3.5-turbo", "completion"))
+	if after-before != 2 {
+		t.Errorf("Expected 2 completion tokens recorded, got %v", after-before)
+	}
+}
+
+func TestChatCompletionsRecordUsageLogs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler, db, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hi\"}}],\"usage\":null}\n\n"))
+			w.Write([]byte("data: {\"choices\":[],\"usage\":{\"prompt_tokens\":30,\"completion_tokens\":20,\"total_tokens\":50}}\n\n"))
+			w.Write([]byte("data: [DONE]\n\n"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}],"usage":{"prompt_tokens":10,"completion_tokens":4,"total_tokens":14}}`))
+	}))
+	defer mockBackend.Close()
+
+	db.UpdateChannel(&database.Channel{ID: 1, Name: "test-chan", BaseURL: mockBackend.URL, APIKey: "sk-test", Weight: 10, Enabled: true})
+
+	for _, stream := range []bool{false, true} {
+		body, _ := json.Marshal(ChatCompletionRequest{
+			Model:    "gpt-3.5-turbo",
+			Messages: []ChatCompletionMessage{{Role: "user", Content: "test"}},
+			Stream:   stream,
+			User:     "customer-a",
+		})
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBuffer(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Set("user_id", int64(1))
+		handler.ChatCompletions(c)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected 200 (stream=%v), got %d", stream, w.Code)
+		}
+	}
+
+	logs, err := db.ListUsageLogs(database.UsageQuery{UserID: 1}, 10)
+	if err != nil {
+		t.Fatalf("Failed to list usage logs: %v", err)
+	}
+	if len(logs) != 2 {
+		t.Fatalf("Expected a usage log per request, got %d", len(logs))
+	}
+	streamed, plain := logs[0], logs[1]
+	if plain.TotalTokens != 14 || plain.PromptTokens != 10 || plain.ChannelID != 1 || plain.EndUser != "customer-a" {
+		t.Errorf("Unexpected usage log %+v", plain)
+	}
+	if streamed.TotalTokens != 50 || streamed.CompletionTokens != 20 || streamed.Model != "gpt-3.5-turbo" {
+		t.Errorf("Unexpected streamed usage log %+v", streamed)
+	}
+}
+
+func TestStreamUsageInjected(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler, db, cleanup := setupTestHandler(t)
+	defer cleanup()
+	handler.SetStreamUsage(true)
+
+	var requested []bool
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req ChatCompletionRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		requested = append(requested, req.StreamOptions != nil && req.StreamOptions.IncludeUsage)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hi\"}}],\"usage\":null}\n\n"))
+		w.Write([]byte("data: {\"choices\":[],\"usage\":{\"prompt_tokens\":30,\"completion_tokens\":20,\"total_tokens\":50}}\n\n"))
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer mockBackend.Close()
+
+	db.UpdateChannel(&database.Channel{ID: 1, Name: "test-chan", BaseURL: mockBackend.URL, APIKey: "sk-test", Weight: 10, Enabled: true})
+
+	for _, clientUsage := range []bool{false, true} {
+		req := ChatCompletionRequest{
+			Model:    "gpt-3.5-turbo",
+			Messages: []ChatCompletionMessage{{Role: "user", Content: "test"}},
+			Stream:   true,
+		}
+		if clientUsage {
+			req.StreamOptions = &StreamOptions{IncludeUsage: true}
+		}
+		body, _ := json.Marshal(req)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewBuffer(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Set("user_id", int64(1))
+		handler.ChatCompletions(c)
+
+		// The usage chunk only reaches clients that asked for it
+		if got := bytes.Contains(w.Body.Bytes(), []byte(`"total_tokens":50`)); got != clientUsage {
+			t.Errorf("Expected usage chunk in stream to be %v when the client asked for usage=%v: %s", clientUsage, clientUsage, w.Body.String())
+		}
+		if !bytes.Contains(w.Body.Bytes(), []byte(`"content":"Hi"`)) || !bytes.HasSuffix(w.Body.Bytes(), []byte("data: [DONE]\n\n")) {
+			t.Errorf("Expected content and [DONE] to reach the client: %s", w.Body.String())
+		}
+	}
+
+	if len(requested) != 2 || !requested[0] || !requested[1] {
+		t.Errorf("Expected usage to be requested from the backend for every stream, got %v", requested)
+	}
+	logs, err := db.ListUsageLogs(database.UsageQuery{UserID: 1}, 10)
+	if err != nil {
+		t.Fatalf("Failed to list usage logs: %v", err)
+	}
+	if len(logs) != 2 || logs[0].TotalTokens != 50 || logs[1].TotalTokens != 50 {
+		t.Errorf("Expected both streams in the usage log, got %+v", logs)
+	}
+}
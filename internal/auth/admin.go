@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireAdmin middleware ensures the request carries a valid admin token.
+// Until the first admin token is created the admin API stays open, as it
+// was before admin tokens existed.
+func (m *Middleware) RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		count, err := m.db.CountAdminTokens()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+		if count == 0 {
+			c.Next()
+			return
+		}
+
+		value := extractAPIKey(c)
+		if value == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "missing admin token"})
+			c.Abort()
+			return
+		}
+
+		token, err := m.db.GetAdminTokenByToken(value)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+		if token == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid admin token"})
+			c.Abort()
+			return
+		}
+
+		c.Set("admin_token", token)
+		c.Next()
+	}
+}
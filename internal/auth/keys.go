@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// Prefixes of credentials issued by the gateway
+const (
+	apiKeyPrefix     = "sk-gw-"
+	adminTokenPrefix = "gw-admin-"
+)
+
+// GenerateAPIKey returns a new random API key
+func GenerateAPIKey() (string, error) {
+	return generateKey(apiKeyPrefix)
+}
+
+// GenerateAdminToken returns a new random admin token
+func GenerateAdminToken() (string, error) {
+	return generateKey(adminTokenPrefix)
+}
+
+// generateKey returns a random credential with the given prefix
+func generateKey(prefix string) (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return prefix + hex.EncodeToString(buf), nil
+}
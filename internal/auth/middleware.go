@@ -3,6 +3,7 @@ package auth
 import (
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/X0Ken/openai-gateway/pkg/database"
@@ -28,7 +29,7 @@ func (m *Middleware) RequireAuth() gin.HandlerFunc {
 			return
 		}
 
-		user, err := m.db.GetUserByAPIKey(apiKey)
+		user, key, err := m.db.LookupAPIKey(apiKey)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			c.Abort()
@@ -41,9 +42,23 @@ func (m *Middleware) RequireAuth() gin.HandlerFunc {
 			return
 		}
 
+		if !key.Valid(time.Now()) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "API key is disabled or expired"})
+			c.Abort()
+			return
+		}
+
+		if !user.Enabled {
+			c.JSON(http.StatusForbidden, gin.H{"error": "user is disabled"})
+			c.Abort()
+			return
+		}
+
 		// Store user ID in context for later use
 		c.Set("user_id", user.ID)
 		c.Set("user", user)
+		c.Set("api_key_id", key.ID)
+		c.Set("api_key", key)
 		c.Next()
 	}
 }
@@ -57,15 +72,17 @@ func (m *Middleware) OptionalAuth() gin.HandlerFunc {
 			return
 		}
 
-		user, err := m.db.GetUserByAPIKey(apiKey)
+		user, key, err := m.db.LookupAPIKey(apiKey)
 		if err != nil {
 			c.Next()
 			return
 		}
 
-		if user != nil {
+		if user != nil && user.Enabled && key.Valid(time.Now()) {
 			c.Set("user_id", user.ID)
 			c.Set("user", user)
+			c.Set("api_key_id", key.ID)
+			c.Set("api_key", key)
 		}
 
 		c.Next()
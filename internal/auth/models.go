@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"strings"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+// ModelAllowed reports whether the request's credential may call model. It
+// must be allowed both by the user and by the API key the request was made
+// with. Requests without a user may call
+// every model.
+func ModelAllowed(c *gin.Context, model string) bool {
+	if user, ok := GetUser(c); ok && !MatchModels(user.AllowedModels, model) {
+		return false
+	}
+	if value, ok := c.Get("api_key"); ok {
+		if key, ok := value.(*database.APIKey); ok && !MatchModels(key.AllowedModels, model) {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchModels reports whether model is in allowed, where an entry ending in
+// * matches every model starting with the rest of it. An empty list allows
+// every model.
+func MatchModels(allowed []string, model string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, pattern := range allowed {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(model, prefix) {
+				return true
+			}
+		} else if pattern == model {
+			return true
+		}
+	}
+	return false
+}
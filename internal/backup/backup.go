@@ -0,0 +1,179 @@
+package backup
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/pkg/blob"
+	"github.com/X0Ken/openai-gateway/pkg/database"
+)
+
+// Backup file names are the prefix, the UTC time of the snapshot and the
+// suffix, so they sort by age
+const (
+	filePrefix = "gateway-"
+	fileSuffix = ".db.gz"
+	timeFormat = "20060102T150405Z"
+)
+
+// Options configures scheduled database backups
+type Options struct {
+	// Dir is the directory compressed backups are written to
+	Dir string
+	// Keep is the number of backups kept in Dir; older ones are deleted
+	Keep int
+	// Remote, when set, receives a copy of every backup under its file
+	// name, e.g. in an S3 bucket
+	Remote blob.Store
+}
+
+// Runner takes compressed snapshots of the database
+type Runner struct {
+	db   *database.DB
+	opts Options
+	now  func() time.Time
+}
+
+// NewRunner creates a backup runner for db
+func NewRunner(db *database.DB, opts Options) *Runner {
+	if opts.Keep <= 0 {
+		opts.Keep = 1
+	}
+	return &Runner{db: db, opts: opts, now: time.Now}
+}
+
+// Run takes a backup, deletes the backups beyond Keep and uploads the new
+// one. It returns the path of the backup. It is meant to run every backup
+// interval.
+func (r *Runner) Run(ctx context.Context) (string, error) {
+	if err := os.MkdirAll(r.opts.Dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	name := filePrefix + r.now().UTC().Format(timeFormat) + fileSuffix
+	dest := filepath.Join(r.opts.Dir, name)
+
+	// Snapshot to a temporary file, then compress it into place, so an
+	// interrupted run never leaves a partial backup under a backup name
+	snapshot := dest + ".snapshot"
+	defer os.Remove(snapshot)
+	if err := r.db.Backup(ctx, snapshot); err != nil {
+		return "", err
+	}
+	size, err := compress(snapshot, dest)
+	if err != nil {
+		return "", err
+	}
+	log.Printf("Database backed up to %s (%d bytes)", dest, size)
+
+	if err := r.rotate(); err != nil {
+		return dest, err
+	}
+	if r.opts.Remote != nil {
+		if err := r.upload(ctx, dest, name, size); err != nil {
+			return dest, err
+		}
+	}
+	return dest, nil
+}
+
+// compress gzips src into dest, returning the compressed size
+func compress(src, dest string) (int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	defer in.Close()
+
+	tmp := dest + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create backup: %w", err)
+	}
+	defer os.Remove(tmp)
+
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		out.Close()
+		return 0, fmt.Errorf("failed to compress backup: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		out.Close()
+		return 0, fmt.Errorf("failed to compress backup: %w", err)
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return 0, fmt.Errorf("failed to write backup: %w", err)
+	}
+	info, err := out.Stat()
+	if err != nil {
+		out.Close()
+		return 0, fmt.Errorf("failed to write backup: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return 0, fmt.Errorf("failed to write backup: %w", err)
+	}
+
+	if err := os.Rename(tmp, dest); err != nil {
+		return 0, fmt.Errorf("failed to write backup: %w", err)
+	}
+	return info.Size(), nil
+}
+
+// rotate deletes all but the newest Keep backups in Dir
+func (r *Runner) rotate() error {
+	backups, err := List(r.opts.Dir)
+	if err != nil {
+		return err
+	}
+	if len(backups) <= r.opts.Keep {
+		return nil
+	}
+	for _, name := range backups[:len(backups)-r.opts.Keep] {
+		if err := os.Remove(filepath.Join(r.opts.Dir, name)); err != nil {
+			return fmt.Errorf("failed to delete old backup: %w", err)
+		}
+		log.Printf("Deleted old backup %s", name)
+	}
+	return nil
+}
+
+// upload copies a backup to the remote store
+func (r *Runner) upload(ctx context.Context, file, name string, size int64) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer f.Close()
+
+	if err := r.opts.Remote.Put(ctx, name, f, size, "application/gzip"); err != nil {
+		return err
+	}
+	log.Printf("Uploaded backup %s", name)
+	return nil
+}
+
+// List returns the names of the backups in dir, oldest first
+func List(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.Type().IsRegular() && strings.HasPrefix(name, filePrefix) && strings.HasSuffix(name, fileSuffix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,90 @@
+package backup
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/pkg/blob"
+	"github.com/X0Ken/openai-gateway/pkg/database"
+)
+
+func TestRunBacksUpRotatesAndUploads(t *testing.T) {
+	dbPath := "/tmp/test_backup.db"
+	defer os.Remove(dbPath)
+
+	db, err := database.New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+	db.CreateUser(&database.User{APIKey: "test-key", Name: "Test"})
+
+	dir := t.TempDir()
+	remoteDir := t.TempDir()
+	runner := NewRunner(db, Options{Dir: dir, Keep: 2, Remote: blob.NewLocal(remoteDir)})
+	now := time.Date(2026, 10, 16, 3, 0, 0, 0, time.UTC)
+	runner.now = func() time.Time { return now }
+
+	var last string
+	for i := 0; i < 3; i++ {
+		last, err = runner.Run(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(24 * time.Hour)
+	}
+
+	backups, err := List(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"gateway-20261017T030000Z.db.gz", "gateway-20261018T030000Z.db.gz"}
+	if len(backups) != 2 || backups[0] != want[0] || backups[1] != want[1] {
+		t.Fatalf("Expected the 2 newest backups, got %v", backups)
+	}
+	if uploads, _ := List(remoteDir); len(uploads) != 3 {
+		t.Errorf("Expected every backup uploaded, got %v", uploads)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("Expected no temporary files left, got %d entries", len(entries))
+	}
+
+	// The backup restores to a working database
+	restored := filepath.Join(t.TempDir(), "restored.db")
+	gunzip(t, last, restored)
+	restoredDB, err := database.New(restored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restoredDB.Close()
+	user, err := restoredDB.GetUserByAPIKey("test-key")
+	if err != nil || user == nil {
+		t.Errorf("Expected the user in the restored database, got %v, %v", user, err)
+	}
+}
+
+func gunzip(t *testing.T, src, dest string) {
+	t.Helper()
+	in, err := os.Open(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	zr, err := gzip.NewReader(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.Create(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	if _, err := io.Copy(out, zr); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,177 @@
+// Package bootstrap seeds an empty database on first start, so a new
+// gateway is usable without manual admin API calls.
+package bootstrap
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/X0Ken/openai-gateway/internal/auth"
+	"github.com/X0Ken/openai-gateway/internal/reconcile"
+	"github.com/X0Ken/openai-gateway/pkg/database"
+)
+
+// Names of the seeded resources
+const (
+	AdminTokenName = "bootstrap"
+	UserName       = "default"
+	ChannelName    = "default"
+)
+
+// Options describe what to seed. Empty credentials are generated.
+type Options struct {
+	// Enabled seeds an admin token and a default user even when nothing
+	// else is configured
+	Enabled bool
+	// File is a declarative state file applied first
+	File       string
+	AdminToken string
+	UserAPIKey string
+	// ChannelBaseURL, when set, creates a channel serving ChannelModels
+	ChannelBaseURL string
+	ChannelAPIKey  string
+	ChannelModels  []string
+}
+
+// Environment variables read by OptionsFromEnv
+const (
+	EnvEnabled        = "GATEWAY_BOOTSTRAP"
+	EnvFile           = "GATEWAY_BOOTSTRAP_FILE"
+	EnvAdminToken     = "GATEWAY_ADMIN_TOKEN"
+	EnvUserAPIKey     = "GATEWAY_USER_API_KEY"
+	EnvChannelBaseURL = "GATEWAY_CHANNEL_BASE_URL"
+	EnvChannelAPIKey  = "GATEWAY_CHANNEL_API_KEY"
+	EnvChannelModels  = "GATEWAY_CHANNEL_MODELS"
+)
+
+// OptionsFromEnv overrides the configured options with environment
+// variables. Setting any of them enables bootstrapping.
+func OptionsFromEnv(opts Options) Options {
+	if v := os.Getenv(EnvEnabled); v != "" {
+		opts.Enabled = v == "true" || v == "1"
+	}
+	if v := os.Getenv(EnvFile); v != "" {
+		opts.File = v
+	}
+	if v := os.Getenv(EnvAdminToken); v != "" {
+		opts.AdminToken = v
+	}
+	if v := os.Getenv(EnvUserAPIKey); v != "" {
+		opts.UserAPIKey = v
+	}
+	if v := os.Getenv(EnvChannelBaseURL); v != "" {
+		opts.ChannelBaseURL = v
+	}
+	if v := os.Getenv(EnvChannelAPIKey); v != "" {
+		opts.ChannelAPIKey = v
+	}
+	if v := os.Getenv(EnvChannelModels); v != "" {
+		opts.ChannelModels = nil
+		for _, model := range strings.Split(v, ",") {
+			if model = strings.TrimSpace(model); model != "" {
+				opts.ChannelModels = append(opts.ChannelModels, model)
+			}
+		}
+	}
+	return opts
+}
+
+// Active reports whether the options ask for anything to be seeded
+func (o Options) Active() bool {
+	return o.Enabled || o.File != "" || o.AdminToken != "" || o.UserAPIKey != "" || o.ChannelBaseURL != ""
+}
+
+// Result reports what was seeded. Generated credentials are returned so
+// they can be shown once; supplied ones are not echoed.
+type Result struct {
+	// Seeded is false when the database already had data
+	Seeded              bool
+	Changes             []reconcile.Change
+	GeneratedAdminToken string
+	GeneratedUserAPIKey string
+}
+
+// Run seeds the database when it is empty: it applies the state file and
+// environment channel, creates a default user unless the state declared
+// users, and creates the first admin token. A database with any channel,
+// model, user or admin token is left untouched.
+func Run(db *database.DB, reconciler *reconcile.Reconciler, opts Options) (*Result, error) {
+	empty, err := db.Empty()
+	if err != nil {
+		return nil, err
+	}
+	if !empty {
+		return &Result{}, nil
+	}
+
+	state, err := desiredState(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{Seeded: true}
+	if state.Channels != nil || state.Models != nil || state.Users != nil {
+		if result.Changes, err = reconciler.Apply(state); err != nil {
+			return nil, fmt.Errorf("failed to apply bootstrap state: %w", err)
+		}
+	}
+
+	if state.Users == nil {
+		user := &database.User{Name: UserName, APIKey: opts.UserAPIKey}
+		if user.APIKey == "" {
+			if user.APIKey, err = auth.GenerateAPIKey(); err != nil {
+				return nil, fmt.Errorf("failed to generate bootstrap user API key: %w", err)
+			}
+			result.GeneratedUserAPIKey = user.APIKey
+		}
+		if err := db.CreateUser(user); err != nil {
+			return nil, fmt.Errorf("failed to create bootstrap user: %w", err)
+		}
+	}
+
+	token := &database.AdminToken{Name: AdminTokenName, Token: opts.AdminToken}
+	if token.Token == "" {
+		if token.Token, err = auth.GenerateAdminToken(); err != nil {
+			return nil, fmt.Errorf("failed to generate bootstrap admin token: %w", err)
+		}
+		result.GeneratedAdminToken = token.Token
+	}
+	if err := db.CreateAdminToken(token); err != nil {
+		return nil, fmt.Errorf("failed to create bootstrap admin token: %w", err)
+	}
+
+	return result, nil
+}
+
+// desiredState builds the state to apply from the state file and the
+// environment channel
+func desiredState(opts Options) (*reconcile.State, error) {
+	state := &reconcile.State{}
+	if opts.File != "" {
+		var err error
+		if state, err = reconcile.LoadStateFile(opts.File); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.ChannelBaseURL == "" {
+		return state, nil
+	}
+	if opts.ChannelAPIKey == "" {
+		return nil, fmt.Errorf("%s is required with %s", EnvChannelAPIKey, EnvChannelBaseURL)
+	}
+
+	state.Channels = append(state.Channels, reconcile.ChannelSpec{
+		Name:    ChannelName,
+		BaseURL: opts.ChannelBaseURL,
+		APIKey:  opts.ChannelAPIKey,
+	})
+	for _, model := range opts.ChannelModels {
+		state.Models = append(state.Models, reconcile.ModelSpec{
+			Name:     model,
+			Channels: []reconcile.ModelChannelSpec{{Channel: ChannelName, BackendModelName: model}},
+		})
+	}
+	return state, nil
+}
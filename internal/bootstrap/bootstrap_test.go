@@ -0,0 +1,103 @@
+package bootstrap
+
+import (
+	"os"
+	"testing"
+
+	"github.com/X0Ken/openai-gateway/internal/reconcile"
+	"github.com/X0Ken/openai-gateway/pkg/database"
+)
+
+func TestRunSeedsEmptyDatabase(t *testing.T) {
+	dbPath := "/tmp/test_bootstrap.db"
+	defer os.Remove(dbPath)
+
+	db, err := database.New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	opts := Options{
+		UserAPIKey:     "sk-user",
+		ChannelBaseURL: "https://api.openai.com",
+		ChannelAPIKey:  "sk-upstream",
+		ChannelModels:  []string{"gpt-4o", "gpt-4o-mini"},
+	}
+	result, err := Run(db, reconcile.NewReconciler(db), opts)
+	if err != nil {
+		t.Fatalf("Failed to bootstrap: %v", err)
+	}
+	if !result.Seeded {
+		t.Fatal("Expected an empty database to be seeded")
+	}
+	if result.GeneratedUserAPIKey != "" {
+		t.Errorf("Expected the supplied user key not to be echoed, got %q", result.GeneratedUserAPIKey)
+	}
+	if result.GeneratedAdminToken == "" {
+		t.Error("Expected an admin token to be generated")
+	}
+
+	if token, _ := db.GetAdminTokenByToken(result.GeneratedAdminToken); token == nil || token.Name != AdminTokenName {
+		t.Errorf("Expected the generated admin token to be stored, got %+v", token)
+	}
+	if user, _ := db.GetUserByAPIKey("sk-user"); user == nil || user.Name != UserName {
+		t.Errorf("Expected the default user, got %+v", user)
+	}
+	ch, _ := db.GetChannelByName(ChannelName)
+	if ch == nil || ch.APIKey != "sk-upstream" {
+		t.Fatalf("Expected the default channel, got %+v", ch)
+	}
+	for _, name := range opts.ChannelModels {
+		model, _ := db.GetModelByName(name)
+		if model == nil {
+			t.Fatalf("Expected model %s", name)
+		}
+		if mappings, _ := db.GetModelChannelsByModel(model.ID); len(mappings) != 1 || mappings[0].ChannelID != ch.ID {
+			t.Errorf("Expected %s to be served by the default channel, got %+v", name, mappings)
+		}
+	}
+
+	// A second start leaves the seeded database alone
+	result, err = Run(db, reconcile.NewReconciler(db), opts)
+	if err != nil {
+		t.Fatalf("Failed to bootstrap: %v", err)
+	}
+	if result.Seeded {
+		t.Error("Expected a non-empty database not to be seeded again")
+	}
+	if count, _ := db.CountAdminTokens(); count != 1 {
+		t.Errorf("Expected one admin token, got %d", count)
+	}
+}
+
+func TestRunRequiresChannelAPIKey(t *testing.T) {
+	dbPath := "/tmp/test_bootstrap_channel.db"
+	defer os.Remove(dbPath)
+
+	db, err := database.New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := Run(db, reconcile.NewReconciler(db), Options{ChannelBaseURL: "https://api.openai.com"}); err == nil {
+		t.Error("Expected an error without a channel API key")
+	}
+	if empty, _ := db.Empty(); !empty {
+		t.Error("Expected nothing to be seeded after an error")
+	}
+}
+
+func TestOptionsFromEnv(t *testing.T) {
+	t.Setenv(EnvAdminToken, "gw-admin-env")
+	t.Setenv(EnvChannelModels, "gpt-4o, ,gpt-4o-mini")
+
+	opts := OptionsFromEnv(Options{File: "state.yaml"})
+	if !opts.Active() || opts.AdminToken != "gw-admin-env" || opts.File != "state.yaml" {
+		t.Errorf("Expected environment to override options, got %+v", opts)
+	}
+	if len(opts.ChannelModels) != 2 || opts.ChannelModels[1] != "gpt-4o-mini" {
+		t.Errorf("Expected two models, got %v", opts.ChannelModels)
+	}
+}
@@ -0,0 +1,305 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/internal/metrics"
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/X0Ken/openai-gateway/pkg/health"
+	"github.com/X0Ken/openai-gateway/pkg/workerpool"
+)
+
+// PollInterval is how often ProbeOpen should look for breakers due a probe
+const PollInterval = 5 * time.Second
+
+// probeConcurrency bounds the number of channels probed in parallel
+const probeConcurrency = 8
+
+// State is the state of a channel's circuit breaker
+type State string
+
+const (
+	// StateClosed lets requests through
+	StateClosed State = "closed"
+	// StateOpen keeps the channel out of routing
+	StateOpen State = "open"
+	// StateHalfOpen is a tripped breaker being tried again: by a probe, or
+	// by requests when the channel cannot be probed
+	StateHalfOpen State = "half_open"
+)
+
+// Options configures the per-channel circuit breakers
+type Options struct {
+	// ConsecutiveFailures trips a breaker after this many failures in a
+	// row; 0 disables the check
+	ConsecutiveFailures int
+	// ErrorRate trips a breaker when the share of failed requests in a
+	// window reaches it; 0 disables the check
+	ErrorRate float64
+	// MinRequests is the number of requests in a window before the rate is
+	// evaluated
+	MinRequests int
+	// Window is the length of the fixed window requests are counted over
+	Window time.Duration
+	// OpenDuration is how long a tripped breaker keeps its channel out of
+	// routing before trying it again
+	OpenDuration time.Duration
+	// ProbeTimeout bounds a probe of a half-open channel
+	ProbeTimeout time.Duration
+}
+
+// Status is the state of one channel's breaker
+type Status struct {
+	ChannelID           int64 `json:"channel_id"`
+	State               State `json:"state"`
+	ConsecutiveFailures int   `json:"consecutive_failures"`
+	// Requests and Failures are counted over the current window
+	Requests  int    `json:"requests"`
+	Failures  int    `json:"failures"`
+	Trips     int64  `json:"trips"`
+	LastError string `json:"last_error,omitempty"`
+	// OpenedAt is when the breaker last tripped, and RetryAt when an open
+	// breaker will be tried again
+	OpenedAt *time.Time `json:"opened_at,omitempty"`
+	RetryAt  *time.Time `json:"retry_at,omitempty"`
+}
+
+// breaker is the state of one channel
+type breaker struct {
+	name        string
+	status      Status
+	windowStart time.Time
+	// probing is set while a half-open channel is probed, keeping it out
+	// of routing until the probe decides
+	probing bool
+}
+
+// Breakers keeps a circuit breaker per channel. A breaker trips when its
+// channel fails too often, removing the channel from routing. Once
+// OpenDuration has passed it turns half-open and the channel is probed: a
+// success closes the breaker and a failure opens it again. Channels that
+// cannot be probed take requests while half-open, and the first outcome
+// decides.
+type Breakers struct {
+	mu       sync.Mutex
+	opts     Options
+	channels map[int64]*breaker
+	db       *database.DB
+	probe    health.Prober
+	now      func() time.Time
+}
+
+// New creates circuit breakers for every channel
+func New(opts Options) *Breakers {
+	if opts.Window <= 0 {
+		opts.Window = time.Minute
+	}
+	if opts.MinRequests <= 0 {
+		opts.MinRequests = 1
+	}
+	if opts.OpenDuration <= 0 {
+		opts.OpenDuration = 30 * time.Second
+	}
+	return &Breakers{opts: opts, channels: make(map[int64]*breaker), now: time.Now}
+}
+
+// SetProber sets the check run against half-open channels, which are looked
+// up in db. Without a prober every half-open channel is tried by requests.
+func (b *Breakers) SetProber(db *database.DB, probe health.Prober) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.db = db
+	b.probe = probe
+}
+
+// Record counts the outcome of a request to a channel. err is nil when the
+// channel served the request, and the failure otherwise.
+func (b *Breakers) Record(ch *database.Channel, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	br := b.get(ch.ID, ch.Name, now)
+	status := &br.status
+
+	switch status.State {
+	case StateOpen:
+		// Requests already in flight when the breaker tripped
+		return
+	case StateHalfOpen:
+		if err == nil {
+			b.close(br, now)
+		} else {
+			b.trip(br, err, now)
+		}
+		return
+	}
+
+	if now.Sub(br.windowStart) >= b.opts.Window {
+		br.windowStart = now
+		status.Requests, status.Failures = 0, 0
+	}
+	status.Requests++
+	if err == nil {
+		status.ConsecutiveFailures = 0
+		return
+	}
+	status.Failures++
+	status.ConsecutiveFailures++
+
+	if n := b.opts.ConsecutiveFailures; n > 0 && status.ConsecutiveFailures >= n {
+		b.trip(br, err, now)
+		return
+	}
+	rate := float64(status.Failures) / float64(status.Requests)
+	if b.opts.ErrorRate > 0 && status.Requests >= b.opts.MinRequests && rate >= b.opts.ErrorRate {
+		b.trip(br, err, now)
+	}
+}
+
+// Unhealthy reports whether a channel's breaker keeps it out of routing
+func (b *Breakers) Unhealthy(channelID int64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	br, ok := b.channels[channelID]
+	if !ok {
+		return false
+	}
+	return br.status.State == StateOpen || br.probing
+}
+
+// Status returns the breaker of a channel. Channels without recorded
+// requests are closed.
+func (b *Breakers) Status(channelID int64) Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	br, ok := b.channels[channelID]
+	if !ok {
+		return Status{ChannelID: channelID, State: StateClosed}
+	}
+	return br.status
+}
+
+// ProbeOpen turns breakers open for OpenDuration half-open and probes their
+// channels. It is meant to run every PollInterval.
+func (b *Breakers) ProbeOpen(ctx context.Context) error {
+	b.mu.Lock()
+	now := b.now()
+	var due []int64
+	for id, br := range b.channels {
+		if br.status.State != StateOpen || now.Before(*br.status.RetryAt) {
+			continue
+		}
+		b.setState(br, StateHalfOpen)
+		log.Printf("Circuit breaker of channel %s is half-open", br.name)
+		if b.probe != nil {
+			br.probing = true
+			due = append(due, id)
+		}
+	}
+	db, probe := b.db, b.probe
+	b.mu.Unlock()
+
+	return workerpool.Run(ctx, probeConcurrency, due, func(ctx context.Context, id int64) error {
+		ch, err := db.GetChannel(id)
+		if err != nil || ch == nil {
+			b.settle(id, ch, err)
+			return err
+		}
+		if b.opts.ProbeTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, b.opts.ProbeTimeout)
+			defer cancel()
+		}
+		err = probe(ctx, ch)
+		if err != nil && ctx.Err() == context.Canceled {
+			// Shutting down; the channel was not at fault
+			err = health.ErrSkipped
+		}
+		b.settle(id, ch, err)
+		return nil
+	})
+}
+
+// settle records the probe of a half-open channel. A deleted channel's
+// breaker is dropped, and a channel that could not be probed is left
+// half-open for requests to decide.
+func (b *Breakers) settle(id int64, ch *database.Channel, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	br, ok := b.channels[id]
+	if !ok {
+		return
+	}
+	br.probing = false
+	if ch == nil && err == nil {
+		metrics.DeleteBreakerState(br.name)
+		delete(b.channels, id)
+		return
+	}
+	if br.status.State != StateHalfOpen || errors.Is(err, health.ErrSkipped) || ch == nil {
+		return
+	}
+
+	now := b.now()
+	if err == nil {
+		b.close(br, now)
+	} else {
+		b.trip(br, err, now)
+	}
+}
+
+// get returns the breaker of a channel, creating a closed one
+func (b *Breakers) get(id int64, name string, now time.Time) *breaker {
+	br, ok := b.channels[id]
+	if !ok {
+		br = &breaker{name: name, status: Status{ChannelID: id, State: StateClosed}, windowStart: now}
+		b.channels[id] = br
+		metrics.SetBreakerState(name, 0)
+	}
+	return br
+}
+
+// trip opens a breaker
+func (b *Breakers) trip(br *breaker, err error, now time.Time) {
+	status := &br.status
+	retryAt := now.Add(b.opts.OpenDuration)
+	status.OpenedAt, status.RetryAt = &now, &retryAt
+	status.LastError = err.Error()
+	status.Trips++
+	b.setState(br, StateOpen)
+	metrics.RecordBreakerTrip(br.name)
+	log.Printf("Circuit breaker of channel %s opened after %d consecutive failures (%d of %d requests failed), retrying at %s: %s",
+		br.name, status.ConsecutiveFailures, status.Failures, status.Requests, retryAt.Format(time.RFC3339), status.LastError)
+}
+
+// close closes a breaker, starting a new window
+func (b *Breakers) close(br *breaker, now time.Time) {
+	status := &br.status
+	status.ConsecutiveFailures, status.Requests, status.Failures = 0, 0, 0
+	status.RetryAt = nil
+	br.windowStart = now
+	b.setState(br, StateClosed)
+	log.Printf("Circuit breaker of channel %s closed", br.name)
+}
+
+// setState changes a breaker's state and its gauge
+func (b *Breakers) setState(br *breaker, state State) {
+	br.status.State = state
+	metrics.SetBreakerState(br.name, stateLevels[state])
+}
+
+// stateLevels are the values of the breaker state gauge
+var stateLevels = map[State]int{
+	StateClosed:   0,
+	StateHalfOpen: 1,
+	StateOpen:     2,
+}
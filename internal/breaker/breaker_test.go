@@ -0,0 +1,132 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/X0Ken/openai-gateway/pkg/health"
+)
+
+var errBackend = errors.New("backend error: 502")
+
+// newTestBreakers returns breakers on a clock advanced by the returned function
+func newTestBreakers(opts Options) (*Breakers, func(time.Duration)) {
+	b := New(opts)
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return now }
+	return b, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestBreakerTripsAfterConsecutiveFailures(t *testing.T) {
+	b, _ := newTestBreakers(Options{ConsecutiveFailures: 3, OpenDuration: time.Minute})
+	ch := &database.Channel{ID: 1, Name: "a"}
+
+	b.Record(ch, errBackend)
+	b.Record(ch, errBackend)
+	b.Record(ch, nil)
+	b.Record(ch, errBackend)
+	b.Record(ch, errBackend)
+	if b.Unhealthy(ch.ID) {
+		t.Fatal("Expected a success to reset the consecutive failures")
+	}
+
+	b.Record(ch, errBackend)
+	if !b.Unhealthy(ch.ID) {
+		t.Fatal("Expected the breaker to open after 3 consecutive failures")
+	}
+	status := b.Status(ch.ID)
+	if status.State != StateOpen || status.Trips != 1 || status.LastError != errBackend.Error() {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+
+	// Requests in flight when the breaker opened do not close it
+	b.Record(ch, nil)
+	if !b.Unhealthy(ch.ID) {
+		t.Error("Expected the breaker to stay open")
+	}
+}
+
+func TestBreakerTripsOnErrorRate(t *testing.T) {
+	b, advance := newTestBreakers(Options{ErrorRate: 0.5, MinRequests: 4, Window: time.Minute})
+	ch := &database.Channel{ID: 1, Name: "a"}
+
+	// A high rate below the minimum sample size, then a new window
+	b.Record(ch, errBackend)
+	b.Record(ch, nil)
+	b.Record(ch, errBackend)
+	advance(time.Minute)
+	b.Record(ch, nil)
+	b.Record(ch, errBackend)
+	b.Record(ch, nil)
+	if b.Unhealthy(ch.ID) {
+		t.Fatal("Expected the breaker to stay closed below the minimum requests of a window")
+	}
+
+	b.Record(ch, errBackend)
+	if !b.Unhealthy(ch.ID) {
+		t.Fatal("Expected the breaker to open at a 50% error rate")
+	}
+}
+
+func TestBreakerProbesHalfOpenChannels(t *testing.T) {
+	dbPath := "/tmp/test_breaker.db"
+	defer os.Remove(dbPath)
+
+	db, err := database.New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	ch := &database.Channel{Name: "a", BaseURL: "https://a.example.com", APIKey: "sk-a", Enabled: true}
+	if err := db.CreateChannel(ch); err != nil {
+		t.Fatal(err)
+	}
+
+	probeErr := errBackend
+	probes := 0
+	b, advance := newTestBreakers(Options{ConsecutiveFailures: 1, OpenDuration: time.Minute})
+	b.SetProber(db, func(ctx context.Context, probed *database.Channel) error {
+		probes++
+		return probeErr
+	})
+	ctx := context.Background()
+
+	b.Record(ch, errBackend)
+	b.ProbeOpen(ctx)
+	if probes != 0 {
+		t.Fatal("Expected no probe before the open duration passed")
+	}
+
+	// A failed probe opens the breaker again
+	advance(time.Minute)
+	b.ProbeOpen(ctx)
+	if probes != 1 || !b.Unhealthy(ch.ID) || b.Status(ch.ID).Trips != 2 {
+		t.Fatalf("Expected a failed probe to reopen the breaker, got %d probes and %+v", probes, b.Status(ch.ID))
+	}
+
+	// A successful probe closes it
+	probeErr = nil
+	advance(time.Minute)
+	b.ProbeOpen(ctx)
+	if b.Unhealthy(ch.ID) || b.Status(ch.ID).State != StateClosed {
+		t.Fatalf("Expected a successful probe to close the breaker, got %+v", b.Status(ch.ID))
+	}
+
+	// A channel that cannot be probed is left to requests while half-open
+	probeErr = health.ErrSkipped
+	b.Record(ch, errBackend)
+	advance(time.Minute)
+	b.ProbeOpen(ctx)
+	if b.Unhealthy(ch.ID) || b.Status(ch.ID).State != StateHalfOpen {
+		t.Fatalf("Expected a half-open breaker taking requests, got %+v", b.Status(ch.ID))
+	}
+	b.Record(ch, nil)
+	if b.Status(ch.ID).State != StateClosed {
+		t.Errorf("Expected a successful request to close the breaker, got %+v", b.Status(ch.ID))
+	}
+}
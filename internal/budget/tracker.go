@@ -0,0 +1,119 @@
+package budget
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/internal/alert"
+	"github.com/X0Ken/openai-gateway/pkg/store"
+	"github.com/gin-gonic/gin"
+)
+
+// Options configures the per-user error budget
+type Options struct {
+	// Window is the length of the fixed window errors are counted over
+	Window time.Duration
+	// Threshold is the error rate (0-1) above which the user is alerted on
+	Threshold float64
+	// MinRequests is the number of requests in a window before the rate is evaluated
+	MinRequests int64
+}
+
+// Tracker counts each user's failed requests over a fixed window and raises
+// an alert, at most once per window, when the error rate exceeds the
+// threshold. Counts live in the shared stores so replicas see one budget.
+type Tracker struct {
+	opts     Options
+	counters store.RateLimits
+	state    store.State
+	notifier *alert.Notifier
+}
+
+// NewTracker creates a new error budget tracker
+func NewTracker(opts Options, counters store.RateLimits, state store.State, notifier *alert.Notifier) *Tracker {
+	if opts.Window <= 0 {
+		opts.Window = 5 * time.Minute
+	}
+	if opts.MinRequests <= 0 {
+		opts.MinRequests = 1
+	}
+	return &Tracker{opts: opts, counters: counters, state: state, notifier: notifier}
+}
+
+// Middleware records the outcome of every authenticated request. Responses
+// with status 400 or above count against the user's budget.
+func (t *Tracker) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		userID, ok := c.Get("user_id")
+		if !ok {
+			return
+		}
+		id, ok := userID.(int64)
+		if !ok {
+			return
+		}
+
+		if err := t.Record(c.Request.Context(), id, c.Writer.Status()); err != nil {
+			log.Printf("Failed to record error budget for user %d: %v", id, err)
+		}
+	}
+}
+
+// Record counts a request outcome for a user and alerts when the budget is exhausted
+func (t *Tracker) Record(ctx context.Context, userID int64, status int) error {
+	prefix := "errbudget:" + strconv.FormatInt(userID, 10)
+
+	total, err := t.counters.Incr(ctx, prefix+":total", t.opts.Window)
+	if err != nil {
+		return err
+	}
+	if status < 400 {
+		return nil
+	}
+
+	failures, err := t.counters.Incr(ctx, prefix+":errors", t.opts.Window)
+	if err != nil {
+		return err
+	}
+
+	if total < t.opts.MinRequests {
+		return nil
+	}
+	rate := float64(failures) / float64(total)
+	if rate <= t.opts.Threshold {
+		return nil
+	}
+
+	// Alert once per window
+	alertedKey := prefix + ":alerted"
+	alerted, err := t.state.Get(ctx, alertedKey)
+	if err != nil {
+		return err
+	}
+	if alerted != nil {
+		return nil
+	}
+	if err := t.state.Set(ctx, alertedKey, []byte("1"), t.opts.Window); err != nil {
+		return err
+	}
+
+	t.notifier.Notify(alert.Alert{
+		Type:    alert.TypeErrorBudget,
+		Subject: fmt.Sprintf("user %d", userID),
+		Message: fmt.Sprintf("error rate %.0f%% over the last %s exceeds %.0f%%", rate*100, t.opts.Window, t.opts.Threshold*100),
+		Details: map[string]any{
+			"user_id":     userID,
+			"errors":      failures,
+			"requests":    total,
+			"error_rate":  rate,
+			"last_status": status,
+		},
+	})
+
+	return nil
+}
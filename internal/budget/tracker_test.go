@@ -0,0 +1,71 @@
+package budget
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/internal/alert"
+	"github.com/X0Ken/openai-gateway/pkg/store"
+)
+
+func TestTrackerAlertsOncePerWindow(t *testing.T) {
+	alerts := make(chan alert.Alert, 10)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var a alert.Alert
+		json.NewDecoder(r.Body).Decode(&a)
+		alerts <- a
+	}))
+	defer webhook.Close()
+
+	mem := store.NewMemory()
+	tracker := NewTracker(Options{Window: time.Minute, Threshold: 0.5, MinRequests: 4}, mem, mem, alert.NewNotifier(webhook.URL))
+
+	ctx := context.Background()
+	// 3 failures out of 3 requests stay below the minimum sample size
+	for i := 0; i < 3; i++ {
+		tracker.Record(ctx, 7, http.StatusBadRequest)
+	}
+	select {
+	case a := <-alerts:
+		t.Fatalf("Unexpected alert before min requests: %+v", a)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// The 4th failure exceeds the budget
+	tracker.Record(ctx, 7, http.StatusTooManyRequests)
+	select {
+	case a := <-alerts:
+		if a.Type != alert.TypeErrorBudget || a.Subject != "user 7" {
+			t.Errorf("Unexpected alert: %+v", a)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected an alert")
+	}
+
+	// Further failures in the same window do not alert again
+	tracker.Record(ctx, 7, http.StatusBadRequest)
+	select {
+	case a := <-alerts:
+		t.Fatalf("Unexpected second alert: %+v", a)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestTrackerIgnoresSuccesses(t *testing.T) {
+	mem := store.NewMemory()
+	tracker := NewTracker(Options{Window: time.Minute, Threshold: 0.5, MinRequests: 1}, mem, mem, alert.NewNotifier(""))
+
+	ctx := context.Background()
+	for i := 0; i < 10; i++ {
+		tracker.Record(ctx, 1, http.StatusOK)
+	}
+	tracker.Record(ctx, 1, http.StatusBadGateway)
+
+	if v, _ := mem.Get(ctx, "errbudget:1:alerted"); v != nil {
+		t.Error("Expected no alert at 1/11 error rate")
+	}
+}
@@ -0,0 +1,115 @@
+// Package certs serves the TLS certificate of the gateway from files and
+// reloads it when they change, so a rotated certificate is picked up
+// without a restart
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Reloader holds a certificate loaded from a certificate and key file
+type Reloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	version fileVersion
+}
+
+// fileVersion identifies the contents of the certificate files by their
+// modification times and sizes
+type fileVersion struct {
+	certMod, keyMod   time.Time
+	certSize, keySize int64
+}
+
+// NewReloader loads the certificate in certFile and keyFile, both PEM encoded
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+	version, err := r.stat()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(version); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate returns the current certificate, for tls.Config
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// TLSConfig returns a server TLS configuration serving the current
+// certificate
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.GetCertificate,
+	}
+}
+
+// Reload loads the certificate again if either file changed since it was
+// last loaded. A certificate that fails to load, such as one caught halfway
+// through a rotation, is reported and the previous one kept; it is retried
+// on the next call. It is meant to run every reload interval.
+func (r *Reloader) Reload(ctx context.Context) error {
+	version, err := r.stat()
+	if err != nil {
+		return err
+	}
+	r.mu.RLock()
+	unchanged := version == r.version
+	r.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	if err := r.load(version); err != nil {
+		return err
+	}
+	log.Printf("Reloaded TLS certificate from %s", r.certFile)
+	return nil
+}
+
+// stat reads the version of the certificate files
+func (r *Reloader) stat() (fileVersion, error) {
+	cert, err := os.Stat(r.certFile)
+	if err != nil {
+		return fileVersion{}, fmt.Errorf("failed to read TLS certificate: %w", err)
+	}
+	key, err := os.Stat(r.keyFile)
+	if err != nil {
+		return fileVersion{}, fmt.Errorf("failed to read TLS key: %w", err)
+	}
+	return fileVersion{
+		certMod:  cert.ModTime(),
+		keyMod:   key.ModTime(),
+		certSize: cert.Size(),
+		keySize:  key.Size(),
+	}, nil
+}
+
+// load parses the certificate files and makes the result current
+func (r *Reloader) load(version fileVersion) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.version = version
+	return nil
+}
@@ -0,0 +1,116 @@
+package certs
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCert writes a self-signed certificate for commonName to certFile and
+// keyFile, with a modification time of modTime
+func writeCert(t *testing.T, certFile, keyFile, commonName string, modTime time.Time) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(certFile, modTime, modTime)
+	os.Chtimes(keyFile, modTime, modTime)
+}
+
+// commonName returns the subject of the reloader's current certificate
+func commonName(t *testing.T, r *Reloader) string {
+	t.Helper()
+	cert, err := r.GetCertificate(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestReloaderPicksUpRotatedCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	now := time.Now()
+	writeCert(t, certFile, keyFile, "first", now.Add(-time.Hour))
+
+	r, err := NewReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := commonName(t, r); name != "first" {
+		t.Fatalf("Expected the first certificate, got %q", name)
+	}
+
+	// Unchanged files are not reloaded
+	if err := r.Reload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	writeCert(t, certFile, keyFile, "second", now)
+	if err := r.Reload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if name := commonName(t, r); name != "second" {
+		t.Errorf("Expected the rotated certificate, got %q", name)
+	}
+
+	// A broken certificate keeps the previous one in service
+	os.WriteFile(keyFile, []byte("not a key"), 0600)
+	if err := r.Reload(context.Background()); err == nil {
+		t.Error("Expected an error for a broken key")
+	}
+	if name := commonName(t, r); name != "second" {
+		t.Errorf("Expected the previous certificate kept, got %q", name)
+	}
+
+	// and the rotation is retried until it completes
+	writeCert(t, certFile, keyFile, "third", now.Add(time.Hour))
+	if err := r.Reload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if name := commonName(t, r); name != "third" {
+		t.Errorf("Expected the completed rotation, got %q", name)
+	}
+}
+
+func TestNewReloaderRejectsMissingFiles(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := NewReloader(filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")); err == nil {
+		t.Error("Expected an error for missing certificate files")
+	}
+}
@@ -0,0 +1,121 @@
+package channel
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+)
+
+// Operation identifies an upstream API operation
+type Operation string
+
+const (
+	OperationChat           Operation = "chat"
+	OperationCompletions    Operation = "completions"
+	OperationEmbeddings     Operation = "embeddings"
+	OperationImages         Operation = "images"
+	OperationModels         Operation = "models"
+	OperationTranscriptions Operation = "transcriptions"
+	OperationTranslations   Operation = "translations"
+	OperationSpeech         Operation = "speech"
+)
+
+// defaultVersionPrefix is inserted when a base URL carries no API version
+const defaultVersionPrefix = "/v1"
+
+// defaultPaths holds the OpenAI path of each operation relative to the version root
+var defaultPaths = map[Operation]string{
+	OperationChat:           "/chat/completions",
+	OperationCompletions:    "/completions",
+	OperationEmbeddings:     "/embeddings",
+	OperationImages:         "/images/generations",
+	OperationModels:         "/models",
+	OperationTranscriptions: "/audio/transcriptions",
+	OperationTranslations:   "/audio/translations",
+	OperationSpeech:         "/audio/speech",
+}
+
+// versionSegment matches API version path segments such as v1, v2 or v1beta
+var versionSegment = regexp.MustCompile(`^v\d+[a-z0-9]*$`)
+
+// modelPlaceholder is replaced with the backend model name in path templates
+const modelPlaceholder = "{model}"
+
+// ErrInvalidPathTemplate is returned when a channel path template is rejected
+var ErrInvalidPathTemplate = errors.New("invalid path template")
+
+// EndpointURL builds the upstream URL for an operation on a channel. A
+// channel path template for the operation, when set, is appended to the base
+// URL verbatim (no version prefix is inserted) so self-hosted backends can
+// expose operations under nonstandard paths such as /api/v1/chat. A pinned
+// API version is sent as the api-version query parameter.
+func EndpointURL(ch *database.Channel, op Operation, model string) string {
+	var endpoint string
+	if tmpl, ok := ch.PathTemplates[string(op)]; ok && tmpl != "" {
+		path := strings.ReplaceAll(tmpl, modelPlaceholder, url.PathEscape(model))
+		endpoint = strings.TrimRight(ch.BaseURL, "/") + path
+	} else {
+		endpoint = JoinURL(ch.BaseURL, defaultPaths[op])
+	}
+
+	if ch.APIVersion != "" {
+		sep := "?"
+		if strings.Contains(endpoint, "?") {
+			sep = "&"
+		}
+		endpoint += sep + "api-version=" + url.QueryEscape(ch.APIVersion)
+	}
+
+	return endpoint
+}
+
+// ValidatePathTemplates checks that every template targets a known operation
+// and is an absolute path
+func ValidatePathTemplates(templates map[string]string) error {
+	for op, tmpl := range templates {
+		if _, ok := defaultPaths[Operation(op)]; !ok {
+			return fmt.Errorf("%w: unknown operation %q", ErrInvalidPathTemplate, op)
+		}
+		if !strings.HasPrefix(tmpl, "/") {
+			return fmt.Errorf("%w: path for %q must start with /", ErrInvalidPathTemplate, op)
+		}
+	}
+	return nil
+}
+
+// JoinURL joins a base URL and an operation path. Base URLs may be stored
+// with or without a version suffix: "https://api.openai.com" and
+// "https://api.openai.com/v1" both resolve to ".../v1/chat/completions".
+func JoinURL(baseURL, path string) string {
+	base := strings.TrimRight(baseURL, "/")
+	if path != "" && !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	if !HasVersionSuffix(base) {
+		base += defaultVersionPrefix
+	}
+
+	return base + path
+}
+
+// HasVersionSuffix reports whether the last path segment of a URL is an API
+// version such as v1 or v1beta
+func HasVersionSuffix(url string) bool {
+	rest := url
+	if i := strings.Index(rest, "://"); i >= 0 {
+		rest = rest[i+3:]
+	}
+
+	slash := strings.Index(rest, "/")
+	if slash < 0 {
+		return false
+	}
+
+	segments := strings.Split(rest[slash+1:], "/")
+	return versionSegment.MatchString(segments[len(segments)-1])
+}
@@ -0,0 +1,93 @@
+package channel
+
+import (
+	"testing"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+)
+
+func TestJoinURL(t *testing.T) {
+	tests := []struct {
+		base     string
+		path     string
+		expected string
+	}{
+		{"https://api.openai.com", "/chat/completions", "https://api.openai.com/v1/chat/completions"},
+		{"https://api.openai.com/", "/chat/completions", "https://api.openai.com/v1/chat/completions"},
+		{"https://api.openai.com/v1", "/chat/completions", "https://api.openai.com/v1/chat/completions"},
+		{"https://api.openai.com/v1/", "/embeddings", "https://api.openai.com/v1/embeddings"},
+		{"http://localhost:8000/openai/v1", "models", "http://localhost:8000/openai/v1/models"},
+		{"https://example.com/api/v1beta", "/models", "https://example.com/api/v1beta/models"},
+		{"https://example.com/proxy", "/models", "https://example.com/proxy/v1/models"},
+	}
+
+	for _, tt := range tests {
+		if got := JoinURL(tt.base, tt.path); got != tt.expected {
+			t.Errorf("JoinURL(%q, %q) = %q, expected %q", tt.base, tt.path, got, tt.expected)
+		}
+	}
+}
+
+func TestEndpointURL(t *testing.T) {
+	ch := &database.Channel{BaseURL: "https://api.openai.com/v1"}
+
+	if got := EndpointURL(ch, OperationChat, "gpt-4"); got != "https://api.openai.com/v1/chat/completions" {
+		t.Errorf("Unexpected chat URL: %s", got)
+	}
+
+	if got := EndpointURL(ch, OperationEmbeddings, "text-embedding-3-small"); got != "https://api.openai.com/v1/embeddings" {
+		t.Errorf("Unexpected embeddings URL: %s", got)
+	}
+}
+
+func TestEndpointURLPathTemplates(t *testing.T) {
+	ch := &database.Channel{
+		BaseURL: "http://localhost:11434/",
+		PathTemplates: map[string]string{
+			"chat":   "/api/v1/chat",
+			"models": "/deployments/{model}/models",
+		},
+	}
+
+	if got := EndpointURL(ch, OperationChat, "llama3"); got != "http://localhost:11434/api/v1/chat" {
+		t.Errorf("Unexpected chat URL: %s", got)
+	}
+
+	if got := EndpointURL(ch, OperationModels, "llama3"); got != "http://localhost:11434/deployments/llama3/models" {
+		t.Errorf("Unexpected models URL: %s", got)
+	}
+
+	// Operations without a template fall back to the default path
+	if got := EndpointURL(ch, OperationEmbeddings, "llama3"); got != "http://localhost:11434/v1/embeddings" {
+		t.Errorf("Unexpected embeddings URL: %s", got)
+	}
+}
+
+func TestEndpointURLAPIVersion(t *testing.T) {
+	ch := &database.Channel{
+		BaseURL:    "https://example.openai.azure.com",
+		APIVersion: "2024-06-01",
+		PathTemplates: map[string]string{
+			"chat": "/openai/deployments/{model}/chat/completions",
+		},
+	}
+
+	expected := "https://example.openai.azure.com/openai/deployments/gpt-4o/chat/completions?api-version=2024-06-01"
+	if got := EndpointURL(ch, OperationChat, "gpt-4o"); got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+}
+
+func TestValidatePathTemplates(t *testing.T) {
+	if err := ValidatePathTemplates(map[string]string{"chat": "/api/chat"}); err != nil {
+		t.Errorf("Valid templates should not return error: %v", err)
+	}
+
+	if err := ValidatePathTemplates(map[string]string{"unknown": "/x"}); err == nil {
+		t.Error("Expected error for unknown operation")
+	}
+
+	if err := ValidatePathTemplates(map[string]string{"chat": "api/chat"}); err == nil {
+		t.Error("Expected error for relative path")
+	}
+}
@@ -0,0 +1,22 @@
+package channel
+
+import (
+	"net/http"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+)
+
+// SetUpstreamHeaders sets the authentication and account headers a channel
+// requires on an outgoing request, authenticating with apiKey from the
+// channel's key pool. Multi-org OpenAI accounts are represented as separate
+// channels that differ only in Organization or Project.
+func SetUpstreamHeaders(req *http.Request, ch *database.Channel, apiKey string) {
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	if ch.Organization != "" {
+		req.Header.Set("OpenAI-Organization", ch.Organization)
+	}
+	if ch.Project != "" {
+		req.Header.Set("OpenAI-Project", ch.Project)
+	}
+}
@@ -0,0 +1,36 @@
+package channel
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+)
+
+func TestSetUpstreamHeaders(t *testing.T) {
+	ch := &database.Channel{
+		APIKey:       "sk-test",
+		Organization: "org-123",
+		Project:      "proj_abc",
+	}
+
+	req, _ := http.NewRequest("POST", "https://api.openai.com/v1/chat/completions", nil)
+	SetUpstreamHeaders(req, ch, ch.APIKey)
+
+	if got := req.Header.Get("Authorization"); got != "Bearer sk-test" {
+		t.Errorf("Expected bearer auth, got %q", got)
+	}
+	if got := req.Header.Get("OpenAI-Organization"); got != "org-123" {
+		t.Errorf("Expected organization header, got %q", got)
+	}
+	if got := req.Header.Get("OpenAI-Project"); got != "proj_abc" {
+		t.Errorf("Expected project header, got %q", got)
+	}
+
+	// Unset account fields must not produce empty headers
+	req, _ = http.NewRequest("POST", "https://api.openai.com/v1/chat/completions", nil)
+	SetUpstreamHeaders(req, &database.Channel{APIKey: "sk-test"}, "sk-test")
+	if _, ok := req.Header["Openai-Organization"]; ok {
+		t.Error("Expected no organization header")
+	}
+}
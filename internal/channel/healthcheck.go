@@ -0,0 +1,67 @@
+package channel
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/X0Ken/openai-gateway/pkg/health"
+)
+
+// SetHealthChecker registers every enabled channel with checker, and keeps
+// it up to date as channels are created, enabled, disabled and deleted
+func (m *Manager) SetHealthChecker(checker *health.Checker) error {
+	m.health = checker
+
+	channels, err := m.db.ListEnabledChannels()
+	if err != nil {
+		return err
+	}
+	for _, ch := range channels {
+		m.registerHealth(ch)
+	}
+	return nil
+}
+
+// registerHealth registers an enabled channel with the health checker
+func (m *Manager) registerHealth(ch *database.Channel) {
+	if m.health != nil && ch.Enabled {
+		m.health.RegisterChannel(ch.ID, ch.BaseURL)
+	}
+}
+
+// Probe checks that a channel's backend answers and accepts its API key by
+// listing its models. It is a health.Prober. Channels speaking other APIs
+// than OpenAI's are skipped. A backend that does not serve the models
+// endpoint is reachable, so a 404 or 405 counts as healthy; server errors
+// and rejected credentials do not.
+func (m *Manager) Probe(ctx context.Context, ch *database.Channel) error {
+	if ch.Type != "" && ch.Type != database.ChannelTypeOpenAI {
+		return health.ErrSkipped
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", EndpointURL(ch, OperationModels, ""), nil)
+	if err != nil {
+		return err
+	}
+	SetUpstreamHeaders(req, ch, ch.APIKey)
+
+	client, err := m.Client(ch)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+
+	switch {
+	case resp.StatusCode >= 500, resp.StatusCode == http.StatusUnauthorized, resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("models endpoint returned status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package channel
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/X0Ken/openai-gateway/pkg/health"
+)
+
+func TestProbe(t *testing.T) {
+	status := http.StatusOK
+	var auth string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		w.WriteHeader(status)
+	}))
+	defer backend.Close()
+
+	m := &Manager{transports: NewTransports(DefaultTransportOptions())}
+	ch := &database.Channel{ID: 1, BaseURL: backend.URL, APIKey: "sk-test"}
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		status  int
+		healthy bool
+	}{
+		{http.StatusOK, true},
+		{http.StatusNotFound, true},
+		{http.StatusUnauthorized, false},
+		{http.StatusBadGateway, false},
+	} {
+		status = tc.status
+		if err := m.Probe(ctx, ch); (err == nil) != tc.healthy {
+			t.Errorf("Status %d: expected healthy=%v, got %v", tc.status, tc.healthy, err)
+		}
+	}
+	if auth != "Bearer sk-test" {
+		t.Errorf("Expected the channel's API key, got %q", auth)
+	}
+
+	other := &database.Channel{ID: 2, Type: database.ChannelTypeAnthropic, BaseURL: backend.URL}
+	if err := m.Probe(ctx, other); !errors.Is(err, health.ErrSkipped) {
+		t.Errorf("Expected non-OpenAI channels to be skipped, got %v", err)
+	}
+}
+
+func TestManagerRegistersChannelsForHealthChecks(t *testing.T) {
+	dbPath := "/tmp/test_channel_health.db"
+	defer os.Remove(dbPath)
+
+	db, err := database.New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	existing := &database.Channel{Name: "existing", BaseURL: "https://a.example.com", APIKey: "sk-a", Enabled: true}
+	db.CreateChannel(existing)
+
+	checker := health.NewChecker(time.Minute, time.Second)
+	m := NewManager(db)
+	if err := m.SetHealthChecker(checker); err != nil {
+		t.Fatal(err)
+	}
+	if checker.GetStatus(existing.ID) == nil {
+		t.Fatal("Expected existing channels to be registered")
+	}
+
+	created, err := m.Create(&CreateRequest{Name: "new", BaseURL: "https://b.example.com", APIKey: "sk-b", Enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := checker.GetStatus(created.ID); status == nil || status.Status != health.StatusUnknown {
+		t.Fatalf("Expected the new channel to be registered as unknown, got %+v", status)
+	}
+
+	disabled := false
+	if _, err := m.Update(created.ID, &UpdateRequest{Enabled: &disabled}); err != nil {
+		t.Fatal(err)
+	}
+	if checker.GetStatus(created.ID) != nil {
+		t.Error("Expected a disabled channel to be unregistered")
+	}
+
+	if err := m.Delete(existing.ID); err != nil {
+		t.Fatal(err)
+	}
+	if checker.GetStatus(existing.ID) != nil {
+		t.Error("Expected a deleted channel to be unregistered")
+	}
+}
@@ -0,0 +1,164 @@
+package channel
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+)
+
+// RateLimit is the upstream quota left on a key, as reported by the
+// backend's rate limit headers
+type RateLimit struct {
+	// Remaining is the number of requests (or tokens) left in the window
+	Remaining int64
+	// Reset is the time until the window resets; zero when not reported
+	Reset time.Duration
+}
+
+// keyID identifies one key of one channel
+type keyID struct {
+	channelID int64
+	key       string
+}
+
+// keyState is what is known about a key's upstream quota
+type keyState struct {
+	remaining     int64
+	known         bool
+	resetAt       time.Time
+	cooldownUntil time.Time
+}
+
+// KeyPool chooses among the upstream API keys of each channel, so a channel
+// holding several keys of one account spreads load over their rate limits.
+// Requests go to the key with the most remaining quota, skipping keys that
+// are cooling down after a 429; keys that tie, such as keys whose quota is
+// not yet known, are used in round-robin order.
+type KeyPool struct {
+	mu     sync.Mutex
+	next   map[int64]int
+	states map[keyID]*keyState
+}
+
+// NewKeyPool creates a new key pool
+func NewKeyPool() *KeyPool {
+	return &KeyPool{
+		next:   make(map[int64]int),
+		states: make(map[keyID]*keyState),
+	}
+}
+
+// Next returns the key to use for the channel's next request
+func (p *KeyPool) Next(ch *database.Channel) string {
+	return p.pick(ch, time.Now())
+}
+
+// pick returns the key to use for the channel's next request at now
+func (p *KeyPool) pick(ch *database.Channel, now time.Time) string {
+	keys := ch.Keys()
+	if len(keys) == 1 {
+		return keys[0]
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	candidates := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if !p.coolingDown(ch.ID, key, now) {
+			candidates = append(candidates, key)
+		}
+	}
+	// With every key cooling down the request is still sent; the backend
+	// decides, and routing already steers new sessions elsewhere
+	if len(candidates) == 0 {
+		candidates = keys
+	}
+
+	var best []string
+	bestRemaining := int64(-1)
+	for _, key := range candidates {
+		remaining := p.remaining(ch.ID, key, now)
+		switch {
+		case remaining > bestRemaining:
+			best, bestRemaining = []string{key}, remaining
+		case remaining == bestRemaining:
+			best = append(best, key)
+		}
+	}
+
+	i := p.next[ch.ID] % len(best)
+	p.next[ch.ID] = i + 1
+	return best[i]
+}
+
+// remaining returns a key's known remaining quota, or the maximum when it is
+// unknown or its window has reset. Must be called with p.mu held.
+func (p *KeyPool) remaining(channelID int64, key string, now time.Time) int64 {
+	state := p.states[keyID{channelID, key}]
+	if state == nil || !state.known || (!state.resetAt.IsZero() && !now.Before(state.resetAt)) {
+		return math.MaxInt64
+	}
+	return state.remaining
+}
+
+// coolingDown reports whether a key is cooling down after a 429. Must be
+// called with p.mu held.
+func (p *KeyPool) coolingDown(channelID int64, key string, now time.Time) bool {
+	state := p.states[keyID{channelID, key}]
+	return state != nil && now.Before(state.cooldownUntil)
+}
+
+// state returns the state of a key, creating it when absent. Must be called
+// with p.mu held.
+func (p *KeyPool) state(channelID int64, key string) *keyState {
+	id := keyID{channelID, key}
+	state := p.states[id]
+	if state == nil {
+		state = &keyState{}
+		p.states[id] = state
+	}
+	return state
+}
+
+// Observe records the quota a backend reported for a key
+func (p *KeyPool) Observe(channelID int64, key string, limit RateLimit, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	state := p.state(channelID, key)
+	state.remaining = limit.Remaining
+	state.known = true
+	state.resetAt = time.Time{}
+	if limit.Reset > 0 {
+		state.resetAt = now.Add(limit.Reset)
+	}
+}
+
+// Cooldown takes a key out of rotation until the given time, e.g. after the
+// backend rate limited it
+func (p *KeyPool) Cooldown(channelID int64, key string, until time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	state := p.state(channelID, key)
+	if until.After(state.cooldownUntil) {
+		state.cooldownUntil = until
+	}
+}
+
+// Available returns the number of the channel's keys not cooling down at now
+func (p *KeyPool) Available(ch *database.Channel, now time.Time) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	available := 0
+	for _, key := range ch.Keys() {
+		if !p.coolingDown(ch.ID, key, now) {
+			available++
+		}
+	}
+	return available
+}
@@ -0,0 +1,91 @@
+package channel
+
+import (
+	"testing"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+)
+
+func TestKeyPoolRoundRobin(t *testing.T) {
+	pool := NewKeyPool()
+	ch := &database.Channel{ID: 1, APIKey: "sk-a", APIKeys: []string{"sk-b", "sk-c"}}
+
+	want := []string{"sk-a", "sk-b", "sk-c", "sk-a"}
+	for i, key := range want {
+		if got := pool.Next(ch); got != key {
+			t.Errorf("Request %d: expected %s, got %s", i, key, got)
+		}
+	}
+
+	// Channels rotate independently
+	other := &database.Channel{ID: 2, APIKey: "sk-x", APIKeys: []string{"sk-y"}}
+	if got := pool.Next(other); got != "sk-x" {
+		t.Errorf("Expected sk-x for another channel, got %s", got)
+	}
+
+	// Removing keys from a channel keeps the rotation in range
+	ch.APIKeys = []string{"sk-b"}
+	for range 3 {
+		if got := pool.Next(ch); got != "sk-a" && got != "sk-b" {
+			t.Errorf("Unexpected key %s", got)
+		}
+	}
+
+	if got := pool.Next(&database.Channel{ID: 3, APIKey: "sk-only"}); got != "sk-only" {
+		t.Errorf("Expected single key, got %s", got)
+	}
+}
+
+func TestKeyPoolPrefersRemainingQuota(t *testing.T) {
+	pool := NewKeyPool()
+	ch := &database.Channel{ID: 1, APIKey: "sk-a", APIKeys: []string{"sk-b", "sk-c"}}
+	now := time.Now()
+
+	// A key whose quota is unknown is tried before known, lower quotas
+	pool.Observe(ch.ID, "sk-a", RateLimit{Remaining: 10}, now)
+	pool.Observe(ch.ID, "sk-b", RateLimit{Remaining: 50, Reset: time.Minute}, now)
+	if got := pool.pick(ch, now); got != "sk-c" {
+		t.Errorf("Expected unmeasured key sk-c, got %s", got)
+	}
+
+	pool.Observe(ch.ID, "sk-c", RateLimit{Remaining: 5}, now)
+	if got := pool.pick(ch, now); got != "sk-b" {
+		t.Errorf("Expected key with most remaining quota, got %s", got)
+	}
+
+	// Once its window resets a key's quota is assumed full again
+	pool.Observe(ch.ID, "sk-b", RateLimit{Remaining: 1, Reset: time.Second}, now)
+	if got := pool.pick(ch, now.Add(2*time.Second)); got != "sk-b" {
+		t.Errorf("Expected reset key sk-b, got %s", got)
+	}
+}
+
+func TestKeyPoolSkipsKeysInCooldown(t *testing.T) {
+	pool := NewKeyPool()
+	ch := &database.Channel{ID: 1, APIKey: "sk-a", APIKeys: []string{"sk-b"}}
+	now := time.Now()
+
+	pool.Cooldown(ch.ID, "sk-a", now.Add(time.Minute))
+	for range 3 {
+		if got := pool.pick(ch, now); got != "sk-b" {
+			t.Fatalf("Expected sk-b while sk-a cools down, got %s", got)
+		}
+	}
+	if got := pool.Available(ch, now); got != 1 {
+		t.Errorf("Expected 1 available key, got %d", got)
+	}
+
+	// With every key cooling down requests still get a key
+	pool.Cooldown(ch.ID, "sk-b", now.Add(time.Minute))
+	if got := pool.Available(ch, now); got != 0 {
+		t.Errorf("Expected no available keys, got %d", got)
+	}
+	if got := pool.pick(ch, now); got == "" {
+		t.Error("Expected a key when all keys cool down")
+	}
+
+	if got := pool.Available(ch, now.Add(2*time.Minute)); got != 2 {
+		t.Errorf("Expected cooldowns to expire, got %d available", got)
+	}
+}
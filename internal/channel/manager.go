@@ -1,40 +1,166 @@
 package channel
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
+	"sync/atomic"
+	"time"
 
-	"github.com/gin-gonic/gin"
 	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/X0Ken/openai-gateway/pkg/health"
+	"github.com/gin-gonic/gin"
 )
 
 // Manager handles channel business logic
 type Manager struct {
-	db *database.DB
+	db         *database.DB
+	transports *Transports
+	// health, when set, tracks the health of every channel
+	health *health.Checker
+	// retry is the retry policy of channels without their own
+	retry atomic.Pointer[RetryPolicy]
 }
 
 // NewManager creates a new channel manager
 func NewManager(db *database.DB) *Manager {
-	return &Manager{db: db}
+	m := &Manager{db: db, transports: NewTransports(DefaultTransportOptions())}
+	m.SetRetryPolicy(DefaultRetryPolicy())
+	return m
+}
+
+// SetRetryPolicy replaces the retry policy of channels without their own.
+// It is safe to call while requests are served, such as on a config reload.
+func (m *Manager) SetRetryPolicy(p RetryPolicy) {
+	m.retry.Store(&p)
+}
+
+// RetryPolicy returns the retry policy of a channel's upstream requests:
+// the configured policy with the channel's override applied
+func (m *Manager) RetryPolicy(ch *database.Channel) RetryPolicy {
+	return m.retry.Load().Override(ch.RetryPolicy)
+}
+
+// SetTransportOptions replaces the options of the channels' HTTP clients.
+// It is meant to be called at startup, before any client is used.
+func (m *Manager) SetTransportOptions(opts TransportOptions) {
+	m.transports = NewTransports(opts)
+}
+
+// Client returns the shared HTTP client for a channel's upstream requests
+func (m *Manager) Client(ch *database.Channel) (*http.Client, error) {
+	return m.transports.Client(ch)
 }
 
 // CreateRequest represents a channel creation request
 type CreateRequest struct {
-	Name    string `json:"name" binding:"required"`
-	BaseURL string `json:"base_url" binding:"required"`
-	APIKey  string `json:"api_key" binding:"required"`
-	Weight  int    `json:"weight"`
-	Enabled bool   `json:"enabled"`
+	Name             string            `json:"name" binding:"required"`
+	Type             string            `json:"type"`
+	BaseURL          string            `json:"base_url" binding:"required"`
+	APIKey           string            `json:"api_key" binding:"required"`
+	APIKeys          []string          `json:"api_keys"`
+	Weight           int               `json:"weight"`
+	Enabled          bool              `json:"enabled"`
+	PathTemplates    map[string]string `json:"path_templates"`
+	Organization     string            `json:"organization"`
+	Project          string            `json:"project"`
+	APIVersion       string            `json:"api_version"`
+	Notes            string            `json:"notes"`
+	MaintenanceUntil string            `json:"maintenance_until"`
+	MaxConcurrency   int               `json:"max_concurrency"`
+	MaxBatchSize     int               `json:"max_batch_size"`
+	TestOnly         bool              `json:"test_only"`
+	Cost             float64           `json:"cost"`
+	ProxyURL         string            `json:"proxy_url"`
+	// RetryPolicy overrides fields of the configured retry policy
+	RetryPolicy *database.RetryPolicy `json:"retry_policy"`
 }
 
 // UpdateRequest represents a channel update request
 type UpdateRequest struct {
 	Name    string `json:"name"`
+	Type    string `json:"type"`
 	BaseURL string `json:"base_url"`
 	APIKey  string `json:"api_key"`
 	Weight  int    `json:"weight"`
 	Enabled *bool  `json:"enabled"`
+	// APIKeys replaces the channel's additional keys when present; an empty array clears them
+	APIKeys []string `json:"api_keys"`
+	// PathTemplates replaces the channel's templates when present; an empty object clears them
+	PathTemplates map[string]string `json:"path_templates"`
+	Organization  *string           `json:"organization"`
+	Project       *string           `json:"project"`
+	APIVersion    *string           `json:"api_version"`
+	Notes         *string           `json:"notes"`
+	// MaintenanceUntil sets the maintenance window end; an empty string clears it
+	MaintenanceUntil *string `json:"maintenance_until"`
+	// MaxConcurrency limits concurrent requests to the channel; 0 removes the limit
+	MaxConcurrency *int `json:"max_concurrency"`
+	// MaxBatchSize limits embeddings inputs per upstream request; 0 removes the limit
+	MaxBatchSize *int `json:"max_batch_size"`
+	// TestOnly keeps the channel out of routing while it is validated
+	TestOnly *bool `json:"test_only"`
+	// Cost is the channel's relative cost for cost-optimized routing; 0 unsets it
+	Cost *float64 `json:"cost"`
+	// ProxyURL sends the channel's requests through a proxy; an empty string
+	// restores the default
+	ProxyURL *string `json:"proxy_url"`
+	// RetryPolicy replaces the channel's retry policy override when present;
+	// an empty object restores the configured policy
+	RetryPolicy *database.RetryPolicy `json:"retry_policy"`
+	// MigrateSessions is the fraction of the channel's sticky sessions, from
+	// 0 to 1, to end after the update so they are routed afresh. It is
+	// applied by the admin API.
+	MigrateSessions float64 `json:"migrate_sessions"`
+}
+
+// ErrInvalidMigrateSessions is returned when migrate_sessions is not between 0 and 1
+var ErrInvalidMigrateSessions = errors.New("migrate_sessions must be between 0 and 1")
+
+// ErrInvalidAPIKeys is returned when a channel's additional API keys contain an empty key
+var ErrInvalidAPIKeys = errors.New("invalid api_keys")
+
+// validateAPIKeys checks that no additional API key is empty
+func validateAPIKeys(keys []string) error {
+	for _, key := range keys {
+		if key == "" {
+			return fmt.Errorf("%w: keys must not be empty", ErrInvalidAPIKeys)
+		}
+	}
+	return nil
+}
+
+// ErrInvalidType is returned when a channel's type is not a known backend API
+var ErrInvalidType = errors.New("invalid type")
+
+// ValidateType checks that a channel type is known. An empty type selects
+// the OpenAI API.
+func ValidateType(t string) error {
+	if t != "" && !slices.Contains(database.ChannelTypes, t) {
+		return fmt.Errorf("%w: must be one of %v", ErrInvalidType, database.ChannelTypes)
+	}
+	return nil
+}
+
+// ErrInvalidCost is returned when a channel's cost is negative
+var ErrInvalidCost = errors.New("invalid cost: must not be negative")
+
+// ErrInvalidMaintenanceTime is returned when maintenance_until is not an RFC 3339 timestamp
+var ErrInvalidMaintenanceTime = errors.New("invalid maintenance_until")
+
+// parseMaintenanceUntil parses an RFC 3339 timestamp, returning nil for an empty string
+func parseMaintenanceUntil(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: expected an RFC 3339 timestamp", ErrInvalidMaintenanceTime)
+	}
+	return &t, nil
 }
 
 // Create creates a new channel
@@ -42,18 +168,58 @@ func (m *Manager) Create(req *CreateRequest) (*database.Channel, error) {
 	if req.Weight <= 0 {
 		req.Weight = 10
 	}
+	if err := ValidateType(req.Type); err != nil {
+		return nil, err
+	}
+	if err := ValidatePathTemplates(req.PathTemplates); err != nil {
+		return nil, err
+	}
+	if err := validateAPIKeys(req.APIKeys); err != nil {
+		return nil, err
+	}
+	if req.Cost < 0 {
+		return nil, ErrInvalidCost
+	}
+	if err := ValidateProxyURL(req.ProxyURL); err != nil {
+		return nil, err
+	}
+	if err := ValidateRetryPolicy(req.RetryPolicy); err != nil {
+		return nil, err
+	}
+	if req.RetryPolicy.IsZero() {
+		req.RetryPolicy = nil
+	}
+	maintenanceUntil, err := parseMaintenanceUntil(req.MaintenanceUntil)
+	if err != nil {
+		return nil, err
+	}
 
 	channel := &database.Channel{
-		Name:    req.Name,
-		BaseURL: req.BaseURL,
-		APIKey:  req.APIKey,
-		Weight:  req.Weight,
-		Enabled: req.Enabled,
+		Name:             req.Name,
+		Type:             req.Type,
+		BaseURL:          req.BaseURL,
+		APIKey:           req.APIKey,
+		APIKeys:          req.APIKeys,
+		Weight:           req.Weight,
+		Enabled:          req.Enabled,
+		PathTemplates:    req.PathTemplates,
+		Organization:     req.Organization,
+		Project:          req.Project,
+		APIVersion:       req.APIVersion,
+		Notes:            req.Notes,
+		MaintenanceUntil: maintenanceUntil,
+		MaxConcurrency:   req.MaxConcurrency,
+		MaxBatchSize:     req.MaxBatchSize,
+		TestOnly:         req.TestOnly,
+		Cost:             req.Cost,
+		ProxyURL:         req.ProxyURL,
+		RetryPolicy:      req.RetryPolicy,
 	}
 
 	if err := m.db.CreateChannel(channel); err != nil {
 		return nil, err
 	}
+	m.Saved(channel)
 
 	return channel, nil
 }
@@ -82,33 +248,146 @@ func (m *Manager) Update(id int64, req *UpdateRequest) (*database.Channel, error
 	if channel == nil {
 		return nil, fmt.Errorf("channel not found")
 	}
+	if req.MigrateSessions < 0 || req.MigrateSessions > 1 {
+		return nil, ErrInvalidMigrateSessions
+	}
 
 	if req.Name != "" {
 		channel.Name = req.Name
 	}
+	if req.Type != "" {
+		if err := ValidateType(req.Type); err != nil {
+			return nil, err
+		}
+		channel.Type = req.Type
+	}
 	if req.BaseURL != "" {
 		channel.BaseURL = req.BaseURL
 	}
 	if req.APIKey != "" {
+		// New credentials clear an auth_failed status so the channel is routable again
+		if req.APIKey != channel.APIKey {
+			channel.Status = ""
+		}
 		channel.APIKey = req.APIKey
 	}
+	if req.APIKeys != nil {
+		if err := validateAPIKeys(req.APIKeys); err != nil {
+			return nil, err
+		}
+		if !slices.Equal(req.APIKeys, channel.APIKeys) {
+			channel.Status = ""
+		}
+		channel.APIKeys = req.APIKeys
+	}
 	if req.Weight > 0 {
 		channel.Weight = req.Weight
 	}
 	if req.Enabled != nil {
 		channel.Enabled = *req.Enabled
 	}
+	if req.PathTemplates != nil {
+		if err := ValidatePathTemplates(req.PathTemplates); err != nil {
+			return nil, err
+		}
+		channel.PathTemplates = req.PathTemplates
+	}
+	if req.Organization != nil {
+		channel.Organization = *req.Organization
+	}
+	if req.Project != nil {
+		channel.Project = *req.Project
+	}
+	if req.APIVersion != nil {
+		channel.APIVersion = *req.APIVersion
+	}
+	if req.Notes != nil {
+		channel.Notes = *req.Notes
+	}
+	if req.MaintenanceUntil != nil {
+		maintenanceUntil, err := parseMaintenanceUntil(*req.MaintenanceUntil)
+		if err != nil {
+			return nil, err
+		}
+		channel.MaintenanceUntil = maintenanceUntil
+	}
+	if req.MaxConcurrency != nil {
+		channel.MaxConcurrency = *req.MaxConcurrency
+	}
+	if req.MaxBatchSize != nil {
+		channel.MaxBatchSize = *req.MaxBatchSize
+	}
+	if req.TestOnly != nil {
+		channel.TestOnly = *req.TestOnly
+	}
+	if req.Cost != nil {
+		if *req.Cost < 0 {
+			return nil, ErrInvalidCost
+		}
+		channel.Cost = *req.Cost
+	}
+	if req.ProxyURL != nil {
+		if err := ValidateProxyURL(*req.ProxyURL); err != nil {
+			return nil, err
+		}
+		channel.ProxyURL = *req.ProxyURL
+	}
+	if req.RetryPolicy != nil {
+		if err := ValidateRetryPolicy(req.RetryPolicy); err != nil {
+			return nil, err
+		}
+		channel.RetryPolicy = req.RetryPolicy
+		if req.RetryPolicy.IsZero() {
+			channel.RetryPolicy = nil
+		}
+	}
 
 	if err := m.db.UpdateChannel(channel); err != nil {
 		return nil, err
 	}
+	m.Saved(channel)
 
 	return channel, nil
 }
 
 // Delete deletes a channel
 func (m *Manager) Delete(id int64) error {
-	return m.db.DeleteChannel(id)
+	if err := m.db.DeleteChannel(id); err != nil {
+		return err
+	}
+	m.Deleted(id)
+	return nil
+}
+
+// Saved brings the health checker up to date with a channel created or
+// updated in the database, by the Manager or by anything else writing
+// channels, such as the reconciler
+func (m *Manager) Saved(channel *database.Channel) {
+	if channel.Enabled {
+		m.registerHealth(channel)
+	} else if m.health != nil {
+		m.health.UnregisterChannel(channel.ID)
+	}
+}
+
+// Deleted drops the connections and health state of a channel deleted
+// from the database
+func (m *Manager) Deleted(id int64) {
+	m.transports.Forget(id)
+	if m.health != nil {
+		m.health.UnregisterChannel(id)
+	}
+}
+
+// StatusForError maps a Manager error to an HTTP status code
+func StatusForError(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidPathTemplate), errors.Is(err, ErrInvalidMaintenanceTime), errors.Is(err, ErrInvalidAPIKeys), errors.Is(err, ErrInvalidCost), errors.Is(err, ErrInvalidType), errors.Is(err, ErrInvalidMigrateSessions), errors.Is(err, ErrInvalidProxyURL), errors.Is(err, ErrInvalidRetryPolicy):
+		return http.StatusBadRequest
+	case errors.Is(err, database.ErrDuplicate):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
 }
 
 // Handler handles HTTP requests for channel management
@@ -140,7 +419,7 @@ func (h *Handler) Create(c *gin.Context) {
 
 	channel, err := h.manager.Create(&req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(StatusForError(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -196,7 +475,7 @@ func (h *Handler) Update(c *gin.Context) {
 
 	channel, err := h.manager.Update(id, &req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(StatusForError(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -0,0 +1,100 @@
+package channel
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+)
+
+// RetryPolicy is how a failed upstream request is retried on the same
+// channel before the failure is returned
+type RetryPolicy struct {
+	// MaxAttempts counts the first attempt; 1 disables retries
+	MaxAttempts int
+	// InitialDelay is the wait before the first retry, multiplied by
+	// Multiplier for each further retry and capped at MaxDelay
+	InitialDelay time.Duration
+	Multiplier   float64
+	MaxDelay     time.Duration
+	// RetryableStatuses are the backend statuses worth retrying. Transport
+	// errors, such as a refused connection or a timeout, are always retried.
+	RetryableStatuses []int
+}
+
+// DefaultRetryPolicy returns the policy used when none is configured. It
+// makes a single attempt, so requests are not retried.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:       1,
+		InitialDelay:      500 * time.Millisecond,
+		Multiplier:        2,
+		MaxDelay:          5 * time.Second,
+		RetryableStatuses: []int{429, 500, 502, 503, 504},
+	}
+}
+
+// Override returns the policy with the fields set in a channel's override
+// replacing its own
+func (p RetryPolicy) Override(o *database.RetryPolicy) RetryPolicy {
+	if o == nil {
+		return p
+	}
+	if o.MaxAttempts > 0 {
+		p.MaxAttempts = o.MaxAttempts
+	}
+	if o.InitialDelayMs > 0 {
+		p.InitialDelay = time.Duration(o.InitialDelayMs) * time.Millisecond
+	}
+	if o.Multiplier > 0 {
+		p.Multiplier = o.Multiplier
+	}
+	if o.MaxDelayMs > 0 {
+		p.MaxDelay = time.Duration(o.MaxDelayMs) * time.Millisecond
+	}
+	if len(o.RetryableStatuses) > 0 {
+		p.RetryableStatuses = o.RetryableStatuses
+	}
+	return p
+}
+
+// Delay returns the wait before retrying after the given failed attempt,
+// counted from 1
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	d := float64(p.InitialDelay) * math.Pow(p.Multiplier, float64(attempt-1))
+	if d > float64(p.MaxDelay) {
+		return p.MaxDelay
+	}
+	return time.Duration(d)
+}
+
+// Retryable reports whether a backend status is worth retrying
+func (p RetryPolicy) Retryable(status int) bool {
+	return slices.Contains(p.RetryableStatuses, status)
+}
+
+// ErrInvalidRetryPolicy is returned when a retry policy has out of range fields
+var ErrInvalidRetryPolicy = errors.New("invalid retry_policy")
+
+// ValidateRetryPolicy checks a channel's retry policy override. Zero fields
+// are valid, since they inherit the configured policy.
+func ValidateRetryPolicy(p *database.RetryPolicy) error {
+	if p == nil {
+		return nil
+	}
+	if p.MaxAttempts < 0 || p.InitialDelayMs < 0 || p.MaxDelayMs < 0 {
+		return fmt.Errorf("%w: max_attempts and delays must not be negative", ErrInvalidRetryPolicy)
+	}
+	if p.Multiplier != 0 && p.Multiplier < 1 {
+		return fmt.Errorf("%w: multiplier must be at least 1", ErrInvalidRetryPolicy)
+	}
+	for _, status := range p.RetryableStatuses {
+		if status < 400 || status > 599 {
+			return fmt.Errorf("%w: retryable_statuses must be 4xx or 5xx statuses, got %d", ErrInvalidRetryPolicy, status)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package channel
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{InitialDelay: 100 * time.Millisecond, Multiplier: 2, MaxDelay: time.Second}
+	want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second}
+	for i, w := range want {
+		if got := p.Delay(i + 1); got != w {
+			t.Errorf("Delay(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+}
+
+func TestRetryPolicyOverride(t *testing.T) {
+	p := DefaultRetryPolicy().Override(&database.RetryPolicy{MaxAttempts: 4, RetryableStatuses: []int{503}})
+	if p.MaxAttempts != 4 || p.InitialDelay != 500*time.Millisecond || p.Multiplier != 2 {
+		t.Errorf("Expected max_attempts overridden and delays inherited, got %+v", p)
+	}
+	if p.Retryable(502) || !p.Retryable(503) {
+		t.Errorf("Expected only 503 retryable, got %v", p.RetryableStatuses)
+	}
+	if got := DefaultRetryPolicy().Override(nil); got.MaxAttempts != 1 {
+		t.Errorf("Expected the default policy without an override, got %+v", got)
+	}
+}
+
+func TestValidateRetryPolicy(t *testing.T) {
+	valid := []*database.RetryPolicy{nil, {}, {MaxAttempts: 3, Multiplier: 1.5, RetryableStatuses: []int{429, 503}}}
+	for _, p := range valid {
+		if err := ValidateRetryPolicy(p); err != nil {
+			t.Errorf("Expected %+v to be valid, got %v", p, err)
+		}
+	}
+
+	invalid := []*database.RetryPolicy{{MaxAttempts: -1}, {Multiplier: 0.5}, {InitialDelayMs: -5}, {RetryableStatuses: []int{200}}}
+	for _, p := range invalid {
+		if err := ValidateRetryPolicy(p); !errors.Is(err, ErrInvalidRetryPolicy) {
+			t.Errorf("Expected %+v to be rejected, got %v", p, err)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package channel
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+)
+
+// TransportOptions tunes the HTTP clients used to reach upstream channels
+type TransportOptions struct {
+	// MaxIdleConnsPerHost is the number of keep-alive connections kept
+	// open to a channel's backend
+	MaxIdleConnsPerHost int
+	// IdleConnTimeout closes keep-alive connections unused for this long
+	IdleConnTimeout     time.Duration
+	TLSHandshakeTimeout time.Duration
+	// Timeout bounds how long a backend may take to send its response
+	// headers, and how long a non-streaming request may take as a whole.
+	// Reading a streamed response is not bounded. 0 disables it.
+	Timeout time.Duration
+	// Proxy is the proxy URL of channels without their own; empty uses the
+	// HTTP_PROXY and HTTPS_PROXY environment variables
+	Proxy string
+	// Wrap, when set, wraps the transport of each channel, such as to
+	// inject faults in tests
+	Wrap func(ch *database.Channel, rt http.RoundTripper) http.RoundTripper
+}
+
+// DefaultTransportOptions returns the options used when none are configured
+func DefaultTransportOptions() TransportOptions {
+	return TransportOptions{
+		MaxIdleConnsPerHost: 32,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+		Timeout:             60 * time.Second,
+	}
+}
+
+// ErrInvalidProxyURL is returned when a proxy URL is not an absolute http,
+// https or socks5 URL
+var ErrInvalidProxyURL = errors.New("invalid proxy_url")
+
+// ValidateProxyURL checks that a proxy URL can be used. An empty URL selects
+// the default proxy.
+func ValidateProxyURL(proxy string) error {
+	if proxy == "" {
+		return nil
+	}
+	u, err := url.Parse(proxy)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("%w: expected an absolute URL", ErrInvalidProxyURL)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+		return nil
+	}
+	return fmt.Errorf("%w: scheme must be http, https or socks5", ErrInvalidProxyURL)
+}
+
+// channelClient is the client of one channel and the proxy it was built for
+type channelClient struct {
+	proxy  string
+	client *http.Client
+}
+
+// Transports keeps one HTTP client per channel, so requests to a backend
+// reuse its keep-alive connections instead of dialing and negotiating TLS
+// every time. A channel's client is rebuilt when its proxy changes.
+type Transports struct {
+	mu      sync.Mutex
+	opts    TransportOptions
+	clients map[int64]*channelClient
+}
+
+// NewTransports creates an empty set of channel clients
+func NewTransports(opts TransportOptions) *Transports {
+	return &Transports{opts: opts, clients: make(map[int64]*channelClient)}
+}
+
+// Client returns the HTTP client for a channel's upstream requests
+func (t *Transports) Client(ch *database.Channel) (*http.Client, error) {
+	proxy := ch.ProxyURL
+	if proxy == "" {
+		proxy = t.opts.Proxy
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if cc, ok := t.clients[ch.ID]; ok {
+		if cc.proxy == proxy {
+			return cc.client, nil
+		}
+		cc.client.CloseIdleConnections()
+	}
+
+	transport, err := t.newTransport(proxy)
+	if err != nil {
+		return nil, err
+	}
+	var rt http.RoundTripper = transport
+	if t.opts.Wrap != nil {
+		rt = t.opts.Wrap(ch, transport)
+	}
+	if t.opts.Timeout > 0 {
+		rt = &deadlineTransport{next: rt, timeout: t.opts.Timeout}
+	}
+	client := &http.Client{Transport: rt}
+	t.clients[ch.ID] = &channelClient{proxy: proxy, client: client}
+	return client, nil
+}
+
+// Forget closes a channel's idle connections and drops its client
+func (t *Transports) Forget(channelID int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if cc, ok := t.clients[channelID]; ok {
+		cc.client.CloseIdleConnections()
+		delete(t.clients, channelID)
+	}
+}
+
+// newTransport builds a transport sending requests through proxy
+func (t *Transports) newTransport(proxy string) (*http.Transport, error) {
+	proxyFunc := http.ProxyFromEnvironment
+	if proxy != "" {
+		if err := ValidateProxyURL(proxy); err != nil {
+			return nil, err
+		}
+		u, _ := url.Parse(proxy)
+		proxyFunc = http.ProxyURL(u)
+	}
+
+	return &http.Transport{
+		Proxy: proxyFunc,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConnsPerHost:   t.opts.MaxIdleConnsPerHost,
+		IdleConnTimeout:       t.opts.IdleConnTimeout,
+		TLSHandshakeTimeout:   t.opts.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: t.opts.Timeout,
+		ExpectContinueTimeout: time.Second,
+		TLSClientConfig:       &tls.Config{MinVersion: tls.VersionTLS12},
+	}, nil
+}
+
+// streamingKey marks the context of a streamed upstream request
+type streamingKey struct{}
+
+// Streaming marks ctx as the context of a streamed upstream request. Its
+// response may be read for as long as the stream lasts, where other
+// requests must complete within the transport's timeout.
+func Streaming(ctx context.Context) context.Context {
+	return context.WithValue(ctx, streamingKey{}, true)
+}
+
+// deadlineTransport bounds a non-streaming request, reading its response
+// included, by a timeout. Unlike http.Client.Timeout it leaves streams
+// alone.
+type deadlineTransport struct {
+	next    http.RoundTripper
+	timeout time.Duration
+}
+
+// RoundTrip sends the request with a deadline unless it is streamed. The
+// deadline is released when the response body is closed.
+func (t *deadlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if streaming, _ := req.Context().Value(streamingKey{}).(bool); streaming {
+		return t.next.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), t.timeout)
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// CloseIdleConnections closes the idle connections of the wrapped transport
+func (t *deadlineTransport) CloseIdleConnections() {
+	if c, ok := t.next.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// cancelBody releases a request's deadline when its response body is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close closes the body and releases the deadline
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,104 @@
+package channel
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+)
+
+func TestTransportsReuseConnections(t *testing.T) {
+	var conns atomic.Int32
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	backend.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	backend.Start()
+	defer backend.Close()
+
+	transports := NewTransports(DefaultTransportOptions())
+	ch := &database.Channel{ID: 1, BaseURL: backend.URL}
+
+	for i := 0; i < 5; i++ {
+		client, err := transports.Client(ch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.Get(backend.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	if n := conns.Load(); n != 1 {
+		t.Errorf("Expected sequential requests to share 1 connection, got %d", n)
+	}
+
+	// A new proxy gets a new client; an invalid one is rejected
+	first, _ := transports.Client(ch)
+	ch.ProxyURL = "http://proxy.example.com:3128"
+	if second, err := transports.Client(ch); err != nil || second == first {
+		t.Errorf("Expected a new client for a changed proxy, got %v", err)
+	}
+	ch.ProxyURL = "ftp://proxy.example.com"
+	if _, err := transports.Client(ch); !errors.Is(err, ErrInvalidProxyURL) {
+		t.Errorf("Expected ErrInvalidProxyURL, got %v", err)
+	}
+}
+
+func TestTransportsTimeout(t *testing.T) {
+	// The backend answers at once but takes longer than the timeout to
+	// finish its body
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow-headers" {
+			time.Sleep(300 * time.Millisecond)
+		}
+		w.Write([]byte("data: 1\n\n"))
+		w.(http.Flusher).Flush()
+		time.Sleep(300 * time.Millisecond)
+		w.Write([]byte("data: 2\n\n"))
+	}))
+	defer backend.Close()
+
+	opts := DefaultTransportOptions()
+	opts.Timeout = 100 * time.Millisecond
+	client, err := NewTransports(opts).Client(&database.Channel{ID: 1, BaseURL: backend.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func(ctx context.Context, path string) (string, error) {
+		req, _ := http.NewRequestWithContext(ctx, "GET", backend.URL+path, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	// A stream is read for as long as it lasts
+	if body, err := get(Streaming(context.Background()), "/"); err != nil || body != "data: 1\n\ndata: 2\n\n" {
+		t.Errorf("Expected the whole stream, got %q (%v)", body, err)
+	}
+	// Other requests must complete within the timeout
+	if _, err := get(context.Background(), "/"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected a non-streaming request to time out, got %v", err)
+	}
+	// Streams must still start within it
+	if _, err := get(Streaming(context.Background()), "/slow-headers"); err == nil {
+		t.Error("Expected a stream without headers in time to fail")
+	}
+}
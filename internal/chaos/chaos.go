@@ -0,0 +1,178 @@
+// Package chaos injects faults into upstream requests for testing: added
+// latency, 5xx responses and streams dropped partway through. It lets
+// failover, retries and circuit breakers be exercised against healthy
+// backends. It must never be enabled in production.
+package chaos
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/internal/metrics"
+	"github.com/X0Ken/openai-gateway/pkg/database"
+)
+
+// DefaultErrorStatus is the status of injected errors without one
+const DefaultErrorStatus = http.StatusServiceUnavailable
+
+// Fault describes the faults injected into the requests of some channels.
+// Each rate is the share of requests affected, from 0 to 1, drawn
+// independently.
+type Fault struct {
+	// Channels are glob patterns of the channel names affected; empty
+	// matches every channel
+	Channels []string
+	// Latency is added before LatencyRate of the requests are sent
+	Latency     time.Duration
+	LatencyRate float64
+	// ErrorRate of the requests are answered with ErrorStatus without
+	// reaching the backend
+	ErrorRate   float64
+	ErrorStatus int
+	// DropRate of the responses fail after DropAfterBytes bytes of their
+	// body, as when a backend dies in the middle of a stream. Shorter
+	// responses complete normally.
+	DropRate       float64
+	DropAfterBytes int
+}
+
+// Injector wraps the transports of channels with their faults
+type Injector struct {
+	faults []Fault
+	rand   func() float64
+}
+
+// New creates an injector. For each channel, the first fault matching its
+// name applies.
+func New(faults []Fault) *Injector {
+	return &Injector{faults: faults, rand: rand.Float64}
+}
+
+// Wrap returns next with the faults of ch injected, or next itself when no
+// fault matches the channel
+func (i *Injector) Wrap(ch *database.Channel, next http.RoundTripper) http.RoundTripper {
+	for _, fault := range i.faults {
+		if matches(fault.Channels, ch.Name) {
+			if fault.ErrorStatus == 0 {
+				fault.ErrorStatus = DefaultErrorStatus
+			}
+			return &transport{next: next, channel: ch.Name, fault: fault, rand: i.rand}
+		}
+	}
+	return next
+}
+
+// matches reports whether a channel name matches any of the patterns
+func matches(patterns []string, name string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// transport injects a fault into a channel's requests
+type transport struct {
+	next    http.RoundTripper
+	channel string
+	fault   Fault
+	rand    func() float64
+}
+
+// RoundTrip delays, fails or truncates a request according to the fault
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	f := t.fault
+	if f.Latency > 0 && t.rand() < f.LatencyRate {
+		metrics.RecordChaosFault(t.channel, metrics.ChaosLatency)
+		if err := sleep(req.Context(), f.Latency); err != nil {
+			return nil, err
+		}
+	}
+
+	if t.rand() < f.ErrorRate {
+		metrics.RecordChaosFault(t.channel, metrics.ChaosError)
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return errorResponse(req, f.ErrorStatus), nil
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || t.rand() >= f.DropRate {
+		return resp, err
+	}
+	metrics.RecordChaosFault(t.channel, metrics.ChaosDrop)
+	resp.Body = &dropBody{body: resp.Body, remaining: f.DropAfterBytes}
+	resp.ContentLength = -1
+	resp.Header.Del("Content-Length")
+	return resp, nil
+}
+
+// CloseIdleConnections closes the idle connections of the wrapped transport
+func (t *transport) CloseIdleConnections() {
+	if c, ok := t.next.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// sleep waits for d, returning early with the context's error when the
+// request is cancelled
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// errorResponse builds an OpenAI-style error response with the status
+func errorResponse(req *http.Request, status int) *http.Response {
+	body := fmt.Sprintf(`{"error":{"message":"chaos: injected %d","type":"server_error","code":"chaos"}}`, status)
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// dropBody reads a response body up to a limit, then fails as a connection
+// closed by the backend would
+type dropBody struct {
+	body      io.ReadCloser
+	remaining int
+}
+
+func (d *dropBody) Read(p []byte) (int, error) {
+	if d.remaining <= 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	if len(p) > d.remaining {
+		p = p[:d.remaining]
+	}
+	n, err := d.body.Read(p)
+	d.remaining -= n
+	return n, err
+}
+
+func (d *dropBody) Close() error {
+	return d.body.Close()
+}
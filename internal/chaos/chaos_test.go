@@ -0,0 +1,90 @@
+package chaos
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/internal/metrics"
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// newClient returns a client for ch with the injector's faults and a fixed
+// draw for every rate
+func newClient(i *Injector, ch *database.Channel, draw float64) *http.Client {
+	i.rand = func() float64 { return draw }
+	return &http.Client{Transport: i.Wrap(ch, http.DefaultTransport)}
+}
+
+func TestInjectedFaults(t *testing.T) {
+	var calls atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Write([]byte("data: " + strings.Repeat("x", 100) + "\n\n"))
+	}))
+	defer backend.Close()
+
+	flaky := &database.Channel{Name: "flaky-1"}
+	injector := New([]Fault{
+		{Channels: []string{"slow-*"}, Latency: 50 * time.Millisecond, LatencyRate: 0.5},
+		{Channels: []string{"flaky-*"}, ErrorRate: 0.3, DropRate: 0.6, DropAfterBytes: 10},
+	})
+
+	// Draws below the error rate answer without reaching the backend
+	resp, err := newClient(injector, flaky, 0.1).Get(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != DefaultErrorStatus || !strings.Contains(string(body), `"code":"chaos"`) || calls.Load() != 0 {
+		t.Errorf("Expected an injected 503 without a backend call, got %d %s after %d calls", resp.StatusCode, body, calls.Load())
+	}
+	if got := testutil.ToFloat64(metrics.ChaosFaults.WithLabelValues("flaky-1", metrics.ChaosError)); got != 1 {
+		t.Errorf("Expected 1 injected error recorded, got %v", got)
+	}
+
+	// Draws below the drop rate cut the body off
+	resp, err = newClient(injector, flaky, 0.5).Get(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !errors.Is(err, io.ErrUnexpectedEOF) || len(body) != 10 {
+		t.Errorf("Expected the body dropped after 10 bytes, got %d bytes and %v", len(body), err)
+	}
+
+	// Higher draws pass through
+	resp, err = newClient(injector, flaky, 0.9).Get(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusOK || len(body) != 108 {
+		t.Errorf("Expected the full response, got %d with %d bytes and %v", resp.StatusCode, len(body), err)
+	}
+
+	// Latency applies before the request is sent
+	start := time.Now()
+	resp, err = newClient(injector, &database.Channel{Name: "slow-1"}, 0.2).Get(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected 50ms of injected latency, took %s", elapsed)
+	}
+
+	// Channels matching no fault keep their transport
+	if rt := injector.Wrap(&database.Channel{Name: "stable"}, http.DefaultTransport); rt != http.DefaultTransport {
+		t.Error("Expected an unmatched channel's transport unwrapped")
+	}
+}
@@ -0,0 +1,165 @@
+// Package cluster tracks the gateway replicas sharing a cluster store. Each
+// replica publishes a heartbeat with its version, start time and request
+// rate, so a rolling deploy can be followed from any replica.
+package cluster
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/internal/version"
+	"github.com/X0Ken/openai-gateway/pkg/store"
+	"github.com/gin-gonic/gin"
+)
+
+// HeartbeatInterval is how often a replica publishes its heartbeat
+const HeartbeatInterval = 10 * time.Second
+
+// staleAfter is how long after its last heartbeat a replica is considered
+// gone and removed from the member set
+const staleAfter = 3 * HeartbeatInterval
+
+// membersSet is the store set holding one heartbeat per replica
+const membersSet = "cluster:members"
+
+// Instance is the latest heartbeat of a replica
+type Instance struct {
+	ID        string    `json:"id"`
+	Hostname  string    `json:"hostname"`
+	Version   string    `json:"version"`
+	Commit    string    `json:"commit,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	LastSeen  time.Time `json:"last_seen"`
+	// Requests is the number of requests served since the replica started
+	Requests int64 `json:"requests"`
+	// RequestRate is the requests per second between the last two heartbeats
+	RequestRate float64 `json:"request_rate"`
+
+	// UptimeSeconds and Self are computed when instances are listed
+	UptimeSeconds int64 `json:"uptime_seconds"`
+	Self          bool  `json:"self"`
+}
+
+// Registry publishes this replica's heartbeat and lists the replicas of the
+// cluster
+type Registry struct {
+	members  store.Members
+	requests atomic.Int64
+	now      func() time.Time
+
+	mu   sync.Mutex
+	self Instance
+	// lastRequests is the request count at the previous heartbeat
+	lastRequests int64
+}
+
+// NewRegistry creates the registry of this replica. Its ID is the hostname
+// with a random suffix, so a restarted replica is told apart from its
+// previous run.
+func NewRegistry(members store.Members) *Registry {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "gateway"
+	}
+	suffix := make([]byte, 3)
+	rand.Read(suffix)
+
+	info := version.Get()
+	commit := info.Commit
+	if len(commit) > 12 {
+		commit = commit[:12]
+	}
+	now := time.Now()
+	return &Registry{
+		members: members,
+		now:     time.Now,
+		self: Instance{
+			ID:        hostname + "-" + hex.EncodeToString(suffix),
+			Hostname:  hostname,
+			Version:   info.Version,
+			Commit:    commit,
+			StartedAt: now,
+			LastSeen:  now,
+		},
+	}
+}
+
+// ID returns this replica's ID
+func (r *Registry) ID() string {
+	return r.self.ID
+}
+
+// Middleware counts the requests served by this replica
+func (r *Registry) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		r.requests.Add(1)
+		c.Next()
+	}
+}
+
+// Heartbeat publishes this replica's state to the member set
+func (r *Registry) Heartbeat(ctx context.Context) error {
+	r.mu.Lock()
+	now := r.now()
+	requests := r.requests.Load()
+	if elapsed := now.Sub(r.self.LastSeen).Seconds(); elapsed > 0 {
+		r.self.RequestRate = float64(requests-r.lastRequests) / elapsed
+	}
+	r.self.Requests = requests
+	r.self.LastSeen = now
+	r.lastRequests = requests
+	data, err := json.Marshal(r.self)
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return r.members.SetMember(ctx, membersSet, r.self.ID, data)
+}
+
+// Leave removes this replica from the member set on shutdown
+func (r *Registry) Leave(ctx context.Context) error {
+	return r.members.DeleteMember(ctx, membersSet, r.self.ID)
+}
+
+// Instances lists the replicas that sent a heartbeat recently, sorted by
+// ID. Replicas that stopped without leaving are removed once stale.
+func (r *Registry) Instances(ctx context.Context) ([]Instance, error) {
+	members, err := r.members.ListMembers(ctx, membersSet)
+	if err != nil {
+		return nil, err
+	}
+
+	now := r.now()
+	instances := make([]Instance, 0, len(members))
+	for id, data := range members {
+		var instance Instance
+		if err := json.Unmarshal(data, &instance); err != nil {
+			log.Printf("Ignoring malformed heartbeat of cluster member %s: %v", id, err)
+			continue
+		}
+		if now.Sub(instance.LastSeen) > staleAfter {
+			if err := r.members.DeleteMember(ctx, membersSet, id); err != nil {
+				log.Printf("Failed to remove stale cluster member %s: %v", id, err)
+			}
+			continue
+		}
+		instance.UptimeSeconds = int64(now.Sub(instance.StartedAt).Seconds())
+		instance.Self = id == r.self.ID
+		instances = append(instances, instance)
+	}
+
+	slices.SortFunc(instances, func(a, b Instance) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	return instances, nil
+}
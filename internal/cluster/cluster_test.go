@@ -0,0 +1,69 @@
+package cluster
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/pkg/store"
+)
+
+func TestRegistry(t *testing.T) {
+	mem := store.NewMemory()
+	ctx := context.Background()
+
+	now := time.Now()
+	clock := func() time.Time { return now }
+	a, b := NewRegistry(mem), NewRegistry(mem)
+	for _, r := range []*Registry{a, b} {
+		r.now = clock
+		r.self.StartedAt, r.self.LastSeen = now, now
+	}
+	if a.ID() == b.ID() {
+		t.Fatalf("Expected distinct IDs, got %s twice", a.ID())
+	}
+
+	now = now.Add(10 * time.Second)
+	for i := 0; i < 50; i++ {
+		a.requests.Add(1)
+	}
+	if err := a.Heartbeat(ctx); err != nil {
+		t.Fatal(err)
+	}
+	b.Heartbeat(ctx)
+
+	instances, err := a.Instances(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(instances) != 2 {
+		t.Fatalf("Expected 2 instances, got %+v", instances)
+	}
+	for _, instance := range instances {
+		if instance.ID == a.ID() {
+			if !instance.Self || instance.Requests != 50 || instance.RequestRate != 5 || instance.UptimeSeconds != 10 {
+				t.Errorf("Unexpected own instance %+v", instance)
+			}
+		} else if instance.Self || instance.RequestRate != 0 {
+			t.Errorf("Unexpected peer instance %+v", instance)
+		}
+	}
+
+	// A replica that stops sending heartbeats is dropped once stale
+	now = now.Add(staleAfter)
+	a.Heartbeat(ctx)
+	now = now.Add(time.Second)
+	instances, _ = a.Instances(ctx)
+	if len(instances) != 1 || instances[0].ID != a.ID() {
+		t.Errorf("Expected only the live instance, got %+v", instances)
+	}
+	if members, _ := mem.ListMembers(ctx, membersSet); len(members) != 1 {
+		t.Errorf("Expected the stale member to be removed, got %d members", len(members))
+	}
+
+	// A replica leaving on shutdown is removed at once
+	a.Leave(ctx)
+	if instances, _ = b.Instances(ctx); len(instances) != 0 {
+		t.Errorf("Expected no instances after leaving, got %+v", instances)
+	}
+}
@@ -2,8 +2,14 @@ package config
 
 import (
 	"fmt"
+	"log"
 	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"gopkg.in/yaml.v3"
@@ -13,79 +19,545 @@ import (
 type Config struct {
 	Server      ServerConfig      `yaml:"server"`
 	Database    DatabaseConfig    `yaml:"database"`
+	Backup      BackupConfig      `yaml:"backup"`
 	HealthCheck HealthCheckConfig `yaml:"health_check"`
+	Breaker     BreakerConfig     `yaml:"circuit_breaker"`
 	Session     SessionConfig     `yaml:"session"`
 	Metrics     MetricsConfig     `yaml:"metrics"`
+	SCIM        SCIMConfig        `yaml:"scim"`
+	Kubernetes  KubernetesConfig  `yaml:"kubernetes"`
+	Cluster     ClusterConfig     `yaml:"cluster"`
+	Alerts      AlertsConfig      `yaml:"alerts"`
+	ErrorBudget ErrorBudgetConfig `yaml:"error_budget"`
+	Routing     RoutingConfig     `yaml:"routing"`
+	SLO         SLOConfig         `yaml:"slo"`
+	Bootstrap   BootstrapConfig   `yaml:"bootstrap"`
+	Dedup       DedupConfig       `yaml:"dedup"`
+	StatusPages StatusPagesConfig `yaml:"status_pages"`
+	Probes      ProbesConfig      `yaml:"probes"`
+	Quality     QualityConfig     `yaml:"quality"`
+	Admin       AdminConfig       `yaml:"admin"`
+	Usage       UsageConfig       `yaml:"usage"`
+	Upstream    UpstreamConfig    `yaml:"upstream"`
+	Replay      ReplayConfig      `yaml:"replay"`
+	Chaos       ChaosConfig       `yaml:"chaos"`
 }
 
 // ServerConfig holds HTTP server configuration
 type ServerConfig struct {
-	Port         int    `yaml:"port"`
-	Host         string `yaml:"host"`
-	ReadTimeout  int    `yaml:"read_timeout"`
-	WriteTimeout int    `yaml:"write_timeout"`
+	Port int    `yaml:"port"`
+	Host string `yaml:"host"`
+	// ReadHeaderTimeout is the seconds a client has to send its request
+	// headers and ReadTimeout the seconds to send the whole request, body
+	// included; 0 disables either
+	ReadHeaderTimeout int `yaml:"read_header_timeout"`
+	ReadTimeout       int `yaml:"read_timeout"`
+	// WriteTimeout is accepted but not applied: a write deadline would cut
+	// off streams, which proxy_timeout and stream_heartbeat govern instead
+	WriteTimeout int `yaml:"write_timeout"`
+	// AdminTimeout and ProxyTimeout are the seconds admin and OpenAI API
+	// handlers have to start their response; 0 disables the deadline
+	AdminTimeout int `yaml:"admin_timeout"`
+	ProxyTimeout int `yaml:"proxy_timeout"`
+	// StreamHeartbeat is the seconds a stream may be silent before a ping
+	// comment is sent to keep proxies from closing it; 0 disables pings
+	StreamHeartbeat int `yaml:"stream_heartbeat"`
+	// ShutdownTimeout is the seconds requests in flight, streams included,
+	// have to finish after a SIGTERM or SIGINT before they are cut off
+	ShutdownTimeout int `yaml:"shutdown_timeout"`
+	// TrustedProxies lists the addresses and CIDR ranges whose
+	// X-Forwarded-For header is believed when reading client addresses
+	TrustedProxies []string  `yaml:"trusted_proxies"`
+	TLS            TLSConfig `yaml:"tls"`
+}
+
+// TLSConfig holds the certificate the server terminates HTTPS with
+type TLSConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// ReloadInterval is the seconds between checks of the certificate
+	// files, which are reloaded once they change; 0 disables reloading
+	ReloadInterval int `yaml:"reload_interval"`
+	// RedirectHTTP serves a redirect to HTTPS on HTTPPort
+	RedirectHTTP bool `yaml:"redirect_http"`
+	HTTPPort     int  `yaml:"http_port"`
 }
 
 // DatabaseConfig holds database configuration
 type DatabaseConfig struct {
 	Path string `yaml:"path"`
+	// AutoMigrate applies pending schema migrations at startup. When
+	// disabled, the server refuses to start until they are applied with
+	// gateway migrate.
+	AutoMigrate bool `yaml:"auto_migrate"`
+}
+
+// BackupConfig holds scheduled database backup configuration
+type BackupConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// IntervalHours is the number of hours between backups
+	IntervalHours int `yaml:"interval_hours"`
+	// Dir is where gzip-compressed backups are written
+	Dir string `yaml:"dir"`
+	// Keep is the number of backups kept in Dir
+	Keep int      `yaml:"keep"`
+	S3   S3Config `yaml:"s3"`
+}
+
+// S3Config holds the S3-compatible bucket backups are uploaded to. Uploads
+// are off while Bucket is empty.
+type S3Config struct {
+	Endpoint string `yaml:"endpoint"`
+	Region   string `yaml:"region"`
+	Bucket   string `yaml:"bucket"`
+	// Prefix is prepended to the names of uploaded objects
+	Prefix          string `yaml:"prefix"`
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+	// PathStyle addresses the bucket in the URL path, as MinIO and most
+	// other S3-compatible stores expect
+	PathStyle bool `yaml:"path_style"`
 }
 
 // HealthCheckConfig holds health check configuration
 type HealthCheckConfig struct {
 	Interval int `yaml:"interval"`
 	Timeout  int `yaml:"timeout"`
+	// Active probes every enabled channel's models endpoint each interval;
+	// otherwise only request failures and synthetic probes are counted
+	Active bool `yaml:"active"`
+	// UnhealthyThreshold is the consecutive failures after which a channel
+	// is marked unhealthy and taken out of routing
+	UnhealthyThreshold int `yaml:"unhealthy_threshold"`
+}
+
+// BreakerConfig holds the per-channel circuit breaker configuration
+type BreakerConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// ConsecutiveFailures trips a channel's breaker after this many failed
+	// requests in a row; 0 disables the check
+	ConsecutiveFailures int `yaml:"consecutive_failures"`
+	// ErrorRate trips a channel's breaker when this share (0-1) of its
+	// requests in a window failed; 0 disables the check
+	ErrorRate   float64 `yaml:"error_rate"`
+	MinRequests int     `yaml:"min_requests"`
+	// Window is the length in seconds of the window requests are counted over
+	Window int `yaml:"window"`
+	// OpenDuration is how many seconds a tripped channel stays out of
+	// routing before it is probed
+	OpenDuration int `yaml:"open_duration"`
 }
 
 // SessionConfig holds session management configuration
 type SessionConfig struct {
 	IdleTimeout int `yaml:"idle_timeout"`
+	// PreferPreviousChannel routes a user whose session expired back to
+	// the channel they last used
+	PreferPreviousChannel bool `yaml:"prefer_previous_channel"`
 }
 
 // MetricsConfig holds metrics configuration
 type MetricsConfig struct {
 	Enabled bool `yaml:"enabled"`
 	Port    int  `yaml:"port"`
+	// DisableModelLabel drops the per-model label from metrics
+	DisableModelLabel bool `yaml:"disable_model_label"`
+	// ModelGroups reports models by group, mapping group names to glob patterns
+	ModelGroups map[string][]string `yaml:"model_groups"`
+	// Exporter pushes metrics in addition to the /metrics endpoint: "statsd" or "otlp"
+	Exporter     string `yaml:"exporter"`
+	Endpoint     string `yaml:"endpoint"`
+	PushInterval int    `yaml:"push_interval"`
+	Prefix       string `yaml:"prefix"`
+}
+
+// SCIMConfig holds configuration for user provisioning from an identity provider
+type SCIMConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Token   string `yaml:"token"`
+}
+
+// KubernetesConfig holds configuration for syncing state from a mounted
+// ConfigMap or Secret directory
+type KubernetesConfig struct {
+	Enabled   bool   `yaml:"enabled"`
+	ConfigDir string `yaml:"config_dir"`
+}
+
+// ClusterConfig selects where state shared between replicas is kept
+type ClusterConfig struct {
+	Store string      `yaml:"store"`
+	Redis RedisConfig `yaml:"redis"`
+}
+
+// RedisConfig holds Redis connection configuration
+type RedisConfig struct {
+	Addr     string `yaml:"addr"`
+	Password string `yaml:"password"`
+	DB       int    `yaml:"db"`
+}
+
+// AlertsConfig holds alert delivery configuration
+type AlertsConfig struct {
+	WebhookURL string `yaml:"webhook_url"`
+}
+
+// ErrorBudgetConfig holds per-user error budget configuration
+type ErrorBudgetConfig struct {
+	Enabled     bool    `yaml:"enabled"`
+	Window      int     `yaml:"window"`
+	Threshold   float64 `yaml:"threshold"`
+	MinRequests int64   `yaml:"min_requests"`
+}
+
+// RoutingConfig holds channel selection policies
+type RoutingConfig struct {
+	CostOptimization CostOptimizationConfig `yaml:"cost_optimization"`
+	ColdStart        ColdStartConfig        `yaml:"cold_start"`
+	// Seed seeds weighted channel selection so it is reproducible; 0 seeds
+	// from the clock
+	Seed int64 `yaml:"seed"`
+	// Debug logs each weighted selection's draw and cumulative weights
+	Debug bool `yaml:"debug"`
+}
+
+// CostOptimizationConfig holds the policy that prefers cheaper channels while
+// p95 latency is below a target and faster channels once it is breached
+type CostOptimizationConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// LatencyTargetMs is the p95 latency target in milliseconds
+	LatencyTargetMs int `yaml:"latency_target_ms"`
+	// RecoverRatio is the fraction of the target p95 must fall below before
+	// cheaper channels are preferred again
+	RecoverRatio float64 `yaml:"recover_ratio"`
+	// Window is the latency window in seconds
+	Window     int `yaml:"window"`
+	MinSamples int `yaml:"min_samples"`
+}
+
+// ColdStartConfig holds how channels without enough metrics are trusted
+type ColdStartConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Observations is the requests after which a channel is scored on its
+	// own metrics alone
+	Observations int64 `yaml:"observations"`
+	// Bonus scales the average score of other channels that a new channel
+	// borrows until then, so it is explored sooner
+	Bonus float64 `yaml:"bonus"`
+	// MaxShare caps the fraction of new sessions a new channel may get
+	MaxShare float64 `yaml:"max_share"`
+}
+
+// SLOConfig holds service level objectives evaluated for burn-rate alerts
+type SLOConfig struct {
+	// EvaluationInterval is how often burn rates are computed, in seconds
+	EvaluationInterval int                  `yaml:"evaluation_interval"`
+	Objectives         []SLOObjectiveConfig `yaml:"objectives"`
+}
+
+// SLOObjectiveConfig defines one objective. An empty model covers all models.
+type SLOObjectiveConfig struct {
+	Name   string  `yaml:"name"`
+	Model  string  `yaml:"model"`
+	Type   string  `yaml:"type"`
+	Target float64 `yaml:"target"`
+	// LatencyThresholdMs is the latency good requests are within, for latency objectives
+	LatencyThresholdMs int `yaml:"latency_threshold_ms"`
+}
+
+// BootstrapConfig seeds an empty database on first start. Environment
+// variables such as GATEWAY_ADMIN_TOKEN override these settings.
+type BootstrapConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// File is a declarative state file (channels, models, users) to apply
+	File string `yaml:"file"`
+}
+
+// DedupConfig holds duplicate request detection configuration
+type DedupConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// WindowMs is how long after a request an identical one counts as a
+	// duplicate, in milliseconds
+	WindowMs int `yaml:"window_ms"`
+	// Coalesce serves duplicates the original's response instead of calling
+	// the backend again
+	Coalesce bool `yaml:"coalesce"`
+}
+
+// StatusPagesConfig holds the provider status pages polled for declared
+// incidents
+type StatusPagesConfig struct {
+	// Interval is how often pages are polled, in seconds
+	Interval int `yaml:"interval"`
+	// MinImpact is the impact (minor, major or critical) at which a
+	// provider's channels are avoided
+	MinImpact string                 `yaml:"min_impact"`
+	Providers []StatusProviderConfig `yaml:"providers"`
+}
+
+// StatusProviderConfig defines one provider's status page
+type StatusProviderConfig struct {
+	Name string `yaml:"name"`
+	// URL is the Statuspage summary endpoint, e.g.
+	// https://status.openai.com/api/v2/summary.json
+	URL string `yaml:"url"`
+	// Channels are glob patterns of the names of the provider's channels
+	Channels []string `yaml:"channels"`
+	// Components limits the impact to these status page components
+	Components []string `yaml:"components"`
+}
+
+// ProbesConfig holds configuration for running the synthetic probes defined
+// through the admin API
+type ProbesConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Timeout bounds each probe request, in seconds
+	Timeout int `yaml:"timeout"`
+	// RetentionHours is how long probe results are kept
+	RetentionHours int `yaml:"retention_hours"`
+}
+
+// QualityConfig holds configuration for response quality signals
+type QualityConfig struct {
+	// Enabled checks successful chat completions for empty output, refusals
+	// and truncated JSON, and counts them per channel
+	Enabled bool `yaml:"enabled"`
+}
+
+// AdminConfig holds protections of the admin API
+type AdminConfig struct {
+	// AllowedIPs lists the addresses and CIDR ranges admin requests may come
+	// from; empty allows every address
+	AllowedIPs []string `yaml:"allowed_ips"`
+	// MutationLimit is the number of changes each admin token may make per
+	// RateLimitWindow seconds; 0 disables the limit
+	MutationLimit   int64 `yaml:"mutation_limit"`
+	RateLimitWindow int   `yaml:"rate_limit_window"`
+}
+
+// UpstreamConfig holds the connection settings of the HTTP clients that
+// reach channels. Each channel keeps its own pool of connections.
+type UpstreamConfig struct {
+	// Timeout is the seconds a backend may take to send its response
+	// headers, and a whole non-streaming request may take; streams are read
+	// as long as they last. 0 disables it.
+	Timeout int `yaml:"timeout"`
+	// MaxIdleConnsPerHost is the keep-alive connections kept per channel
+	MaxIdleConnsPerHost int `yaml:"max_idle_conns_per_host"`
+	// IdleConnTimeout is the seconds an unused connection is kept open
+	IdleConnTimeout     int `yaml:"idle_conn_timeout"`
+	TLSHandshakeTimeout int `yaml:"tls_handshake_timeout"`
+	// Proxy is the proxy URL of channels without their own proxy_url; empty
+	// uses the HTTP_PROXY and HTTPS_PROXY environment variables
+	Proxy string `yaml:"proxy"`
+	// MaxBufferedResponseKB is the largest non-streaming response read
+	// whole before it is sent; larger ones are copied to the client as they
+	// are read. 0 reads every response whole.
+	MaxBufferedResponseKB int `yaml:"max_buffered_response_kb"`
+	// Retry is the retry policy of channels without their own retry_policy
+	Retry RetryConfig `yaml:"retry"`
+}
+
+// RetryConfig holds how failed upstream requests are retried on the same
+// channel before the failure is returned or failed over
+type RetryConfig struct {
+	// MaxAttempts counts the first attempt; 1 disables retries
+	MaxAttempts int `yaml:"max_attempts"`
+	// InitialDelayMs is the wait before the first retry, multiplied by
+	// Multiplier for each further retry and capped at MaxDelayMs
+	InitialDelayMs int     `yaml:"initial_delay_ms"`
+	Multiplier     float64 `yaml:"multiplier"`
+	MaxDelayMs     int     `yaml:"max_delay_ms"`
+	// RetryableStatuses are the backend statuses retried; transport errors
+	// are always retried
+	RetryableStatuses []int `yaml:"retryable_statuses"`
+}
+
+// ReplayConfig holds the capture of requests for replay against another
+// gateway with "gateway replay"
+type ReplayConfig struct {
+	// Capture appends a sample of sanitized requests to File
+	Capture bool   `yaml:"capture"`
+	File    string `yaml:"file"`
+	// SampleRate is the share of requests captured, from 0 to 1
+	SampleRate float64 `yaml:"sample_rate"`
+	// RedactContent replaces prompt and message text with x's of the same
+	// length
+	RedactContent bool `yaml:"redact_content"`
+}
+
+// ChaosConfig holds the faults injected into upstream requests for testing.
+// It must never be enabled in production.
+type ChaosConfig struct {
+	Enabled bool               `yaml:"enabled"`
+	Faults  []ChaosFaultConfig `yaml:"faults"`
+}
+
+// ChaosFaultConfig holds the faults injected into the requests of the
+// channels matching Channels. Rates are the share of requests affected.
+type ChaosFaultConfig struct {
+	// Channels are glob patterns of channel names; empty matches every channel
+	Channels    []string `yaml:"channels"`
+	LatencyMs   int      `yaml:"latency_ms"`
+	LatencyRate float64  `yaml:"latency_rate"`
+	ErrorRate   float64  `yaml:"error_rate"`
+	// ErrorStatus is the status of injected errors; 0 is 503
+	ErrorStatus    int     `yaml:"error_status"`
+	DropRate       float64 `yaml:"drop_rate"`
+	DropAfterBytes int     `yaml:"drop_after_bytes"`
+}
+
+// UsageConfig holds configuration for usage accounting
+type UsageConfig struct {
+	// StreamUsage asks backends for a usage chunk on every streamed chat
+	// completion, so streams are logged even when clients do not request
+	// usage. Disable it for backends that reject stream_options.
+	StreamUsage bool `yaml:"stream_usage"`
+	// RollupAfterDays is the age in days after which usage logs are
+	// replaced by hourly aggregates; 0 keeps every log
+	RollupAfterDays int `yaml:"rollup_after_days"`
+	// DailyAfterDays is the age in days after which hourly aggregates are
+	// merged into daily ones; 0 keeps them hourly
+	DailyAfterDays int `yaml:"daily_after_days"`
 }
 
 // DefaultConfig returns a default configuration
 func DefaultConfig() *Config {
 	return &Config{
 		Server: ServerConfig{
-			Port:         8080,
-			Host:         "0.0.0.0",
-			ReadTimeout:  30,
-			WriteTimeout: 30,
+			Port:              8080,
+			Host:              "0.0.0.0",
+			ReadHeaderTimeout: 10,
+			ReadTimeout:       30,
+			WriteTimeout:      30,
+			AdminTimeout:      10,
+			ProxyTimeout:      300,
+			StreamHeartbeat:   15,
+			ShutdownTimeout:   30,
+			TLS: TLSConfig{
+				ReloadInterval: 60,
+				HTTPPort:       80,
+			},
 		},
 		Database: DatabaseConfig{
-			Path: "./gateway.db",
+			Path:        "./gateway.db",
+			AutoMigrate: true,
+		},
+		Backup: BackupConfig{
+			IntervalHours: 24,
+			Dir:           "./backups",
+			Keep:          7,
 		},
 		HealthCheck: HealthCheckConfig{
-			Interval: 30,
-			Timeout:  5,
+			Interval:           30,
+			Timeout:            5,
+			Active:             true,
+			UnhealthyThreshold: 3,
+		},
+		Breaker: BreakerConfig{
+			Enabled:             true,
+			ConsecutiveFailures: 5,
+			ErrorRate:           0.5,
+			MinRequests:         20,
+			Window:              60,
+			OpenDuration:        30,
 		},
 		Session: SessionConfig{
 			IdleTimeout: 30,
 		},
 		Metrics: MetricsConfig{
-			Enabled: true,
-			Port:    9090,
+			Enabled:      true,
+			Port:         9090,
+			PushInterval: 10,
+		},
+		Cluster: ClusterConfig{
+			Store: "local",
+		},
+		ErrorBudget: ErrorBudgetConfig{
+			Window:      300,
+			Threshold:   0.5,
+			MinRequests: 20,
+		},
+		Routing: RoutingConfig{
+			CostOptimization: CostOptimizationConfig{
+				RecoverRatio: 0.8,
+				Window:       300,
+				MinSamples:   20,
+			},
+			ColdStart: ColdStartConfig{
+				Enabled:      true,
+				Observations: 20,
+				Bonus:        1.2,
+				MaxShare:     0.2,
+			},
+		},
+		SLO: SLOConfig{
+			EvaluationInterval: 60,
+		},
+		Dedup: DedupConfig{
+			WindowMs: 2000,
+		},
+		StatusPages: StatusPagesConfig{
+			Interval:  60,
+			MinImpact: "major",
+		},
+		Admin: AdminConfig{
+			MutationLimit:   60,
+			RateLimitWindow: 60,
+		},
+		Probes: ProbesConfig{
+			Timeout:        30,
+			RetentionHours: 168,
+		},
+		Usage: UsageConfig{
+			StreamUsage:     true,
+			RollupAfterDays: 30,
+			DailyAfterDays:  180,
+		},
+		Upstream: UpstreamConfig{
+			Timeout:               60,
+			MaxIdleConnsPerHost:   32,
+			IdleConnTimeout:       90,
+			TLSHandshakeTimeout:   10,
+			MaxBufferedResponseKB: 1024,
+			Retry: RetryConfig{
+				MaxAttempts:       1,
+				InitialDelayMs:    500,
+				Multiplier:        2,
+				MaxDelayMs:        5000,
+				RetryableStatuses: []int{429, 500, 502, 503, 504},
+			},
+		},
+		Replay: ReplayConfig{
+			File:          "./capture.jsonl",
+			SampleRate:    1,
+			RedactContent: true,
 		},
 	}
 }
 
+// watchDebounce coalesces the burst of events produced when an editor
+// saves the configuration file or Kubernetes swaps a mounted ConfigMap
+const watchDebounce = 500 * time.Millisecond
+
 // Service manages configuration with hot reload
 type Service struct {
-	mu      sync.RWMutex
-	config  *Config
-	path    string
-	watcher *fsnotify.Watcher
+	mu          sync.RWMutex
+	config      *Config
+	path        string
+	watcher     *fsnotify.Watcher
+	subscribers []func(old, cfg *Config)
+	stopCh      chan struct{}
+	doneCh      chan struct{}
 }
 
 // NewService creates a new configuration service
 func NewService(path string) (*Service, error) {
 	svc := &Service{
-		path: path,
+		path:   path,
+		stopCh: make(chan struct{}),
+		doneCh: make(chan struct{}),
 	}
 
 	// Load initial config
@@ -96,46 +568,440 @@ func NewService(path string) (*Service, error) {
 	return svc, nil
 }
 
-// Load reads configuration from file
+// Load reads the configuration file over the defaults, applies overrides
+// from the environment and validates the result. A missing file leaves the
+// defaults. On error the current configuration is kept.
 func (s *Service) Load() error {
+	cfg, err := s.read()
+	if err != nil {
+		return err
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.config = cfg
+	return nil
+}
 
-	s.config = DefaultConfig()
+// read loads a new configuration
+func (s *Service) read() (*Config, error) {
+	cfg := DefaultConfig()
 
 	data, err := os.ReadFile(s.path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	if err == nil {
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse config file: %w", err)
 		}
-		return fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	if err := yaml.Unmarshal(data, s.config); err != nil {
-		return fmt.Errorf("failed to parse config file: %w", err)
+	if err := applyEnv(cfg, os.LookupEnv); err != nil {
+		return nil, err
 	}
-
-	return nil
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return cfg, nil
 }
 
-// Get returns the current configuration
+// Get returns the current configuration. It must not be modified.
 func (s *Service) Get() *Config {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	return s.config
 }
 
-// Validate checks if the configuration is valid
+// Subscribe registers fn to be called with the previous and the new
+// configuration after every reload that changed it. Components compare the
+// settings they use and apply the changes.
+func (s *Service) Subscribe(fn func(old, cfg *Config)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscribers = append(s.subscribers, fn)
+}
+
+// Reload loads the configuration again and notifies the subscribers when it
+// changed. An invalid configuration is rejected and the current one is kept.
+func (s *Service) Reload() error {
+	cfg, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	old := s.config
+	if reflect.DeepEqual(old, cfg) {
+		s.mu.Unlock()
+		return nil
+	}
+	s.config = cfg
+	subscribers := s.subscribers
+	s.mu.Unlock()
+
+	log.Printf("Configuration reloaded from %s", s.path)
+	for _, fn := range subscribers {
+		fn(old, cfg)
+	}
+	return nil
+}
+
+// Watch begins reloading the configuration when its file changes. The
+// file's directory is watched, so files replaced by editors or by
+// Kubernetes ConfigMap updates are picked up.
+func (s *Service) Watch() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create watcher: %w", err)
+	}
+	if err := watcher.Add(filepath.Dir(s.path)); err != nil {
+		watcher.Close()
+		return fmt.Errorf("failed to watch %s: %w", s.path, err)
+	}
+	s.watcher = watcher
+
+	go s.loop()
+	return nil
+}
+
+// Stop stops watching the configuration file
+func (s *Service) Stop() {
+	if s.watcher == nil {
+		return
+	}
+	close(s.stopCh)
+	<-s.doneCh
+	s.watcher.Close()
+}
+
+// loop waits for events on the configuration file and reloads it once they
+// settle. Other files in the directory, such as the database, are ignored.
+func (s *Service) loop() {
+	defer close(s.doneCh)
+
+	timer := time.NewTimer(watchDebounce)
+	timer.Stop()
+	defer timer.Stop()
+
+	file := filepath.Base(s.path)
+	for {
+		select {
+		case event, ok := <-s.watcher.Events:
+			if !ok {
+				return
+			}
+			if name := filepath.Base(event.Name); name == file || strings.HasPrefix(name, "..") {
+				timer.Reset(watchDebounce)
+			}
+		case err, ok := <-s.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("Config watcher error: %v", err)
+		case <-timer.C:
+			if err := s.Reload(); err != nil {
+				log.Printf("Config reload failed, keeping the current configuration: %v", err)
+			}
+		case <-s.stopCh:
+			return
+		}
+	}
+}
+
+// Validate checks if the current configuration is valid
 func (s *Service) Validate() error {
-	cfg := s.Get()
+	return s.Get().Validate()
+}
 
+// Validate checks if the configuration is valid
+func (cfg *Config) Validate() error {
 	if cfg.Server.Port <= 0 || cfg.Server.Port > 65535 {
 		return fmt.Errorf("invalid server port: %d", cfg.Server.Port)
 	}
 
+	if cfg.Server.ReadHeaderTimeout < 0 || cfg.Server.ReadTimeout < 0 {
+		return fmt.Errorf("server read_header_timeout and read_timeout cannot be negative")
+	}
+	if cfg.Server.AdminTimeout < 0 || cfg.Server.ProxyTimeout < 0 {
+		return fmt.Errorf("server admin_timeout and proxy_timeout cannot be negative")
+	}
+	if cfg.Server.StreamHeartbeat < 0 {
+		return fmt.Errorf("server stream_heartbeat cannot be negative")
+	}
+	if cfg.Server.ShutdownTimeout < 0 {
+		return fmt.Errorf("server shutdown_timeout cannot be negative")
+	}
+	if t := cfg.Server.TLS; t.Enabled {
+		if t.CertFile == "" || t.KeyFile == "" {
+			return fmt.Errorf("server tls requires cert_file and key_file")
+		}
+		if t.ReloadInterval < 0 {
+			return fmt.Errorf("server tls reload_interval cannot be negative")
+		}
+		if t.RedirectHTTP && (t.HTTPPort <= 0 || t.HTTPPort > 65535 || t.HTTPPort == cfg.Server.Port) {
+			return fmt.Errorf("invalid server tls http_port: %d", t.HTTPPort)
+		}
+	}
+
+	if cfg.HealthCheck.Interval <= 0 || cfg.HealthCheck.Timeout < 0 {
+		return fmt.Errorf("health_check interval must be positive and timeout cannot be negative")
+	}
+	if cfg.Session.IdleTimeout <= 0 {
+		return fmt.Errorf("session idle_timeout must be positive")
+	}
+
+	if cfg.HealthCheck.UnhealthyThreshold < 1 {
+		return fmt.Errorf("health_check unhealthy_threshold must be at least 1")
+	}
+
+	if b := cfg.Backup; b.Enabled {
+		if b.IntervalHours <= 0 {
+			return fmt.Errorf("backup interval_hours must be positive")
+		}
+		if b.Dir == "" {
+			return fmt.Errorf("backup dir is required")
+		}
+		if b.Keep < 1 {
+			return fmt.Errorf("backup keep must be at least 1")
+		}
+	}
+
+	if br := cfg.Breaker; br.Enabled {
+		if br.ConsecutiveFailures < 0 {
+			return fmt.Errorf("circuit_breaker consecutive_failures cannot be negative")
+		}
+		if br.ErrorRate < 0 || br.ErrorRate > 1 {
+			return fmt.Errorf("circuit_breaker error_rate must be between 0 and 1")
+		}
+		if br.ConsecutiveFailures == 0 && br.ErrorRate == 0 {
+			return fmt.Errorf("circuit_breaker needs consecutive_failures or error_rate")
+		}
+		if br.Window <= 0 || br.OpenDuration <= 0 {
+			return fmt.Errorf("circuit_breaker window and open_duration must be positive")
+		}
+	}
+
+	if cfg.Usage.RollupAfterDays < 0 || cfg.Usage.DailyAfterDays < 0 {
+		return fmt.Errorf("usage rollup_after_days and daily_after_days cannot be negative")
+	}
+
+	if up := cfg.Upstream; up.Timeout < 0 || up.MaxIdleConnsPerHost < 0 || up.IdleConnTimeout < 0 || up.TLSHandshakeTimeout < 0 || up.MaxBufferedResponseKB < 0 {
+		return fmt.Errorf("upstream timeouts, max_idle_conns_per_host and max_buffered_response_kb cannot be negative")
+	}
+	if err := validateRetry(cfg.Upstream.Retry); err != nil {
+		return err
+	}
+
+	if r := cfg.Replay; r.Capture {
+		if r.File == "" {
+			return fmt.Errorf("replay file is required when capture is enabled")
+		}
+		if r.SampleRate <= 0 || r.SampleRate > 1 {
+			return fmt.Errorf("replay sample_rate must be greater than 0 and at most 1")
+		}
+	}
+
 	if cfg.Database.Path == "" {
 		return fmt.Errorf("database path cannot be empty")
 	}
 
+	if cfg.SCIM.Enabled && cfg.SCIM.Token == "" {
+		return fmt.Errorf("scim token is required when scim is enabled")
+	}
+
+	switch cfg.Metrics.Exporter {
+	case "":
+	case "statsd", "otlp":
+		if cfg.Metrics.Endpoint == "" {
+			return fmt.Errorf("metrics endpoint is required for the %s exporter", cfg.Metrics.Exporter)
+		}
+	default:
+		return fmt.Errorf("invalid metrics exporter: %s", cfg.Metrics.Exporter)
+	}
+
+	switch cfg.Cluster.Store {
+	case "local":
+	case "redis":
+		if cfg.Cluster.Redis.Addr == "" {
+			return fmt.Errorf("cluster redis addr is required when store is redis")
+		}
+	default:
+		return fmt.Errorf("invalid cluster store: %s", cfg.Cluster.Store)
+	}
+
+	if cfg.ErrorBudget.Enabled && (cfg.ErrorBudget.Threshold <= 0 || cfg.ErrorBudget.Threshold >= 1) {
+		return fmt.Errorf("error budget threshold must be between 0 and 1")
+	}
+
+	if cost := cfg.Routing.CostOptimization; cost.Enabled {
+		if cost.LatencyTargetMs <= 0 {
+			return fmt.Errorf("routing cost_optimization latency_target_ms must be positive")
+		}
+		if cost.RecoverRatio <= 0 || cost.RecoverRatio > 1 {
+			return fmt.Errorf("routing cost_optimization recover_ratio must be between 0 and 1")
+		}
+		if cost.Window <= 0 {
+			return fmt.Errorf("routing cost_optimization window must be positive")
+		}
+	}
+
+	if cold := cfg.Routing.ColdStart; cold.Enabled {
+		if cold.Observations <= 0 {
+			return fmt.Errorf("routing cold_start observations must be positive")
+		}
+		if cold.Bonus <= 0 {
+			return fmt.Errorf("routing cold_start bonus must be positive")
+		}
+		if cold.MaxShare <= 0 || cold.MaxShare > 1 {
+			return fmt.Errorf("routing cold_start max_share must be between 0 and 1")
+		}
+	}
+
+	if cfg.Dedup.Enabled && cfg.Dedup.WindowMs <= 0 {
+		return fmt.Errorf("dedup window_ms must be positive")
+	}
+
+	if err := validateSLOs(cfg.SLO); err != nil {
+		return err
+	}
+
+	if cfg.Probes.Enabled && (cfg.Probes.Timeout <= 0 || cfg.Probes.RetentionHours <= 0) {
+		return fmt.Errorf("probes timeout and retention_hours must be positive")
+	}
+
+	if err := validateStatusPages(cfg.StatusPages); err != nil {
+		return err
+	}
+
+	if cfg.Chaos.Enabled {
+		if err := validateChaos(cfg.Chaos); err != nil {
+			return err
+		}
+	}
+
+	if cfg.Admin.MutationLimit > 0 && cfg.Admin.RateLimitWindow <= 0 {
+		return fmt.Errorf("admin rate_limit_window must be positive")
+	}
+
+	if cfg.Kubernetes.Enabled && cfg.Kubernetes.ConfigDir == "" {
+		return fmt.Errorf("kubernetes config_dir is required when kubernetes is enabled")
+	}
+
+	return nil
+}
+
+// validateSLOs checks SLO objectives have unique names, a known type and a
+// target between 0 and 1
+func validateSLOs(cfg SLOConfig) error {
+	if len(cfg.Objectives) > 0 && cfg.EvaluationInterval <= 0 {
+		return fmt.Errorf("slo evaluation_interval must be positive")
+	}
+
+	names := make(map[string]bool)
+	for _, o := range cfg.Objectives {
+		if o.Name == "" {
+			return fmt.Errorf("slo name cannot be empty")
+		}
+		if names[o.Name] {
+			return fmt.Errorf("duplicate slo name: %s", o.Name)
+		}
+		names[o.Name] = true
+
+		switch o.Type {
+		case "availability":
+		case "latency":
+			if o.LatencyThresholdMs <= 0 {
+				return fmt.Errorf("slo %s latency_threshold_ms must be positive", o.Name)
+			}
+		default:
+			return fmt.Errorf("invalid slo type for %s: %s", o.Name, o.Type)
+		}
+
+		if o.Target <= 0 || o.Target >= 1 {
+			return fmt.Errorf("slo %s target must be between 0 and 1", o.Name)
+		}
+	}
+	return nil
+}
+
+// validateStatusPages checks status page providers have unique names, a URL
+// and valid channel patterns
+func validateStatusPages(cfg StatusPagesConfig) error {
+	if len(cfg.Providers) == 0 {
+		return nil
+	}
+	if cfg.Interval <= 0 {
+		return fmt.Errorf("status_pages interval must be positive")
+	}
+	switch cfg.MinImpact {
+	case "minor", "major", "critical":
+	default:
+		return fmt.Errorf("invalid status_pages min_impact: %s", cfg.MinImpact)
+	}
+
+	names := make(map[string]bool)
+	for _, p := range cfg.Providers {
+		if p.Name == "" {
+			return fmt.Errorf("status page provider name cannot be empty")
+		}
+		if names[p.Name] {
+			return fmt.Errorf("duplicate status page provider: %s", p.Name)
+		}
+		names[p.Name] = true
+
+		if p.URL == "" {
+			return fmt.Errorf("status page provider %s url is required", p.Name)
+		}
+		for _, pattern := range p.Channels {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("status page provider %s has invalid channel pattern %q", p.Name, pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// validateChaos checks chaos faults have valid channel patterns, rates
+// between 0 and 1 and a 5xx error status
+func validateChaos(cfg ChaosConfig) error {
+	for i, f := range cfg.Faults {
+		for _, pattern := range f.Channels {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("chaos fault %d has invalid channel pattern %q", i, pattern)
+			}
+		}
+		for _, rate := range []float64{f.LatencyRate, f.ErrorRate, f.DropRate} {
+			if rate < 0 || rate > 1 {
+				return fmt.Errorf("chaos fault %d rates must be between 0 and 1", i)
+			}
+		}
+		if f.LatencyMs < 0 || f.DropAfterBytes < 0 {
+			return fmt.Errorf("chaos fault %d latency_ms and drop_after_bytes cannot be negative", i)
+		}
+		if f.ErrorStatus != 0 && (f.ErrorStatus < 500 || f.ErrorStatus > 599) {
+			return fmt.Errorf("chaos fault %d error_status must be a 5xx status", i)
+		}
+	}
+	return nil
+}
+
+// validateRetry checks the upstream retry policy makes at least one attempt,
+// never shrinks its delays and only retries error statuses
+func validateRetry(r RetryConfig) error {
+	if r.MaxAttempts < 1 {
+		return fmt.Errorf("upstream retry max_attempts must be at least 1")
+	}
+	if r.InitialDelayMs < 0 || r.MaxDelayMs < 0 {
+		return fmt.Errorf("upstream retry initial_delay_ms and max_delay_ms cannot be negative")
+	}
+	if r.Multiplier < 1 {
+		return fmt.Errorf("upstream retry multiplier must be at least 1")
+	}
+	for _, status := range r.RetryableStatuses {
+		if status < 400 || status > 599 {
+			return fmt.Errorf("upstream retry retryable_statuses must be 4xx or 5xx statuses, got %d", status)
+		}
+	}
 	return nil
 }
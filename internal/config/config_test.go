@@ -1,7 +1,10 @@
 package config
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestDefaultConfig(t *testing.T) {
@@ -63,3 +66,92 @@ func TestValidate(t *testing.T) {
 		t.Errorf("Valid config should not return error: %v", err)
 	}
 }
+
+func TestEnvOverrides(t *testing.T) {
+	env := map[string]string{
+		"GATEWAY_SERVER_PORT":                       "9000",
+		"GATEWAY_SERVER_TLS_ENABLED":                "true",
+		"GATEWAY_CLUSTER_REDIS_PASSWORD":            "secret",
+		"GATEWAY_ROUTING_COLD_START_MAX_SHARE":      "0.5",
+		"GATEWAY_ADMIN_ALLOWED_IPS":                 "10.0.0.0/8, 127.0.0.1",
+		"GATEWAY_UPSTREAM_RETRY_RETRYABLE_STATUSES": "502,503",
+	}
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+
+	cfg := DefaultConfig()
+	if err := applyEnv(cfg, lookup); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Port != 9000 || !cfg.Server.TLS.Enabled || cfg.Cluster.Redis.Password != "secret" {
+		t.Errorf("Expected overridden settings, got %+v", cfg.Server)
+	}
+	if cfg.Routing.ColdStart.MaxShare != 0.5 {
+		t.Errorf("Expected max_share 0.5, got %v", cfg.Routing.ColdStart.MaxShare)
+	}
+	if ips := cfg.Admin.AllowedIPs; len(ips) != 2 || ips[1] != "127.0.0.1" {
+		t.Errorf("Expected 2 allowed IPs, got %v", ips)
+	}
+	if statuses := cfg.Upstream.Retry.RetryableStatuses; len(statuses) != 2 || statuses[1] != 503 {
+		t.Errorf("Expected retryable statuses [502 503], got %v", statuses)
+	}
+	if cfg.Database.Path != "./gateway.db" {
+		t.Errorf("Expected settings without variables unchanged, got %s", cfg.Database.Path)
+	}
+
+	env = map[string]string{"GATEWAY_SERVER_PORT": "http"}
+	if err := applyEnv(DefaultConfig(), lookup); err == nil {
+		t.Error("Expected an invalid number to be rejected")
+	}
+}
+
+func TestWatchReloadsChangedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("session:\n  idle_timeout: 30\n")
+
+	svc, err := NewService(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := make(chan [2]int, 1)
+	svc.Subscribe(func(old, cfg *Config) {
+		changes <- [2]int{old.Session.IdleTimeout, cfg.Session.IdleTimeout}
+	})
+	if err := svc.Watch(); err != nil {
+		t.Fatal(err)
+	}
+	defer svc.Stop()
+
+	write("session:\n  idle_timeout: 45\n")
+	select {
+	case change := <-changes:
+		if change != [2]int{30, 45} {
+			t.Errorf("Expected idle_timeout 30 to 45, got %v", change)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected subscribers notified of the change")
+	}
+
+	// An invalid file is rejected and the current configuration kept
+	write("session:\n  idle_timeout: -1\n")
+	time.Sleep(2 * watchDebounce)
+	if err := svc.Reload(); err == nil {
+		t.Error("Expected the invalid configuration to be rejected")
+	}
+	if got := svc.Get().Session.IdleTimeout; got != 45 {
+		t.Errorf("Expected idle_timeout 45 kept, got %d", got)
+	}
+	select {
+	case change := <-changes:
+		t.Errorf("Expected no notification, got %v", change)
+	default:
+	}
+}
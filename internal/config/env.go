@@ -0,0 +1,99 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix starts the names of environment variables overriding settings.
+// The rest of a name is the setting's YAML path in upper case joined with
+// underscores, such as GATEWAY_SERVER_PORT for server.port or
+// GATEWAY_CLUSTER_REDIS_PASSWORD for cluster.redis.password.
+const EnvPrefix = "GATEWAY"
+
+// applyEnv overrides the settings of cfg set in the environment. Lists of
+// strings are comma-separated. Lists of objects and maps cannot be set from
+// the environment.
+func applyEnv(cfg *Config, lookup func(string) (string, bool)) error {
+	return overrideFields(reflect.ValueOf(cfg).Elem(), EnvPrefix, lookup)
+}
+
+// overrideFields overrides the fields of struct v from variables named
+// after prefix and their YAML names
+func overrideFields(v reflect.Value, prefix string, lookup func(string) (string, bool)) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("yaml")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		name := prefix + "_" + strings.ToUpper(tag)
+
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			if err := overrideFields(field, name, lookup); err != nil {
+				return err
+			}
+			continue
+		}
+		value, ok := lookup(name)
+		if !ok {
+			continue
+		}
+		if err := setField(field, value); err != nil {
+			return fmt.Errorf("invalid %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// setField parses value into a field
+func setField(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		if field.OverflowInt(n) {
+			return fmt.Errorf("%s is out of range", value)
+		}
+		field.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		kind := field.Type().Elem().Kind()
+		if kind != reflect.String && kind != reflect.Int {
+			return fmt.Errorf("lists of %s cannot be set from the environment", field.Type().Elem())
+		}
+		items := reflect.MakeSlice(field.Type(), 0, 0)
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			elem := reflect.New(field.Type().Elem()).Elem()
+			if err := setField(elem, item); err != nil {
+				return err
+			}
+			items = reflect.Append(items, elem)
+		}
+		field.Set(items)
+	default:
+		return fmt.Errorf("%s settings cannot be set from the environment", field.Kind())
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package dedup
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/internal/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// DeduplicatedHeader marks a response replayed from an identical request
+const DeduplicatedHeader = "X-Gateway-Deduplicated"
+
+// defaultMaxResponseSize bounds the response kept for replay to duplicates
+const defaultMaxResponseSize = 1 << 20
+
+// Options configures request deduplication
+type Options struct {
+	// Window is how long after an original request arrives, or until it
+	// completes if that is later, an identical request counts as a duplicate
+	Window time.Duration
+	// Coalesce makes duplicates wait for the original and share its
+	// response instead of being forwarded upstream
+	Coalesce bool
+	// MaxResponseSize bounds the response recorded for replay; duplicates of
+	// larger responses are forwarded
+	MaxResponseSize int
+}
+
+// Deduplicator detects identical requests from the same user, commonly
+// caused by client retry bugs, and optionally coalesces them into one
+// upstream call. State is kept in process memory, so each replica
+// deduplicates the requests it receives.
+type Deduplicator struct {
+	opts Options
+
+	mu        sync.Mutex
+	entries   map[string]*entry
+	lastSweep time.Time
+}
+
+// entry tracks an original request
+type entry struct {
+	arrival time.Time
+	// expires is when the entry stops matching; zero while in flight
+	expires time.Time
+	// done is closed when the original request completes
+	done chan struct{}
+	// resp is the recorded response, nil when it cannot be replayed
+	resp *response
+}
+
+// response is a successful response recorded for replay
+type response struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// New creates a deduplicator
+func New(opts Options) *Deduplicator {
+	if opts.Window <= 0 {
+		opts.Window = 2 * time.Second
+	}
+	if opts.MaxResponseSize <= 0 {
+		opts.MaxResponseSize = defaultMaxResponseSize
+	}
+	return &Deduplicator{opts: opts, entries: make(map[string]*entry)}
+}
+
+// Middleware detects duplicate POST requests by user, path and body hash.
+// Duplicates are counted and logged; with Coalesce they wait for the original
+// and receive its response when it succeeded.
+func (d *Deduplicator) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Multipart uploads are streamed to the backend, so they are not
+		// read into memory to be hashed
+		if c.Request.Method != http.MethodPost || strings.HasPrefix(c.ContentType(), "multipart/") {
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "failed to read request body"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		key := requestKey(c.GetInt64("user_id"), c.Request.URL.Path, body)
+		e, duplicate := d.acquire(key, time.Now())
+		if duplicate {
+			d.serveDuplicate(c, e)
+			return
+		}
+		defer d.release(e)
+
+		if !d.opts.Coalesce {
+			c.Next()
+			return
+		}
+
+		rec := &recorder{ResponseWriter: c.Writer, limit: d.opts.MaxResponseSize}
+		c.Writer = rec
+		c.Next()
+		c.Writer = rec.ResponseWriter
+
+		if status := rec.Status(); status >= 200 && status < 300 && !rec.overflow {
+			e.resp = &response{status: status, header: rec.Header().Clone(), body: rec.body.Bytes()}
+		}
+	}
+}
+
+// acquire returns the entry of an identical request that is in flight or
+// within its window, or registers the request as an original
+func (d *Deduplicator) acquire(key string, now time.Time) (*entry, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.sweep(now)
+	if e, ok := d.entries[key]; ok && e.matches(now) {
+		return e, true
+	}
+
+	e := &entry{arrival: now, done: make(chan struct{})}
+	d.entries[key] = e
+	return e, false
+}
+
+// release marks an original request as completed. It keeps matching until
+// its window has passed.
+func (d *Deduplicator) release(e *entry) {
+	d.mu.Lock()
+	e.expires = e.arrival.Add(d.opts.Window)
+	if now := time.Now(); now.After(e.expires) {
+		e.expires = now
+	}
+	d.mu.Unlock()
+	close(e.done)
+}
+
+// sweep removes expired entries, at most once per window
+func (d *Deduplicator) sweep(now time.Time) {
+	if now.Sub(d.lastSweep) < d.opts.Window {
+		return
+	}
+	d.lastSweep = now
+	for key, e := range d.entries {
+		if !e.matches(now) {
+			delete(d.entries, key)
+		}
+	}
+}
+
+// matches reports whether an identical request arriving at now is a
+// duplicate: the original is in flight or its window has not passed
+func (e *entry) matches(now time.Time) bool {
+	return e.expires.IsZero() || now.Before(e.expires)
+}
+
+// serveDuplicate handles a duplicate request. Without coalescing, or when the
+// original's response cannot be replayed, the duplicate is forwarded.
+func (d *Deduplicator) serveDuplicate(c *gin.Context, e *entry) {
+	path := c.Request.URL.Path
+	if !d.opts.Coalesce {
+		log.Printf("Duplicate request: user=%d path=%s", c.GetInt64("user_id"), path)
+		metrics.RecordDuplicateRequest(metrics.DuplicateForwarded)
+		c.Next()
+		return
+	}
+
+	select {
+	case <-e.done:
+	case <-c.Request.Context().Done():
+		c.Abort()
+		return
+	}
+
+	if e.resp == nil {
+		log.Printf("Duplicate request: user=%d path=%s forwarded, original response not replayable", c.GetInt64("user_id"), path)
+		metrics.RecordDuplicateRequest(metrics.DuplicateForwarded)
+		c.Next()
+		return
+	}
+
+	log.Printf("Duplicate request: user=%d path=%s coalesced", c.GetInt64("user_id"), path)
+	metrics.RecordDuplicateRequest(metrics.DuplicateCoalesced)
+	header := c.Writer.Header()
+	for name, values := range e.resp.header {
+		header[name] = values
+	}
+	header.Set(DeduplicatedHeader, "true")
+	header.Set("Content-Length", strconv.Itoa(len(e.resp.body)))
+	c.Writer.WriteHeader(e.resp.status)
+	c.Writer.Write(e.resp.body)
+	c.Abort()
+}
+
+// requestKey identifies identical requests of a user
+func requestKey(userID int64, path string, body []byte) string {
+	sum := sha256.Sum256(body)
+	return strconv.FormatInt(userID, 10) + " " + path + " " + hex.EncodeToString(sum[:])
+}
+
+// recorder copies a response as it is written to the client, up to a limit
+type recorder struct {
+	gin.ResponseWriter
+	limit    int
+	body     bytes.Buffer
+	overflow bool
+}
+
+// Write writes p to the client and records it
+func (r *recorder) Write(p []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(p)
+	r.record(p[:n])
+	return n, err
+}
+
+// WriteString writes s to the client and records it
+func (r *recorder) WriteString(s string) (int, error) {
+	n, err := r.ResponseWriter.WriteString(s)
+	r.record([]byte(s[:n]))
+	return n, err
+}
+
+// record keeps written bytes until the limit is exceeded
+func (r *recorder) record(p []byte) {
+	if r.overflow {
+		return
+	}
+	if r.body.Len()+len(p) > r.limit {
+		r.overflow = true
+		r.body = bytes.Buffer{}
+		return
+	}
+	r.body.Write(p)
+}
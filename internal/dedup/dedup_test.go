@@ -0,0 +1,125 @@
+package dedup
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newTestRouter serves POST /echo behind the deduplicator, counting calls and
+// holding each call until release is closed
+func newTestRouter(d *Deduplicator, calls *atomic.Int32, release chan struct{}) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("user_id", int64(1))
+	})
+	r.Use(d.Middleware())
+	r.POST("/echo", func(c *gin.Context) {
+		n := calls.Add(1)
+		<-release
+		if c.Query("fail") != "" {
+			c.JSON(http.StatusBadGateway, gin.H{"error": "backend down"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"call": n})
+	})
+	return r
+}
+
+func post(r *gin.Engine, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", path, strings.NewReader(body)))
+	return w
+}
+
+func TestCoalesceSharesResponse(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	r := newTestRouter(New(Options{Window: time.Minute, Coalesce: true}), &calls, release)
+
+	var wg sync.WaitGroup
+	responses := make([]*httptest.ResponseRecorder, 3)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		responses[0] = post(r, "/echo", `{"prompt":"hi"}`)
+	}()
+	for calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	for i := 1; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			responses[i] = post(r, "/echo", `{"prompt":"hi"}`)
+		}(i)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if calls.Load() != 1 {
+		t.Fatalf("Expected one upstream call, got %d", calls.Load())
+	}
+	for i, w := range responses {
+		if w.Code != http.StatusOK || w.Body.String() != `{"call":1}` {
+			t.Errorf("Response %d: expected the shared response, got %d %s", i, w.Code, w.Body.String())
+		}
+	}
+	if responses[0].Header().Get(DeduplicatedHeader) != "" || responses[1].Header().Get(DeduplicatedHeader) != "true" {
+		t.Error("Expected only duplicates to be marked as deduplicated")
+	}
+
+	// A different body is not a duplicate
+	if w := post(r, "/echo", `{"prompt":"bye"}`); w.Body.String() != `{"call":2}` {
+		t.Errorf("Expected a new call for a different body, got %s", w.Body.String())
+	}
+}
+
+func TestDuplicatesOfFailuresAreForwarded(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	close(release)
+	r := newTestRouter(New(Options{Window: time.Minute, Coalesce: true}), &calls, release)
+
+	post(r, "/echo?fail=1", `{}`)
+	if w := post(r, "/echo?fail=1", `{}`); w.Code != http.StatusBadGateway || calls.Load() != 2 {
+		t.Errorf("Expected the retry of a failed request to be forwarded, got %d after %d calls", w.Code, calls.Load())
+	}
+}
+
+func TestWindowExpires(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	close(release)
+	r := newTestRouter(New(Options{Window: 10 * time.Millisecond, Coalesce: true}), &calls, release)
+
+	post(r, "/echo", `{}`)
+	if w := post(r, "/echo", `{}`); w.Header().Get(DeduplicatedHeader) != "true" {
+		t.Error("Expected a duplicate within the window to be coalesced")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if w := post(r, "/echo", `{}`); w.Header().Get(DeduplicatedHeader) != "" || calls.Load() != 2 {
+		t.Errorf("Expected a request after the window to be forwarded, got %d calls", calls.Load())
+	}
+}
+
+func TestDetectOnlyForwardsDuplicates(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	close(release)
+	r := newTestRouter(New(Options{Window: time.Minute}), &calls, release)
+
+	post(r, "/echo", `{}`)
+	post(r, "/echo", `{}`)
+	if calls.Load() != 2 {
+		t.Errorf("Expected duplicates to be forwarded without coalescing, got %d calls", calls.Load())
+	}
+}
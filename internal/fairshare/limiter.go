@@ -0,0 +1,160 @@
+package fairshare
+
+import (
+	"context"
+	"sync"
+)
+
+// Limiter bounds the number of concurrent requests per channel. When a
+// channel is at its limit, waiting requests are queued per user and slots are
+// handed out round-robin across users, so one heavy user cannot starve
+// everyone else pinned to the same channel.
+type Limiter struct {
+	mu       sync.Mutex
+	channels map[int64]*channelQueue
+}
+
+// channelQueue tracks active requests and per-user wait queues of a channel
+type channelQueue struct {
+	limit   int
+	active  int
+	waiting map[int64][]*waiter
+	// users holds users with waiting requests in round-robin order
+	users []int64
+}
+
+// waiter is a request waiting for a slot; ready is closed once it is granted
+type waiter struct {
+	ready   chan struct{}
+	granted bool
+}
+
+// NewLimiter creates a new limiter
+func NewLimiter() *Limiter {
+	return &Limiter{channels: make(map[int64]*channelQueue)}
+}
+
+// Acquire waits for a slot on a channel and returns a function that releases
+// it. A limit of zero or less means unlimited. If ctx ends first, ctx.Err()
+// is returned and no slot is held.
+func (l *Limiter) Acquire(ctx context.Context, channelID, userID int64, limit int) (func(), error) {
+	if limit <= 0 {
+		return func() {}, nil
+	}
+
+	l.mu.Lock()
+	q, ok := l.channels[channelID]
+	if !ok {
+		q = &channelQueue{waiting: make(map[int64][]*waiter)}
+		l.channels[channelID] = q
+	}
+	q.limit = limit
+
+	if q.active < q.limit && len(q.users) == 0 {
+		q.active++
+		l.mu.Unlock()
+		return l.releaser(channelID), nil
+	}
+
+	w := &waiter{ready: make(chan struct{})}
+	if len(q.waiting[userID]) == 0 {
+		q.users = append(q.users, userID)
+	}
+	q.waiting[userID] = append(q.waiting[userID], w)
+	l.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return l.releaser(channelID), nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		if w.granted {
+			// The slot was granted while ctx ended; hand it on
+			q.active--
+			q.dispatch()
+		} else {
+			q.remove(userID, w)
+		}
+		return nil, ctx.Err()
+	}
+}
+
+// Waiting returns the number of requests queued for a channel
+func (l *Limiter) Waiting(channelID int64) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	q, ok := l.channels[channelID]
+	if !ok {
+		return 0
+	}
+
+	n := 0
+	for _, ws := range q.waiting {
+		n += len(ws)
+	}
+	return n
+}
+
+// releaser returns a function that frees a slot exactly once
+func (l *Limiter) releaser(channelID int64) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+
+			q := l.channels[channelID]
+			q.active--
+			q.dispatch()
+		})
+	}
+}
+
+// dispatch grants free slots to waiting users in round-robin order; the
+// caller holds the limiter lock
+func (q *channelQueue) dispatch() {
+	for q.active < q.limit && len(q.users) > 0 {
+		userID := q.users[0]
+		q.users = q.users[1:]
+
+		ws := q.waiting[userID]
+		w := ws[0]
+		if len(ws) > 1 {
+			q.waiting[userID] = ws[1:]
+			q.users = append(q.users, userID)
+		} else {
+			delete(q.waiting, userID)
+		}
+
+		q.active++
+		w.granted = true
+		close(w.ready)
+	}
+}
+
+// remove drops a waiter that gave up; the caller holds the limiter lock
+func (q *channelQueue) remove(userID int64, w *waiter) {
+	ws := q.waiting[userID]
+	for i, candidate := range ws {
+		if candidate == w {
+			ws = append(ws[:i], ws[i+1:]...)
+			break
+		}
+	}
+
+	if len(ws) > 0 {
+		q.waiting[userID] = ws
+		return
+	}
+
+	delete(q.waiting, userID)
+	for i, id := range q.users {
+		if id == userID {
+			q.users = append(q.users[:i], q.users[i+1:]...)
+			break
+		}
+	}
+}
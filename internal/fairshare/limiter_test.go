@@ -0,0 +1,101 @@
+package fairshare
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLimiterRoundRobin(t *testing.T) {
+	l := NewLimiter()
+	ctx := context.Background()
+
+	// Hold the only slot
+	release, err := l.Acquire(ctx, 1, 0, 1)
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+
+	// User 1 queues three requests before user 2 queues one
+	var mu sync.Mutex
+	var order []int64
+	var wg sync.WaitGroup
+	enqueue := func(userID int64) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, err := l.Acquire(ctx, 1, userID, 1)
+			if err != nil {
+				t.Errorf("Acquire failed: %v", err)
+				return
+			}
+			mu.Lock()
+			order = append(order, userID)
+			mu.Unlock()
+			r()
+		}()
+	}
+
+	for _, userID := range []int64{1, 1, 1, 2} {
+		before := l.Waiting(1)
+		enqueue(userID)
+		waitFor(t, func() bool { return l.Waiting(1) == before+1 })
+	}
+
+	release()
+	wg.Wait()
+
+	// User 2 is served second instead of after all of user 1's requests
+	expected := []int64{1, 2, 1, 1}
+	for i := range expected {
+		if order[i] != expected[i] {
+			t.Fatalf("Expected order %v, got %v", expected, order)
+		}
+	}
+}
+
+func TestLimiterCancel(t *testing.T) {
+	l := NewLimiter()
+
+	release, _ := l.Acquire(context.Background(), 1, 1, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := l.Acquire(ctx, 1, 2, 1); err == nil {
+		t.Fatal("Expected Acquire to fail when ctx ends")
+	}
+	if l.Waiting(1) != 0 {
+		t.Error("Cancelled waiter should be removed from the queue")
+	}
+
+	release()
+	release() // releasing twice is a no-op
+
+	r, err := l.Acquire(context.Background(), 1, 2, 1)
+	if err != nil {
+		t.Fatalf("Expected slot to be free: %v", err)
+	}
+	r()
+}
+
+func TestLimiterUnlimited(t *testing.T) {
+	l := NewLimiter()
+	for i := 0; i < 100; i++ {
+		if _, err := l.Acquire(context.Background(), 1, 1, 0); err != nil {
+			t.Fatalf("Acquire failed: %v", err)
+		}
+	}
+}
+
+// waitFor polls cond until it holds or the test times out
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
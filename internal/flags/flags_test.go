@@ -0,0 +1,94 @@
+package flags
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+)
+
+func TestEvaluate(t *testing.T) {
+	flag := &database.FeatureFlag{Name: "hedged_requests", Enabled: true, RolloutPercent: 30, UserIDs: []int64{7}}
+
+	on := 0
+	for id := int64(1); id <= 1000; id++ {
+		if Evaluate(flag, id) {
+			on++
+		}
+	}
+	if on < 250 || on > 350 {
+		t.Errorf("Expected about 30%% of users at a 30%% rollout, got %d of 1000", on)
+	}
+	if !Evaluate(flag, 7) {
+		t.Error("Expected a listed user to get the flag")
+	}
+	if Evaluate(flag, 0) {
+		t.Error("Expected requests without a user to be excluded from a partial rollout")
+	}
+
+	// Users keep the flag as the rollout grows
+	wider := *flag
+	wider.RolloutPercent = 60
+	for id := int64(1); id <= 1000; id++ {
+		if Evaluate(flag, id) && !Evaluate(&wider, id) {
+			t.Fatalf("User %d lost the flag when the rollout grew", id)
+		}
+	}
+
+	flag.Enabled = false
+	if Evaluate(flag, 7) {
+		t.Error("Expected a disabled flag to be off for listed users")
+	}
+}
+
+func TestFlagsCache(t *testing.T) {
+	dbPath := "/tmp/test_flags.db"
+	defer os.Remove(dbPath)
+
+	db, err := database.New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	f := New(db)
+	f.now = func() time.Time { return now }
+
+	flag := &database.FeatureFlag{Name: "response_cache", Enabled: true, RolloutPercent: 100}
+	if err := db.CreateFeatureFlag(flag); err != nil {
+		t.Fatal(err)
+	}
+	if !f.Enabled("response_cache", 1) {
+		t.Fatal("Expected a fully rolled out flag to be on")
+	}
+	if f.Enabled("unknown", 1) {
+		t.Error("Expected an unknown flag to be off")
+	}
+
+	// A change is picked up once the cache expires, or at once when invalidated
+	flag.Enabled = false
+	if err := db.UpdateFeatureFlag(flag); err != nil {
+		t.Fatal(err)
+	}
+	if !f.Enabled("response_cache", 1) {
+		t.Error("Expected the cached flag within the TTL")
+	}
+	now = now.Add(CacheTTL)
+	if f.Enabled("response_cache", 1) {
+		t.Error("Expected the change after the TTL")
+	}
+
+	flag.Enabled = true
+	db.UpdateFeatureFlag(flag)
+	f.Invalidate()
+	if !f.Enabled("response_cache", 1) {
+		t.Error("Expected the change after invalidation")
+	}
+
+	var none *Flags
+	if none.Enabled("response_cache", 1) {
+		t.Error("Expected a nil Flags to have every flag off")
+	}
+}
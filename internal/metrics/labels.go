@@ -0,0 +1,110 @@
+package metrics
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"sync"
+)
+
+// otherModelGroup is reported for models that match no configured group
+const otherModelGroup = "other"
+
+// LabelOptions controls the cardinality of the model label
+type LabelOptions struct {
+	// DisableModelLabel reports every model as an empty label value
+	DisableModelLabel bool
+	// ModelGroups maps a group name to glob patterns (path.Match syntax);
+	// when set, models are reported by group and unmatched models as "other"
+	ModelGroups map[string][]string
+}
+
+// modelLabeler maps model names onto label values
+type modelLabeler struct {
+	disabled bool
+	groups   []modelGroup
+	cache    sync.Map
+}
+
+// modelGroup is a named set of model patterns
+type modelGroup struct {
+	name     string
+	patterns []string
+}
+
+// labeler is the active model labeler; the zero value reports models verbatim
+var labeler = &modelLabeler{}
+
+// Configure applies label options. It should be called once at startup,
+// before any metrics are recorded.
+func Configure(opts LabelOptions) error {
+	if err := ValidateModelGroups(opts.ModelGroups); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(opts.ModelGroups))
+	for name := range opts.ModelGroups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	l := &modelLabeler{disabled: opts.DisableModelLabel}
+	for _, name := range names {
+		l.groups = append(l.groups, modelGroup{name: name, patterns: opts.ModelGroups[name]})
+	}
+	labeler = l
+
+	return nil
+}
+
+// ValidateModelGroups checks that every model group pattern is well formed
+func ValidateModelGroups(groups map[string][]string) error {
+	for name, patterns := range groups {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid pattern %q in model group %q: %w", pattern, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// modelLabel returns the label value to report for a model
+func modelLabel(model string) string {
+	return labeler.label(model)
+}
+
+// label resolves a model to its label value, caching group matches
+func (l *modelLabeler) label(model string) string {
+	if l.disabled {
+		return ""
+	}
+	if len(l.groups) == 0 {
+		return model
+	}
+
+	if group, ok := l.cache.Load(model); ok {
+		return group.(string)
+	}
+
+	group := otherModelGroup
+	for _, g := range l.groups {
+		if g.matches(model) {
+			group = g.name
+			break
+		}
+	}
+	l.cache.Store(model, group)
+
+	return group
+}
+
+// matches reports whether a model matches any of the group's patterns
+func (g modelGroup) matches(model string) bool {
+	for _, pattern := range g.patterns {
+		if ok, _ := path.Match(pattern, model); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package metrics
+
+import "testing"
+
+func TestModelLabel(t *testing.T) {
+	defer Configure(LabelOptions{})
+
+	if got := modelLabel("gpt-4o"); got != "gpt-4o" {
+		t.Errorf("Expected model reported verbatim by default, got %q", got)
+	}
+
+	err := Configure(LabelOptions{ModelGroups: map[string][]string{
+		"gpt":    {"gpt-*"},
+		"claude": {"claude-3-*", "claude-sonnet-*"},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to configure: %v", err)
+	}
+
+	tests := map[string]string{
+		"gpt-4o":          "gpt",
+		"claude-3-opus":   "claude",
+		"claude-sonnet-4": "claude",
+		"llama3":          otherModelGroup,
+	}
+	for model, expected := range tests {
+		if got := modelLabel(model); got != expected {
+			t.Errorf("modelLabel(%q) = %q, expected %q", model, got, expected)
+		}
+	}
+
+	Configure(LabelOptions{DisableModelLabel: true})
+	if got := modelLabel("gpt-4o"); got != "" {
+		t.Errorf("Expected empty label when disabled, got %q", got)
+	}
+}
+
+func TestConfigureRejectsBadPattern(t *testing.T) {
+	if err := Configure(LabelOptions{ModelGroups: map[string][]string{"bad": {"gpt-["}}}); err == nil {
+		t.Error("Expected error for malformed pattern")
+	}
+}
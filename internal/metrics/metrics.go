@@ -2,8 +2,10 @@ package metrics
 
 import (
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/X0Ken/openai-gateway/internal/version"
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -56,6 +58,210 @@ var (
 		},
 		[]string{"channel"},
 	)
+
+	// BreakerState reports the state of each channel's circuit breaker
+	BreakerState = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gateway_channel_breaker_state",
+			Help: "State of each channel's circuit breaker (0 closed, 1 half-open, 2 open)",
+		},
+		[]string{"channel"},
+	)
+
+	// BreakerTrips counts circuit breakers opening
+	BreakerTrips = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_channel_breaker_trips_total",
+			Help: "Total number of times each channel's circuit breaker opened",
+		},
+		[]string{"channel"},
+	)
+
+	// ActiveStreams tracks currently open SSE streams
+	ActiveStreams = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gateway_active_streams",
+			Help: "Number of currently open streaming responses",
+		},
+		[]string{"channel", "model"},
+	)
+
+	// StreamedBytes counts bytes sent to clients in streaming responses
+	StreamedBytes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_streamed_bytes_total",
+			Help: "Total bytes sent to clients in streaming responses",
+		},
+		[]string{"channel", "model"},
+	)
+
+	// TokensTotal counts tokens reported in backend usage
+	TokensTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_tokens_total",
+			Help: "Total tokens reported by backends, by type (prompt or completion)",
+		},
+		[]string{"channel", "model", "type"},
+	)
+
+	// ModelRequests counts completed API requests by model and outcome
+	ModelRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_model_requests_total",
+			Help: "Total API requests by model and outcome (success or error)",
+		},
+		[]string{"model", "outcome"},
+	)
+
+	// DuplicateRequests counts requests identical to one received shortly before
+	DuplicateRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_duplicate_requests_total",
+			Help: "Duplicate requests by outcome (coalesced or forwarded)",
+		},
+		[]string{"outcome"},
+	)
+
+	// SLOBurnRate reports how fast each SLO consumes its error budget
+	SLOBurnRate = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gateway_slo_burn_rate",
+			Help: "Error budget burn rate of each SLO over each alerting window",
+		},
+		[]string{"slo", "window"},
+	)
+
+	// ProviderImpact reports the impact declared on each provider's status page
+	ProviderImpact = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gateway_provider_status_impact",
+			Help: "Impact declared on each provider's status page (0 none, 1 minor, 2 major, 3 critical)",
+		},
+		[]string{"provider"},
+	)
+
+	// QualityChecked counts responses whose quality signals were computed
+	QualityChecked = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_quality_checked_total",
+			Help: "Successful responses checked for quality signals by channel",
+		},
+		[]string{"channel"},
+	)
+
+	// QualitySignals counts the quality signals raised by successful responses
+	QualitySignals = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_quality_signals_total",
+			Help: "Quality signals (empty, refusal, truncated_json) raised by successful responses by channel",
+		},
+		[]string{"channel", "signal"},
+	)
+
+	// StreamRetries counts streams retried on another channel after failing
+	// before any content
+	StreamRetries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_stream_retries_total",
+			Help: "Streams retried on another channel after failing before any content, by the channel that failed",
+		},
+		[]string{"channel"},
+	)
+
+	// JobRuns counts runs of background jobs by outcome
+	JobRuns = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_job_runs_total",
+			Help: "Runs of background jobs by outcome",
+		},
+		[]string{"job", "outcome"},
+	)
+
+	// JobDuration measures how long background job runs take
+	JobDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "gateway_job_duration_seconds",
+			Help:    "Duration of background job runs in seconds",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"job"},
+	)
+
+	// JobLastSuccess is the time of each background job's last successful run
+	JobLastSuccess = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gateway_job_last_success_timestamp_seconds",
+			Help: "Unix time of the last successful run of each background job",
+		},
+		[]string{"job"},
+	)
+
+	// Panics counts handler panics recovered by the gateway, by route
+	Panics = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_panics_total",
+			Help: "Handler panics recovered, by route",
+		},
+		[]string{"route"},
+	)
+
+	// RequestTimeouts counts requests answered with a timeout error because
+	// their handler missed its deadline, by route
+	RequestTimeouts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_request_timeouts_total",
+			Help: "Requests whose handler missed its deadline, by route",
+		},
+		[]string{"route"},
+	)
+
+	// AdminRejections counts admin requests rejected by the admin guard
+	AdminRejections = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_admin_rejections_total",
+			Help: "Admin requests rejected by the IP allowlist or rate limit",
+		},
+		[]string{"reason"},
+	)
+
+	// QuotaRejections counts requests rejected because a user's or group's
+	// monthly quota is exhausted, or a group's rate limit is exceeded
+	QuotaRejections = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_quota_rejections_total",
+			Help: "Requests rejected because a user's or group's quota is exhausted",
+		},
+		[]string{"budget"},
+	)
+
+	// ChaosFaults counts faults injected into upstream requests by the
+	// chaos testing layer
+	ChaosFaults = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_chaos_faults_total",
+			Help: "Faults (latency, error, drop) injected into upstream requests by channel",
+		},
+		[]string{"channel", "fault"},
+	)
+
+	// UpstreamRetries counts upstream requests retried on the same channel
+	// under its retry policy
+	UpstreamRetries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_upstream_retries_total",
+			Help: "Upstream requests retried on the same channel after a retryable failure",
+		},
+		[]string{"channel"},
+	)
+
+	// BuildInfo is always 1, labelled with the build of the running binary
+	BuildInfo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gateway_build_info",
+			Help: "Build of the running gateway, always 1",
+		},
+		[]string{"version", "commit", "build_date", "go_version", "features"},
+	)
 )
 
 func init() {
@@ -64,6 +270,31 @@ func init() {
 	prometheus.MustRegister(ErrorCounter)
 	prometheus.MustRegister(ChannelLatency)
 	prometheus.MustRegister(ChannelErrorRate)
+	prometheus.MustRegister(BreakerState)
+	prometheus.MustRegister(BreakerTrips)
+	prometheus.MustRegister(ActiveStreams)
+	prometheus.MustRegister(StreamedBytes)
+	prometheus.MustRegister(TokensTotal)
+	prometheus.MustRegister(ModelRequests)
+	prometheus.MustRegister(DuplicateRequests)
+	prometheus.MustRegister(SLOBurnRate)
+	prometheus.MustRegister(ProviderImpact)
+	prometheus.MustRegister(QualityChecked)
+	prometheus.MustRegister(QualitySignals)
+	prometheus.MustRegister(StreamRetries)
+	prometheus.MustRegister(JobRuns)
+	prometheus.MustRegister(JobDuration)
+	prometheus.MustRegister(JobLastSuccess)
+	prometheus.MustRegister(Panics)
+	prometheus.MustRegister(RequestTimeouts)
+	prometheus.MustRegister(AdminRejections)
+	prometheus.MustRegister(QuotaRejections)
+	prometheus.MustRegister(ChaosFaults)
+	prometheus.MustRegister(UpstreamRetries)
+	prometheus.MustRegister(BuildInfo)
+
+	info := version.Get()
+	BuildInfo.WithLabelValues(info.Version, info.Commit, info.BuildDate, info.GoVersion, strings.Join(info.Features, ",")).Set(1)
 }
 
 // Middleware returns a Gin middleware that collects metrics
@@ -95,7 +326,7 @@ func Handler() gin.HandlerFunc {
 
 // RecordChannelLatency records channel response latency
 func RecordChannelLatency(channel, model string, duration time.Duration) {
-	ChannelLatency.WithLabelValues(channel, model).Observe(duration.Seconds())
+	ChannelLatency.WithLabelValues(channel, modelLabel(model)).Observe(duration.Seconds())
 }
 
 // RecordChannelError records a channel error
@@ -107,3 +338,156 @@ func RecordChannelError(channel string) {
 func SetChannelErrorRate(channel string, rate float64) {
 	ChannelErrorRate.WithLabelValues(channel).Set(rate)
 }
+
+// SetBreakerState sets the circuit breaker state of a channel
+func SetBreakerState(channel string, level int) {
+	BreakerState.WithLabelValues(channel).Set(float64(level))
+}
+
+// DeleteBreakerState removes the circuit breaker state of a deleted channel
+func DeleteBreakerState(channel string) {
+	BreakerState.DeleteLabelValues(channel)
+}
+
+// RecordBreakerTrip records a channel's circuit breaker opening
+func RecordBreakerTrip(channel string) {
+	BreakerTrips.WithLabelValues(channel).Inc()
+}
+
+// StreamStarted records a newly opened stream and returns a function that
+// records it as closed
+func StreamStarted(channel, model string) func() {
+	gauge := ActiveStreams.WithLabelValues(channel, modelLabel(model))
+	gauge.Inc()
+	return gauge.Dec
+}
+
+// RecordStreamedBytes records bytes sent to a client in a streaming response
+func RecordStreamedBytes(channel, model string, n int) {
+	if n > 0 {
+		StreamedBytes.WithLabelValues(channel, modelLabel(model)).Add(float64(n))
+	}
+}
+
+// RecordStreamRetry records a stream retried after failing on a channel
+func RecordStreamRetry(channel string) {
+	StreamRetries.WithLabelValues(channel).Inc()
+}
+
+// RecordTokens records prompt and completion tokens reported by a backend
+func RecordTokens(channel, model string, prompt, completion int) {
+	label := modelLabel(model)
+	if prompt > 0 {
+		TokensTotal.WithLabelValues(channel, label, "prompt").Add(float64(prompt))
+	}
+	if completion > 0 {
+		TokensTotal.WithLabelValues(channel, label, "completion").Add(float64(completion))
+	}
+}
+
+// Request outcomes recorded by RecordModelRequest
+const (
+	OutcomeSuccess = "success"
+	OutcomeError   = "error"
+)
+
+// RecordModelRequest records the outcome of an API request for a model
+func RecordModelRequest(model string, success bool) {
+	outcome := OutcomeSuccess
+	if !success {
+		outcome = OutcomeError
+	}
+	ModelRequests.WithLabelValues(modelLabel(model), outcome).Inc()
+}
+
+// RecordJobRun records a run of a background job
+func RecordJobRun(job string, duration time.Duration, success bool) {
+	outcome := OutcomeSuccess
+	if !success {
+		outcome = OutcomeError
+	}
+	JobRuns.WithLabelValues(job, outcome).Inc()
+	JobDuration.WithLabelValues(job).Observe(duration.Seconds())
+	if success {
+		JobLastSuccess.WithLabelValues(job).SetToCurrentTime()
+	}
+}
+
+// RecordPanic records a recovered handler panic on a route
+func RecordPanic(route string) {
+	Panics.WithLabelValues(route).Inc()
+}
+
+// RecordRequestTimeout records a request whose handler missed its deadline
+func RecordRequestTimeout(route string) {
+	RequestTimeouts.WithLabelValues(route).Inc()
+}
+
+// Exhausted budgets recorded by RecordQuotaRejection
+const (
+	QuotaTokens   = "tokens"
+	QuotaCost     = "cost"
+	QuotaRequests = "requests"
+)
+
+// RecordQuotaRejection records a request rejected for an exhausted quota
+func RecordQuotaRejection(budget string) {
+	QuotaRejections.WithLabelValues(budget).Inc()
+}
+
+// Faults recorded by RecordChaosFault
+const (
+	ChaosLatency = "latency"
+	ChaosError   = "error"
+	ChaosDrop    = "drop"
+)
+
+// RecordChaosFault records a fault injected into a channel's request
+func RecordChaosFault(channel, fault string) {
+	ChaosFaults.WithLabelValues(channel, fault).Inc()
+}
+
+// RecordUpstreamRetry records a request retried on a channel
+func RecordUpstreamRetry(channel string) {
+	UpstreamRetries.WithLabelValues(channel).Inc()
+}
+
+// Admin rejection reasons recorded by RecordAdminRejection
+const (
+	AdminRejectionIP        = "ip"
+	AdminRejectionRateLimit = "rate_limit"
+)
+
+// RecordAdminRejection records an admin request rejected by the admin guard
+func RecordAdminRejection(reason string) {
+	AdminRejections.WithLabelValues(reason).Inc()
+}
+
+// Duplicate request outcomes recorded by RecordDuplicateRequest
+const (
+	DuplicateCoalesced = "coalesced"
+	DuplicateForwarded = "forwarded"
+)
+
+// RecordDuplicateRequest records a duplicate request and how it was served
+func RecordDuplicateRequest(outcome string) {
+	DuplicateRequests.WithLabelValues(outcome).Inc()
+}
+
+// SetSLOBurnRate sets the burn rate of an SLO over a window
+func SetSLOBurnRate(slo, window string, rate float64) {
+	SLOBurnRate.WithLabelValues(slo, window).Set(rate)
+}
+
+// SetProviderImpact sets the impact level declared on a provider's status page
+func SetProviderImpact(provider string, level int) {
+	ProviderImpact.WithLabelValues(provider).Set(float64(level))
+}
+
+// RecordQuality records a checked response and the quality signals it raised
+func RecordQuality(channel string, signals []string) {
+	QualityChecked.WithLabelValues(channel).Inc()
+	for _, signal := range signals {
+		QualitySignals.WithLabelValues(channel, signal).Inc()
+	}
+}
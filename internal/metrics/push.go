@@ -0,0 +1,366 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Push exporters
+const (
+	ExporterStatsD = "statsd"
+	ExporterOTLP   = "otlp"
+)
+
+// statsdMaxPacket keeps StatsD datagrams below common network MTUs
+const statsdMaxPacket = 1432
+
+// PushOptions configures pushing metrics to a collector
+type PushOptions struct {
+	// Exporter is ExporterStatsD or ExporterOTLP
+	Exporter string
+	// Endpoint is a host:port for StatsD or an OTLP/HTTP metrics URL such as
+	// http://collector:4318/v1/metrics
+	Endpoint string
+	Interval time.Duration
+	// Prefix is prepended to StatsD metric names
+	Prefix string
+}
+
+// Pusher periodically pushes the registered metrics to a StatsD or OTLP
+// collector, for environments without a Prometheus scraper
+type Pusher struct {
+	opts     PushOptions
+	gatherer prometheus.Gatherer
+	client   *http.Client
+	start    time.Time
+	previous map[string]float64
+}
+
+// NewPusher creates a pusher for the default Prometheus registry
+func NewPusher(opts PushOptions) (*Pusher, error) {
+	switch opts.Exporter {
+	case ExporterStatsD, ExporterOTLP:
+	default:
+		return nil, fmt.Errorf("unknown metrics exporter: %s", opts.Exporter)
+	}
+	if opts.Endpoint == "" {
+		return nil, fmt.Errorf("metrics endpoint is required for the %s exporter", opts.Exporter)
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = 10 * time.Second
+	}
+
+	return &Pusher{
+		opts:     opts,
+		gatherer: prometheus.DefaultGatherer,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		start:    time.Now(),
+		previous: make(map[string]float64),
+	}, nil
+}
+
+// Interval returns how often Push should run
+func (p *Pusher) Interval() time.Duration {
+	return p.opts.Interval
+}
+
+// Push gathers and sends the current metrics once
+func (p *Pusher) Push() error {
+	families, err := p.gatherer.Gather()
+	if err != nil {
+		return fmt.Errorf("failed to gather metrics: %w", err)
+	}
+
+	if p.opts.Exporter == ExporterStatsD {
+		return p.pushStatsD(families)
+	}
+	return p.pushOTLP(families)
+}
+
+// pushStatsD sends metrics as DogStatsD lines. Prometheus counters are
+// cumulative, so counters and histogram counts/sums are sent as deltas since
+// the previous push.
+func (p *Pusher) pushStatsD(families []*dto.MetricFamily) error {
+	conn, err := net.Dial("udp", p.opts.Endpoint)
+	if err != nil {
+		return fmt.Errorf("failed to connect to statsd: %w", err)
+	}
+	defer conn.Close()
+
+	var lines []string
+	for _, family := range families {
+		name := p.opts.Prefix + family.GetName()
+		for _, m := range family.GetMetric() {
+			tags := statsdTags(m.GetLabel())
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				lines = append(lines, p.statsdCounter(name, tags, m.GetCounter().GetValue()))
+			case dto.MetricType_GAUGE:
+				lines = append(lines, statsdLine(name, m.GetGauge().GetValue(), "g", tags))
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				lines = append(lines,
+					p.statsdCounter(name+".count", tags, float64(h.GetSampleCount())),
+					p.statsdCounter(name+".sum", tags, h.GetSampleSum()),
+				)
+			}
+		}
+	}
+
+	// Pack lines into datagrams
+	var packet bytes.Buffer
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+		if packet.Len() > 0 && packet.Len()+1+len(line) > statsdMaxPacket {
+			if _, err := conn.Write(packet.Bytes()); err != nil {
+				return fmt.Errorf("failed to write to statsd: %w", err)
+			}
+			packet.Reset()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	if packet.Len() > 0 {
+		if _, err := conn.Write(packet.Bytes()); err != nil {
+			return fmt.Errorf("failed to write to statsd: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// statsdCounter returns a counter line for the increase since the last push,
+// or an empty string when nothing changed
+func (p *Pusher) statsdCounter(name, tags string, value float64) string {
+	key := name + "|" + tags
+	delta := value - p.previous[key]
+	if delta < 0 {
+		// The counter was reset
+		delta = value
+	}
+	p.previous[key] = value
+
+	if delta == 0 {
+		return ""
+	}
+	return statsdLine(name, delta, "c", tags)
+}
+
+// statsdLine formats a single DogStatsD line
+func statsdLine(name string, value float64, kind, tags string) string {
+	line := name + ":" + strconv.FormatFloat(value, 'f', -1, 64) + "|" + kind
+	if tags != "" {
+		line += "|#" + tags
+	}
+	return line
+}
+
+// statsdTags formats labels as DogStatsD tags, skipping empty values
+func statsdTags(labels []*dto.LabelPair) string {
+	tags := make([]string, 0, len(labels))
+	for _, l := range labels {
+		if l.GetValue() == "" {
+			continue
+		}
+		value := strings.NewReplacer(",", "_", "|", "_", "#", "_").Replace(l.GetValue())
+		tags = append(tags, l.GetName()+":"+value)
+	}
+	sort.Strings(tags)
+	return strings.Join(tags, ",")
+}
+
+// OTLP/HTTP JSON payload types, covering the subset used by the gateway
+
+type otlpRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpMetric struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Sum         *otlpSum       `json:"sum,omitempty"`
+	Gauge       *otlpGauge     `json:"gauge,omitempty"`
+	Histogram   *otlpHistogram `json:"histogram,omitempty"`
+}
+
+type otlpSum struct {
+	DataPoints             []otlpNumberPoint `json:"dataPoints"`
+	AggregationTemporality int               `json:"aggregationTemporality"`
+	IsMonotonic            bool              `json:"isMonotonic"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpNumberPoint `json:"dataPoints"`
+}
+
+type otlpHistogram struct {
+	DataPoints             []otlpHistogramPoint `json:"dataPoints"`
+	AggregationTemporality int                  `json:"aggregationTemporality"`
+}
+
+type otlpNumberPoint struct {
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string          `json:"timeUnixNano"`
+	AsDouble          float64         `json:"asDouble"`
+}
+
+type otlpHistogramPoint struct {
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	TimeUnixNano      string          `json:"timeUnixNano"`
+	Count             string          `json:"count"`
+	Sum               float64         `json:"sum"`
+	BucketCounts      []string        `json:"bucketCounts"`
+	ExplicitBounds    []float64       `json:"explicitBounds"`
+}
+
+type otlpAttribute struct {
+	Key   string         `json:"key"`
+	Value otlpStringJSON `json:"value"`
+}
+
+type otlpStringJSON struct {
+	StringValue string `json:"stringValue"`
+}
+
+// otlpCumulative is AGGREGATION_TEMPORALITY_CUMULATIVE
+const otlpCumulative = 2
+
+// pushOTLP posts metrics to an OTLP/HTTP endpoint using the JSON encoding
+func (p *Pusher) pushOTLP(families []*dto.MetricFamily) error {
+	body, err := json.Marshal(p.otlpPayload(families, time.Now()))
+	if err != nil {
+		return fmt.Errorf("failed to encode metrics: %w", err)
+	}
+
+	resp, err := p.client.Post(p.opts.Endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to send metrics: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("otlp collector returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// otlpPayload converts gathered metric families into an OTLP export request
+func (p *Pusher) otlpPayload(families []*dto.MetricFamily, now time.Time) otlpRequest {
+	start := strconv.FormatInt(p.start.UnixNano(), 10)
+	ts := strconv.FormatInt(now.UnixNano(), 10)
+
+	var metrics []otlpMetric
+	for _, family := range families {
+		metric := otlpMetric{Name: family.GetName(), Description: family.GetHelp()}
+
+		switch family.GetType() {
+		case dto.MetricType_COUNTER:
+			metric.Sum = &otlpSum{AggregationTemporality: otlpCumulative, IsMonotonic: true}
+			for _, m := range family.GetMetric() {
+				metric.Sum.DataPoints = append(metric.Sum.DataPoints, otlpNumberPoint{
+					Attributes:        otlpAttributes(m.GetLabel()),
+					StartTimeUnixNano: start,
+					TimeUnixNano:      ts,
+					AsDouble:          m.GetCounter().GetValue(),
+				})
+			}
+		case dto.MetricType_GAUGE:
+			metric.Gauge = &otlpGauge{}
+			for _, m := range family.GetMetric() {
+				metric.Gauge.DataPoints = append(metric.Gauge.DataPoints, otlpNumberPoint{
+					Attributes:   otlpAttributes(m.GetLabel()),
+					TimeUnixNano: ts,
+					AsDouble:     m.GetGauge().GetValue(),
+				})
+			}
+		case dto.MetricType_HISTOGRAM:
+			metric.Histogram = &otlpHistogram{AggregationTemporality: otlpCumulative}
+			for _, m := range family.GetMetric() {
+				metric.Histogram.DataPoints = append(metric.Histogram.DataPoints, otlpHistogramPointFor(m, start, ts))
+			}
+		default:
+			continue
+		}
+
+		metrics = append(metrics, metric)
+	}
+
+	return otlpRequest{ResourceMetrics: []otlpResourceMetrics{{
+		Resource: otlpResource{Attributes: []otlpAttribute{
+			{Key: "service.name", Value: otlpStringJSON{StringValue: "openai-gateway"}},
+		}},
+		ScopeMetrics: []otlpScopeMetrics{{
+			Scope:   otlpScope{Name: "github.com/X0Ken/openai-gateway"},
+			Metrics: metrics,
+		}},
+	}}}
+}
+
+// otlpHistogramPointFor converts Prometheus cumulative buckets into OTLP
+// per-bucket counts, with a final overflow bucket
+func otlpHistogramPointFor(m *dto.Metric, start, ts string) otlpHistogramPoint {
+	h := m.GetHistogram()
+	point := otlpHistogramPoint{
+		Attributes:        otlpAttributes(m.GetLabel()),
+		StartTimeUnixNano: start,
+		TimeUnixNano:      ts,
+		Count:             strconv.FormatUint(h.GetSampleCount(), 10),
+		Sum:               h.GetSampleSum(),
+	}
+
+	var prev uint64
+	for _, b := range h.GetBucket() {
+		point.ExplicitBounds = append(point.ExplicitBounds, b.GetUpperBound())
+		point.BucketCounts = append(point.BucketCounts, strconv.FormatUint(b.GetCumulativeCount()-prev, 10))
+		prev = b.GetCumulativeCount()
+	}
+	point.BucketCounts = append(point.BucketCounts, strconv.FormatUint(h.GetSampleCount()-prev, 10))
+
+	return point
+}
+
+// otlpAttributes converts labels into OTLP attributes, skipping empty values
+func otlpAttributes(labels []*dto.LabelPair) []otlpAttribute {
+	var attrs []otlpAttribute
+	for _, l := range labels {
+		if l.GetValue() == "" {
+			continue
+		}
+		attrs = append(attrs, otlpAttribute{Key: l.GetName(), Value: otlpStringJSON{StringValue: l.GetValue()}})
+	}
+	return attrs
+}
@@ -0,0 +1,135 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// newTestRegistry registers a counter, gauge and histogram with sample values
+func newTestRegistry() (*prometheus.Registry, *prometheus.CounterVec) {
+	reg := prometheus.NewRegistry()
+
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_requests_total", Help: "requests"}, []string{"channel"})
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_active", Help: "active"})
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test_latency_seconds", Help: "latency", Buckets: []float64{0.1, 1}})
+	reg.MustRegister(counter, gauge, histogram)
+
+	counter.WithLabelValues("openai").Add(3)
+	gauge.Set(2)
+	histogram.Observe(0.05)
+	histogram.Observe(0.5)
+	histogram.Observe(5)
+
+	return reg, counter
+}
+
+func TestPushStatsD(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer conn.Close()
+
+	reg, counter := newTestRegistry()
+	pusher, err := NewPusher(PushOptions{Exporter: ExporterStatsD, Endpoint: conn.LocalAddr().String(), Prefix: "gw."})
+	if err != nil {
+		t.Fatalf("Failed to create pusher: %v", err)
+	}
+	pusher.gatherer = reg
+
+	read := func() string {
+		buf := make([]byte, 4096)
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("Failed to read datagram: %v", err)
+		}
+		return string(buf[:n])
+	}
+
+	if err := pusher.Push(); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	packet := read()
+	for _, expected := range []string{
+		"gw.test_requests_total:3|c|#channel:openai",
+		"gw.test_active:2|g",
+		"gw.test_latency_seconds.count:3|c",
+	} {
+		if !strings.Contains(packet, expected) {
+			t.Errorf("Expected %q in packet:\n%s", expected, packet)
+		}
+	}
+
+	// Counters are sent as deltas
+	counter.WithLabelValues("openai").Add(2)
+	if err := pusher.Push(); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	packet = read()
+	if !strings.Contains(packet, "gw.test_requests_total:2|c|#channel:openai") {
+		t.Errorf("Expected counter delta in packet:\n%s", packet)
+	}
+	if strings.Contains(packet, "test_latency_seconds.count") {
+		t.Errorf("Unchanged counters should not be sent:\n%s", packet)
+	}
+}
+
+func TestPushOTLP(t *testing.T) {
+	var received otlpRequest
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Unexpected content type %s", r.Header.Get("Content-Type"))
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer collector.Close()
+
+	reg, _ := newTestRegistry()
+	pusher, err := NewPusher(PushOptions{Exporter: ExporterOTLP, Endpoint: collector.URL + "/v1/metrics"})
+	if err != nil {
+		t.Fatalf("Failed to create pusher: %v", err)
+	}
+	pusher.gatherer = reg
+
+	if err := pusher.Push(); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+
+	metrics := map[string]otlpMetric{}
+	for _, m := range received.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		metrics[m.Name] = m
+	}
+
+	sum := metrics["test_requests_total"].Sum
+	if sum == nil || !sum.IsMonotonic || sum.DataPoints[0].AsDouble != 3 {
+		t.Errorf("Unexpected counter: %+v", sum)
+	}
+	if sum.DataPoints[0].Attributes[0].Value.StringValue != "openai" {
+		t.Errorf("Expected channel attribute, got %+v", sum.DataPoints[0].Attributes)
+	}
+
+	hist := metrics["test_latency_seconds"].Histogram
+	if hist == nil {
+		t.Fatal("Expected histogram")
+	}
+	if got := strings.Join(hist.DataPoints[0].BucketCounts, ","); got != "1,1,1" {
+		t.Errorf("Expected per-bucket counts 1,1,1, got %s", got)
+	}
+}
+
+func TestNewPusherValidation(t *testing.T) {
+	if _, err := NewPusher(PushOptions{Exporter: "graphite", Endpoint: "x"}); err == nil {
+		t.Error("Expected error for unknown exporter")
+	}
+	if _, err := NewPusher(PushOptions{Exporter: ExporterStatsD}); err == nil {
+		t.Error("Expected error for missing endpoint")
+	}
+}
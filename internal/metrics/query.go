@@ -0,0 +1,213 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// LatencySummary summarizes a channel's latency histogram since the process
+// started. Quantiles, in seconds, are interpolated within histogram buckets
+// and are nil when no requests were observed.
+type LatencySummary struct {
+	Count uint64   `json:"count"`
+	P50   *float64 `json:"p50"`
+	P90   *float64 `json:"p90"`
+	P99   *float64 `json:"p99"`
+}
+
+// ChannelLatencySummary returns latency quantiles for a channel and model
+func ChannelLatencySummary(channel, model string) LatencySummary {
+	h := findMetric(ChannelLatency, map[string]string{"channel": channel, "model": modelLabel(model)})
+	if h == nil || h.GetHistogram() == nil || h.GetHistogram().GetSampleCount() == 0 {
+		return LatencySummary{}
+	}
+
+	hist := h.GetHistogram()
+	quantile := func(q float64) *float64 {
+		v := histogramQuantile(hist, q)
+		return &v
+	}
+	return LatencySummary{
+		Count: hist.GetSampleCount(),
+		P50:   quantile(0.5),
+		P90:   quantile(0.9),
+		P99:   quantile(0.99),
+	}
+}
+
+// ChannelTokens returns the prompt and completion tokens recorded for a
+// channel and model
+func ChannelTokens(channel, model string) (prompt, completion float64) {
+	labels := map[string]string{"channel": channel, "model": modelLabel(model), "type": "prompt"}
+	if m := findMetric(TokensTotal, labels); m != nil {
+		prompt = m.GetCounter().GetValue()
+	}
+	labels["type"] = "completion"
+	if m := findMetric(TokensTotal, labels); m != nil {
+		completion = m.GetCounter().GetValue()
+	}
+	return prompt, completion
+}
+
+// ModelRequestCounts returns the total and failed requests recorded for a
+// model, or for all models when model is empty
+func ModelRequestCounts(model string) (total, errors float64) {
+	for _, m := range collectMetrics(ModelRequests, modelSelector(model)) {
+		value := m.GetCounter().GetValue()
+		total += value
+		if labelValue(m, "outcome") == OutcomeError {
+			errors += value
+		}
+	}
+	return total, errors
+}
+
+// ModelLatencyCounts returns the number of channel latencies observed for a
+// model, or for all models when model is empty, and how many of them were at
+// most threshold seconds. Counts within a bucket are interpolated linearly.
+func ModelLatencyCounts(model string, threshold float64) (total, fast float64) {
+	for _, m := range collectMetrics(ChannelLatency, modelSelector(model)) {
+		h := m.GetHistogram()
+		total += float64(h.GetSampleCount())
+		fast += histogramCountBelow(h, threshold)
+	}
+	return total, fast
+}
+
+// ChannelQuality returns the number of responses checked for quality signals
+// on a channel and how many of them raised each signal
+func ChannelQuality(channel string) (checked float64, signals map[string]float64) {
+	if m := findMetric(QualityChecked, map[string]string{"channel": channel}); m != nil {
+		checked = m.GetCounter().GetValue()
+	}
+	signals = make(map[string]float64)
+	for _, m := range collectMetrics(QualitySignals, map[string]string{"channel": channel}) {
+		signals[labelValue(m, "signal")] += m.GetCounter().GetValue()
+	}
+	return checked, signals
+}
+
+// modelSelector returns the labels selecting a model's series
+func modelSelector(model string) map[string]string {
+	if model == "" {
+		return nil
+	}
+	return map[string]string{"model": modelLabel(model)}
+}
+
+// labelValue returns the value of a metric's label
+func labelValue(m *dto.Metric, name string) string {
+	for _, p := range m.GetLabel() {
+		if p.GetName() == name {
+			return p.GetValue()
+		}
+	}
+	return ""
+}
+
+// collectMetrics returns the series of a collector carrying all of the given
+// labels, whatever their other labels
+func collectMetrics(c prometheus.Collector, labels map[string]string) []*dto.Metric {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+
+	var found []*dto.Metric
+	for metric := range ch {
+		var m dto.Metric
+		if err := metric.Write(&m); err != nil {
+			continue
+		}
+		matched := true
+		for name, value := range labels {
+			if labelValue(&m, name) != value {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			found = append(found, &m)
+		}
+	}
+	return found
+}
+
+// histogramCountBelow estimates the observations at most threshold by linear
+// interpolation within the bucket that contains it
+func histogramCountBelow(h *dto.Histogram, threshold float64) float64 {
+	lowerBound, lowerCount := 0.0, 0.0
+	for _, b := range h.GetBucket() {
+		upperBound, upperCount := b.GetUpperBound(), float64(b.GetCumulativeCount())
+		if threshold <= upperBound {
+			if upperBound == lowerBound {
+				return upperCount
+			}
+			return lowerCount + (upperCount-lowerCount)*(threshold-lowerBound)/(upperBound-lowerBound)
+		}
+		lowerBound, lowerCount = upperBound, upperCount
+	}
+	// Beyond the highest finite bound every observation in a finite bucket is fast
+	return lowerCount
+}
+
+// findMetric returns the series of a collector with exactly the given labels,
+// without creating it when absent
+func findMetric(c prometheus.Collector, labels map[string]string) *dto.Metric {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+
+	var found *dto.Metric
+	for metric := range ch {
+		if found != nil {
+			continue
+		}
+		var m dto.Metric
+		if err := metric.Write(&m); err != nil {
+			continue
+		}
+		if labelsMatch(m.GetLabel(), labels) {
+			found = &m
+		}
+	}
+	return found
+}
+
+// labelsMatch reports whether label pairs are exactly the given labels
+func labelsMatch(pairs []*dto.LabelPair, labels map[string]string) bool {
+	if len(pairs) != len(labels) {
+		return false
+	}
+	for _, p := range pairs {
+		if value, ok := labels[p.GetName()]; !ok || value != p.GetValue() {
+			return false
+		}
+	}
+	return true
+}
+
+// histogramQuantile estimates a quantile by linear interpolation within the
+// bucket that contains it, as PromQL's histogram_quantile does
+func histogramQuantile(h *dto.Histogram, q float64) float64 {
+	total := float64(h.GetSampleCount())
+	rank := q * total
+
+	lowerBound, lowerCount := 0.0, 0.0
+	for _, b := range h.GetBucket() {
+		upperBound, upperCount := b.GetUpperBound(), float64(b.GetCumulativeCount())
+		if upperCount >= rank {
+			if upperCount == lowerCount {
+				return upperBound
+			}
+			return lowerBound + (upperBound-lowerBound)*(rank-lowerCount)/(upperCount-lowerCount)
+		}
+		lowerBound, lowerCount = upperBound, upperCount
+	}
+
+	// The quantile falls in the +Inf bucket; report the highest finite bound
+	return lowerBound
+}
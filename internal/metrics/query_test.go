@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestChannelLatencySummary(t *testing.T) {
+	if s := ChannelLatencySummary("query-test", "none"); s.Count != 0 || s.P50 != nil {
+		t.Errorf("Expected an empty summary for an unseen channel, got %+v", s)
+	}
+
+	// 90 fast requests and 10 slow ones
+	for i := 0; i < 90; i++ {
+		RecordChannelLatency("query-test", "gpt-4", 20*time.Millisecond)
+	}
+	for i := 0; i < 10; i++ {
+		RecordChannelLatency("query-test", "gpt-4", 3*time.Second)
+	}
+
+	s := ChannelLatencySummary("query-test", "gpt-4")
+	if s.Count != 100 {
+		t.Fatalf("Expected 100 samples, got %d", s.Count)
+	}
+	if *s.P50 < 0.01 || *s.P50 > 0.025 {
+		t.Errorf("Expected p50 within the 10-25ms bucket, got %v", *s.P50)
+	}
+	if *s.P99 < 2.5 || *s.P99 > 5 {
+		t.Errorf("Expected p99 within the 2.5-5s bucket, got %v", *s.P99)
+	}
+	if math.IsNaN(*s.P90) {
+		t.Error("Expected a p90 value")
+	}
+}
+
+func TestChannelTokens(t *testing.T) {
+	RecordTokens("query-tokens", "gpt-4", 10, 4)
+	RecordTokens("query-tokens", "gpt-4", 5, 1)
+
+	prompt, completion := ChannelTokens("query-tokens", "gpt-4")
+	if prompt != 15 || completion != 5 {
+		t.Errorf("Expected 15 prompt and 5 completion tokens, got %v and %v", prompt, completion)
+	}
+}
+
+func TestModelRequestCounts(t *testing.T) {
+	for i := 0; i < 9; i++ {
+		RecordModelRequest("query-requests", true)
+	}
+	RecordModelRequest("query-requests", false)
+
+	total, errors := ModelRequestCounts("query-requests")
+	if total != 10 || errors != 1 {
+		t.Errorf("Expected 10 requests with 1 error, got %v and %v", total, errors)
+	}
+
+	if all, _ := ModelRequestCounts(""); all < total {
+		t.Errorf("Expected all models to include %v requests, got %v", total, all)
+	}
+}
+
+func TestModelLatencyCounts(t *testing.T) {
+	// Spread over two channels; the threshold falls between buckets
+	for i := 0; i < 8; i++ {
+		RecordChannelLatency("query-latency-a", "query-latency", 50*time.Millisecond)
+	}
+	RecordChannelLatency("query-latency-b", "query-latency", 20*time.Second)
+	RecordChannelLatency("query-latency-b", "query-latency", 20*time.Second)
+
+	total, fast := ModelLatencyCounts("query-latency", 1)
+	if total != 10 || fast != 8 {
+		t.Errorf("Expected 8 of 10 latencies under 1s, got %v of %v", fast, total)
+	}
+}
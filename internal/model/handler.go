@@ -35,7 +35,10 @@ func (h *Handler) RegisterRoutes(r *gin.RouterGroup) {
 
 // CreateModelRequest represents a model creation request
 type CreateModelRequest struct {
-	Name string `json:"name" binding:"required"`
+	Name             string `json:"name" binding:"required"`
+	ContextWindow    int    `json:"context_window" binding:"min=0"`
+	Truncate         bool   `json:"truncate"`
+	MaxStreamSeconds int    `json:"max_stream_seconds" binding:"min=0"`
 }
 
 // CreateModel handles creating a new model
@@ -47,11 +50,14 @@ func (h *Handler) CreateModel(c *gin.Context) {
 	}
 
 	model := &database.Model{
-		Name: req.Name,
+		Name:             req.Name,
+		ContextWindow:    req.ContextWindow,
+		Truncate:         req.Truncate,
+		MaxStreamSeconds: req.MaxStreamSeconds,
 	}
 
 	if err := h.db.CreateModel(model); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(database.StatusForError(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -93,7 +99,10 @@ func (h *Handler) GetModel(c *gin.Context) {
 
 // UpdateModelRequest represents a model update request
 type UpdateModelRequest struct {
-	Name string `json:"name" binding:"required"`
+	Name             string `json:"name" binding:"required"`
+	ContextWindow    *int   `json:"context_window" binding:"omitempty,min=0"`
+	Truncate         *bool  `json:"truncate"`
+	MaxStreamSeconds *int   `json:"max_stream_seconds" binding:"omitempty,min=0"`
 }
 
 // UpdateModel handles updating a model
@@ -122,8 +131,17 @@ func (h *Handler) UpdateModel(c *gin.Context) {
 	}
 
 	model.Name = req.Name
+	if req.ContextWindow != nil {
+		model.ContextWindow = *req.ContextWindow
+	}
+	if req.Truncate != nil {
+		model.Truncate = *req.Truncate
+	}
+	if req.MaxStreamSeconds != nil {
+		model.MaxStreamSeconds = *req.MaxStreamSeconds
+	}
 	if err := h.db.UpdateModel(model); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(database.StatusForError(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -158,6 +176,10 @@ type AddModelChannelRequest struct {
 	ChannelID        int64  `json:"channel_id" binding:"required"`
 	BackendModelName string `json:"backend_model_name" binding:"required"`
 	Weight           int    `json:"weight"`
+	StreamMode       string `json:"stream_mode"`
+	// Dimensions declares the embeddings length of the backend; 0 learns it
+	// from the first response
+	Dimensions int `json:"dimensions" binding:"min=0"`
 }
 
 // AddModelChannel handles adding a channel to a model
@@ -174,15 +196,22 @@ func (h *Handler) AddModelChannel(c *gin.Context) {
 		return
 	}
 
+	if req.StreamMode != "" && !database.IsValidStreamMode(req.StreamMode) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid stream mode: " + req.StreamMode})
+		return
+	}
+
 	mc := &database.ModelChannel{
 		ModelID:          modelID,
 		ChannelID:        req.ChannelID,
 		BackendModelName: req.BackendModelName,
 		Weight:           req.Weight,
+		StreamMode:       req.StreamMode,
+		Dimensions:       req.Dimensions,
 	}
 
 	if err := h.db.AddModelChannel(mc); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(database.StatusForError(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -0,0 +1,286 @@
+// Package probe runs synthetic requests with golden prompts against every
+// channel of a model, so a broken channel is noticed before users hit it.
+// Results are kept as history and fed into channel health.
+package probe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/internal/channel"
+	"github.com/X0Ken/openai-gateway/internal/provider"
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/X0Ken/openai-gateway/pkg/health"
+	"github.com/X0Ken/openai-gateway/pkg/workerpool"
+)
+
+// PollInterval is how often RunDue should look for probes that are due
+const PollInterval = 10 * time.Second
+
+// runConcurrency bounds the number of channels probed in parallel
+const runConcurrency = 8
+
+// maxTokens bounds the completion requested by a probe
+const maxTokens = 64
+
+// Options configures a Runner
+type Options struct {
+	// Timeout bounds each probe request
+	Timeout time.Duration
+	// Retention is how long results are kept
+	Retention time.Duration
+}
+
+// Runner periodically runs enabled probes
+type Runner struct {
+	db     *database.DB
+	health *health.Checker
+	opts   Options
+	client *http.Client
+
+	mu      sync.Mutex
+	lastRun map[int64]time.Time
+	pruned  time.Time
+}
+
+// NewRunner creates a probe runner. Results update the health checker's
+// channel status when one is given.
+func NewRunner(db *database.DB, checker *health.Checker, opts Options) *Runner {
+	return &Runner{
+		db:      db,
+		health:  checker,
+		opts:    opts,
+		client:  &http.Client{Timeout: opts.Timeout},
+		lastRun: make(map[int64]time.Time),
+	}
+}
+
+// RunDue runs every enabled probe whose interval has passed since its last
+// run, and prunes expired results
+func (r *Runner) RunDue(ctx context.Context, now time.Time) {
+	probes, err := r.db.ListProbes()
+	if err != nil {
+		log.Printf("Failed to list probes: %v", err)
+		return
+	}
+
+	for _, p := range probes {
+		if !p.Enabled || !r.due(p, now) {
+			continue
+		}
+		if _, err := r.Run(ctx, p); err != nil {
+			log.Printf("Failed to run probe %s: %v", p.Name, err)
+		}
+	}
+
+	r.prune(now)
+}
+
+// due reports whether a probe should run, marking it as run if so
+func (r *Runner) due(p *database.Probe, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if last, ok := r.lastRun[p.ID]; ok && now.Sub(last) < time.Duration(p.IntervalSeconds)*time.Second {
+		return false
+	}
+	r.lastRun[p.ID] = now
+	return true
+}
+
+// prune removes results older than the retention, at most once an hour
+func (r *Runner) prune(now time.Time) {
+	if r.opts.Retention <= 0 || now.Sub(r.pruned) < time.Hour {
+		return
+	}
+	r.pruned = now
+
+	removed, err := r.db.DeleteProbeResultsBefore(now.Add(-r.opts.Retention))
+	if err != nil {
+		log.Printf("Failed to prune probe results: %v", err)
+	} else if removed > 0 {
+		log.Printf("Pruned %d probe results", removed)
+	}
+}
+
+// target is a channel serving a probe's model
+type target struct {
+	channel      *database.Channel
+	backendModel string
+}
+
+// Run sends a probe to every enabled channel of its model and records the
+// results
+func (r *Runner) Run(ctx context.Context, p *database.Probe) ([]*database.ProbeResult, error) {
+	targets, err := r.targets(p.Model)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*database.ProbeResult, len(targets))
+	indexes := make([]int, len(targets))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	workerpool.Run(ctx, runConcurrency, indexes, func(ctx context.Context, i int) error {
+		results[i] = r.probe(ctx, p, targets[i])
+		return nil
+	})
+
+	// Channels not probed because ctx was cancelled have no result
+	recorded := make([]*database.ProbeResult, 0, len(results))
+	for _, result := range results {
+		if result == nil {
+			continue
+		}
+		if err := r.db.CreateProbeResult(result); err != nil {
+			log.Printf("Failed to record probe result: %v", err)
+		}
+		r.reportHealth(result)
+		recorded = append(recorded, result)
+	}
+	return recorded, nil
+}
+
+// targets returns the enabled channels mapped to a model
+func (r *Runner) targets(model string) ([]target, error) {
+	m, err := r.db.GetModelByName(model)
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, fmt.Errorf("model not found: %s", model)
+	}
+
+	mappings, err := r.db.GetModelChannelsByModel(m.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []target
+	for _, mc := range mappings {
+		ch, err := r.db.GetChannel(mc.ChannelID)
+		if err != nil {
+			return nil, err
+		}
+		if ch != nil && ch.Enabled {
+			targets = append(targets, target{channel: ch, backendModel: mc.BackendModelName})
+		}
+	}
+	return targets, nil
+}
+
+// probe sends one probe request to a channel and checks the response
+func (r *Runner) probe(ctx context.Context, p *database.Probe, t target) *database.ProbeResult {
+	result := &database.ProbeResult{ProbeID: p.ID, ChannelID: t.channel.ID}
+
+	payload, err := json.Marshal(map[string]any{
+		"model":      t.backendModel,
+		"messages":   []map[string]string{{"role": "user", "content": p.Prompt}},
+		"max_tokens": maxTokens,
+	})
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	adapter := provider.For(t.channel)
+	req, err := adapter.NewRequest(ctx, t.channel, channel.OperationChat, t.backendModel, payload, t.channel.APIKey)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	start := time.Now()
+	resp, err := r.client.Do(req)
+	if err != nil {
+		result.LatencyMs = time.Since(start).Milliseconds()
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+
+	if err := adapter.ConvertResponse(resp, channel.OperationChat, payload); err != nil {
+		result.LatencyMs = time.Since(start).Milliseconds()
+		result.StatusCode = resp.StatusCode
+		result.Error = err.Error()
+		return result
+	}
+	body, err := io.ReadAll(resp.Body)
+	result.LatencyMs = time.Since(start).Milliseconds()
+	result.StatusCode = resp.StatusCode
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	if err := check(p, resp.StatusCode, body, result.LatencyMs); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Success = true
+	return result
+}
+
+// check asserts a probe response has the status, shape, content and latency
+// the probe expects
+func check(p *database.Probe, status int, body []byte, latencyMs int64) error {
+	if status != http.StatusOK {
+		return fmt.Errorf("unexpected status %d: %s", status, truncate(body))
+	}
+
+	var completion struct {
+		Choices []struct {
+			Message *struct {
+				Content *string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(body, &completion); err != nil {
+		return fmt.Errorf("response is not a chat completion: %v", err)
+	}
+	if len(completion.Choices) == 0 || completion.Choices[0].Message == nil || completion.Choices[0].Message.Content == nil {
+		return fmt.Errorf("response has no message content")
+	}
+
+	content := *completion.Choices[0].Message.Content
+	if p.Expect != "" && !strings.Contains(strings.ToLower(content), strings.ToLower(p.Expect)) {
+		return fmt.Errorf("response does not contain %q: %s", p.Expect, truncate([]byte(content)))
+	}
+	if p.MaxLatencyMs > 0 && latencyMs > int64(p.MaxLatencyMs) {
+		return fmt.Errorf("latency %dms exceeds %dms", latencyMs, p.MaxLatencyMs)
+	}
+	return nil
+}
+
+// truncate shortens a response body for an error message
+func truncate(body []byte) string {
+	const limit = 200
+	if len(body) > limit {
+		return string(body[:limit]) + "..."
+	}
+	return string(body)
+}
+
+// reportHealth feeds a probe result into the channel's health status
+func (r *Runner) reportHealth(result *database.ProbeResult) {
+	if r.health == nil {
+		return
+	}
+	if r.health.GetStatus(result.ChannelID) == nil {
+		r.health.RegisterChannel(result.ChannelID, "")
+	}
+
+	var err error
+	if !result.Success {
+		err = fmt.Errorf("probe %d failed: %s", result.ProbeID, result.Error)
+	}
+	r.health.UpdateStatus(result.ChannelID, result.Success, err)
+}
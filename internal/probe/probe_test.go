@@ -0,0 +1,111 @@
+package probe
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/X0Ken/openai-gateway/pkg/health"
+)
+
+// newBackend answers chat completions with the given content
+func newBackend(content string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":"` + content + `"},"finish_reason":"stop"}]}`))
+	}))
+}
+
+func TestRunRecordsResultsAndHealth(t *testing.T) {
+	dbPath := "/tmp/test_probe.db"
+	defer os.Remove(dbPath)
+
+	db, err := database.New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	good := newBackend("The capital of France is Paris.")
+	defer good.Close()
+	bad := newBackend("I don't know.")
+	defer bad.Close()
+
+	model := &database.Model{Name: "gpt-4"}
+	db.CreateModel(model)
+	var channels []*database.Channel
+	for _, url := range []string{good.URL, bad.URL} {
+		ch := &database.Channel{Name: url, BaseURL: url + "/v1", APIKey: "sk-test", Weight: 10, Enabled: true}
+		db.CreateChannel(ch)
+		db.AddModelChannel(&database.ModelChannel{ModelID: model.ID, ChannelID: ch.ID, BackendModelName: "gpt-4", Weight: 10})
+		channels = append(channels, ch)
+	}
+
+	probe := &database.Probe{Name: "capital", Model: "gpt-4", Prompt: "What is the capital of France?", Expect: "paris", IntervalSeconds: 60, Enabled: true}
+	if err := db.CreateProbe(probe); err != nil {
+		t.Fatalf("Failed to create probe: %v", err)
+	}
+
+	checker := health.NewChecker(time.Minute, time.Second)
+	runner := NewRunner(db, checker, Options{Timeout: 5 * time.Second})
+	now := time.Now()
+	runner.RunDue(context.Background(), now)
+
+	history, err := db.ListProbeResults(probe.ID, 0, 10)
+	if err != nil {
+		t.Fatalf("Failed to list probe results: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("Expected a result per channel, got %d", len(history))
+	}
+	for _, r := range history {
+		wantSuccess := r.ChannelID == channels[0].ID
+		if r.Success != wantSuccess || r.StatusCode != http.StatusOK {
+			t.Errorf("Channel %d: unexpected result %+v", r.ChannelID, r)
+		}
+	}
+	if status := checker.GetStatus(channels[0].ID); status == nil || status.Status != health.StatusHealthy {
+		t.Errorf("Expected the passing channel to be healthy, got %+v", status)
+	}
+	if status := checker.GetStatus(channels[1].ID); status == nil || status.ConsecutiveFailures != 1 || status.LastError == "" {
+		t.Errorf("Expected the failing channel to record a failure, got %+v", status)
+	}
+
+	// The probe is not due again until its interval has passed
+	runner.RunDue(context.Background(), now.Add(30*time.Second))
+	if history, _ := db.ListProbeResults(probe.ID, channels[0].ID, 10); len(history) != 1 {
+		t.Errorf("Expected no run before the interval, got %d results", len(history))
+	}
+	runner.RunDue(context.Background(), now.Add(time.Minute))
+	if history, _ := db.ListProbeResults(probe.ID, channels[0].ID, 10); len(history) != 2 {
+		t.Errorf("Expected a second run after the interval, got %d results", len(history))
+	}
+}
+
+func TestCheck(t *testing.T) {
+	probe := &database.Probe{Expect: "pong", MaxLatencyMs: 1000}
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		latency int64
+		ok      bool
+	}{
+		{"pass", 200, `{"choices":[{"message":{"content":"PONG"}}]}`, 10, true},
+		{"error status", 500, `{"error":"down"}`, 10, false},
+		{"not json", 200, `pong`, 10, false},
+		{"no choices", 200, `{"choices":[]}`, 10, false},
+		{"null content", 200, `{"choices":[{"message":{"content":null}}]}`, 10, false},
+		{"unexpected content", 200, `{"choices":[{"message":{"content":"ping"}}]}`, 10, false},
+		{"too slow", 200, `{"choices":[{"message":{"content":"pong"}}]}`, 2000, false},
+	}
+	for _, tt := range tests {
+		if err := check(probe, tt.status, []byte(tt.body), tt.latency); (err == nil) != tt.ok {
+			t.Errorf("%s: expected ok=%v, got %v", tt.name, tt.ok, err)
+		}
+	}
+}
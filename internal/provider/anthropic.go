@@ -0,0 +1,460 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/internal/channel"
+	"github.com/X0Ken/openai-gateway/pkg/database"
+)
+
+// Anthropic API defaults
+const (
+	// anthropicVersion is sent as the anthropic-version header unless the
+	// channel pins an API version
+	anthropicVersion = "2023-06-01"
+	// anthropicMaxTokens is used when a request does not limit its output,
+	// since the Messages API requires a limit
+	anthropicMaxTokens = 4096
+)
+
+// anthropic adapts chat completions to the Anthropic Messages API
+type anthropic struct{}
+
+// NewRequest translates a chat completion request into a Messages request
+func (anthropic) NewRequest(ctx context.Context, ch *database.Channel, op channel.Operation, model string, body []byte, apiKey string) (*http.Request, error) {
+	if op != channel.OperationChat {
+		return nil, unsupported(ch, op)
+	}
+
+	payload, err := toAnthropicRequest(body, model)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := channel.JoinURL(ch.BaseURL, "/messages")
+	if tmpl, ok := ch.PathTemplates[string(op)]; ok && tmpl != "" {
+		endpoint = strings.TrimRight(ch.BaseURL, "/") + strings.ReplaceAll(tmpl, "{model}", url.PathEscape(model))
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+
+	version := ch.APIVersion
+	if version == "" {
+		version = anthropicVersion
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Api-Key", apiKey)
+	req.Header.Set("Anthropic-Version", version)
+	return req, nil
+}
+
+// ConvertResponse translates a Messages response, stream or error into
+// OpenAI format
+func (anthropic) ConvertResponse(resp *http.Response, op channel.Operation, body []byte) error {
+	convertAnthropicHeaders(resp.Header, time.Now())
+
+	if resp.StatusCode != http.StatusOK {
+		return replaceBody(resp, convertAnthropicError)
+	}
+
+	var req openAIRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return err
+	}
+	if req.Stream {
+		includeUsage := req.StreamOptions != nil && req.StreamOptions.IncludeUsage
+		resp.Body = newAnthropicStream(resp.Body, includeUsage)
+		resp.Header.Set("Content-Type", "text/event-stream")
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		return nil
+	}
+	return replaceBody(resp, convertAnthropicMessage)
+}
+
+// replaceBody reads a response body and replaces it with its conversion
+func replaceBody(resp *http.Response, convert func([]byte) ([]byte, error)) error {
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	converted, err := convert(data)
+	if err != nil {
+		return err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(converted))
+	resp.ContentLength = int64(len(converted))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(converted)))
+	return nil
+}
+
+// anthropicRateLimitHeaders maps Anthropic rate limit headers to their
+// OpenAI equivalents, as remaining and reset header pairs
+var anthropicRateLimitHeaders = [][4]string{
+	{"Anthropic-Ratelimit-Requests-Remaining", "Anthropic-Ratelimit-Requests-Reset", "X-Ratelimit-Remaining-Requests", "X-Ratelimit-Reset-Requests"},
+	{"Anthropic-Ratelimit-Tokens-Remaining", "Anthropic-Ratelimit-Tokens-Reset", "X-Ratelimit-Remaining-Tokens", "X-Ratelimit-Reset-Tokens"},
+}
+
+// convertAnthropicHeaders adds the OpenAI rate limit headers equivalent to
+// Anthropic's. Anthropic reports resets as RFC 3339 times
+// and OpenAI as durations.
+func convertAnthropicHeaders(header http.Header, now time.Time) {
+	for _, names := range anthropicRateLimitHeaders {
+		if remaining := header.Get(names[0]); remaining != "" {
+			header.Set(names[2], remaining)
+		}
+		if reset, err := time.Parse(time.RFC3339, header.Get(names[1])); err == nil {
+			header.Set(names[3], max(reset.Sub(now), 0).Round(time.Second).String())
+		}
+	}
+}
+
+// anthropicRequest is a Messages API request
+type anthropicRequest struct {
+	Model         string              `json:"model"`
+	System        string              `json:"system,omitempty"`
+	Messages      []anthropicMessage  `json:"messages"`
+	MaxTokens     int                 `json:"max_tokens"`
+	Temperature   *float64            `json:"temperature,omitempty"`
+	TopP          *float64            `json:"top_p,omitempty"`
+	StopSequences []string            `json:"stop_sequences,omitempty"`
+	Stream        bool                `json:"stream,omitempty"`
+	Metadata      *anthropicMetadata  `json:"metadata,omitempty"`
+	Tools         []anthropicTool     `json:"tools,omitempty"`
+	ToolChoice    *anthropicToolUsage `json:"tool_choice,omitempty"`
+}
+
+// anthropicMetadata identifies the end user of a request
+type anthropicMetadata struct {
+	UserID string `json:"user_id"`
+}
+
+// anthropicMessage is a Messages API turn
+type anthropicMessage struct {
+	Role    string           `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+// anthropicBlock is a content block of a message or response
+type anthropicBlock struct {
+	Type      string           `json:"type"`
+	Text      string           `json:"text,omitempty"`
+	Source    *anthropicSource `json:"source,omitempty"`
+	ID        string           `json:"id,omitempty"`
+	Name      string           `json:"name,omitempty"`
+	Input     json.RawMessage  `json:"input,omitempty"`
+	ToolUseID string           `json:"tool_use_id,omitempty"`
+	Content   string           `json:"content,omitempty"`
+}
+
+// anthropicSource is the source of an image block
+type anthropicSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+// anthropicTool is a tool the model may use
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+// anthropicToolUsage controls how the model uses tools
+type anthropicToolUsage struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+}
+
+// toAnthropicRequest translates a chat completion request body into a
+// Messages request body for model
+func toAnthropicRequest(body []byte, model string) ([]byte, error) {
+	var req openAIRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+
+	out := anthropicRequest{
+		Model:       model,
+		MaxTokens:   anthropicMaxTokens,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+		Stream:      req.Stream,
+	}
+	if req.MaxCompletionTokens != nil {
+		out.MaxTokens = *req.MaxCompletionTokens
+	} else if req.MaxTokens != nil {
+		out.MaxTokens = *req.MaxTokens
+	}
+	// OpenAI temperatures range up to 2, Anthropic's up to 1
+	if out.Temperature != nil && *out.Temperature > 1 {
+		one := 1.0
+		out.Temperature = &one
+	}
+	if req.User != "" {
+		out.Metadata = &anthropicMetadata{UserID: req.User}
+	}
+
+	stop, err := stopSequences(req.Stop)
+	if err != nil {
+		return nil, err
+	}
+	out.StopSequences = stop
+
+	var system []string
+	for _, m := range req.Messages {
+		switch m.Role {
+		case "system", "developer":
+			text, err := textContent(m.Content)
+			if err != nil {
+				return nil, err
+			}
+			system = append(system, text)
+		case "user":
+			blocks, err := contentBlocks(m.Content)
+			if err != nil {
+				return nil, err
+			}
+			out.Messages = appendMessage(out.Messages, "user", blocks)
+		case "assistant":
+			blocks, err := contentBlocks(m.Content)
+			if err != nil {
+				return nil, err
+			}
+			for _, call := range m.ToolCalls {
+				input := json.RawMessage(call.Function.Arguments)
+				if !json.Valid(input) {
+					input = json.RawMessage("{}")
+				}
+				blocks = append(blocks, anthropicBlock{Type: "tool_use", ID: call.ID, Name: call.Function.Name, Input: input})
+			}
+			out.Messages = appendMessage(out.Messages, "assistant", blocks)
+		case "tool":
+			text, err := textContent(m.Content)
+			if err != nil {
+				return nil, err
+			}
+			out.Messages = appendMessage(out.Messages, "user", []anthropicBlock{{Type: "tool_result", ToolUseID: m.ToolCallID, Content: text}})
+		default:
+			return nil, fmt.Errorf("%w: message role %q", ErrUnsupported, m.Role)
+		}
+	}
+	out.System = strings.Join(system, "\n\n")
+
+	for _, tool := range req.Tools {
+		if tool.Type != "function" {
+			return nil, fmt.Errorf("%w: tool type %q", ErrUnsupported, tool.Type)
+		}
+		schema := tool.Function.Parameters
+		if len(schema) == 0 {
+			schema = json.RawMessage(`{"type":"object","properties":{}}`)
+		}
+		out.Tools = append(out.Tools, anthropicTool{Name: tool.Function.Name, Description: tool.Function.Description, InputSchema: schema})
+	}
+	if out.ToolChoice, err = toolChoice(req.ToolChoice); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(out)
+}
+
+// appendMessage appends a turn, merging it into the previous one when both
+// have the same role, since tool results and user text alternate with
+// assistant turns in the Messages API
+func appendMessage(messages []anthropicMessage, role string, blocks []anthropicBlock) []anthropicMessage {
+	if len(blocks) == 0 {
+		return messages
+	}
+	if n := len(messages); n > 0 && messages[n-1].Role == role {
+		messages[n-1].Content = append(messages[n-1].Content, blocks...)
+		return messages
+	}
+	return append(messages, anthropicMessage{Role: role, Content: blocks})
+}
+
+// contentBlocks converts message content into text and image blocks.
+// Empty text is dropped, since the Messages API rejects empty blocks.
+func contentBlocks(content json.RawMessage) ([]anthropicBlock, error) {
+	parts, err := contentParts(content)
+	if err != nil {
+		return nil, err
+	}
+	var blocks []anthropicBlock
+	for _, part := range parts {
+		switch part.Type {
+		case "text":
+			if part.Text != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: part.Text})
+			}
+		case "image_url":
+			if part.ImageURL == nil || part.ImageURL.URL == "" {
+				return nil, fmt.Errorf("%w: image_url part without a url", ErrUnsupported)
+			}
+			blocks = append(blocks, anthropicBlock{Type: "image", Source: imageSource(part.ImageURL.URL)})
+		default:
+			return nil, fmt.Errorf("%w: %s content", ErrUnsupported, part.Type)
+		}
+	}
+	return blocks, nil
+}
+
+// imageSource converts an image URL, which may be a base64 data URL, into
+// an image source
+func imageSource(imageURL string) *anthropicSource {
+	if rest, ok := strings.CutPrefix(imageURL, "data:"); ok {
+		if mediaType, data, ok := strings.Cut(rest, ";base64,"); ok {
+			return &anthropicSource{Type: "base64", MediaType: mediaType, Data: data}
+		}
+	}
+	return &anthropicSource{Type: "url", URL: imageURL}
+}
+
+// toolChoice converts an OpenAI tool_choice into its Anthropic equivalent
+func toolChoice(choice json.RawMessage) (*anthropicToolUsage, error) {
+	if len(choice) == 0 || string(choice) == "null" {
+		return nil, nil
+	}
+	var mode string
+	if err := json.Unmarshal(choice, &mode); err == nil {
+		switch mode {
+		case "auto":
+			return &anthropicToolUsage{Type: "auto"}, nil
+		case "none":
+			return &anthropicToolUsage{Type: "none"}, nil
+		case "required":
+			return &anthropicToolUsage{Type: "any"}, nil
+		}
+		return nil, fmt.Errorf("%w: tool_choice %q", ErrUnsupported, mode)
+	}
+	var named struct {
+		Function struct {
+			Name string `json:"name"`
+		} `json:"function"`
+	}
+	if err := json.Unmarshal(choice, &named); err != nil || named.Function.Name == "" {
+		return nil, fmt.Errorf("%w: tool_choice must name a function", ErrUnsupported)
+	}
+	return &anthropicToolUsage{Type: "tool", Name: named.Function.Name}, nil
+}
+
+// anthropicUsage is the token usage of a Messages response
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+// promptTokens counts every input token, cached or not
+func (u anthropicUsage) promptTokens() int {
+	return u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+}
+
+// anthropicResponse is a Messages API response
+type anthropicResponse struct {
+	ID         string           `json:"id"`
+	Model      string           `json:"model"`
+	Content    []anthropicBlock `json:"content"`
+	StopReason string           `json:"stop_reason"`
+	Usage      anthropicUsage   `json:"usage"`
+}
+
+// newOpenAIUsage converts Anthropic token usage
+func newOpenAIUsage(u anthropicUsage) openAIUsage {
+	prompt := u.promptTokens()
+	return openAIUsage{PromptTokens: prompt, CompletionTokens: u.OutputTokens, TotalTokens: prompt + u.OutputTokens}
+}
+
+// finishReason maps an Anthropic stop reason to an OpenAI finish reason
+func finishReason(stopReason string) string {
+	switch stopReason {
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	case "refusal":
+		return "content_filter"
+	}
+	return "stop"
+}
+
+// convertAnthropicMessage converts a Messages response body into a chat
+// completion response body
+func convertAnthropicMessage(data []byte) ([]byte, error) {
+	var msg anthropicResponse
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, fmt.Errorf("invalid Anthropic response: %w", err)
+	}
+
+	message := openAIResponseMessage{Role: "assistant"}
+	var texts []string
+	for _, block := range msg.Content {
+		switch block.Type {
+		case "text":
+			texts = append(texts, block.Text)
+		case "tool_use":
+			var arguments bytes.Buffer
+			if err := json.Compact(&arguments, block.Input); err != nil {
+				arguments.WriteString("{}")
+			}
+			message.ToolCalls = append(message.ToolCalls, openAIResponseToolCall{
+				ID:       block.ID,
+				Type:     "function",
+				Function: openAIFunctionCall{Name: block.Name, Arguments: arguments.String()},
+			})
+		}
+	}
+	if len(texts) > 0 || len(message.ToolCalls) == 0 {
+		content := strings.Join(texts, "")
+		message.Content = &content
+	}
+
+	return json.Marshal(openAIResponse{
+		ID:      msg.ID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   msg.Model,
+		Choices: []openAIChoice{{Message: message, FinishReason: finishReason(msg.StopReason)}},
+		Usage:   newOpenAIUsage(msg.Usage),
+	})
+}
+
+// anthropicError is the body of a Messages API error response or stream
+// error event
+type anthropicError struct {
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// openAIError converts the error into an OpenAI error body
+func (e anthropicError) openAIError() ([]byte, error) {
+	return json.Marshal(map[string]any{
+		"error": map[string]any{"message": e.Error.Message, "type": e.Error.Type, "param": nil, "code": nil},
+	})
+}
+
+// convertAnthropicError converts an error response body into OpenAI
+// format, leaving bodies that are not Anthropic errors unchanged
+func convertAnthropicError(data []byte) ([]byte, error) {
+	var e anthropicError
+	if err := json.Unmarshal(data, &e); err != nil || e.Error.Message == "" {
+		return data, nil
+	}
+	return e.openAIError()
+}
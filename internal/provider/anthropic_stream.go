@@ -0,0 +1,152 @@
+package provider
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// errStreamTruncated is returned when a Messages stream ends before its
+// message_stop event
+var errStreamTruncated = errors.New("backend stream ended before message_stop")
+
+// anthropicEvent holds the fields of the Messages stream events the
+// conversion uses
+type anthropicEvent struct {
+	Type    string `json:"type"`
+	Message struct {
+		ID    string         `json:"id"`
+		Model string         `json:"model"`
+		Usage anthropicUsage `json:"usage"`
+	} `json:"message"`
+	Index        int            `json:"index"`
+	ContentBlock anthropicBlock `json:"content_block"`
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage *anthropicUsage `json:"usage"`
+	anthropicError
+}
+
+// anthropicStream converts a Messages event stream into chat completion
+// chunks as it is read. Events are converted one at a time, so memory stays
+// bounded however long the stream runs.
+type anthropicStream struct {
+	chunkWriter
+	body   io.ReadCloser
+	reader *bufio.Reader
+	err    error
+
+	includeUsage bool
+	usage        anthropicUsage
+	// toolCalls maps the index of each tool_use block to its tool call index
+	toolCalls map[int]int
+}
+
+// newAnthropicStream returns a reader converting a Messages event stream.
+// With includeUsage the usage is sent in a final chunk, as OpenAI does for
+// stream_options.include_usage.
+func newAnthropicStream(body io.ReadCloser, includeUsage bool) *anthropicStream {
+	return &anthropicStream{
+		body:         body,
+		reader:       bufio.NewReader(body),
+		includeUsage: includeUsage,
+		chunkWriter:  chunkWriter{created: time.Now().Unix()},
+		toolCalls:    make(map[int]int),
+	}
+}
+
+// Read returns converted chunks, reading events from the backend as needed
+func (s *anthropicStream) Read(p []byte) (int, error) {
+	for s.out.Len() == 0 && s.err == nil {
+		s.err = s.next()
+	}
+	if s.out.Len() > 0 {
+		return s.out.Read(p)
+	}
+	return 0, s.err
+}
+
+// Close closes the backend stream
+func (s *anthropicStream) Close() error {
+	return s.body.Close()
+}
+
+// next reads and converts one event. It returns io.EOF after message_stop.
+func (s *anthropicStream) next() error {
+	data, err := readEvent(s.reader)
+	if err == io.EOF {
+		return errStreamTruncated
+	}
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		return nil
+	}
+
+	var event anthropicEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return fmt.Errorf("invalid Anthropic stream event: %w", err)
+	}
+
+	switch event.Type {
+	case "message_start":
+		s.id, s.model, s.usage = event.Message.ID, event.Message.Model, event.Message.Usage
+		empty := ""
+		s.writeChunk(openAIDelta{Role: "assistant", Content: &empty}, nil, nil)
+	case "content_block_start":
+		switch event.ContentBlock.Type {
+		case "text":
+			if event.ContentBlock.Text != "" {
+				s.writeChunk(openAIDelta{Content: &event.ContentBlock.Text}, nil, nil)
+			}
+		case "tool_use":
+			index := len(s.toolCalls)
+			s.toolCalls[event.Index] = index
+			s.writeChunk(openAIDelta{ToolCalls: []openAIResponseToolCall{{
+				Index:    &index,
+				ID:       event.ContentBlock.ID,
+				Type:     "function",
+				Function: openAIFunctionCall{Name: event.ContentBlock.Name},
+			}}}, nil, nil)
+		}
+	case "content_block_delta":
+		switch event.Delta.Type {
+		case "text_delta":
+			s.writeChunk(openAIDelta{Content: &event.Delta.Text}, nil, nil)
+		case "input_json_delta":
+			if index, ok := s.toolCalls[event.Index]; ok {
+				s.writeChunk(openAIDelta{ToolCalls: []openAIResponseToolCall{{
+					Index:    &index,
+					Function: openAIFunctionCall{Arguments: event.Delta.PartialJSON},
+				}}}, nil, nil)
+			}
+		}
+	case "message_delta":
+		if event.Usage != nil {
+			s.usage.OutputTokens = event.Usage.OutputTokens
+		}
+		if event.Delta.StopReason != "" {
+			reason := finishReason(event.Delta.StopReason)
+			s.writeChunk(openAIDelta{}, &reason, nil)
+		}
+	case "message_stop":
+		if s.includeUsage {
+			usage := newOpenAIUsage(s.usage)
+			s.writeChunk(openAIDelta{}, nil, &usage)
+		}
+		s.out.WriteString("data: [DONE]\n\n")
+		return io.EOF
+	case "error":
+		// The gateway reports the failure to the client
+		return fmt.Errorf("backend stream error: %s", event.Error.Message)
+	}
+	return nil
+}
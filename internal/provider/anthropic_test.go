@@ -0,0 +1,236 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/internal/channel"
+	"github.com/X0Ken/openai-gateway/pkg/database"
+)
+
+func TestToAnthropicRequest(t *testing.T) {
+	body := `{
+		"model": "claude",
+		"messages": [
+			{"role": "system", "content": "Be brief."},
+			{"role": "user", "content": [{"type": "text", "text": "What is in this image?"}, {"type": "image_url", "image_url": {"url": "data:image/png;base64,AAAA"}}]},
+			{"role": "assistant", "content": null, "tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "lookup", "arguments": "{\"q\":\"cat\"}"}}]},
+			{"role": "tool", "tool_call_id": "call_1", "content": "a cat"},
+			{"role": "user", "content": "Thanks"}
+		],
+		"max_tokens": 100,
+		"temperature": 1.5,
+		"stop": "END",
+		"user": "alice",
+		"tools": [{"type": "function", "function": {"name": "lookup", "parameters": {"type": "object"}}}],
+		"tool_choice": "required"
+	}`
+
+	data, err := toAnthropicRequest([]byte(body), "claude-3-5-sonnet")
+	if err != nil {
+		t.Fatalf("toAnthropicRequest failed: %v", err)
+	}
+	var got anthropicRequest
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Model != "claude-3-5-sonnet" || got.System != "Be brief." || got.MaxTokens != 100 {
+		t.Errorf("Unexpected model, system or max_tokens: %s", data)
+	}
+	if got.Temperature == nil || *got.Temperature != 1 {
+		t.Errorf("Expected temperature clamped to 1, got %v", got.Temperature)
+	}
+	if len(got.StopSequences) != 1 || got.Metadata == nil || got.Metadata.UserID != "alice" {
+		t.Errorf("Unexpected stop sequences or metadata: %s", data)
+	}
+	if len(got.Tools) != 1 || got.ToolChoice == nil || got.ToolChoice.Type != "any" {
+		t.Errorf("Unexpected tools: %s", data)
+	}
+
+	// The tool result and the following user text merge into one user turn
+	if len(got.Messages) != 3 {
+		t.Fatalf("Expected 3 turns, got %s", data)
+	}
+	user, assistant, result := got.Messages[0], got.Messages[1], got.Messages[2]
+	if len(user.Content) != 2 || user.Content[1].Type != "image" || user.Content[1].Source.Type != "base64" || user.Content[1].Source.MediaType != "image/png" {
+		t.Errorf("Unexpected user turn: %+v", user)
+	}
+	if assistant.Role != "assistant" || len(assistant.Content) != 1 || assistant.Content[0].Type != "tool_use" || string(assistant.Content[0].Input) != `{"q":"cat"}` {
+		t.Errorf("Unexpected assistant turn: %+v", assistant)
+	}
+	if result.Role != "user" || len(result.Content) != 2 || result.Content[0].Type != "tool_result" || result.Content[0].ToolUseID != "call_1" || result.Content[1].Text != "Thanks" {
+		t.Errorf("Unexpected tool result turn: %+v", result)
+	}
+}
+
+func TestToAnthropicRequestDefaults(t *testing.T) {
+	data, err := toAnthropicRequest([]byte(`{"messages":[{"role":"user","content":"hi"}],"stream":true}`), "claude")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got anthropicRequest
+	json.Unmarshal(data, &got)
+	if got.MaxTokens != anthropicMaxTokens || !got.Stream || got.System != "" {
+		t.Errorf("Unexpected defaults: %s", data)
+	}
+
+	_, err = toAnthropicRequest([]byte(`{"messages":[{"role":"user","content":[{"type":"input_audio"}]}]}`), "claude")
+	if !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Expected ErrUnsupported for audio content, got %v", err)
+	}
+}
+
+func TestConvertAnthropicMessage(t *testing.T) {
+	data, err := convertAnthropicMessage([]byte(`{
+		"id": "msg_1", "type": "message", "role": "assistant", "model": "claude",
+		"content": [{"type": "text", "text": "Let me check."}, {"type": "tool_use", "id": "toolu_1", "name": "lookup", "input": {"q": "cat"}}],
+		"stop_reason": "tool_use",
+		"usage": {"input_tokens": 10, "cache_read_input_tokens": 5, "output_tokens": 7}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got openAIResponse
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != "msg_1" || got.Object != "chat.completion" || len(got.Choices) != 1 {
+		t.Fatalf("Unexpected response: %s", data)
+	}
+	choice := got.Choices[0]
+	if choice.FinishReason != "tool_calls" || *choice.Message.Content != "Let me check." {
+		t.Errorf("Unexpected choice: %s", data)
+	}
+	if len(choice.Message.ToolCalls) != 1 || choice.Message.ToolCalls[0].Function.Arguments != `{"q":"cat"}` {
+		t.Errorf("Unexpected tool calls: %s", data)
+	}
+	if got.Usage != (openAIUsage{PromptTokens: 15, CompletionTokens: 7, TotalTokens: 22}) {
+		t.Errorf("Unexpected usage %+v", got.Usage)
+	}
+}
+
+func TestAnthropicStream(t *testing.T) {
+	events := []string{
+		`event: message_start` + "\n" + `data: {"type":"message_start","message":{"id":"msg_1","model":"claude","usage":{"input_tokens":12,"output_tokens":1}}}`,
+		`event: ping` + "\n" + `data: {"type":"ping"}`,
+		`data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hel"}}`,
+		`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"lo"}}`,
+		`data: {"type":"content_block_stop","index":0}`,
+		`data: {"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_1","name":"lookup","input":{}}}`,
+		`data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"q\":"}}`,
+		`data: {"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":9}}`,
+		`data: {"type":"message_stop"}`,
+	}
+	stream := newAnthropicStream(io.NopCloser(strings.NewReader(strings.Join(events, "\n\n")+"\n\n")), true)
+	out, err := io.ReadAll(stream)
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+
+	var chunks []openAIChunk
+	var done bool
+	for _, event := range strings.Split(strings.TrimSpace(string(out)), "\n\n") {
+		data := strings.TrimPrefix(event, "data: ")
+		if data == "[DONE]" {
+			done = true
+			continue
+		}
+		var chunk openAIChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("Invalid chunk %q: %v", data, err)
+		}
+		chunks = append(chunks, chunk)
+	}
+	if !done {
+		t.Error("Expected a final [DONE]")
+	}
+	// role, two text deltas, tool call start, arguments, finish reason, usage
+	if len(chunks) != 7 {
+		t.Fatalf("Expected 7 chunks, got %d: %s", len(chunks), out)
+	}
+	if chunks[0].Choices[0].Delta.Role != "assistant" || chunks[0].ID != "msg_1" {
+		t.Errorf("Unexpected first chunk %+v", chunks[0])
+	}
+	if *chunks[1].Choices[0].Delta.Content+*chunks[2].Choices[0].Delta.Content != "Hello" {
+		t.Errorf("Unexpected text deltas: %s", out)
+	}
+	call := chunks[3].Choices[0].Delta.ToolCalls[0]
+	if *call.Index != 0 || call.ID != "toolu_1" || call.Function.Name != "lookup" {
+		t.Errorf("Unexpected tool call start %+v", call)
+	}
+	if chunks[4].Choices[0].Delta.ToolCalls[0].Function.Arguments != `{"q":` {
+		t.Errorf("Unexpected tool call arguments: %s", out)
+	}
+	if *chunks[5].Choices[0].FinishReason != "tool_calls" {
+		t.Errorf("Unexpected finish reason: %s", out)
+	}
+	if len(chunks[6].Choices) != 0 || *chunks[6].Usage != (openAIUsage{PromptTokens: 12, CompletionTokens: 9, TotalTokens: 21}) {
+		t.Errorf("Unexpected usage chunk %+v", chunks[6])
+	}
+}
+
+func TestAnthropicStreamErrors(t *testing.T) {
+	truncated := `data: {"type":"message_start","message":{"id":"msg_1","model":"claude"}}` + "\n\n"
+	_, err := io.ReadAll(newAnthropicStream(io.NopCloser(strings.NewReader(truncated)), false))
+	if !errors.Is(err, errStreamTruncated) {
+		t.Errorf("Expected a truncated stream error, got %v", err)
+	}
+
+	failed := truncated + `data: {"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}` + "\n\n"
+	out, err := io.ReadAll(newAnthropicStream(io.NopCloser(strings.NewReader(failed)), false))
+	if err == nil || !strings.Contains(err.Error(), "Overloaded") {
+		t.Errorf("Expected the stream error, got %v", err)
+	}
+	if strings.Contains(string(out), "overloaded_error") {
+		t.Errorf("Expected the error to be left to the gateway, got %s", out)
+	}
+}
+
+func TestAnthropicRequestAndErrorResponse(t *testing.T) {
+	ch := &database.Channel{Type: database.ChannelTypeAnthropic, BaseURL: "https://api.anthropic.com"}
+	adapter := For(ch)
+
+	body := []byte(`{"model":"claude","messages":[{"role":"user","content":"hi"}]}`)
+	req, err := adapter.NewRequest(context.Background(), ch, channel.OperationChat, "claude", body, "sk-ant")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.URL.String() != "https://api.anthropic.com/v1/messages" {
+		t.Errorf("Unexpected URL %s", req.URL)
+	}
+	if req.Header.Get("X-Api-Key") != "sk-ant" || req.Header.Get("Anthropic-Version") != anthropicVersion || req.Header.Get("Authorization") != "" {
+		t.Errorf("Unexpected headers %v", req.Header)
+	}
+
+	if _, err := adapter.NewRequest(context.Background(), ch, channel.OperationEmbeddings, "claude", body, "sk-ant"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Expected ErrUnsupported for embeddings, got %v", err)
+	}
+
+	resp := &http.Response{
+		StatusCode: http.StatusTooManyRequests,
+		Header: http.Header{
+			"Anthropic-Ratelimit-Requests-Remaining": {"0"},
+			"Anthropic-Ratelimit-Requests-Reset":     {time.Now().Add(30 * time.Second).UTC().Format(time.RFC3339)},
+		},
+		Body: io.NopCloser(strings.NewReader(`{"type":"error","error":{"type":"rate_limit_error","message":"Slow down"}}`)),
+	}
+	if err := adapter.ConvertResponse(resp, channel.OperationChat, body); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(data), `"message":"Slow down"`) || !strings.HasPrefix(string(data), `{"error":`) {
+		t.Errorf("Unexpected error body %s", data)
+	}
+	if resp.Header.Get("X-Ratelimit-Remaining-Requests") != "0" || resp.Header.Get("X-Ratelimit-Reset-Requests") == "" {
+		t.Errorf("Expected OpenAI rate limit headers, got %v", resp.Header)
+	}
+}
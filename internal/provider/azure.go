@@ -0,0 +1,76 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/X0Ken/openai-gateway/internal/channel"
+	"github.com/X0Ken/openai-gateway/pkg/database"
+)
+
+// azureVersion is sent as the api-version query parameter unless the channel
+// pins an API version
+const azureVersion = "2024-10-21"
+
+// azurePaths holds the path of each operation relative to a deployment
+var azurePaths = map[channel.Operation]string{
+	channel.OperationChat:           "/chat/completions",
+	channel.OperationCompletions:    "/completions",
+	channel.OperationEmbeddings:     "/embeddings",
+	channel.OperationImages:         "/images/generations",
+	channel.OperationTranscriptions: "/audio/transcriptions",
+	channel.OperationTranslations:   "/audio/translations",
+	channel.OperationSpeech:         "/audio/speech",
+}
+
+// azure adapts requests to Azure OpenAI. Azure speaks the OpenAI API, so
+// bodies and responses pass through unchanged, but each model is served by a
+// deployment with its own URL and keys are sent in the api-key header.
+type azure struct {
+	openAI
+}
+
+// NewRequest posts the body to the operation's endpoint on the deployment
+// named by model
+func (azure) NewRequest(ctx context.Context, ch *database.Channel, op channel.Operation, model string, body []byte, apiKey string) (*http.Request, error) {
+	endpoint, err := azureURL(ch, op, model)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Api-Key", apiKey)
+	return req, nil
+}
+
+// azureURL builds the URL of an operation on a deployment, such as
+// https://res.openai.azure.com/openai/deployments/gpt-4o/chat/completions?api-version=2024-10-21.
+// A channel path template for the operation replaces the deployment path.
+func azureURL(ch *database.Channel, op channel.Operation, deployment string) (string, error) {
+	base := strings.TrimSuffix(strings.TrimRight(ch.BaseURL, "/"), "/openai")
+
+	var endpoint string
+	if tmpl, ok := ch.PathTemplates[string(op)]; ok && tmpl != "" {
+		endpoint = base + strings.ReplaceAll(tmpl, "{model}", url.PathEscape(deployment))
+	} else if path, ok := azurePaths[op]; ok {
+		endpoint = base + "/openai/deployments/" + url.PathEscape(deployment) + path
+	} else {
+		return "", unsupported(ch, op)
+	}
+
+	version := ch.APIVersion
+	if version == "" {
+		version = azureVersion
+	}
+	sep := "?"
+	if strings.Contains(endpoint, "?") {
+		sep = "&"
+	}
+	return endpoint + sep + "api-version=" + url.QueryEscape(version), nil
+}
@@ -0,0 +1,46 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/X0Ken/openai-gateway/internal/channel"
+	"github.com/X0Ken/openai-gateway/pkg/database"
+)
+
+func TestAzureRequest(t *testing.T) {
+	ch := &database.Channel{Type: database.ChannelTypeAzure, BaseURL: "https://res.openai.azure.com/", Organization: "org-1"}
+	adapter := For(ch)
+
+	req, err := adapter.NewRequest(context.Background(), ch, channel.OperationChat, "gpt-4o prod", []byte(`{}`), "azure-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "https://res.openai.azure.com/openai/deployments/gpt-4o%20prod/chat/completions?api-version=" + azureVersion; req.URL.String() != want {
+		t.Errorf("Expected %s, got %s", want, req.URL)
+	}
+	if req.Header.Get("Api-Key") != "azure-key" || req.Header.Get("Authorization") != "" || req.Header.Get("OpenAI-Organization") != "" {
+		t.Errorf("Unexpected headers %v", req.Header)
+	}
+
+	tests := []struct {
+		name string
+		ch   database.Channel
+		op   channel.Operation
+		want string
+	}{
+		{"embeddings with pinned version", database.Channel{BaseURL: "https://res.openai.azure.com/openai", APIVersion: "2024-06-01"}, channel.OperationEmbeddings, "https://res.openai.azure.com/openai/deployments/ada/embeddings?api-version=2024-06-01"},
+		{"path template", database.Channel{BaseURL: "https://proxy.example.com", PathTemplates: map[string]string{"chat": "/azure/{model}/chat?x=1"}}, channel.OperationChat, "https://proxy.example.com/azure/ada/chat?x=1&api-version=" + azureVersion},
+	}
+	for _, tt := range tests {
+		got, err := azureURL(&tt.ch, tt.op, "ada")
+		if err != nil || got != tt.want {
+			t.Errorf("%s: expected %s, got %s (%v)", tt.name, tt.want, got, err)
+		}
+	}
+
+	if _, err := adapter.NewRequest(context.Background(), ch, channel.OperationModels, "gpt-4o", nil, "azure-key"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Expected ErrUnsupported for models, got %v", err)
+	}
+}
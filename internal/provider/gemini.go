@@ -0,0 +1,502 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/internal/channel"
+	"github.com/X0Ken/openai-gateway/pkg/database"
+)
+
+// geminiVersion is the API version used unless the channel pins one or its
+// base URL ends in a version
+const geminiVersion = "v1beta"
+
+// gemini adapts chat completions to the Gemini API's generateContent and
+// streamGenerateContent methods
+type gemini struct{}
+
+// NewRequest translates a chat completion request into a generateContent
+// request, or a streamGenerateContent request for streams
+func (gemini) NewRequest(ctx context.Context, ch *database.Channel, op channel.Operation, model string, body []byte, apiKey string) (*http.Request, error) {
+	if op != channel.OperationChat {
+		return nil, unsupported(ch, op)
+	}
+
+	payload, stream, err := toGeminiRequest(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", geminiURL(ch, model, stream), bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Goog-Api-Key", apiKey)
+	return req, nil
+}
+
+// ConvertResponse translates a generateContent response, stream or error
+// into OpenAI format
+func (gemini) ConvertResponse(resp *http.Response, op channel.Operation, body []byte) error {
+	if resp.StatusCode != http.StatusOK {
+		return replaceBody(resp, convertGeminiError)
+	}
+
+	var req openAIRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return err
+	}
+	if req.Stream {
+		includeUsage := req.StreamOptions != nil && req.StreamOptions.IncludeUsage
+		resp.Body = newGeminiStream(resp.Body, req.Model, includeUsage)
+		resp.Header.Set("Content-Type", "text/event-stream")
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		return nil
+	}
+	return replaceBody(resp, func(data []byte) ([]byte, error) {
+		return convertGeminiResponse(data, req.Model)
+	})
+}
+
+// geminiURL builds the URL of the method generating content with model,
+// such as https://generativelanguage.googleapis.com/v1beta/models/gemini-2.5-flash:generateContent.
+// A chat path template replaces the model path.
+func geminiURL(ch *database.Channel, model string, stream bool) string {
+	model = url.PathEscape(strings.TrimPrefix(model, "models/"))
+	base := strings.TrimRight(ch.BaseURL, "/")
+
+	var endpoint string
+	if tmpl, ok := ch.PathTemplates[string(channel.OperationChat)]; ok && tmpl != "" {
+		endpoint = base + strings.ReplaceAll(tmpl, "{model}", model)
+	} else {
+		if !channel.HasVersionSuffix(base) {
+			version := ch.APIVersion
+			if version == "" {
+				version = geminiVersion
+			}
+			base += "/" + version
+		}
+		endpoint = base + "/models/" + model
+	}
+
+	if stream {
+		return endpoint + ":streamGenerateContent?alt=sse"
+	}
+	return endpoint + ":generateContent"
+}
+
+// geminiRequest is a generateContent request
+type geminiRequest struct {
+	Contents          []geminiContent         `json:"contents"`
+	SystemInstruction *geminiContent          `json:"systemInstruction,omitempty"`
+	GenerationConfig  *geminiGenerationConfig `json:"generationConfig,omitempty"`
+	Tools             []geminiTool            `json:"tools,omitempty"`
+	ToolConfig        *geminiToolConfig       `json:"toolConfig,omitempty"`
+}
+
+// geminiContent is a turn of a conversation or a response candidate
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+// geminiPart is one part of a turn
+type geminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	Thought          bool                    `json:"thought,omitempty"`
+	InlineData       *geminiBlob             `json:"inlineData,omitempty"`
+	FileData         *geminiFileData         `json:"fileData,omitempty"`
+	FunctionCall     *geminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *geminiFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+// geminiBlob is inline media, such as a base64 image
+type geminiBlob struct {
+	MIMEType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+// geminiFileData is media referenced by URI
+type geminiFileData struct {
+	FileURI string `json:"fileUri"`
+}
+
+// geminiFunctionCall is a function call made by the model
+type geminiFunctionCall struct {
+	ID   string          `json:"id,omitempty"`
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+// geminiFunctionResponse is the result of a function call
+type geminiFunctionResponse struct {
+	ID       string          `json:"id,omitempty"`
+	Name     string          `json:"name"`
+	Response json.RawMessage `json:"response"`
+}
+
+// geminiGenerationConfig holds the sampling and output options of a request
+type geminiGenerationConfig struct {
+	Temperature      *float64 `json:"temperature,omitempty"`
+	TopP             *float64 `json:"topP,omitempty"`
+	MaxOutputTokens  *int     `json:"maxOutputTokens,omitempty"`
+	StopSequences    []string `json:"stopSequences,omitempty"`
+	ResponseMIMEType string   `json:"responseMimeType,omitempty"`
+}
+
+// geminiTool declares the functions the model may call
+type geminiTool struct {
+	FunctionDeclarations []geminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+// geminiFunctionDeclaration is a function the model may call, described by
+// a JSON schema
+type geminiFunctionDeclaration struct {
+	Name                 string          `json:"name"`
+	Description          string          `json:"description,omitempty"`
+	ParametersJSONSchema json.RawMessage `json:"parametersJsonSchema,omitempty"`
+}
+
+// geminiToolConfig controls how the model uses tools
+type geminiToolConfig struct {
+	FunctionCallingConfig struct {
+		Mode                 string   `json:"mode"`
+		AllowedFunctionNames []string `json:"allowedFunctionNames,omitempty"`
+	} `json:"functionCallingConfig"`
+}
+
+// toGeminiRequest translates a chat completion request body into a
+// generateContent request body, reporting whether a stream was requested
+func toGeminiRequest(body []byte) ([]byte, bool, error) {
+	var req openAIRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, false, err
+	}
+	if req.N != nil && *req.N > 1 {
+		return nil, false, fmt.Errorf("%w: n greater than 1", ErrUnsupported)
+	}
+
+	config := geminiGenerationConfig{
+		Temperature:     req.Temperature,
+		TopP:            req.TopP,
+		MaxOutputTokens: req.MaxTokens,
+	}
+	if req.MaxCompletionTokens != nil {
+		config.MaxOutputTokens = req.MaxCompletionTokens
+	}
+	stop, err := stopSequences(req.Stop)
+	if err != nil {
+		return nil, false, err
+	}
+	config.StopSequences = stop
+	if req.ResponseFormat != nil && (req.ResponseFormat.Type == "json_object" || req.ResponseFormat.Type == "json_schema") {
+		config.ResponseMIMEType = "application/json"
+	}
+
+	out := geminiRequest{GenerationConfig: &config}
+	var system []geminiPart
+	// Tool results name their function, which OpenAI leaves to the call
+	calls := make(map[string]string)
+	for _, m := range req.Messages {
+		switch m.Role {
+		case "system", "developer":
+			text, err := textContent(m.Content)
+			if err != nil {
+				return nil, false, err
+			}
+			system = append(system, geminiPart{Text: text})
+		case "user":
+			parts, err := geminiParts(m.Content)
+			if err != nil {
+				return nil, false, err
+			}
+			out.Contents = appendContent(out.Contents, "user", parts)
+		case "assistant":
+			parts, err := geminiParts(m.Content)
+			if err != nil {
+				return nil, false, err
+			}
+			for _, call := range m.ToolCalls {
+				args := json.RawMessage(call.Function.Arguments)
+				if !json.Valid(args) {
+					args = json.RawMessage("{}")
+				}
+				calls[call.ID] = call.Function.Name
+				parts = append(parts, geminiPart{FunctionCall: &geminiFunctionCall{Name: call.Function.Name, Args: args}})
+			}
+			out.Contents = appendContent(out.Contents, "model", parts)
+		case "tool":
+			name, ok := calls[m.ToolCallID]
+			if !ok {
+				return nil, false, fmt.Errorf("%w: tool message for unknown tool call %q", ErrUnsupported, m.ToolCallID)
+			}
+			text, err := textContent(m.Content)
+			if err != nil {
+				return nil, false, err
+			}
+			out.Contents = appendContent(out.Contents, "user", []geminiPart{{FunctionResponse: &geminiFunctionResponse{Name: name, Response: functionResponse(text)}}})
+		default:
+			return nil, false, fmt.Errorf("%w: message role %q", ErrUnsupported, m.Role)
+		}
+	}
+	if len(system) > 0 {
+		out.SystemInstruction = &geminiContent{Parts: system}
+	}
+
+	var declarations []geminiFunctionDeclaration
+	for _, tool := range req.Tools {
+		if tool.Type != "function" {
+			return nil, false, fmt.Errorf("%w: tool type %q", ErrUnsupported, tool.Type)
+		}
+		declarations = append(declarations, geminiFunctionDeclaration{Name: tool.Function.Name, Description: tool.Function.Description, ParametersJSONSchema: tool.Function.Parameters})
+	}
+	if len(declarations) > 0 {
+		out.Tools = []geminiTool{{FunctionDeclarations: declarations}}
+	}
+	if out.ToolConfig, err = geminiToolChoice(req.ToolChoice); err != nil {
+		return nil, false, err
+	}
+
+	data, err := json.Marshal(out)
+	return data, req.Stream, err
+}
+
+// appendContent appends a turn, merging it into the previous one when both
+// have the same role, so the results of parallel calls share one turn
+func appendContent(contents []geminiContent, role string, parts []geminiPart) []geminiContent {
+	if len(parts) == 0 {
+		return contents
+	}
+	if n := len(contents); n > 0 && contents[n-1].Role == role {
+		contents[n-1].Parts = append(contents[n-1].Parts, parts...)
+		return contents
+	}
+	return append(contents, geminiContent{Role: role, Parts: parts})
+}
+
+// geminiParts converts message content into text and media parts. Empty
+// text is dropped.
+func geminiParts(content json.RawMessage) ([]geminiPart, error) {
+	contentParts, err := contentParts(content)
+	if err != nil {
+		return nil, err
+	}
+	var parts []geminiPart
+	for _, part := range contentParts {
+		switch part.Type {
+		case "text":
+			if part.Text != "" {
+				parts = append(parts, geminiPart{Text: part.Text})
+			}
+		case "image_url":
+			if part.ImageURL == nil || part.ImageURL.URL == "" {
+				return nil, fmt.Errorf("%w: image_url part without a url", ErrUnsupported)
+			}
+			parts = append(parts, imagePart(part.ImageURL.URL))
+		default:
+			return nil, fmt.Errorf("%w: %s content", ErrUnsupported, part.Type)
+		}
+	}
+	return parts, nil
+}
+
+// imagePart converts an image URL, which may be a base64 data URL, into a
+// media part
+func imagePart(imageURL string) geminiPart {
+	if rest, ok := strings.CutPrefix(imageURL, "data:"); ok {
+		if mimeType, data, ok := strings.Cut(rest, ";base64,"); ok {
+			return geminiPart{InlineData: &geminiBlob{MIMEType: mimeType, Data: data}}
+		}
+	}
+	return geminiPart{FileData: &geminiFileData{FileURI: imageURL}}
+}
+
+// functionResponse wraps a tool result in the object Gemini expects. A
+// result that is already a JSON object is sent as is.
+func functionResponse(text string) json.RawMessage {
+	if trimmed := strings.TrimSpace(text); strings.HasPrefix(trimmed, "{") && json.Valid([]byte(trimmed)) {
+		return json.RawMessage(trimmed)
+	}
+	data, _ := json.Marshal(map[string]string{"content": text})
+	return data
+}
+
+// geminiToolChoice converts an OpenAI tool_choice into a function calling
+// config
+func geminiToolChoice(choice json.RawMessage) (*geminiToolConfig, error) {
+	usage, err := toolChoice(choice)
+	if err != nil || usage == nil {
+		return nil, err
+	}
+	config := &geminiToolConfig{}
+	switch usage.Type {
+	case "auto":
+		config.FunctionCallingConfig.Mode = "AUTO"
+	case "none":
+		config.FunctionCallingConfig.Mode = "NONE"
+	case "any":
+		config.FunctionCallingConfig.Mode = "ANY"
+	case "tool":
+		config.FunctionCallingConfig.Mode = "ANY"
+		config.FunctionCallingConfig.AllowedFunctionNames = []string{usage.Name}
+	}
+	return config, nil
+}
+
+// geminiUsage is the token usage of a response
+type geminiUsage struct {
+	PromptTokenCount     int `json:"promptTokenCount"`
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
+	ThoughtsTokenCount   int `json:"thoughtsTokenCount"`
+}
+
+// openAIUsage converts the usage, counting thinking tokens as completion
+// tokens as OpenAI does for reasoning
+func (u geminiUsage) openAIUsage() openAIUsage {
+	completion := u.CandidatesTokenCount + u.ThoughtsTokenCount
+	return openAIUsage{PromptTokens: u.PromptTokenCount, CompletionTokens: completion, TotalTokens: u.PromptTokenCount + completion}
+}
+
+// geminiResponse is a generateContent response, or one event of a stream
+type geminiResponse struct {
+	Candidates []struct {
+		Content      geminiContent `json:"content"`
+		FinishReason string        `json:"finishReason"`
+	} `json:"candidates"`
+	PromptFeedback *struct {
+		BlockReason string `json:"blockReason"`
+	} `json:"promptFeedback"`
+	UsageMetadata *geminiUsage `json:"usageMetadata"`
+	ModelVersion  string       `json:"modelVersion"`
+	ResponseID    string       `json:"responseId"`
+	Error         *geminiError `json:"error"`
+}
+
+// blocked reports whether the prompt was blocked, leaving no candidates
+func (r *geminiResponse) blocked() bool {
+	return len(r.Candidates) == 0 && r.PromptFeedback != nil && r.PromptFeedback.BlockReason != ""
+}
+
+// geminiFinishReason maps a Gemini finish reason to an OpenAI finish reason
+func geminiFinishReason(reason string) string {
+	switch reason {
+	case "MAX_TOKENS":
+		return "length"
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII", "IMAGE_SAFETY":
+		return "content_filter"
+	}
+	return "stop"
+}
+
+// newGeminiID returns a new ID for a response or function call, since
+// Gemini does not always assign one
+func newGeminiID(prefix string) string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return prefix + hex.EncodeToString(b)
+}
+
+// toolCall converts a function call part into a tool call
+func (c *geminiFunctionCall) toolCall() openAIResponseToolCall {
+	id := c.ID
+	if id == "" {
+		id = newGeminiID("call_")
+	}
+	var arguments bytes.Buffer
+	if err := json.Compact(&arguments, c.Args); err != nil {
+		arguments.WriteString("{}")
+	}
+	return openAIResponseToolCall{ID: id, Type: "function", Function: openAIFunctionCall{Name: c.Name, Arguments: arguments.String()}}
+}
+
+// convertGeminiResponse converts a generateContent response body into a
+// chat completion response body for model
+func convertGeminiResponse(data []byte, model string) ([]byte, error) {
+	var resp geminiResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("invalid Gemini response: %w", err)
+	}
+
+	message := openAIResponseMessage{Role: "assistant"}
+	reason := "content_filter"
+	var texts []string
+	if len(resp.Candidates) > 0 {
+		candidate := resp.Candidates[0]
+		for _, part := range candidate.Content.Parts {
+			switch {
+			case part.Thought:
+			case part.FunctionCall != nil:
+				message.ToolCalls = append(message.ToolCalls, part.FunctionCall.toolCall())
+			case part.Text != "":
+				texts = append(texts, part.Text)
+			}
+		}
+		reason = geminiFinishReason(candidate.FinishReason)
+		if len(message.ToolCalls) > 0 {
+			reason = "tool_calls"
+		}
+	}
+	if len(texts) > 0 || len(message.ToolCalls) == 0 {
+		content := strings.Join(texts, "")
+		message.Content = &content
+	}
+
+	var usage openAIUsage
+	if resp.UsageMetadata != nil {
+		usage = resp.UsageMetadata.openAIUsage()
+	}
+	if resp.ModelVersion != "" {
+		model = resp.ModelVersion
+	}
+	id := resp.ResponseID
+	if id == "" {
+		id = newGeminiID("chatcmpl-")
+	}
+
+	return json.Marshal(openAIResponse{
+		ID:      id,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   model,
+		Choices: []openAIChoice{{Message: message, FinishReason: reason}},
+		Usage:   usage,
+	})
+}
+
+// geminiError is a Gemini API error
+type geminiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Status  string `json:"status"`
+}
+
+// convertGeminiError converts an error response body into OpenAI format,
+// leaving bodies that are not Gemini errors unchanged. Streaming methods
+// wrap the error in an array.
+func convertGeminiError(data []byte) ([]byte, error) {
+	var e geminiResponse
+	if err := json.Unmarshal(data, &e); err != nil {
+		var wrapped []geminiResponse
+		if json.Unmarshal(data, &wrapped) != nil || len(wrapped) == 0 {
+			return data, nil
+		}
+		e = wrapped[0]
+	}
+	if e.Error == nil || e.Error.Message == "" {
+		return data, nil
+	}
+	return json.Marshal(map[string]any{
+		"error": map[string]any{"message": e.Error.Message, "type": strings.ToLower(e.Error.Status), "param": nil, "code": nil},
+	})
+}
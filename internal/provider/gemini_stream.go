@@ -0,0 +1,145 @@
+package provider
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// errGeminiTruncated is returned when a Gemini stream ends before a finish
+// reason
+var errGeminiTruncated = errors.New("backend stream ended before a finish reason")
+
+// geminiStream converts a streamGenerateContent event stream into chat
+// completion chunks as it is read. Each event is a partial response whose
+// parts are new content, so events convert one at a time.
+type geminiStream struct {
+	chunkWriter
+	body   io.ReadCloser
+	reader *bufio.Reader
+	err    error
+
+	includeUsage bool
+	started      bool
+	finished     bool
+	usage        geminiUsage
+	toolCalls    int
+}
+
+// newGeminiStream returns a reader converting a Gemini event stream for
+// model. With includeUsage the usage is sent in a final chunk.
+func newGeminiStream(body io.ReadCloser, model string, includeUsage bool) *geminiStream {
+	return &geminiStream{
+		chunkWriter:  chunkWriter{model: model, created: time.Now().Unix()},
+		body:         body,
+		reader:       bufio.NewReader(body),
+		includeUsage: includeUsage,
+	}
+}
+
+// Read returns converted chunks, reading events from the backend as needed
+func (s *geminiStream) Read(p []byte) (int, error) {
+	for s.out.Len() == 0 && s.err == nil {
+		s.err = s.next()
+	}
+	if s.out.Len() > 0 {
+		return s.out.Read(p)
+	}
+	return 0, s.err
+}
+
+// Close closes the backend stream
+func (s *geminiStream) Close() error {
+	return s.body.Close()
+}
+
+// next reads and converts one event. It returns io.EOF once the backend
+// stream ends after a finish reason.
+func (s *geminiStream) next() error {
+	data, err := readEvent(s.reader)
+	if err == io.EOF {
+		if !s.finished {
+			return errGeminiTruncated
+		}
+		if s.includeUsage {
+			usage := s.usage.openAIUsage()
+			s.writeChunk(openAIDelta{}, nil, &usage)
+		}
+		s.out.WriteString("data: [DONE]\n\n")
+		return io.EOF
+	}
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		return nil
+	}
+
+	var event geminiResponse
+	if err := json.Unmarshal(data, &event); err != nil {
+		return fmt.Errorf("invalid Gemini stream event: %w", err)
+	}
+	if event.Error != nil {
+		return fmt.Errorf("backend stream error: %s", event.Error.Message)
+	}
+
+	if !s.started {
+		s.started = true
+		s.id = event.ResponseID
+		if s.id == "" {
+			s.id = newGeminiID("chatcmpl-")
+		}
+		if event.ModelVersion != "" {
+			s.model = event.ModelVersion
+		}
+		empty := ""
+		s.writeChunk(openAIDelta{Role: "assistant", Content: &empty}, nil, nil)
+	}
+	if event.UsageMetadata != nil {
+		s.usage = *event.UsageMetadata
+	}
+
+	if event.blocked() {
+		s.finish("content_filter")
+		return nil
+	}
+	if len(event.Candidates) == 0 {
+		return nil
+	}
+	candidate := event.Candidates[0]
+	for _, part := range candidate.Content.Parts {
+		switch {
+		case part.Thought:
+		case part.FunctionCall != nil:
+			// Gemini sends each call whole, with its arguments
+			call := part.FunctionCall.toolCall()
+			index := s.toolCalls
+			call.Index = &index
+			s.toolCalls++
+			s.writeChunk(openAIDelta{ToolCalls: []openAIResponseToolCall{call}}, nil, nil)
+		case part.Text != "":
+			text := part.Text
+			s.writeChunk(openAIDelta{Content: &text}, nil, nil)
+		}
+	}
+	if candidate.FinishReason != "" {
+		reason := geminiFinishReason(candidate.FinishReason)
+		if s.toolCalls > 0 {
+			reason = "tool_calls"
+		}
+		s.finish(reason)
+	}
+	return nil
+}
+
+// finish writes the chunk carrying the finish reason, once
+func (s *geminiStream) finish(reason string) {
+	if s.finished {
+		return
+	}
+	s.finished = true
+	s.writeChunk(openAIDelta{}, &reason, nil)
+}
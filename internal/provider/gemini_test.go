@@ -0,0 +1,211 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/X0Ken/openai-gateway/internal/channel"
+	"github.com/X0Ken/openai-gateway/pkg/database"
+)
+
+func TestToGeminiRequest(t *testing.T) {
+	body := `{
+		"model": "gemini-2.5-flash",
+		"messages": [
+			{"role": "system", "content": "Be brief."},
+			{"role": "user", "content": [{"type": "text", "text": "What is in this image?"}, {"type": "image_url", "image_url": {"url": "data:image/png;base64,AAAA"}}]},
+			{"role": "assistant", "content": null, "tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "lookup", "arguments": "{\"q\":\"cat\"}"}}]},
+			{"role": "tool", "tool_call_id": "call_1", "content": "a cat"},
+			{"role": "user", "content": "Thanks"}
+		],
+		"max_tokens": 100,
+		"temperature": 1.5,
+		"stop": ["END"],
+		"response_format": {"type": "json_object"},
+		"tools": [{"type": "function", "function": {"name": "lookup", "parameters": {"type": "object"}}}],
+		"tool_choice": {"type": "function", "function": {"name": "lookup"}},
+		"stream": true
+	}`
+
+	data, stream, err := toGeminiRequest([]byte(body))
+	if err != nil {
+		t.Fatalf("toGeminiRequest failed: %v", err)
+	}
+	if !stream {
+		t.Error("Expected a stream to be requested")
+	}
+	var got geminiRequest
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	config := got.GenerationConfig
+	if *config.MaxOutputTokens != 100 || *config.Temperature != 1.5 || len(config.StopSequences) != 1 || config.ResponseMIMEType != "application/json" {
+		t.Errorf("Unexpected generation config: %s", data)
+	}
+	if got.SystemInstruction == nil || got.SystemInstruction.Parts[0].Text != "Be brief." {
+		t.Errorf("Unexpected system instruction: %s", data)
+	}
+	if len(got.Tools) != 1 || string(got.Tools[0].FunctionDeclarations[0].ParametersJSONSchema) != `{"type":"object"}` {
+		t.Errorf("Unexpected tools: %s", data)
+	}
+	if got.ToolConfig == nil || got.ToolConfig.FunctionCallingConfig.Mode != "ANY" || got.ToolConfig.FunctionCallingConfig.AllowedFunctionNames[0] != "lookup" {
+		t.Errorf("Unexpected tool config: %s", data)
+	}
+
+	// The function response and the following user text merge into one turn
+	if len(got.Contents) != 3 {
+		t.Fatalf("Expected 3 turns, got %s", data)
+	}
+	user, model, result := got.Contents[0], got.Contents[1], got.Contents[2]
+	if len(user.Parts) != 2 || user.Parts[1].InlineData == nil || user.Parts[1].InlineData.MIMEType != "image/png" {
+		t.Errorf("Unexpected user turn: %+v", user)
+	}
+	if model.Role != "model" || model.Parts[0].FunctionCall == nil || string(model.Parts[0].FunctionCall.Args) != `{"q":"cat"}` {
+		t.Errorf("Unexpected model turn: %+v", model)
+	}
+	response := result.Parts[0].FunctionResponse
+	if result.Role != "user" || response == nil || response.Name != "lookup" || string(response.Response) != `{"content":"a cat"}` || result.Parts[1].Text != "Thanks" {
+		t.Errorf("Unexpected function response turn: %+v", result)
+	}
+
+	_, _, err = toGeminiRequest([]byte(`{"messages":[{"role":"tool","tool_call_id":"call_9","content":"x"}]}`))
+	if !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Expected ErrUnsupported for an unknown tool call, got %v", err)
+	}
+}
+
+func TestConvertGeminiResponse(t *testing.T) {
+	data, err := convertGeminiResponse([]byte(`{
+		"candidates": [{"content": {"role": "model", "parts": [{"text": "thinking", "thought": true}, {"text": "Let me check."}, {"functionCall": {"name": "lookup", "args": {"q": "cat"}}}]}, "finishReason": "STOP"}],
+		"usageMetadata": {"promptTokenCount": 10, "candidatesTokenCount": 7, "thoughtsTokenCount": 3, "totalTokenCount": 20},
+		"modelVersion": "gemini-2.5-flash-001",
+		"responseId": "resp_1"
+	}`), "gemini-2.5-flash")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got openAIResponse
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != "resp_1" || got.Model != "gemini-2.5-flash-001" || len(got.Choices) != 1 {
+		t.Fatalf("Unexpected response: %s", data)
+	}
+	choice := got.Choices[0]
+	if choice.FinishReason != "tool_calls" || *choice.Message.Content != "Let me check." {
+		t.Errorf("Unexpected choice: %s", data)
+	}
+	if len(choice.Message.ToolCalls) != 1 || choice.Message.ToolCalls[0].Function.Arguments != `{"q":"cat"}` || !strings.HasPrefix(choice.Message.ToolCalls[0].ID, "call_") {
+		t.Errorf("Unexpected tool calls: %s", data)
+	}
+	if got.Usage != (openAIUsage{PromptTokens: 10, CompletionTokens: 10, TotalTokens: 20}) {
+		t.Errorf("Unexpected usage %+v", got.Usage)
+	}
+
+	// A blocked prompt has no candidates
+	data, _ = convertGeminiResponse([]byte(`{"promptFeedback":{"blockReason":"SAFETY"}}`), "gemini")
+	if !strings.Contains(string(data), `"finish_reason":"content_filter"`) {
+		t.Errorf("Expected a content_filter finish, got %s", data)
+	}
+}
+
+func TestGeminiStream(t *testing.T) {
+	events := []string{
+		`data: {"candidates":[{"content":{"role":"model","parts":[{"text":"Hel"}]}}],"modelVersion":"gemini-2.5-flash","responseId":"resp_1"}`,
+		`data: {"candidates":[{"content":{"role":"model","parts":[{"text":"lo"}]}}]}`,
+		`data: {"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"lookup","args":{"q":"cat"}}}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":12,"candidatesTokenCount":9}}`,
+	}
+	stream := newGeminiStream(io.NopCloser(strings.NewReader(strings.Join(events, "\r\n\r\n")+"\r\n\r\n")), "gemini", true)
+	out, err := io.ReadAll(stream)
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+
+	var chunks []openAIChunk
+	var done bool
+	for _, event := range strings.Split(strings.TrimSpace(string(out)), "\n\n") {
+		data := strings.TrimPrefix(event, "data: ")
+		if data == "[DONE]" {
+			done = true
+			continue
+		}
+		var chunk openAIChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("Invalid chunk %q: %v", data, err)
+		}
+		chunks = append(chunks, chunk)
+	}
+	if !done {
+		t.Error("Expected a final [DONE]")
+	}
+	// role, two text deltas, tool call, finish reason, usage
+	if len(chunks) != 6 {
+		t.Fatalf("Expected 6 chunks, got %d: %s", len(chunks), out)
+	}
+	if chunks[0].Choices[0].Delta.Role != "assistant" || chunks[0].ID != "resp_1" || chunks[0].Model != "gemini-2.5-flash" {
+		t.Errorf("Unexpected first chunk %+v", chunks[0])
+	}
+	if *chunks[1].Choices[0].Delta.Content+*chunks[2].Choices[0].Delta.Content != "Hello" {
+		t.Errorf("Unexpected text deltas: %s", out)
+	}
+	call := chunks[3].Choices[0].Delta.ToolCalls[0]
+	if *call.Index != 0 || call.Function.Name != "lookup" || call.Function.Arguments != `{"q":"cat"}` {
+		t.Errorf("Unexpected tool call %+v", call)
+	}
+	if *chunks[4].Choices[0].FinishReason != "tool_calls" {
+		t.Errorf("Unexpected finish reason: %s", out)
+	}
+	if *chunks[5].Usage != (openAIUsage{PromptTokens: 12, CompletionTokens: 9, TotalTokens: 21}) {
+		t.Errorf("Unexpected usage chunk %+v", chunks[5])
+	}
+
+	_, err = io.ReadAll(newGeminiStream(io.NopCloser(strings.NewReader(events[0]+"\n\n")), "gemini", false))
+	if !errors.Is(err, errGeminiTruncated) {
+		t.Errorf("Expected a truncated stream error, got %v", err)
+	}
+}
+
+func TestGeminiRequestAndErrorResponse(t *testing.T) {
+	ch := &database.Channel{Type: database.ChannelTypeGemini, BaseURL: "https://generativelanguage.googleapis.com"}
+	adapter := For(ch)
+
+	req, err := adapter.NewRequest(context.Background(), ch, channel.OperationChat, "models/gemini-2.5-flash", []byte(`{"messages":[{"role":"user","content":"hi"}],"stream":true}`), "goog-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.URL.String() != "https://generativelanguage.googleapis.com/v1beta/models/gemini-2.5-flash:streamGenerateContent?alt=sse" {
+		t.Errorf("Unexpected URL %s", req.URL)
+	}
+	if req.Header.Get("X-Goog-Api-Key") != "goog-key" || req.Header.Get("Authorization") != "" {
+		t.Errorf("Unexpected headers %v", req.Header)
+	}
+
+	pinned := &database.Channel{BaseURL: "https://example.com/v1", APIVersion: "v1beta"}
+	if got := geminiURL(pinned, "gemini", false); got != "https://example.com/v1/models/gemini:generateContent" {
+		t.Errorf("Expected the base URL's version to be kept, got %s", got)
+	}
+
+	if _, err := adapter.NewRequest(context.Background(), ch, channel.OperationEmbeddings, "gemini", nil, "goog-key"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Expected ErrUnsupported for embeddings, got %v", err)
+	}
+
+	resp := &http.Response{
+		StatusCode: http.StatusTooManyRequests,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader(`[{"error":{"code":429,"message":"Quota exceeded","status":"RESOURCE_EXHAUSTED"}}]`)),
+	}
+	if err := adapter.ConvertResponse(resp, channel.OperationChat, nil); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(data), `"message":"Quota exceeded"`) || !strings.Contains(string(data), `"type":"resource_exhausted"`) {
+		t.Errorf("Unexpected error body %s", data)
+	}
+}
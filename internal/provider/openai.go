@@ -0,0 +1,186 @@
+package provider
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// openAIRequest holds the chat completion request fields adapters translate
+// to other APIs
+type openAIRequest struct {
+	Model               string          `json:"model"`
+	Messages            []openAIMessage `json:"messages"`
+	MaxTokens           *int            `json:"max_tokens"`
+	MaxCompletionTokens *int            `json:"max_completion_tokens"`
+	Temperature         *float64        `json:"temperature"`
+	TopP                *float64        `json:"top_p"`
+	Stop                json.RawMessage `json:"stop"`
+	Stream              bool            `json:"stream"`
+	StreamOptions       *struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options"`
+	User           string          `json:"user"`
+	Tools          []openAITool    `json:"tools"`
+	ToolChoice     json.RawMessage `json:"tool_choice"`
+	N              *int            `json:"n"`
+	ResponseFormat *struct {
+		Type string `json:"type"`
+	} `json:"response_format"`
+}
+
+// openAIMessage is a chat message, whose content is a string, null or an
+// array of content parts
+type openAIMessage struct {
+	Role       string           `json:"role"`
+	Content    json.RawMessage  `json:"content"`
+	ToolCalls  []openAIToolCall `json:"tool_calls"`
+	ToolCallID string           `json:"tool_call_id"`
+}
+
+// openAIContentPart is one part of a message's content
+type openAIContentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	ImageURL *struct {
+		URL string `json:"url"`
+	} `json:"image_url"`
+}
+
+// openAIToolCall is a function call made by the assistant
+type openAIToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// openAITool is a function the model may call
+type openAITool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string          `json:"name"`
+		Description string          `json:"description,omitempty"`
+		Parameters  json.RawMessage `json:"parameters,omitempty"`
+	} `json:"function"`
+}
+
+// contentParts decodes message content given as a string, null or an array
+// of parts
+func contentParts(content json.RawMessage) ([]openAIContentPart, error) {
+	if len(content) == 0 || string(content) == "null" {
+		return nil, nil
+	}
+	var text string
+	if err := json.Unmarshal(content, &text); err == nil {
+		return []openAIContentPart{{Type: "text", Text: text}}, nil
+	}
+	var parts []openAIContentPart
+	if err := json.Unmarshal(content, &parts); err != nil {
+		return nil, fmt.Errorf("%w: message content must be a string or an array of parts", ErrUnsupported)
+	}
+	return parts, nil
+}
+
+// textContent returns the text of message content, joining text parts
+func textContent(content json.RawMessage) (string, error) {
+	parts, err := contentParts(content)
+	if err != nil {
+		return "", err
+	}
+	var texts []string
+	for _, part := range parts {
+		if part.Type != "text" {
+			return "", fmt.Errorf("%w: %s content in this message", ErrUnsupported, part.Type)
+		}
+		texts = append(texts, part.Text)
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+// stopSequences decodes a stop parameter given as a string or an array
+func stopSequences(stop json.RawMessage) ([]string, error) {
+	if len(stop) == 0 || string(stop) == "null" {
+		return nil, nil
+	}
+	var one string
+	if err := json.Unmarshal(stop, &one); err == nil {
+		return []string{one}, nil
+	}
+	var many []string
+	if err := json.Unmarshal(stop, &many); err != nil {
+		return nil, fmt.Errorf("%w: stop must be a string or an array of strings", ErrUnsupported)
+	}
+	return many, nil
+}
+
+// openAIUsage is the token usage of a chat completion
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// openAIFunctionCall is the function of a tool call in a response
+type openAIFunctionCall struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"`
+}
+
+// openAIResponseToolCall is a tool call in a response or stream delta
+type openAIResponseToolCall struct {
+	Index    *int               `json:"index,omitempty"`
+	ID       string             `json:"id,omitempty"`
+	Type     string             `json:"type,omitempty"`
+	Function openAIFunctionCall `json:"function"`
+}
+
+// openAIResponseMessage is the message of a chat completion choice
+type openAIResponseMessage struct {
+	Role      string                   `json:"role"`
+	Content   *string                  `json:"content"`
+	ToolCalls []openAIResponseToolCall `json:"tool_calls,omitempty"`
+}
+
+// openAIChoice is a chat completion choice
+type openAIChoice struct {
+	Index        int                   `json:"index"`
+	Message      openAIResponseMessage `json:"message"`
+	FinishReason string                `json:"finish_reason"`
+}
+
+// openAIResponse is a chat completion response
+type openAIResponse struct {
+	ID      string         `json:"id"`
+	Object  string         `json:"object"`
+	Created int64          `json:"created"`
+	Model   string         `json:"model"`
+	Choices []openAIChoice `json:"choices"`
+	Usage   openAIUsage    `json:"usage"`
+}
+
+// openAIDelta is the delta of a streamed chat completion choice
+type openAIDelta struct {
+	Role      string                   `json:"role,omitempty"`
+	Content   *string                  `json:"content,omitempty"`
+	ToolCalls []openAIResponseToolCall `json:"tool_calls,omitempty"`
+}
+
+// openAIChunkChoice is a choice of a streamed chat completion chunk
+type openAIChunkChoice struct {
+	Index        int         `json:"index"`
+	Delta        openAIDelta `json:"delta"`
+	FinishReason *string     `json:"finish_reason"`
+}
+
+// openAIChunk is a streamed chat completion chunk
+type openAIChunk struct {
+	ID      string              `json:"id"`
+	Object  string              `json:"object"`
+	Created int64               `json:"created"`
+	Model   string              `json:"model"`
+	Choices []openAIChunkChoice `json:"choices"`
+	Usage   *openAIUsage        `json:"usage,omitempty"`
+}
@@ -0,0 +1,71 @@
+// Package provider adapts the OpenAI API the gateway serves to the native
+// API of each channel type, so clients using an OpenAI SDK can reach
+// backends such as Anthropic's Messages API or Gemini unchanged.
+package provider
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/X0Ken/openai-gateway/internal/channel"
+	"github.com/X0Ken/openai-gateway/pkg/database"
+)
+
+// ErrUnsupported is returned when a channel type cannot serve an operation
+var ErrUnsupported = errors.New("operation not supported")
+
+// Adapter translates OpenAI requests into a backend's API and its responses
+// back into OpenAI format
+type Adapter interface {
+	// NewRequest builds the upstream request for an operation from an
+	// OpenAI request body, authenticating with apiKey
+	NewRequest(ctx context.Context, ch *database.Channel, op channel.Operation, model string, body []byte, apiKey string) (*http.Request, error)
+	// ConvertResponse rewrites the backend's response to the request built
+	// from body into OpenAI format. Error responses are converted too, and
+	// streamed bodies are converted as they are read.
+	ConvertResponse(resp *http.Response, op channel.Operation, body []byte) error
+}
+
+// adapters holds the adapter of each channel type
+var adapters = map[string]Adapter{
+	database.ChannelTypeOpenAI:    openAI{},
+	database.ChannelTypeAnthropic: anthropic{},
+	database.ChannelTypeAzure:     azure{},
+	database.ChannelTypeGemini:    gemini{},
+}
+
+// For returns the adapter of a channel's type. Channels without a type, or
+// with an unknown one, speak the OpenAI API.
+func For(ch *database.Channel) Adapter {
+	if adapter, ok := adapters[ch.Type]; ok {
+		return adapter
+	}
+	return openAI{}
+}
+
+// unsupported returns the error for an operation a channel type cannot serve
+func unsupported(ch *database.Channel, op channel.Operation) error {
+	return fmt.Errorf("%w: %s channels do not support %s", ErrUnsupported, ch.Type, op)
+}
+
+// openAI passes requests and responses through unchanged
+type openAI struct{}
+
+// NewRequest posts the body to the operation's OpenAI endpoint
+func (openAI) NewRequest(ctx context.Context, ch *database.Channel, op channel.Operation, model string, body []byte, apiKey string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", channel.EndpointURL(ch, op, model), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	channel.SetUpstreamHeaders(req, ch, apiKey)
+	return req, nil
+}
+
+// ConvertResponse leaves the response unchanged
+func (openAI) ConvertResponse(resp *http.Response, op channel.Operation, body []byte) error {
+	return nil
+}
@@ -0,0 +1,67 @@
+package provider
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// chunkWriter buffers the chat completion chunks converted from a backend
+// stream until they are read
+type chunkWriter struct {
+	out     bytes.Buffer
+	id      string
+	model   string
+	created int64
+}
+
+// readEvent reads the data of the next SSE event. Events without data,
+// such as comments, yield nil.
+func readEvent(reader *bufio.Reader) ([]byte, error) {
+	var data []byte
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && (err != io.EOF || len(line) == 0) {
+			return nil, err
+		}
+		line = bytes.TrimRight(line, "\r\n")
+		if len(line) == 0 {
+			return data, nil
+		}
+		if value, ok := bytes.CutPrefix(line, []byte("data:")); ok {
+			if data != nil {
+				data = append(data, '\n')
+			}
+			data = append(data, bytes.TrimPrefix(value, []byte(" "))...)
+		}
+		if err == io.EOF {
+			return data, nil
+		}
+	}
+}
+
+// writeChunk writes a chunk with a delta, finish reason or usage. A usage
+// chunk has no choices.
+func (w *chunkWriter) writeChunk(delta openAIDelta, finishReason *string, usage *openAIUsage) {
+	chunk := openAIChunk{
+		ID:      w.id,
+		Object:  "chat.completion.chunk",
+		Created: w.created,
+		Model:   w.model,
+		Choices: []openAIChunkChoice{},
+		Usage:   usage,
+	}
+	if usage == nil {
+		chunk.Choices = append(chunk.Choices, openAIChunkChoice{Delta: delta, FinishReason: finishReason})
+	}
+	data, _ := json.Marshal(chunk)
+	w.writeData(data)
+}
+
+// writeData writes an SSE event carrying data
+func (w *chunkWriter) writeData(data []byte) {
+	w.out.WriteString("data: ")
+	w.out.Write(data)
+	w.out.WriteString("\n\n")
+}
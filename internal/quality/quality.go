@@ -0,0 +1,87 @@
+// Package quality computes lightweight quality signals of a completion, such
+// as an empty answer or a refusal, so backends that return degraded content
+// with a 200 status can be told apart from healthy ones.
+package quality
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Signals a response can raise
+const (
+	// SignalEmpty marks a response without content or tool calls
+	SignalEmpty = "empty"
+	// SignalRefusal marks a response that declines to answer
+	SignalRefusal = "refusal"
+	// SignalTruncatedJSON marks a response that should be JSON but does not parse
+	SignalTruncatedJSON = "truncated_json"
+)
+
+// Signals lists every signal, in reporting order
+var Signals = []string{SignalEmpty, SignalRefusal, SignalTruncatedJSON}
+
+// refusalPrefixes are phrases a refusal typically opens with. Only the start
+// of the content is checked, so answers quoting them are not flagged.
+var refusalPrefixes = []string{
+	"i'm sorry, but i can't",
+	"i'm sorry, but i cannot",
+	"i am sorry, but i cannot",
+	"i'm sorry, i can't",
+	"i can't help with",
+	"i cannot help with",
+	"i can't assist with",
+	"i cannot assist with",
+	"i'm unable to",
+	"i am unable to",
+	"as an ai language model",
+}
+
+// Response is the part of a completion the signals are computed from
+type Response struct {
+	Content string
+	// ToolCalls reports whether the response called tools, in which case
+	// it may legitimately have no content
+	ToolCalls bool
+	// Refusal reports whether the backend flagged a refusal explicitly
+	Refusal bool
+	// JSON reports whether the request asked for a JSON response
+	JSON bool
+	// Partial reports that Content holds only the start of a long response,
+	// so it cannot be checked for completeness
+	Partial bool
+}
+
+// Evaluate returns the signals a response raises
+func Evaluate(r Response) []string {
+	var signals []string
+	content := strings.TrimSpace(r.Content)
+
+	if content == "" && !r.ToolCalls {
+		signals = append(signals, SignalEmpty)
+	}
+	if r.Refusal || isRefusal(content) {
+		signals = append(signals, SignalRefusal)
+	}
+	if content != "" && !r.Partial && (r.JSON || looksLikeJSON(content)) && !json.Valid([]byte(content)) {
+		signals = append(signals, SignalTruncatedJSON)
+	}
+	return signals
+}
+
+// isRefusal reports whether content opens with a refusal phrase
+func isRefusal(content string) bool {
+	start := strings.ToLower(content[:min(len(content), 100)])
+	start = strings.ReplaceAll(start, "’", "'")
+	for _, prefix := range refusalPrefixes {
+		if strings.HasPrefix(start, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// looksLikeJSON reports whether content appears to be a JSON object or array
+func looksLikeJSON(content string) bool {
+	return strings.HasPrefix(content, "{") || strings.HasPrefix(content, "[")
+}
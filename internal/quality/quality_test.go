@@ -0,0 +1,38 @@
+package quality
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name string
+		r    Response
+		want []string
+	}{
+		{name: "healthy", r: Response{Content: "Paris is the capital of France."}},
+		{name: "empty", r: Response{Content: "  \n"}, want: []string{SignalEmpty}},
+		{name: "tool calls without content", r: Response{ToolCalls: true}},
+		{name: "refusal phrase", r: Response{Content: "I’m sorry, but I can’t help with that."}, want: []string{SignalRefusal}},
+		{name: "quoted refusal", r: Response{Content: `The model said "I cannot help with that".`}},
+		{name: "flagged refusal", r: Response{Refusal: true}, want: []string{SignalEmpty, SignalRefusal}},
+		{name: "valid JSON", r: Response{Content: `{"a": [1, 2]}`, JSON: true}},
+		{name: "truncated JSON", r: Response{Content: `{"a": [1, 2`}, want: []string{SignalTruncatedJSON}},
+		{name: "JSON mode prose", r: Response{Content: "Sure! Here it is", JSON: true}, want: []string{SignalTruncatedJSON}},
+		{name: "partial JSON", r: Response{Content: `{"a": [1, 2`, JSON: true, Partial: true}},
+	}
+	for _, tt := range tests {
+		if got := Evaluate(tt.r); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Evaluate = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRefusalOnlyMatchesStart(t *testing.T) {
+	content := strings.Repeat("word ", 50) + "As an AI language model"
+	if got := Evaluate(Response{Content: content}); got != nil {
+		t.Errorf("Expected no signals for a late refusal phrase, got %v", got)
+	}
+}
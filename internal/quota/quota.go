@@ -0,0 +1,313 @@
+// Package quota enforces monthly token and cost budgets, per user and
+// shared by the members of a group, and the request rate limits of groups.
+// Usage is taken from the usage log, so a budget covers every replica, and
+// requests are checked before they are routed. Summed usage is reused for
+// UsageCacheTTL, keeping the sum over a month of logs off most requests.
+package quota
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/internal/metrics"
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/X0Ken/openai-gateway/pkg/store"
+	"github.com/gin-gonic/gin"
+)
+
+// rateWindow is the window of group request rate limits
+const rateWindow = time.Minute
+
+// UsageCacheTTL is how long the summed usage of a user or group is reused
+// before the usage log is summed again. A budget can overshoot by what is
+// used in that time.
+const UsageCacheTTL = 5 * time.Second
+
+// Status is a user's or group's usage against its quota in the current
+// period
+type Status struct {
+	UserID int64 `json:"user_id,omitempty"`
+	// GroupID and GroupName are set for the shared quota of a group
+	GroupID   int64  `json:"group_id,omitempty"`
+	GroupName string `json:"group_name,omitempty"`
+	// PeriodStart is the start of the month, or the last reset if later
+	PeriodStart time.Time `json:"period_start"`
+	// PeriodEnd is the start of the next month, when the quota renews
+	PeriodEnd   time.Time `json:"period_end"`
+	TokensLimit int64     `json:"tokens_limit"`
+	TokensUsed  int64     `json:"tokens_used"`
+	CostLimit   float64   `json:"cost_limit"`
+	CostUsed    float64   `json:"cost_used"`
+	// Exhausted names the budget used up, "tokens" or "cost", or is empty
+	Exhausted string `json:"exhausted,omitempty"`
+}
+
+// Message describes the exhausted budget for the client
+func (s *Status) Message() string {
+	var message string
+	switch s.Exhausted {
+	case metrics.QuotaTokens:
+		message = fmt.Sprintf("monthly token quota of %d exhausted (%d used), it renews at %s", s.TokensLimit, s.TokensUsed, s.PeriodEnd.Format(time.RFC3339))
+	case metrics.QuotaCost:
+		message = fmt.Sprintf("monthly budget of $%.2f exhausted ($%.2f used), it renews at %s", s.CostLimit, s.CostUsed, s.PeriodEnd.Format(time.RFC3339))
+	default:
+		return ""
+	}
+	if s.GroupID != 0 {
+		message = fmt.Sprintf("group %q: %s", s.GroupName, message)
+	}
+	return message
+}
+
+// Checker computes quota status from the usage log and counts the requests
+// of groups with a rate limit
+type Checker struct {
+	db       *database.DB
+	counters store.RateLimits
+	now      func() time.Time
+
+	mu    sync.Mutex
+	usage map[string]*usage
+}
+
+// usage is the summed usage of a user or group since the start of a period
+type usage struct {
+	from       time.Time
+	tokens     int64
+	cost       float64
+	measuredAt time.Time
+}
+
+// New creates a quota checker
+func New(db *database.DB) *Checker {
+	return &Checker{db: db, now: time.Now, usage: make(map[string]*usage)}
+}
+
+// SetRateLimits sets the counters group request rates are counted in.
+// Group rate limits are not enforced until it is called.
+func (q *Checker) SetRateLimits(counters store.RateLimits) {
+	q.counters = counters
+}
+
+// Status returns a user's usage against its quota, or nil if the user has
+// no quota
+func (q *Checker) Status(userID int64) (*Status, error) {
+	quota, err := q.db.GetUserQuota(userID)
+	if err != nil || quota == nil {
+		return nil, err
+	}
+
+	status := q.newStatus(quota.MonthlyTokens, quota.MonthlyCost, quota.ResetAt)
+	status.UserID = userID
+	key := "user:" + strconv.FormatInt(userID, 10)
+	if err := q.measure(status, key, database.UsageQuery{UserID: userID, From: status.PeriodStart}); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// GroupStatus returns the usage of a group's members against the group's
+// shared quota
+func (q *Checker) GroupStatus(group *database.Group) (*Status, error) {
+	status := q.newStatus(group.MonthlyTokens, group.MonthlyCost, group.ResetAt)
+	status.GroupID = group.ID
+	status.GroupName = group.Name
+	key := "group:" + strconv.FormatInt(group.ID, 10)
+	if err := q.measure(status, key, database.UsageQuery{GroupID: group.ID, From: status.PeriodStart}); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// Statuses returns the status of a user's own quota, if any, followed by
+// those of its groups with a monthly budget
+func (q *Checker) Statuses(userID int64) ([]*Status, error) {
+	groups, err := q.db.ListUserGroups(userID)
+	if err != nil {
+		return nil, err
+	}
+	return q.statuses(userID, groups)
+}
+
+// statuses returns the statuses of a user's quota and of its groups' budgets
+func (q *Checker) statuses(userID int64, groups []*database.Group) ([]*Status, error) {
+	var statuses []*Status
+	status, err := q.Status(userID)
+	if err != nil {
+		return nil, err
+	}
+	if status != nil {
+		statuses = append(statuses, status)
+	}
+	for _, group := range groups {
+		if group.MonthlyTokens == 0 && group.MonthlyCost == 0 {
+			continue
+		}
+		status, err := q.GroupStatus(group)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Exhausted returns the first status among statuses with an exhausted
+// budget, or nil
+func Exhausted(statuses []*Status) *Status {
+	for _, status := range statuses {
+		if status.Exhausted != "" {
+			return status
+		}
+	}
+	return nil
+}
+
+// newStatus starts a status for the current month with the given limits
+func (q *Checker) newStatus(tokensLimit int64, costLimit float64, resetAt *time.Time) *Status {
+	now := q.now().UTC()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	status := &Status{
+		PeriodStart: start,
+		PeriodEnd:   start.AddDate(0, 1, 0),
+		TokensLimit: tokensLimit,
+		CostLimit:   costLimit,
+	}
+	if resetAt != nil && resetAt.After(start) {
+		status.PeriodStart = resetAt.UTC()
+	}
+	return status
+}
+
+// measure fills in a status's usage from the usage matching query, cached
+// under key, and finds the exhausted budget
+func (q *Checker) measure(status *Status, key string, query database.UsageQuery) error {
+	used, err := q.summarize(key, query)
+	if err != nil {
+		return err
+	}
+	status.TokensUsed = used.tokens
+	status.CostUsed = used.cost
+
+	switch {
+	case status.TokensLimit > 0 && status.TokensUsed >= status.TokensLimit:
+		status.Exhausted = metrics.QuotaTokens
+	case status.CostLimit > 0 && status.CostUsed >= status.CostLimit:
+		status.Exhausted = metrics.QuotaCost
+	}
+	return nil
+}
+
+// summarize returns the usage matching query, summing the usage log only
+// when the cached sum under key is stale or started at another time, as it
+// does after a reset
+func (q *Checker) summarize(key string, query database.UsageQuery) (*usage, error) {
+	now := q.now()
+	q.mu.Lock()
+	cached := q.usage[key]
+	q.mu.Unlock()
+	if cached != nil && cached.from.Equal(query.From) && now.Sub(cached.measuredAt) < UsageCacheTTL {
+		return cached, nil
+	}
+
+	totals, err := q.db.SummarizeUsage(query)
+	if err != nil {
+		return nil, err
+	}
+	used := &usage{from: query.From, tokens: totals[0].TotalTokens, cost: totals[0].Cost, measuredAt: now}
+	q.mu.Lock()
+	q.usage[key] = used
+	q.mu.Unlock()
+	return used, nil
+}
+
+// limitRate counts a request against the rate limits of the user's groups
+// and returns the first group over its limit, or nil
+func (q *Checker) limitRate(ctx context.Context, groups []*database.Group) (*database.Group, error) {
+	if q.counters == nil {
+		return nil, nil
+	}
+	for _, group := range groups {
+		if group.RequestsPerMinute <= 0 {
+			continue
+		}
+		count, err := q.counters.Incr(ctx, "grouprate:"+strconv.FormatInt(group.ID, 10), rateWindow)
+		if err != nil {
+			return nil, err
+		}
+		if count > int64(group.RequestsPerMinute) {
+			return group, nil
+		}
+	}
+	return nil, nil
+}
+
+// Middleware rejects requests of users whose quota, or whose group's shared
+// quota, is exhausted with 429 and an insufficient_quota error, and requests
+// over a group's rate limit with 429 and a rate_limit_exceeded error, before
+// anything is routed. Requests in flight when a quota runs out are
+// completed, so usage can overshoot the limit by what they use.
+func (q *Checker) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetInt64("user_id")
+		if userID == 0 {
+			c.Next()
+			return
+		}
+
+		groups, err := q.db.ListUserGroups(userID)
+		if err != nil {
+			// Fail open: a database hiccup must not block every user
+			log.Printf("Failed to check quota of user %d: %v", userID, err)
+			c.Next()
+			return
+		}
+		statuses, err := q.statuses(userID, groups)
+		if err != nil {
+			log.Printf("Failed to check quota of user %d: %v", userID, err)
+			c.Next()
+			return
+		}
+		if status := Exhausted(statuses); status != nil {
+			metrics.RecordQuotaRejection(status.Exhausted)
+			retryAfter := int(status.PeriodEnd.Sub(q.now()).Seconds()) + 1
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error": gin.H{
+					"message": status.Message(),
+					"type":    "insufficient_quota",
+					"param":   nil,
+					"code":    "insufficient_quota",
+				},
+			})
+			return
+		}
+
+		group, err := q.limitRate(c.Request.Context(), groups)
+		if err != nil {
+			// Fail open: the store being down must not block every user
+			log.Printf("Failed to count request of user %d: %v", userID, err)
+			c.Next()
+			return
+		}
+		if group != nil {
+			metrics.RecordQuotaRejection(metrics.QuotaRequests)
+			c.Header("Retry-After", strconv.Itoa(int(rateWindow.Seconds())))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error": gin.H{
+					"message": fmt.Sprintf("group %q: rate limit of %d requests per minute exceeded", group.Name, group.RequestsPerMinute),
+					"type":    "requests",
+					"param":   nil,
+					"code":    "rate_limit_exceeded",
+				},
+			})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,215 @@
+package quota
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/X0Ken/openai-gateway/pkg/store"
+	"github.com/gin-gonic/gin"
+)
+
+func TestQuota(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	dbPath := "/tmp/test_quota.db"
+	defer os.Remove(dbPath)
+
+	db, err := database.New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+	q := New(db)
+	q.now = func() time.Time { return now }
+
+	if status, err := q.Status(1); err != nil || status != nil {
+		t.Fatalf("Expected no status for a user without a quota, got %+v, %v", status, err)
+	}
+
+	if err := db.SetUserQuota(&database.UserQuota{UserID: 1, MonthlyTokens: 1000}); err != nil {
+		t.Fatal(err)
+	}
+	// Usage in the previous month does not count
+	for _, log := range []database.UsageLog{
+		{UserID: 1, Model: "gpt-4", TotalTokens: 5000, CreatedAt: now.AddDate(0, -1, 0)},
+		{UserID: 1, Model: "gpt-4", TotalTokens: 600, CreatedAt: now.Add(-time.Hour)},
+		{UserID: 2, Model: "gpt-4", TotalTokens: 600, CreatedAt: now.Add(-time.Hour)},
+	} {
+		if err := db.CreateUsageLog(&log); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", int64(1)) })
+	r.POST("/v1/chat/completions", q.Middleware(), func(c *gin.Context) { c.Status(http.StatusOK) })
+	call := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", "/v1/chat/completions", nil))
+		return w
+	}
+
+	status, err := q.Status(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.TokensUsed != 600 || status.Exhausted != "" {
+		t.Errorf("Expected 600 tokens used and budget left, got %+v", status)
+	}
+	if w := call(); w.Code != http.StatusOK {
+		t.Errorf("Expected a request within quota to pass, got %d", w.Code)
+	}
+
+	if err := db.CreateUsageLog(&database.UsageLog{UserID: 1, Model: "gpt-4", TotalTokens: 400, CreatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	// The usage is summed again once the cached sum is stale
+	if w := call(); w.Code != http.StatusOK {
+		t.Errorf("Expected the cached usage to be reused, got %d", w.Code)
+	}
+	now = now.Add(UsageCacheTTL)
+	w := call()
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429 once the quota is exhausted, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("Expected a Retry-After header until the quota renews")
+	}
+
+	// A reset starts the count over
+	if _, err := db.ResetUserQuota(1, now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(2 * time.Minute)
+	if w := call(); w.Code != http.StatusOK {
+		t.Errorf("Expected a request after a reset to pass, got %d", w.Code)
+	}
+
+	// So does the next month
+	if _, err := db.ResetUserQuota(1, now.AddDate(0, -2, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if w := call(); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected an old reset to be ignored, got %d", w.Code)
+	}
+	now = time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+	if w := call(); w.Code != http.StatusOK {
+		t.Errorf("Expected the quota to renew with the month, got %d", w.Code)
+	}
+}
+
+func TestGroupQuota(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	dbPath := "/tmp/test_group_quota.db"
+	defer os.Remove(dbPath)
+
+	db, err := database.New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+	q := New(db)
+	q.now = func() time.Time { return now }
+	q.SetRateLimits(store.NewMemory())
+
+	alice := &database.User{APIKey: "alice-key", Name: "alice"}
+	bob := &database.User{APIKey: "bob-key", Name: "bob"}
+	carol := &database.User{APIKey: "carol-key", Name: "carol"}
+	for _, u := range []*database.User{alice, bob, carol} {
+		if err := db.CreateUser(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	team := &database.Group{Name: "team", MonthlyTokens: 1000, RequestsPerMinute: 3}
+	if err := db.CreateGroup(team); err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range []*database.User{alice, bob} {
+		if err := db.AddGroupMember(team.ID, u.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var userID int64
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", userID) })
+	r.POST("/v1/chat/completions", q.Middleware(), func(c *gin.Context) { c.Status(http.StatusOK) })
+	call := func(id int64) *httptest.ResponseRecorder {
+		userID = id
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", "/v1/chat/completions", nil))
+		return w
+	}
+
+	// Members share the rate limit, non-members are not held to it
+	for i, id := range []int64{alice.ID, bob.ID, alice.ID} {
+		if w := call(id); w.Code != http.StatusOK {
+			t.Fatalf("Expected request %d within the group rate limit to pass, got %d", i, w.Code)
+		}
+	}
+	if w := call(bob.ID); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 over the group rate limit, got %d", w.Code)
+	}
+	if w := call(carol.ID); w.Code != http.StatusOK {
+		t.Errorf("Expected a non-member to pass, got %d", w.Code)
+	}
+
+	// Members' usage counts against the shared budget together
+	team.RequestsPerMinute = 0
+	if err := db.UpdateGroup(team); err != nil {
+		t.Fatal(err)
+	}
+	for _, log := range []database.UsageLog{
+		{UserID: alice.ID, Model: "gpt-4", TotalTokens: 600, CreatedAt: now.Add(-time.Hour)},
+		{UserID: carol.ID, Model: "gpt-4", TotalTokens: 5000, CreatedAt: now.Add(-time.Hour)},
+	} {
+		if err := db.CreateUsageLog(&log); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now = now.Add(UsageCacheTTL)
+	status, err := q.GroupStatus(team)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.TokensUsed != 600 || status.Exhausted != "" {
+		t.Errorf("Expected the group to have used 600 tokens, got %+v", status)
+	}
+	if w := call(bob.ID); w.Code != http.StatusOK {
+		t.Errorf("Expected a member within the shared budget to pass, got %d", w.Code)
+	}
+
+	if err := db.CreateUsageLog(&database.UsageLog{UserID: bob.ID, Model: "gpt-4", TotalTokens: 400, CreatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(UsageCacheTTL)
+	for _, id := range []int64{alice.ID, bob.ID} {
+		if w := call(id); w.Code != http.StatusTooManyRequests {
+			t.Errorf("Expected 429 for user %d once the shared budget is exhausted, got %d", id, w.Code)
+		}
+	}
+	if w := call(carol.ID); w.Code != http.StatusOK {
+		t.Errorf("Expected a non-member to pass, got %d", w.Code)
+	}
+
+	// Leaving the group takes the member's usage out of the shared budget
+	if _, err := db.RemoveGroupMember(team.ID, bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(UsageCacheTTL)
+	if w := call(alice.ID); w.Code != http.StatusOK {
+		t.Errorf("Expected the budget to have room once bob left, got %d", w.Code)
+	}
+	if w := call(bob.ID); w.Code != http.StatusOK {
+		t.Errorf("Expected a former member to pass, got %d", w.Code)
+	}
+}
@@ -0,0 +1,87 @@
+package reconcile
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+// Handler exposes the declarative state API
+type Handler struct {
+	reconciler *Reconciler
+}
+
+// NewHandler creates a new state handler
+func NewHandler(reconciler *Reconciler) *Handler {
+	return &Handler{reconciler: reconciler}
+}
+
+// RegisterRoutes registers state routes
+func (h *Handler) RegisterRoutes(r *gin.RouterGroup) {
+	r.GET("/state", h.GetState)
+	r.PUT("/state", h.PutState)
+}
+
+// ApplyResponse reports the changes planned or applied for a desired state
+type ApplyResponse struct {
+	DryRun  bool     `json:"dry_run"`
+	Changes []Change `json:"changes"`
+}
+
+// GetState returns the current state in the shape accepted by PutState
+func (h *Handler) GetState(c *gin.Context) {
+	state, err := h.reconciler.Export()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, state)
+}
+
+// PutState reconciles the gateway to the desired state. With ?dry_run=true
+// the diff is returned without applying anything.
+func (h *Handler) PutState(c *gin.Context) {
+	var desired State
+	if err := c.ShouldBindJSON(&desired); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	dryRun := c.Query("dry_run") == "true"
+
+	var changes []Change
+	var err error
+	if dryRun {
+		changes, err = h.reconciler.Plan(&desired)
+	} else {
+		changes, err = h.reconciler.Apply(&desired)
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, ErrInvalidState):
+			status = http.StatusBadRequest
+		case errors.Is(err, database.ErrDuplicate):
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, ApplyResponse{
+		DryRun:  dryRun,
+		Changes: nonNil(changes),
+	})
+}
+
+// nonNil returns an empty slice in place of nil, so empty change lists are
+// serialized as [] and merged state sections stay managed
+func nonNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
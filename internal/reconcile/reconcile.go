@@ -0,0 +1,813 @@
+package reconcile
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"sort"
+
+	"github.com/X0Ken/openai-gateway/internal/channel"
+	"github.com/X0Ken/openai-gateway/pkg/database"
+)
+
+// State is the full desired configuration of the gateway. Each section is
+// optional: an omitted (nil) section is left unmanaged, while a present
+// section, even an empty one, is authoritative and resources missing from it
+// are deleted.
+type State struct {
+	Channels []ChannelSpec `json:"channels"`
+	Models   []ModelSpec   `json:"models"`
+	Users    []UserSpec    `json:"users"`
+}
+
+// ChannelSpec describes a desired channel, keyed by name
+type ChannelSpec struct {
+	Name           string            `json:"name"`
+	Type           string            `json:"type,omitempty"`
+	BaseURL        string            `json:"base_url"`
+	APIKey         string            `json:"api_key"`
+	APIKeys        []string          `json:"api_keys,omitempty"`
+	Weight         int               `json:"weight,omitempty"`
+	Enabled        *bool             `json:"enabled,omitempty"`
+	PathTemplates  map[string]string `json:"path_templates,omitempty"`
+	Organization   string            `json:"organization,omitempty"`
+	Project        string            `json:"project,omitempty"`
+	APIVersion     string            `json:"api_version,omitempty"`
+	MaxConcurrency int               `json:"max_concurrency,omitempty"`
+	MaxBatchSize   int               `json:"max_batch_size,omitempty"`
+	TestOnly       bool              `json:"test_only,omitempty"`
+	Cost           float64           `json:"cost,omitempty"`
+	ProxyURL       string            `json:"proxy_url,omitempty"`
+	// RetryPolicy overrides fields of the configured retry policy
+	RetryPolicy *database.RetryPolicy `json:"retry_policy,omitempty"`
+}
+
+// ModelSpec describes a desired logical model and its channel mappings
+type ModelSpec struct {
+	Name             string             `json:"name"`
+	ContextWindow    int                `json:"context_window,omitempty"`
+	Truncate         bool               `json:"truncate,omitempty"`
+	MaxStreamSeconds int                `json:"max_stream_seconds,omitempty"`
+	Channels         []ModelChannelSpec `json:"channels,omitempty"`
+}
+
+// ModelChannelSpec describes a desired model-channel mapping, keyed by channel name
+type ModelChannelSpec struct {
+	Channel          string `json:"channel"`
+	BackendModelName string `json:"backend_model_name"`
+	Weight           int    `json:"weight,omitempty"`
+	StreamMode       string `json:"stream_mode,omitempty"`
+	// Dimensions declares the backend's embeddings length; 0 leaves it to be
+	// learned from responses
+	Dimensions int `json:"dimensions,omitempty"`
+}
+
+// UserSpec describes a desired user, keyed by name
+type UserSpec struct {
+	Name    string `json:"name"`
+	APIKey  string `json:"api_key"`
+	Enabled *bool  `json:"enabled,omitempty"`
+}
+
+// ErrInvalidState is returned when the desired state fails validation
+var ErrInvalidState = errors.New("invalid state")
+
+// Change actions
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+// Change describes a single difference between the current and desired state
+type Change struct {
+	Action string   `json:"action"`
+	Kind   string   `json:"kind"`
+	Name   string   `json:"name"`
+	Fields []string `json:"fields,omitempty"`
+
+	apply func(db *database.DB) error
+	// applied, if set, runs once the change is committed
+	applied func()
+}
+
+// Reconciler computes and applies differences between desired and current state
+type Reconciler struct {
+	db       *database.DB
+	channels *channel.Manager
+}
+
+// NewReconciler creates a new reconciler
+func NewReconciler(db *database.DB) *Reconciler {
+	return &Reconciler{db: db}
+}
+
+// SetChannelManager makes channel changes keep the manager's health checks
+// and connections up to date, as the manager's own writes do
+func (r *Reconciler) SetChannelManager(m *channel.Manager) {
+	r.channels = m
+}
+
+// Plan returns the changes required to reach the desired state without applying them
+func (r *Reconciler) Plan(desired *State) ([]Change, error) {
+	if err := validate(desired); err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+
+	if desired.Channels != nil {
+		channelChanges, err := r.planChannels(desired.Channels)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, channelChanges...)
+	}
+
+	if desired.Models != nil {
+		modelChanges, err := r.planModels(desired.Models)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, modelChanges...)
+	}
+
+	if desired.Users != nil {
+		userChanges, err := r.planUsers(desired.Users)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, userChanges...)
+	}
+
+	return order(changes), nil
+}
+
+// Apply reconciles the current state towards the desired state and returns
+// the changes that were made. The changes are applied in one transaction, so
+// a failure leaves the state as it was. Applying the same state twice is a
+// no-op.
+func (r *Reconciler) Apply(desired *State) ([]Change, error) {
+	changes, err := r.Plan(desired)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.db.Transaction(func(tx *database.DB) error {
+		for _, change := range changes {
+			if err := change.apply(tx); err != nil {
+				return fmt.Errorf("failed to %s %s %q: %w", change.Action, change.Kind, change.Name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, change := range changes {
+		if change.applied != nil {
+			change.applied()
+		}
+	}
+	return changes, nil
+}
+
+// Export returns the current state in the same shape accepted by Apply.
+// API keys are omitted.
+func (r *Reconciler) Export() (*State, error) {
+	channels, err := r.db.ListChannels()
+	if err != nil {
+		return nil, err
+	}
+	models, err := r.db.ListModels()
+	if err != nil {
+		return nil, err
+	}
+	mappings, err := r.db.ListModelChannels()
+	if err != nil {
+		return nil, err
+	}
+	users, err := r.db.ListUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	state := &State{
+		Channels: []ChannelSpec{},
+		Models:   []ModelSpec{},
+		Users:    []UserSpec{},
+	}
+
+	channelNames := make(map[int64]string)
+	for _, ch := range channels {
+		enabled := ch.Enabled
+		channelNames[ch.ID] = ch.Name
+		state.Channels = append(state.Channels, ChannelSpec{
+			Name:           ch.Name,
+			Type:           ch.Type,
+			BaseURL:        ch.BaseURL,
+			Weight:         ch.Weight,
+			Enabled:        &enabled,
+			PathTemplates:  ch.PathTemplates,
+			Organization:   ch.Organization,
+			Project:        ch.Project,
+			APIVersion:     ch.APIVersion,
+			MaxConcurrency: ch.MaxConcurrency,
+			MaxBatchSize:   ch.MaxBatchSize,
+			TestOnly:       ch.TestOnly,
+			Cost:           ch.Cost,
+			ProxyURL:       ch.ProxyURL,
+			RetryPolicy:    ch.RetryPolicy,
+		})
+	}
+
+	for _, m := range models {
+		spec := ModelSpec{Name: m.Name, ContextWindow: m.ContextWindow, Truncate: m.Truncate, MaxStreamSeconds: m.MaxStreamSeconds}
+		for _, mc := range mappings {
+			if mc.ModelID != m.ID {
+				continue
+			}
+			spec.Channels = append(spec.Channels, ModelChannelSpec{
+				Channel:          channelNames[mc.ChannelID],
+				BackendModelName: mc.BackendModelName,
+				Weight:           mc.Weight,
+				StreamMode:       mc.StreamMode,
+				Dimensions:       mc.Dimensions,
+			})
+		}
+		state.Models = append(state.Models, spec)
+	}
+
+	for _, u := range users {
+		enabled := u.Enabled
+		state.Users = append(state.Users, UserSpec{Name: u.Name, Enabled: &enabled})
+	}
+
+	return state, nil
+}
+
+// validate checks the desired state for missing keys and duplicates
+func validate(desired *State) error {
+	seen := make(map[string]bool)
+	for _, ch := range desired.Channels {
+		if ch.Name == "" || ch.BaseURL == "" || ch.APIKey == "" {
+			return fmt.Errorf("%w: channel %q: name, base_url and api_key are required", ErrInvalidState, ch.Name)
+		}
+		if slices.Contains(ch.APIKeys, "") {
+			return fmt.Errorf("%w: channel %q: api_keys must not be empty", ErrInvalidState, ch.Name)
+		}
+		if seen[ch.Name] {
+			return fmt.Errorf("%w: channel %q is declared more than once", ErrInvalidState, ch.Name)
+		}
+		seen[ch.Name] = true
+		if err := channel.ValidateType(ch.Type); err != nil {
+			return fmt.Errorf("%w: channel %q: %v", ErrInvalidState, ch.Name, err)
+		}
+		if err := channel.ValidatePathTemplates(ch.PathTemplates); err != nil {
+			return fmt.Errorf("%w: channel %q: %v", ErrInvalidState, ch.Name, err)
+		}
+		if err := channel.ValidateProxyURL(ch.ProxyURL); err != nil {
+			return fmt.Errorf("%w: channel %q: %v", ErrInvalidState, ch.Name, err)
+		}
+		if err := channel.ValidateRetryPolicy(ch.RetryPolicy); err != nil {
+			return fmt.Errorf("%w: channel %q: %v", ErrInvalidState, ch.Name, err)
+		}
+	}
+
+	seen = make(map[string]bool)
+	for _, m := range desired.Models {
+		if m.Name == "" {
+			return fmt.Errorf("%w: model name is required", ErrInvalidState)
+		}
+		if seen[m.Name] {
+			return fmt.Errorf("%w: model %q is declared more than once", ErrInvalidState, m.Name)
+		}
+		if m.ContextWindow < 0 {
+			return fmt.Errorf("%w: model %q: context_window must not be negative", ErrInvalidState, m.Name)
+		}
+		if m.MaxStreamSeconds < 0 {
+			return fmt.Errorf("%w: model %q: max_stream_seconds must not be negative", ErrInvalidState, m.Name)
+		}
+		seen[m.Name] = true
+
+		mapped := make(map[string]bool)
+		dimensions := 0
+		for _, mc := range m.Channels {
+			if mc.Channel == "" || mc.BackendModelName == "" {
+				return fmt.Errorf("%w: model %q: channel and backend_model_name are required", ErrInvalidState, m.Name)
+			}
+			if mapped[mc.Channel] {
+				return fmt.Errorf("%w: model %q maps channel %q more than once", ErrInvalidState, m.Name, mc.Channel)
+			}
+			mapped[mc.Channel] = true
+			if mc.StreamMode != "" && !database.IsValidStreamMode(mc.StreamMode) {
+				return fmt.Errorf("%w: model %q: invalid stream mode %q", ErrInvalidState, m.Name, mc.StreamMode)
+			}
+			if mc.Dimensions < 0 {
+				return fmt.Errorf("%w: model %q: dimensions must not be negative", ErrInvalidState, m.Name)
+			}
+			if mc.Dimensions != 0 {
+				if dimensions != 0 && mc.Dimensions != dimensions {
+					return fmt.Errorf("%w: model %q maps backends with %d and %d dimensions", ErrInvalidState, m.Name, dimensions, mc.Dimensions)
+				}
+				dimensions = mc.Dimensions
+			}
+		}
+	}
+
+	seen = make(map[string]bool)
+	for _, u := range desired.Users {
+		if u.Name == "" || u.APIKey == "" {
+			return fmt.Errorf("%w: user %q: name and api_key are required", ErrInvalidState, u.Name)
+		}
+		if seen[u.Name] {
+			return fmt.Errorf("%w: user %q is declared more than once", ErrInvalidState, u.Name)
+		}
+		seen[u.Name] = true
+	}
+
+	return nil
+}
+
+// planChannels diffs desired channels against the database
+func (r *Reconciler) planChannels(desired []ChannelSpec) ([]Change, error) {
+	current, err := r.db.ListChannels()
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]*database.Channel)
+	for _, ch := range current {
+		byName[ch.Name] = ch
+	}
+
+	var changes []Change
+	wanted := make(map[string]bool)
+	for _, spec := range desired {
+		wanted[spec.Name] = true
+		target := channelFromSpec(spec)
+
+		existing, ok := byName[spec.Name]
+		if !ok {
+			changes = append(changes, Change{
+				Action:  ActionCreate,
+				Kind:    "channel",
+				Name:    spec.Name,
+				apply:   func(db *database.DB) error { return db.CreateChannel(target) },
+				applied: func() { r.channelSaved(target) },
+			})
+			continue
+		}
+
+		if fields := channelDiff(existing, target); len(fields) > 0 {
+			// Notes, maintenance windows and status are operational, not
+			// declared state; a new API key clears an auth_failed status
+			target.ID = existing.ID
+			target.Notes = existing.Notes
+			target.MaintenanceUntil = existing.MaintenanceUntil
+			if existing.APIKey == target.APIKey && slices.Equal(existing.APIKeys, target.APIKeys) {
+				target.Status = existing.Status
+			}
+			changes = append(changes, Change{
+				Action:  ActionUpdate,
+				Kind:    "channel",
+				Name:    spec.Name,
+				Fields:  fields,
+				apply:   func(db *database.DB) error { return db.UpdateChannel(target) },
+				applied: func() { r.channelSaved(target) },
+			})
+		}
+	}
+
+	for _, ch := range current {
+		if wanted[ch.Name] {
+			continue
+		}
+		id := ch.ID
+		changes = append(changes, Change{
+			Action: ActionDelete,
+			Kind:   "channel",
+			Name:   ch.Name,
+			apply: func(db *database.DB) error {
+				if err := db.RemoveAllModelChannelsForChannel(id); err != nil {
+					return err
+				}
+				return db.DeleteChannel(id)
+			},
+			applied: func() { r.channelDeleted(id) },
+		})
+	}
+
+	return changes, nil
+}
+
+// channelFromSpec converts a spec into a channel, applying creation defaults
+func channelFromSpec(spec ChannelSpec) *database.Channel {
+	weight := spec.Weight
+	if weight <= 0 {
+		weight = 10
+	}
+	enabled := spec.Enabled == nil || *spec.Enabled
+	channelType := spec.Type
+	if channelType == "" {
+		channelType = database.ChannelTypeOpenAI
+	}
+	retryPolicy := spec.RetryPolicy
+	if retryPolicy.IsZero() {
+		retryPolicy = nil
+	}
+
+	return &database.Channel{
+		Name:           spec.Name,
+		Type:           channelType,
+		BaseURL:        spec.BaseURL,
+		APIKey:         spec.APIKey,
+		APIKeys:        spec.APIKeys,
+		Weight:         weight,
+		Enabled:        enabled,
+		PathTemplates:  spec.PathTemplates,
+		Organization:   spec.Organization,
+		Project:        spec.Project,
+		APIVersion:     spec.APIVersion,
+		MaxConcurrency: spec.MaxConcurrency,
+		MaxBatchSize:   spec.MaxBatchSize,
+		TestOnly:       spec.TestOnly,
+		Cost:           spec.Cost,
+		ProxyURL:       spec.ProxyURL,
+		RetryPolicy:    retryPolicy,
+	}
+}
+
+// channelDiff lists the fields that differ between two channels
+func channelDiff(current, target *database.Channel) []string {
+	var fields []string
+	if current.Type != target.Type {
+		fields = append(fields, "type")
+	}
+	if current.BaseURL != target.BaseURL {
+		fields = append(fields, "base_url")
+	}
+	if current.APIKey != target.APIKey {
+		fields = append(fields, "api_key")
+	}
+	if !slices.Equal(current.APIKeys, target.APIKeys) {
+		fields = append(fields, "api_keys")
+	}
+	if current.Weight != target.Weight {
+		fields = append(fields, "weight")
+	}
+	if current.Enabled != target.Enabled {
+		fields = append(fields, "enabled")
+	}
+	if !maps.Equal(current.PathTemplates, target.PathTemplates) {
+		fields = append(fields, "path_templates")
+	}
+	if current.Organization != target.Organization {
+		fields = append(fields, "organization")
+	}
+	if current.Project != target.Project {
+		fields = append(fields, "project")
+	}
+	if current.APIVersion != target.APIVersion {
+		fields = append(fields, "api_version")
+	}
+	if current.MaxConcurrency != target.MaxConcurrency {
+		fields = append(fields, "max_concurrency")
+	}
+	if current.MaxBatchSize != target.MaxBatchSize {
+		fields = append(fields, "max_batch_size")
+	}
+	if current.TestOnly != target.TestOnly {
+		fields = append(fields, "test_only")
+	}
+	if current.Cost != target.Cost {
+		fields = append(fields, "cost")
+	}
+	if current.ProxyURL != target.ProxyURL {
+		fields = append(fields, "proxy_url")
+	}
+	if !reflect.DeepEqual(current.RetryPolicy, target.RetryPolicy) {
+		fields = append(fields, "retry_policy")
+	}
+	return fields
+}
+
+// modelDiff lists the model settings that differ from the desired spec
+func modelDiff(current *database.Model, target *ModelSpec) []string {
+	var fields []string
+	if current.ContextWindow != target.ContextWindow {
+		fields = append(fields, "context_window")
+	}
+	if current.Truncate != target.Truncate {
+		fields = append(fields, "truncate")
+	}
+	if current.MaxStreamSeconds != target.MaxStreamSeconds {
+		fields = append(fields, "max_stream_seconds")
+	}
+	return fields
+}
+
+// channelSaved tells the channel manager, if any, about a saved channel
+func (r *Reconciler) channelSaved(ch *database.Channel) {
+	if r.channels != nil {
+		r.channels.Saved(ch)
+	}
+}
+
+// channelDeleted tells the channel manager, if any, about a deleted channel
+func (r *Reconciler) channelDeleted(id int64) {
+	if r.channels != nil {
+		r.channels.Deleted(id)
+	}
+}
+
+// planModels diffs desired models and their channel mappings against the database
+func (r *Reconciler) planModels(desired []ModelSpec) ([]Change, error) {
+	models, err := r.db.ListModels()
+	if err != nil {
+		return nil, err
+	}
+	mappings, err := r.db.ListModelChannels()
+	if err != nil {
+		return nil, err
+	}
+	channels, err := r.db.ListChannels()
+	if err != nil {
+		return nil, err
+	}
+
+	modelsByName := make(map[string]*database.Model)
+	for _, m := range models {
+		modelsByName[m.Name] = m
+	}
+	channelNames := make(map[int64]string)
+	for _, ch := range channels {
+		channelNames[ch.ID] = ch.Name
+	}
+
+	var changes []Change
+	wanted := make(map[string]bool)
+	for _, spec := range desired {
+		wanted[spec.Name] = true
+
+		// Current mappings of this model keyed by channel name
+		currentMappings := make(map[string]*database.ModelChannel)
+		existing, ok := modelsByName[spec.Name]
+		if ok {
+			for _, mc := range mappings {
+				if mc.ModelID == existing.ID {
+					currentMappings[channelNames[mc.ChannelID]] = mc
+				}
+			}
+			if fields := modelDiff(existing, &spec); len(fields) > 0 {
+				updated := *existing
+				updated.ContextWindow = spec.ContextWindow
+				updated.Truncate = spec.Truncate
+				updated.MaxStreamSeconds = spec.MaxStreamSeconds
+				changes = append(changes, Change{
+					Action: ActionUpdate,
+					Kind:   "model",
+					Name:   spec.Name,
+					Fields: fields,
+					apply:  func(db *database.DB) error { return db.UpdateModel(&updated) },
+				})
+			}
+		} else {
+			changes = append(changes, Change{
+				Action: ActionCreate,
+				Kind:   "model",
+				Name:   spec.Name,
+				apply: func(db *database.DB) error {
+					return db.CreateModel(&database.Model{Name: spec.Name, ContextWindow: spec.ContextWindow, Truncate: spec.Truncate, MaxStreamSeconds: spec.MaxStreamSeconds})
+				},
+			})
+		}
+
+		wantedMappings := make(map[string]bool)
+		for _, mcSpec := range spec.Channels {
+			wantedMappings[mcSpec.Channel] = true
+			name := spec.Name + "/" + mcSpec.Channel
+
+			weight := mcSpec.Weight
+			if weight <= 0 {
+				weight = 10
+			}
+			streamMode := mcSpec.StreamMode
+			if streamMode == "" {
+				streamMode = database.StreamModePassthrough
+			}
+
+			current, ok := currentMappings[mcSpec.Channel]
+			if !ok {
+				changes = append(changes, Change{
+					Action: ActionCreate,
+					Kind:   "model_channel",
+					Name:   name,
+					apply: func(db *database.DB) error {
+						modelID, channelID, err := resolveMapping(db, spec.Name, mcSpec.Channel)
+						if err != nil {
+							return err
+						}
+						return db.AddModelChannel(&database.ModelChannel{
+							ModelID:          modelID,
+							ChannelID:        channelID,
+							BackendModelName: mcSpec.BackendModelName,
+							Weight:           weight,
+							StreamMode:       streamMode,
+							Dimensions:       mcSpec.Dimensions,
+						})
+					},
+				})
+				continue
+			}
+
+			var fields []string
+			if current.BackendModelName != mcSpec.BackendModelName {
+				fields = append(fields, "backend_model_name")
+			}
+			if current.Weight != weight {
+				fields = append(fields, "weight")
+			}
+			if current.StreamMode != streamMode {
+				fields = append(fields, "stream_mode")
+			}
+			if mcSpec.Dimensions != 0 && current.Dimensions != mcSpec.Dimensions {
+				fields = append(fields, "dimensions")
+			}
+			if len(fields) > 0 {
+				updated := *current
+				updated.BackendModelName = mcSpec.BackendModelName
+				updated.Weight = weight
+				updated.StreamMode = streamMode
+				if mcSpec.Dimensions != 0 {
+					updated.Dimensions = mcSpec.Dimensions
+				}
+				changes = append(changes, Change{
+					Action: ActionUpdate,
+					Kind:   "model_channel",
+					Name:   name,
+					Fields: fields,
+					apply:  func(db *database.DB) error { return db.UpdateModelChannel(&updated) },
+				})
+			}
+		}
+
+		for channelName, mc := range currentMappings {
+			if wantedMappings[channelName] {
+				continue
+			}
+			modelID, channelID := mc.ModelID, mc.ChannelID
+			changes = append(changes, Change{
+				Action: ActionDelete,
+				Kind:   "model_channel",
+				Name:   spec.Name + "/" + channelName,
+				apply:  func(db *database.DB) error { return db.RemoveModelChannel(modelID, channelID) },
+			})
+		}
+	}
+
+	for _, m := range models {
+		if wanted[m.Name] {
+			continue
+		}
+		id := m.ID
+		changes = append(changes, Change{
+			Action: ActionDelete,
+			Kind:   "model",
+			Name:   m.Name,
+			apply: func(db *database.DB) error {
+				if err := db.RemoveAllModelChannelsForModel(id); err != nil {
+					return err
+				}
+				return db.DeleteModel(id)
+			},
+		})
+	}
+
+	return changes, nil
+}
+
+// resolveMapping looks up model and channel IDs by name at apply time, so
+// mappings may reference resources created earlier in the same apply
+func resolveMapping(db *database.DB, modelName, channelName string) (int64, int64, error) {
+	model, err := db.GetModelByName(modelName)
+	if err != nil {
+		return 0, 0, err
+	}
+	if model == nil {
+		return 0, 0, fmt.Errorf("model not found: %s", modelName)
+	}
+
+	ch, err := db.GetChannelByName(channelName)
+	if err != nil {
+		return 0, 0, err
+	}
+	if ch == nil {
+		return 0, 0, fmt.Errorf("channel not found: %s", channelName)
+	}
+
+	return model.ID, ch.ID, nil
+}
+
+// planUsers diffs desired users against the database
+func (r *Reconciler) planUsers(desired []UserSpec) ([]Change, error) {
+	current, err := r.db.ListUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]*database.User)
+	for _, u := range current {
+		byName[u.Name] = u
+	}
+
+	var changes []Change
+	wanted := make(map[string]bool)
+	for _, spec := range desired {
+		wanted[spec.Name] = true
+		enabled := spec.Enabled == nil || *spec.Enabled
+
+		existing, ok := byName[spec.Name]
+		if !ok {
+			user := &database.User{Name: spec.Name, APIKey: spec.APIKey}
+			changes = append(changes, Change{
+				Action: ActionCreate,
+				Kind:   "user",
+				Name:   spec.Name,
+				apply: func(db *database.DB) error {
+					if err := db.CreateUser(user); err != nil {
+						return err
+					}
+					if !enabled {
+						user.Enabled = false
+						return db.UpdateUser(user)
+					}
+					return nil
+				},
+			})
+			continue
+		}
+
+		var fields []string
+		if existing.APIKey != spec.APIKey {
+			fields = append(fields, "api_key")
+		}
+		if existing.Enabled != enabled {
+			fields = append(fields, "enabled")
+		}
+		if len(fields) > 0 {
+			updated := *existing
+			updated.APIKey = spec.APIKey
+			updated.Enabled = enabled
+			changes = append(changes, Change{
+				Action: ActionUpdate,
+				Kind:   "user",
+				Name:   spec.Name,
+				Fields: fields,
+				apply:  func(db *database.DB) error { return db.UpdateUser(&updated) },
+			})
+		}
+	}
+
+	for _, u := range current {
+		if wanted[u.Name] {
+			continue
+		}
+		id := u.ID
+		changes = append(changes, Change{
+			Action: ActionDelete,
+			Kind:   "user",
+			Name:   u.Name,
+			apply:  func(db *database.DB) error { return db.DeleteUser(id) },
+		})
+	}
+
+	return changes, nil
+}
+
+// applyOrder ranks changes so dependencies are created before dependents and
+// removed after them
+var applyOrder = map[string]int{
+	"create/channel":       0,
+	"update/channel":       0,
+	"create/model":         1,
+	"delete/model_channel": 2,
+	"create/model_channel": 3,
+	"update/model_channel": 3,
+	"delete/model":         4,
+	"delete/channel":       5,
+	"create/user":          6,
+	"update/user":          6,
+	"delete/user":          6,
+}
+
+// order sorts changes into a dependency-safe order
+func order(changes []Change) []Change {
+	sort.SliceStable(changes, func(i, j int) bool {
+		return applyOrder[changes[i].Action+"/"+changes[i].Kind] < applyOrder[changes[j].Action+"/"+changes[j].Kind]
+	})
+	return changes
+}
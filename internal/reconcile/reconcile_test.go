@@ -0,0 +1,170 @@
+package reconcile
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/internal/channel"
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/X0Ken/openai-gateway/pkg/health"
+)
+
+func TestApplyIsIdempotent(t *testing.T) {
+	dbPath := "/tmp/test_reconcile.db"
+	os.Remove(dbPath)
+	defer os.Remove(dbPath)
+
+	db, err := database.New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	r := NewReconciler(db)
+	desired := &State{
+		Channels: []ChannelSpec{
+			{Name: "openai", BaseURL: "https://api.openai.com", APIKey: "sk-1"},
+		},
+		Models: []ModelSpec{
+			{Name: "gpt-4", Channels: []ModelChannelSpec{{Channel: "openai", BackendModelName: "gpt-4"}}},
+		},
+		Users: []UserSpec{
+			{Name: "alice", APIKey: "alice-key"},
+		},
+	}
+
+	changes, err := r.Apply(desired)
+	if err != nil {
+		t.Fatalf("Failed to apply state: %v", err)
+	}
+	if len(changes) != 4 {
+		t.Errorf("Expected 4 changes on first apply, got %d: %+v", len(changes), changes)
+	}
+
+	changes, err = r.Apply(desired)
+	if err != nil {
+		t.Fatalf("Failed to re-apply state: %v", err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("Expected no changes on second apply, got %+v", changes)
+	}
+
+	// Dry run reports updates and deletions without applying them
+	desired.Channels[0].Weight = 20
+	desired.Models = []ModelSpec{}
+	changes, err = r.Plan(desired)
+	if err != nil {
+		t.Fatalf("Failed to plan state: %v", err)
+	}
+	if len(changes) != 2 {
+		t.Errorf("Expected channel update and model delete, got %+v", changes)
+	}
+
+	model, _ := db.GetModelByName("gpt-4")
+	if model == nil {
+		t.Error("Dry run must not delete the model")
+	}
+
+	// Omitted sections are left unmanaged
+	if _, err := r.Apply(&State{Channels: desired.Channels}); err != nil {
+		t.Fatalf("Failed to apply partial state: %v", err)
+	}
+	if user, _ := db.GetUserByName("alice"); user == nil {
+		t.Error("Users must be left alone when the users section is omitted")
+	}
+}
+
+func TestApplyRollsBackOnFailure(t *testing.T) {
+	dbPath := "/tmp/test_reconcile_rollback.db"
+	os.Remove(dbPath)
+	defer os.Remove(dbPath)
+
+	db, err := database.New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	r := NewReconciler(db)
+	if _, err := r.Apply(&State{Users: []UserSpec{{Name: "bob", APIKey: "shared-key"}}}); err != nil {
+		t.Fatalf("Failed to apply state: %v", err)
+	}
+
+	// alice is created before bob is deleted, so her key collides with his
+	_, err = r.Apply(&State{
+		Channels: []ChannelSpec{{Name: "openai", BaseURL: "https://api.openai.com", APIKey: "sk-1"}},
+		Users:    []UserSpec{{Name: "alice", APIKey: "shared-key"}},
+	})
+	if err == nil {
+		t.Fatal("Expected the duplicate API key to fail the apply")
+	}
+
+	if ch, _ := db.GetChannelByName("openai"); ch != nil {
+		t.Error("Channel created before the failure must be rolled back")
+	}
+	if user, _ := db.GetUserByName("bob"); user == nil {
+		t.Error("bob must be kept when the apply fails")
+	}
+}
+
+func TestApplyUpdatesChannelManager(t *testing.T) {
+	dbPath := "/tmp/test_reconcile_manager.db"
+	os.Remove(dbPath)
+	defer os.Remove(dbPath)
+
+	db, err := database.New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	checker := health.NewChecker(time.Minute, time.Second)
+	mgr := channel.NewManager(db)
+	if err := mgr.SetHealthChecker(checker); err != nil {
+		t.Fatalf("Failed to set health checker: %v", err)
+	}
+	r := NewReconciler(db)
+	r.SetChannelManager(mgr)
+
+	spec := ChannelSpec{Name: "openai", BaseURL: "https://api.openai.com", APIKey: "sk-1"}
+	if _, err := r.Apply(&State{Channels: []ChannelSpec{spec}}); err != nil {
+		t.Fatalf("Failed to apply state: %v", err)
+	}
+	ch, _ := db.GetChannelByName("openai")
+	if ch == nil {
+		t.Fatal("Expected channel to be created")
+	}
+	if checker.GetStatus(ch.ID) == nil {
+		t.Error("Created channel must be registered for health checks")
+	}
+
+	disabled := false
+	spec.Enabled = &disabled
+	if _, err := r.Apply(&State{Channels: []ChannelSpec{spec}}); err != nil {
+		t.Fatalf("Failed to disable channel: %v", err)
+	}
+	if checker.GetStatus(ch.ID) != nil {
+		t.Error("Disabled channel must be unregistered from health checks")
+	}
+
+	spec.Enabled = nil
+	if _, err := r.Apply(&State{Channels: []ChannelSpec{spec}}); err != nil {
+		t.Fatalf("Failed to enable channel: %v", err)
+	}
+	if _, err := r.Apply(&State{Channels: []ChannelSpec{}}); err != nil {
+		t.Fatalf("Failed to delete channel: %v", err)
+	}
+	if checker.GetStatus(ch.ID) != nil {
+		t.Error("Deleted channel must be unregistered from health checks")
+	}
+}
+
+func TestPlanRejectsInvalidState(t *testing.T) {
+	r := NewReconciler(nil)
+
+	_, err := r.Plan(&State{Channels: []ChannelSpec{{Name: "x"}}})
+	if err == nil {
+		t.Error("Expected validation error for channel without base_url")
+	}
+}
@@ -0,0 +1,201 @@
+package reconcile
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"gopkg.in/yaml.v3"
+)
+
+// watchDebounce coalesces the burst of events produced when Kubernetes swaps
+// the ..data symlink of a mounted ConfigMap or Secret
+const watchDebounce = 500 * time.Millisecond
+
+// envReference matches ${VAR} references expanded from the environment
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// Watcher keeps the database in sync with state files in a directory, such
+// as a ConfigMap or Secret mounted into the gateway pod. Every change to the
+// directory triggers a full reconcile of the merged state.
+type Watcher struct {
+	reconciler *Reconciler
+	dir        string
+	watcher    *fsnotify.Watcher
+	stopCh     chan struct{}
+	doneCh     chan struct{}
+}
+
+// NewWatcher creates a new state directory watcher
+func NewWatcher(reconciler *Reconciler, dir string) *Watcher {
+	return &Watcher{
+		reconciler: reconciler,
+		dir:        dir,
+		stopCh:     make(chan struct{}),
+		doneCh:     make(chan struct{}),
+	}
+}
+
+// Start reconciles the current directory contents and begins watching for changes
+func (w *Watcher) Start() error {
+	if _, err := w.Sync(); err != nil {
+		return err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create watcher: %w", err)
+	}
+	if err := watcher.Add(w.dir); err != nil {
+		watcher.Close()
+		return fmt.Errorf("failed to watch %s: %w", w.dir, err)
+	}
+	w.watcher = watcher
+
+	go w.loop()
+	return nil
+}
+
+// Stop stops watching the directory
+func (w *Watcher) Stop() {
+	if w.watcher == nil {
+		return
+	}
+	close(w.stopCh)
+	<-w.doneCh
+	w.watcher.Close()
+}
+
+// Sync loads the state directory and applies it
+func (w *Watcher) Sync() ([]Change, error) {
+	desired, err := LoadStateDir(w.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := w.reconciler.Apply(desired)
+	if err != nil {
+		return changes, err
+	}
+
+	for _, change := range changes {
+		log.Printf("State sync: %s %s %q", change.Action, change.Kind, change.Name)
+	}
+	return changes, nil
+}
+
+// loop waits for directory events and resyncs once they settle
+func (w *Watcher) loop() {
+	defer close(w.doneCh)
+
+	timer := time.NewTimer(watchDebounce)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case _, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			timer.Reset(watchDebounce)
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("State watcher error: %v", err)
+		case <-timer.C:
+			if _, err := w.Sync(); err != nil {
+				log.Printf("State sync failed: %v", err)
+			}
+		case <-w.stopCh:
+			return
+		}
+	}
+}
+
+// LoadStateDir reads every .yaml, .yml and .json file in a directory and
+// merges them into a single state. Hidden entries, including the ..data
+// links Kubernetes creates for mounted volumes, are skipped. ${VAR}
+// references are expanded from the environment so API keys can be injected
+// from Secrets.
+func LoadStateDir(dir string) (*State, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state directory: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		switch strings.ToLower(filepath.Ext(name)) {
+		case ".yaml", ".yml", ".json":
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	merged := &State{}
+	for _, name := range names {
+		state, err := LoadStateFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		if state.Channels != nil {
+			merged.Channels = append(nonNil(merged.Channels), state.Channels...)
+		}
+		if state.Models != nil {
+			merged.Models = append(nonNil(merged.Models), state.Models...)
+		}
+		if state.Users != nil {
+			merged.Users = append(nonNil(merged.Users), state.Users...)
+		}
+	}
+
+	return merged, nil
+}
+
+// LoadStateFile decodes a single YAML or JSON state file, expanding ${VAR}
+// references from the environment. YAML is a superset of JSON, so both are
+// decoded as YAML and then mapped onto the JSON field names used by the
+// state API.
+func LoadStateFile(path string) (*State, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	data = envReference.ReplaceAllFunc(data, func(ref []byte) []byte {
+		return []byte(os.Getenv(string(ref[2 : len(ref)-1])))
+	})
+
+	var doc any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %w", path, err)
+	}
+
+	state := &State{}
+	if doc == nil {
+		return state, nil
+	}
+
+	encoded, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %w", path, err)
+	}
+	if err := json.Unmarshal(encoded, state); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %w", path, err)
+	}
+
+	return state, nil
+}
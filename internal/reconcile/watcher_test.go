@@ -0,0 +1,63 @@
+package reconcile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadStateDir(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TEST_OPENAI_KEY", "sk-from-secret")
+
+	files := map[string]string{
+		"channels.yaml": `
+channels:
+  - name: openai
+    base_url: https://api.openai.com
+    api_key: ${TEST_OPENAI_KEY}
+`,
+		"models.json":  `{"models": [{"name": "gpt-4", "channels": [{"channel": "openai", "backend_model_name": "gpt-4"}]}]}`,
+		"users.yaml":   "users: []\n",
+		"README.txt":   "ignored",
+		".hidden.yaml": "channels:\n  - name: hidden\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	state, err := LoadStateDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to load state directory: %v", err)
+	}
+
+	if len(state.Channels) != 1 || state.Channels[0].APIKey != "sk-from-secret" {
+		t.Errorf("Unexpected channels: %+v", state.Channels)
+	}
+	if len(state.Models) != 1 || state.Models[0].Channels[0].BackendModelName != "gpt-4" {
+		t.Errorf("Unexpected models: %+v", state.Models)
+	}
+	if state.Users == nil || len(state.Users) != 0 {
+		t.Errorf("Expected empty but managed users section, got %#v", state.Users)
+	}
+}
+
+func TestLoadStateDirOmittedSections(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "state.yaml"), []byte("channels: []\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write state file: %v", err)
+	}
+
+	state, err := LoadStateDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to load state directory: %v", err)
+	}
+	if state.Channels == nil {
+		t.Error("Channels section should be managed")
+	}
+	if state.Models != nil || state.Users != nil {
+		t.Error("Omitted sections should stay unmanaged")
+	}
+}
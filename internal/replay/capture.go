@@ -0,0 +1,200 @@
+// Package replay captures sanitized API requests to a log file and replays
+// them against another gateway, such as a staging instance, to validate
+// routing changes with production traffic before release
+package replay
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Headers replayed with a request. The session key is pseudonymized, and
+// credentials are never captured.
+const (
+	pinHeader        = "X-Gateway-Pin"
+	sessionKeyHeader = "X-Session-Key"
+)
+
+// Record is a captured request
+type Record struct {
+	Time   time.Time         `json:"time"`
+	Method string            `json:"method"`
+	Path   string            `json:"path"`
+	Header map[string]string `json:"header,omitempty"`
+	Body   json.RawMessage   `json:"body"`
+}
+
+// Options configures request capture
+type Options struct {
+	// File is the JSON Lines file records are appended to
+	File string
+	// SampleRate is the share of requests captured, from 0 to 1
+	SampleRate float64
+	// RedactContent replaces the text of prompts and messages with x's of
+	// the same length, keeping request sizes realistic
+	RedactContent bool
+}
+
+// Recorder appends sanitized requests to a capture file
+type Recorder struct {
+	opts Options
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewRecorder opens the capture file for appending
+func NewRecorder(opts Options) (*Recorder, error) {
+	file, err := os.OpenFile(opts.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open capture file: %w", err)
+	}
+	return &Recorder{opts: opts, file: file}, nil
+}
+
+// Close closes the capture file
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Close()
+}
+
+// Middleware captures a sample of JSON POST requests before they are
+// handled. Multipart uploads are not captured.
+func (r *Recorder) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodPost || strings.HasPrefix(c.ContentType(), "multipart/") || rand.Float64() >= r.opts.SampleRate {
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "failed to read request body"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		record, err := r.sanitize(c, body)
+		if err == nil {
+			err = r.write(record)
+		}
+		if err != nil {
+			log.Printf("Failed to capture request %s: %v", c.Request.URL.Path, err)
+		}
+		c.Next()
+	}
+}
+
+// sanitize builds the record of a request. The OpenAI "user" field and the
+// session key are replaced with pseudonyms, and requests without a session
+// key get one derived from their user, so stickiness per user and end user
+// is reproduced on replay with a single API key.
+func (r *Recorder) sanitize(c *gin.Context, body []byte) (*Record, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, fmt.Errorf("request body is not a JSON object: %w", err)
+	}
+
+	var user string
+	if raw, ok := fields["user"]; ok {
+		if err := json.Unmarshal(raw, &user); err == nil && user != "" {
+			fields["user"], _ = json.Marshal(pseudonym(user))
+		}
+	}
+	if r.opts.RedactContent {
+		for _, name := range []string{"messages", "prompt", "input"} {
+			raw, ok := fields[name]
+			if !ok {
+				continue
+			}
+			var value any
+			if err := json.Unmarshal(raw, &value); err != nil {
+				return nil, fmt.Errorf("failed to redact %s: %w", name, err)
+			}
+			fields[name], _ = json.Marshal(redact(value))
+		}
+	}
+	sanitized, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	header := map[string]string{}
+	if pin := c.GetHeader(pinHeader); pin != "" {
+		header[pinHeader] = pin
+	}
+	switch key := c.GetHeader(sessionKeyHeader); {
+	case key != "":
+		header[sessionKeyHeader] = pseudonym(key)
+	case user == "":
+		header[sessionKeyHeader] = pseudonym("user:" + strconv.FormatInt(c.GetInt64("user_id"), 10))
+	}
+
+	return &Record{
+		Time:   time.Now().UTC(),
+		Method: c.Request.Method,
+		Path:   c.Request.URL.Path,
+		Header: header,
+		Body:   sanitized,
+	}, nil
+}
+
+// write appends a record to the capture file as one line
+func (r *Recorder) write(record *Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err = r.file.Write(line)
+	return err
+}
+
+// pseudonym replaces an identifier with a stable hash of it
+func pseudonym(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return "anon-" + hex.EncodeToString(sum[:8])
+}
+
+// redactKeep lists the fields whose strings describe a message rather than
+// hold its content, and are kept by redact
+var redactKeep = map[string]bool{"role": true, "type": true, "name": true, "id": true, "tool_call_id": true, "detail": true}
+
+// redact replaces every string in a decoded JSON value with x's of the same
+// length, except the fields in redactKeep. Numbers, such as token arrays,
+// are kept.
+func redact(value any) any {
+	switch v := value.(type) {
+	case string:
+		return strings.Repeat("x", len(v))
+	case []any:
+		for i := range v {
+			v[i] = redact(v[i])
+		}
+	case map[string]any:
+		for key, field := range v {
+			if !redactKeep[key] {
+				v[key] = redact(field)
+			}
+		}
+	}
+	return value
+}
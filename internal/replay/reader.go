@@ -0,0 +1,118 @@
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+)
+
+// pollInterval is how often a followed capture file is checked for new
+// records
+const pollInterval = 250 * time.Millisecond
+
+// Read sends the records of a capture file to out, in order, and closes out
+// when it returns. With follow it keeps reading records as they are appended
+// until ctx is cancelled, starting over when the file is truncated or
+// rotated. Malformed lines are logged and skipped.
+func Read(ctx context.Context, path string, follow bool, out chan<- Record) error {
+	defer close(out)
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open capture file: %w", err)
+	}
+	defer func() { file.Close() }()
+
+	reader := bufio.NewReader(file)
+	var partial []byte
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		offset += int64(len(line))
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to read capture file: %w", err)
+		}
+		if err != nil {
+			// A record being written may be read in parts
+			partial = append(partial, line...)
+			if !follow {
+				return send(ctx, partial, out)
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(pollInterval):
+			}
+			if reopened, err := reopen(path, file, offset); err != nil {
+				return err
+			} else if reopened != nil {
+				file.Close()
+				file, offset, partial = reopened, 0, nil
+				reader.Reset(file)
+			}
+			continue
+		}
+
+		line = append(partial, line...)
+		partial = nil
+		if err := send(ctx, line, out); err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// reopen opens the capture file again when it was replaced or truncated
+// since it was opened as file, which has been read up to offset. It returns
+// nil when the file is unchanged.
+func reopen(path string, file *os.File, offset int64) (*os.File, error) {
+	current, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		// Rotated, and not created again yet
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat capture file: %w", err)
+	}
+	opened, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat capture file: %w", err)
+	}
+	if os.SameFile(current, opened) && current.Size() >= offset {
+		return nil, nil
+	}
+
+	reopened, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open capture file: %w", err)
+	}
+	log.Printf("Capture file %s was rotated or truncated, reading it from the start", path)
+	return reopened, nil
+}
+
+// send decodes a line and sends its record to out
+func send(ctx context.Context, line []byte, out chan<- Record) error {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 {
+		return nil
+	}
+	var record Record
+	if err := json.Unmarshal(line, &record); err != nil {
+		log.Printf("Skipping malformed capture record: %v", err)
+		return nil
+	}
+	select {
+	case out <- record:
+	case <-ctx.Done():
+	}
+	return nil
+}
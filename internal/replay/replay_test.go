@@ -0,0 +1,213 @@
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// capture posts body through a recorder writing to file and returns what
+// the handler received
+func capture(t *testing.T, rec *Recorder, body string, header map[string]string) string {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", int64(7)) })
+	r.Use(rec.Middleware())
+	var received string
+	r.POST("/v1/chat/completions", func(c *gin.Context) {
+		b, _ := io.ReadAll(c.Request.Body)
+		received = string(b)
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	return received
+}
+
+// readAll reads every record of a capture file
+func readAll(t *testing.T, file string) []Record {
+	t.Helper()
+	out := make(chan Record)
+	read := make(chan error, 1)
+	go func() { read <- Read(context.Background(), file, false, out) }()
+	var records []Record
+	for record := range out {
+		records = append(records, record)
+	}
+	if err := <-read; err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func TestCaptureSanitizesRequests(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "capture.jsonl")
+	rec, err := NewRecorder(Options{File: file, SampleRate: 1, RedactContent: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rec.Close()
+
+	body := `{"model":"gpt-4o","user":"alice","messages":[{"role":"user","content":"secret plan"}]}`
+	received := capture(t, rec, body, map[string]string{"Authorization": "Bearer sk-live", "X-Gateway-Pin": "tenant-1"})
+	if received != body {
+		t.Errorf("Expected the handler to receive the original body, got %s", received)
+	}
+	capture(t, rec, `{"model":"text-embedding-3-small","input":["hello"]}`, nil)
+
+	records := readAll(t, file)
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(records))
+	}
+
+	chat := records[0]
+	if chat.Path != "/v1/chat/completions" || chat.Method != "POST" {
+		t.Errorf("Expected POST /v1/chat/completions, got %s %s", chat.Method, chat.Path)
+	}
+	if _, ok := chat.Header["Authorization"]; ok {
+		t.Error("Expected credentials not to be captured")
+	}
+	if chat.Header["X-Gateway-Pin"] != "tenant-1" {
+		t.Errorf("Expected the pin to be kept, got %v", chat.Header)
+	}
+	var fields struct {
+		Model    string `json:"model"`
+		User     string `json:"user"`
+		Messages []struct {
+			Role    string `json:"role"`
+			Content string `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(chat.Body, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if fields.Model != "gpt-4o" || fields.User != pseudonym("alice") {
+		t.Errorf("Expected the model kept and the user pseudonymized, got %+v", fields)
+	}
+	if m := fields.Messages[0]; m.Role != "user" || m.Content != "xxxxxxxxxxx" {
+		t.Errorf("Expected the content redacted and the role kept, got %+v", m)
+	}
+
+	// Without an end user, stickiness follows the gateway user
+	if key := records[1].Header["X-Session-Key"]; key != pseudonym("user:7") {
+		t.Errorf("Expected a session key derived from the user, got %q", key)
+	}
+	if !strings.Contains(string(records[1].Body), `"input":["xxxxx"]`) {
+		t.Errorf("Expected the input redacted, got %s", records[1].Body)
+	}
+}
+
+func TestReplaySendsRecordsToTarget(t *testing.T) {
+	var mu sync.Mutex
+	var got []*http.Request
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		got = append(got, r)
+		mu.Unlock()
+		if r.URL.Path == "/v1/embeddings" {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte("data: {}\n\ndata: [DONE]\n\n"))
+	}))
+	defer target.Close()
+
+	start := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	records := []Record{
+		{Time: start, Method: "POST", Path: "/v1/chat/completions", Header: map[string]string{"X-Session-Key": "anon-1"}, Body: json.RawMessage(`{"model":"gpt-4o"}`)},
+		{Time: start.Add(40 * time.Millisecond), Method: "POST", Path: "/v1/chat/completions", Body: json.RawMessage(`{"model":"gpt-4o"}`)},
+		{Time: start.Add(80 * time.Millisecond), Method: "POST", Path: "/v1/embeddings", Body: json.RawMessage(`{"model":"e"}`)},
+	}
+	in := make(chan Record, len(records))
+	for _, record := range records {
+		in <- record
+	}
+	close(in)
+
+	began := time.Now()
+	summary := NewReplayer(ReplayOptions{Target: target.URL + "/", APIKey: "sk-staging", Speed: 2, Concurrency: 2}).Run(context.Background(), in)
+	if elapsed := time.Since(began); elapsed < 40*time.Millisecond {
+		t.Errorf("Expected the recorded pace halved by speed 2, took %s", elapsed)
+	}
+
+	if summary.Sent != 3 || summary.Failed != 0 {
+		t.Errorf("Expected 3 requests sent without failures, got %+v", summary)
+	}
+	if summary.Statuses[http.StatusOK] != 2 || summary.Statuses[http.StatusTooManyRequests] != 1 {
+		t.Errorf("Expected 2 OK and 1 rate limited, got %v", summary.Statuses)
+	}
+	if summary.Max < summary.P50 {
+		t.Errorf("Expected max latency at least p50, got %+v", summary)
+	}
+
+	for _, r := range got {
+		if auth := r.Header.Get("Authorization"); auth != "Bearer sk-staging" {
+			t.Errorf("Expected the staging key, got %q", auth)
+		}
+	}
+	if key := got[0].Header.Get("X-Session-Key"); key != "anon-1" {
+		t.Errorf("Expected the session key replayed, got %q", key)
+	}
+}
+
+func TestReadFollowsAppendedRecords(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "capture.jsonl")
+	if err := os.WriteFile(file, []byte(`{"path":"/v1/a","body":{}}`+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out := make(chan Record)
+	read := make(chan error, 1)
+	go func() { read <- Read(ctx, file, true, out) }()
+
+	if record := <-out; record.Path != "/v1/a" {
+		t.Fatalf("Expected the existing record, got %q", record.Path)
+	}
+
+	// A record written in two parts is read whole
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.WriteString(`{"path":"/v1/b",`)
+	time.Sleep(2 * pollInterval)
+	f.WriteString(`"body":{}}` + "\n")
+	if record := <-out; record.Path != "/v1/b" {
+		t.Fatalf("Expected the appended record, got %q", record.Path)
+	}
+
+	// A truncated file is read from the start
+	if err := os.WriteFile(file, []byte(`{"path":"/v1/c","body":{}}`+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if record := <-out; record.Path != "/v1/c" {
+		t.Fatalf("Expected the record of the truncated file, got %q", record.Path)
+	}
+
+	cancel()
+	if err := <-read; err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-out; ok {
+		t.Error("Expected the records channel closed")
+	}
+}
@@ -0,0 +1,188 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReplayOptions configures a replay
+type ReplayOptions struct {
+	// Target is the base URL of the gateway replayed against, e.g.
+	// https://staging.example.com
+	Target string
+	// APIKey authenticates every replayed request
+	APIKey string
+	// Rate is the number of requests sent per second. Zero keeps the
+	// recorded pace, scaled by Speed.
+	Rate float64
+	// Speed multiplies the recorded pace when Rate is zero
+	Speed float64
+	// Concurrency caps the requests in flight; sending waits for a slot
+	Concurrency int
+	// Client sends the requests. Responses are read to the end, so streams
+	// are replayed in full.
+	Client *http.Client
+}
+
+// Summary describes the outcome of a replay
+type Summary struct {
+	// Sent counts the requests sent, and Failed those that got no
+	// response
+	Sent   int
+	Failed int
+	// Statuses counts the responses by status code
+	Statuses map[int]int
+	// P50, P95 and Max are response latencies, read to the end
+	P50, P95, Max time.Duration
+}
+
+// Replayer sends captured requests to a gateway
+type Replayer struct {
+	opts ReplayOptions
+	now  func() time.Time
+}
+
+// NewReplayer creates a replayer
+func NewReplayer(opts ReplayOptions) *Replayer {
+	opts.Target = strings.TrimSuffix(opts.Target, "/")
+	if opts.Speed <= 0 {
+		opts.Speed = 1
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Minute}
+	}
+	return &Replayer{opts: opts, now: time.Now}
+}
+
+// Run replays the records received from in until in is closed or ctx is
+// cancelled, and waits for the requests in flight
+func (r *Replayer) Run(ctx context.Context, in <-chan Record) *Summary {
+	var (
+		mu        sync.Mutex
+		wg        sync.WaitGroup
+		latencies []time.Duration
+		summary   = &Summary{Statuses: map[int]int{}}
+	)
+	slots := make(chan struct{}, r.opts.Concurrency)
+
+	var first time.Time
+	start := r.now()
+loop:
+	for sent := 0; ; sent++ {
+		var record Record
+		select {
+		case <-ctx.Done():
+			break loop
+		case rec, ok := <-in:
+			if !ok {
+				break loop
+			}
+			record = rec
+		}
+
+		if sent == 0 {
+			first = record.Time
+		}
+		if !r.wait(ctx, start, r.due(sent, first, record.Time)) {
+			break
+		}
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			break loop
+		}
+
+		wg.Add(1)
+		go func() {
+			defer func() { <-slots; wg.Done() }()
+			status, latency, err := r.send(ctx, record)
+
+			mu.Lock()
+			defer mu.Unlock()
+			summary.Sent++
+			if err != nil {
+				summary.Failed++
+				return
+			}
+			summary.Statuses[status]++
+			latencies = append(latencies, latency)
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	summary.P50 = percentile(latencies, 0.50)
+	summary.P95 = percentile(latencies, 0.95)
+	summary.Max = percentile(latencies, 1)
+	return summary
+}
+
+// due returns when the nth record is sent, relative to the start of the
+// replay: at the fixed rate, or at its recorded offset from the first
+// record scaled by speed
+func (r *Replayer) due(n int, first, recorded time.Time) time.Duration {
+	if r.opts.Rate > 0 {
+		return time.Duration(float64(n) / r.opts.Rate * float64(time.Second))
+	}
+	return time.Duration(float64(recorded.Sub(first)) / r.opts.Speed)
+}
+
+// wait sleeps until due after start. It returns false when ctx is cancelled.
+func (r *Replayer) wait(ctx context.Context, start time.Time, due time.Duration) bool {
+	delay := due - r.now().Sub(start)
+	if delay <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// send replays a record and reads the response to the end, returning its
+// status and how long it took
+func (r *Replayer) send(ctx context.Context, record Record) (int, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, record.Method, r.opts.Target+record.Path, bytes.NewReader(record.Body))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+r.opts.APIKey)
+	for name, value := range record.Header {
+		req.Header.Set(name, value)
+	}
+
+	start := r.now()
+	resp, err := r.opts.Client.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return 0, 0, err
+	}
+	return resp.StatusCode, r.now().Sub(start), nil
+}
+
+// percentile returns the p-th percentile of sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(p*float64(len(sorted))+0.5) - 1
+	return sorted[max(0, min(i, len(sorted)-1))]
+}
@@ -0,0 +1,94 @@
+package router
+
+import "github.com/X0Ken/openai-gateway/pkg/database"
+
+// ColdStartOptions configures how channels without enough metrics are
+// scored. Until it has served Observations requests, a channel is scored
+// with a blend of its own metrics and the average of its peers', and its
+// share of new sessions is capped.
+type ColdStartOptions struct {
+	// Observations is the number of requests after which a channel is
+	// scored on its own metrics alone
+	Observations int64
+	// Bonus scales the score a cold channel borrows from its peers, so it is
+	// explored sooner; 1 borrows it unchanged
+	Bonus float64
+	// MaxShare caps the fraction of new sessions a cold channel may get
+	// while warm channels can take them
+	MaxShare float64
+}
+
+// SetColdStart enables cold-start protection for new channels. Without it
+// a channel without metrics is scored on its weight alone.
+func (e *Engine) SetColdStart(opts ColdStartOptions) {
+	e.coldStart = &opts
+}
+
+// candidate is a channel being scored for selection
+type candidate struct {
+	// score is the channel's score before its metrics are applied
+	score float64
+	// factor scales score by the channel's latency and error rate
+	factor float64
+	// observations is the number of requests the metrics are based on
+	observations int64
+}
+
+// newCandidate scores a channel whose base score is score
+func newCandidate(score float64, metrics *database.ChannelMetrics) candidate {
+	c := candidate{score: score, factor: metricsFactor(metrics)}
+	if metrics != nil {
+		c.observations = metrics.RequestCount
+	}
+	return c
+}
+
+// finalScores applies each candidate's metrics, blending in the average
+// factor of warm candidates and capping the share of cold ones under
+// cold-start protection
+func (e *Engine) finalScores(candidates []candidate) []float64 {
+	scores := make([]float64, len(candidates))
+	opts := e.coldStart
+	if opts == nil {
+		for i, c := range candidates {
+			scores[i] = c.score * c.factor
+		}
+		return scores
+	}
+
+	// Cold channels borrow the average factor of warm ones
+	prior, warm := 0.0, 0
+	for _, c := range candidates {
+		if c.observations >= opts.Observations {
+			prior += c.factor
+			warm++
+		}
+	}
+	if warm > 0 {
+		prior /= float64(warm)
+	} else {
+		prior = 1
+	}
+
+	var cold []int
+	warmTotal := 0.0
+	for i, c := range candidates {
+		if c.observations >= opts.Observations {
+			scores[i] = c.score * c.factor
+			warmTotal += scores[i]
+			continue
+		}
+		seen := float64(c.observations) / float64(opts.Observations)
+		scores[i] = c.score * (seen*c.factor + (1-seen)*prior*opts.Bonus)
+		cold = append(cold, i)
+	}
+
+	// Cap each cold channel's share against the warm channels
+	if warm > 0 && opts.MaxShare > 0 && opts.MaxShare < 1 {
+		limit := warmTotal * opts.MaxShare / (1 - opts.MaxShare)
+		for _, i := range cold {
+			scores[i] = min(scores[i], limit)
+		}
+	}
+	return scores
+}
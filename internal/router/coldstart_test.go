@@ -0,0 +1,42 @@
+package router
+
+import (
+	"math"
+	"testing"
+)
+
+func TestColdStartScores(t *testing.T) {
+	e := &Engine{}
+	e.SetColdStart(ColdStartOptions{Observations: 10, Bonus: 1.5, MaxShare: 0.2})
+
+	warm := candidate{score: 10, factor: 0.5, observations: 100}
+
+	// A new channel borrows the warm average with the bonus, but its share
+	// is capped
+	scores := e.finalScores([]candidate{warm, {score: 10, factor: 1}})
+	if scores[0] != 5 {
+		t.Errorf("Expected warm score 5, got %v", scores[0])
+	}
+	if want := 5 * 0.2 / 0.8; math.Abs(scores[1]-want) > 1e-9 {
+		t.Errorf("Expected cold score capped at %v, got %v", want, scores[1])
+	}
+
+	// Its own metrics weigh in as it is observed
+	scores = e.finalScores([]candidate{warm, warm, {score: 1, factor: 0.1, observations: 5}})
+	if want := 0.5*0.1 + 0.5*0.5*1.5; math.Abs(scores[2]-want) > 1e-9 {
+		t.Errorf("Expected blended score %v, got %v", want, scores[2])
+	}
+
+	// Without warm channels there is nothing to cap against
+	scores = e.finalScores([]candidate{{score: 10, factor: 1}, {score: 10, factor: 1}})
+	if scores[0] != 15 || scores[1] != 15 {
+		t.Errorf("Expected uncapped scores of 15, got %v", scores)
+	}
+
+	// Without cold-start protection metrics are applied as measured
+	e.coldStart = nil
+	scores = e.finalScores([]candidate{warm, {score: 10, factor: 1}})
+	if scores[0] != 5 || scores[1] != 10 {
+		t.Errorf("Expected scores 5 and 10, got %v", scores)
+	}
+}
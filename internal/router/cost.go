@@ -0,0 +1,124 @@
+package router
+
+import (
+	"log"
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// maxLatencySamples bounds the memory used by a cost policy's window
+const maxLatencySamples = 10000
+
+// CostPolicyOptions configures a CostPolicy
+type CostPolicyOptions struct {
+	// LatencyTarget is the p95 latency above which routing favours speed
+	LatencyTarget time.Duration
+	// RecoverRatio is the fraction of LatencyTarget the p95 must fall below
+	// before routing favours cost again, so the policy does not flap
+	RecoverRatio float64
+	// Window is how far back latencies are considered
+	Window time.Duration
+	// MinSamples is the number of latencies needed before the mode changes
+	MinSamples int
+}
+
+// latencySample is one observed request latency
+type latencySample struct {
+	at      time.Time
+	latency time.Duration
+}
+
+// CostPolicy switches routing between an economy mode, which prefers cheaper
+// channels while the gateway's p95 latency has headroom below the target, and
+// a performance mode, which prefers faster channels once the target is
+// breached. The p95 is taken over all requests in a sliding window.
+type CostPolicy struct {
+	opts CostPolicyOptions
+
+	mu          sync.Mutex
+	samples     []latencySample
+	performance bool
+}
+
+// NewCostPolicy creates a cost policy, starting in economy mode
+func NewCostPolicy(opts CostPolicyOptions) *CostPolicy {
+	return &CostPolicy{opts: opts}
+}
+
+// Observe records a request latency
+func (p *CostPolicy) Observe(latency time.Duration, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.samples = append(p.samples, latencySample{at: now, latency: latency})
+	if len(p.samples) > maxLatencySamples {
+		p.samples = slices.Delete(p.samples, 0, len(p.samples)-maxLatencySamples)
+	}
+}
+
+// Economy reports whether routing should currently prefer cheaper channels,
+// re-evaluating the mode against the window's p95 latency
+func (p *CostPolicy) Economy(now time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	cutoff := now.Add(-p.opts.Window)
+	i := 0
+	for i < len(p.samples) && p.samples[i].at.Before(cutoff) {
+		i++
+	}
+	p.samples = slices.Delete(p.samples, 0, i)
+
+	if len(p.samples) < p.opts.MinSamples || len(p.samples) == 0 {
+		return !p.performance
+	}
+
+	p95 := p.percentile(0.95)
+	switch {
+	case !p.performance && p95 > p.opts.LatencyTarget:
+		p.performance = true
+		log.Printf("Routing favours faster channels: p95 latency %v exceeds target %v", p95, p.opts.LatencyTarget)
+	case p.performance && float64(p95) < float64(p.opts.LatencyTarget)*p.opts.RecoverRatio:
+		p.performance = false
+		log.Printf("Routing favours cheaper channels: p95 latency %v recovered below target %v", p95, p.opts.LatencyTarget)
+	}
+	return !p.performance
+}
+
+// percentile returns the nearest-rank percentile of the window's latencies.
+// Must be called with p.mu held.
+func (p *CostPolicy) percentile(q float64) time.Duration {
+	latencies := make([]time.Duration, len(p.samples))
+	for i, s := range p.samples {
+		latencies[i] = s.latency
+	}
+	slices.Sort(latencies)
+
+	rank := int(math.Ceil(q*float64(len(latencies)))) - 1
+	return latencies[max(rank, 0)]
+}
+
+// SetCostPolicy enables cost-optimized routing
+func (e *Engine) SetCostPolicy(policy *CostPolicy) {
+	e.costPolicy = policy
+}
+
+// ObserveLatency records a request latency for the cost policy, if enabled
+func (e *Engine) ObserveLatency(latency time.Duration) {
+	if e.costPolicy != nil {
+		e.costPolicy.Observe(latency, time.Now())
+	}
+}
+
+// costFactor scales a channel's score in economy mode by how its cost
+// compares to the cheapest candidate's: the cheapest keeps its score and a
+// channel twice as expensive has it halved. Channels without a cost are left
+// unscaled.
+func costFactor(cost, minCost float64) float64 {
+	if cost <= 0 || minCost <= 0 {
+		return 1
+	}
+	return minCost / cost
+}
@@ -0,0 +1,116 @@
+package router
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+)
+
+func TestCostPolicyHysteresis(t *testing.T) {
+	policy := NewCostPolicy(CostPolicyOptions{
+		LatencyTarget: time.Second,
+		RecoverRatio:  0.5,
+		Window:        time.Minute,
+		MinSamples:    10,
+	})
+	now := time.Now()
+
+	observe := func(latency time.Duration, n int) {
+		for range n {
+			policy.Observe(latency, now)
+		}
+	}
+
+	// Too few samples keep the initial economy mode
+	observe(2*time.Second, 5)
+	if !policy.Economy(now) {
+		t.Fatal("Expected economy mode below min samples")
+	}
+
+	observe(2*time.Second, 5)
+	if policy.Economy(now) {
+		t.Fatal("Expected performance mode once p95 exceeds the target")
+	}
+
+	// Old samples age out of the window; a p95 below the target but above
+	// the recovery threshold keeps performance mode
+	now = now.Add(2 * time.Minute)
+	observe(700*time.Millisecond, 20)
+	if policy.Economy(now) {
+		t.Fatal("Expected performance mode to hold within the hysteresis band")
+	}
+
+	now = now.Add(2 * time.Minute)
+	observe(100*time.Millisecond, 20)
+	if !policy.Economy(now) {
+		t.Fatal("Expected economy mode once p95 recovers")
+	}
+}
+
+func TestCostFactor(t *testing.T) {
+	tests := []struct {
+		cost, minCost, want float64
+	}{
+		{1, 1, 1},
+		{2, 1, 0.5},
+		{0, 1, 1},
+		{3, 0, 1},
+	}
+	for _, tt := range tests {
+		if got := costFactor(tt.cost, tt.minCost); got != tt.want {
+			t.Errorf("costFactor(%v, %v) = %v, want %v", tt.cost, tt.minCost, got, tt.want)
+		}
+	}
+}
+
+func TestRouteWithCostPolicy(t *testing.T) {
+	dbPath := "/tmp/test_router_cost.db"
+	defer os.Remove(dbPath)
+
+	db, err := database.New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	model := &database.Model{Name: "gpt-4"}
+	db.CreateModel(model)
+
+	cheap := &database.Channel{Name: "cheap", BaseURL: "https://a.example.com", APIKey: "sk-a", Weight: 10, Enabled: true, Cost: 1}
+	fast := &database.Channel{Name: "fast", BaseURL: "https://b.example.com", APIKey: "sk-b", Weight: 10, Enabled: true, Cost: 1000000}
+	for _, ch := range []*database.Channel{cheap, fast} {
+		db.CreateChannel(ch)
+		db.AddModelChannel(&database.ModelChannel{ModelID: model.ID, ChannelID: ch.ID, BackendModelName: "gpt-4", Weight: 10})
+	}
+	db.UpdateChannelMetrics(cheap.ID, 100, true)
+	db.UpdateChannelMetrics(fast.ID, 0.01, true)
+
+	engine := NewEngine(db)
+	engine.SetCostPolicy(NewCostPolicy(CostPolicyOptions{LatencyTarget: time.Second, RecoverRatio: 0.8, Window: time.Minute, MinSamples: 1}))
+
+	countFast := func(firstUser int64) int {
+		n := 0
+		for userID := firstUser; userID < firstUser+20; userID++ {
+			result, err := engine.Route(userID, "gpt-4")
+			if err != nil {
+				t.Fatalf("Failed to route: %v", err)
+			}
+			if result.Channel.ID == fast.ID {
+				n++
+			}
+		}
+		return n
+	}
+
+	// In economy mode the millionfold cost outweighs the latency advantage
+	if n := countFast(1); n > 2 {
+		t.Errorf("Expected economy mode to favour the cheap channel, got %d/20 on fast", n)
+	}
+
+	engine.ObserveLatency(5 * time.Second)
+	if n := countFast(100); n < 18 {
+		t.Errorf("Expected performance mode to favour the fast channel, got %d/20 on fast", n)
+	}
+}
@@ -2,41 +2,95 @@ package router
 
 import (
 	"errors"
-	"math/rand"
 	"time"
 
 	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/X0Ken/openai-gateway/pkg/store"
 )
 
 // Engine handles intelligent routing with multi-factor scoring
 type Engine struct {
 	db *database.DB
+	// sessions and metrics hold sticky sessions and channel metrics, in the
+	// database unless shared stores are set
+	sessions  store.Sessions
+	metrics   store.Metrics
+	penalties penalties
+	// preferPrevious routes a user without a session back to the channel
+	// recorded in their history when it can still serve the model
+	preferPrevious bool
+	// costPolicy, when set, trades cost against latency in channel selection
+	costPolicy *CostPolicy
+	// incidents, when set, reports channels of providers with a declared incident
+	incidents IncidentSource
+	// health reports channels to keep out of routing
+	health []HealthSource
+	// rand draws weighted selections; debug logs each draw
+	rand  Rand
+	debug bool
+	// coldStart, when set, limits the trust given to channels without
+	// enough metrics
+	coldStart *ColdStartOptions
 }
 
 // NewEngine creates a new routing engine
 func NewEngine(db *database.DB) *Engine {
-	return &Engine{db: db}
+	return &Engine{db: db, sessions: db, metrics: db, rand: newDefaultRand()}
+}
+
+// SetStores keeps sticky sessions and channel metrics in the given stores,
+// such as ones shared by the replicas of a cluster
+func (e *Engine) SetStores(sessions store.Sessions, metrics store.Metrics) {
+	e.sessions = sessions
+	e.metrics = metrics
+}
+
+// SetPreferPreviousChannel makes new sessions reuse the channel a user was
+// last routed to, for continuity across session expiry
+func (e *Engine) SetPreferPreviousChannel(enabled bool) {
+	e.preferPrevious = enabled
 }
 
 // RouteResult represents the result of a routing decision
 type RouteResult struct {
 	Channel          *database.Channel
+	Model            *database.Model
 	BackendModelName string
+	StreamMode       string
 	SessionID        int64
 	IsNew            bool
+	// Rule names the routing rule that chose the channel, if any
+	Rule string
+	// Pinned is set when the channel was chosen by the request's pin
+	Pinned bool
 }
 
 // channelMapping represents a channel with its model mapping details
 type channelMapping struct {
 	channel          *database.Channel
 	backendModelName string
+	streamMode       string
 	weight           int
 }
 
-// Route selects the best channel for a request
+// Route selects the best channel for a request without known attributes
 func (e *Engine) Route(userID int64, model string) (*RouteResult, error) {
-	// First, check for existing session (sticky routing)
-	session, err := e.db.GetSessionByUser(userID)
+	return e.RouteRequest(userID, model, Attributes{})
+}
+
+// RouteRequest selects the best channel for a request. A matching routing
+// rule takes precedence over attrs.Pin, which takes precedence over the
+// sticky session of the user, or of the end user given by attrs.SessionKey.
+func (e *Engine) RouteRequest(userID int64, model string, attrs Attributes) (*RouteResult, error) {
+	if result, err := e.routeByRules(userID, model, attrs); result != nil || err != nil {
+		return result, err
+	}
+	if attrs.Pin != "" {
+		return e.routeByPin(model, attrs)
+	}
+
+	// Check for existing session (sticky routing)
+	session, err := e.sessions.GetSessionByKey(userID, attrs.SessionKey)
 	if err != nil {
 		return nil, err
 	}
@@ -48,7 +102,16 @@ func (e *Engine) Route(userID int64, model string) (*RouteResult, error) {
 			return nil, err
 		}
 
-		if channel != nil && channel.Enabled {
+		// A session on an unhealthy channel is dropped, so the user moves to
+		// another channel rather than returning to it on the next request
+		if channel != nil && e.unhealthy(channel) {
+			if err := e.sessions.DeleteSession(session.ID); err != nil {
+				return nil, err
+			}
+			channel = nil
+		}
+
+		if channel != nil && channel.Enabled && !channel.AuthFailed() && !channel.TestOnly && !attrs.excludes(channel.ID) {
 			// Get the model object by name to find its ID
 			modelObj, err := e.db.GetModelByName(model)
 			if err != nil {
@@ -63,10 +126,12 @@ func (e *Engine) Route(userID int64, model string) (*RouteResult, error) {
 				for _, mc := range modelChannels {
 					if mc.ModelID == modelObj.ID {
 						// Update session last used time
-						e.db.UpdateSessionLastUsed(session.ID)
+						e.sessions.UpdateSessionLastUsed(session.ID)
 						return &RouteResult{
 							Channel:          channel,
+							Model:            modelObj,
 							BackendModelName: mc.BackendModelName,
+							StreamMode:       mc.StreamMode,
 							SessionID:        session.ID,
 							IsNew:            false,
 						}, nil
@@ -77,102 +142,177 @@ func (e *Engine) Route(userID int64, model string) (*RouteResult, error) {
 	}
 
 	// No valid session, find model by name
-	modelObj, err := e.db.GetModelByName(model)
+	modelObj, mappings, err := e.candidates(model, attrs)
 	if err != nil {
 		return nil, err
 	}
+
+	// Prefer the user's previous channel, otherwise score and select the
+	// best channel using mapping weights. History is kept per API key, so
+	// it does not apply to end-user sessions.
+	var bestMapping channelMapping
+	var ok bool
+	if attrs.SessionKey == "" {
+		bestMapping, ok, err = e.previousMapping(userID, mappings)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !ok {
+		bestMapping = e.selectBestMapping(mappings)
+	}
+
+	// Create new session
+	newSession := &database.Session{
+		UserID:     userID,
+		SessionKey: attrs.SessionKey,
+		ChannelID:  bestMapping.channel.ID,
+	}
+	if err := e.sessions.CreateSession(newSession); err != nil {
+		return nil, err
+	}
+	if attrs.SessionKey == "" {
+		if err := e.db.RecordUserChannel(userID, bestMapping.channel.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return &RouteResult{
+		Channel:          bestMapping.channel,
+		Model:            modelObj,
+		BackendModelName: bestMapping.backendModelName,
+		StreamMode:       bestMapping.streamMode,
+		SessionID:        newSession.ID,
+		IsNew:            true,
+	}, nil
+}
+
+// candidates returns a model and the mappings of its channels that may take
+// a new request: routable and not excluded, leaving out unhealthy channels
+// unless no other is left
+func (e *Engine) candidates(model string, attrs Attributes) (*database.Model, []channelMapping, error) {
+	modelObj, err := e.db.GetModelByName(model)
+	if err != nil {
+		return nil, nil, err
+	}
 	if modelObj == nil {
-		return nil, errors.New("model not found: " + model)
+		return nil, nil, errors.New("model not found: " + model)
 	}
 
 	// Get all model-channel mappings for this model
 	modelChannels, err := e.db.GetModelChannelsByModel(modelObj.ID)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	if len(modelChannels) == 0 {
-		return nil, errors.New("no channels configured for model: " + model)
+		return nil, nil, errors.New("no channels configured for model: " + model)
 	}
 
-	// Get channel objects for each mapping
-	var mappings []channelMapping
+	// Get channel objects for each mapping, skipping channels that are not
+	// routable, and unhealthy ones unless no other is left
+	now := time.Now()
+	var mappings, unhealthy []channelMapping
 	for _, mc := range modelChannels {
 		channel, err := e.db.GetChannel(mc.ChannelID)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
+		}
+		if channel == nil || !routable(channel, now) || attrs.excludes(channel.ID) {
+			continue
 		}
-		if channel != nil && channel.Enabled {
-			mappings = append(mappings, channelMapping{
-				channel:          channel,
-				backendModelName: mc.BackendModelName,
-				weight:           mc.Weight,
-			})
+		mapping := channelMapping{
+			channel:          channel,
+			backendModelName: mc.BackendModelName,
+			streamMode:       mc.StreamMode,
+			weight:           mc.Weight,
+		}
+		if e.unhealthy(channel) {
+			unhealthy = append(unhealthy, mapping)
+		} else {
+			mappings = append(mappings, mapping)
 		}
 	}
+	if len(mappings) == 0 {
+		mappings = unhealthy
+	}
 
 	if len(mappings) == 0 {
-		return nil, errors.New("no suitable channel found for model: " + model)
+		return nil, nil, errors.New("no suitable channel found for model: " + model)
 	}
+	return modelObj, mappings, nil
+}
 
-	// Score and select best channel using mapping weights
-	bestMapping := e.selectBestMapping(mappings)
+// Available returns a model and the number of its channels that can take new
+// traffic, without routing a request or touching sessions. The model is nil
+// when it does not exist.
+func (e *Engine) Available(model string) (*database.Model, int, error) {
+	modelObj, err := e.db.GetModelByName(model)
+	if err != nil || modelObj == nil {
+		return nil, 0, err
+	}
 
-	// Create new session
-	newSession := &database.Session{
-		UserID:    userID,
-		ChannelID: bestMapping.channel.ID,
+	modelChannels, err := e.db.GetModelChannelsByModel(modelObj.ID)
+	if err != nil {
+		return nil, 0, err
 	}
-	if err := e.db.CreateSession(newSession); err != nil {
-		return nil, err
+	now := time.Now()
+	available := 0
+	for _, mc := range modelChannels {
+		channel, err := e.db.GetChannel(mc.ChannelID)
+		if err != nil {
+			return nil, 0, err
+		}
+		if channel != nil && routable(channel, now) {
+			available++
+		}
 	}
+	return modelObj, available, nil
+}
 
-	return &RouteResult{
-		Channel:          bestMapping.channel,
-		BackendModelName: bestMapping.backendModelName,
-		SessionID:        newSession.ID,
-		IsNew:            true,
-	}, nil
+// routable reports whether a channel may be chosen for new traffic: it is
+// enabled, not draining for maintenance, its credentials were not rejected
+// and it is not reserved for manual tests
+func routable(channel *database.Channel, now time.Time) bool {
+	return channel.Enabled && !channel.InMaintenance(now) && !channel.AuthFailed() && !channel.TestOnly
 }
 
-// selectBestChannel selects the best channel using weighted scoring
-func (e *Engine) selectBestChannel(channels []*database.Channel) *database.Channel {
-	if len(channels) == 1 {
-		return channels[0]
+// previousMapping returns the mapping of the channel the user was last routed
+// to, if preferring it is enabled and it is among the candidates
+func (e *Engine) previousMapping(userID int64, mappings []channelMapping) (channelMapping, bool, error) {
+	if !e.preferPrevious {
+		return channelMapping{}, false, nil
 	}
 
-	// Calculate scores for each channel
-	type scoredChannel struct {
-		channel *database.Channel
-		score   float64
+	history, err := e.db.GetUserChannelHistory(userID)
+	if err != nil || history == nil {
+		return channelMapping{}, false, err
 	}
 
-	var scored []scoredChannel
-	for _, ch := range channels {
-		score := e.calculateScore(ch)
-		scored = append(scored, scoredChannel{channel: ch, score: score})
+	for _, m := range mappings {
+		if m.channel.ID == history.ChannelID {
+			return m, true, nil
+		}
 	}
+	return channelMapping{}, false, nil
+}
 
-	// Weighted random selection based on scores
-	totalScore := 0.0
-	for _, sc := range scored {
-		totalScore += sc.score
+// selectBestChannel selects the best channel using weighted scoring
+func (e *Engine) selectBestChannel(channels []*database.Channel) *database.Channel {
+	if len(channels) == 1 {
+		return channels[0]
 	}
 
-	// Generate random value
-	r := rand.Float64() * totalScore
-
-	// Select channel based on weighted probability
-	cumulative := 0.0
-	for _, sc := range scored {
-		cumulative += sc.score
-		if r <= cumulative {
-			return sc.channel
-		}
+	// Calculate scores for each channel
+	names := make([]string, len(channels))
+	candidates := make([]candidate, len(channels))
+	for i, ch := range channels {
+		metrics, _ := e.metrics.GetChannelMetrics(ch.ID)
+		names[i], candidates[i] = ch.Name, newCandidate(e.baseScore(ch), metrics)
 	}
 
-	// Fallback to last channel
-	return scored[len(scored)-1].channel
+	// Weighted random selection based on scores
+	return channels[e.pickWeighted(names, e.finalScores(candidates))]
 }
 
 // selectBestMapping selects the best channel mapping using weighted scoring
@@ -181,68 +321,94 @@ func (e *Engine) selectBestMapping(mappings []channelMapping) channelMapping {
 		return mappings[0]
 	}
 
-	// Calculate scores for each mapping
-	type scoredMapping struct {
-		mapping channelMapping
-		score   float64
+	// Under a cost policy, prefer cheaper channels while latency has
+	// headroom and faster ones once it does not
+	economy, performance := false, false
+	if e.costPolicy != nil {
+		economy = e.costPolicy.Economy(time.Now())
+		performance = !economy
 	}
-
-	var scored []scoredMapping
+	minCost := 0.0
 	for _, m := range mappings {
-		score := e.calculateScore(m.channel)
-		// Factor in mapping weight
-		score *= float64(m.weight)
-		scored = append(scored, scoredMapping{mapping: m, score: score})
-	}
-
-	// Weighted random selection based on scores
-	totalScore := 0.0
-	for _, sc := range scored {
-		totalScore += sc.score
+		if cost := m.channel.Cost; cost > 0 && (minCost == 0 || cost < minCost) {
+			minCost = cost
+		}
 	}
 
-	// Generate random value
-	r := rand.Float64() * totalScore
-
-	// Select mapping based on weighted probability
-	cumulative := 0.0
-	for _, sc := range scored {
-		cumulative += sc.score
-		if r <= cumulative {
-			return sc.mapping
+	names := make([]string, len(mappings))
+	candidates := make([]candidate, len(mappings))
+	for i, m := range mappings {
+		score := e.baseScore(m.channel)
+		// Factor in mapping weight
+		score *= float64(m.weight)
+		if economy {
+			score *= costFactor(m.channel.Cost, minCost)
+		}
+		if performance {
+			score *= e.latencyFactor(m.channel.ID)
 		}
+		metrics, _ := e.metrics.GetChannelMetrics(m.channel.ID)
+		names[i], candidates[i] = m.channel.Name, newCandidate(score, metrics)
 	}
 
-	// Fallback to last mapping
-	return scored[len(scored)-1].mapping
+	// Weighted random selection based on scores
+	return mappings[e.pickWeighted(names, e.finalScores(candidates))]
 }
 
 // calculateScore calculates a composite score for a channel
 func (e *Engine) calculateScore(channel *database.Channel) float64 {
+	// Get metrics for this channel; without any, use weight only
+	metrics, _ := e.metrics.GetChannelMetrics(channel.ID)
+	return e.baseScore(channel) * metricsFactor(metrics)
+}
+
+// baseScore scores a channel on its weight and penalties, before metrics
+func (e *Engine) baseScore(channel *database.Channel) float64 {
 	// Base score from weight
 	score := float64(channel.Weight)
 
-	// Get metrics for this channel
-	metrics, err := e.db.GetChannelMetrics(channel.ID)
-	if err != nil || metrics == nil {
-		// No metrics yet, use weight only
-		return score
+	// Channels that were recently rate limited, or whose provider declared an
+	// incident, are avoided while the penalty lasts
+	if e.penalized(channel.ID, time.Now()) || e.inIncident(channel) {
+		score *= penaltyFactor
 	}
+	return score
+}
 
-	// Factor in latency (lower is better)
-	if metrics.LatencyAvg > 0 {
-		latencyFactor := 1.0 / (1.0 + metrics.LatencyAvg)
-		score *= latencyFactor
+// metricsFactor scales a score by a channel's latency and error rate, or is
+// 1 without metrics
+func metricsFactor(metrics *database.ChannelMetrics) float64 {
+	if metrics == nil {
+		return 1
 	}
 
+	// Factor in latency (lower is better)
+	factor := latencyFactorOf(metrics)
+
 	// Factor in error rate (lower is better)
 	errorFactor := 1.0 - metrics.ErrorRate
 	if errorFactor < 0.1 {
 		errorFactor = 0.1 // Minimum factor to avoid zero scores
 	}
-	score *= errorFactor
+	return factor * errorFactor
+}
 
-	return score
+// latencyFactorOf scales a score down as a channel's average latency grows
+func latencyFactorOf(metrics *database.ChannelMetrics) float64 {
+	if metrics == nil || metrics.LatencyAvg <= 0 {
+		return 1
+	}
+	return 1.0 / (1.0 + metrics.LatencyAvg)
+}
+
+// latencyFactor applies the latency factor again in performance mode, so
+// faster channels are favoured more strongly than by the base score
+func (e *Engine) latencyFactor(channelID int64) float64 {
+	metrics, err := e.metrics.GetChannelMetrics(channelID)
+	if err != nil {
+		return 1
+	}
+	return latencyFactorOf(metrics)
 }
 
 // contains checks if a string slice contains a value
@@ -254,8 +420,3 @@ func contains(slice []string, item string) bool {
 	}
 	return false
 }
-
-// init initializes the random seed
-func init() {
-	rand.Seed(time.Now().UnixNano())
-}
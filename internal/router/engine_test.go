@@ -3,6 +3,7 @@ package router
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/X0Ken/openai-gateway/pkg/database"
 )
@@ -84,3 +85,256 @@ func TestContains(t *testing.T) {
 		t.Error("Expected not to contain 'd'")
 	}
 }
+
+func TestRouteSkipsChannelsInMaintenance(t *testing.T) {
+	dbPath := "/tmp/test_router_maintenance.db"
+	defer os.Remove(dbPath)
+
+	db, err := database.New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	model := &database.Model{Name: "gpt-4"}
+	db.CreateModel(model)
+
+	until := time.Now().Add(time.Hour)
+	draining := &database.Channel{Name: "draining", BaseURL: "https://a.example.com", APIKey: "sk-a", Weight: 10, Enabled: true, MaintenanceUntil: &until}
+	active := &database.Channel{Name: "active", BaseURL: "https://b.example.com", APIKey: "sk-b", Weight: 10, Enabled: true}
+	for _, ch := range []*database.Channel{draining, active} {
+		db.CreateChannel(ch)
+		db.AddModelChannel(&database.ModelChannel{ModelID: model.ID, ChannelID: ch.ID, BackendModelName: "gpt-4", Weight: 10})
+	}
+
+	engine := NewEngine(db)
+	for userID := int64(1); userID <= 20; userID++ {
+		result, err := engine.Route(userID, "gpt-4")
+		if err != nil {
+			t.Fatalf("Failed to route: %v", err)
+		}
+		if result.Channel.ID != active.ID {
+			t.Fatalf("Expected new sessions on the active channel, got %s", result.Channel.Name)
+		}
+	}
+
+	// An expired maintenance window no longer drains the channel
+	past := time.Now().Add(-time.Minute)
+	draining.MaintenanceUntil = &past
+	db.UpdateChannel(draining)
+
+	retrieved, _ := db.GetChannel(draining.ID)
+	if retrieved.InMaintenance(time.Now()) {
+		t.Error("Expected maintenance window to have ended")
+	}
+}
+
+func TestPenalizeLowersScoreUntilExpiry(t *testing.T) {
+	dbPath := "/tmp/test_router_penalty.db"
+	defer os.Remove(dbPath)
+
+	db, err := database.New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	channel := &database.Channel{Name: "limited", BaseURL: "https://a.example.com", APIKey: "sk-a", Weight: 10, Enabled: true}
+	db.CreateChannel(channel)
+
+	engine := NewEngine(db)
+	base := engine.calculateScore(channel)
+
+	engine.Penalize(channel.ID, time.Minute)
+	if got := engine.calculateScore(channel); got >= base {
+		t.Errorf("Expected penalized score below %v, got %v", base, got)
+	}
+
+	// A shorter penalty does not cut an existing one short
+	engine.Penalize(channel.ID, time.Millisecond)
+	if !engine.penalized(channel.ID, time.Now().Add(time.Second)) {
+		t.Error("Expected the longer penalty to be kept")
+	}
+
+	if engine.penalized(channel.ID, time.Now().Add(2*time.Minute)) {
+		t.Error("Expected penalty to expire")
+	}
+}
+
+// incidentChannels is an incident source declaring incidents for named channels
+type incidentChannels map[string]bool
+
+func (i incidentChannels) Affected(channelName string) bool {
+	return i[channelName]
+}
+
+func TestIncidentLowersScore(t *testing.T) {
+	dbPath := "/tmp/test_router_incident.db"
+	defer os.Remove(dbPath)
+
+	db, err := database.New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	down := &database.Channel{Name: "openai-east", BaseURL: "https://a.example.com", APIKey: "sk-a", Weight: 10, Enabled: true}
+	up := &database.Channel{Name: "anthropic-main", BaseURL: "https://b.example.com", APIKey: "sk-b", Weight: 10, Enabled: true}
+	db.CreateChannel(down)
+	db.CreateChannel(up)
+
+	engine := NewEngine(db)
+	base := engine.calculateScore(down)
+
+	engine.SetIncidentSource(incidentChannels{"openai-east": true})
+	if got := engine.calculateScore(down); got >= base {
+		t.Errorf("Expected score below %v during an incident, got %v", base, got)
+	}
+	if got := engine.calculateScore(up); got != base {
+		t.Errorf("Expected unaffected channel to keep score %v, got %v", base, got)
+	}
+}
+
+func TestRoutePrefersPreviousChannel(t *testing.T) {
+	dbPath := "/tmp/test_router_previous.db"
+	defer os.Remove(dbPath)
+
+	db, err := database.New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	user := &database.User{APIKey: "test-key", Name: "Test User"}
+	db.CreateUser(user)
+
+	model := &database.Model{Name: "gpt-4"}
+	db.CreateModel(model)
+
+	previous := &database.Channel{Name: "previous", BaseURL: "https://a.example.com", APIKey: "sk-a", Weight: 1, Enabled: true}
+	preferred := &database.Channel{Name: "preferred", BaseURL: "https://b.example.com", APIKey: "sk-b", Weight: 1000000, Enabled: true}
+	for _, ch := range []*database.Channel{previous, preferred} {
+		db.CreateChannel(ch)
+		db.AddModelChannel(&database.ModelChannel{ModelID: model.ID, ChannelID: ch.ID, BackendModelName: "gpt-4", Weight: 10})
+	}
+	db.RecordUserChannel(user.ID, previous.ID)
+
+	engine := NewEngine(db)
+	engine.SetPreferPreviousChannel(true)
+
+	result, err := engine.Route(user.ID, "gpt-4")
+	if err != nil {
+		t.Fatalf("Failed to route: %v", err)
+	}
+	if result.Channel.ID != previous.ID || !result.IsNew {
+		t.Fatalf("Expected a new session on the previous channel, got %s", result.Channel.Name)
+	}
+
+	// Once the previous channel can no longer serve, the user is re-routed
+	// and the history follows
+	db.DeleteSession(result.SessionID)
+	previous.Enabled = false
+	db.UpdateChannel(previous)
+
+	result, err = engine.Route(user.ID, "gpt-4")
+	if err != nil {
+		t.Fatalf("Failed to route: %v", err)
+	}
+	if result.Channel.ID != preferred.ID {
+		t.Fatalf("Expected fallback to %s, got %s", preferred.Name, result.Channel.Name)
+	}
+	history, _ := db.GetUserChannelHistory(user.ID)
+	if history == nil || history.ChannelID != preferred.ID {
+		t.Errorf("Expected history to record channel %d, got %+v", preferred.ID, history)
+	}
+}
+
+func TestRouteSessionKeys(t *testing.T) {
+	dbPath := "/tmp/test_router_session_keys.db"
+	defer os.Remove(dbPath)
+
+	db, err := database.New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	user := &database.User{APIKey: "test-key", Name: "Platform"}
+	db.CreateUser(user)
+
+	model := &database.Model{Name: "gpt-4"}
+	db.CreateModel(model)
+
+	channel := &database.Channel{Name: "only", BaseURL: "https://a.example.com", APIKey: "sk-a", Weight: 10, Enabled: true}
+	db.CreateChannel(channel)
+	db.AddModelChannel(&database.ModelChannel{ModelID: model.ID, ChannelID: channel.ID, BackendModelName: "gpt-4", Weight: 10})
+
+	engine := NewEngine(db)
+
+	// Each end user gets its own session, even on the same channel
+	sessions := map[string]int64{}
+	for _, key := range []string{"", "alice", "bob"} {
+		result, err := engine.RouteRequest(user.ID, "gpt-4", Attributes{SessionKey: key})
+		if err != nil {
+			t.Fatalf("Failed to route %q: %v", key, err)
+		}
+		if !result.IsNew {
+			t.Errorf("Expected a new session for %q", key)
+		}
+		sessions[key] = result.SessionID
+	}
+
+	result, err := engine.RouteRequest(user.ID, "gpt-4", Attributes{SessionKey: "alice"})
+	if err != nil {
+		t.Fatalf("Failed to route: %v", err)
+	}
+	if result.IsNew || result.SessionID != sessions["alice"] {
+		t.Errorf("Expected alice's session %d to be reused, got %d", sessions["alice"], result.SessionID)
+	}
+
+	session, _ := db.GetSessionByKey(user.ID, "bob")
+	if session == nil || session.ID != sessions["bob"] || session.SessionKey != "bob" {
+		t.Errorf("Expected bob's session %d, got %+v", sessions["bob"], session)
+	}
+}
+
+func TestRouteExcludesChannels(t *testing.T) {
+	dbPath := "/tmp/test_router_exclude.db"
+	defer os.Remove(dbPath)
+
+	db, err := database.New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	user := &database.User{APIKey: "test-key", Name: "Test User"}
+	db.CreateUser(user)
+
+	model := &database.Model{Name: "gpt-4"}
+	db.CreateModel(model)
+
+	broken := &database.Channel{Name: "broken", BaseURL: "https://a.example.com", APIKey: "sk-a", Weight: 10, Enabled: true}
+	healthy := &database.Channel{Name: "healthy", BaseURL: "https://b.example.com", APIKey: "sk-b", Weight: 10, Enabled: true}
+	for _, ch := range []*database.Channel{broken, healthy} {
+		db.CreateChannel(ch)
+		db.AddModelChannel(&database.ModelChannel{ModelID: model.ID, ChannelID: ch.ID, BackendModelName: "gpt-4", Weight: 10})
+	}
+	db.CreateRoutingRule(&database.RoutingRule{Name: "pin", Priority: 1, Enabled: true, ChannelID: broken.ID})
+	db.CreateSession(&database.Session{UserID: user.ID, ChannelID: broken.ID})
+
+	engine := NewEngine(db)
+
+	// The rule and the sticky session both point at the excluded channel
+	result, err := engine.RouteRequest(user.ID, "gpt-4", Attributes{Exclude: []int64{broken.ID}})
+	if err != nil {
+		t.Fatalf("Failed to route: %v", err)
+	}
+	if result.Channel.ID != healthy.ID || result.Rule != "" || !result.IsNew {
+		t.Errorf("Expected a new session on %s, got %s (rule %q)", healthy.Name, result.Channel.Name, result.Rule)
+	}
+
+	if _, err := engine.RouteRequest(user.ID, "gpt-4", Attributes{Exclude: []int64{broken.ID, healthy.ID}}); err == nil {
+		t.Error("Expected an error with every channel excluded")
+	}
+}
@@ -0,0 +1,27 @@
+package router
+
+import "github.com/X0Ken/openai-gateway/pkg/database"
+
+// HealthSource reports channels that should not take traffic, such as
+// channels failing their health checks or with an open circuit breaker
+type HealthSource interface {
+	Unhealthy(channelID int64) bool
+}
+
+// AddHealthSource keeps channels the source reports unhealthy out of
+// routing. Sessions on an unhealthy channel are routed afresh; when every
+// channel of a model is unhealthy, they are used anyway rather than failing
+// every request.
+func (e *Engine) AddHealthSource(source HealthSource) {
+	e.health = append(e.health, source)
+}
+
+// unhealthy reports whether any health source reports a channel unhealthy
+func (e *Engine) unhealthy(channel *database.Channel) bool {
+	for _, source := range e.health {
+		if source.Unhealthy(channel.ID) {
+			return true
+		}
+	}
+	return false
+}
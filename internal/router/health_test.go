@@ -0,0 +1,59 @@
+package router
+
+import (
+	"os"
+	"testing"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+)
+
+// unhealthyChannels is a health source failing channels by ID
+type unhealthyChannels map[int64]bool
+
+func (u unhealthyChannels) Unhealthy(channelID int64) bool {
+	return u[channelID]
+}
+
+func TestRouteSkipsUnhealthyChannels(t *testing.T) {
+	dbPath := "/tmp/test_router_health.db"
+	defer os.Remove(dbPath)
+
+	db, err := database.New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	user := &database.User{APIKey: "test-key", Name: "Test"}
+	db.CreateUser(user)
+	model := &database.Model{Name: "gpt-4o"}
+	db.CreateModel(model)
+	down := &database.Channel{Name: "down", BaseURL: "https://a.example.com", APIKey: "sk-a", Weight: 10, Enabled: true}
+	up := &database.Channel{Name: "up", BaseURL: "https://b.example.com", APIKey: "sk-b", Weight: 10, Enabled: true}
+	for _, ch := range []*database.Channel{down, up} {
+		db.CreateChannel(ch)
+		db.AddModelChannel(&database.ModelChannel{ModelID: model.ID, ChannelID: ch.ID, BackendModelName: "gpt-4o"})
+	}
+
+	engine := NewEngine(db)
+	health := unhealthyChannels{down.ID: true}
+	engine.AddHealthSource(health)
+
+	// A session on the unhealthy channel is routed afresh
+	db.CreateSession(&database.Session{UserID: user.ID, ChannelID: down.ID})
+	for i := 0; i < 10; i++ {
+		result, err := engine.Route(user.ID, "gpt-4o")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Channel.ID != up.ID {
+			t.Fatalf("Expected the healthy channel, got %s", result.Channel.Name)
+		}
+	}
+
+	// With every channel unhealthy, they are used anyway
+	health[up.ID] = true
+	if _, err := engine.Route(user.ID, "gpt-4o"); err != nil {
+		t.Errorf("Expected an unhealthy channel rather than an error, got %v", err)
+	}
+}
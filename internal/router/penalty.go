@@ -0,0 +1,65 @@
+package router
+
+import (
+	"sync"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+)
+
+// penaltyFactor scales the score of a penalized channel so new sessions
+// prefer other channels without excluding it outright
+const penaltyFactor = 0.1
+
+// penalties tracks channels whose score is temporarily reduced
+type penalties struct {
+	mu    sync.Mutex
+	until map[int64]time.Time
+}
+
+// Penalize reduces a channel's score for the given duration, e.g. after the
+// backend rate limited it. A longer existing penalty is kept.
+func (e *Engine) Penalize(channelID int64, d time.Duration) {
+	e.penalties.mu.Lock()
+	defer e.penalties.mu.Unlock()
+
+	if e.penalties.until == nil {
+		e.penalties.until = make(map[int64]time.Time)
+	}
+	until := time.Now().Add(d)
+	if until.After(e.penalties.until[channelID]) {
+		e.penalties.until[channelID] = until
+	}
+}
+
+// penalized reports whether a channel is currently penalized
+func (e *Engine) penalized(channelID int64, now time.Time) bool {
+	e.penalties.mu.Lock()
+	defer e.penalties.mu.Unlock()
+
+	until, ok := e.penalties.until[channelID]
+	if !ok {
+		return false
+	}
+	if !now.Before(until) {
+		delete(e.penalties.until, channelID)
+		return false
+	}
+	return true
+}
+
+// IncidentSource reports channels whose provider has declared an incident
+type IncidentSource interface {
+	Affected(channelName string) bool
+}
+
+// SetIncidentSource penalizes the channels of providers with a declared
+// incident for as long as it lasts
+func (e *Engine) SetIncidentSource(source IncidentSource) {
+	e.incidents = source
+}
+
+// inIncident reports whether a channel's provider has declared an incident
+func (e *Engine) inIncident(channel *database.Channel) bool {
+	return e.incidents != nil && e.incidents.Affected(channel.Name)
+}
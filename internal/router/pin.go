@@ -0,0 +1,55 @@
+package router
+
+import (
+	"hash/fnv"
+	"log"
+	"strconv"
+)
+
+// routeByPin returns the route to the channel a pin maps to among the
+// model's candidates. The mapping uses rendezvous hashing: every candidate
+// is scored by a hash of the pin and its channel ID, and the highest score
+// wins. The same pin therefore reaches the same channel on every replica
+// and across restarts, and when a channel leaves or joins, only the pins
+// mapped to it move. Pinned routes bypass sticky sessions without changing
+// them.
+func (e *Engine) routeByPin(model string, attrs Attributes) (*RouteResult, error) {
+	modelObj, mappings, err := e.candidates(model, attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	best, bestScore := mappings[0], pinScore(attrs.Pin, mappings[0].channel.ID)
+	for _, m := range mappings[1:] {
+		if score := pinScore(attrs.Pin, m.channel.ID); score > bestScore {
+			best, bestScore = m, score
+		}
+	}
+	if e.debug {
+		log.Printf("Pinned selection: pin %q picked %s of %d candidates", attrs.Pin, best.channel.Name, len(mappings))
+	}
+
+	return &RouteResult{
+		Channel:          best.channel,
+		Model:            modelObj,
+		BackendModelName: best.backendModelName,
+		StreamMode:       best.streamMode,
+		Pinned:           true,
+	}, nil
+}
+
+// pinScore hashes a pin with a channel ID. FNV-1a is finalized with the
+// splitmix64 mixer, so pins differing in one byte still spread evenly.
+func pinScore(pin string, channelID int64) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(pin))
+	h.Write([]byte{0})
+	h.Write([]byte(strconv.FormatInt(channelID, 10)))
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
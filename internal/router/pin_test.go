@@ -0,0 +1,92 @@
+package router
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+)
+
+func TestRouteRequestByPin(t *testing.T) {
+	dbPath := "/tmp/test_router_pin.db"
+	defer os.Remove(dbPath)
+
+	db, err := database.New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	user := &database.User{APIKey: "test-key", Name: "Test User"}
+	db.CreateUser(user)
+	model := &database.Model{Name: "gpt-4"}
+	db.CreateModel(model)
+
+	var channels []*database.Channel
+	for i := 0; i < 4; i++ {
+		ch := &database.Channel{Name: fmt.Sprintf("ch-%d", i), BaseURL: "https://example.com", APIKey: "sk", Weight: 10, Enabled: true}
+		db.CreateChannel(ch)
+		db.AddModelChannel(&database.ModelChannel{ModelID: model.ID, ChannelID: ch.ID, BackendModelName: "gpt-4", Weight: 10})
+		channels = append(channels, ch)
+	}
+
+	engine := NewEngine(db)
+	route := func(pin string, exclude ...int64) int64 {
+		t.Helper()
+		result, err := engine.RouteRequest(user.ID, "gpt-4", Attributes{Pin: pin, Exclude: exclude})
+		if err != nil {
+			t.Fatalf("Failed to route: %v", err)
+		}
+		if !result.Pinned || result.SessionID != 0 {
+			t.Fatalf("Expected a pinned route without a session, got %+v", result)
+		}
+		return result.Channel.ID
+	}
+
+	// The same pin always reaches the same channel, and pins spread over
+	// the channels
+	pinned := make(map[string]int64)
+	used := make(map[int64]bool)
+	for i := 0; i < 64; i++ {
+		pin := fmt.Sprintf("eval-run-%d", i)
+		pinned[pin] = route(pin)
+		used[pinned[pin]] = true
+		if again := route(pin); again != pinned[pin] {
+			t.Fatalf("Expected pin %q to stay on channel %d, got %d", pin, pinned[pin], again)
+		}
+	}
+	if len(used) != len(channels) {
+		t.Errorf("Expected pins spread over all %d channels, got %d", len(channels), len(used))
+	}
+
+	// Pins do not create or follow sticky sessions
+	if s, _ := db.GetSessionByKey(user.ID, ""); s != nil {
+		t.Errorf("Expected no session for pinned requests, got %+v", s)
+	}
+
+	// Disabling a channel only moves the pins mapped to it
+	gone := channels[0]
+	gone.Enabled = false
+	db.UpdateChannel(gone)
+	for pin, channelID := range pinned {
+		got := route(pin)
+		if channelID != gone.ID && got != channelID {
+			t.Errorf("Expected pin %q to stay on channel %d, got %d", pin, channelID, got)
+		}
+		if got == gone.ID {
+			t.Errorf("Expected pin %q to leave the disabled channel", pin)
+		}
+	}
+
+	// An excluded channel, such as one that failed the request, hands the
+	// pin to the next channel in its order
+	for pin, channelID := range pinned {
+		if channelID == gone.ID {
+			continue
+		}
+		if got := route(pin, channelID); got == channelID || got == gone.ID {
+			t.Errorf("Expected pin %q to move off excluded channel %d, got %d", pin, channelID, got)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package router
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rand is the source of the random draws of weighted selection. It must be
+// safe for concurrent use, as requests are routed concurrently.
+type Rand interface {
+	// Float64 returns a number in [0, 1)
+	Float64() float64
+}
+
+// lockedRand is a seeded generator guarded by a mutex
+type lockedRand struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+// NewRand returns a concurrency-safe generator seeded with seed. The same
+// seed gives the same sequence of draws, so routing can be replayed in tests
+// and simulations.
+func NewRand(seed int64) Rand {
+	return &lockedRand{r: rand.New(rand.NewSource(seed))}
+}
+
+// Float64 returns the next draw
+func (l *lockedRand) Float64() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Float64()
+}
+
+// SetRand replaces the generator of weighted selection, e.g. with
+// NewRand(seed) for deterministic routing
+func (e *Engine) SetRand(r Rand) {
+	e.rand = r
+}
+
+// SetDebug logs every weighted selection with its draw and the cumulative
+// weights of the candidates
+func (e *Engine) SetDebug(enabled bool) {
+	e.debug = enabled
+}
+
+// pickWeighted draws an index with probability proportional to its score.
+// names label the candidates in debug logs.
+func (e *Engine) pickWeighted(names []string, scores []float64) int {
+	total := 0.0
+	for _, score := range scores {
+		total += score
+	}
+	r := e.rand.Float64() * total
+
+	// Fall back to the last candidate if rounding leaves r past the end
+	picked := len(scores) - 1
+	cumulative := 0.0
+	for i, score := range scores {
+		cumulative += score
+		if r <= cumulative {
+			picked = i
+			break
+		}
+	}
+
+	if e.debug {
+		e.logDraw(names, scores, r, total, picked)
+	}
+	return picked
+}
+
+// logDraw logs a weighted selection
+func (e *Engine) logDraw(names []string, scores []float64, r, total float64, picked int) {
+	var b strings.Builder
+	cumulative := 0.0
+	for i, score := range scores {
+		cumulative += score
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "%s=%.6f", names[i], cumulative)
+	}
+	log.Printf("Weighted selection: draw %.6f of %.6f, cumulative [%s], picked %s", r, total, b.String(), names[picked])
+}
+
+// newDefaultRand seeds a generator from the clock
+func newDefaultRand() Rand {
+	return NewRand(time.Now().UnixNano())
+}
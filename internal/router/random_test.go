@@ -0,0 +1,69 @@
+package router
+
+import (
+	"sync"
+	"testing"
+)
+
+// fixedRand always draws the same value
+type fixedRand float64
+
+func (f fixedRand) Float64() float64 { return float64(f) }
+
+func TestPickWeighted(t *testing.T) {
+	names := []string{"a", "b", "c"}
+	scores := []float64{1, 2, 7}
+
+	tests := []struct {
+		draw float64
+		want int
+	}{
+		{0, 0},
+		{0.1, 0},
+		{0.15, 1},
+		{0.3, 1},
+		{0.31, 2},
+		{0.999, 2},
+	}
+	for _, tt := range tests {
+		e := &Engine{rand: fixedRand(tt.draw), debug: true}
+		if got := e.pickWeighted(names, scores); got != tt.want {
+			t.Errorf("Draw %v: expected %s, got %s", tt.draw, names[tt.want], names[got])
+		}
+	}
+}
+
+func TestSeededSelectionIsReproducible(t *testing.T) {
+	names := []string{"a", "b", "c"}
+	scores := []float64{1, 1, 1}
+
+	draw := func(seed int64) []int {
+		e := &Engine{rand: NewRand(seed)}
+		picks := make([]int, 50)
+		for i := range picks {
+			picks[i] = e.pickWeighted(names, scores)
+		}
+		return picks
+	}
+
+	first, second := draw(42), draw(42)
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("Expected the same picks for the same seed, differing at draw %d", i)
+		}
+	}
+
+	// The generator is shared by concurrent requests
+	e := &Engine{rand: NewRand(1)}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				e.pickWeighted(names, scores)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,118 @@
+package router
+
+import (
+	"slices"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+)
+
+// Attributes are the properties of a request that routing rules match
+type Attributes struct {
+	// PromptTokens is the estimated size of the prompt
+	PromptTokens int
+	HasTools     bool
+	HasImages    bool
+	// SessionKey identifies the end user behind the API key, such as the
+	// OpenAI "user" field. When set, stickiness is scoped to it instead of
+	// the API key's user.
+	SessionKey string
+	// Pin, when set, maps the request consistently to one of the model's
+	// channels, so requests with the same pin reach the same backend
+	Pin string
+	// Exclude lists channels that must not be chosen, such as one that
+	// already failed the request. Rules and sessions pointing at them are
+	// passed over.
+	Exclude []int64
+}
+
+// excludes reports whether a channel is excluded from the route
+func (a Attributes) excludes(channelID int64) bool {
+	return slices.Contains(a.Exclude, channelID)
+}
+
+// routeByRules returns the route chosen by the first enabled rule that
+// matches the request and whose channel can serve the model, or nil when no
+// rule applies. A rule's route bypasses sticky sessions without changing them.
+func (e *Engine) routeByRules(userID int64, model string, attrs Attributes) (*RouteResult, error) {
+	rules, err := e.db.ListRoutingRules()
+	if err != nil || len(rules) == 0 {
+		return nil, err
+	}
+
+	modelObj, err := e.db.GetModelByName(model)
+	if err != nil || modelObj == nil {
+		return nil, err
+	}
+
+	var user *database.User
+	now := time.Now()
+	for _, rule := range rules {
+		if !rule.Enabled || (rule.Model != "" && rule.Model != model) || attrs.excludes(rule.ChannelID) {
+			continue
+		}
+		if len(rule.Conditions.UserLabels) > 0 && user == nil {
+			if user, err = e.db.GetUser(userID); err != nil {
+				return nil, err
+			}
+		}
+		if !ruleMatches(rule.Conditions, user, attrs) {
+			continue
+		}
+
+		result, err := e.ruleRoute(rule, modelObj, now)
+		if err != nil {
+			return nil, err
+		}
+		if result != nil {
+			return result, nil
+		}
+	}
+	return nil, nil
+}
+
+// ruleMatches reports whether a request satisfies every set condition
+func ruleMatches(cond database.RuleConditions, user *database.User, attrs Attributes) bool {
+	if len(cond.UserLabels) > 0 && (user == nil || !user.MatchLabels(cond.UserLabels)) {
+		return false
+	}
+	if cond.MinPromptTokens > 0 && attrs.PromptTokens < cond.MinPromptTokens {
+		return false
+	}
+	if cond.MaxPromptTokens > 0 && attrs.PromptTokens > cond.MaxPromptTokens {
+		return false
+	}
+	if cond.HasTools != nil && *cond.HasTools != attrs.HasTools {
+		return false
+	}
+	if cond.HasImages != nil && *cond.HasImages != attrs.HasImages {
+		return false
+	}
+	return true
+}
+
+// ruleRoute builds the route to a rule's channel, or returns nil when the
+// channel is not routable or does not serve the model
+func (e *Engine) ruleRoute(rule *database.RoutingRule, modelObj *database.Model, now time.Time) (*RouteResult, error) {
+	channel, err := e.db.GetChannel(rule.ChannelID)
+	if err != nil || channel == nil || !routable(channel, now) || e.unhealthy(channel) {
+		return nil, err
+	}
+
+	modelChannels, err := e.db.GetModelChannelsByChannel(channel.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, mc := range modelChannels {
+		if mc.ModelID == modelObj.ID {
+			return &RouteResult{
+				Channel:          channel,
+				Model:            modelObj,
+				BackendModelName: mc.BackendModelName,
+				StreamMode:       mc.StreamMode,
+				Rule:             rule.Name,
+			}, nil
+		}
+	}
+	return nil, nil
+}
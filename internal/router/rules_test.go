@@ -0,0 +1,109 @@
+package router
+
+import (
+	"os"
+	"testing"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+)
+
+func TestRouteRequestAppliesRules(t *testing.T) {
+	dbPath := "/tmp/test_router_rules.db"
+	defer os.Remove(dbPath)
+
+	db, err := database.New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	user := &database.User{APIKey: "test-key", Name: "Test User", Labels: map[string]string{"tier": "gold"}}
+	db.CreateUser(user)
+
+	model := &database.Model{Name: "gpt-4"}
+	db.CreateModel(model)
+
+	standard := &database.Channel{Name: "standard", BaseURL: "https://a.example.com", APIKey: "sk-a", Weight: 10, Enabled: true}
+	long := &database.Channel{Name: "long", BaseURL: "https://b.example.com", APIKey: "sk-b", Weight: 10, Enabled: true}
+	tools := &database.Channel{Name: "tools", BaseURL: "https://c.example.com", APIKey: "sk-c", Weight: 10, Enabled: true}
+	for _, ch := range []*database.Channel{standard, long, tools} {
+		db.CreateChannel(ch)
+	}
+	db.AddModelChannel(&database.ModelChannel{ModelID: model.ID, ChannelID: standard.ID, BackendModelName: "gpt-4", Weight: 10})
+	db.AddModelChannel(&database.ModelChannel{ModelID: model.ID, ChannelID: long.ID, BackendModelName: "gpt-4-128k", Weight: 10})
+
+	hasTools := true
+	db.CreateRoutingRule(&database.RoutingRule{Name: "long-context", Priority: 10, Enabled: true, Model: "gpt-4", ChannelID: long.ID, Conditions: database.RuleConditions{MinPromptTokens: 8000}})
+	// The tools channel does not serve gpt-4, so this rule never applies
+	db.CreateRoutingRule(&database.RoutingRule{Name: "tools", Priority: 5, Enabled: true, ChannelID: tools.ID, Conditions: database.RuleConditions{HasTools: &hasTools}})
+	db.CreateRoutingRule(&database.RoutingRule{Name: "silver", Priority: 1, Enabled: true, ChannelID: long.ID, Conditions: database.RuleConditions{UserLabels: map[string]string{"tier": "silver"}}})
+
+	engine := NewEngine(db)
+
+	// Pin the user's sticky session to the standard channel
+	db.CreateSession(&database.Session{UserID: user.ID, ChannelID: standard.ID})
+
+	result, err := engine.RouteRequest(user.ID, "gpt-4", Attributes{PromptTokens: 9000})
+	if err != nil {
+		t.Fatalf("Failed to route: %v", err)
+	}
+	if result.Channel.ID != long.ID || result.Rule != "long-context" || result.BackendModelName != "gpt-4-128k" {
+		t.Fatalf("Expected long-context rule to route to %s, got %s (rule %q)", long.Name, result.Channel.Name, result.Rule)
+	}
+
+	tests := []struct {
+		name  string
+		attrs Attributes
+	}{
+		{"short prompt", Attributes{PromptTokens: 100}},
+		{"tools channel without the model", Attributes{PromptTokens: 100, HasTools: true}},
+	}
+	for _, tt := range tests {
+		result, err := engine.RouteRequest(user.ID, "gpt-4", tt.attrs)
+		if err != nil {
+			t.Fatalf("%s: failed to route: %v", tt.name, err)
+		}
+		if result.Channel.ID != standard.ID || result.Rule != "" {
+			t.Errorf("%s: expected the sticky session on %s, got %s (rule %q)", tt.name, standard.Name, result.Channel.Name, result.Rule)
+		}
+	}
+
+	// A rule whose channel is disabled falls through to normal routing
+	long.Enabled = false
+	db.UpdateChannel(long)
+	result, err = engine.RouteRequest(user.ID, "gpt-4", Attributes{PromptTokens: 9000})
+	if err != nil {
+		t.Fatalf("Failed to route: %v", err)
+	}
+	if result.Channel.ID != standard.ID || result.Rule != "" {
+		t.Errorf("Expected fallback to %s, got %s (rule %q)", standard.Name, result.Channel.Name, result.Rule)
+	}
+}
+
+func TestRuleMatches(t *testing.T) {
+	yes, no := true, false
+	gold := &database.User{Labels: map[string]string{"tier": "gold"}}
+
+	tests := []struct {
+		name  string
+		cond  database.RuleConditions
+		user  *database.User
+		attrs Attributes
+		want  bool
+	}{
+		{"no conditions", database.RuleConditions{}, nil, Attributes{}, true},
+		{"label match", database.RuleConditions{UserLabels: map[string]string{"tier": "gold"}}, gold, Attributes{}, true},
+		{"label mismatch", database.RuleConditions{UserLabels: map[string]string{"tier": "silver"}}, gold, Attributes{}, false},
+		{"label without user", database.RuleConditions{UserLabels: map[string]string{"tier": "gold"}}, nil, Attributes{}, false},
+		{"below min tokens", database.RuleConditions{MinPromptTokens: 100}, nil, Attributes{PromptTokens: 99}, false},
+		{"within token range", database.RuleConditions{MinPromptTokens: 100, MaxPromptTokens: 200}, nil, Attributes{PromptTokens: 150}, true},
+		{"above max tokens", database.RuleConditions{MaxPromptTokens: 200}, nil, Attributes{PromptTokens: 201}, false},
+		{"requires tools", database.RuleConditions{HasTools: &yes}, nil, Attributes{}, false},
+		{"excludes images", database.RuleConditions{HasImages: &no}, nil, Attributes{HasImages: true}, false},
+	}
+	for _, tt := range tests {
+		if got := ruleMatches(tt.cond, tt.user, tt.attrs); got != tt.want {
+			t.Errorf("%s: ruleMatches() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+// Package scheduler runs the gateway's periodic background jobs, such as
+// session cleanup and health checks, on one loop per job. Waits are
+// jittered so replicas started together do not run jobs in lockstep, every
+// run is recorded in the job metrics, and jobs are stopped in the reverse
+// order they were added.
+package scheduler
+
+import (
+	"context"
+	"log"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/internal/metrics"
+)
+
+// finalTimeout bounds the final run of a job when the scheduler stops
+const finalTimeout = 10 * time.Second
+
+// Job is periodic background work
+type Job struct {
+	// Name identifies the job in logs and metrics
+	Name     string
+	Interval time.Duration
+	// Jitter is the most random delay added to each wait
+	Jitter time.Duration
+	// Immediate runs the job once at start instead of after the first wait
+	Immediate bool
+	// Run does the work. Its context is cancelled when the job is stopped.
+	Run func(ctx context.Context) error
+	// Final, if set, runs once after the job has stopped, such as a last
+	// flush of buffered data
+	Final func(ctx context.Context) error
+}
+
+// wait returns the time until the next run
+func (j *Job) wait() time.Duration {
+	if j.Jitter <= 0 {
+		return j.Interval
+	}
+	return j.Interval + rand.N(j.Jitter)
+}
+
+// Scheduler runs jobs until it is stopped. Runs of one job never overlap.
+type Scheduler struct {
+	mu      sync.Mutex
+	entries []*entry
+	started bool
+	stopped bool
+}
+
+// entry is a job and the loop running it
+type entry struct {
+	job    Job
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// mu guards the job's interval and jitter, and rescheduled wakes the
+	// loop when they change
+	mu          sync.Mutex
+	rescheduled chan struct{}
+}
+
+// wait returns the time until the job's next run
+func (e *entry) wait() time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.job.wait()
+}
+
+// New creates a scheduler
+func New() *Scheduler {
+	return &Scheduler{}
+}
+
+// Add registers a job. Jobs added after Start begin running at once. Jobs
+// without a name, a positive interval or a Run function are rejected with a
+// logged warning.
+func (s *Scheduler) Add(job Job) {
+	if job.Name == "" || job.Interval <= 0 || job.Run == nil {
+		log.Printf("Scheduler: ignoring invalid job %q with interval %s", job.Name, job.Interval)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped {
+		return
+	}
+	e := &entry{job: job, rescheduled: make(chan struct{}, 1)}
+	s.entries = append(s.entries, e)
+	if s.started {
+		s.launch(e)
+	}
+}
+
+// Reschedule changes the interval and jitter of a job, such as after a
+// configuration reload. The wait in progress starts over with the new
+// interval. Invalid intervals are ignored. It reports whether the job was
+// found.
+func (s *Scheduler) Reschedule(name string, interval, jitter time.Duration) bool {
+	if interval <= 0 {
+		log.Printf("Scheduler: ignoring invalid interval %s for job %q", interval, name)
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, e := range s.entries {
+		if e.job.Name != name {
+			continue
+		}
+		e.mu.Lock()
+		e.job.Interval, e.job.Jitter = interval, jitter
+		e.mu.Unlock()
+		select {
+		case e.rescheduled <- struct{}{}:
+		default:
+		}
+		return true
+	}
+	return false
+}
+
+// Start begins running the registered jobs
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started || s.stopped {
+		return
+	}
+	s.started = true
+	for _, e := range s.entries {
+		s.launch(e)
+	}
+}
+
+// Stop stops the jobs one at a time, last added first. Each job's in-flight
+// run is cancelled and waited for, and its Final function is run, before the
+// job added before it is stopped.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return
+	}
+	s.stopped = true
+	entries := s.entries
+	started := s.started
+	s.mu.Unlock()
+
+	if !started {
+		return
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		e.cancel()
+		<-e.done
+		if e.job.Final != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), finalTimeout)
+			if err := e.job.Final(ctx); err != nil {
+				log.Printf("Job %s failed its final run: %v", e.job.Name, err)
+			}
+			cancel()
+		}
+	}
+}
+
+// launch starts the loop of a job. s.mu must be held.
+func (s *Scheduler) launch(e *entry) {
+	ctx, cancel := context.WithCancel(context.Background())
+	e.cancel = cancel
+	e.done = make(chan struct{})
+	go loop(ctx, e)
+}
+
+// loop runs a job after every wait until ctx is cancelled
+func loop(ctx context.Context, e *entry) {
+	defer close(e.done)
+
+	job := &e.job
+	if job.Immediate {
+		run(ctx, job)
+	}
+	timer := time.NewTimer(e.wait())
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			run(ctx, job)
+			timer.Reset(e.wait())
+		case <-e.rescheduled:
+			timer.Reset(e.wait())
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// run runs a job once and records the outcome
+func run(ctx context.Context, job *Job) {
+	start := time.Now()
+	err := job.Run(ctx)
+	if ctx.Err() != nil {
+		// Runs cut short by Stop are not failures
+		return
+	}
+	metrics.RecordJobRun(job.Name, time.Since(start), err == nil)
+	if err != nil {
+		log.Printf("Job %s failed: %v", job.Name, err)
+	}
+}
@@ -0,0 +1,155 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSchedulerRunsJobs(t *testing.T) {
+	var runs, failures atomic.Int32
+	s := New()
+	s.Add(Job{Name: "test_runs", Interval: 10 * time.Millisecond, Immediate: true, Run: func(context.Context) error {
+		runs.Add(1)
+		return nil
+	}})
+	s.Add(Job{Name: "test_failures", Interval: 10 * time.Millisecond, Run: func(context.Context) error {
+		failures.Add(1)
+		return errors.New("boom")
+	}})
+	s.Start()
+	time.Sleep(100 * time.Millisecond)
+	s.Stop()
+
+	if runs.Load() < 3 || failures.Load() < 3 {
+		t.Fatalf("Expected repeated runs, got %d and %d", runs.Load(), failures.Load())
+	}
+	// A run racing with Stop may go unrecorded
+	if got := testutil.ToFloat64(metrics.JobRuns.WithLabelValues("test_runs", metrics.OutcomeSuccess)); got < float64(runs.Load()-1) {
+		t.Errorf("Expected %d successful runs recorded, got %v", runs.Load(), got)
+	}
+	if got := testutil.ToFloat64(metrics.JobRuns.WithLabelValues("test_failures", metrics.OutcomeError)); got < float64(failures.Load()-1) {
+		t.Errorf("Expected %d failed runs recorded, got %v", failures.Load(), got)
+	}
+
+	// Nothing runs after Stop
+	stopped := runs.Load()
+	time.Sleep(30 * time.Millisecond)
+	if runs.Load() != stopped {
+		t.Error("Expected no runs after Stop")
+	}
+}
+
+func TestSchedulerStopsInReverseOrder(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	record := func(event string) {
+		mu.Lock()
+		order = append(order, event)
+		mu.Unlock()
+	}
+
+	s := New()
+	for _, name := range []string{"first", "second"} {
+		s.Add(Job{
+			Name:      name,
+			Interval:  time.Hour,
+			Immediate: true,
+			Run: func(ctx context.Context) error {
+				// Block until the job is stopped
+				<-ctx.Done()
+				record(name + " cancelled")
+				return ctx.Err()
+			},
+			Final: func(context.Context) error {
+				record(name + " final")
+				return nil
+			},
+		})
+	}
+	s.Start()
+	time.Sleep(20 * time.Millisecond)
+	s.Stop()
+
+	want := []string{"second cancelled", "second final", "first cancelled", "first final"}
+	if len(order) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, order)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("Expected %v, got %v", want, order)
+		}
+	}
+}
+
+func TestSchedulerAddAfterStart(t *testing.T) {
+	ran := make(chan struct{}, 1)
+	s := New()
+	s.Start()
+	defer s.Stop()
+
+	// Invalid jobs are ignored
+	s.Add(Job{Name: "no_interval", Run: func(context.Context) error { return nil }})
+
+	s.Add(Job{Name: "late", Interval: 5 * time.Millisecond, Run: func(context.Context) error {
+		select {
+		case ran <- struct{}{}:
+		default:
+		}
+		return nil
+	}})
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatal("Expected a job added after Start to run")
+	}
+}
+
+func TestSchedulerReschedule(t *testing.T) {
+	ran := make(chan struct{}, 1)
+	s := New()
+	s.Add(Job{Name: "slow", Interval: time.Hour, Run: func(context.Context) error {
+		select {
+		case ran <- struct{}{}:
+		default:
+		}
+		return nil
+	}})
+	s.Start()
+	defer s.Stop()
+
+	if s.Reschedule("missing", time.Second, 0) {
+		t.Error("Expected an unknown job not to be rescheduled")
+	}
+	if s.Reschedule("slow", 0, 0) {
+		t.Error("Expected an invalid interval to be ignored")
+	}
+
+	// The hour-long wait in progress starts over with the new interval
+	if !s.Reschedule("slow", 5*time.Millisecond, 0) {
+		t.Fatal("Expected the job to be rescheduled")
+	}
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the rescheduled job to run")
+	}
+}
+
+func TestJobWaitJitter(t *testing.T) {
+	job := Job{Interval: time.Second, Jitter: 100 * time.Millisecond}
+	for i := 0; i < 100; i++ {
+		if d := job.wait(); d < time.Second || d >= 1100*time.Millisecond {
+			t.Fatalf("Wait %v outside the jitter range", d)
+		}
+	}
+	if d := (&Job{Interval: time.Second}).wait(); d != time.Second {
+		t.Errorf("Expected no jitter, got %v", d)
+	}
+}
@@ -0,0 +1,396 @@
+package scim
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/X0Ken/openai-gateway/internal/auth"
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+// SCIM schema URNs
+const (
+	SchemaUser         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SchemaListResponse = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SchemaPatchOp      = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SchemaError        = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+// Handler implements the subset of the SCIM 2.0 Users API needed to keep
+// gateway users in sync with an identity provider. userName maps to the
+// user's name; deprovisioning disables the user instead of deleting it so
+// usage history is kept.
+type Handler struct {
+	db    *database.DB
+	token string
+}
+
+// NewHandler creates a new SCIM handler authenticated by a static bearer token
+func NewHandler(db *database.DB, token string) *Handler {
+	return &Handler{db: db, token: token}
+}
+
+// RegisterRoutes registers SCIM routes
+func (h *Handler) RegisterRoutes(r *gin.RouterGroup) {
+	r.Use(h.requireToken())
+
+	r.GET("/Users", h.ListUsers)
+	r.POST("/Users", h.CreateUser)
+	r.GET("/Users/:id", h.GetUser)
+	r.PUT("/Users/:id", h.ReplaceUser)
+	r.PATCH("/Users/:id", h.PatchUser)
+	r.DELETE("/Users/:id", h.DeleteUser)
+}
+
+// User represents a SCIM user resource
+type User struct {
+	Schemas    []string `json:"schemas"`
+	ID         string   `json:"id,omitempty"`
+	ExternalID string   `json:"externalId,omitempty"`
+	UserName   string   `json:"userName"`
+	Active     *bool    `json:"active,omitempty"`
+	Meta       *Meta    `json:"meta,omitempty"`
+}
+
+// Meta represents SCIM resource metadata
+type Meta struct {
+	ResourceType string `json:"resourceType"`
+	Created      string `json:"created"`
+	LastModified string `json:"lastModified"`
+}
+
+// ListResponse represents a SCIM list response
+type ListResponse struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int      `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    []User   `json:"Resources"`
+}
+
+// PatchRequest represents a SCIM PatchOp request
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations"`
+}
+
+// PatchOperation represents a single SCIM patch operation
+type PatchOperation struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	Value any    `json:"value"`
+}
+
+// requireToken authenticates the identity provider by bearer token
+func (h *Handler) requireToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if h.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+			writeError(c, http.StatusUnauthorized, "invalid SCIM token")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// ListUsers lists users, optionally filtered by `userName eq "..."` or `externalId eq "..."`
+func (h *Handler) ListUsers(c *gin.Context) {
+	var users []*database.User
+
+	if filter := c.Query("filter"); filter != "" {
+		attr, value, err := parseEqFilter(filter)
+		if err != nil {
+			writeError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		var user *database.User
+		switch attr {
+		case "username":
+			user, err = h.db.GetUserByName(value)
+		case "externalid":
+			user, err = h.db.GetUserByExternalID(value)
+		default:
+			writeError(c, http.StatusBadRequest, "unsupported filter attribute: "+attr)
+			return
+		}
+		if err != nil {
+			writeError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if user != nil {
+			users = append(users, user)
+		}
+	} else {
+		all, err := h.db.ListUsers()
+		if err != nil {
+			writeError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		users = all
+	}
+
+	resources := make([]User, 0, len(users))
+	for _, u := range users {
+		resources = append(resources, toSCIM(u))
+	}
+
+	c.JSON(http.StatusOK, ListResponse{
+		Schemas:      []string{SchemaListResponse},
+		TotalResults: len(resources),
+		StartIndex:   1,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+// CreateUser provisions a new user with a generated API key
+func (h *Handler) CreateUser(c *gin.Context) {
+	var req User
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.UserName == "" {
+		writeError(c, http.StatusBadRequest, "userName is required")
+		return
+	}
+
+	apiKey, err := auth.GenerateAPIKey()
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	user := &database.User{
+		APIKey:     apiKey,
+		Name:       req.UserName,
+		ExternalID: req.ExternalID,
+	}
+	if err := h.db.CreateUser(user); err != nil {
+		writeDBError(c, err)
+		return
+	}
+
+	if req.Active != nil && !*req.Active {
+		user.Enabled = false
+		if err := h.db.UpdateUser(user); err != nil {
+			writeDBError(c, err)
+			return
+		}
+	}
+
+	// Reload to pick up database-assigned timestamps
+	created, err := h.db.GetUser(user.ID)
+	if err != nil || created == nil {
+		created = user
+	}
+
+	c.JSON(http.StatusCreated, toSCIM(created))
+}
+
+// GetUser returns a single user
+func (h *Handler) GetUser(c *gin.Context) {
+	user, ok := h.loadUser(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, toSCIM(user))
+}
+
+// ReplaceUser replaces a user's userName, externalId and active state
+func (h *Handler) ReplaceUser(c *gin.Context) {
+	user, ok := h.loadUser(c)
+	if !ok {
+		return
+	}
+
+	var req User
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.UserName == "" {
+		writeError(c, http.StatusBadRequest, "userName is required")
+		return
+	}
+
+	user.Name = req.UserName
+	user.ExternalID = req.ExternalID
+	user.Enabled = req.Active == nil || *req.Active
+
+	if err := h.db.UpdateUser(user); err != nil {
+		writeDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, toSCIM(user))
+}
+
+// PatchUser applies replace operations on active, userName and externalId
+func (h *Handler) PatchUser(c *gin.Context) {
+	user, ok := h.loadUser(c)
+	if !ok {
+		return
+	}
+
+	var req PatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		writeError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	for _, op := range req.Operations {
+		if !strings.EqualFold(op.Op, "replace") && !strings.EqualFold(op.Op, "add") {
+			writeError(c, http.StatusBadRequest, "unsupported patch operation: "+op.Op)
+			return
+		}
+
+		// Without a path the value is an object of attributes to replace
+		values := map[string]any{}
+		if op.Path != "" {
+			values[op.Path] = op.Value
+		} else if m, ok := op.Value.(map[string]any); ok {
+			values = m
+		}
+
+		for path, value := range values {
+			if err := applyPatch(user, path, value); err != nil {
+				writeError(c, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+	}
+
+	if err := h.db.UpdateUser(user); err != nil {
+		writeDBError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, toSCIM(user))
+}
+
+// DeleteUser deprovisions a user by disabling it
+func (h *Handler) DeleteUser(c *gin.Context) {
+	user, ok := h.loadUser(c)
+	if !ok {
+		return
+	}
+
+	user.Enabled = false
+	if err := h.db.UpdateUser(user); err != nil {
+		writeDBError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// loadUser resolves the :id parameter, writing a SCIM error when it fails
+func (h *Handler) loadUser(c *gin.Context) (*database.User, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		writeError(c, http.StatusNotFound, "user not found")
+		return nil, false
+	}
+
+	user, err := h.db.GetUser(id)
+	if err != nil {
+		writeError(c, http.StatusInternalServerError, err.Error())
+		return nil, false
+	}
+	if user == nil {
+		writeError(c, http.StatusNotFound, "user not found")
+		return nil, false
+	}
+
+	return user, true
+}
+
+// applyPatch sets a single SCIM attribute on a user
+func applyPatch(user *database.User, path string, value any) error {
+	switch strings.ToLower(path) {
+	case "active":
+		switch v := value.(type) {
+		case bool:
+			user.Enabled = v
+		case string:
+			// Some identity providers send booleans as strings
+			active, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("invalid value for active: %q", v)
+			}
+			user.Enabled = active
+		default:
+			return fmt.Errorf("invalid value for active")
+		}
+	case "username":
+		name, ok := value.(string)
+		if !ok || name == "" {
+			return fmt.Errorf("invalid value for userName")
+		}
+		user.Name = name
+	case "externalid":
+		externalID, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("invalid value for externalId")
+		}
+		user.ExternalID = externalID
+	default:
+		return fmt.Errorf("unsupported attribute: %s", path)
+	}
+	return nil
+}
+
+// parseEqFilter parses a filter of the form `attribute eq "value"`
+func parseEqFilter(filter string) (string, string, error) {
+	parts := strings.SplitN(strings.TrimSpace(filter), " ", 3)
+	if len(parts) != 3 || !strings.EqualFold(parts[1], "eq") {
+		return "", "", fmt.Errorf("unsupported filter: %s", filter)
+	}
+
+	value := strings.Trim(strings.TrimSpace(parts[2]), `"`)
+	return strings.ToLower(parts[0]), value, nil
+}
+
+// toSCIM converts a gateway user into a SCIM user resource
+func toSCIM(u *database.User) User {
+	active := u.Enabled
+	return User{
+		Schemas:    []string{SchemaUser},
+		ID:         strconv.FormatInt(u.ID, 10),
+		ExternalID: u.ExternalID,
+		UserName:   u.Name,
+		Active:     &active,
+		Meta: &Meta{
+			ResourceType: "User",
+			Created:      u.CreatedAt.UTC().Format("2006-01-02T15:04:05Z"),
+			LastModified: u.UpdatedAt.UTC().Format("2006-01-02T15:04:05Z"),
+		},
+	}
+}
+
+// writeError writes a SCIM error response
+func writeError(c *gin.Context, status int, detail string) {
+	c.JSON(status, gin.H{
+		"schemas": []string{SchemaError},
+		"status":  strconv.Itoa(status),
+		"detail":  detail,
+	})
+}
+
+// writeDBError writes a SCIM error for a database write failure
+func writeDBError(c *gin.Context, err error) {
+	if errors.Is(err, database.ErrDuplicate) {
+		writeError(c, http.StatusConflict, err.Error())
+		return
+	}
+	writeError(c, http.StatusInternalServerError, err.Error())
+}
@@ -0,0 +1,104 @@
+package scim
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/gin-gonic/gin"
+)
+
+func setupTestRouter(t *testing.T) (*gin.Engine, *database.DB, func()) {
+	dbPath := "/tmp/test_scim.db"
+	os.Remove(dbPath)
+
+	db, err := database.New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	NewHandler(db, "scim-secret").RegisterRoutes(r.Group("/scim/v2"))
+
+	cleanup := func() {
+		db.Close()
+		os.Remove(dbPath)
+	}
+
+	return r, db, cleanup
+}
+
+func doRequest(r *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/scim+json")
+	req.Header.Set("Authorization", "Bearer scim-secret")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestSCIMUserLifecycle(t *testing.T) {
+	r, db, cleanup := setupTestRouter(t)
+	defer cleanup()
+
+	// Provision
+	w := doRequest(r, "POST", "/scim/v2/Users", `{"schemas":["urn:ietf:params:scim:schemas:core:2.0:User"],"userName":"alice","externalId":"hr-42"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var created User
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if created.Active == nil || !*created.Active {
+		t.Error("Expected provisioned user to be active")
+	}
+
+	user, _ := db.GetUserByExternalID("hr-42")
+	if user == nil || user.Name != "alice" || user.APIKey == "" {
+		t.Fatalf("Expected user with generated key, got %+v", user)
+	}
+
+	// Lookup by filter
+	w = doRequest(r, "GET", `/scim/v2/Users?filter=userName+eq+"alice"`, "")
+	var list ListResponse
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if list.TotalResults != 1 {
+		t.Errorf("Expected 1 filtered result, got %d", list.TotalResults)
+	}
+
+	// Deactivate via PATCH
+	w = doRequest(r, "PATCH", "/scim/v2/Users/"+created.ID, `{"schemas":["urn:ietf:params:scim:api:messages:2.0:PatchOp"],"Operations":[{"op":"replace","value":{"active":false}}]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	user, _ = db.GetUser(user.ID)
+	if user.Enabled {
+		t.Error("Expected user to be disabled after PATCH active=false")
+	}
+
+	// Duplicate userName
+	w = doRequest(r, "POST", "/scim/v2/Users", `{"userName":"alice"}`)
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409, got %d", w.Code)
+	}
+}
+
+func TestSCIMRequiresToken(t *testing.T) {
+	r, _, cleanup := setupTestRouter(t)
+	defer cleanup()
+
+	req := httptest.NewRequest("GET", "/scim/v2/Users", nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401, got %d", w.Code)
+	}
+}
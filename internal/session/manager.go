@@ -1,60 +1,45 @@
 package session
 
 import (
+	"math"
+	"math/rand"
 	"net/http"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/X0Ken/openai-gateway/pkg/store"
 )
 
+// CleanupInterval is how often expired sessions should be removed
+const CleanupInterval = 5 * time.Minute
+
 // Manager handles session business logic
 type Manager struct {
-	db            *database.DB
-	idleTimeout   time.Duration
-	cleanupTicker *time.Ticker
-	stopCh        chan struct{}
+	db store.Sessions
+	// idleTimeout is the minutes a session may go unused before it expires
+	idleTimeout atomic.Int64
 }
 
 // NewManager creates a new session manager
-func NewManager(db *database.DB, idleTimeoutMinutes int) *Manager {
-	return &Manager{
-		db:          db,
-		idleTimeout: time.Duration(idleTimeoutMinutes) * time.Minute,
-		stopCh:      make(chan struct{}),
-	}
-}
-
-// Start begins the session cleanup loop
-func (m *Manager) Start() {
-	m.cleanupTicker = time.NewTicker(5 * time.Minute)
-	go m.cleanupLoop()
-}
-
-// Stop stops the session cleanup loop
-func (m *Manager) Stop() {
-	if m.cleanupTicker != nil {
-		m.cleanupTicker.Stop()
-	}
-	close(m.stopCh)
+func NewManager(db store.Sessions, idleTimeoutMinutes int) *Manager {
+	m := &Manager{db: db}
+	m.SetIdleTimeout(idleTimeoutMinutes)
+	return m
 }
 
-// cleanupLoop periodically cleans up expired sessions
-func (m *Manager) cleanupLoop() {
-	for {
-		select {
-		case <-m.cleanupTicker.C:
-			m.CleanupExpired()
-		case <-m.stopCh:
-			return
-		}
-	}
+// SetIdleTimeout changes how long sessions may go unused before they
+// expire, such as after a configuration reload. It applies from the next
+// cleanup.
+func (m *Manager) SetIdleTimeout(minutes int) {
+	m.idleTimeout.Store(int64(minutes))
 }
 
 // CleanupExpired removes expired sessions
 func (m *Manager) CleanupExpired() error {
-	return m.db.DeleteExpiredSessions(int(m.idleTimeout.Minutes()))
+	return m.db.DeleteExpiredSessions(int(m.idleTimeout.Load()))
 }
 
 // GetSession retrieves a session by ID
@@ -77,6 +62,33 @@ func (m *Manager) DeleteSession(id int64) error {
 	return m.db.DeleteSession(id)
 }
 
+// MigrateChannel ends a random fraction of the sticky sessions on a channel,
+// so their next requests are routed afresh instead of waiting for the
+// sessions to expire. It returns the sessions it ended.
+func (m *Manager) MigrateChannel(channelID int64, fraction float64) ([]*database.Session, error) {
+	sessions, err := m.db.ListSessions()
+	if err != nil {
+		return nil, err
+	}
+
+	var onChannel []*database.Session
+	for _, s := range sessions {
+		if s.ChannelID == channelID {
+			onChannel = append(onChannel, s)
+		}
+	}
+	rand.Shuffle(len(onChannel), func(i, j int) { onChannel[i], onChannel[j] = onChannel[j], onChannel[i] })
+
+	n := int(math.Round(fraction * float64(len(onChannel))))
+	migrated := onChannel[:n]
+	for _, s := range migrated {
+		if err := m.db.DeleteSession(s.ID); err != nil {
+			return nil, err
+		}
+	}
+	return migrated, nil
+}
+
 // Handler handles HTTP requests for session management
 type Handler struct {
 	manager *Manager
@@ -0,0 +1,56 @@
+package session
+
+import (
+	"os"
+	"testing"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+)
+
+func TestMigrateChannel(t *testing.T) {
+	dbPath := "/tmp/test_session_migrate.db"
+	defer os.Remove(dbPath)
+
+	db, err := database.New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	for userID := int64(1); userID <= 4; userID++ {
+		db.CreateSession(&database.Session{UserID: userID, ChannelID: 1})
+	}
+	db.CreateSession(&database.Session{UserID: 5, ChannelID: 2})
+
+	m := NewManager(db, 30)
+	countOn := func(channelID int64) int {
+		sessions, _ := m.ListSessions()
+		n := 0
+		for _, s := range sessions {
+			if s.ChannelID == channelID {
+				n++
+			}
+		}
+		return n
+	}
+
+	migrated, err := m.MigrateChannel(1, 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrated) != 2 || countOn(1) != 2 {
+		t.Errorf("Expected half of 4 sessions migrated, got %d with %d left", len(migrated), countOn(1))
+	}
+	for _, s := range migrated {
+		if s.ChannelID != 1 {
+			t.Errorf("Expected only sessions on channel 1 to be migrated, got %+v", s)
+		}
+	}
+
+	if _, err := m.MigrateChannel(1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if countOn(1) != 0 || countOn(2) != 1 {
+		t.Errorf("Expected all sessions on channel 1 and none elsewhere migrated, got %d and %d left", countOn(1), countOn(2))
+	}
+}
@@ -0,0 +1,238 @@
+// Package slo evaluates service level objectives against the gateway's
+// metrics and alerts when an error budget burns too fast.
+//
+// Burn rates follow the multiwindow approach: an alert fires when both a long
+// and a short window burn faster than the threshold, so it triggers quickly
+// on a real incident and clears quickly once it is over.
+package slo
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/internal/alert"
+	"github.com/X0Ken/openai-gateway/internal/metrics"
+)
+
+// Objective types
+const (
+	// TypeAvailability counts requests that did not fail on the gateway or backend side
+	TypeAvailability = "availability"
+	// TypeLatency counts requests answered within the latency threshold
+	TypeLatency = "latency"
+)
+
+// Objective is a service level objective for one logical model, or for all
+// models when Model is empty
+type Objective struct {
+	Name  string
+	Model string
+	Type  string
+	// Target is the fraction of good requests, e.g. 0.999
+	Target float64
+	// LatencyThreshold is the latency a latency objective's good requests are within
+	LatencyThreshold time.Duration
+}
+
+// BurnWindow is a pair of windows whose burn rates must both exceed the
+// threshold for an alert of the given severity
+type BurnWindow struct {
+	Severity  string
+	Long      time.Duration
+	Short     time.Duration
+	Threshold float64
+}
+
+// DefaultBurnWindows page on a burn that would exhaust a 30-day budget in
+// about two days, and warn on one that would exhaust it in five
+var DefaultBurnWindows = []BurnWindow{
+	{Severity: "fast", Long: time.Hour, Short: 5 * time.Minute, Threshold: 14.4},
+	{Severity: "slow", Long: 6 * time.Hour, Short: 30 * time.Minute, Threshold: 6},
+}
+
+// Source returns the cumulative good and total request counts of an objective
+type Source func(o Objective) (good, total float64)
+
+// MetricsSource reads objective counts from the gateway's Prometheus metrics
+func MetricsSource(o Objective) (good, total float64) {
+	if o.Type == TypeLatency {
+		total, fast := metrics.ModelLatencyCounts(o.Model, o.LatencyThreshold.Seconds())
+		return fast, total
+	}
+	total, errors := metrics.ModelRequestCounts(o.Model)
+	return total - errors, total
+}
+
+// snapshot is the cumulative counts of an objective at a point in time
+type snapshot struct {
+	at    time.Time
+	good  float64
+	total float64
+}
+
+// Status is the current state of an objective
+type Status struct {
+	Name             string             `json:"name"`
+	Model            string             `json:"model,omitempty"`
+	Type             string             `json:"type"`
+	Target           float64            `json:"target"`
+	LatencyThreshold float64            `json:"latency_threshold,omitempty"`
+	BurnRates        map[string]float64 `json:"burn_rates"`
+	Alerting         []string           `json:"alerting"`
+}
+
+// Evaluator periodically computes the burn rates of objectives and raises an
+// alert when a burn window starts firing
+type Evaluator struct {
+	objectives []Objective
+	windows    []BurnWindow
+	source     Source
+	notifier   *alert.Notifier
+	interval   time.Duration
+
+	mu        sync.Mutex
+	history   map[string][]snapshot
+	burnRates map[string]map[string]float64
+	firing    map[string]map[string]bool
+}
+
+// NewEvaluator creates an evaluator for the objectives using the default
+// burn windows and the metrics source. Evaluate is meant to run every
+// interval.
+func NewEvaluator(objectives []Objective, interval time.Duration, notifier *alert.Notifier) *Evaluator {
+	return &Evaluator{
+		objectives: objectives,
+		windows:    DefaultBurnWindows,
+		source:     MetricsSource,
+		notifier:   notifier,
+		interval:   interval,
+		history:    make(map[string][]snapshot),
+		burnRates:  make(map[string]map[string]float64),
+		firing:     make(map[string]map[string]bool),
+	}
+}
+
+// Evaluate takes a snapshot of every objective, updates its burn rates and
+// alerts on windows that started firing
+func (e *Evaluator) Evaluate(now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	retain := e.interval
+	for _, w := range e.windows {
+		retain = max(retain, w.Long+e.interval)
+	}
+
+	for _, o := range e.objectives {
+		good, total := e.source(o)
+		history := append(e.history[o.Name], snapshot{at: now, good: good, total: total})
+		for len(history) > 1 && now.Sub(history[1].at) >= retain {
+			history = history[1:]
+		}
+		e.history[o.Name] = history
+
+		rates := make(map[string]float64)
+		if e.firing[o.Name] == nil {
+			e.firing[o.Name] = make(map[string]bool)
+		}
+		for _, w := range e.windows {
+			long := burnRate(history, w.Long, o.Target)
+			short := burnRate(history, w.Short, o.Target)
+			rates[windowLabel(w.Long)] = long
+			rates[windowLabel(w.Short)] = short
+
+			firing := long > w.Threshold && short > w.Threshold
+			if firing && !e.firing[o.Name][w.Severity] {
+				e.notify(o, w, long, short)
+			} else if !firing && e.firing[o.Name][w.Severity] {
+				log.Printf("SLO %s %s burn rate recovered", o.Name, w.Severity)
+			}
+			e.firing[o.Name][w.Severity] = firing
+		}
+		e.burnRates[o.Name] = rates
+		for window, rate := range rates {
+			metrics.SetSLOBurnRate(o.Name, window, rate)
+		}
+	}
+}
+
+// notify raises a burn rate alert
+func (e *Evaluator) notify(o Objective, w BurnWindow, long, short float64) {
+	e.notifier.Notify(alert.Alert{
+		Type:    alert.TypeSLOBurnRate,
+		Subject: o.Name,
+		Message: fmt.Sprintf("%s error budget burning at %.1fx over %s and %.1fx over %s (threshold %.1fx)",
+			w.Severity, long, windowLabel(w.Long), short, windowLabel(w.Short), w.Threshold),
+		Details: map[string]any{
+			"slo":       o.Name,
+			"model":     o.Model,
+			"type":      o.Type,
+			"target":    o.Target,
+			"severity":  w.Severity,
+			"burn_rate": map[string]float64{windowLabel(w.Long): long, windowLabel(w.Short): short},
+		},
+	})
+}
+
+// Status returns the current state of every objective
+func (e *Evaluator) Status() []Status {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	statuses := make([]Status, 0, len(e.objectives))
+	for _, o := range e.objectives {
+		s := Status{
+			Name:             o.Name,
+			Model:            o.Model,
+			Type:             o.Type,
+			Target:           o.Target,
+			LatencyThreshold: o.LatencyThreshold.Seconds(),
+			BurnRates:        e.burnRates[o.Name],
+			Alerting:         []string{},
+		}
+		if s.BurnRates == nil {
+			s.BurnRates = map[string]float64{}
+		}
+		for _, w := range e.windows {
+			if e.firing[o.Name][w.Severity] {
+				s.Alerting = append(s.Alerting, w.Severity)
+			}
+		}
+		statuses = append(statuses, s)
+	}
+	return statuses
+}
+
+// burnRate returns how many times faster than sustainable the error budget
+// burned over the window ending at the latest snapshot. While less history
+// than the window is available, the oldest snapshot is used.
+func burnRate(history []snapshot, window time.Duration, target float64) float64 {
+	if len(history) < 2 || target >= 1 {
+		return 0
+	}
+	latest := history[len(history)-1]
+	base := history[0]
+	for _, s := range history {
+		if latest.at.Sub(s.at) < window {
+			break
+		}
+		base = s
+	}
+
+	total := latest.total - base.total
+	if total <= 0 {
+		return 0
+	}
+	bad := total - (latest.good - base.good)
+	return (bad / total) / (1 - target)
+}
+
+// windowLabel formats a window for metric labels and status, e.g. "5m" or "6h"
+func windowLabel(d time.Duration) string {
+	if d%time.Hour == 0 {
+		return fmt.Sprintf("%dh", d/time.Hour)
+	}
+	return fmt.Sprintf("%dm", d/time.Minute)
+}
@@ -0,0 +1,77 @@
+package slo
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/internal/alert"
+)
+
+func TestBurnRate(t *testing.T) {
+	start := time.Now()
+	history := []snapshot{
+		{at: start, good: 0, total: 0},
+		{at: start.Add(time.Minute), good: 100, total: 100},
+		{at: start.Add(2 * time.Minute), good: 190, total: 200},
+	}
+
+	// Over the last minute 10 of 100 requests failed against a 1% budget
+	if got := burnRate(history, time.Minute, 0.99); math.Abs(got-10) > 1e-9 {
+		t.Errorf("Expected burn rate 10 over one minute, got %v", got)
+	}
+	// With less history than the window, all of it is used
+	if got := burnRate(history, time.Hour, 0.99); math.Abs(got-5) > 1e-9 {
+		t.Errorf("Expected burn rate 5 over the available history, got %v", got)
+	}
+	if got := burnRate(history[:1], time.Minute, 0.99); got != 0 {
+		t.Errorf("Expected no burn rate from a single snapshot, got %v", got)
+	}
+}
+
+func TestEvaluatorAlertsWhenBothWindowsBurn(t *testing.T) {
+	var good, total float64
+	e := NewEvaluator([]Objective{{Name: "chat", Type: TypeAvailability, Target: 0.99}}, time.Minute, alert.NewNotifier(""))
+	e.windows = []BurnWindow{{Severity: "fast", Long: 10 * time.Minute, Short: 2 * time.Minute, Threshold: 5}}
+	e.source = func(Objective) (float64, float64) { return good, total }
+
+	now := time.Now()
+	step := func(requests, failures float64) []string {
+		total += requests
+		good += requests - failures
+		now = now.Add(time.Minute)
+		e.Evaluate(now)
+		return e.Status()[0].Alerting
+	}
+
+	for range 10 {
+		if alerting := step(100, 0); len(alerting) != 0 {
+			t.Fatalf("Expected no alert while healthy, got %v", alerting)
+		}
+	}
+
+	// An outage burns both windows
+	if alerting := step(100, 100); len(alerting) != 1 || alerting[0] != "fast" {
+		t.Fatalf("Expected the fast burn alert, got %v", alerting)
+	}
+
+	// Once the outage leaves the short window, the alert clears
+	step(100, 0)
+	if alerting := step(100, 0); len(alerting) != 0 {
+		t.Errorf("Expected the alert to clear, got %v", alerting)
+	}
+
+	status := e.Status()[0]
+	if _, ok := status.BurnRates["10m"]; !ok {
+		t.Errorf("Expected a 10m burn rate, got %v", status.BurnRates)
+	}
+}
+
+func TestWindowLabel(t *testing.T) {
+	if got := windowLabel(6 * time.Hour); got != "6h" {
+		t.Errorf("Expected 6h, got %s", got)
+	}
+	if got := windowLabel(30 * time.Minute); got != "30m" {
+		t.Errorf("Expected 30m, got %s", got)
+	}
+}
@@ -0,0 +1,284 @@
+// Package statuspage polls provider status pages and reports declared
+// incidents, so that routing can move away from a provider before its errors
+// show up in the gateway's own metrics.
+//
+// Pages are read in the Atlassian Statuspage summary format
+// (/api/v2/summary.json), which OpenAI and Anthropic both publish.
+package statuspage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/internal/alert"
+	"github.com/X0Ken/openai-gateway/internal/metrics"
+)
+
+// Impact levels, in increasing order of severity
+const (
+	ImpactNone     = "none"
+	ImpactMinor    = "minor"
+	ImpactMajor    = "major"
+	ImpactCritical = "critical"
+)
+
+// impactLevels orders impacts; unknown values such as "maintenance" rank as none
+var impactLevels = map[string]int{
+	ImpactNone:     0,
+	ImpactMinor:    1,
+	ImpactMajor:    2,
+	ImpactCritical: 3,
+}
+
+// componentImpacts maps a component's status to the impact it represents
+var componentImpacts = map[string]string{
+	"degraded_performance": ImpactMinor,
+	"partial_outage":       ImpactMajor,
+	"major_outage":         ImpactCritical,
+}
+
+// ValidImpact reports whether impact is a known impact level
+func ValidImpact(impact string) bool {
+	_, ok := impactLevels[impact]
+	return ok
+}
+
+// Provider is a status page and the channels served by that provider
+type Provider struct {
+	Name string
+	// URL is the page's summary endpoint, e.g.
+	// https://status.openai.com/api/v2/summary.json
+	URL string
+	// Channels are glob patterns (path.Match syntax) of the names of the
+	// channels the provider serves
+	Channels []string
+	// Components, when set, limits the impact to these components, e.g.
+	// "API", instead of the page's overall indicator
+	Components []string
+}
+
+// Incident is an unresolved incident declared on a status page
+type Incident struct {
+	Name      string    `json:"name"`
+	Status    string    `json:"status"`
+	Impact    string    `json:"impact"`
+	URL       string    `json:"url,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// ProviderStatus is the last known state of a provider's status page
+type ProviderStatus struct {
+	Provider    string `json:"provider"`
+	Impact      string `json:"impact"`
+	Description string `json:"description,omitempty"`
+	// Affected reports whether the impact reaches the monitor's threshold,
+	// so the provider's channels are avoided
+	Affected  bool       `json:"affected"`
+	Incidents []Incident `json:"incidents"`
+	CheckedAt time.Time  `json:"checked_at,omitempty"`
+	// Error is why the last poll failed; the previous state is kept
+	Error string `json:"error,omitempty"`
+}
+
+// summary is the subset of a Statuspage summary used by the monitor
+type summary struct {
+	Status struct {
+		Indicator   string `json:"indicator"`
+		Description string `json:"description"`
+	} `json:"status"`
+	Components []struct {
+		Name   string `json:"name"`
+		Status string `json:"status"`
+	} `json:"components"`
+	Incidents []struct {
+		Name      string    `json:"name"`
+		Status    string    `json:"status"`
+		Impact    string    `json:"impact"`
+		Shortlink string    `json:"shortlink"`
+		CreatedAt time.Time `json:"created_at"`
+	} `json:"incidents"`
+}
+
+// Monitor periodically polls provider status pages
+type Monitor struct {
+	providers []Provider
+	minImpact string
+	notifier  *alert.Notifier
+	client    *http.Client
+
+	mu       sync.RWMutex
+	statuses map[string]*ProviderStatus
+}
+
+// NewMonitor creates a monitor of the providers' status pages. A provider's
+// channels are avoided while its impact is at least minImpact.
+func NewMonitor(providers []Provider, minImpact string, notifier *alert.Notifier) *Monitor {
+	statuses := make(map[string]*ProviderStatus, len(providers))
+	for _, p := range providers {
+		statuses[p.Name] = &ProviderStatus{Provider: p.Name, Impact: ImpactNone, Incidents: []Incident{}}
+	}
+	return &Monitor{
+		providers: providers,
+		minImpact: minImpact,
+		notifier:  notifier,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		statuses:  statuses,
+	}
+}
+
+// Poll fetches every status page once and alerts on providers that became
+// affected or recovered. It is meant to run every poll interval.
+func (m *Monitor) Poll(ctx context.Context) {
+	for _, p := range m.providers {
+		s, err := m.fetch(ctx, p.URL)
+		if err != nil {
+			log.Printf("Failed to poll status page of %s: %v", p.Name, err)
+			m.mu.Lock()
+			m.statuses[p.Name].Error = err.Error()
+			m.mu.Unlock()
+			continue
+		}
+		m.update(p, s, time.Now())
+	}
+}
+
+// fetch reads a status page summary
+func (m *Monitor) fetch(ctx context.Context, url string) (*summary, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status page returned status %d", resp.StatusCode)
+	}
+
+	var s summary
+	if err := json.NewDecoder(resp.Body).Decode(&s); err != nil {
+		return nil, fmt.Errorf("invalid status page summary: %w", err)
+	}
+	return &s, nil
+}
+
+// update records a provider's new state
+func (m *Monitor) update(p Provider, s *summary, now time.Time) {
+	status := &ProviderStatus{
+		Provider:    p.Name,
+		Impact:      impactOf(p, s),
+		Description: s.Status.Description,
+		Incidents:   []Incident{},
+		CheckedAt:   now,
+	}
+	status.Affected = impactLevels[status.Impact] >= impactLevels[m.minImpact]
+	for _, i := range s.Incidents {
+		status.Incidents = append(status.Incidents, Incident{
+			Name:      i.Name,
+			Status:    i.Status,
+			Impact:    i.Impact,
+			URL:       i.Shortlink,
+			StartedAt: i.CreatedAt,
+		})
+	}
+
+	m.mu.Lock()
+	previous := m.statuses[p.Name]
+	m.statuses[p.Name] = status
+	m.mu.Unlock()
+
+	metrics.SetProviderImpact(p.Name, impactLevels[status.Impact])
+	if status.Affected && !previous.Affected {
+		m.notify(status)
+	} else if !status.Affected && previous.Affected {
+		log.Printf("Provider %s status page recovered: %s", p.Name, status.Description)
+	}
+}
+
+// impactOf returns the impact of a summary on a provider: the worst status of
+// the provider's components, or otherwise the worse of the page indicator and
+// its unresolved incidents
+func impactOf(p Provider, s *summary) string {
+	impact := ImpactNone
+	raise := func(i string) {
+		if impactLevels[i] > impactLevels[impact] {
+			impact = i
+		}
+	}
+
+	if len(p.Components) > 0 {
+		for _, c := range s.Components {
+			for _, name := range p.Components {
+				if strings.EqualFold(c.Name, name) {
+					raise(componentImpacts[c.Status])
+				}
+			}
+		}
+		return impact
+	}
+
+	raise(s.Status.Indicator)
+	for _, i := range s.Incidents {
+		raise(i.Impact)
+	}
+	return impact
+}
+
+// notify raises a provider incident alert
+func (m *Monitor) notify(status *ProviderStatus) {
+	names := make([]string, 0, len(status.Incidents))
+	for _, i := range status.Incidents {
+		names = append(names, i.Name)
+	}
+	m.notifier.Notify(alert.Alert{
+		Type:    alert.TypeProviderIncident,
+		Subject: status.Provider,
+		Message: fmt.Sprintf("%s status page reports %s impact: %s", status.Provider, status.Impact, status.Description),
+		Details: map[string]any{
+			"provider":  status.Provider,
+			"impact":    status.Impact,
+			"incidents": names,
+		},
+	})
+}
+
+// Affected reports whether a channel belongs to a provider whose status page
+// currently declares an incident at or above the threshold
+func (m *Monitor) Affected(channelName string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, p := range m.providers {
+		if !m.statuses[p.Name].Affected {
+			continue
+		}
+		for _, pattern := range p.Channels {
+			if ok, _ := path.Match(pattern, channelName); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Status returns the last known state of every provider
+func (m *Monitor) Status() []ProviderStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	statuses := make([]ProviderStatus, 0, len(m.providers))
+	for _, p := range m.providers {
+		statuses = append(statuses, *m.statuses[p.Name])
+	}
+	return statuses
+}
@@ -0,0 +1,91 @@
+package statuspage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+const operational = `{
+	"status": {"indicator": "none", "description": "All Systems Operational"},
+	"components": [{"name": "API", "status": "operational"}, {"name": "ChatGPT", "status": "operational"}],
+	"incidents": []
+}`
+
+const chatOutage = `{
+	"status": {"indicator": "major", "description": "Partial System Outage"},
+	"components": [{"name": "API", "status": "degraded_performance"}, {"name": "ChatGPT", "status": "major_outage"}],
+	"incidents": [{"name": "ChatGPT unavailable", "status": "investigating", "impact": "major",
+		"shortlink": "https://stspg.io/abc", "created_at": "2026-10-16T10:00:00Z"}]
+}`
+
+// newStatusPage serves the summary stored in page
+func newStatusPage(page *atomic.Value) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := page.Load().(string)
+		if body == "" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+}
+
+func TestPollDetectsIncidents(t *testing.T) {
+	var page atomic.Value
+	page.Store(operational)
+	server := newStatusPage(&page)
+	defer server.Close()
+
+	m := NewMonitor([]Provider{{Name: "openai", URL: server.URL, Channels: []string{"openai-*"}}}, ImpactMajor, nil)
+
+	m.Poll(context.Background())
+	if m.Affected("openai-east") {
+		t.Error("Expected no channel to be affected while operational")
+	}
+
+	page.Store(chatOutage)
+	m.Poll(context.Background())
+	if !m.Affected("openai-east") {
+		t.Error("Expected the provider's channels to be affected during an incident")
+	}
+	if m.Affected("anthropic-main") {
+		t.Error("Expected other providers' channels to be unaffected")
+	}
+
+	status := m.Status()[0]
+	if status.Impact != ImpactMajor || len(status.Incidents) != 1 || status.Incidents[0].URL != "https://stspg.io/abc" {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+
+	// A failed poll keeps the last known state
+	page.Store("")
+	m.Poll(context.Background())
+	status = m.Status()[0]
+	if !status.Affected || status.Error == "" {
+		t.Errorf("Expected the previous state with an error, got %+v", status)
+	}
+}
+
+func TestComponentsLimitImpact(t *testing.T) {
+	var page atomic.Value
+	page.Store(chatOutage)
+	server := newStatusPage(&page)
+	defer server.Close()
+
+	m := NewMonitor([]Provider{{Name: "openai", URL: server.URL, Channels: []string{"openai-*"}, Components: []string{"api"}}}, ImpactMajor, nil)
+	m.Poll(context.Background())
+
+	// Only the API component counts, which is degraded, not down
+	if status := m.Status()[0]; status.Impact != ImpactMinor || status.Affected {
+		t.Errorf("Expected minor impact below the threshold, got %+v", status)
+	}
+
+	m = NewMonitor([]Provider{{Name: "openai", URL: server.URL, Channels: []string{"openai-*"}, Components: []string{"api"}}}, ImpactMinor, nil)
+	m.Poll(context.Background())
+	if !m.Affected("openai-east") {
+		t.Error("Expected a minor threshold to include degraded components")
+	}
+}
@@ -0,0 +1,191 @@
+// Package timeout bounds how long a handler may take to start its response,
+// so slow handlers such as admin endpoints stuck on database queries answer
+// with an error instead of holding the client indefinitely.
+package timeout
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/internal/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// Middleware returns a middleware giving later handlers d to start their
+// response. A handler still silent at the deadline has the client answered
+// with a 503 and its request context cancelled, and anything it writes
+// afterwards is discarded. Once a response has started the deadline no
+// longer applies, so streams run as long as they need. A d of zero or less
+// disables the deadline.
+func Middleware(d time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if d <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithCancel(c.Request.Context())
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		w := newWriter(c.Writer)
+		c.Writer = w
+		route := c.FullPath()
+		method := c.Request.Method
+
+		fired := make(chan struct{})
+		timer := time.AfterFunc(d, func() {
+			defer close(fired)
+			if !w.timeout(d) {
+				return
+			}
+			cancel()
+			metrics.RecordRequestTimeout(route)
+			log.Printf("Request %s %s timed out after %s", method, route, d)
+		})
+		// Runs even if a handler panics, so the timer never writes to a
+		// response that has been handed back to the server
+		defer func() {
+			if !timer.Stop() {
+				<-fired
+			}
+			c.Writer = w.ResponseWriter
+		}()
+
+		c.Next()
+	}
+}
+
+// writer passes a handler's response through to the client until the
+// deadline answered the request, after which the handler's writes are
+// discarded. Handlers set headers on a map of their own, copied to the
+// client's on each write, so the timer can answer while a handler is still
+// setting them.
+type writer struct {
+	gin.ResponseWriter
+	header http.Header
+
+	mu       sync.Mutex
+	timedOut bool
+}
+
+// newWriter wraps w for the timeout middleware
+func newWriter(w gin.ResponseWriter) *writer {
+	return &writer{ResponseWriter: w, header: w.Header().Clone()}
+}
+
+// timeout answers the client with a 503 unless the response has started,
+// and reports whether it did
+func (w *writer) timeout(d time.Duration) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.ResponseWriter.Written() {
+		return false
+	}
+	w.timedOut = true
+
+	body := fmt.Sprintf(`{"error":"request timed out after %s"}`, d)
+	header := w.ResponseWriter.Header()
+	header.Set("Content-Type", "application/json; charset=utf-8")
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	w.ResponseWriter.WriteHeader(http.StatusServiceUnavailable)
+	w.ResponseWriter.WriteString(body)
+	w.ResponseWriter.Flush()
+	return true
+}
+
+// syncHeader copies the handler's headers to the client's. Callers hold mu.
+func (w *writer) syncHeader() {
+	header := w.ResponseWriter.Header()
+	for name := range header {
+		if _, ok := w.header[name]; !ok {
+			delete(header, name)
+		}
+	}
+	for name, values := range w.header {
+		header[name] = values
+	}
+}
+
+// Header returns the handler's headers
+func (w *writer) Header() http.Header {
+	return w.header
+}
+
+// WriteHeader sets the response status unless the request timed out
+func (w *writer) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.timedOut {
+		w.ResponseWriter.WriteHeader(code)
+	}
+}
+
+// WriteHeaderNow sends the response headers unless the request timed out
+func (w *writer) WriteHeaderNow() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.timedOut {
+		w.syncHeader()
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+// Write writes to the client unless the request timed out. Discarded writes
+// report success so the handler runs to completion.
+func (w *writer) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return len(data), nil
+	}
+	w.syncHeader()
+	return w.ResponseWriter.Write(data)
+}
+
+// WriteString writes to the client unless the request timed out
+func (w *writer) WriteString(s string) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timedOut {
+		return len(s), nil
+	}
+	w.syncHeader()
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Flush flushes the response unless the request timed out
+func (w *writer) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.timedOut {
+		w.syncHeader()
+		w.ResponseWriter.Flush()
+	}
+}
+
+// Status returns the response status
+func (w *writer) Status() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.ResponseWriter.Status()
+}
+
+// Size returns the number of body bytes written to the client
+func (w *writer) Size() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.ResponseWriter.Size()
+}
+
+// Written reports whether the response has started
+func (w *writer) Written() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.ResponseWriter.Written()
+}
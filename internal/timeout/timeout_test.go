@@ -0,0 +1,59 @@
+package timeout
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	done := make(chan struct{})
+	r := gin.New()
+	r.Use(Middleware(50 * time.Millisecond))
+	r.GET("/fast", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+	r.GET("/slow", func(c *gin.Context) {
+		defer close(done)
+		<-c.Request.Context().Done()
+		c.Header("X-Late", "1")
+		c.JSON(http.StatusOK, gin.H{"status": "late"})
+	})
+	r.GET("/stream", func(c *gin.Context) {
+		c.Header("Content-Type", "text/event-stream")
+		c.Writer.WriteString("data: 1\n\n")
+		c.Writer.Flush()
+		time.Sleep(100 * time.Millisecond)
+		c.Writer.WriteString("data: 2\n\n")
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/fast", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "ok") {
+		t.Errorf("Expected the handler's response, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// The slow handler's context is cancelled and its response discarded
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/slow", nil))
+	<-done
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "timed out") {
+		t.Errorf("Expected a 503 timeout, got %d: %s", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "late") || w.Header().Get("X-Late") != "" {
+		t.Errorf("Expected the late response to be discarded, got %q", w.Body.String())
+	}
+
+	// A stream that started before the deadline runs to completion
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/stream", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "data: 1\n\ndata: 2\n\n" || w.Header().Get("Content-Type") != "text/event-stream" {
+		t.Errorf("Expected the whole stream, got %d %s: %q", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+	}
+}
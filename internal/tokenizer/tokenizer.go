@@ -0,0 +1,154 @@
+// Package tokenizer estimates prompt token counts without calling a backend.
+//
+// Estimates come from a pre-tokenizer that splits text the way OpenAI's BPE
+// encodings do (letters, digit groups, punctuation, whitespace) and a
+// per-encoding average of characters per token. They are close enough to
+// budget a request, not to bill one.
+package tokenizer
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Encoding describes the token statistics of a family of models
+type Encoding struct {
+	Name string
+	// LettersPerToken is the average number of letters per token in a word
+	LettersPerToken float64
+	// DigitsPerToken is the maximum number of digits merged into one token
+	DigitsPerToken int
+}
+
+// Bundled encodings
+var (
+	CL100K = Encoding{Name: "cl100k_base", LettersPerToken: 6, DigitsPerToken: 3}
+	O200K  = Encoding{Name: "o200k_base", LettersPerToken: 7, DigitsPerToken: 3}
+)
+
+// encodingPrefixes maps model name prefixes to encodings, checked in order
+var encodingPrefixes = []struct {
+	prefix   string
+	encoding Encoding
+}{
+	{"gpt-4o", O200K},
+	{"gpt-4.1", O200K},
+	{"gpt-5", O200K},
+	{"chatgpt-4o", O200K},
+	{"o1", O200K},
+	{"o3", O200K},
+	{"o4", O200K},
+}
+
+// Per-message overheads of the chat format
+const (
+	tokensPerMessage = 3
+	tokensPerName    = 1
+	tokensPerReply   = 3
+)
+
+// ForModel returns the encoding used to estimate tokens for a model. Models
+// without a known prefix use cl100k_base.
+func ForModel(model string) Encoding {
+	model = strings.ToLower(model)
+	for _, p := range encodingPrefixes {
+		if strings.HasPrefix(model, p.prefix) {
+			return p.encoding
+		}
+	}
+	return CL100K
+}
+
+// Message is a chat message to estimate
+type Message struct {
+	Role    string
+	Name    string
+	Content string
+}
+
+// CountMessages estimates the prompt tokens of a chat request, including the
+// tokens the chat format adds around each message and the reply
+func (e Encoding) CountMessages(messages []Message) int {
+	total := tokensPerReply
+	for _, m := range messages {
+		total += tokensPerMessage + e.Count(m.Role) + e.Count(m.Content)
+		if m.Name != "" {
+			total += tokensPerName + e.Count(m.Name)
+		}
+	}
+	return total
+}
+
+// Count estimates the number of tokens in text
+func (e Encoding) Count(text string) int {
+	total := 0
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case isIdeograph(r):
+			// CJK characters are rarely merged
+			total++
+			i++
+		case unicode.IsLetter(r):
+			j := i
+			for j < len(runes) && unicode.IsLetter(runes[j]) && !isIdeograph(runes[j]) {
+				j++
+			}
+			total += ceilDiv(float64(j-i), e.LettersPerToken)
+			i = j
+		case unicode.IsDigit(r):
+			j := i
+			for j < len(runes) && unicode.IsDigit(runes[j]) {
+				j++
+			}
+			total += ceilDiv(float64(j-i), float64(e.DigitsPerToken))
+			i = j
+		case r == ' ':
+			// A single space is merged into the following word
+			j := i
+			for j < len(runes) && runes[j] == ' ' {
+				j++
+			}
+			if j-i > 1 || j == len(runes) {
+				total++
+			}
+			i = j
+		case unicode.IsSpace(r):
+			j := i
+			for j < len(runes) && unicode.IsSpace(runes[j]) {
+				j++
+			}
+			total++
+			i = j
+		default:
+			// Punctuation and symbols merge in pairs on average
+			j := i
+			for j < len(runes) && isSymbol(runes[j]) {
+				j++
+			}
+			total += ceilDiv(float64(j-i), 2)
+			i = j
+		}
+	}
+	return total
+}
+
+// isIdeograph reports whether r belongs to a script written without spaces
+func isIdeograph(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// isSymbol reports whether r is neither a letter, digit nor whitespace
+func isSymbol(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsSpace(r)
+}
+
+// ceilDiv divides n by d rounding up, with a minimum of one
+func ceilDiv(n, d float64) int {
+	q := int(n / d)
+	if float64(q)*d < n {
+		q++
+	}
+	return max(q, 1)
+}
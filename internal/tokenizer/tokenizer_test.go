@@ -0,0 +1,55 @@
+package tokenizer
+
+import "testing"
+
+func TestForModel(t *testing.T) {
+	tests := map[string]string{
+		"gpt-4o-mini":   "o200k_base",
+		"GPT-4o":        "o200k_base",
+		"o1-preview":    "o200k_base",
+		"gpt-4":         "cl100k_base",
+		"gpt-3.5-turbo": "cl100k_base",
+		"llama-3-70b":   "cl100k_base",
+	}
+	for model, want := range tests {
+		if got := ForModel(model).Name; got != want {
+			t.Errorf("ForModel(%q) = %s, want %s", model, got, want)
+		}
+	}
+}
+
+func TestCount(t *testing.T) {
+	// Reference counts are from cl100k_base; estimates should be within 25%
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"Hello!", 2},
+		{"Hello, how are you today?", 7},
+		{"The quick brown fox jumps over the lazy dog.", 10},
+		{"12345678", 3},
+		{"你好世界", 4},
+	}
+	for _, tt := range tests {
+		got := CL100K.Count(tt.text)
+		if diff := float64(got-tt.want) / float64(tt.want); diff < -0.25 || diff > 0.25 {
+			t.Errorf("Count(%q) = %d, want about %d", tt.text, got, tt.want)
+		}
+	}
+
+	if got := CL100K.Count(""); got != 0 {
+		t.Errorf("Count(\"\") = %d, want 0", got)
+	}
+}
+
+func TestCountMessagesAddsFormatOverhead(t *testing.T) {
+	messages := []Message{
+		{Role: "system", Content: "You are helpful."},
+		{Role: "user", Content: "Hello!"},
+	}
+	content := CL100K.Count("system") + CL100K.Count("You are helpful.") + CL100K.Count("user") + CL100K.Count("Hello!")
+	want := content + 2*tokensPerMessage + tokensPerReply
+	if got := CL100K.CountMessages(messages); got != want {
+		t.Errorf("CountMessages = %d, want %d", got, want)
+	}
+}
@@ -0,0 +1,88 @@
+// Package version reports the gateway's build version.
+package version
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strings"
+)
+
+// Build variables, set at build time with
+// -ldflags "-X github.com/X0Ken/openai-gateway/internal/version.Version=v1.2.3"
+var (
+	// Version is the release version
+	Version = "dev"
+	// Commit overrides the commit embedded by the Go toolchain, for builds
+	// outside a git checkout
+	Commit = ""
+	// BuildDate is the build time, conventionally RFC 3339
+	BuildDate = ""
+	// Features is a comma-separated list of the features enabled in the build
+	Features = ""
+)
+
+// Info describes the running build
+type Info struct {
+	Version   string   `json:"version"`
+	Commit    string   `json:"commit,omitempty"`
+	Modified  bool     `json:"modified,omitempty"`
+	BuildDate string   `json:"build_date,omitempty"`
+	GoVersion string   `json:"go_version"`
+	Features  []string `json:"features"`
+}
+
+// Get returns the build information. Unless set at build time, the commit
+// comes from the VCS metadata the Go toolchain embeds when building from a
+// checkout.
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+		Features:  parseFeatures(Features),
+	}
+	if build, ok := debug.ReadBuildInfo(); ok && Commit == "" {
+		for _, setting := range build.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				info.Commit = setting.Value
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+	return info
+}
+
+// parseFeatures splits a comma-separated feature list into sorted, unique
+// names
+func parseFeatures(list string) []string {
+	features := []string{}
+	for _, feature := range strings.Split(list, ",") {
+		if feature = strings.TrimSpace(feature); feature != "" {
+			features = append(features, feature)
+		}
+	}
+	slices.Sort(features)
+	return slices.Compact(features)
+}
+
+// String formats the build information on one line
+func (i Info) String() string {
+	s := "gateway " + i.Version
+	if i.Commit != "" {
+		commit := i.Commit
+		if len(commit) > 12 {
+			commit = commit[:12]
+		}
+		s += " (" + commit
+		if i.Modified {
+			s += ", modified"
+		}
+		s += ")"
+	}
+	return fmt.Sprintf("%s %s", s, i.GoVersion)
+}
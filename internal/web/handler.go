@@ -36,11 +36,20 @@ func (h *Handler) Index(c *gin.Context) {
         button { padding: 8px 16px; margin: 5px; cursor: pointer; }
         .enabled { color: green; }
         .disabled { color: red; }
+        .maintenance { color: orange; }
+        .auth-failed { color: red; font-weight: bold; }
+        .test-only { color: purple; }
     </style>
 </head>
 <body>
     <h1>OpenAI Gateway Admin</h1>
     
+    <div class="section">
+        <h2>Admin Token</h2>
+        <input id="admin-token" type="password" placeholder="Admin token">
+        <button onclick="saveToken()">Save</button>
+    </div>
+    
     <div class="section">
         <h2>Models</h2>
         <div id="models"></div>
@@ -53,6 +62,13 @@ func (h *Handler) Index(c *gin.Context) {
         <button onclick="loadChannels()">Refresh</button>
     </div>
     
+    <div class="section">
+        <h2>Compare Channels</h2>
+        <input id="compare-model" placeholder="Model name">
+        <button onclick="loadComparison()">Compare</button>
+        <div id="comparison"></div>
+    </div>
+    
     <div class="section">
         <h2>Users</h2>
         <div id="users"></div>
@@ -66,26 +82,45 @@ func (h *Handler) Index(c *gin.Context) {
     </div>
     
     <script>
+        document.getElementById('admin-token').value = localStorage.getItem('adminToken') || '';
+        
+        function saveToken() {
+            localStorage.setItem('adminToken', document.getElementById('admin-token').value);
+        }
+        
+        // api fetches an admin API path with the saved admin token
+        function api(path) {
+            const token = localStorage.getItem('adminToken');
+            return fetch(path, token ? { headers: { 'Authorization': 'Bearer ' + token } } : {});
+        }
+        
         async function loadModels() {
-            const resp = await fetch('/api/models');
+            const resp = await api('/api/models');
             const models = await resp.json();
             document.getElementById('models').innerHTML = renderModels(models);
         }
         
         async function loadChannels() {
-            const resp = await fetch('/api/channels');
+            const resp = await api('/api/channels');
             const channels = await resp.json();
             document.getElementById('channels').innerHTML = renderChannels(channels);
         }
         
+        async function loadComparison() {
+            const model = document.getElementById('compare-model').value;
+            const resp = await api('/api/channels/compare?model=' + encodeURIComponent(model));
+            const result = await resp.json();
+            document.getElementById('comparison').innerHTML = resp.ok ? renderComparison(result.channels) : '<p>' + escapeHTML(result.error) + '</p>';
+        }
+        
         async function loadUsers() {
-            const resp = await fetch('/api/users');
+            const resp = await api('/api/users');
             const users = await resp.json();
             document.getElementById('users').innerHTML = renderUsers(users);
         }
         
         async function loadSessions() {
-            const resp = await fetch('/api/sessions');
+            const resp = await api('/api/sessions');
             const sessions = await resp.json();
             document.getElementById('sessions').innerHTML = renderSessions(sessions);
         }
@@ -100,12 +135,43 @@ func (h *Handler) Index(c *gin.Context) {
             return html;
         }
         
+        function escapeHTML(text) {
+            const div = document.createElement('div');
+            div.textContent = text;
+            return div.innerHTML;
+        }
+        
         function renderChannels(channels) {
             if (!channels || channels.length === 0) return '<p>No channels configured</p>';
-            let html = '<table><tr><th>ID</th><th>Name</th><th>Base URL</th><th>Weight</th><th>Status</th></tr>';
+            let html = '<table><tr><th>ID</th><th>Name</th><th>Base URL</th><th>Weight</th><th>Status</th><th>Notes</th></tr>';
             channels.forEach(ch => {
-                const status = ch.enabled ? '<span class="enabled">Enabled</span>' : '<span class="disabled">Disabled</span>';
-                html += '<tr><td>' + ch.id + '</td><td>' + ch.name + '</td><td>' + ch.base_url + '</td><td>' + ch.weight + '</td><td>' + status + '</td></tr>';
+                let status = ch.enabled ? '<span class="enabled">Enabled</span>' : '<span class="disabled">Disabled</span>';
+                if (ch.enabled && ch.maintenance_until && new Date(ch.maintenance_until) > new Date()) {
+                    status = '<span class="maintenance">Maintenance until ' + new Date(ch.maintenance_until).toLocaleString() + '</span>';
+                }
+                if (ch.status === 'auth_failed') {
+                    status = '<span class="auth-failed">Auth failed</span>';
+                }
+                if (ch.test_only) {
+                    status += ' <span class="test-only">Test only</span>';
+                }
+                html += '<tr><td>' + ch.id + '</td><td>' + ch.name + '</td><td>' + ch.base_url + '</td><td>' + ch.weight + '</td><td>' + status + '</td><td>' + escapeHTML(ch.notes || '') + '</td></tr>';
+            });
+            html += '</table>';
+            return html;
+        }
+        
+        function formatSeconds(value) {
+            return value === null ? '-' : (value * 1000).toFixed(0) + ' ms';
+        }
+        
+        function renderComparison(rows) {
+            if (!rows || rows.length === 0) return '<p>No channels serve this model</p>';
+            let html = '<table><tr><th>Channel</th><th>Backend Model</th><th>Weight</th><th>p50</th><th>p90</th><th>p99</th><th>Error Rate</th><th>Requests</th><th>Tokens (prompt / completion)</th><th>Health</th></tr>';
+            rows.forEach(r => {
+                let health = r.health ? r.health.status : 'unknown';
+                if (r.status === 'auth_failed') health = '<span class="auth-failed">Auth failed</span>';
+                html += '<tr><td>' + escapeHTML(r.channel_name) + '</td><td>' + escapeHTML(r.backend_model_name) + '</td><td>' + r.weight + '</td><td>' + formatSeconds(r.latency.p50) + '</td><td>' + formatSeconds(r.latency.p90) + '</td><td>' + formatSeconds(r.latency.p99) + '</td><td>' + (r.error_rate * 100).toFixed(1) + '%</td><td>' + r.request_count + '</td><td>' + r.prompt_tokens + ' / ' + r.completion_tokens + '</td><td>' + health + '</td></tr>';
             });
             html += '</table>';
             return html;
@@ -1,13 +1,36 @@
 package main
 
 import (
+	"fmt"
 	"log"
+	"os"
 
 	"github.com/X0Ken/openai-gateway/cmd/server"
 )
 
+// commands maps subcommands to their entry points; without one the server runs
+var commands = map[string]func(args []string) error{
+	"serve":     func([]string) error { return server.Run() },
+	"check":     server.Check,
+	"integrity": server.Integrity,
+	"migrate":   server.Migrate,
+	"replay":    server.Replay,
+	"version":   server.Version,
+}
+
 func main() {
-	if err := server.Run(); err != nil {
+	name, args := "serve", []string{}
+	if len(os.Args) > 1 {
+		name, args = os.Args[1], os.Args[2:]
+	}
+
+	run, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\nUsage: gateway [serve|check|integrity|migrate|replay|version] [flags]\n", name)
+		os.Exit(2)
+	}
+
+	if err := run(args); err != nil {
 		log.Fatal(err)
 	}
 }
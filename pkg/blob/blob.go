@@ -0,0 +1,42 @@
+// Package blob stores backup files on local disk or in an S3-compatible
+// bucket. Database backups are its only user.
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// ErrNotFound is returned when a blob does not exist
+var ErrNotFound = errors.New("blob not found")
+
+// ErrInvalidKey is returned for a key that is empty, absolute or escapes
+// the store with ".."
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// Store keeps blobs under slash-separated keys
+type Store interface {
+	// Put stores size bytes of body under key, replacing any blob there.
+	// body may be read more than once.
+	Put(ctx context.Context, key string, body io.ReadSeeker, size int64, contentType string) error
+	// Get returns the content of a blob, which the caller must close
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes a blob; deleting a missing blob succeeds
+	Delete(ctx context.Context, key string) error
+}
+
+// cleanKey validates a key and returns it in canonical form
+func cleanKey(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") {
+		return "", fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	cleaned := path.Clean(key)
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	return cleaned, nil
+}
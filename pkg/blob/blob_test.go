@@ -0,0 +1,97 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/X0Ken/openai-gateway/pkg/s3"
+)
+
+// testStore checks the behavior every store shares
+func testStore(t *testing.T, store Store) {
+	t.Helper()
+	ctx := context.Background()
+
+	content := []byte("large artifact")
+	if err := store.Put(ctx, "batches/1/output.jsonl", bytes.NewReader(content), int64(len(content)), "application/jsonl"); err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := store.Get(ctx, "batches/1/output.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(body)
+	body.Close()
+	if string(got) != string(content) {
+		t.Errorf("Expected %q, got %q", content, got)
+	}
+
+	if err := store.Delete(ctx, "batches/1/output.jsonl"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(ctx, "batches/1/output.jsonl"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after delete, got %v", err)
+	}
+	if err := store.Delete(ctx, "batches/1/output.jsonl"); err != nil {
+		t.Errorf("Expected deleting a missing blob to succeed, got %v", err)
+	}
+
+	for _, key := range []string{"", "/etc/passwd", "../outside", "a/../../outside"} {
+		if err := store.Put(ctx, key, bytes.NewReader(nil), 0, ""); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Key %q: expected ErrInvalidKey, got %v", key, err)
+		}
+	}
+}
+
+func TestLocal(t *testing.T) {
+	testStore(t, NewLocal(t.TempDir()))
+}
+
+func TestS3(t *testing.T) {
+	// A minimal in-memory bucket
+	var mu sync.Mutex
+	objects := map[string][]byte{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodPut:
+			objects[r.URL.Path], _ = io.ReadAll(r.Body)
+		case http.MethodGet:
+			data, ok := objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(data)
+		case http.MethodDelete:
+			delete(objects, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	client, err := s3.New(s3.Config{Endpoint: server.URL, Bucket: "artifacts", AccessKeyID: "id", SecretAccessKey: "secret", PathStyle: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewS3(client, "prod")
+
+	content := []byte("x")
+	store.Put(context.Background(), "files/a", bytes.NewReader(content), 1, "")
+	mu.Lock()
+	_, ok := objects["/artifacts/prod/files/a"]
+	mu.Unlock()
+	if !ok {
+		t.Error("Expected the key under the prefix")
+	}
+
+	testStore(t, store)
+}
@@ -0,0 +1,62 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+
+	"github.com/X0Ken/openai-gateway/pkg/s3"
+)
+
+// S3 stores blobs in an S3-compatible bucket, under a key prefix
+type S3 struct {
+	client *s3.Client
+	prefix string
+}
+
+// NewS3 creates a store keeping blobs in client's bucket, with prefix
+// prepended to their keys
+func NewS3(client *s3.Client, prefix string) *S3 {
+	return &S3{client: client, prefix: prefix}
+}
+
+// Put uploads a blob
+func (s *S3) Put(ctx context.Context, key string, body io.ReadSeeker, size int64, contentType string) error {
+	objectKey, err := s.key(key)
+	if err != nil {
+		return err
+	}
+	return s.client.PutObject(ctx, objectKey, body, size, contentType)
+}
+
+// Get downloads a blob
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	objectKey, err := s.key(key)
+	if err != nil {
+		return nil, err
+	}
+	body, err := s.client.GetObject(ctx, objectKey)
+	if errors.Is(err, s3.ErrNotFound) {
+		return nil, ErrNotFound
+	}
+	return body, err
+}
+
+// Delete deletes a blob
+func (s *S3) Delete(ctx context.Context, key string) error {
+	objectKey, err := s.key(key)
+	if err != nil {
+		return err
+	}
+	return s.client.DeleteObject(ctx, objectKey)
+}
+
+// key returns the object key of a blob
+func (s *S3) key(key string) (string, error) {
+	cleaned, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(s.prefix, cleaned), nil
+}
@@ -0,0 +1,99 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AdminToken is a bearer token accepted by the admin API. The token itself
+// is only returned when it is created.
+type AdminToken struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Token     string    `json:"token,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreateAdminToken creates a new admin token
+func (db *DB) CreateAdminToken(token *AdminToken) error {
+	result, err := db.Exec("INSERT INTO admin_tokens (name, token) VALUES (?, ?)", token.Name, token.Token)
+	if cols := uniqueColumns(err); cols != nil {
+		if len(cols) == 1 && strings.HasSuffix(cols[0], ".token") {
+			return duplicateError("admin token")
+		}
+		return duplicateError(fmt.Sprintf("admin token name %q", token.Name))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create admin token: %w", err)
+	}
+
+	token.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// GetAdminTokenByToken retrieves an admin token by its value
+func (db *DB) GetAdminTokenByToken(value string) (*AdminToken, error) {
+	var token AdminToken
+	err := db.QueryRow("SELECT id, name, created_at FROM admin_tokens WHERE token = ?", value).Scan(&token.ID, &token.Name, &token.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get admin token: %w", err)
+	}
+	return &token, nil
+}
+
+// ListAdminTokens retrieves all admin tokens without their values
+func (db *DB) ListAdminTokens() ([]*AdminToken, error) {
+	rows, err := db.Query("SELECT id, name, created_at FROM admin_tokens ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list admin tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []*AdminToken
+	for rows.Next() {
+		var token AdminToken
+		if err := rows.Scan(&token.ID, &token.Name, &token.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan admin token: %w", err)
+		}
+		tokens = append(tokens, &token)
+	}
+
+	return tokens, rows.Err()
+}
+
+// CountAdminTokens returns the number of admin tokens
+func (db *DB) CountAdminTokens() (int64, error) {
+	var count int64
+	if err := db.QueryRow("SELECT COUNT(*) FROM admin_tokens").Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count admin tokens: %w", err)
+	}
+	return count, nil
+}
+
+// DeleteAdminToken deletes an admin token by ID
+func (db *DB) DeleteAdminToken(id int64) error {
+	_, err := db.Exec("DELETE FROM admin_tokens WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete admin token: %w", err)
+	}
+	return nil
+}
+
+// Empty reports whether the database has no channels, models, users or
+// admin tokens, as on first start
+func (db *DB) Empty() (bool, error) {
+	var found bool
+	err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM channels)
+		OR EXISTS (SELECT 1 FROM models)
+		OR EXISTS (SELECT 1 FROM users)
+		OR EXISTS (SELECT 1 FROM admin_tokens)`).Scan(&found)
+	if err != nil {
+		return false, fmt.Errorf("failed to check for existing data: %w", err)
+	}
+	return !found, nil
+}
@@ -0,0 +1,52 @@
+package database
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestAdminTokens(t *testing.T) {
+	dbPath := "/tmp/test_admin_tokens.db"
+	defer os.Remove(dbPath)
+
+	db, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	if empty, err := db.Empty(); err != nil || !empty {
+		t.Fatalf("Expected a new database to be empty, got %v, %v", empty, err)
+	}
+
+	token := &AdminToken{Name: "ops", Token: "gw-admin-1"}
+	if err := db.CreateAdminToken(token); err != nil {
+		t.Fatalf("Failed to create admin token: %v", err)
+	}
+	if empty, _ := db.Empty(); empty {
+		t.Error("Expected a database with an admin token not to be empty")
+	}
+
+	if err := db.CreateAdminToken(&AdminToken{Name: "ops", Token: "gw-admin-2"}); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("Expected duplicate name error, got %v", err)
+	}
+	if err := db.CreateAdminToken(&AdminToken{Name: "ci", Token: "gw-admin-1"}); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("Expected duplicate token error, got %v", err)
+	}
+
+	found, err := db.GetAdminTokenByToken("gw-admin-1")
+	if err != nil || found == nil || found.ID != token.ID || found.Token != "" {
+		t.Fatalf("Expected token %d without its value, got %+v, %v", token.ID, found, err)
+	}
+	if found, _ := db.GetAdminTokenByToken("nope"); found != nil {
+		t.Errorf("Expected no token, got %+v", found)
+	}
+
+	if err := db.DeleteAdminToken(token.ID); err != nil {
+		t.Fatalf("Failed to delete admin token: %v", err)
+	}
+	if count, _ := db.CountAdminTokens(); count != 0 {
+		t.Errorf("Expected no admin tokens, got %d", count)
+	}
+}
@@ -0,0 +1,177 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// analyticsBucket is the granularity chat completions are aggregated at
+const analyticsBucket = time.Hour
+
+// CompletionStats describes one completed chat completion for analytics
+type CompletionStats struct {
+	Model  string
+	UserID int64
+	// EndUser is the request's OpenAI "user" field, identifying the API
+	// key holder's own end user
+	EndUser      string
+	FinishReason string
+	// HasUsage is false when the backend did not report token usage
+	HasUsage         bool
+	PromptTokens     int
+	CompletionTokens int
+	At               time.Time
+}
+
+// RecordCompletionStats adds a chat completion to its hourly aggregate
+func (db *DB) RecordCompletionStats(stats CompletionStats) error {
+	bucket := stats.At.Truncate(analyticsBucket).Unix()
+	var usageRequests int
+	if stats.HasUsage {
+		usageRequests = 1
+	}
+
+	_, err := db.Exec(`INSERT INTO request_analytics (bucket, model, user_id, end_user, finish_reason, requests, usage_requests, prompt_tokens, completion_tokens)
+		VALUES (?, ?, ?, ?, ?, 1, ?, ?, ?)
+		ON CONFLICT(bucket, model, user_id, end_user, finish_reason) DO UPDATE SET
+			requests = requests + 1,
+			usage_requests = usage_requests + excluded.usage_requests,
+			prompt_tokens = prompt_tokens + excluded.prompt_tokens,
+			completion_tokens = completion_tokens + excluded.completion_tokens`,
+		bucket, stats.Model, stats.UserID, stats.EndUser, stats.FinishReason, usageRequests, stats.PromptTokens, stats.CompletionTokens,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record completion stats: %w", err)
+	}
+	return nil
+}
+
+// AnalyticsQuery selects and groups chat completion aggregates
+type AnalyticsQuery struct {
+	// Model, UserID and EndUser filter when set
+	Model   string
+	UserID  int64
+	EndUser string
+	// From and To bound the time range; To is exclusive
+	From time.Time
+	To   time.Time
+	// Interval is the width of each returned bucket, a multiple of an hour
+	Interval time.Duration
+	// ByModel, ByUser and ByEndUser split buckets per model, per user and
+	// per end user
+	ByModel   bool
+	ByUser    bool
+	ByEndUser bool
+}
+
+// AnalyticsBucket aggregates chat completions over an interval
+type AnalyticsBucket struct {
+	Start   time.Time `json:"start"`
+	Model   string    `json:"model,omitempty"`
+	UserID  int64     `json:"user_id,omitempty"`
+	EndUser string    `json:"end_user,omitempty"`
+	// Requests counts completions; token averages are over the UsageRequests
+	// whose backend reported usage
+	Requests            int64            `json:"requests"`
+	UsageRequests       int64            `json:"usage_requests"`
+	PromptTokens        int64            `json:"prompt_tokens"`
+	CompletionTokens    int64            `json:"completion_tokens"`
+	AvgPromptTokens     float64          `json:"avg_prompt_tokens"`
+	AvgCompletionTokens float64          `json:"avg_completion_tokens"`
+	FinishReasons       map[string]int64 `json:"finish_reasons"`
+}
+
+// QueryAnalytics returns chat completion aggregates in time order
+func (db *DB) QueryAnalytics(q AnalyticsQuery) ([]*AnalyticsBucket, error) {
+	interval := int64(max(q.Interval, analyticsBucket) / time.Second)
+
+	groups := []string{"start"}
+	columns := "(bucket / ?) * ? AS start"
+	if q.ByModel {
+		columns += ", model"
+		groups = append(groups, "model")
+	} else {
+		columns += ", ''"
+	}
+	if q.ByUser {
+		columns += ", user_id"
+		groups = append(groups, "user_id")
+	} else {
+		columns += ", 0"
+	}
+	if q.ByEndUser {
+		columns += ", end_user"
+		groups = append(groups, "end_user")
+	} else {
+		columns += ", ''"
+	}
+
+	where := []string{"1 = 1"}
+	args := []any{interval, interval}
+	if q.Model != "" {
+		where = append(where, "model = ?")
+		args = append(args, q.Model)
+	}
+	if q.UserID != 0 {
+		where = append(where, "user_id = ?")
+		args = append(args, q.UserID)
+	}
+	if q.EndUser != "" {
+		where = append(where, "end_user = ?")
+		args = append(args, q.EndUser)
+	}
+	if !q.From.IsZero() {
+		where = append(where, "bucket >= ?")
+		args = append(args, q.From.Truncate(analyticsBucket).Unix())
+	}
+	if !q.To.IsZero() {
+		where = append(where, "bucket < ?")
+		args = append(args, q.To.Unix())
+	}
+
+	query := fmt.Sprintf(`SELECT %s, finish_reason, SUM(requests), SUM(usage_requests), SUM(prompt_tokens), SUM(completion_tokens)
+		FROM request_analytics WHERE %s GROUP BY %s, finish_reason ORDER BY %s, finish_reason`,
+		columns, strings.Join(where, " AND "), strings.Join(groups, ", "), strings.Join(groups, ", "))
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query analytics: %w", err)
+	}
+	defer rows.Close()
+
+	var buckets []*AnalyticsBucket
+	var current *AnalyticsBucket
+	for rows.Next() {
+		var start int64
+		var model, endUser, finishReason string
+		var userID, requests, usageRequests, promptTokens, completionTokens int64
+		if err := rows.Scan(&start, &model, &userID, &endUser, &finishReason, &requests, &usageRequests, &promptTokens, &completionTokens); err != nil {
+			return nil, fmt.Errorf("failed to scan analytics: %w", err)
+		}
+
+		if current == nil || current.Start.Unix() != start || current.Model != model || current.UserID != userID || current.EndUser != endUser {
+			current = &AnalyticsBucket{Start: time.Unix(start, 0).UTC(), Model: model, UserID: userID, EndUser: endUser, FinishReasons: map[string]int64{}}
+			buckets = append(buckets, current)
+		}
+		current.Requests += requests
+		current.UsageRequests += usageRequests
+		current.PromptTokens += promptTokens
+		current.CompletionTokens += completionTokens
+		if finishReason == "" {
+			finishReason = "unknown"
+		}
+		current.FinishReasons[finishReason] += requests
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query analytics: %w", err)
+	}
+
+	for _, b := range buckets {
+		if b.UsageRequests > 0 {
+			b.AvgPromptTokens = float64(b.PromptTokens) / float64(b.UsageRequests)
+			b.AvgCompletionTokens = float64(b.CompletionTokens) / float64(b.UsageRequests)
+		}
+	}
+	return buckets, nil
+}
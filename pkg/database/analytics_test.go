@@ -0,0 +1,82 @@
+package database
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCompletionAnalytics(t *testing.T) {
+	dbPath := "/tmp/test_analytics.db"
+	defer os.Remove(dbPath)
+
+	db, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	day := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	records := []CompletionStats{
+		{Model: "gpt-4", UserID: 1, FinishReason: "stop", HasUsage: true, PromptTokens: 100, CompletionTokens: 10, At: day.Add(10 * time.Minute)},
+		{Model: "gpt-4", UserID: 1, FinishReason: "length", HasUsage: true, PromptTokens: 300, CompletionTokens: 50, At: day.Add(20 * time.Minute)},
+		{Model: "gpt-4", UserID: 2, FinishReason: "stop", At: day.Add(90 * time.Minute)},
+		{Model: "gpt-3.5", UserID: 2, FinishReason: "stop", HasUsage: true, PromptTokens: 20, CompletionTokens: 5, At: day.Add(30 * time.Minute)},
+	}
+	for _, r := range records {
+		if err := db.RecordCompletionStats(r); err != nil {
+			t.Fatalf("Failed to record completion stats: %v", err)
+		}
+	}
+
+	buckets, err := db.QueryAnalytics(AnalyticsQuery{Model: "gpt-4", Interval: time.Hour})
+	if err != nil {
+		t.Fatalf("Failed to query analytics: %v", err)
+	}
+	if len(buckets) != 2 {
+		t.Fatalf("Expected 2 hourly buckets, got %d", len(buckets))
+	}
+	first := buckets[0]
+	if !first.Start.Equal(day) || first.Requests != 2 || first.UsageRequests != 2 {
+		t.Errorf("Unexpected first bucket %+v", first)
+	}
+	if first.AvgPromptTokens != 200 || first.AvgCompletionTokens != 30 {
+		t.Errorf("Expected averages 200/30, got %v/%v", first.AvgPromptTokens, first.AvgCompletionTokens)
+	}
+	if first.FinishReasons["stop"] != 1 || first.FinishReasons["length"] != 1 {
+		t.Errorf("Unexpected finish reasons %v", first.FinishReasons)
+	}
+	if second := buckets[1]; second.Requests != 1 || second.UsageRequests != 0 || second.AvgPromptTokens != 0 {
+		t.Errorf("Expected a bucket without usage, got %+v", second)
+	}
+
+	buckets, err = db.QueryAnalytics(AnalyticsQuery{From: day, To: day.Add(24 * time.Hour), Interval: 24 * time.Hour, ByModel: true})
+	if err != nil {
+		t.Fatalf("Failed to query analytics: %v", err)
+	}
+	if len(buckets) != 2 || buckets[0].Model != "gpt-3.5" || buckets[1].Model != "gpt-4" || buckets[1].Requests != 3 {
+		t.Fatalf("Expected daily buckets per model, got %+v", buckets)
+	}
+
+	if err := db.RecordCompletionStats(CompletionStats{Model: "gpt-4", UserID: 3, EndUser: "customer-a", FinishReason: "stop", At: day}); err != nil {
+		t.Fatalf("Failed to record completion stats: %v", err)
+	}
+	if err := db.RecordCompletionStats(CompletionStats{Model: "gpt-4", UserID: 3, EndUser: "customer-b", FinishReason: "stop", At: day}); err != nil {
+		t.Fatalf("Failed to record completion stats: %v", err)
+	}
+	buckets, err = db.QueryAnalytics(AnalyticsQuery{UserID: 3, Interval: 24 * time.Hour, ByEndUser: true})
+	if err != nil {
+		t.Fatalf("Failed to query analytics: %v", err)
+	}
+	if len(buckets) != 2 || buckets[0].EndUser != "customer-a" || buckets[1].EndUser != "customer-b" || buckets[1].Requests != 1 {
+		t.Errorf("Expected one bucket per end user, got %+v", buckets)
+	}
+
+	buckets, err = db.QueryAnalytics(AnalyticsQuery{UserID: 2, Interval: 24 * time.Hour, ByUser: true})
+	if err != nil {
+		t.Fatalf("Failed to query analytics: %v", err)
+	}
+	if len(buckets) != 1 || buckets[0].UserID != 2 || buckets[0].Requests != 2 || buckets[0].FinishReasons["stop"] != 2 {
+		t.Errorf("Expected one daily bucket for user 2, got %+v", buckets)
+	}
+}
@@ -0,0 +1,186 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// PrimaryKeyName is the name of the key a user is created with
+const PrimaryKeyName = "primary"
+
+// APIKey is a named key of a user. Every user has one primary key, created
+// with it and replaced by rotation, and any number of additional keys.
+// Usage made with a key is attributed to it.
+type APIKey struct {
+	ID     int64  `json:"id"`
+	UserID int64  `json:"user_id"`
+	Name   string `json:"name"`
+	// Key is only returned when the key is created
+	Key     string `json:"key,omitempty"`
+	Primary bool   `json:"primary"`
+	Enabled bool   `json:"enabled"`
+	// ExpiresAt is when the key stops authenticating; nil never expires
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// AllowedModels further limits the models the user may call when using
+	// the key; empty adds no limit
+	AllowedModels []string  `json:"allowed_models,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Valid reports whether the key authenticates its user at now
+func (k *APIKey) Valid(now time.Time) bool {
+	return k.Enabled && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// apiKeyColumns lists the columns selected for an APIKey, in scan order. The
+// key value is not selected.
+const apiKeyColumns = "api_keys.id, api_keys.user_id, api_keys.name, api_keys.is_primary, api_keys.enabled, api_keys.expires_at, api_keys.allowed_models, api_keys.created_at, api_keys.updated_at"
+
+// apiKeyScan holds the scan destinations of the apiKeyColumns
+type apiKeyScan struct {
+	key           APIKey
+	expiresAt     sql.NullTime
+	allowedModels sql.NullString
+}
+
+// dest returns the destinations of the apiKeyColumns, in order
+func (s *apiKeyScan) dest() []any {
+	return []any{&s.key.ID, &s.key.UserID, &s.key.Name, &s.key.Primary, &s.key.Enabled, &s.expiresAt, &s.allowedModels, &s.key.CreatedAt, &s.key.UpdatedAt}
+}
+
+// finish decodes the scanned columns into the APIKey
+func (s *apiKeyScan) finish() (*APIKey, error) {
+	if s.expiresAt.Valid {
+		s.key.ExpiresAt = &s.expiresAt.Time
+	}
+	if err := decodeModelList(s.allowedModels, &s.key.AllowedModels); err != nil {
+		return nil, fmt.Errorf("invalid allowed models for API key %d: %w", s.key.ID, err)
+	}
+	return &s.key, nil
+}
+
+// scanAPIKey scans a row selected with apiKeyColumns into an APIKey
+func scanAPIKey(row rowScanner) (*APIKey, error) {
+	var s apiKeyScan
+	if err := row.Scan(s.dest()...); err != nil {
+		return nil, err
+	}
+	return s.finish()
+}
+
+// CreateAPIKey creates a new API key for a user
+func (db *DB) CreateAPIKey(key *APIKey) error {
+	allowedModels, err := encodeModelList(key.AllowedModels)
+	if err != nil {
+		return err
+	}
+
+	result, err := db.Exec(
+		"INSERT INTO api_keys (user_id, name, key, is_primary, enabled, expires_at, allowed_models) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		key.UserID, key.Name, key.Key, key.Primary, key.Enabled, nullTime(key.ExpiresAt), allowedModels,
+	)
+	if cols := uniqueColumns(err); cols != nil {
+		if len(cols) == 1 && cols[0] == "api_keys.key" {
+			return duplicateError("API key")
+		}
+		return duplicateError(fmt.Sprintf("API key name %q", key.Name))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	key.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// GetAPIKey retrieves one of a user's API keys by ID, without its value
+func (db *DB) GetAPIKey(userID, id int64) (*APIKey, error) {
+	key, err := scanAPIKey(db.QueryRow("SELECT "+apiKeyColumns+" FROM api_keys WHERE id = ? AND user_id = ?", id, userID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+	return key, nil
+}
+
+// LookupAPIKey retrieves an API key by its value together with its user, in
+// one query, whether or not the key is still valid. It returns nils if no
+// user holds the key.
+func (db *DB) LookupAPIKey(value string) (*User, *APIKey, error) {
+	row := db.QueryRow("SELECT "+userColumns+", "+apiKeyColumns+" FROM api_keys JOIN users ON users.id = api_keys.user_id WHERE api_keys.key = ?", value)
+
+	var u userScan
+	var k apiKeyScan
+	err := row.Scan(append(u.dest(), k.dest()...)...)
+	if err == sql.ErrNoRows {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to look up API key: %w", err)
+	}
+
+	user, err := u.finish()
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := k.finish()
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, key, nil
+}
+
+// ListAPIKeys retrieves a user's API keys without their values, the
+// primary key first
+func (db *DB) ListAPIKeys(userID int64) ([]*APIKey, error) {
+	rows, err := db.Query("SELECT "+apiKeyColumns+" FROM api_keys WHERE user_id = ? ORDER BY is_primary DESC, id", userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []*APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan API key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// UpdateAPIKey updates an API key's name, enabled state, expiry and
+// allowed models
+func (db *DB) UpdateAPIKey(key *APIKey) error {
+	allowedModels, err := encodeModelList(key.AllowedModels)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(
+		"UPDATE api_keys SET name = ?, enabled = ?, expires_at = ?, allowed_models = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		key.Name, key.Enabled, nullTime(key.ExpiresAt), allowedModels, key.ID,
+	)
+	if uniqueColumns(err) != nil {
+		return duplicateError(fmt.Sprintf("API key name %q", key.Name))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update API key: %w", err)
+	}
+	return nil
+}
+
+// DeleteAPIKey revokes an API key by ID
+func (db *DB) DeleteAPIKey(id int64) error {
+	_, err := db.Exec("DELETE FROM api_keys WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete API key: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package database
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestAPIKeys(t *testing.T) {
+	dbPath := "/tmp/test_api_keys.db"
+	defer os.Remove(dbPath)
+
+	db, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	user := &User{APIKey: "sk-primary", Name: "ci"}
+	if err := db.CreateUser(user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	expires := time.Now().Add(time.Hour).UTC()
+	key := &APIKey{UserID: user.ID, Name: "staging", Key: "sk-staging", Enabled: true, ExpiresAt: &expires}
+	if err := db.CreateAPIKey(key); err != nil {
+		t.Fatalf("Failed to create API key: %v", err)
+	}
+	if err := db.CreateAPIKey(&APIKey{UserID: user.ID, Name: "staging", Key: "sk-other", Enabled: true}); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("Expected a duplicate key name to be rejected, got %v", err)
+	}
+
+	owner, got, err := db.LookupAPIKey("sk-staging")
+	if err != nil {
+		t.Fatalf("Failed to look up API key: %v", err)
+	}
+	if owner == nil || owner.ID != user.ID || owner.APIKey != "sk-primary" {
+		t.Fatalf("Unexpected key owner %+v", owner)
+	}
+	if got == nil || got.UserID != user.ID || got.Key != "" || got.Primary || !got.Valid(time.Now()) {
+		t.Fatalf("Unexpected API key %+v", got)
+	}
+	if got.Valid(expires) {
+		t.Error("Expected the key to be invalid once expired")
+	}
+
+	got.Enabled = false
+	if err := db.UpdateAPIKey(got); err != nil {
+		t.Fatalf("Failed to update API key: %v", err)
+	}
+	if got, _ = db.GetAPIKey(user.ID, key.ID); got.Valid(time.Now()) {
+		t.Error("Expected a disabled key to be invalid")
+	}
+	if other, _ := db.GetAPIKey(user.ID+1, key.ID); other != nil {
+		t.Error("Expected keys to be looked up within their user")
+	}
+
+	// The user's own key is its primary key, and changing it keeps the key
+	_, primary, err := db.LookupAPIKey("sk-primary")
+	if err != nil || primary == nil || !primary.Primary || primary.Name != PrimaryKeyName {
+		t.Fatalf("Expected the user's key as primary key, got %+v (%v)", primary, err)
+	}
+	user.APIKey = "sk-replaced"
+	if err := db.UpdateUser(user); err != nil {
+		t.Fatalf("Failed to update user: %v", err)
+	}
+	if _, replaced, _ := db.LookupAPIKey("sk-replaced"); replaced == nil || replaced.ID != primary.ID {
+		t.Errorf("Expected the primary key %d to take the new value, got %+v", primary.ID, replaced)
+	}
+	if old, _, _ := db.LookupAPIKey("sk-primary"); old != nil {
+		t.Error("Expected the replaced value to stop authenticating")
+	}
+	if keys, _ := db.ListAPIKeys(user.ID); len(keys) != 2 || !keys[0].Primary {
+		t.Errorf("Expected the primary and the additional key, got %+v", keys)
+	}
+
+	// Usage is attributed to the key it was made with
+	db.CreateUsageLog(&UsageLog{UserID: user.ID, Model: "gpt-4", TotalTokens: 10})
+	db.CreateUsageLog(&UsageLog{UserID: user.ID, APIKeyID: key.ID, Model: "gpt-4", TotalTokens: 30})
+	summaries, err := db.SummarizeUsage(UsageQuery{UserID: user.ID}, UsageByUser, UsageByAPIKey)
+	if err != nil {
+		t.Fatalf("Failed to summarize usage: %v", err)
+	}
+	if len(summaries) != 2 || summaries[0].APIKeyID != 0 || summaries[1].APIKeyID != key.ID || summaries[1].TotalTokens != 30 {
+		t.Errorf("Unexpected usage per key %+v %+v", summaries[0], summaries[len(summaries)-1])
+	}
+
+	// Deleting the user revokes its keys
+	if err := db.DeleteUser(user.ID); err != nil {
+		t.Fatalf("Failed to delete user: %v", err)
+	}
+	if keys, _ := db.ListAPIKeys(user.ID); len(keys) != 0 {
+		t.Errorf("Expected the user's keys to be deleted, got %d", len(keys))
+	}
+}
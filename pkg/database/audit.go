@@ -0,0 +1,94 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// AuditEntry records an admin action on a resource with snapshots of its
+// state before and after the action
+type AuditEntry struct {
+	ID         int64           `json:"id"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   int64           `json:"target_id"`
+	Actor      string          `json:"actor,omitempty"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// auditColumns lists the columns selected for an AuditEntry, in scan order
+const auditColumns = "id, action, target_type, target_id, actor, before, after, created_at"
+
+// scanAuditEntry scans a row selected with auditColumns into an AuditEntry
+func scanAuditEntry(row rowScanner) (*AuditEntry, error) {
+	var entry AuditEntry
+	var before, after sql.NullString
+
+	if err := row.Scan(&entry.ID, &entry.Action, &entry.TargetType, &entry.TargetID, &entry.Actor, &before, &after, &entry.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	if before.Valid {
+		entry.Before = json.RawMessage(before.String)
+	}
+	if after.Valid {
+		entry.After = json.RawMessage(after.String)
+	}
+	return &entry, nil
+}
+
+// nullJSON stores a JSON document, using NULL when it is empty
+func nullJSON(doc json.RawMessage) sql.NullString {
+	if len(doc) == 0 {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: string(doc), Valid: true}
+}
+
+// CreateAuditEntry appends an entry to the audit log
+func (db *DB) CreateAuditEntry(entry *AuditEntry) error {
+	result, err := db.Exec(
+		"INSERT INTO audit_log (action, target_type, target_id, actor, before, after) VALUES (?, ?, ?, ?, ?, ?)",
+		entry.Action, entry.TargetType, entry.TargetID, entry.Actor, nullJSON(entry.Before), nullJSON(entry.After),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create audit entry: %w", err)
+	}
+
+	entry.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// ListAuditEntries retrieves the most recent audit entries for a target,
+// newest first. An empty targetType lists entries for all targets.
+func (db *DB) ListAuditEntries(targetType string, targetID int64, limit int) ([]*AuditEntry, error) {
+	query := "SELECT " + auditColumns + " FROM audit_log"
+	var args []any
+	if targetType != "" {
+		query += " WHERE target_type = ? AND target_id = ?"
+		args = append(args, targetType, targetID)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []*AuditEntry
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
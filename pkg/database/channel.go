@@ -2,28 +2,209 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"time"
 )
 
 // Channel represents a backend channel configuration
 type Channel struct {
-	ID        int64     `json:"id"`
-	Name      string    `json:"name"`
-	BaseURL   string    `json:"base_url"`
-	APIKey    string    `json:"api_key"`
-	Weight    int       `json:"weight"`
-	Enabled   bool      `json:"enabled"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID               int64             `json:"id"`
+	Name             string            `json:"name"`
+	Type             string            `json:"type"`
+	BaseURL          string            `json:"base_url"`
+	APIKey           string            `json:"api_key"`
+	APIKeys          []string          `json:"api_keys,omitempty"`
+	Weight           int               `json:"weight"`
+	Enabled          bool              `json:"enabled"`
+	PathTemplates    map[string]string `json:"path_templates,omitempty"`
+	Organization     string            `json:"organization,omitempty"`
+	Project          string            `json:"project,omitempty"`
+	APIVersion       string            `json:"api_version,omitempty"`
+	Notes            string            `json:"notes,omitempty"`
+	MaintenanceUntil *time.Time        `json:"maintenance_until,omitempty"`
+	MaxConcurrency   int               `json:"max_concurrency,omitempty"`
+	MaxBatchSize     int               `json:"max_batch_size,omitempty"`
+	Status           string            `json:"status,omitempty"`
+	TestOnly         bool              `json:"test_only,omitempty"`
+	Cost             float64           `json:"cost,omitempty"`
+	ProxyURL         string            `json:"proxy_url,omitempty"`
+	RetryPolicy      *RetryPolicy      `json:"retry_policy,omitempty"`
+	CreatedAt        time.Time         `json:"created_at"`
+	UpdatedAt        time.Time         `json:"updated_at"`
 }
 
-// CreateChannel creates a new channel
+// InMaintenance reports whether the channel is draining at the given time. A
+// draining channel keeps serving existing sticky sessions but receives no new
+// ones until MaintenanceUntil.
+func (c *Channel) InMaintenance(now time.Time) bool {
+	return c.MaintenanceUntil != nil && now.Before(*c.MaintenanceUntil)
+}
+
+// Keys returns the channel's pool of upstream API keys: APIKey followed by
+// the additional APIKeys
+func (c *Channel) Keys() []string {
+	return append([]string{c.APIKey}, c.APIKeys...)
+}
+
+// RetryPolicy overrides the configured retry policy of a channel's upstream
+// requests. Zero fields inherit the configured value.
+type RetryPolicy struct {
+	MaxAttempts       int     `json:"max_attempts,omitempty"`
+	InitialDelayMs    int     `json:"initial_delay_ms,omitempty"`
+	Multiplier        float64 `json:"multiplier,omitempty"`
+	MaxDelayMs        int     `json:"max_delay_ms,omitempty"`
+	RetryableStatuses []int   `json:"retryable_statuses,omitempty"`
+}
+
+// IsZero reports whether the policy overrides nothing
+func (p *RetryPolicy) IsZero() bool {
+	return p == nil || (p.MaxAttempts == 0 && p.InitialDelayMs == 0 && p.Multiplier == 0 && p.MaxDelayMs == 0 && len(p.RetryableStatuses) == 0)
+}
+
+// ChannelStatusAuthFailed marks a channel whose backend repeatedly rejected
+// its credentials. Unlike transient unhealthiness it persists until an
+// operator updates the channel's API key.
+const ChannelStatusAuthFailed = "auth_failed"
+
+// AuthFailed reports whether the channel has been disabled for invalid credentials
+func (c *Channel) AuthFailed() bool {
+	return c.Status == ChannelStatusAuthFailed
+}
+
+// Channel types, naming the API a channel's backend speaks
+const (
+	ChannelTypeOpenAI    = "openai"
+	ChannelTypeAnthropic = "anthropic"
+	ChannelTypeAzure     = "azure"
+	ChannelTypeGemini    = "gemini"
+)
+
+// ChannelTypes lists the valid channel types
+var ChannelTypes = []string{ChannelTypeOpenAI, ChannelTypeAnthropic, ChannelTypeAzure, ChannelTypeGemini}
+
+// channelColumns lists the columns selected for a Channel, in scan order
+const channelColumns = "id, name, base_url, api_key, weight, enabled, path_templates, organization, project, api_version, notes, maintenance_until, max_concurrency, max_batch_size, status, api_keys, test_only, cost, type, proxy_url, retry_policy, created_at, updated_at"
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanChannel scans a row selected with channelColumns into a Channel
+func scanChannel(row rowScanner) (*Channel, error) {
+	var channel Channel
+	var pathTemplates sql.NullString
+	var maintenanceUntil sql.NullTime
+	var apiKeys sql.NullString
+	var retryPolicy sql.NullString
+
+	if err := row.Scan(&channel.ID, &channel.Name, &channel.BaseURL, &channel.APIKey, &channel.Weight, &channel.Enabled, &pathTemplates, &channel.Organization, &channel.Project, &channel.APIVersion, &channel.Notes, &maintenanceUntil, &channel.MaxConcurrency, &channel.MaxBatchSize, &channel.Status, &apiKeys, &channel.TestOnly, &channel.Cost, &channel.Type, &channel.ProxyURL, &retryPolicy, &channel.CreatedAt, &channel.UpdatedAt); err != nil {
+		return nil, err
+	}
+
+	if maintenanceUntil.Valid {
+		channel.MaintenanceUntil = &maintenanceUntil.Time
+	}
+
+	if pathTemplates.Valid && pathTemplates.String != "" {
+		if err := json.Unmarshal([]byte(pathTemplates.String), &channel.PathTemplates); err != nil {
+			return nil, fmt.Errorf("invalid path templates for channel %d: %w", channel.ID, err)
+		}
+	}
+
+	if apiKeys.Valid && apiKeys.String != "" {
+		if err := json.Unmarshal([]byte(apiKeys.String), &channel.APIKeys); err != nil {
+			return nil, fmt.Errorf("invalid api keys for channel %d: %w", channel.ID, err)
+		}
+	}
+
+	if retryPolicy.Valid && retryPolicy.String != "" {
+		if err := json.Unmarshal([]byte(retryPolicy.String), &channel.RetryPolicy); err != nil {
+			return nil, fmt.Errorf("invalid retry policy for channel %d: %w", channel.ID, err)
+		}
+	}
+
+	return &channel, nil
+}
+
+// encodeAPIKeys serializes additional API keys for storage, using NULL when empty
+func encodeAPIKeys(keys []string) (sql.NullString, error) {
+	if len(keys) == 0 {
+		return sql.NullString{}, nil
+	}
+
+	data, err := json.Marshal(keys)
+	if err != nil {
+		return sql.NullString{}, fmt.Errorf("failed to encode api keys: %w", err)
+	}
+
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+// encodePathTemplates serializes path templates for storage, using NULL when empty
+func encodePathTemplates(templates map[string]string) (sql.NullString, error) {
+	if len(templates) == 0 {
+		return sql.NullString{}, nil
+	}
+
+	data, err := json.Marshal(templates)
+	if err != nil {
+		return sql.NullString{}, fmt.Errorf("failed to encode path templates: %w", err)
+	}
+
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+// encodeRetryPolicy serializes a retry policy override for storage, using
+// NULL when it overrides nothing
+func encodeRetryPolicy(policy *RetryPolicy) (sql.NullString, error) {
+	if policy.IsZero() {
+		return sql.NullString{}, nil
+	}
+
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return sql.NullString{}, fmt.Errorf("failed to encode retry policy: %w", err)
+	}
+
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+// nullTime stores a nil time as NULL
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
+
+// CreateChannel creates a new channel. Channels without a type are OpenAI
+// channels.
 func (db *DB) CreateChannel(channel *Channel) error {
+	if channel.Type == "" {
+		channel.Type = ChannelTypeOpenAI
+	}
+	pathTemplates, err := encodePathTemplates(channel.PathTemplates)
+	if err != nil {
+		return err
+	}
+	apiKeys, err := encodeAPIKeys(channel.APIKeys)
+	if err != nil {
+		return err
+	}
+	retryPolicy, err := encodeRetryPolicy(channel.RetryPolicy)
+	if err != nil {
+		return err
+	}
+
 	result, err := db.Exec(
-		"INSERT INTO channels (name, base_url, api_key, weight, enabled) VALUES (?, ?, ?, ?, ?)",
-		channel.Name, channel.BaseURL, channel.APIKey, channel.Weight, channel.Enabled,
+		"INSERT INTO channels (name, base_url, api_key, weight, enabled, path_templates, organization, project, api_version, notes, maintenance_until, max_concurrency, max_batch_size, status, api_keys, test_only, cost, type, proxy_url, retry_policy) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		channel.Name, channel.BaseURL, channel.APIKey, channel.Weight, channel.Enabled, pathTemplates, channel.Organization, channel.Project, channel.APIVersion, channel.Notes, nullTime(channel.MaintenanceUntil), channel.MaxConcurrency, channel.MaxBatchSize, channel.Status, apiKeys, channel.TestOnly, channel.Cost, channel.Type, channel.ProxyURL, retryPolicy,
 	)
+	if uniqueColumns(err) != nil {
+		return duplicateError(fmt.Sprintf("channel name %q", channel.Name))
+	}
 	if err != nil {
 		return fmt.Errorf("failed to create channel: %w", err)
 	}
@@ -34,12 +215,7 @@ func (db *DB) CreateChannel(channel *Channel) error {
 
 // GetChannel retrieves a channel by ID
 func (db *DB) GetChannel(id int64) (*Channel, error) {
-	var channel Channel
-
-	err := db.QueryRow(
-		"SELECT id, name, base_url, api_key, weight, enabled, created_at, updated_at FROM channels WHERE id = ?",
-		id,
-	).Scan(&channel.ID, &channel.Name, &channel.BaseURL, &channel.APIKey, &channel.Weight, &channel.Enabled, &channel.CreatedAt, &channel.UpdatedAt)
+	channel, err := scanChannel(db.QueryRow("SELECT "+channelColumns+" FROM channels WHERE id = ?", id))
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -48,17 +224,12 @@ func (db *DB) GetChannel(id int64) (*Channel, error) {
 		return nil, fmt.Errorf("failed to get channel: %w", err)
 	}
 
-	return &channel, nil
+	return channel, nil
 }
 
 // GetChannelByName retrieves a channel by name
 func (db *DB) GetChannelByName(name string) (*Channel, error) {
-	var channel Channel
-
-	err := db.QueryRow(
-		"SELECT id, name, base_url, api_key, weight, enabled, created_at, updated_at FROM channels WHERE name = ?",
-		name,
-	).Scan(&channel.ID, &channel.Name, &channel.BaseURL, &channel.APIKey, &channel.Weight, &channel.Enabled, &channel.CreatedAt, &channel.UpdatedAt)
+	channel, err := scanChannel(db.QueryRow("SELECT "+channelColumns+" FROM channels WHERE name = ?", name))
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -67,12 +238,12 @@ func (db *DB) GetChannelByName(name string) (*Channel, error) {
 		return nil, fmt.Errorf("failed to get channel by name: %w", err)
 	}
 
-	return &channel, nil
+	return channel, nil
 }
 
 // ListChannels retrieves all channels
 func (db *DB) ListChannels() ([]*Channel, error) {
-	rows, err := db.Query("SELECT id, name, base_url, api_key, weight, enabled, created_at, updated_at FROM channels")
+	rows, err := db.Query("SELECT " + channelColumns + " FROM channels")
 	if err != nil {
 		return nil, fmt.Errorf("failed to list channels: %w", err)
 	}
@@ -80,13 +251,12 @@ func (db *DB) ListChannels() ([]*Channel, error) {
 
 	var channels []*Channel
 	for rows.Next() {
-		var channel Channel
-
-		if err := rows.Scan(&channel.ID, &channel.Name, &channel.BaseURL, &channel.APIKey, &channel.Weight, &channel.Enabled, &channel.CreatedAt, &channel.UpdatedAt); err != nil {
+		channel, err := scanChannel(rows)
+		if err != nil {
 			return nil, fmt.Errorf("failed to scan channel: %w", err)
 		}
 
-		channels = append(channels, &channel)
+		channels = append(channels, channel)
 	}
 
 	return channels, nil
@@ -94,7 +264,7 @@ func (db *DB) ListChannels() ([]*Channel, error) {
 
 // ListEnabledChannels retrieves all enabled channels
 func (db *DB) ListEnabledChannels() ([]*Channel, error) {
-	rows, err := db.Query("SELECT id, name, base_url, api_key, weight, enabled, created_at, updated_at FROM channels WHERE enabled = 1")
+	rows, err := db.Query("SELECT " + channelColumns + " FROM channels WHERE enabled = 1")
 	if err != nil {
 		return nil, fmt.Errorf("failed to list enabled channels: %w", err)
 	}
@@ -102,13 +272,12 @@ func (db *DB) ListEnabledChannels() ([]*Channel, error) {
 
 	var channels []*Channel
 	for rows.Next() {
-		var channel Channel
-
-		if err := rows.Scan(&channel.ID, &channel.Name, &channel.BaseURL, &channel.APIKey, &channel.Weight, &channel.Enabled, &channel.CreatedAt, &channel.UpdatedAt); err != nil {
+		channel, err := scanChannel(rows)
+		if err != nil {
 			return nil, fmt.Errorf("failed to scan channel: %w", err)
 		}
 
-		channels = append(channels, &channel)
+		channels = append(channels, channel)
 	}
 
 	return channels, nil
@@ -116,10 +285,29 @@ func (db *DB) ListEnabledChannels() ([]*Channel, error) {
 
 // UpdateChannel updates a channel
 func (db *DB) UpdateChannel(channel *Channel) error {
-	_, err := db.Exec(
-		"UPDATE channels SET name = ?, base_url = ?, api_key = ?, weight = ?, enabled = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
-		channel.Name, channel.BaseURL, channel.APIKey, channel.Weight, channel.Enabled, channel.ID,
+	if channel.Type == "" {
+		channel.Type = ChannelTypeOpenAI
+	}
+	pathTemplates, err := encodePathTemplates(channel.PathTemplates)
+	if err != nil {
+		return err
+	}
+	apiKeys, err := encodeAPIKeys(channel.APIKeys)
+	if err != nil {
+		return err
+	}
+	retryPolicy, err := encodeRetryPolicy(channel.RetryPolicy)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(
+		"UPDATE channels SET name = ?, base_url = ?, api_key = ?, weight = ?, enabled = ?, path_templates = ?, organization = ?, project = ?, api_version = ?, notes = ?, maintenance_until = ?, max_concurrency = ?, max_batch_size = ?, status = ?, api_keys = ?, test_only = ?, cost = ?, type = ?, proxy_url = ?, retry_policy = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		channel.Name, channel.BaseURL, channel.APIKey, channel.Weight, channel.Enabled, pathTemplates, channel.Organization, channel.Project, channel.APIVersion, channel.Notes, nullTime(channel.MaintenanceUntil), channel.MaxConcurrency, channel.MaxBatchSize, channel.Status, apiKeys, channel.TestOnly, channel.Cost, channel.Type, channel.ProxyURL, retryPolicy, channel.ID,
 	)
+	if uniqueColumns(err) != nil {
+		return duplicateError(fmt.Sprintf("channel name %q", channel.Name))
+	}
 	if err != nil {
 		return fmt.Errorf("failed to update channel: %w", err)
 	}
@@ -127,6 +315,15 @@ func (db *DB) UpdateChannel(channel *Channel) error {
 	return nil
 }
 
+// SetChannelStatus updates only a channel's status
+func (db *DB) SetChannelStatus(id int64, status string) error {
+	_, err := db.Exec("UPDATE channels SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", status, id)
+	if err != nil {
+		return fmt.Errorf("failed to set channel status: %w", err)
+	}
+	return nil
+}
+
 // DeleteChannel deletes a channel by ID
 func (db *DB) DeleteChannel(id int64) error {
 	_, err := db.Exec("DELETE FROM channels WHERE id = ?", id)
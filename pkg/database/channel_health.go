@@ -0,0 +1,59 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ChannelHealth is the persisted result of a channel's health checks
+type ChannelHealth struct {
+	ChannelID           int64
+	Status              string
+	ConsecutiveFailures int
+	LastError           string
+	LastChecked         time.Time
+}
+
+// SaveChannelHealth creates or replaces a channel's health
+func (db *DB) SaveChannelHealth(health *ChannelHealth) error {
+	_, err := db.Exec(
+		`INSERT INTO channel_health (channel_id, status, consecutive_failures, last_error, last_checked) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(channel_id) DO UPDATE SET status = excluded.status, consecutive_failures = excluded.consecutive_failures,
+		last_error = excluded.last_error, last_checked = excluded.last_checked`,
+		health.ChannelID, health.Status, health.ConsecutiveFailures, health.LastError, health.LastChecked.UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save channel health: %w", err)
+	}
+	return nil
+}
+
+// ListChannelHealth retrieves the health of every checked channel
+func (db *DB) ListChannelHealth() ([]*ChannelHealth, error) {
+	rows, err := db.Query("SELECT channel_id, status, consecutive_failures, last_error, last_checked FROM channel_health ORDER BY channel_id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list channel health: %w", err)
+	}
+	defer rows.Close()
+
+	var healths []*ChannelHealth
+	for rows.Next() {
+		var health ChannelHealth
+		var lastChecked sql.NullTime
+		if err := rows.Scan(&health.ChannelID, &health.Status, &health.ConsecutiveFailures, &health.LastError, &lastChecked); err != nil {
+			return nil, fmt.Errorf("failed to scan channel health: %w", err)
+		}
+		health.LastChecked = lastChecked.Time
+		healths = append(healths, &health)
+	}
+	return healths, rows.Err()
+}
+
+// DeleteChannelHealth removes a channel's health
+func (db *DB) DeleteChannelHealth(channelID int64) error {
+	if _, err := db.Exec("DELETE FROM channel_health WHERE channel_id = ?", channelID); err != nil {
+		return fmt.Errorf("failed to delete channel health: %w", err)
+	}
+	return nil
+}
@@ -46,6 +46,8 @@ func TestChannelCRUD(t *testing.T) {
 
 	// Update
 	channel.Weight = 20
+	channel.PathTemplates = map[string]string{"chat": "/api/v1/chat"}
+	channel.APIKeys = []string{"sk-test-2", "sk-test-3"}
 	if err := db.UpdateChannel(channel); err != nil {
 		t.Fatalf("Failed to update channel: %v", err)
 	}
@@ -54,6 +56,12 @@ func TestChannelCRUD(t *testing.T) {
 	if retrieved.Weight != 20 {
 		t.Errorf("Expected weight 20, got %d", retrieved.Weight)
 	}
+	if retrieved.PathTemplates["chat"] != "/api/v1/chat" {
+		t.Errorf("Expected chat path template to round-trip, got %v", retrieved.PathTemplates)
+	}
+	if keys := retrieved.Keys(); len(keys) != 3 || keys[0] != "sk-test" || keys[2] != "sk-test-3" {
+		t.Errorf("Expected key pool to round-trip, got %v", keys)
+	}
 
 	// List
 	channels, err := db.ListChannels()
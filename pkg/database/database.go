@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -16,10 +17,28 @@ var migrationsFS embed.FS
 // DB wraps sql.DB with migration capabilities
 type DB struct {
 	*sql.DB
+	// tx, when set, is the transaction the DB's queries run in
+	tx *sql.Tx
 }
 
-// New creates a new database connection and runs migrations
+// New opens the database and applies any pending migrations
 func New(dbPath string) (*DB, error) {
+	db, err := Open(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := db.Migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to run migrations: %w", err)
+	}
+
+	return db, nil
+}
+
+// Open opens the database without migrating it, creating its directory if
+// needed
+func Open(dbPath string) (*DB, error) {
 	// Ensure directory exists
 	dir := filepath.Dir(dbPath)
 	if dir != "." && dir != "/" {
@@ -28,44 +47,38 @@ func New(dbPath string) (*DB, error) {
 		}
 	}
 
-	// Open database
-	db, err := sql.Open("sqlite3", dbPath)
+	// Open database. In WAL mode with synchronous=NORMAL a commit is not
+	// synced to disk, which keeps the writes every request makes cheap; a
+	// power loss can lose the last commits but never corrupts the database.
+	db, err := sql.Open("sqlite3", dbPath+"?_journal_mode=WAL&_synchronous=NORMAL")
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
 	// Test connection
 	if err := db.Ping(); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	// Run migrations
-	if err := runMigrations(db); err != nil {
-		return nil, fmt.Errorf("failed to run migrations: %w", err)
-	}
-
-	return &DB{db}, nil
+	return &DB{DB: db}, nil
 }
 
-// runMigrations executes all migration files
-func runMigrations(db *sql.DB) error {
-	migrationFiles := []string{
-		"migrations/001_init.up.sql",
-		"migrations/002_models.up.sql",
-	}
-
-	for _, migrationFile := range migrationFiles {
-		content, err := migrationsFS.ReadFile(migrationFile)
-		if err != nil {
-			return fmt.Errorf("failed to read migration file %s: %w", migrationFile, err)
+// splitStatements splits a migration file into individual SQL statements
+func splitStatements(content string) []string {
+	var stmts []string
+	for _, stmt := range strings.Split(content, ";") {
+		var lines []string
+		for _, line := range strings.Split(stmt, "\n") {
+			if trimmed := strings.TrimSpace(line); trimmed != "" && !strings.HasPrefix(trimmed, "--") {
+				lines = append(lines, line)
+			}
 		}
-
-		if _, err := db.Exec(string(content)); err != nil {
-			return fmt.Errorf("failed to execute migration %s: %w", migrationFile, err)
+		if len(lines) > 0 {
+			stmts = append(stmts, strings.Join(lines, "\n"))
 		}
 	}
-
-	return nil
+	return stmts
 }
 
 // Close closes the database connection
@@ -48,9 +48,30 @@ func TestMigrations(t *testing.T) {
 	}
 
 	// Test that we can insert into users
-	_, err = db.Exec("INSERT INTO users (api_key, name) VALUES (?, ?)",
-		"test-key", "Test User")
+	_, err = db.Exec("INSERT INTO users (name) VALUES (?)", "Test User")
 	if err != nil {
 		t.Errorf("Failed to insert into users: %v", err)
 	}
 }
+
+func TestMigrationsRerun(t *testing.T) {
+	dbPath := "/tmp/test_migrations_rerun.db"
+	defer os.Remove(dbPath)
+
+	db, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	db.Close()
+
+	// Reopening must not run applied migrations again
+	db, err = New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+
+	if run, err := db.Migrate(); err != nil || len(run) != 0 {
+		t.Errorf("Expected no pending migrations, got %v (%v)", run, err)
+	}
+}
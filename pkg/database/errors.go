@@ -0,0 +1,46 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// ErrDuplicate is returned when a write would violate a unique constraint
+var ErrDuplicate = errors.New("already exists")
+
+// StatusForError maps a database write error to an HTTP status code
+func StatusForError(err error) int {
+	if errors.Is(err, ErrDuplicate) || errors.Is(err, ErrDimensionMismatch) {
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// uniqueColumns returns the "table.column" names reported by a unique
+// constraint violation, or nil if err is not one
+func uniqueColumns(err error) []string {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) || sqliteErr.ExtendedCode != sqlite3.ErrConstraintUnique {
+		return nil
+	}
+
+	_, cols, ok := strings.Cut(sqliteErr.Error(), "failed: ")
+	if !ok {
+		return []string{""}
+	}
+
+	columns := strings.Split(cols, ",")
+	for i := range columns {
+		columns[i] = strings.TrimSpace(columns[i])
+	}
+	return columns
+}
+
+// duplicateError builds a descriptive ErrDuplicate for a unique violation
+func duplicateError(subject string) error {
+	return fmt.Errorf("%s %w", subject, ErrDuplicate)
+}
@@ -0,0 +1,140 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// FeatureFlag gates a behavior. A disabled flag is off for everyone; an
+// enabled one is on for the listed users and for RolloutPercent of the rest.
+type FeatureFlag struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Enabled     bool   `json:"enabled"`
+	// RolloutPercent is the share of users, from 0 to 100, the flag is on for
+	RolloutPercent int `json:"rollout_percent"`
+	// UserIDs always get the flag while it is enabled
+	UserIDs   []int64   `json:"user_ids"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// featureFlagColumns lists the columns selected for a FeatureFlag, in scan order
+const featureFlagColumns = "id, name, description, enabled, rollout_percent, user_ids, created_at, updated_at"
+
+// scanFeatureFlag scans a row selected with featureFlagColumns into a FeatureFlag
+func scanFeatureFlag(row rowScanner) (*FeatureFlag, error) {
+	var flag FeatureFlag
+	var userIDs sql.NullString
+
+	if err := row.Scan(&flag.ID, &flag.Name, &flag.Description, &flag.Enabled, &flag.RolloutPercent, &userIDs, &flag.CreatedAt, &flag.UpdatedAt); err != nil {
+		return nil, err
+	}
+
+	flag.UserIDs = []int64{}
+	if userIDs.Valid && userIDs.String != "" {
+		if err := json.Unmarshal([]byte(userIDs.String), &flag.UserIDs); err != nil {
+			return nil, fmt.Errorf("invalid user IDs for feature flag %d: %w", flag.ID, err)
+		}
+	}
+	return &flag, nil
+}
+
+// encodeFlagUserIDs serializes a flag's user list for storage, using NULL when empty
+func encodeFlagUserIDs(ids []int64) (sql.NullString, error) {
+	if len(ids) == 0 {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(ids)
+	if err != nil {
+		return sql.NullString{}, fmt.Errorf("failed to encode feature flag users: %w", err)
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+// CreateFeatureFlag creates a new feature flag
+func (db *DB) CreateFeatureFlag(flag *FeatureFlag) error {
+	userIDs, err := encodeFlagUserIDs(flag.UserIDs)
+	if err != nil {
+		return err
+	}
+
+	result, err := db.Exec(
+		"INSERT INTO feature_flags (name, description, enabled, rollout_percent, user_ids) VALUES (?, ?, ?, ?, ?)",
+		flag.Name, flag.Description, flag.Enabled, flag.RolloutPercent, userIDs,
+	)
+	if uniqueColumns(err) != nil {
+		return duplicateError(fmt.Sprintf("feature flag %q", flag.Name))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create feature flag: %w", err)
+	}
+
+	flag.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// GetFeatureFlag retrieves a feature flag by ID
+func (db *DB) GetFeatureFlag(id int64) (*FeatureFlag, error) {
+	flag, err := scanFeatureFlag(db.QueryRow("SELECT "+featureFlagColumns+" FROM feature_flags WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get feature flag: %w", err)
+	}
+	return flag, nil
+}
+
+// ListFeatureFlags retrieves all feature flags ordered by name
+func (db *DB) ListFeatureFlags() ([]*FeatureFlag, error) {
+	rows, err := db.Query("SELECT " + featureFlagColumns + " FROM feature_flags ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list feature flags: %w", err)
+	}
+	defer rows.Close()
+
+	var flags []*FeatureFlag
+	for rows.Next() {
+		flag, err := scanFeatureFlag(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan feature flag: %w", err)
+		}
+		flags = append(flags, flag)
+	}
+
+	return flags, rows.Err()
+}
+
+// UpdateFeatureFlag updates a feature flag
+func (db *DB) UpdateFeatureFlag(flag *FeatureFlag) error {
+	userIDs, err := encodeFlagUserIDs(flag.UserIDs)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(
+		"UPDATE feature_flags SET name = ?, description = ?, enabled = ?, rollout_percent = ?, user_ids = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		flag.Name, flag.Description, flag.Enabled, flag.RolloutPercent, userIDs, flag.ID,
+	)
+	if uniqueColumns(err) != nil {
+		return duplicateError(fmt.Sprintf("feature flag %q", flag.Name))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update feature flag: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteFeatureFlag deletes a feature flag by ID
+func (db *DB) DeleteFeatureFlag(id int64) error {
+	_, err := db.Exec("DELETE FROM feature_flags WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete feature flag: %w", err)
+	}
+	return nil
+}
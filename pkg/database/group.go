@@ -0,0 +1,194 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Group is a set of users sharing a monthly budget and a request rate
+// limit. Zero limits are unlimited. Members are still held to their own
+// quotas.
+type Group struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// MonthlyTokens caps the total tokens used by all members per calendar
+	// month (UTC)
+	MonthlyTokens int64 `json:"monthly_tokens"`
+	// MonthlyCost caps the cost in USD of all members per calendar month (UTC)
+	MonthlyCost float64 `json:"monthly_cost"`
+	// RequestsPerMinute caps the requests of all members per minute
+	RequestsPerMinute int `json:"requests_per_minute"`
+	// ResetAt is when the group's budget was last reset; usage before it
+	// does not count against the current month
+	ResetAt   *time.Time `json:"reset_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// groupColumns lists the columns selected for a Group, in scan order
+const groupColumns = "id, name, description, monthly_tokens, monthly_cost, requests_per_minute, reset_at, created_at, updated_at"
+
+// scanGroup scans a row selected with groupColumns into a Group
+func scanGroup(row rowScanner) (*Group, error) {
+	var g Group
+	var resetAt sql.NullTime
+	if err := row.Scan(&g.ID, &g.Name, &g.Description, &g.MonthlyTokens, &g.MonthlyCost, &g.RequestsPerMinute, &resetAt, &g.CreatedAt, &g.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if resetAt.Valid {
+		g.ResetAt = &resetAt.Time
+	}
+	return &g, nil
+}
+
+// CreateGroup creates a new group
+func (db *DB) CreateGroup(g *Group) error {
+	result, err := db.Exec(
+		"INSERT INTO user_groups (name, description, monthly_tokens, monthly_cost, requests_per_minute) VALUES (?, ?, ?, ?, ?)",
+		g.Name, g.Description, g.MonthlyTokens, g.MonthlyCost, g.RequestsPerMinute,
+	)
+	if uniqueColumns(err) != nil {
+		return duplicateError(fmt.Sprintf("group name %q", g.Name))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create group: %w", err)
+	}
+
+	g.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// GetGroup retrieves a group by ID, or nil if it does not exist
+func (db *DB) GetGroup(id int64) (*Group, error) {
+	g, err := scanGroup(db.QueryRow("SELECT "+groupColumns+" FROM user_groups WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get group: %w", err)
+	}
+	return g, nil
+}
+
+// queryGroups runs a query selecting groupColumns
+func (db *DB) queryGroups(query string, args ...any) ([]*Group, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list groups: %w", err)
+	}
+	defer rows.Close()
+
+	var groups []*Group
+	for rows.Next() {
+		g, err := scanGroup(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan group: %w", err)
+		}
+		groups = append(groups, g)
+	}
+
+	return groups, rows.Err()
+}
+
+// ListGroups retrieves all groups
+func (db *DB) ListGroups() ([]*Group, error) {
+	return db.queryGroups("SELECT " + groupColumns + " FROM user_groups ORDER BY id")
+}
+
+// ListUserGroups retrieves the groups a user belongs to
+func (db *DB) ListUserGroups(userID int64) ([]*Group, error) {
+	return db.queryGroups(
+		"SELECT "+groupColumns+" FROM user_groups WHERE id IN (SELECT group_id FROM user_group_members WHERE user_id = ?) ORDER BY id",
+		userID,
+	)
+}
+
+// UpdateGroup updates a group's name, description and limits, keeping its
+// last reset
+func (db *DB) UpdateGroup(g *Group) error {
+	_, err := db.Exec(
+		"UPDATE user_groups SET name = ?, description = ?, monthly_tokens = ?, monthly_cost = ?, requests_per_minute = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		g.Name, g.Description, g.MonthlyTokens, g.MonthlyCost, g.RequestsPerMinute, g.ID,
+	)
+	if uniqueColumns(err) != nil {
+		return duplicateError(fmt.Sprintf("group name %q", g.Name))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update group: %w", err)
+	}
+	return nil
+}
+
+// ResetGroupQuota restarts a group's monthly count at at, so earlier usage
+// of its members in the month no longer counts. It reports whether the
+// group exists.
+func (db *DB) ResetGroupQuota(id int64, at time.Time) (bool, error) {
+	result, err := db.Exec(
+		"UPDATE user_groups SET reset_at = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		at.UTC(), id,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to reset group quota: %w", err)
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// DeleteGroup deletes a group and its memberships
+func (db *DB) DeleteGroup(id int64) error {
+	if _, err := db.Exec("DELETE FROM user_group_members WHERE group_id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete group members: %w", err)
+	}
+	if _, err := db.Exec("DELETE FROM user_groups WHERE id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete group: %w", err)
+	}
+	return nil
+}
+
+// AddGroupMember adds a user to a group; adding a member again succeeds
+func (db *DB) AddGroupMember(groupID, userID int64) error {
+	_, err := db.Exec(
+		"INSERT INTO user_group_members (group_id, user_id) VALUES (?, ?) ON CONFLICT(group_id, user_id) DO NOTHING",
+		groupID, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to add group member: %w", err)
+	}
+	return nil
+}
+
+// RemoveGroupMember removes a user from a group. It reports whether the
+// user was a member.
+func (db *DB) RemoveGroupMember(groupID, userID int64) (bool, error) {
+	result, err := db.Exec("DELETE FROM user_group_members WHERE group_id = ? AND user_id = ?", groupID, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to remove group member: %w", err)
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// ListGroupMembers retrieves the users in a group
+func (db *DB) ListGroupMembers(groupID int64) ([]*User, error) {
+	rows, err := db.Query(
+		"SELECT "+userColumns+" FROM users WHERE id IN (SELECT user_id FROM user_group_members WHERE group_id = ?) ORDER BY id",
+		groupID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list group members: %w", err)
+	}
+	defer rows.Close()
+
+	var users []*User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
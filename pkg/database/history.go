@@ -0,0 +1,60 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// UserChannelHistory records the channel a user was last routed to. Unlike a
+// session it is kept when the session expires.
+type UserChannelHistory struct {
+	UserID    int64     `json:"user_id"`
+	ChannelID int64     `json:"channel_id"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// RecordUserChannel stores channelID as the channel the user was last routed to
+func (db *DB) RecordUserChannel(userID, channelID int64) error {
+	_, err := db.Exec(
+		`INSERT INTO user_channel_history (user_id, channel_id) VALUES (?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET channel_id = excluded.channel_id, updated_at = CURRENT_TIMESTAMP`,
+		userID, channelID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record user channel: %w", err)
+	}
+	return nil
+}
+
+// ForgetUserChannel clears a user's history if it names channelID, so the
+// user is not routed back to that channel
+func (db *DB) ForgetUserChannel(userID, channelID int64) error {
+	_, err := db.Exec(
+		"DELETE FROM user_channel_history WHERE user_id = ? AND channel_id = ?",
+		userID, channelID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to forget user channel: %w", err)
+	}
+	return nil
+}
+
+// GetUserChannelHistory retrieves the channel a user was last routed to
+func (db *DB) GetUserChannelHistory(userID int64) (*UserChannelHistory, error) {
+	var history UserChannelHistory
+
+	err := db.QueryRow(
+		"SELECT user_id, channel_id, updated_at FROM user_channel_history WHERE user_id = ?",
+		userID,
+	).Scan(&history.UserID, &history.ChannelID, &history.UpdatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user channel history: %w", err)
+	}
+
+	return &history, nil
+}
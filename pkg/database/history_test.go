@@ -0,0 +1,75 @@
+package database
+
+import (
+	"os"
+	"testing"
+)
+
+func TestUserChannelHistory(t *testing.T) {
+	dbPath := "/tmp/test_user_channel_history.db"
+	defer os.Remove(dbPath)
+
+	db, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	user := &User{APIKey: "test-key", Name: "Test"}
+	db.CreateUser(user)
+
+	first := &Channel{Name: "first", BaseURL: "https://a.example.com", APIKey: "sk-a"}
+	second := &Channel{Name: "second", BaseURL: "https://b.example.com", APIKey: "sk-b"}
+	db.CreateChannel(first)
+	db.CreateChannel(second)
+
+	history, err := db.GetUserChannelHistory(user.ID)
+	if err != nil {
+		t.Fatalf("Failed to get history: %v", err)
+	}
+	if history != nil {
+		t.Fatalf("Expected no history, got %+v", history)
+	}
+
+	for _, ch := range []*Channel{first, second} {
+		if err := db.RecordUserChannel(user.ID, ch.ID); err != nil {
+			t.Fatalf("Failed to record user channel: %v", err)
+		}
+	}
+
+	history, err = db.GetUserChannelHistory(user.ID)
+	if err != nil {
+		t.Fatalf("Failed to get history: %v", err)
+	}
+	if history == nil || history.ChannelID != second.ID {
+		t.Errorf("Expected last channel %d, got %+v", second.ID, history)
+	}
+}
+
+func TestForgetUserChannel(t *testing.T) {
+	dbPath := "/tmp/test_forget_user_channel.db"
+	defer os.Remove(dbPath)
+
+	db, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	db.RecordUserChannel(1, 10)
+
+	// History naming another channel is kept
+	if err := db.ForgetUserChannel(1, 20); err != nil {
+		t.Fatal(err)
+	}
+	if history, _ := db.GetUserChannelHistory(1); history == nil {
+		t.Fatal("Expected history of another channel to be kept")
+	}
+
+	if err := db.ForgetUserChannel(1, 10); err != nil {
+		t.Fatal(err)
+	}
+	if history, _ := db.GetUserChannelHistory(1); history != nil {
+		t.Errorf("Expected history to be cleared, got %+v", history)
+	}
+}
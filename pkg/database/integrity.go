@@ -0,0 +1,118 @@
+package database
+
+import "fmt"
+
+// reference is a column that must point at an existing row of another table
+type reference struct {
+	Table  string
+	Column string
+	Parent string
+}
+
+// references lists the relationships checked for orphan rows. Foreign keys
+// are declared in the schema but SQLite does not enforce them by default, so
+// deleting a channel or user can leave rows pointing at it.
+var references = []reference{
+	{Table: "model_channels", Column: "model_id", Parent: "models"},
+	{Table: "model_channels", Column: "channel_id", Parent: "channels"},
+	{Table: "sessions", Column: "user_id", Parent: "users"},
+	{Table: "sessions", Column: "channel_id", Parent: "channels"},
+	{Table: "channel_metrics", Column: "channel_id", Parent: "channels"},
+	{Table: "channel_health", Column: "channel_id", Parent: "channels"},
+	{Table: "user_channel_history", Column: "user_id", Parent: "users"},
+	{Table: "user_channel_history", Column: "channel_id", Parent: "channels"},
+	{Table: "routing_rules", Column: "channel_id", Parent: "channels"},
+	{Table: "api_key_rotations", Column: "user_id", Parent: "users"},
+	{Table: "api_keys", Column: "user_id", Parent: "users"},
+	{Table: "user_quotas", Column: "user_id", Parent: "users"},
+	{Table: "user_group_members", Column: "group_id", Parent: "user_groups"},
+	{Table: "user_group_members", Column: "user_id", Parent: "users"},
+}
+
+// Orphans counts rows whose reference points at a missing row
+type Orphans struct {
+	Table  string `json:"table"`
+	Column string `json:"column"`
+	Parent string `json:"parent"`
+	Count  int64  `json:"count"`
+}
+
+// IntegrityReport summarizes a database integrity check
+type IntegrityReport struct {
+	// Errors are the problems reported by PRAGMA integrity_check; they cannot
+	// be repaired automatically
+	Errors  []string  `json:"errors"`
+	Orphans []Orphans `json:"orphans"`
+	// Repaired is the number of orphan rows deleted
+	Repaired int64 `json:"repaired"`
+}
+
+// OK reports whether no problems remain after the check. Orphans are all
+// deleted by a repair, so only integrity errors remain after one.
+func (r *IntegrityReport) OK() bool {
+	return len(r.Errors) == 0 && (len(r.Orphans) == 0 || r.Repaired > 0)
+}
+
+// CheckIntegrity runs PRAGMA integrity_check and counts orphan rows. With
+// repair, orphan rows are deleted in a single transaction.
+func (db *DB) CheckIntegrity(repair bool) (*IntegrityReport, error) {
+	report := &IntegrityReport{Errors: []string{}, Orphans: []Orphans{}}
+
+	rows, err := db.Query("PRAGMA integrity_check")
+	if err != nil {
+		return nil, fmt.Errorf("failed to run integrity check: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var message string
+		if err := rows.Scan(&message); err != nil {
+			return nil, fmt.Errorf("failed to scan integrity check: %w", err)
+		}
+		if message != "ok" {
+			report.Errors = append(report.Errors, message)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to run integrity check: %w", err)
+	}
+
+	for _, ref := range references {
+		var count int64
+		if err := db.QueryRow("SELECT COUNT(*) FROM " + ref.orphanQuery()).Scan(&count); err != nil {
+			return nil, fmt.Errorf("failed to count orphans in %s.%s: %w", ref.Table, ref.Column, err)
+		}
+		if count > 0 {
+			report.Orphans = append(report.Orphans, Orphans{Table: ref.Table, Column: ref.Column, Parent: ref.Parent, Count: count})
+		}
+	}
+
+	if !repair || len(report.Orphans) == 0 {
+		return report, nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin repair: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, ref := range references {
+		result, err := tx.Exec("DELETE FROM " + ref.orphanQuery())
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete orphans in %s.%s: %w", ref.Table, ref.Column, err)
+		}
+		n, _ := result.RowsAffected()
+		report.Repaired += n
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit repair: %w", err)
+	}
+	return report, nil
+}
+
+// orphanQuery returns the FROM and WHERE clauses selecting the reference's
+// orphan rows
+func (ref reference) orphanQuery() string {
+	return fmt.Sprintf("%s WHERE %s NOT IN (SELECT id FROM %s)", ref.Table, ref.Column, ref.Parent)
+}
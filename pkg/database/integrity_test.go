@@ -0,0 +1,64 @@
+package database
+
+import (
+	"os"
+	"testing"
+)
+
+func TestCheckIntegrity(t *testing.T) {
+	dbPath := "/tmp/test_integrity.db"
+	defer os.Remove(dbPath)
+
+	db, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	user := &User{APIKey: "test-key", Name: "Test"}
+	db.CreateUser(user)
+	ch := &Channel{Name: "chan", BaseURL: "https://a.example.com", APIKey: "sk-a"}
+	db.CreateChannel(ch)
+	model := &Model{Name: "gpt-4"}
+	db.CreateModel(model)
+	db.AddModelChannel(&ModelChannel{ModelID: model.ID, ChannelID: ch.ID, BackendModelName: "gpt-4", Weight: 10})
+	db.CreateSession(&Session{UserID: user.ID, ChannelID: ch.ID})
+	db.UpdateChannelMetrics(ch.ID, 0.1, true)
+
+	report, err := db.CheckIntegrity(false)
+	if err != nil {
+		t.Fatalf("Failed to check integrity: %v", err)
+	}
+	if !report.OK() || len(report.Orphans) != 0 {
+		t.Fatalf("Expected a clean database, got %+v", report)
+	}
+
+	// Deleting the channel leaves its mapping, session and metrics behind
+	db.DeleteChannel(ch.ID)
+	report, err = db.CheckIntegrity(false)
+	if err != nil {
+		t.Fatalf("Failed to check integrity: %v", err)
+	}
+	if report.OK() || len(report.Orphans) != 3 {
+		t.Fatalf("Expected 3 orphaned references, got %+v", report.Orphans)
+	}
+	if mappings, _ := db.GetModelChannelsByModel(model.ID); len(mappings) != 1 {
+		t.Fatal("Expected a check without repair to leave orphans in place")
+	}
+
+	report, err = db.CheckIntegrity(true)
+	if err != nil {
+		t.Fatalf("Failed to repair: %v", err)
+	}
+	if !report.OK() || report.Repaired != 3 {
+		t.Errorf("Expected 3 rows repaired, got %+v", report)
+	}
+
+	report, _ = db.CheckIntegrity(false)
+	if len(report.Orphans) != 0 {
+		t.Errorf("Expected no orphans after repair, got %+v", report.Orphans)
+	}
+	if m, _ := db.GetModel(model.ID); m == nil {
+		t.Error("Expected the model to be kept")
+	}
+}
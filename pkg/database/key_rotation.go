@@ -0,0 +1,119 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// KeyRotation records the replacement of a user's API key. The replaced key
+// keeps authenticating the user until GraceExpiresAt.
+type KeyRotation struct {
+	ID     int64 `json:"id"`
+	UserID int64 `json:"user_id"`
+	// OldKeyHint is the tail of the replaced key; the key itself is never returned
+	OldKeyHint     string    `json:"old_key_hint"`
+	GraceExpiresAt time.Time `json:"grace_expires_at"`
+	RotatedBy      string    `json:"rotated_by,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// keyHintLength is the number of trailing characters shown of a replaced key
+const keyHintLength = 4
+
+// keyHint returns the tail of key, masking the rest
+func keyHint(key string) string {
+	if len(key) <= keyHintLength {
+		return "..."
+	}
+	return "..." + key[len(key)-keyHintLength:]
+}
+
+// RotateUserAPIKey replaces the value of a user's primary key with newKey
+// and records the rotation. The old value stays valid for grace, as an
+// additional key expiring with it; a zero grace revokes it at once. It
+// returns nil if the user does not exist.
+func (db *DB) RotateUserAPIKey(userID int64, newKey string, grace time.Duration, rotatedBy string) (*KeyRotation, error) {
+	var rotation *KeyRotation
+	err := db.Transaction(func(tx *DB) error {
+		var primaryID int64
+		var oldKey string
+		var allowedModels sql.NullString
+		err := tx.QueryRow("SELECT id, key, allowed_models FROM api_keys WHERE user_id = ? AND is_primary", userID).Scan(&primaryID, &oldKey, &allowedModels)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get primary key: %w", err)
+		}
+
+		_, err = tx.Exec("UPDATE api_keys SET key = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", newKey, primaryID)
+		if uniqueColumns(err) != nil {
+			return duplicateError("API key")
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update API key: %w", err)
+		}
+
+		now := time.Now().UTC()
+		rotation = &KeyRotation{
+			UserID:         userID,
+			OldKeyHint:     keyHint(oldKey),
+			GraceExpiresAt: now.Add(grace),
+			RotatedBy:      rotatedBy,
+			CreatedAt:      now,
+		}
+		result, err := tx.Exec(
+			"INSERT INTO api_key_rotations (user_id, old_key, grace_expires_at, rotated_by, created_at) VALUES (?, ?, ?, ?, ?)",
+			userID, oldKey, rotation.GraceExpiresAt, rotatedBy, rotation.CreatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to record key rotation: %w", err)
+		}
+		rotation.ID, _ = result.LastInsertId()
+
+		if grace <= 0 {
+			return nil
+		}
+		old := &APIKey{
+			UserID:    userID,
+			Name:      fmt.Sprintf("rotated-%d", rotation.ID),
+			Key:       oldKey,
+			Enabled:   true,
+			ExpiresAt: &rotation.GraceExpiresAt,
+		}
+		if err := decodeModelList(allowedModels, &old.AllowedModels); err != nil {
+			return fmt.Errorf("invalid allowed models for API key %d: %w", primaryID, err)
+		}
+		return tx.CreateAPIKey(old)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rotation, nil
+}
+
+// ListKeyRotations retrieves a user's key rotations, most recent first
+func (db *DB) ListKeyRotations(userID int64) ([]*KeyRotation, error) {
+	rows, err := db.Query(
+		"SELECT id, user_id, old_key, grace_expires_at, rotated_by, created_at FROM api_key_rotations WHERE user_id = ? ORDER BY id DESC",
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list key rotations: %w", err)
+	}
+	defer rows.Close()
+
+	rotations := []*KeyRotation{}
+	for rows.Next() {
+		var r KeyRotation
+		var oldKey string
+		if err := rows.Scan(&r.ID, &r.UserID, &oldKey, &r.GraceExpiresAt, &r.RotatedBy, &r.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan key rotation: %w", err)
+		}
+		r.OldKeyHint = keyHint(oldKey)
+		rotations = append(rotations, &r)
+	}
+
+	return rotations, rows.Err()
+}
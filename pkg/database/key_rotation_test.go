@@ -0,0 +1,73 @@
+package database
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRotateUserAPIKey(t *testing.T) {
+	dbPath := "/tmp/test_key_rotation.db"
+	defer os.Remove(dbPath)
+
+	db, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	user := &User{APIKey: "sk-old-1234", Name: "rotating"}
+	if err := db.CreateUser(user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	rotation, err := db.RotateUserAPIKey(user.ID, "sk-new-5678", time.Hour, "10.0.0.1")
+	if err != nil {
+		t.Fatalf("Failed to rotate key: %v", err)
+	}
+	if rotation == nil || rotation.OldKeyHint != "...1234" {
+		t.Fatalf("Unexpected rotation %+v", rotation)
+	}
+
+	// Both keys authenticate the user during the grace period
+	for _, key := range []string{"sk-new-5678", "sk-old-1234"} {
+		got, err := db.GetUserByAPIKey(key)
+		if err != nil {
+			t.Fatalf("Failed to get user by %s: %v", key, err)
+		}
+		if got == nil || got.ID != user.ID {
+			t.Errorf("Expected %s to authenticate user %d, got %+v", key, user.ID, got)
+		}
+	}
+
+	// Rotating without a grace period revokes the replaced key at once
+	if _, err := db.RotateUserAPIKey(user.ID, "sk-newer-9012", 0, ""); err != nil {
+		t.Fatalf("Failed to rotate key: %v", err)
+	}
+	if got, _ := db.GetUserByAPIKey("sk-new-5678"); got != nil {
+		t.Errorf("Expected the key rotated without grace to be revoked, got %+v", got)
+	}
+	if got, _ := db.GetUserByAPIKey("sk-old-1234"); got == nil {
+		t.Error("Expected the first key to remain within its grace period")
+	}
+
+	rotations, err := db.ListKeyRotations(user.ID)
+	if err != nil {
+		t.Fatalf("Failed to list key rotations: %v", err)
+	}
+	if len(rotations) != 2 || rotations[0].OldKeyHint != "...5678" || rotations[1].RotatedBy != "10.0.0.1" {
+		t.Errorf("Unexpected rotation history %+v", rotations)
+	}
+
+	if rotation, err := db.RotateUserAPIKey(999, "sk-missing", 0, ""); err != nil || rotation != nil {
+		t.Errorf("Expected nil for a missing user, got %+v, %v", rotation, err)
+	}
+
+	// Deleting the user revokes keys still in their grace period
+	if err := db.DeleteUser(user.ID); err != nil {
+		t.Fatalf("Failed to delete user: %v", err)
+	}
+	if got, _ := db.GetUserByAPIKey("sk-old-1234"); got != nil {
+		t.Errorf("Expected the rotated key of a deleted user to be revoked, got %+v", got)
+	}
+}
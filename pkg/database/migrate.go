@@ -0,0 +1,329 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Migration is a versioned schema change, read from the embedded
+// NNN_name.up.sql file and the NNN_name.down.sql file that reverts it
+type Migration struct {
+	Version int
+	Name    string
+	up      string
+	down    string
+}
+
+// MigrationStatus is a known migration and whether it has been applied
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// legacyVersion is the last migration of the unversioned runner, which
+// re-executed every migration file on each start. Databases it created are
+// adopted at this version.
+const legacyVersion = 39
+
+var migrationFile = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// loadMigrations parses the embedded migrations once
+var loadMigrations = sync.OnceValues(parseMigrations)
+
+// Migrations returns the migrations known to this build, oldest first
+func Migrations() ([]Migration, error) {
+	return loadMigrations()
+}
+
+// parseMigrations reads the embedded migration files. Every version must
+// have both an up and a down file.
+func parseMigrations() ([]Migration, error) {
+	entries, err := migrationsFS.ReadDir("migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		m := migrationFile.FindStringSubmatch(entry.Name())
+		if m == nil {
+			return nil, fmt.Errorf("invalid migration file name %s", entry.Name())
+		}
+		version, _ := strconv.Atoi(m[1])
+		content, err := migrationsFS.ReadFile("migrations/" + entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration file %s: %w", entry.Name(), err)
+		}
+
+		migration := byVersion[version]
+		if migration == nil {
+			migration = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has files named %s and %s", version, migration.Name, m[2])
+		}
+		if m[3] == "up" {
+			migration.up = string(content)
+		} else {
+			migration.down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.up == "" || migration.down == "" {
+			return nil, fmt.Errorf("migration %s needs both an up and a down file", migration)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// String returns the migration's file name prefix, such as 001_init
+func (m Migration) String() string {
+	return fmt.Sprintf("%03d_%s", m.Version, m.Name)
+}
+
+// Migrate applies all pending migrations and returns them
+func (db *DB) Migrate() ([]Migration, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	if len(migrations) == 0 {
+		return nil, nil
+	}
+	return db.MigrateTo(migrations[len(migrations)-1].Version)
+}
+
+// MigrateTo applies pending migrations up to version, or reverts applied
+// migrations above it, newest first, and returns the migrations run. Each
+// migration runs in a transaction with its version record, so one that fails
+// leaves the schema at the previous version.
+func (db *DB) MigrateTo(version int) ([]Migration, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := db.appliedMigrations(migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[int]bool, len(migrations))
+	for _, m := range migrations {
+		known[m.Version] = true
+	}
+	for v := range applied {
+		if v > version && !known[v] {
+			return nil, fmt.Errorf("migration %d was applied by a newer gateway and cannot be reverted by this one", v)
+		}
+	}
+
+	var run []Migration
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok || m.Version > version {
+			continue
+		}
+		if err := db.runMigration(m, true); err != nil {
+			return run, err
+		}
+		run = append(run, m)
+	}
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok || m.Version <= version {
+			continue
+		}
+		if err := db.runMigration(m, false); err != nil {
+			return run, err
+		}
+		run = append(run, m)
+	}
+	return run, nil
+}
+
+// PendingMigrations returns the known migrations not yet applied
+func (db *DB) PendingMigrations() ([]Migration, error) {
+	statuses, err := db.MigrationStatus()
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, s := range statuses {
+		if !s.Applied {
+			pending = append(pending, s.Migration)
+		}
+	}
+	return pending, nil
+}
+
+// MigrationStatus returns each known migration and whether it is applied
+func (db *DB) MigrationStatus() ([]MigrationStatus, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := db.appliedMigrations(migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		appliedAt, ok := applied[m.Version]
+		statuses[i] = MigrationStatus{Migration: m, Applied: ok, AppliedAt: appliedAt}
+	}
+	return statuses, nil
+}
+
+// SchemaVersion returns the highest applied migration, which may be one
+// unknown to this build when a newer gateway migrated the database
+func (db *DB) SchemaVersion() (int, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return 0, err
+	}
+	applied, err := db.appliedMigrations(migrations)
+	if err != nil {
+		return 0, err
+	}
+	version := 0
+	for v := range applied {
+		version = max(version, v)
+	}
+	return version, nil
+}
+
+// appliedMigrations returns when each applied migration was applied, keyed
+// by version, creating the schema_migrations table and adopting a legacy
+// database first if needed
+func (db *DB) appliedMigrations(migrations []Migration) (map[int]time.Time, error) {
+	if err := db.prepareMigrations(migrations); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan applied migration: %w", err)
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// prepareMigrations creates the schema_migrations table. A database created
+// by the unversioned runner has tables but no recorded migrations: it is
+// brought up to legacyVersion the way that runner did, then recorded at it.
+func (db *DB) prepareMigrations(migrations []Migration) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INTEGER PRIMARY KEY,
+    name TEXT NOT NULL,
+    applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+)`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	var recorded, legacy int
+	if err := db.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&recorded); err != nil {
+		return fmt.Errorf("failed to count applied migrations: %w", err)
+	}
+	if recorded > 0 {
+		return nil
+	}
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'channels'").Scan(&legacy); err != nil {
+		return fmt.Errorf("failed to check for a legacy schema: %w", err)
+	}
+	if legacy == 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, m := range migrations {
+		if m.Version > legacyVersion {
+			break
+		}
+		for _, stmt := range splitStatements(m.up) {
+			if _, err := tx.Exec(stmt); err != nil {
+				// Column additions were re-run on every start; skip the ones already applied
+				if strings.Contains(err.Error(), "duplicate column name") {
+					continue
+				}
+				return fmt.Errorf("failed to adopt legacy migration %s: %w", m, err)
+			}
+		}
+		if err := recordMigration(tx, m, true); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit legacy migrations: %w", err)
+	}
+	return nil
+}
+
+// runMigration applies or reverts a migration in a transaction
+func (db *DB) runMigration(m Migration, up bool) error {
+	script, direction := m.up, "apply"
+	if !up {
+		script, direction = m.down, "revert"
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range splitStatements(script) {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to %s migration %s: %w", direction, m, err)
+		}
+	}
+	if err := recordMigration(tx, m, up); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit migration %s: %w", m, err)
+	}
+	return nil
+}
+
+// recordMigration marks a migration applied, or no longer applied
+func recordMigration(tx *sql.Tx, m Migration, applied bool) error {
+	var err error
+	if applied {
+		_, err = tx.Exec("INSERT INTO schema_migrations (version, name) VALUES (?, ?)", m.Version, m.Name)
+	} else {
+		_, err = tx.Exec("DELETE FROM schema_migrations WHERE version = ?", m.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record migration %s: %w", m, err)
+	}
+	return nil
+}
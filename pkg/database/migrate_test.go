@@ -0,0 +1,255 @@
+package database
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// tableCount returns the number of tables other than SQLite's own and the
+// migration records
+func tableCount(t *testing.T, db *DB) int {
+	t.Helper()
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name NOT IN ('sqlite_sequence', 'schema_migrations')").Scan(&n)
+	if err != nil {
+		t.Fatalf("Failed to count tables: %v", err)
+	}
+	return n
+}
+
+func TestMigrationsLoad(t *testing.T) {
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("Expected migration %d, got %s", i+1, m)
+		}
+	}
+	if len(migrations) < legacyVersion {
+		t.Errorf("Expected at least %d migrations, got %d", legacyVersion, len(migrations))
+	}
+}
+
+func TestMigrateDownAndUp(t *testing.T) {
+	dbPath := "/tmp/test_migrate_down.db"
+	defer os.Remove(dbPath)
+
+	db, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	migrations, _ := Migrations()
+	latest := migrations[len(migrations)-1].Version
+	if v, err := db.SchemaVersion(); err != nil || v != latest {
+		t.Fatalf("Expected schema version %d, got %d (%v)", latest, v, err)
+	}
+
+	// Reverting 039 drops its column but keeps the rows
+	db.Exec("INSERT INTO channels (name, base_url, api_key, models) VALUES ('c1', 'https://api.openai.com', 'sk-test', '[]')")
+	run, err := db.MigrateTo(38)
+	if err != nil || len(run) != latest-38 || run[len(run)-1].Version != 39 {
+		t.Fatalf("Expected migrations down to 039 reverted, got %v (%v)", run, err)
+	}
+	if _, err := db.Exec("UPDATE channels SET retry_policy = NULL"); err == nil {
+		t.Error("Expected retry_policy to be dropped")
+	}
+	var name string
+	if err := db.QueryRow("SELECT name FROM channels").Scan(&name); err != nil || name != "c1" {
+		t.Errorf("Expected channels kept, got %q (%v)", name, err)
+	}
+
+	pending, err := db.PendingMigrations()
+	if err != nil || len(pending) != latest-38 || pending[0].Version != 39 {
+		t.Errorf("Expected migrations from 039 pending, got %v (%v)", pending, err)
+	}
+
+	// Every migration reverts cleanly, leaving no tables behind
+	if _, err := db.MigrateTo(0); err != nil {
+		t.Fatalf("Failed to revert all migrations: %v", err)
+	}
+	if n := tableCount(t, db); n != 0 {
+		t.Errorf("Expected no tables after reverting all migrations, got %d", n)
+	}
+	if v, _ := db.SchemaVersion(); v != 0 {
+		t.Errorf("Expected schema version 0, got %d", v)
+	}
+
+	run, err = db.Migrate()
+	if err != nil || len(run) != len(migrations) {
+		t.Fatalf("Expected all %d migrations applied again, got %d (%v)", len(migrations), len(run), err)
+	}
+	statuses, err := db.MigrationStatus()
+	if err != nil {
+		t.Fatalf("Failed to get migration status: %v", err)
+	}
+	for _, s := range statuses {
+		if !s.Applied || s.AppliedAt.IsZero() {
+			t.Errorf("Expected %s applied, got %+v", s.Migration, s)
+		}
+	}
+}
+
+func TestMigrateAdoptsLegacySchema(t *testing.T) {
+	dbPath := "/tmp/test_migrate_legacy.db"
+	defer os.Remove(dbPath)
+
+	// Build the schema the way the unversioned runner did, without records
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	migrations, _ := Migrations()
+	for _, m := range migrations[:legacyVersion] {
+		for _, stmt := range splitStatements(m.up) {
+			if _, err := db.Exec(stmt); err != nil {
+				t.Fatalf("Failed to run %s: %v", m, err)
+			}
+		}
+	}
+	db.Exec("INSERT INTO users (api_key, name) VALUES ('legacy-key', 'Legacy')")
+	db.Close()
+
+	db, err = New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to adopt legacy database: %v", err)
+	}
+	defer db.Close()
+
+	statuses, err := db.MigrationStatus()
+	if err != nil {
+		t.Fatalf("Failed to get migration status: %v", err)
+	}
+	for _, s := range statuses {
+		if !s.Applied {
+			t.Errorf("Expected %s applied", s.Migration)
+		}
+	}
+	if user, err := db.GetUserByAPIKey("legacy-key"); err != nil || user == nil || user.Name != "Legacy" {
+		t.Errorf("Expected legacy data kept, got %+v (%v)", user, err)
+	}
+}
+
+func TestMigrateMovesUserKeysToAPIKeys(t *testing.T) {
+	dbPath := "/tmp/test_migrate_primary_keys.db"
+	os.Remove(dbPath)
+	defer os.Remove(dbPath)
+
+	// A database whose users still hold their key themselves
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	if _, err := db.MigrateTo(40); err != nil {
+		t.Fatalf("Failed to migrate to 040: %v", err)
+	}
+	for _, stmt := range []string{
+		"INSERT INTO users (id, api_key, name) VALUES (1, 'sk-alice', 'alice')",
+		"INSERT INTO users (id, api_key, name) VALUES (2, 'sk-bob', 'bob')",
+		"INSERT INTO users (id, api_key, name) VALUES (9, 'sk-gone', 'gone')",
+		"DELETE FROM users WHERE id = 9",
+		"INSERT INTO api_keys (user_id, name, key) VALUES (2, 'primary', 'sk-bob-ci')",
+		"INSERT INTO usage_logs (user_id, model, channel_id, total_tokens) VALUES (1, 'gpt-4', 1, 10)",
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("Failed to run %q: %v", stmt, err)
+		}
+	}
+	// A key rotated within its grace period, and one whose grace is over
+	now := time.Now().UTC()
+	db.Exec("INSERT INTO api_key_rotations (user_id, old_key, grace_expires_at, created_at) VALUES (1, 'sk-alice-old', ?, ?)", now.Add(time.Hour), now)
+	db.Exec("INSERT INTO api_key_rotations (user_id, old_key, grace_expires_at, created_at) VALUES (1, 'sk-alice-older', ?, ?)", now.Add(-time.Hour), now)
+	db.Close()
+
+	db, err = New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+	defer db.Close()
+
+	for _, value := range []string{"sk-alice", "sk-alice-old", "sk-bob", "sk-bob-ci"} {
+		if user, _ := db.GetUserByAPIKey(value); user == nil {
+			t.Errorf("Expected %s to authenticate its user", value)
+		}
+	}
+	if user, _ := db.GetUserByAPIKey("sk-alice-older"); user != nil {
+		t.Error("Expected a rotated key past its grace period to be rejected")
+	}
+	_, alice, _ := db.LookupAPIKey("sk-alice")
+	if alice == nil || !alice.Primary || alice.Name != PrimaryKeyName {
+		t.Errorf("Expected alice's key as primary key, got %+v", alice)
+	}
+	if _, bob, _ := db.LookupAPIKey("sk-bob"); bob == nil || !bob.Primary || bob.Name != "primary-2" {
+		t.Errorf("Expected bob's key renamed next to his own primary key, got %+v", bob)
+	}
+
+	logs, err := db.ListUsageLogs(UsageQuery{UserID: 1}, 10)
+	if err != nil || len(logs) != 1 || alice == nil || logs[0].APIKeyID != alice.ID {
+		t.Errorf("Expected usage attributed to the primary key, got %+v (%v)", logs, err)
+	}
+
+	// IDs of deleted users are not reused
+	user := &User{Name: "carol", APIKey: "sk-carol"}
+	if err := db.CreateUser(user); err != nil || user.ID != 10 {
+		t.Errorf("Expected the new user to get ID 10, got %d (%v)", user.ID, err)
+	}
+}
+
+func TestMigrateRenamesDuplicateUserNames(t *testing.T) {
+	dbPath := "/tmp/test_migrate_duplicate_names.db"
+	defer os.Remove(dbPath)
+
+	// A legacy database created before user names had to be unique
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	migrations, _ := Migrations()
+	for _, m := range migrations[:5] {
+		for _, stmt := range splitStatements(m.up) {
+			if _, err := db.Exec(stmt); err != nil {
+				t.Fatalf("Failed to run %s: %v", m, err)
+			}
+		}
+	}
+	for _, key := range []string{"key-1", "key-2", "key-3"} {
+		if _, err := db.Exec("INSERT INTO users (api_key, name) VALUES (?, 'alice')", key); err != nil {
+			t.Fatalf("Failed to insert user: %v", err)
+		}
+	}
+	db.Exec("INSERT INTO users (api_key, name) VALUES ('key-4', '')")
+	db.Exec("INSERT INTO users (api_key, name) VALUES ('key-5', '')")
+	db.Close()
+
+	db, err = New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to migrate database with duplicate names: %v", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query("SELECT name FROM users ORDER BY id")
+	if err != nil {
+		t.Fatalf("Failed to list users: %v", err)
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		rows.Scan(&name)
+		names = append(names, name)
+	}
+	want := []string{"alice", "alice-2", "alice-3", "", ""}
+	if len(names) != len(want) {
+		t.Fatalf("Expected names %v, got %v", want, names)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Errorf("Expected names %v, got %v", want, names)
+			break
+		}
+	}
+}
@@ -0,0 +1,8 @@
+-- Migration: 001_init
+-- Created: 2026-10-16
+-- Description: Drop the channels, users, sessions and channel_metrics tables
+
+DROP TABLE IF EXISTS channel_metrics;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS channels;
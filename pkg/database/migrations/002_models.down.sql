@@ -0,0 +1,6 @@
+-- Migration: 002_models
+-- Created: 2026-10-16
+-- Description: Drop the models and model_channels tables
+
+DROP TABLE IF EXISTS model_channels;
+DROP TABLE IF EXISTS models;
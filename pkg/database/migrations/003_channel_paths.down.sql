@@ -0,0 +1,5 @@
+-- Migration: 003_channel_paths
+-- Created: 2026-10-16
+-- Description: Drop channel path templates
+
+ALTER TABLE channels DROP COLUMN path_templates;
@@ -0,0 +1,5 @@
+-- Migration: 003_channel_paths
+-- Created: 2026-10-16
+-- Description: Add per-channel upstream path templates keyed by operation
+
+ALTER TABLE channels ADD COLUMN path_templates TEXT; -- JSON object of operation -> path template
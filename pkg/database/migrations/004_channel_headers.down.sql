@@ -0,0 +1,7 @@
+-- Migration: 004_channel_headers
+-- Created: 2026-10-16
+-- Description: Drop channel organization, project and API version
+
+ALTER TABLE channels DROP COLUMN organization;
+ALTER TABLE channels DROP COLUMN project;
+ALTER TABLE channels DROP COLUMN api_version;
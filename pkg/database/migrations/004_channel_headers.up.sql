@@ -0,0 +1,7 @@
+-- Migration: 004_channel_headers
+-- Created: 2026-10-16
+-- Description: Add per-channel OpenAI organization/project headers and API version pinning
+
+ALTER TABLE channels ADD COLUMN organization TEXT NOT NULL DEFAULT '';
+ALTER TABLE channels ADD COLUMN project TEXT NOT NULL DEFAULT '';
+ALTER TABLE channels ADD COLUMN api_version TEXT NOT NULL DEFAULT '';
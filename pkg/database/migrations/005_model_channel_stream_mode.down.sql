@@ -0,0 +1,5 @@
+-- Migration: 005_model_channel_stream_mode
+-- Created: 2026-10-16
+-- Description: Drop mapping stream modes
+
+ALTER TABLE model_channels DROP COLUMN stream_mode;
@@ -0,0 +1,5 @@
+-- Migration: 005_model_channel_stream_mode
+-- Created: 2026-10-16
+-- Description: Add per-mapping stream mode so the gateway can transcode between streaming and non-streaming backends
+
+ALTER TABLE model_channels ADD COLUMN stream_mode TEXT NOT NULL DEFAULT 'passthrough';
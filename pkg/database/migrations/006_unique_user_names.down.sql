@@ -0,0 +1,5 @@
+-- Migration: 006_unique_user_names
+-- Created: 2026-10-16
+-- Description: Allow duplicate user names again
+
+DROP INDEX IF EXISTS idx_users_name;
@@ -0,0 +1,11 @@
+-- Migration: 006_unique_user_names
+-- Created: 2026-10-16
+-- Description: Enforce unique user names (unnamed users are exempt)
+
+-- Users sharing a name keep it on the oldest of them, the others get their
+-- ID appended so the index can be created
+UPDATE users SET name = name || '-' || id
+WHERE name IS NOT NULL AND name != ''
+  AND id NOT IN (SELECT MIN(id) FROM users WHERE name IS NOT NULL AND name != '' GROUP BY name);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_name ON users(name) WHERE name IS NOT NULL AND name != '';
@@ -0,0 +1,7 @@
+-- Migration: 007_user_sync
+-- Created: 2026-10-16
+-- Description: Drop user enabled flags and external IDs
+
+DROP INDEX IF EXISTS idx_users_external_id;
+ALTER TABLE users DROP COLUMN external_id;
+ALTER TABLE users DROP COLUMN enabled;
@@ -0,0 +1,8 @@
+-- Migration: 007_user_sync
+-- Created: 2026-10-16
+-- Description: Allow users to be disabled and linked to an external identity source
+
+ALTER TABLE users ADD COLUMN enabled BOOLEAN NOT NULL DEFAULT 1;
+ALTER TABLE users ADD COLUMN external_id TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_external_id ON users(external_id) WHERE external_id IS NOT NULL;
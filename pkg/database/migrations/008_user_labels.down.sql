@@ -0,0 +1,6 @@
+-- Migration: 008_user_labels
+-- Created: 2026-10-16
+-- Description: Drop user metadata and labels
+
+ALTER TABLE users DROP COLUMN labels;
+ALTER TABLE users DROP COLUMN metadata;
@@ -0,0 +1,6 @@
+-- Migration: 008_user_labels
+-- Created: 2026-10-16
+-- Description: Attach arbitrary JSON metadata and key/value labels to users
+
+ALTER TABLE users ADD COLUMN metadata TEXT;
+ALTER TABLE users ADD COLUMN labels TEXT;
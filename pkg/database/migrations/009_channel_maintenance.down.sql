@@ -0,0 +1,6 @@
+-- Migration: 009_channel_maintenance
+-- Created: 2026-10-16
+-- Description: Drop channel notes and maintenance windows
+
+ALTER TABLE channels DROP COLUMN maintenance_until;
+ALTER TABLE channels DROP COLUMN notes;
@@ -0,0 +1,6 @@
+-- Migration: 009_channel_maintenance
+-- Created: 2026-10-16
+-- Description: Free-text notes and maintenance windows on channels
+
+ALTER TABLE channels ADD COLUMN notes TEXT NOT NULL DEFAULT '';
+ALTER TABLE channels ADD COLUMN maintenance_until DATETIME;
@@ -0,0 +1,5 @@
+-- Migration: 010_channel_concurrency
+-- Created: 2026-10-16
+-- Description: Drop channel concurrency limits
+
+ALTER TABLE channels DROP COLUMN max_concurrency;
@@ -0,0 +1,5 @@
+-- Migration: 010_channel_concurrency
+-- Created: 2026-10-16
+-- Description: Per-channel concurrent request limit (0 = unlimited)
+
+ALTER TABLE channels ADD COLUMN max_concurrency INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,5 @@
+-- Migration: 011_channel_status
+-- Created: 2026-10-16
+-- Description: Drop channel statuses
+
+ALTER TABLE channels DROP COLUMN status;
@@ -0,0 +1,5 @@
+-- Migration: 011_channel_status
+-- Created: 2026-10-16
+-- Description: Persistent channel status, e.g. auth_failed after repeated 401/403 from the backend
+
+ALTER TABLE channels ADD COLUMN status TEXT NOT NULL DEFAULT '';
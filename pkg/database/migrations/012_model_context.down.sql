@@ -0,0 +1,6 @@
+-- Migration: 012_model_context
+-- Created: 2026-10-16
+-- Description: Drop model context windows and truncation
+
+ALTER TABLE models DROP COLUMN truncate;
+ALTER TABLE models DROP COLUMN context_window;
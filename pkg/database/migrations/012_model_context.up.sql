@@ -0,0 +1,6 @@
+-- Migration: 012_model_context
+-- Created: 2026-10-16
+-- Description: Model context window and opt-in conversation truncation
+
+ALTER TABLE models ADD COLUMN context_window INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE models ADD COLUMN truncate BOOLEAN NOT NULL DEFAULT 0;
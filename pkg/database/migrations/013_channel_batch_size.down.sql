@@ -0,0 +1,5 @@
+-- Migration: 013_channel_batch_size
+-- Created: 2026-10-16
+-- Description: Drop channel batch size limits
+
+ALTER TABLE channels DROP COLUMN max_batch_size;
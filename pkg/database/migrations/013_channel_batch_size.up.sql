@@ -0,0 +1,5 @@
+-- Migration: 013_channel_batch_size
+-- Created: 2026-10-16
+-- Description: Maximum embeddings inputs per upstream request (0 = unlimited)
+
+ALTER TABLE channels ADD COLUMN max_batch_size INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,5 @@
+-- Migration: 014_audit_log
+-- Created: 2026-10-16
+-- Description: Drop the audit log
+
+DROP TABLE IF EXISTS audit_log;
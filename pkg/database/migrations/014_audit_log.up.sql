@@ -0,0 +1,16 @@
+-- Migration: 014_audit_log
+-- Created: 2026-10-16
+-- Description: Audit log of admin actions with before/after snapshots
+
+CREATE TABLE IF NOT EXISTS audit_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    action TEXT NOT NULL,
+    target_type TEXT NOT NULL,
+    target_id INTEGER NOT NULL,
+    actor TEXT NOT NULL DEFAULT '',
+    before TEXT,
+    after TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log(target_type, target_id);
@@ -0,0 +1,5 @@
+-- Migration: 015_user_channel_history
+-- Created: 2026-10-16
+-- Description: Drop the last channel of each user
+
+DROP TABLE IF EXISTS user_channel_history;
@@ -0,0 +1,11 @@
+-- Migration: 015_user_channel_history
+-- Created: 2026-10-16
+-- Description: Last channel each user was routed to, kept after sessions expire
+
+CREATE TABLE IF NOT EXISTS user_channel_history (
+    user_id INTEGER PRIMARY KEY,
+    channel_id INTEGER NOT NULL,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (channel_id) REFERENCES channels(id) ON DELETE CASCADE
+);
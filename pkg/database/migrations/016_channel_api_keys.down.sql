@@ -0,0 +1,5 @@
+-- Migration: 016_channel_api_keys
+-- Created: 2026-10-16
+-- Description: Drop additional channel API keys
+
+ALTER TABLE channels DROP COLUMN api_keys;
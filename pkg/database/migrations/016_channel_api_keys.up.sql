@@ -0,0 +1,5 @@
+-- Migration: 016_channel_api_keys
+-- Created: 2026-10-16
+-- Description: Additional upstream API keys rotated with api_key (JSON array)
+
+ALTER TABLE channels ADD COLUMN api_keys TEXT;
@@ -0,0 +1,5 @@
+-- Migration: 017_channel_test_only
+-- Created: 2026-10-16
+-- Description: Drop the channel test-only flag
+
+ALTER TABLE channels DROP COLUMN test_only;
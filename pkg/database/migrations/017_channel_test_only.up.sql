@@ -0,0 +1,5 @@
+-- Migration: 017_channel_test_only
+-- Created: 2026-10-16
+-- Description: Test-only channels, never selected for user traffic
+
+ALTER TABLE channels ADD COLUMN test_only INTEGER NOT NULL DEFAULT 0;
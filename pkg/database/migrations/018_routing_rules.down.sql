@@ -0,0 +1,5 @@
+-- Migration: 018_routing_rules
+-- Created: 2026-10-16
+-- Description: Drop routing rules
+
+DROP TABLE IF EXISTS routing_rules;
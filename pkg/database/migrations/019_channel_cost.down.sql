@@ -0,0 +1,5 @@
+-- Migration: 019_channel_cost
+-- Created: 2026-10-16
+-- Description: Drop channel costs
+
+ALTER TABLE channels DROP COLUMN cost;
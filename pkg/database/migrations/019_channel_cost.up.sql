@@ -0,0 +1,5 @@
+-- Migration: 019_channel_cost
+-- Created: 2026-10-16
+-- Description: Relative cost of a channel for cost-optimized routing (0 = unset)
+
+ALTER TABLE channels ADD COLUMN cost REAL NOT NULL DEFAULT 0;
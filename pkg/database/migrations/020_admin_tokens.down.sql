@@ -0,0 +1,5 @@
+-- Migration: 020_admin_tokens
+-- Created: 2026-10-16
+-- Description: Drop admin tokens
+
+DROP TABLE IF EXISTS admin_tokens;
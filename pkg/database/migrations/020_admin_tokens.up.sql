@@ -0,0 +1,10 @@
+-- Migration: 020_admin_tokens
+-- Created: 2026-10-16
+-- Description: Bearer tokens that authenticate the admin API
+
+CREATE TABLE IF NOT EXISTS admin_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE,
+    token TEXT NOT NULL UNIQUE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
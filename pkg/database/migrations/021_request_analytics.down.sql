@@ -0,0 +1,5 @@
+-- Migration: 021_request_analytics
+-- Created: 2026-10-16
+-- Description: Drop request analytics
+
+DROP TABLE IF EXISTS request_analytics;
@@ -0,0 +1,17 @@
+-- Migration: 021_request_analytics
+-- Created: 2026-10-16
+-- Description: Hourly chat completion aggregates per model, user and finish reason
+
+CREATE TABLE IF NOT EXISTS request_analytics (
+    bucket INTEGER NOT NULL, -- start of the hour, in Unix seconds
+    model TEXT NOT NULL,
+    user_id INTEGER NOT NULL,
+    finish_reason TEXT NOT NULL DEFAULT '',
+    requests INTEGER NOT NULL DEFAULT 0,
+    usage_requests INTEGER NOT NULL DEFAULT 0,
+    prompt_tokens INTEGER NOT NULL DEFAULT 0,
+    completion_tokens INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (bucket, model, user_id, finish_reason)
+);
+
+CREATE INDEX IF NOT EXISTS idx_request_analytics_user ON request_analytics(user_id, bucket);
@@ -0,0 +1,21 @@
+-- Migration: 022_session_keys
+-- Created: 2026-10-16
+-- Description: Key sessions by user and channel again, keeping each pair's most recently used session
+
+DROP TABLE IF EXISTS sessions_rebuild;
+CREATE TABLE sessions_rebuild (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    channel_id INTEGER NOT NULL,
+    last_used_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (channel_id) REFERENCES channels(id) ON DELETE CASCADE,
+    UNIQUE(user_id, channel_id)
+);
+INSERT OR IGNORE INTO sessions_rebuild (id, user_id, channel_id, last_used_at, created_at)
+    SELECT id, user_id, channel_id, last_used_at, created_at FROM sessions ORDER BY last_used_at DESC;
+DROP TABLE sessions;
+ALTER TABLE sessions_rebuild RENAME TO sessions;
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
+CREATE INDEX IF NOT EXISTS idx_sessions_last_used ON sessions(last_used_at);
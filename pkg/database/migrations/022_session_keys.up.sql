@@ -0,0 +1,33 @@
+-- Migration: 022_session_keys
+-- Created: 2026-10-16
+-- Description: Sticky sessions keyed by end user (OpenAI "user" field or X-Session-Key) within an API key
+
+ALTER TABLE sessions ADD COLUMN session_key TEXT NOT NULL DEFAULT '';
+
+-- SQLite cannot change a table's unique constraint in place, so sessions are
+-- copied into a table allowing one session per key and channel. Adopting a
+-- database created before migrations were tracked runs this again, and the
+-- copy keeps the existing sessions.
+DROP TABLE IF EXISTS sessions_rebuild;
+
+CREATE TABLE sessions_rebuild (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    session_key TEXT NOT NULL DEFAULT '',
+    channel_id INTEGER NOT NULL,
+    last_used_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (channel_id) REFERENCES channels(id) ON DELETE CASCADE,
+    UNIQUE(user_id, session_key, channel_id)
+);
+
+INSERT INTO sessions_rebuild (id, user_id, session_key, channel_id, last_used_at, created_at)
+    SELECT id, user_id, session_key, channel_id, last_used_at, created_at FROM sessions;
+
+DROP TABLE sessions;
+
+ALTER TABLE sessions_rebuild RENAME TO sessions;
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id, session_key);
+CREATE INDEX IF NOT EXISTS idx_sessions_last_used ON sessions(last_used_at);
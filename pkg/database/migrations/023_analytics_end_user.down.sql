@@ -0,0 +1,22 @@
+-- Migration: 023_analytics_end_user
+-- Created: 2026-10-16
+-- Description: Merge request analytics of all end users
+
+DROP TABLE IF EXISTS request_analytics_rebuild;
+CREATE TABLE request_analytics_rebuild (
+    bucket INTEGER NOT NULL, -- start of the hour, in Unix seconds
+    model TEXT NOT NULL,
+    user_id INTEGER NOT NULL,
+    finish_reason TEXT NOT NULL DEFAULT '',
+    requests INTEGER NOT NULL DEFAULT 0,
+    usage_requests INTEGER NOT NULL DEFAULT 0,
+    prompt_tokens INTEGER NOT NULL DEFAULT 0,
+    completion_tokens INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (bucket, model, user_id, finish_reason)
+);
+INSERT INTO request_analytics_rebuild (bucket, model, user_id, finish_reason, requests, usage_requests, prompt_tokens, completion_tokens)
+    SELECT bucket, model, user_id, finish_reason, SUM(requests), SUM(usage_requests), SUM(prompt_tokens), SUM(completion_tokens)
+    FROM request_analytics GROUP BY bucket, model, user_id, finish_reason;
+DROP TABLE request_analytics;
+ALTER TABLE request_analytics_rebuild RENAME TO request_analytics;
+CREATE INDEX IF NOT EXISTS idx_request_analytics_user ON request_analytics(user_id, bucket);
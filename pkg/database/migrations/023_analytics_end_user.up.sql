@@ -0,0 +1,32 @@
+-- Migration: 023_analytics_end_user
+-- Created: 2026-10-16
+-- Description: Split chat completion aggregates by the request's OpenAI "user" field
+
+ALTER TABLE request_analytics ADD COLUMN end_user TEXT NOT NULL DEFAULT '';
+
+-- The end user joins the primary key, which SQLite cannot change in place,
+-- so the aggregates are copied into a rebuilt table
+DROP TABLE IF EXISTS request_analytics_rebuild;
+
+CREATE TABLE request_analytics_rebuild (
+    bucket INTEGER NOT NULL, -- start of the hour, in Unix seconds
+    model TEXT NOT NULL,
+    user_id INTEGER NOT NULL,
+    end_user TEXT NOT NULL DEFAULT '',
+    finish_reason TEXT NOT NULL DEFAULT '',
+    requests INTEGER NOT NULL DEFAULT 0,
+    usage_requests INTEGER NOT NULL DEFAULT 0,
+    prompt_tokens INTEGER NOT NULL DEFAULT 0,
+    completion_tokens INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (bucket, model, user_id, end_user, finish_reason)
+);
+
+INSERT INTO request_analytics_rebuild (bucket, model, user_id, end_user, finish_reason, requests, usage_requests, prompt_tokens, completion_tokens)
+    SELECT bucket, model, user_id, end_user, finish_reason, requests, usage_requests, prompt_tokens, completion_tokens FROM request_analytics;
+
+DROP TABLE request_analytics;
+
+ALTER TABLE request_analytics_rebuild RENAME TO request_analytics;
+
+CREATE INDEX IF NOT EXISTS idx_request_analytics_user ON request_analytics(user_id, bucket);
+CREATE INDEX IF NOT EXISTS idx_request_analytics_end_user ON request_analytics(user_id, end_user, bucket);
@@ -0,0 +1,6 @@
+-- Migration: 024_probes
+-- Created: 2026-10-16
+-- Description: Drop synthetic probes and their results
+
+DROP TABLE IF EXISTS probe_results;
+DROP TABLE IF EXISTS probes;
@@ -0,0 +1,5 @@
+-- Migration: 025_usage_logs
+-- Created: 2026-10-16
+-- Description: Drop the usage log
+
+DROP TABLE IF EXISTS usage_logs;
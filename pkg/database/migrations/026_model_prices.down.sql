@@ -0,0 +1,8 @@
+-- Migration: 026_model_prices
+-- Created: 2026-10-16
+-- Description: Drop model prices and usage costs
+
+DROP INDEX IF EXISTS idx_usage_logs_channel;
+ALTER TABLE usage_logs DROP COLUMN cost;
+ALTER TABLE usage_logs DROP COLUMN backend_model;
+DROP TABLE IF EXISTS model_prices;
@@ -0,0 +1,17 @@
+-- Migration: 026_model_prices
+-- Created: 2026-10-16
+-- Description: Token prices per backend model, and the cost of each usage log
+
+CREATE TABLE IF NOT EXISTS model_prices (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    backend_model TEXT NOT NULL UNIQUE,
+    input_price REAL NOT NULL DEFAULT 0, -- USD per 1K prompt tokens
+    output_price REAL NOT NULL DEFAULT 0, -- USD per 1K completion tokens
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE usage_logs ADD COLUMN backend_model TEXT NOT NULL DEFAULT '';
+ALTER TABLE usage_logs ADD COLUMN cost REAL NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_usage_logs_channel ON usage_logs(channel_id, created_at);
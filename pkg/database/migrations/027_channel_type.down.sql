@@ -0,0 +1,5 @@
+-- Migration: 027_channel_type
+-- Created: 2026-10-16
+-- Description: Drop channel types
+
+ALTER TABLE channels DROP COLUMN type;
@@ -0,0 +1,5 @@
+-- Migration: 027_channel_type
+-- Created: 2026-10-16
+-- Description: API a channel's backend speaks (openai or anthropic)
+
+ALTER TABLE channels ADD COLUMN type TEXT NOT NULL DEFAULT 'openai';
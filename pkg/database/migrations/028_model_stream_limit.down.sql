@@ -0,0 +1,5 @@
+-- Migration: 028_model_stream_limit
+-- Created: 2026-10-16
+-- Description: Drop model stream duration limits
+
+ALTER TABLE models DROP COLUMN max_stream_seconds;
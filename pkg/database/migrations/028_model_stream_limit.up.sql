@@ -0,0 +1,5 @@
+-- Migration: 028_model_stream_limit
+-- Created: 2026-10-16
+-- Description: Per-model cap on streaming duration
+
+ALTER TABLE models ADD COLUMN max_stream_seconds INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,5 @@
+-- Migration: 029_api_key_rotations
+-- Created: 2026-10-16
+-- Description: Drop API key rotation grace periods
+
+DROP TABLE IF EXISTS api_key_rotations;
@@ -0,0 +1,16 @@
+-- Migration: 029_api_key_rotations
+-- Created: 2026-10-16
+-- Description: History of user API key rotations, keeping replaced keys valid for a grace period
+
+CREATE TABLE IF NOT EXISTS api_key_rotations (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    old_key TEXT NOT NULL,
+    grace_expires_at DATETIME NOT NULL,
+    rotated_by TEXT NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_key_rotations_user ON api_key_rotations(user_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_api_key_rotations_old_key ON api_key_rotations(old_key, grace_expires_at);
@@ -0,0 +1,5 @@
+-- Migration: 030_feature_flags
+-- Created: 2026-10-16
+-- Description: Drop feature flags
+
+DROP TABLE IF EXISTS feature_flags;
@@ -0,0 +1,14 @@
+-- Migration: 030_feature_flags
+-- Created: 2026-10-16
+-- Description: Feature flags gating new behaviors per user or by percentage rollout
+
+CREATE TABLE IF NOT EXISTS feature_flags (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    enabled BOOLEAN NOT NULL DEFAULT 0,
+    rollout_percent INTEGER NOT NULL DEFAULT 0,
+    user_ids TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,6 @@
+-- Migration: 031_api_keys
+-- Created: 2026-10-16
+-- Description: Drop additional user API keys
+
+ALTER TABLE usage_logs DROP COLUMN api_key_id;
+DROP TABLE IF EXISTS api_keys;
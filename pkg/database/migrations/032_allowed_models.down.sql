@@ -0,0 +1,6 @@
+-- Migration: 032_allowed_models
+-- Created: 2026-10-16
+-- Description: Drop allowed model lists
+
+ALTER TABLE api_keys DROP COLUMN allowed_models;
+ALTER TABLE users DROP COLUMN allowed_models;
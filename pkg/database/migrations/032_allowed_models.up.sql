@@ -0,0 +1,6 @@
+-- Migration: 032_allowed_models
+-- Created: 2026-10-16
+-- Description: Models a user or API key may call, NULL allowing every model
+
+ALTER TABLE users ADD COLUMN allowed_models TEXT;
+ALTER TABLE api_keys ADD COLUMN allowed_models TEXT;
@@ -0,0 +1,5 @@
+-- Migration: 033_user_quotas
+-- Created: 2026-10-16
+-- Description: Drop user quotas
+
+DROP TABLE IF EXISTS user_quotas;
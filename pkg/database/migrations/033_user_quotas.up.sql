@@ -0,0 +1,13 @@
+-- Migration: 033_user_quotas
+-- Created: 2026-10-16
+-- Description: Monthly token and cost budgets per user
+
+CREATE TABLE IF NOT EXISTS user_quotas (
+    user_id INTEGER PRIMARY KEY,
+    monthly_tokens INTEGER NOT NULL DEFAULT 0,
+    monthly_cost REAL NOT NULL DEFAULT 0,
+    reset_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,5 @@
+-- Migration: 034_usage_rollups
+-- Created: 2026-10-16
+-- Description: Drop usage rollups
+
+DROP TABLE IF EXISTS usage_rollups;
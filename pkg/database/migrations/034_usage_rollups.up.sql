@@ -0,0 +1,23 @@
+-- Migration: 034_usage_rollups
+-- Created: 2026-10-16
+-- Description: Hourly and daily aggregates replacing old usage logs
+
+CREATE TABLE IF NOT EXISTS usage_rollups (
+    period TEXT NOT NULL, -- hour or day
+    bucket DATETIME NOT NULL, -- start of the period
+    user_id INTEGER NOT NULL,
+    api_key_id INTEGER NOT NULL DEFAULT 0,
+    model TEXT NOT NULL,
+    channel_id INTEGER NOT NULL,
+    backend_model TEXT NOT NULL DEFAULT '',
+    end_user TEXT NOT NULL DEFAULT '',
+    requests INTEGER NOT NULL DEFAULT 0,
+    prompt_tokens INTEGER NOT NULL DEFAULT 0,
+    completion_tokens INTEGER NOT NULL DEFAULT 0,
+    total_tokens INTEGER NOT NULL DEFAULT 0,
+    cost REAL NOT NULL DEFAULT 0,
+    PRIMARY KEY (period, bucket, user_id, api_key_id, model, channel_id, backend_model, end_user)
+);
+
+CREATE INDEX IF NOT EXISTS idx_usage_rollups_user ON usage_rollups(user_id, bucket);
+CREATE INDEX IF NOT EXISTS idx_usage_rollups_bucket ON usage_rollups(bucket);
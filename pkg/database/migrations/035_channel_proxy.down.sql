@@ -0,0 +1,5 @@
+-- Migration: 035_channel_proxy
+-- Created: 2026-10-16
+-- Description: Drop channel proxy URLs
+
+ALTER TABLE channels DROP COLUMN proxy_url;
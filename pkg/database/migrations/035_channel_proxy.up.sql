@@ -0,0 +1,5 @@
+-- Migration: 035_channel_proxy
+-- Created: 2026-10-16
+-- Description: Proxy URL a channel's upstream requests are sent through (empty = the configured default)
+
+ALTER TABLE channels ADD COLUMN proxy_url TEXT NOT NULL DEFAULT '';
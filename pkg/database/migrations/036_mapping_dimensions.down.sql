@@ -0,0 +1,5 @@
+-- Migration: 036_mapping_dimensions
+-- Created: 2026-10-16
+-- Description: Drop mapping embedding dimensions
+
+ALTER TABLE model_channels DROP COLUMN dimensions;
@@ -0,0 +1,5 @@
+-- Migration: 036_mapping_dimensions
+-- Created: 2026-10-16
+-- Description: Output dimensionality of an embeddings mapping's backend (0 = unknown)
+
+ALTER TABLE model_channels ADD COLUMN dimensions INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,5 @@
+-- Migration: 037_channel_health
+-- Created: 2026-10-16
+-- Description: Drop channel health
+
+DROP TABLE IF EXISTS channel_health;
@@ -0,0 +1,12 @@
+-- Migration: 037_channel_health
+-- Created: 2026-10-16
+-- Description: Health of each channel as found by active checks, kept across restarts
+
+CREATE TABLE IF NOT EXISTS channel_health (
+    channel_id INTEGER PRIMARY KEY,
+    status TEXT NOT NULL DEFAULT 'unknown',
+    consecutive_failures INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    last_checked DATETIME,
+    FOREIGN KEY (channel_id) REFERENCES channels(id) ON DELETE CASCADE
+);
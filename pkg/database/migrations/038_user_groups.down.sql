@@ -0,0 +1,6 @@
+-- Migration: 038_user_groups
+-- Created: 2026-10-16
+-- Description: Drop user groups and their members
+
+DROP TABLE IF EXISTS user_group_members;
+DROP TABLE IF EXISTS user_groups;
@@ -0,0 +1,5 @@
+-- Migration: 039_channel_retry_policy
+-- Created: 2026-10-16
+-- Description: Drop channel retry policy overrides
+
+ALTER TABLE channels DROP COLUMN retry_policy;
@@ -0,0 +1,5 @@
+-- Migration: 039_channel_retry_policy
+-- Created: 2026-10-16
+-- Description: Per-channel override of the upstream retry policy as JSON (NULL = the configured policy)
+
+ALTER TABLE channels ADD COLUMN retry_policy TEXT;
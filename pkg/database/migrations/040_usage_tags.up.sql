@@ -0,0 +1,30 @@
+-- Migration: 040_usage_tags
+-- Created: 2026-10-16
+-- Description: Client attribution tags of each usage log, kept through rollups
+
+ALTER TABLE usage_logs ADD COLUMN tags TEXT NOT NULL DEFAULT '';
+
+DROP TABLE IF EXISTS usage_rollups_rebuild;
+CREATE TABLE usage_rollups_rebuild (
+    period TEXT NOT NULL, -- hour or day
+    bucket DATETIME NOT NULL, -- start of the period
+    user_id INTEGER NOT NULL,
+    api_key_id INTEGER NOT NULL DEFAULT 0,
+    model TEXT NOT NULL,
+    channel_id INTEGER NOT NULL,
+    backend_model TEXT NOT NULL DEFAULT '',
+    end_user TEXT NOT NULL DEFAULT '',
+    tags TEXT NOT NULL DEFAULT '', -- sorted key=value pairs, comma-separated
+    requests INTEGER NOT NULL DEFAULT 0,
+    prompt_tokens INTEGER NOT NULL DEFAULT 0,
+    completion_tokens INTEGER NOT NULL DEFAULT 0,
+    total_tokens INTEGER NOT NULL DEFAULT 0,
+    cost REAL NOT NULL DEFAULT 0,
+    PRIMARY KEY (period, bucket, user_id, api_key_id, model, channel_id, backend_model, end_user, tags)
+);
+INSERT INTO usage_rollups_rebuild (period, bucket, user_id, api_key_id, model, channel_id, backend_model, end_user, requests, prompt_tokens, completion_tokens, total_tokens, cost)
+    SELECT period, bucket, user_id, api_key_id, model, channel_id, backend_model, end_user, requests, prompt_tokens, completion_tokens, total_tokens, cost FROM usage_rollups;
+DROP TABLE usage_rollups;
+ALTER TABLE usage_rollups_rebuild RENAME TO usage_rollups;
+CREATE INDEX IF NOT EXISTS idx_usage_rollups_user ON usage_rollups(user_id, bucket);
+CREATE INDEX IF NOT EXISTS idx_usage_rollups_bucket ON usage_rollups(bucket);
@@ -0,0 +1,43 @@
+-- Migration: 041_primary_api_keys
+-- Created: 2026-10-16
+-- Description: Move primary API keys back onto their users
+
+DROP TABLE IF EXISTS users_rebuild;
+
+CREATE TABLE users_rebuild (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    api_key TEXT NOT NULL UNIQUE,
+    name TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    enabled BOOLEAN NOT NULL DEFAULT 1,
+    external_id TEXT,
+    metadata TEXT,
+    labels TEXT,
+    allowed_models TEXT
+);
+
+-- A user without a primary key gets a random key nobody holds
+INSERT INTO users_rebuild (id, api_key, name, created_at, updated_at, enabled, external_id, metadata, labels, allowed_models)
+    SELECT id, COALESCE((SELECT key FROM api_keys WHERE api_keys.user_id = users.id AND is_primary), lower(hex(randomblob(16)))),
+        name, created_at, updated_at, enabled, external_id, metadata, labels, allowed_models
+    FROM users;
+
+UPDATE sqlite_sequence SET seq = (SELECT seq FROM sqlite_sequence WHERE name = 'users')
+    WHERE name = 'users_rebuild' AND EXISTS (SELECT 1 FROM sqlite_sequence WHERE name = 'users');
+
+DROP TABLE users;
+
+ALTER TABLE users_rebuild RENAME TO users;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_name ON users(name) WHERE name IS NOT NULL AND name != '';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_external_id ON users(external_id) WHERE external_id IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_api_key_rotations_old_key ON api_key_rotations(old_key, grace_expires_at);
+
+UPDATE usage_logs SET api_key_id = 0 WHERE api_key_id IN (SELECT id FROM api_keys WHERE is_primary);
+UPDATE usage_rollups SET api_key_id = 0 WHERE api_key_id IN (SELECT id FROM api_keys WHERE is_primary);
+
+DELETE FROM api_keys WHERE is_primary;
+DROP INDEX IF EXISTS idx_api_keys_primary;
+ALTER TABLE api_keys DROP COLUMN is_primary;
@@ -0,0 +1,56 @@
+-- Migration: 041_primary_api_keys
+-- Created: 2026-10-16
+-- Description: Move each user's own API key into api_keys as its primary key
+
+ALTER TABLE api_keys ADD COLUMN is_primary BOOLEAN NOT NULL DEFAULT 0;
+
+-- The key is named primary, unless the user already has a key by that name
+INSERT INTO api_keys (user_id, name, key, enabled, is_primary, created_at)
+    SELECT id, CASE WHEN EXISTS (SELECT 1 FROM api_keys WHERE api_keys.user_id = users.id AND api_keys.name = 'primary') THEN 'primary-' || id ELSE 'primary' END, api_key, 1, 1, created_at
+    FROM users;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_api_keys_primary ON api_keys(user_id) WHERE is_primary;
+
+-- Rotated keys still in their grace period become keys expiring with it
+INSERT OR IGNORE INTO api_keys (user_id, name, key, enabled, expires_at)
+    SELECT user_id, 'rotated-' || id, old_key, 1, grace_expires_at FROM api_key_rotations
+    WHERE grace_expires_at > datetime('now');
+
+-- Replaced keys are no longer looked up in the rotation history
+DROP INDEX IF EXISTS idx_api_key_rotations_old_key;
+
+-- Usage made with a user's own key is attributed to its primary key
+UPDATE usage_logs SET api_key_id = COALESCE((SELECT id FROM api_keys WHERE api_keys.user_id = usage_logs.user_id AND is_primary), 0)
+    WHERE api_key_id = 0;
+UPDATE usage_rollups SET api_key_id = COALESCE((SELECT id FROM api_keys WHERE api_keys.user_id = usage_rollups.user_id AND is_primary), 0)
+    WHERE api_key_id = 0;
+
+-- SQLite cannot drop a unique column, so users are copied into a table
+-- without api_key. The ID sequence is carried over so deleted users' IDs
+-- are not reused.
+DROP TABLE IF EXISTS users_rebuild;
+
+CREATE TABLE users_rebuild (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT,
+    enabled BOOLEAN NOT NULL DEFAULT 1,
+    external_id TEXT,
+    metadata TEXT,
+    labels TEXT,
+    allowed_models TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO users_rebuild (id, name, enabled, external_id, metadata, labels, allowed_models, created_at, updated_at)
+    SELECT id, name, enabled, external_id, metadata, labels, allowed_models, created_at, updated_at FROM users;
+
+UPDATE sqlite_sequence SET seq = (SELECT seq FROM sqlite_sequence WHERE name = 'users')
+    WHERE name = 'users_rebuild' AND EXISTS (SELECT 1 FROM sqlite_sequence WHERE name = 'users');
+
+DROP TABLE users;
+
+ALTER TABLE users_rebuild RENAME TO users;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_name ON users(name) WHERE name IS NOT NULL AND name != '';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_external_id ON users(external_id) WHERE external_id IS NOT NULL;
@@ -8,19 +8,27 @@ import (
 
 // Model represents a logical model name that users can request
 type Model struct {
-	ID           int64     `json:"id"`
-	Name         string    `json:"name"`
-	ChannelsCount int64     `json:"channels_count"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID            int64  `json:"id"`
+	Name          string `json:"name"`
+	ChannelsCount int64  `json:"channels_count"`
+	ContextWindow int    `json:"context_window,omitempty"`
+	Truncate      bool   `json:"truncate,omitempty"`
+	// MaxStreamSeconds caps how long a streamed response may run; 0 means
+	// no cap
+	MaxStreamSeconds int       `json:"max_stream_seconds,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
 }
 
 // CreateModel creates a new model
 func (db *DB) CreateModel(model *Model) error {
 	result, err := db.Exec(
-		"INSERT INTO models (name) VALUES (?)",
-		model.Name,
+		"INSERT INTO models (name, context_window, truncate, max_stream_seconds) VALUES (?, ?, ?, ?)",
+		model.Name, model.ContextWindow, model.Truncate, model.MaxStreamSeconds,
 	)
+	if uniqueColumns(err) != nil {
+		return duplicateError(fmt.Sprintf("model name %q", model.Name))
+	}
 	if err != nil {
 		return fmt.Errorf("failed to create model: %w", err)
 	}
@@ -34,9 +42,9 @@ func (db *DB) GetModel(id int64) (*Model, error) {
 	var model Model
 
 	err := db.QueryRow(
-		"SELECT id, name, created_at, updated_at FROM models WHERE id = ?",
+		"SELECT id, name, context_window, truncate, max_stream_seconds, created_at, updated_at FROM models WHERE id = ?",
 		id,
-	).Scan(&model.ID, &model.Name, &model.CreatedAt, &model.UpdatedAt)
+	).Scan(&model.ID, &model.Name, &model.ContextWindow, &model.Truncate, &model.MaxStreamSeconds, &model.CreatedAt, &model.UpdatedAt)
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -53,9 +61,9 @@ func (db *DB) GetModelByName(name string) (*Model, error) {
 	var model Model
 
 	err := db.QueryRow(
-		"SELECT id, name, created_at, updated_at FROM models WHERE name = ?",
+		"SELECT id, name, context_window, truncate, max_stream_seconds, created_at, updated_at FROM models WHERE name = ?",
 		name,
-	).Scan(&model.ID, &model.Name, &model.CreatedAt, &model.UpdatedAt)
+	).Scan(&model.ID, &model.Name, &model.ContextWindow, &model.Truncate, &model.MaxStreamSeconds, &model.CreatedAt, &model.UpdatedAt)
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -70,7 +78,7 @@ func (db *DB) GetModelByName(name string) (*Model, error) {
 // ListModels retrieves all models
 func (db *DB) ListModels() ([]*Model, error) {
 	rows, err := db.Query(`
-		SELECT m.id, m.name, m.created_at, m.updated_at, COUNT(mc.id) as channels_count
+		SELECT m.id, m.name, m.context_window, m.truncate, m.max_stream_seconds, m.created_at, m.updated_at, COUNT(mc.id) as channels_count
 		FROM models m
 		LEFT JOIN model_channels mc ON m.id = mc.model_id
 		GROUP BY m.id
@@ -84,7 +92,7 @@ func (db *DB) ListModels() ([]*Model, error) {
 	var models []*Model
 	for rows.Next() {
 		var model Model
-		if err := rows.Scan(&model.ID, &model.Name, &model.CreatedAt, &model.UpdatedAt, &model.ChannelsCount); err != nil {
+		if err := rows.Scan(&model.ID, &model.Name, &model.ContextWindow, &model.Truncate, &model.MaxStreamSeconds, &model.CreatedAt, &model.UpdatedAt, &model.ChannelsCount); err != nil {
 			return nil, fmt.Errorf("failed to scan model: %w", err)
 		}
 		models = append(models, &model)
@@ -93,12 +101,15 @@ func (db *DB) ListModels() ([]*Model, error) {
 	return models, nil
 }
 
-// UpdateModel updates a model's name
+// UpdateModel updates a model's name, context settings and stream limit
 func (db *DB) UpdateModel(model *Model) error {
 	_, err := db.Exec(
-		"UPDATE models SET name = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
-		model.Name, model.ID,
+		"UPDATE models SET name = ?, context_window = ?, truncate = ?, max_stream_seconds = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		model.Name, model.ContextWindow, model.Truncate, model.MaxStreamSeconds, model.ID,
 	)
+	if uniqueColumns(err) != nil {
+		return duplicateError(fmt.Sprintf("model name %q", model.Name))
+	}
 	if err != nil {
 		return fmt.Errorf("failed to update model: %w", err)
 	}
@@ -1,18 +1,81 @@
 package database
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 )
 
+// Stream modes describe how a mapped backend handles streaming
+const (
+	// StreamModePassthrough forwards the client's stream flag unchanged
+	StreamModePassthrough = "passthrough"
+	// StreamModeNever marks backends without streaming support; streaming
+	// clients receive SSE synthesized from a non-streaming response
+	StreamModeNever = "never"
+	// StreamModeAlways marks backends that are only reliable when streaming;
+	// non-streaming clients receive a response aggregated from the stream
+	StreamModeAlways = "always"
+)
+
+// IsValidStreamMode reports whether mode is a known stream mode
+func IsValidStreamMode(mode string) bool {
+	switch mode {
+	case StreamModePassthrough, StreamModeNever, StreamModeAlways:
+		return true
+	}
+	return false
+}
+
 // ModelChannel represents a mapping between a model and a channel
 type ModelChannel struct {
-	ID               int64     `json:"id"`
-	ModelID          int64     `json:"model_id"`
-	ChannelID        int64     `json:"channel_id"`
-	BackendModelName string    `json:"backend_model_name"`
-	Weight           int       `json:"weight"`
-	CreatedAt        time.Time `json:"created_at"`
+	ID               int64  `json:"id"`
+	ModelID          int64  `json:"model_id"`
+	ChannelID        int64  `json:"channel_id"`
+	BackendModelName string `json:"backend_model_name"`
+	Weight           int    `json:"weight"`
+	StreamMode       string `json:"stream_mode"`
+	// Dimensions is the length of the embeddings the backend returns, or 0
+	// when not yet known. All mappings of a model must agree on it.
+	Dimensions int       `json:"dimensions,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// ErrDimensionMismatch is returned when a mapping's dimensions differ from
+// those of the model's other mappings
+var ErrDimensionMismatch = errors.New("dimension mismatch")
+
+// modelChannelColumns lists the columns selected for a ModelChannel, in scan order
+const modelChannelColumns = "id, model_id, channel_id, backend_model_name, weight, stream_mode, dimensions, created_at"
+
+// scanModelChannel scans a row selected with modelChannelColumns into a ModelChannel
+func scanModelChannel(row rowScanner) (*ModelChannel, error) {
+	var mc ModelChannel
+	if err := row.Scan(&mc.ID, &mc.ModelID, &mc.ChannelID, &mc.BackendModelName, &mc.Weight, &mc.StreamMode, &mc.Dimensions, &mc.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &mc, nil
+}
+
+// queryModelChannels runs a model_channels query and scans all rows
+func (db *DB) queryModelChannels(query string, args ...any) ([]*ModelChannel, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mappings []*ModelChannel
+	for rows.Next() {
+		mc, err := scanModelChannel(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan model channel: %w", err)
+		}
+		mappings = append(mappings, mc)
+	}
+
+	return mappings, nil
 }
 
 // AddModelChannel creates a new model-channel mapping
@@ -20,11 +83,20 @@ func (db *DB) AddModelChannel(mc *ModelChannel) error {
 	if mc.Weight <= 0 {
 		mc.Weight = 10
 	}
+	if mc.StreamMode == "" {
+		mc.StreamMode = StreamModePassthrough
+	}
+	if err := db.checkDimensions(mc); err != nil {
+		return err
+	}
 
 	result, err := db.Exec(
-		"INSERT INTO model_channels (model_id, channel_id, backend_model_name, weight) VALUES (?, ?, ?, ?)",
-		mc.ModelID, mc.ChannelID, mc.BackendModelName, mc.Weight,
+		"INSERT INTO model_channels (model_id, channel_id, backend_model_name, weight, stream_mode, dimensions) VALUES (?, ?, ?, ?, ?, ?)",
+		mc.ModelID, mc.ChannelID, mc.BackendModelName, mc.Weight, mc.StreamMode, mc.Dimensions,
 	)
+	if uniqueColumns(err) != nil {
+		return duplicateError(fmt.Sprintf("mapping of channel %d to model %d", mc.ChannelID, mc.ModelID))
+	}
 	if err != nil {
 		return fmt.Errorf("failed to add model channel: %w", err)
 	}
@@ -35,68 +107,87 @@ func (db *DB) AddModelChannel(mc *ModelChannel) error {
 
 // ListModelChannels retrieves all model-channel mappings
 func (db *DB) ListModelChannels() ([]*ModelChannel, error) {
-	rows, err := db.Query("SELECT id, model_id, channel_id, backend_model_name, weight, created_at FROM model_channels")
+	mappings, err := db.queryModelChannels("SELECT " + modelChannelColumns + " FROM model_channels")
 	if err != nil {
 		return nil, fmt.Errorf("failed to list model channels: %w", err)
 	}
-	defer rows.Close()
-
-	var mappings []*ModelChannel
-	for rows.Next() {
-		var mc ModelChannel
-		if err := rows.Scan(&mc.ID, &mc.ModelID, &mc.ChannelID, &mc.BackendModelName, &mc.Weight, &mc.CreatedAt); err != nil {
-			return nil, fmt.Errorf("failed to scan model channel: %w", err)
-		}
-		mappings = append(mappings, &mc)
-	}
-
 	return mappings, nil
 }
 
 // GetModelChannelsByModel retrieves all channel mappings for a specific model
 func (db *DB) GetModelChannelsByModel(modelID int64) ([]*ModelChannel, error) {
-	rows, err := db.Query(
-		"SELECT id, model_id, channel_id, backend_model_name, weight, created_at FROM model_channels WHERE model_id = ?",
-		modelID,
-	)
+	mappings, err := db.queryModelChannels("SELECT "+modelChannelColumns+" FROM model_channels WHERE model_id = ?", modelID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get model channels by model: %w", err)
 	}
-	defer rows.Close()
-
-	var mappings []*ModelChannel
-	for rows.Next() {
-		var mc ModelChannel
-		if err := rows.Scan(&mc.ID, &mc.ModelID, &mc.ChannelID, &mc.BackendModelName, &mc.Weight, &mc.CreatedAt); err != nil {
-			return nil, fmt.Errorf("failed to scan model channel: %w", err)
-		}
-		mappings = append(mappings, &mc)
-	}
-
 	return mappings, nil
 }
 
 // GetModelChannelsByChannel retrieves all model mappings for a specific channel
 func (db *DB) GetModelChannelsByChannel(channelID int64) ([]*ModelChannel, error) {
-	rows, err := db.Query(
-		"SELECT id, model_id, channel_id, backend_model_name, weight, created_at FROM model_channels WHERE channel_id = ?",
-		channelID,
-	)
+	mappings, err := db.queryModelChannels("SELECT "+modelChannelColumns+" FROM model_channels WHERE channel_id = ?", channelID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get model channels by channel: %w", err)
 	}
-	defer rows.Close()
+	return mappings, nil
+}
 
-	var mappings []*ModelChannel
-	for rows.Next() {
-		var mc ModelChannel
-		if err := rows.Scan(&mc.ID, &mc.ModelID, &mc.ChannelID, &mc.BackendModelName, &mc.Weight, &mc.CreatedAt); err != nil {
-			return nil, fmt.Errorf("failed to scan model channel: %w", err)
-		}
-		mappings = append(mappings, &mc)
+// UpdateModelChannel updates the backend name, weight, stream mode and
+// dimensions of a mapping
+func (db *DB) UpdateModelChannel(mc *ModelChannel) error {
+	if mc.StreamMode == "" {
+		mc.StreamMode = StreamModePassthrough
+	}
+	if err := db.checkDimensions(mc); err != nil {
+		return err
 	}
 
-	return mappings, nil
+	_, err := db.Exec(
+		"UPDATE model_channels SET backend_model_name = ?, weight = ?, stream_mode = ?, dimensions = ? WHERE model_id = ? AND channel_id = ?",
+		mc.BackendModelName, mc.Weight, mc.StreamMode, mc.Dimensions, mc.ModelID, mc.ChannelID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update model channel: %w", err)
+	}
+	return nil
+}
+
+// checkDimensions returns ErrDimensionMismatch if another mapping of the
+// model has known dimensions that differ from the mapping's
+func (db *DB) checkDimensions(mc *ModelChannel) error {
+	if mc.Dimensions == 0 {
+		return nil
+	}
+
+	var channelID int64
+	var dimensions int
+	err := db.QueryRow(
+		"SELECT channel_id, dimensions FROM model_channels WHERE model_id = ? AND channel_id != ? AND dimensions != 0 AND dimensions != ? LIMIT 1",
+		mc.ModelID, mc.ChannelID, mc.Dimensions,
+	).Scan(&channelID, &dimensions)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check model channel dimensions: %w", err)
+	}
+	return fmt.Errorf("%w: the model's mapping to channel %d has %d dimensions, not %d", ErrDimensionMismatch, channelID, dimensions, mc.Dimensions)
+}
+
+// RecordModelChannelDimensions stores the dimensions observed from a
+// mapping's backend if none are known yet and no other mapping of the model
+// has different ones. It reports whether they were stored.
+func (db *DB) RecordModelChannelDimensions(modelID, channelID int64, dimensions int) (bool, error) {
+	result, err := db.Exec(
+		`UPDATE model_channels SET dimensions = ? WHERE model_id = ? AND channel_id = ? AND dimensions = 0
+		AND NOT EXISTS (SELECT 1 FROM model_channels WHERE model_id = ? AND dimensions != 0 AND dimensions != ?)`,
+		dimensions, modelID, channelID, modelID, dimensions,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to record model channel dimensions: %w", err)
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
 }
 
 // RemoveModelChannel deletes a specific model-channel mapping
@@ -0,0 +1,53 @@
+package database
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestModelChannelDimensions(t *testing.T) {
+	dbPath := "/tmp/test_model_channel.db"
+	defer os.Remove(dbPath)
+
+	db, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	model := &Model{Name: "embed"}
+	db.CreateModel(model)
+	var channels [3]*Channel
+	for i, name := range []string{"a", "b", "c"} {
+		channels[i] = &Channel{Name: name, BaseURL: "https://" + name + ".example.com", APIKey: "sk-" + name, Weight: 10, Enabled: true}
+		db.CreateChannel(channels[i])
+	}
+
+	if err := db.AddModelChannel(&ModelChannel{ModelID: model.ID, ChannelID: channels[0].ID, BackendModelName: "small", Dimensions: 1536}); err != nil {
+		t.Fatal(err)
+	}
+	// Unknown dimensions are accepted, differing ones are not
+	if err := db.AddModelChannel(&ModelChannel{ModelID: model.ID, ChannelID: channels[1].ID, BackendModelName: "other"}); err != nil {
+		t.Fatal(err)
+	}
+	err = db.AddModelChannel(&ModelChannel{ModelID: model.ID, ChannelID: channels[2].ID, BackendModelName: "large", Dimensions: 3072})
+	if !errors.Is(err, ErrDimensionMismatch) {
+		t.Fatalf("Expected ErrDimensionMismatch, got %v", err)
+	}
+
+	// Observed dimensions are only recorded when they agree
+	if ok, err := db.RecordModelChannelDimensions(model.ID, channels[1].ID, 768); err != nil || ok {
+		t.Errorf("Expected differing dimensions not to be recorded, got %v, %v", ok, err)
+	}
+	if ok, err := db.RecordModelChannelDimensions(model.ID, channels[1].ID, 1536); err != nil || !ok {
+		t.Errorf("Expected matching dimensions to be recorded, got %v, %v", ok, err)
+	}
+
+	mappings, _ := db.GetModelChannelsByModel(model.ID)
+	for _, mc := range mappings {
+		if mc.Dimensions != 1536 {
+			t.Errorf("Expected 1536 dimensions for channel %d, got %d", mc.ChannelID, mc.Dimensions)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ModelPrice is the price of a backend model's tokens, in USD per 1K tokens
+type ModelPrice struct {
+	ID           int64     `json:"id"`
+	BackendModel string    `json:"backend_model"`
+	InputPrice   float64   `json:"input_price"`
+	OutputPrice  float64   `json:"output_price"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// Cost returns the price of a request's tokens
+func (p *ModelPrice) Cost(promptTokens, completionTokens int) float64 {
+	return (float64(promptTokens)*p.InputPrice + float64(completionTokens)*p.OutputPrice) / 1000
+}
+
+// modelPriceColumns lists the columns selected for a ModelPrice, in scan order
+const modelPriceColumns = "id, backend_model, input_price, output_price, created_at, updated_at"
+
+// scanModelPrice scans a row selected with modelPriceColumns into a ModelPrice
+func scanModelPrice(row rowScanner) (*ModelPrice, error) {
+	var p ModelPrice
+	if err := row.Scan(&p.ID, &p.BackendModel, &p.InputPrice, &p.OutputPrice, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// CreateModelPrice creates a new model price
+func (db *DB) CreateModelPrice(p *ModelPrice) error {
+	result, err := db.Exec(
+		"INSERT INTO model_prices (backend_model, input_price, output_price) VALUES (?, ?, ?)",
+		p.BackendModel, p.InputPrice, p.OutputPrice,
+	)
+	if uniqueColumns(err) != nil {
+		return duplicateError(fmt.Sprintf("price for backend model %q", p.BackendModel))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create model price: %w", err)
+	}
+
+	p.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// GetModelPrice retrieves a model price by ID
+func (db *DB) GetModelPrice(id int64) (*ModelPrice, error) {
+	p, err := scanModelPrice(db.QueryRow("SELECT "+modelPriceColumns+" FROM model_prices WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get model price: %w", err)
+	}
+	return p, nil
+}
+
+// GetModelPriceByBackendModel retrieves the price of a backend model
+func (db *DB) GetModelPriceByBackendModel(backendModel string) (*ModelPrice, error) {
+	p, err := scanModelPrice(db.QueryRow("SELECT "+modelPriceColumns+" FROM model_prices WHERE backend_model = ?", backendModel))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get model price: %w", err)
+	}
+	return p, nil
+}
+
+// ListModelPrices retrieves all model prices
+func (db *DB) ListModelPrices() ([]*ModelPrice, error) {
+	rows, err := db.Query("SELECT " + modelPriceColumns + " FROM model_prices ORDER BY backend_model")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list model prices: %w", err)
+	}
+	defer rows.Close()
+
+	var prices []*ModelPrice
+	for rows.Next() {
+		p, err := scanModelPrice(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan model price: %w", err)
+		}
+		prices = append(prices, p)
+	}
+
+	return prices, rows.Err()
+}
+
+// UpdateModelPrice updates a model price
+func (db *DB) UpdateModelPrice(p *ModelPrice) error {
+	_, err := db.Exec(
+		"UPDATE model_prices SET backend_model = ?, input_price = ?, output_price = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		p.BackendModel, p.InputPrice, p.OutputPrice, p.ID,
+	)
+	if uniqueColumns(err) != nil {
+		return duplicateError(fmt.Sprintf("price for backend model %q", p.BackendModel))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update model price: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteModelPrice deletes a model price by ID
+func (db *DB) DeleteModelPrice(id int64) error {
+	_, err := db.Exec("DELETE FROM model_prices WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete model price: %w", err)
+	}
+	return nil
+}
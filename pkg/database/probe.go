@@ -0,0 +1,183 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Probe is a synthetic request sent periodically to every channel serving a
+// model, asserting on the shape, content and latency of the response
+type Probe struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	// Model is the logical model whose channels are probed
+	Model  string `json:"model"`
+	Prompt string `json:"prompt"`
+	// Expect, when set, must appear in the response content (case-insensitive)
+	Expect string `json:"expect,omitempty"`
+	// MaxLatencyMs fails responses slower than this; 0 disables the check
+	MaxLatencyMs int `json:"max_latency_ms,omitempty"`
+	// IntervalSeconds is how often the probe runs
+	IntervalSeconds int       `json:"interval_seconds"`
+	Enabled         bool      `json:"enabled"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// ProbeResult is the outcome of one probe run against one channel
+type ProbeResult struct {
+	ID         int64     `json:"id"`
+	ProbeID    int64     `json:"probe_id"`
+	ChannelID  int64     `json:"channel_id"`
+	Success    bool      `json:"success"`
+	StatusCode int       `json:"status_code,omitempty"`
+	LatencyMs  int64     `json:"latency_ms"`
+	Error      string    `json:"error,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// probeColumns lists the columns selected for a Probe, in scan order
+const probeColumns = "id, name, model, prompt, expect, max_latency_ms, interval_seconds, enabled, created_at, updated_at"
+
+// scanProbe scans a row selected with probeColumns into a Probe
+func scanProbe(row rowScanner) (*Probe, error) {
+	var p Probe
+	if err := row.Scan(&p.ID, &p.Name, &p.Model, &p.Prompt, &p.Expect, &p.MaxLatencyMs, &p.IntervalSeconds, &p.Enabled, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// CreateProbe creates a new probe
+func (db *DB) CreateProbe(p *Probe) error {
+	result, err := db.Exec(
+		"INSERT INTO probes (name, model, prompt, expect, max_latency_ms, interval_seconds, enabled) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		p.Name, p.Model, p.Prompt, p.Expect, p.MaxLatencyMs, p.IntervalSeconds, p.Enabled,
+	)
+	if uniqueColumns(err) != nil {
+		return duplicateError(fmt.Sprintf("probe name %q", p.Name))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create probe: %w", err)
+	}
+
+	p.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// GetProbe retrieves a probe by ID
+func (db *DB) GetProbe(id int64) (*Probe, error) {
+	p, err := scanProbe(db.QueryRow("SELECT "+probeColumns+" FROM probes WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get probe: %w", err)
+	}
+	return p, nil
+}
+
+// ListProbes retrieves all probes
+func (db *DB) ListProbes() ([]*Probe, error) {
+	rows, err := db.Query("SELECT " + probeColumns + " FROM probes ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list probes: %w", err)
+	}
+	defer rows.Close()
+
+	var probes []*Probe
+	for rows.Next() {
+		p, err := scanProbe(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan probe: %w", err)
+		}
+		probes = append(probes, p)
+	}
+
+	return probes, rows.Err()
+}
+
+// UpdateProbe updates a probe
+func (db *DB) UpdateProbe(p *Probe) error {
+	_, err := db.Exec(
+		"UPDATE probes SET name = ?, model = ?, prompt = ?, expect = ?, max_latency_ms = ?, interval_seconds = ?, enabled = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		p.Name, p.Model, p.Prompt, p.Expect, p.MaxLatencyMs, p.IntervalSeconds, p.Enabled, p.ID,
+	)
+	if uniqueColumns(err) != nil {
+		return duplicateError(fmt.Sprintf("probe name %q", p.Name))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update probe: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteProbe deletes a probe and its results
+func (db *DB) DeleteProbe(id int64) error {
+	if _, err := db.Exec("DELETE FROM probe_results WHERE probe_id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete probe results: %w", err)
+	}
+	if _, err := db.Exec("DELETE FROM probes WHERE id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete probe: %w", err)
+	}
+	return nil
+}
+
+// CreateProbeResult records the outcome of a probe run
+func (db *DB) CreateProbeResult(r *ProbeResult) error {
+	if r.CreatedAt.IsZero() {
+		r.CreatedAt = time.Now().UTC()
+	}
+	result, err := db.Exec(
+		"INSERT INTO probe_results (probe_id, channel_id, success, status_code, latency_ms, error, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		r.ProbeID, r.ChannelID, r.Success, r.StatusCode, r.LatencyMs, r.Error, r.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create probe result: %w", err)
+	}
+
+	r.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// ListProbeResults retrieves the most recent results of a probe, newest
+// first. A zero channelID lists results for all channels.
+func (db *DB) ListProbeResults(probeID, channelID int64, limit int) ([]*ProbeResult, error) {
+	query := "SELECT id, probe_id, channel_id, success, status_code, latency_ms, error, created_at FROM probe_results WHERE probe_id = ?"
+	args := []any{probeID}
+	if channelID != 0 {
+		query += " AND channel_id = ?"
+		args = append(args, channelID)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list probe results: %w", err)
+	}
+	defer rows.Close()
+
+	var results []*ProbeResult
+	for rows.Next() {
+		var r ProbeResult
+		if err := rows.Scan(&r.ID, &r.ProbeID, &r.ChannelID, &r.Success, &r.StatusCode, &r.LatencyMs, &r.Error, &r.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan probe result: %w", err)
+		}
+		results = append(results, &r)
+	}
+
+	return results, rows.Err()
+}
+
+// DeleteProbeResultsBefore removes probe results recorded before a time and
+// returns how many were removed
+func (db *DB) DeleteProbeResultsBefore(before time.Time) (int64, error) {
+	result, err := db.Exec("DELETE FROM probe_results WHERE created_at < ?", before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete probe results: %w", err)
+	}
+	return result.RowsAffected()
+}
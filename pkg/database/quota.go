@@ -0,0 +1,79 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// UserQuota is a user's monthly budget. Zero limits are unlimited.
+type UserQuota struct {
+	UserID int64 `json:"user_id"`
+	// MonthlyTokens caps the total tokens used per calendar month (UTC)
+	MonthlyTokens int64 `json:"monthly_tokens"`
+	// MonthlyCost caps the cost in USD per calendar month (UTC)
+	MonthlyCost float64 `json:"monthly_cost"`
+	// ResetAt is when the quota was last reset; usage before it does not
+	// count against the current month
+	ResetAt   *time.Time `json:"reset_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// GetUserQuota retrieves a user's quota, or nil if the user has none
+func (db *DB) GetUserQuota(userID int64) (*UserQuota, error) {
+	var quota UserQuota
+	var resetAt sql.NullTime
+
+	err := db.QueryRow(
+		"SELECT user_id, monthly_tokens, monthly_cost, reset_at, created_at, updated_at FROM user_quotas WHERE user_id = ?",
+		userID,
+	).Scan(&quota.UserID, &quota.MonthlyTokens, &quota.MonthlyCost, &resetAt, &quota.CreatedAt, &quota.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user quota: %w", err)
+	}
+
+	if resetAt.Valid {
+		quota.ResetAt = &resetAt.Time
+	}
+	return &quota, nil
+}
+
+// SetUserQuota creates or replaces a user's limits, keeping its last reset
+func (db *DB) SetUserQuota(quota *UserQuota) error {
+	_, err := db.Exec(
+		`INSERT INTO user_quotas (user_id, monthly_tokens, monthly_cost) VALUES (?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET monthly_tokens = excluded.monthly_tokens, monthly_cost = excluded.monthly_cost, updated_at = CURRENT_TIMESTAMP`,
+		quota.UserID, quota.MonthlyTokens, quota.MonthlyCost,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set user quota: %w", err)
+	}
+	return nil
+}
+
+// ResetUserQuota restarts a user's monthly count at at, so earlier usage in
+// the month no longer counts. It reports whether the user has a quota.
+func (db *DB) ResetUserQuota(userID int64, at time.Time) (bool, error) {
+	result, err := db.Exec(
+		"UPDATE user_quotas SET reset_at = ?, updated_at = CURRENT_TIMESTAMP WHERE user_id = ?",
+		at.UTC(), userID,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to reset user quota: %w", err)
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// DeleteUserQuota removes a user's quota, making it unlimited
+func (db *DB) DeleteUserQuota(userID int64) error {
+	_, err := db.Exec("DELETE FROM user_quotas WHERE user_id = ?", userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete user quota: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// RoutingRule sends requests whose attributes match its conditions to a
+// specific channel, overriding the router's choice
+type RoutingRule struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	Priority int    `json:"priority"`
+	Enabled  bool   `json:"enabled"`
+	// Model limits the rule to one logical model; empty matches any model
+	Model      string         `json:"model,omitempty"`
+	Conditions RuleConditions `json:"conditions"`
+	ChannelID  int64          `json:"channel_id"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+}
+
+// RuleConditions are the request attributes a routing rule matches. Every
+// set condition must hold; a rule without conditions matches all requests.
+type RuleConditions struct {
+	// UserLabels must all be carried by the requesting user
+	UserLabels map[string]string `json:"user_labels,omitempty"`
+	// MinPromptTokens and MaxPromptTokens bound the estimated prompt size
+	MinPromptTokens int   `json:"min_prompt_tokens,omitempty"`
+	MaxPromptTokens int   `json:"max_prompt_tokens,omitempty"`
+	HasTools        *bool `json:"has_tools,omitempty"`
+	HasImages       *bool `json:"has_images,omitempty"`
+}
+
+// routingRuleColumns lists the columns selected for a RoutingRule, in scan order
+const routingRuleColumns = "id, name, priority, enabled, model, conditions, channel_id, created_at, updated_at"
+
+// scanRoutingRule scans a row selected with routingRuleColumns into a RoutingRule
+func scanRoutingRule(row rowScanner) (*RoutingRule, error) {
+	var rule RoutingRule
+	var conditions sql.NullString
+
+	if err := row.Scan(&rule.ID, &rule.Name, &rule.Priority, &rule.Enabled, &rule.Model, &conditions, &rule.ChannelID, &rule.CreatedAt, &rule.UpdatedAt); err != nil {
+		return nil, err
+	}
+
+	if conditions.Valid && conditions.String != "" {
+		if err := json.Unmarshal([]byte(conditions.String), &rule.Conditions); err != nil {
+			return nil, fmt.Errorf("invalid conditions for routing rule %d: %w", rule.ID, err)
+		}
+	}
+
+	return &rule, nil
+}
+
+// encodeRuleConditions serializes rule conditions for storage
+func encodeRuleConditions(conditions RuleConditions) (string, error) {
+	data, err := json.Marshal(conditions)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode rule conditions: %w", err)
+	}
+	return string(data), nil
+}
+
+// CreateRoutingRule creates a new routing rule
+func (db *DB) CreateRoutingRule(rule *RoutingRule) error {
+	conditions, err := encodeRuleConditions(rule.Conditions)
+	if err != nil {
+		return err
+	}
+
+	result, err := db.Exec(
+		"INSERT INTO routing_rules (name, priority, enabled, model, conditions, channel_id) VALUES (?, ?, ?, ?, ?, ?)",
+		rule.Name, rule.Priority, rule.Enabled, rule.Model, conditions, rule.ChannelID,
+	)
+	if uniqueColumns(err) != nil {
+		return duplicateError(fmt.Sprintf("routing rule name %q", rule.Name))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create routing rule: %w", err)
+	}
+
+	rule.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// GetRoutingRule retrieves a routing rule by ID
+func (db *DB) GetRoutingRule(id int64) (*RoutingRule, error) {
+	rule, err := scanRoutingRule(db.QueryRow("SELECT "+routingRuleColumns+" FROM routing_rules WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get routing rule: %w", err)
+	}
+	return rule, nil
+}
+
+// ListRoutingRules retrieves all routing rules in evaluation order: highest
+// priority first, then oldest first
+func (db *DB) ListRoutingRules() ([]*RoutingRule, error) {
+	rows, err := db.Query("SELECT " + routingRuleColumns + " FROM routing_rules ORDER BY priority DESC, id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list routing rules: %w", err)
+	}
+	defer rows.Close()
+
+	var rules []*RoutingRule
+	for rows.Next() {
+		rule, err := scanRoutingRule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan routing rule: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, rows.Err()
+}
+
+// UpdateRoutingRule updates a routing rule
+func (db *DB) UpdateRoutingRule(rule *RoutingRule) error {
+	conditions, err := encodeRuleConditions(rule.Conditions)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(
+		"UPDATE routing_rules SET name = ?, priority = ?, enabled = ?, model = ?, conditions = ?, channel_id = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		rule.Name, rule.Priority, rule.Enabled, rule.Model, conditions, rule.ChannelID, rule.ID,
+	)
+	if uniqueColumns(err) != nil {
+		return duplicateError(fmt.Sprintf("routing rule name %q", rule.Name))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update routing rule: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteRoutingRule deletes a routing rule by ID
+func (db *DB) DeleteRoutingRule(id int64) error {
+	_, err := db.Exec("DELETE FROM routing_rules WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete routing rule: %w", err)
+	}
+	return nil
+}
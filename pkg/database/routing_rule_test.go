@@ -0,0 +1,62 @@
+package database
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestRoutingRuleCRUD(t *testing.T) {
+	dbPath := "/tmp/test_routing_rule.db"
+	defer os.Remove(dbPath)
+
+	db, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	channel := &Channel{Name: "long-context", BaseURL: "https://api.openai.com", APIKey: "sk-test"}
+	db.CreateChannel(channel)
+
+	hasTools := true
+	low := &RoutingRule{Name: "tools", Priority: 1, Enabled: true, ChannelID: channel.ID, Conditions: RuleConditions{HasTools: &hasTools}}
+	high := &RoutingRule{Name: "long", Priority: 10, Enabled: true, Model: "gpt-4", ChannelID: channel.ID, Conditions: RuleConditions{MinPromptTokens: 8000}}
+	for _, rule := range []*RoutingRule{low, high} {
+		if err := db.CreateRoutingRule(rule); err != nil {
+			t.Fatalf("Failed to create routing rule: %v", err)
+		}
+	}
+
+	if err := db.CreateRoutingRule(&RoutingRule{Name: "tools", ChannelID: channel.ID}); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("Expected ErrDuplicate, got %v", err)
+	}
+
+	rules, err := db.ListRoutingRules()
+	if err != nil {
+		t.Fatalf("Failed to list routing rules: %v", err)
+	}
+	if len(rules) != 2 || rules[0].Name != "long" || rules[1].Name != "tools" {
+		t.Fatalf("Expected rules in priority order, got %+v", rules)
+	}
+	if rules[1].Conditions.HasTools == nil || !*rules[1].Conditions.HasTools {
+		t.Errorf("Expected has_tools to round-trip, got %+v", rules[1].Conditions)
+	}
+
+	high.Conditions.UserLabels = map[string]string{"tier": "gold"}
+	high.Enabled = false
+	if err := db.UpdateRoutingRule(high); err != nil {
+		t.Fatalf("Failed to update routing rule: %v", err)
+	}
+	retrieved, _ := db.GetRoutingRule(high.ID)
+	if retrieved.Enabled || retrieved.Conditions.UserLabels["tier"] != "gold" || retrieved.Conditions.MinPromptTokens != 8000 {
+		t.Errorf("Expected update to round-trip, got %+v", retrieved)
+	}
+
+	if err := db.DeleteRoutingRule(low.ID); err != nil {
+		t.Fatalf("Failed to delete routing rule: %v", err)
+	}
+	if retrieved, _ := db.GetRoutingRule(low.ID); retrieved != nil {
+		t.Error("Routing rule should be deleted")
+	}
+}
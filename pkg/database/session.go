@@ -8,8 +8,11 @@ import (
 
 // Session represents a user-channel mapping for sticky routing
 type Session struct {
-	ID         int64     `json:"id"`
-	UserID     int64     `json:"user_id"`
+	ID     int64 `json:"id"`
+	UserID int64 `json:"user_id"`
+	// SessionKey identifies an end user behind the API key; sessions of the
+	// key itself have none
+	SessionKey string    `json:"session_key,omitempty"`
 	ChannelID  int64     `json:"channel_id"`
 	LastUsedAt time.Time `json:"last_used_at"`
 	CreatedAt  time.Time `json:"created_at"`
@@ -18,8 +21,8 @@ type Session struct {
 // CreateSession creates a new session
 func (db *DB) CreateSession(session *Session) error {
 	result, err := db.Exec(
-		"INSERT INTO sessions (user_id, channel_id) VALUES (?, ?)",
-		session.UserID, session.ChannelID,
+		"INSERT INTO sessions (user_id, session_key, channel_id) VALUES (?, ?, ?)",
+		session.UserID, session.SessionKey, session.ChannelID,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create session: %w", err)
@@ -34,9 +37,9 @@ func (db *DB) GetSession(id int64) (*Session, error) {
 	var session Session
 
 	err := db.QueryRow(
-		"SELECT id, user_id, channel_id, last_used_at, created_at FROM sessions WHERE id = ?",
+		"SELECT id, user_id, session_key, channel_id, last_used_at, created_at FROM sessions WHERE id = ?",
 		id,
-	).Scan(&session.ID, &session.UserID, &session.ChannelID, &session.LastUsedAt, &session.CreatedAt)
+	).Scan(&session.ID, &session.UserID, &session.SessionKey, &session.ChannelID, &session.LastUsedAt, &session.CreatedAt)
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -53,9 +56,9 @@ func (db *DB) GetSessionByUserAndChannel(userID, channelID int64) (*Session, err
 	var session Session
 
 	err := db.QueryRow(
-		"SELECT id, user_id, channel_id, last_used_at, created_at FROM sessions WHERE user_id = ? AND channel_id = ?",
+		"SELECT id, user_id, session_key, channel_id, last_used_at, created_at FROM sessions WHERE user_id = ? AND channel_id = ?",
 		userID, channelID,
-	).Scan(&session.ID, &session.UserID, &session.ChannelID, &session.LastUsedAt, &session.CreatedAt)
+	).Scan(&session.ID, &session.UserID, &session.SessionKey, &session.ChannelID, &session.LastUsedAt, &session.CreatedAt)
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -72,9 +75,9 @@ func (db *DB) GetSessionByUser(userID int64) (*Session, error) {
 	var session Session
 
 	err := db.QueryRow(
-		"SELECT id, user_id, channel_id, last_used_at, created_at FROM sessions WHERE user_id = ? ORDER BY last_used_at DESC LIMIT 1",
+		"SELECT id, user_id, session_key, channel_id, last_used_at, created_at FROM sessions WHERE user_id = ? ORDER BY last_used_at DESC LIMIT 1",
 		userID,
-	).Scan(&session.ID, &session.UserID, &session.ChannelID, &session.LastUsedAt, &session.CreatedAt)
+	).Scan(&session.ID, &session.UserID, &session.SessionKey, &session.ChannelID, &session.LastUsedAt, &session.CreatedAt)
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -86,9 +89,29 @@ func (db *DB) GetSessionByUser(userID int64) (*Session, error) {
 	return &session, nil
 }
 
+// GetSessionByKey retrieves the most recent session for a session key of a
+// user. An empty key selects the sessions of the user's API key itself.
+func (db *DB) GetSessionByKey(userID int64, sessionKey string) (*Session, error) {
+	var session Session
+
+	err := db.QueryRow(
+		"SELECT id, user_id, session_key, channel_id, last_used_at, created_at FROM sessions WHERE user_id = ? AND session_key = ? ORDER BY last_used_at DESC LIMIT 1",
+		userID, sessionKey,
+	).Scan(&session.ID, &session.UserID, &session.SessionKey, &session.ChannelID, &session.LastUsedAt, &session.CreatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session by key: %w", err)
+	}
+
+	return &session, nil
+}
+
 // ListSessions retrieves all sessions
 func (db *DB) ListSessions() ([]*Session, error) {
-	rows, err := db.Query("SELECT id, user_id, channel_id, last_used_at, created_at FROM sessions")
+	rows, err := db.Query("SELECT id, user_id, session_key, channel_id, last_used_at, created_at FROM sessions")
 	if err != nil {
 		return nil, fmt.Errorf("failed to list sessions: %w", err)
 	}
@@ -98,7 +121,7 @@ func (db *DB) ListSessions() ([]*Session, error) {
 	for rows.Next() {
 		var session Session
 
-		if err := rows.Scan(&session.ID, &session.UserID, &session.ChannelID, &session.LastUsedAt, &session.CreatedAt); err != nil {
+		if err := rows.Scan(&session.ID, &session.UserID, &session.SessionKey, &session.ChannelID, &session.LastUsedAt, &session.CreatedAt); err != nil {
 			return nil, fmt.Errorf("failed to scan session: %w", err)
 		}
 
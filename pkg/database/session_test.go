@@ -48,3 +48,41 @@ func TestSessionCRUD(t *testing.T) {
 		t.Errorf("Expected channel ID %d, got %d", channel.ID, retrieved.ChannelID)
 	}
 }
+
+func TestSessionKeysSurviveMigrations(t *testing.T) {
+	dbPath := "/tmp/test_session_keys.db"
+	defer os.Remove(dbPath)
+
+	db, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+
+	user := &User{APIKey: "test-key", Name: "Test"}
+	db.CreateUser(user)
+	channel := &Channel{Name: "test-chan", BaseURL: "https://api.openai.com", APIKey: "sk-test"}
+	db.CreateChannel(channel)
+
+	for _, key := range []string{"", "end-user-1", "end-user-2"} {
+		if err := db.CreateSession(&Session{UserID: user.ID, SessionKey: key, ChannelID: channel.ID}); err != nil {
+			t.Fatalf("Failed to create session for %q: %v", key, err)
+		}
+	}
+	db.Close()
+
+	// Migrations run again on every start
+	db, err = New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	defer db.Close()
+
+	sessions, err := db.ListSessions()
+	if err != nil || len(sessions) != 3 {
+		t.Fatalf("Expected 3 sessions after reopening, got %d, %v", len(sessions), err)
+	}
+	session, err := db.GetSessionByKey(user.ID, "end-user-2")
+	if err != nil || session == nil || session.SessionKey != "end-user-2" {
+		t.Errorf("Expected the end-user-2 session, got %+v, %v", session, err)
+	}
+}
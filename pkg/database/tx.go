@@ -0,0 +1,66 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// errNestedTransaction is returned when Begin is called inside Transaction
+var errNestedTransaction = errors.New("cannot begin a transaction inside another")
+
+// Transaction runs fn with a DB whose queries all run in one transaction,
+// committed when fn returns nil and rolled back otherwise. Inside another
+// Transaction, fn joins the enclosing transaction. fn must not call methods
+// that Begin their own transaction.
+func (db *DB) Transaction(fn func(tx *DB) error) error {
+	if db.tx != nil {
+		return fn(db)
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(&DB{DB: db.DB, tx: tx}); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// Begin starts a transaction, unless the DB already runs in one
+func (db *DB) Begin() (*sql.Tx, error) {
+	if db.tx != nil {
+		return nil, errNestedTransaction
+	}
+	return db.DB.Begin()
+}
+
+// Exec executes a query in the DB's transaction, if any
+func (db *DB) Exec(query string, args ...any) (sql.Result, error) {
+	if db.tx != nil {
+		return db.tx.Exec(query, args...)
+	}
+	return db.DB.Exec(query, args...)
+}
+
+// Query runs a query in the DB's transaction, if any
+func (db *DB) Query(query string, args ...any) (*sql.Rows, error) {
+	if db.tx != nil {
+		return db.tx.Query(query, args...)
+	}
+	return db.DB.Query(query, args...)
+}
+
+// QueryRow runs a query returning one row in the DB's transaction, if any
+func (db *DB) QueryRow(query string, args ...any) *sql.Row {
+	if db.tx != nil {
+		return db.tx.QueryRow(query, args...)
+	}
+	return db.DB.QueryRow(query, args...)
+}
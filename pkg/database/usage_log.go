@@ -0,0 +1,216 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// UsageLog records the tokens used by one request
+type UsageLog struct {
+	ID           int64  `json:"id"`
+	UserID       int64  `json:"user_id"`
+	Model        string `json:"model"`
+	ChannelID    int64  `json:"channel_id"`
+	BackendModel string `json:"backend_model"`
+	// APIKeyID is the user's API key the request was made with, or 0 for
+	// usage without one
+	APIKeyID int64 `json:"api_key_id,omitempty"`
+	// EndUser is the request's OpenAI "user" field, if any
+	EndUser string `json:"end_user,omitempty"`
+	// Tags are the request's attribution tags as sorted, comma-separated
+	// key=value pairs, if any
+	Tags             string `json:"tags,omitempty"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+	TotalTokens      int    `json:"total_tokens"`
+	// Cost is the price of the tokens in USD when the log was recorded, or 0
+	// if the backend model had no price
+	Cost      float64   `json:"cost"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UsageQuery filters usage logs. Zero fields do not filter.
+type UsageQuery struct {
+	UserID   int64
+	APIKeyID int64
+	Model    string
+	// GroupID limits the query to the current members of a group
+	GroupID int64
+	// Tags limits the query to requests carrying every given tag, each a
+	// key=value pair or a key matching any value
+	Tags []string
+	// From and To bound the range; From is inclusive and To exclusive
+	From time.Time
+	To   time.Time
+}
+
+// Usage summary groupings
+const (
+	UsageByUser    = "user_id"
+	UsageByAPIKey  = "api_key_id"
+	UsageByModel   = "model"
+	UsageByChannel = "channel_id"
+)
+
+// UsageSummary is the total usage of a group of usage logs. Only the fields
+// the logs were grouped by are set.
+type UsageSummary struct {
+	UserID           int64   `json:"user_id,omitempty"`
+	APIKeyID         int64   `json:"api_key_id,omitempty"`
+	Model            string  `json:"model,omitempty"`
+	ChannelID        int64   `json:"channel_id,omitempty"`
+	Requests         int64   `json:"requests"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	TotalTokens      int64   `json:"total_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+// CreateUsageLog records a request's token usage, pricing it with the
+// backend model's current price
+func (db *DB) CreateUsageLog(entry *UsageLog) error {
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	entry.CreatedAt = entry.CreatedAt.UTC()
+
+	price, err := db.GetModelPriceByBackendModel(entry.BackendModel)
+	if err != nil {
+		return err
+	}
+	if price != nil {
+		entry.Cost = price.Cost(entry.PromptTokens, entry.CompletionTokens)
+	}
+
+	result, err := db.Exec(
+		"INSERT INTO usage_logs (user_id, api_key_id, model, channel_id, backend_model, end_user, tags, prompt_tokens, completion_tokens, total_tokens, cost, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		entry.UserID, entry.APIKeyID, entry.Model, entry.ChannelID, entry.BackendModel, entry.EndUser, entry.Tags, entry.PromptTokens, entry.CompletionTokens, entry.TotalTokens, entry.Cost, entry.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create usage log: %w", err)
+	}
+
+	entry.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// usageWhere builds the WHERE clause of a usage query on a table whose time
+// is in timeColumn
+func usageWhere(q UsageQuery, timeColumn string) (string, []any) {
+	where := []string{"1 = 1"}
+	var args []any
+	if q.UserID != 0 {
+		where = append(where, "user_id = ?")
+		args = append(args, q.UserID)
+	}
+	if q.APIKeyID != 0 {
+		where = append(where, "api_key_id = ?")
+		args = append(args, q.APIKeyID)
+	}
+	if q.Model != "" {
+		where = append(where, "model = ?")
+		args = append(args, q.Model)
+	}
+	if q.GroupID != 0 {
+		where = append(where, "user_id IN (SELECT user_id FROM user_group_members WHERE group_id = ?)")
+		args = append(args, q.GroupID)
+	}
+	for _, tag := range q.Tags {
+		// Pairs are comma-separated and values cannot hold commas, so a
+		// pair, or a key with its equals sign, is matched between commas
+		if strings.Contains(tag, "=") {
+			where = append(where, "instr(',' || tags || ',', ?) > 0")
+			args = append(args, ","+tag+",")
+		} else {
+			where = append(where, "instr(',' || tags, ?) > 0")
+			args = append(args, ","+tag+"=")
+		}
+	}
+	if !q.From.IsZero() {
+		where = append(where, timeColumn+" >= ?")
+		args = append(args, q.From.UTC())
+	}
+	if !q.To.IsZero() {
+		where = append(where, timeColumn+" < ?")
+		args = append(args, q.To.UTC())
+	}
+	return strings.Join(where, " AND "), args
+}
+
+// ListUsageLogs retrieves the most recent usage logs matching a query,
+// newest first. Logs already rolled up are not listed.
+func (db *DB) ListUsageLogs(q UsageQuery, limit int) ([]*UsageLog, error) {
+	where, args := usageWhere(q, "created_at")
+	rows, err := db.Query(
+		"SELECT id, user_id, api_key_id, model, channel_id, backend_model, end_user, tags, prompt_tokens, completion_tokens, total_tokens, cost, created_at FROM usage_logs WHERE "+where+" ORDER BY id DESC LIMIT ?",
+		append(args, limit)...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list usage logs: %w", err)
+	}
+	defer rows.Close()
+
+	var logs []*UsageLog
+	for rows.Next() {
+		var entry UsageLog
+		if err := rows.Scan(&entry.ID, &entry.UserID, &entry.APIKeyID, &entry.Model, &entry.ChannelID, &entry.BackendModel, &entry.EndUser, &entry.Tags, &entry.PromptTokens, &entry.CompletionTokens, &entry.TotalTokens, &entry.Cost, &entry.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan usage log: %w", err)
+		}
+		logs = append(logs, &entry)
+	}
+
+	return logs, rows.Err()
+}
+
+// SummarizeUsage totals the usage logs matching a query, grouped by the
+// given UsageBy* columns. Without groups a single total is returned. Rolled
+// up usage counts at the start of its hour or day.
+func (db *DB) SummarizeUsage(q UsageQuery, groups ...string) ([]*UsageSummary, error) {
+	for _, g := range groups {
+		if g != UsageByUser && g != UsageByAPIKey && g != UsageByModel && g != UsageByChannel {
+			return nil, fmt.Errorf("invalid usage grouping: %s", g)
+		}
+	}
+
+	logsWhere, args := usageWhere(q, "created_at")
+	rollupsWhere, rollupArgs := usageWhere(q, "bucket")
+	query := "SELECT user_id, api_key_id, model, channel_id, COALESCE(SUM(requests), 0), COALESCE(SUM(prompt_tokens), 0), COALESCE(SUM(completion_tokens), 0), COALESCE(SUM(total_tokens), 0), COALESCE(SUM(cost), 0) FROM (" +
+		"SELECT user_id, api_key_id, model, channel_id, 1 AS requests, prompt_tokens, completion_tokens, total_tokens, cost FROM usage_logs WHERE " + logsWhere +
+		" UNION ALL SELECT user_id, api_key_id, model, channel_id, requests, prompt_tokens, completion_tokens, total_tokens, cost FROM usage_rollups WHERE " + rollupsWhere + ")"
+	args = append(args, rollupArgs...)
+	if len(groups) > 0 {
+		query += " GROUP BY " + strings.Join(groups, ", ") + " ORDER BY " + strings.Join(groups, ", ")
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize usage: %w", err)
+	}
+	defer rows.Close()
+
+	var summaries []*UsageSummary
+	for rows.Next() {
+		var s UsageSummary
+		var userID, apiKeyID, channelID sql.NullInt64
+		var model sql.NullString
+		if err := rows.Scan(&userID, &apiKeyID, &model, &channelID, &s.Requests, &s.PromptTokens, &s.CompletionTokens, &s.TotalTokens, &s.Cost); err != nil {
+			return nil, fmt.Errorf("failed to scan usage summary: %w", err)
+		}
+		for _, g := range groups {
+			switch g {
+			case UsageByUser:
+				s.UserID = userID.Int64
+			case UsageByAPIKey:
+				s.APIKeyID = apiKeyID.Int64
+			case UsageByModel:
+				s.Model = model.String
+			case UsageByChannel:
+				s.ChannelID = channelID.Int64
+			}
+		}
+		summaries = append(summaries, &s)
+	}
+
+	return summaries, rows.Err()
+}
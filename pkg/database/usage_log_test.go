@@ -0,0 +1,73 @@
+package database
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestUsageLogs(t *testing.T) {
+	dbPath := "/tmp/test_usage_logs.db"
+	defer os.Remove(dbPath)
+
+	db, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.CreateModelPrice(&ModelPrice{BackendModel: "gpt-4-0613", InputPrice: 0.03, OutputPrice: 0.06}); err != nil {
+		t.Fatalf("Failed to create model price: %v", err)
+	}
+
+	day := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	entries := []*UsageLog{
+		{UserID: 1, Model: "gpt-4", ChannelID: 1, BackendModel: "gpt-4-0613", PromptTokens: 100, CompletionTokens: 10, TotalTokens: 110, CreatedAt: day.Add(time.Hour)},
+		{UserID: 1, Model: "gpt-4", ChannelID: 2, BackendModel: "gpt-4-0613", PromptTokens: 50, CompletionTokens: 5, TotalTokens: 55, CreatedAt: day.Add(2 * time.Hour)},
+		{UserID: 1, Model: "gpt-3.5", ChannelID: 1, PromptTokens: 20, CompletionTokens: 2, TotalTokens: 22, CreatedAt: day.Add(3 * time.Hour)},
+		{UserID: 2, Model: "gpt-4", ChannelID: 1, PromptTokens: 7, CompletionTokens: 3, TotalTokens: 10, CreatedAt: day.Add(25 * time.Hour)},
+	}
+	for _, e := range entries {
+		if err := db.CreateUsageLog(e); err != nil {
+			t.Fatalf("Failed to create usage log: %v", err)
+		}
+	}
+
+	// Only priced backend models have a cost
+	if entries[0].Cost != 0.0036 || entries[2].Cost != 0 {
+		t.Errorf("Unexpected costs %v and %v", entries[0].Cost, entries[2].Cost)
+	}
+
+	summaries, err := db.SummarizeUsage(UsageQuery{From: day, To: day.Add(24 * time.Hour)}, UsageByUser, UsageByModel)
+	if err != nil {
+		t.Fatalf("Failed to summarize usage: %v", err)
+	}
+	if len(summaries) != 2 {
+		t.Fatalf("Expected totals for two models on the first day, got %+v", summaries)
+	}
+	if s := summaries[1]; s.Model != "gpt-4" || s.UserID != 1 || s.Requests != 2 || s.PromptTokens != 150 || s.TotalTokens != 165 {
+		t.Errorf("Unexpected gpt-4 totals %+v", s)
+	}
+
+	logs, err := db.ListUsageLogs(UsageQuery{Model: "gpt-4"}, 2)
+	if err != nil {
+		t.Fatalf("Failed to list usage logs: %v", err)
+	}
+	if len(logs) != 2 || logs[0].UserID != 2 || !logs[0].CreatedAt.Equal(day.Add(25*time.Hour)) {
+		t.Errorf("Expected the newest gpt-4 logs first, got %+v", logs)
+	}
+
+	summaries, _ = db.SummarizeUsage(UsageQuery{UserID: 2})
+	if len(summaries) != 1 || summaries[0].TotalTokens != 10 || summaries[0].UserID != 0 {
+		t.Errorf("Expected an ungrouped total of user 2's usage, got %+v", summaries)
+	}
+
+	summaries, _ = db.SummarizeUsage(UsageQuery{}, UsageByChannel)
+	if len(summaries) != 2 || summaries[1].ChannelID != 2 || summaries[1].Cost != 0.0018 {
+		t.Errorf("Expected per-channel costs, got %+v", summaries)
+	}
+
+	if _, err := db.SummarizeUsage(UsageQuery{}, "end_user; DROP TABLE usage_logs"); err == nil {
+		t.Error("Expected an unknown grouping to be rejected")
+	}
+}
@@ -0,0 +1,119 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// Usage rollup periods
+const (
+	RollupHour = "hour"
+	RollupDay  = "day"
+)
+
+// rollupBucketLayout is the layout of the bucket strftime computes
+const rollupBucketLayout = "2006-01-02 15:04:05"
+
+// usageRollup is one aggregate row read for a rollup
+type usageRollup struct {
+	bucket       string
+	userID       int64
+	apiKeyID     int64
+	model        string
+	channelID    int64
+	backendModel string
+	endUser      string
+	tags         string
+	requests     int64
+	prompt       int64
+	completion   int64
+	total        int64
+	cost         float64
+}
+
+// RollupUsageLogs replaces the usage logs created before before with hourly
+// aggregates, keeping their totals while shrinking the table. It returns
+// the number of logs rolled up.
+func (db *DB) RollupUsageLogs(before time.Time) (int64, error) {
+	return db.rollupUsage(
+		`SELECT strftime('%Y-%m-%d %H:00:00', created_at), user_id, api_key_id, model, channel_id, backend_model, end_user, tags,
+			COUNT(*), SUM(prompt_tokens), SUM(completion_tokens), SUM(total_tokens), SUM(cost)
+		FROM usage_logs WHERE created_at < ? GROUP BY 1, 2, 3, 4, 5, 6, 7, 8`,
+		"DELETE FROM usage_logs WHERE created_at < ?",
+		RollupHour, before,
+	)
+}
+
+// RollupHourlyUsage merges the hourly aggregates starting before before into
+// daily ones. It returns the number of hourly aggregates merged.
+func (db *DB) RollupHourlyUsage(before time.Time) (int64, error) {
+	return db.rollupUsage(
+		`SELECT strftime('%Y-%m-%d 00:00:00', bucket), user_id, api_key_id, model, channel_id, backend_model, end_user, tags,
+			SUM(requests), SUM(prompt_tokens), SUM(completion_tokens), SUM(total_tokens), SUM(cost)
+		FROM usage_rollups WHERE period = 'hour' AND bucket < ? GROUP BY 1, 2, 3, 4, 5, 6, 7, 8`,
+		"DELETE FROM usage_rollups WHERE period = 'hour' AND bucket < ?",
+		RollupDay, before,
+	)
+}
+
+// rollupUsage adds the aggregates selected by query to period rollups and
+// deletes their source rows with del, in one transaction. Aggregates are
+// added to existing rollups of the same bucket, so a bucket can be rolled up
+// over several runs.
+func (db *DB) rollupUsage(query, del, period string, before time.Time) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin usage rollup: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(query, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to aggregate usage: %w", err)
+	}
+	var rollups []usageRollup
+	for rows.Next() {
+		var r usageRollup
+		if err := rows.Scan(&r.bucket, &r.userID, &r.apiKeyID, &r.model, &r.channelID, &r.backendModel, &r.endUser, &r.tags, &r.requests, &r.prompt, &r.completion, &r.total, &r.cost); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan usage aggregate: %w", err)
+		}
+		rollups = append(rollups, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to aggregate usage: %w", err)
+	}
+
+	for _, r := range rollups {
+		bucket, err := time.ParseInLocation(rollupBucketLayout, r.bucket, time.UTC)
+		if err != nil {
+			return 0, fmt.Errorf("invalid usage bucket %q: %w", r.bucket, err)
+		}
+		_, err = tx.Exec(
+			`INSERT INTO usage_rollups (period, bucket, user_id, api_key_id, model, channel_id, backend_model, end_user, tags, requests, prompt_tokens, completion_tokens, total_tokens, cost)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(period, bucket, user_id, api_key_id, model, channel_id, backend_model, end_user, tags) DO UPDATE SET
+				requests = requests + excluded.requests,
+				prompt_tokens = prompt_tokens + excluded.prompt_tokens,
+				completion_tokens = completion_tokens + excluded.completion_tokens,
+				total_tokens = total_tokens + excluded.total_tokens,
+				cost = cost + excluded.cost`,
+			period, bucket, r.userID, r.apiKeyID, r.model, r.channelID, r.backendModel, r.endUser, r.tags, r.requests, r.prompt, r.completion, r.total, r.cost,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("failed to store usage rollup: %w", err)
+		}
+	}
+
+	result, err := tx.Exec(del, before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete rolled up usage: %w", err)
+	}
+	n, _ := result.RowsAffected()
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit usage rollup: %w", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,107 @@
+package database
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRollupUsage(t *testing.T) {
+	dbPath := "/tmp/test_usage_rollup.db"
+	defer os.Remove(dbPath)
+
+	db, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	day := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	entries := []*UsageLog{
+		{UserID: 1, Model: "gpt-4", ChannelID: 1, PromptTokens: 100, CompletionTokens: 10, TotalTokens: 110, Cost: 1, CreatedAt: day.Add(time.Hour + time.Minute)},
+		{UserID: 1, Model: "gpt-4", ChannelID: 1, PromptTokens: 50, CompletionTokens: 5, TotalTokens: 55, Cost: 0.5, CreatedAt: day.Add(time.Hour + 30*time.Minute)},
+		{UserID: 1, Model: "gpt-4", ChannelID: 1, PromptTokens: 20, CompletionTokens: 2, TotalTokens: 22, CreatedAt: day.Add(5 * time.Hour)},
+		{UserID: 2, Model: "gpt-4", ChannelID: 1, Tags: "feature=search,team=growth", PromptTokens: 7, CompletionTokens: 3, TotalTokens: 10, CreatedAt: day.Add(5 * time.Hour)},
+		// Recent usage is kept as logs
+		{UserID: 1, Model: "gpt-4", ChannelID: 1, PromptTokens: 1, CompletionTokens: 1, TotalTokens: 2, CreatedAt: day.AddDate(0, 0, 10)},
+	}
+	for _, e := range entries {
+		if err := db.CreateUsageLog(e); err != nil {
+			t.Fatalf("Failed to create usage log: %v", err)
+		}
+	}
+
+	summarize := func(q UsageQuery) *UsageSummary {
+		t.Helper()
+		totals, err := db.SummarizeUsage(q)
+		if err != nil {
+			t.Fatalf("Failed to summarize usage: %v", err)
+		}
+		return totals[0]
+	}
+	before := summarize(UsageQuery{})
+
+	n, err := db.RollupUsageLogs(day.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("Failed to roll up usage logs: %v", err)
+	}
+	if n != 4 {
+		t.Errorf("Expected 4 logs rolled up, got %d", n)
+	}
+	logs, _ := db.ListUsageLogs(UsageQuery{}, 10)
+	if len(logs) != 1 {
+		t.Errorf("Expected only the recent log to be kept, got %d", len(logs))
+	}
+
+	// Totals are unchanged, and hourly buckets still filter by time
+	after := summarize(UsageQuery{})
+	if *after != *before {
+		t.Errorf("Expected totals %+v after the rollup, got %+v", before, after)
+	}
+	hour := summarize(UsageQuery{UserID: 1, From: day.Add(time.Hour), To: day.Add(2 * time.Hour)})
+	if hour.Requests != 2 || hour.TotalTokens != 165 || hour.Cost != 1.5 {
+		t.Errorf("Unexpected usage in the rolled up hour: %+v", hour)
+	}
+
+	// A second run adds to the buckets of the first
+	db.CreateUsageLog(&UsageLog{UserID: 1, Model: "gpt-4", ChannelID: 1, TotalTokens: 5, CreatedAt: day.Add(time.Hour + 45*time.Minute)})
+	if _, err := db.RollupUsageLogs(day.AddDate(0, 0, 1)); err != nil {
+		t.Fatal(err)
+	}
+	hour = summarize(UsageQuery{UserID: 1, From: day.Add(time.Hour), To: day.Add(2 * time.Hour)})
+	if hour.Requests != 3 || hour.TotalTokens != 170 {
+		t.Errorf("Expected the later log to join its hour, got %+v", hour)
+	}
+
+	// Hourly rollups merge into days
+	n, err = db.RollupHourlyUsage(day.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("Failed to roll up hourly usage: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("Expected 3 hourly rollups merged, got %d", n)
+	}
+	dayTotals := summarize(UsageQuery{UserID: 1, From: day, To: day.AddDate(0, 0, 1)})
+	if dayTotals.Requests != 4 || dayTotals.TotalTokens != 192 {
+		t.Errorf("Unexpected daily usage: %+v", dayTotals)
+	}
+	byUser, err := db.SummarizeUsage(UsageQuery{}, UsageByUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(byUser) != 2 || byUser[0].Requests != 5 || byUser[1].Requests != 1 {
+		t.Errorf("Unexpected usage by user after rollups: %+v, %+v", byUser[0], byUser[1])
+	}
+
+	// Tags are kept through both rollups
+	for _, tags := range [][]string{{"team=growth"}, {"team"}, {"team=growth", "feature=search"}} {
+		if tagged := summarize(UsageQuery{Tags: tags}); tagged.Requests != 1 || tagged.TotalTokens != 10 {
+			t.Errorf("Expected the tagged request for %v, got %+v", tags, tagged)
+		}
+	}
+	for _, tags := range [][]string{{"team=grow"}, {"eam=growth"}, {"growth"}} {
+		if tagged := summarize(UsageQuery{Tags: tags}); tagged.Requests != 0 {
+			t.Errorf("Expected no usage for %v, got %+v", tags, tagged)
+		}
+	}
+}
@@ -2,41 +2,175 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"time"
 )
 
 // User represents an API key holder
 type User struct {
-	ID        int64     `json:"id"`
-	APIKey    string    `json:"api_key"`
-	Name      string    `json:"name"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID         int64             `json:"id"`
+	APIKey     string            `json:"api_key"`
+	Name       string            `json:"name"`
+	Enabled    bool              `json:"enabled"`
+	ExternalID string            `json:"external_id,omitempty"`
+	Metadata   json.RawMessage   `json:"metadata,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	// AllowedModels lists the models the user may call, where a trailing *
+	// matches any suffix; empty allows every model
+	AllowedModels []string  `json:"allowed_models,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
 }
 
-// CreateUser creates a new user
+// MatchLabels reports whether the user carries every label in selector
+func (u *User) MatchLabels(selector map[string]string) bool {
+	for k, v := range selector {
+		if value, ok := u.Labels[k]; !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+// userColumns lists the columns selected for a User, in scan order. The API
+// key is the user's primary key.
+const userColumns = "users.id, COALESCE((SELECT primary_key.key FROM api_keys primary_key WHERE primary_key.user_id = users.id AND primary_key.is_primary), ''), users.name, users.enabled, users.external_id, users.metadata, users.labels, users.allowed_models, users.created_at, users.updated_at"
+
+// userScan holds the scan destinations of the userColumns
+type userScan struct {
+	user                                              User
+	name, externalID, metadata, labels, allowedModels sql.NullString
+}
+
+// dest returns the destinations of the userColumns, in order
+func (s *userScan) dest() []any {
+	return []any{&s.user.ID, &s.user.APIKey, &s.name, &s.user.Enabled, &s.externalID, &s.metadata, &s.labels, &s.allowedModels, &s.user.CreatedAt, &s.user.UpdatedAt}
+}
+
+// finish decodes the scanned columns into the User
+func (s *userScan) finish() (*User, error) {
+	user := &s.user
+	user.Name = s.name.String
+	user.ExternalID = s.externalID.String
+	if s.metadata.Valid && s.metadata.String != "" {
+		user.Metadata = json.RawMessage(s.metadata.String)
+	}
+	if s.labels.Valid && s.labels.String != "" {
+		if err := json.Unmarshal([]byte(s.labels.String), &user.Labels); err != nil {
+			return nil, fmt.Errorf("invalid labels for user %d: %w", user.ID, err)
+		}
+	}
+	if err := decodeModelList(s.allowedModels, &user.AllowedModels); err != nil {
+		return nil, fmt.Errorf("invalid allowed models for user %d: %w", user.ID, err)
+	}
+	return user, nil
+}
+
+// scanUser scans a row selected with userColumns into a User
+func scanUser(row rowScanner) (*User, error) {
+	var s userScan
+	if err := row.Scan(s.dest()...); err != nil {
+		return nil, err
+	}
+	return s.finish()
+}
+
+// encodeModelList serializes a list of model names for storage, using NULL
+// when empty
+func encodeModelList(models []string) (sql.NullString, error) {
+	if len(models) == 0 {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(models)
+	if err != nil {
+		return sql.NullString{}, fmt.Errorf("failed to encode allowed models: %w", err)
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+// decodeModelList parses a list of model names stored by encodeModelList
+func decodeModelList(value sql.NullString, models *[]string) error {
+	if !value.Valid || value.String == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(value.String), models)
+}
+
+// encodeUserFields serializes metadata and labels for storage, using NULL when empty
+func encodeUserFields(user *User) (metadata, labels sql.NullString, err error) {
+	if len(user.Metadata) > 0 && string(user.Metadata) != "null" {
+		metadata = sql.NullString{String: string(user.Metadata), Valid: true}
+	}
+
+	if len(user.Labels) > 0 {
+		data, err := json.Marshal(user.Labels)
+		if err != nil {
+			return metadata, labels, fmt.Errorf("failed to encode labels: %w", err)
+		}
+		labels = sql.NullString{String: string(data), Valid: true}
+	}
+
+	return metadata, labels, nil
+}
+
+// nullIfEmpty stores empty strings as NULL so partial unique indexes ignore them
+func nullIfEmpty(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// CreateUser creates a new user with its API key as primary key. Users are
+// created enabled.
 func (db *DB) CreateUser(user *User) error {
+	return db.Transaction(func(tx *DB) error {
+		return tx.insertUser(user)
+	})
+}
+
+// CreateUsers creates several users in a single transaction; either all of
+// them are created or none are
+func (db *DB) CreateUsers(users []*User) error {
+	return db.Transaction(func(tx *DB) error {
+		for _, user := range users {
+			if err := tx.insertUser(user); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// insertUser inserts a user and its primary key
+func (db *DB) insertUser(user *User) error {
+	user.Enabled = true
+
+	metadata, labels, err := encodeUserFields(user)
+	if err != nil {
+		return err
+	}
+	allowedModels, err := encodeModelList(user.AllowedModels)
+	if err != nil {
+		return err
+	}
+
 	result, err := db.Exec(
-		"INSERT INTO users (api_key, name) VALUES (?, ?)",
-		user.APIKey, user.Name,
+		"INSERT INTO users (name, enabled, external_id, metadata, labels, allowed_models) VALUES (?, ?, ?, ?, ?, ?)",
+		user.Name, user.Enabled, nullIfEmpty(user.ExternalID), metadata, labels, allowedModels,
 	)
+	if cols := uniqueColumns(err); cols != nil {
+		return userDuplicateError(user, cols)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to create user: %w", err)
 	}
-
 	user.ID, _ = result.LastInsertId()
-	return nil
+
+	return db.CreateAPIKey(&APIKey{UserID: user.ID, Name: PrimaryKeyName, Key: user.APIKey, Primary: true, Enabled: true})
 }
 
 // GetUser retrieves a user by ID
 func (db *DB) GetUser(id int64) (*User, error) {
-	var user User
-
-	err := db.QueryRow(
-		"SELECT id, api_key, name, created_at, updated_at FROM users WHERE id = ?",
-		id,
-	).Scan(&user.ID, &user.APIKey, &user.Name, &user.CreatedAt, &user.UpdatedAt)
+	user, err := scanUser(db.QueryRow("SELECT "+userColumns+" FROM users WHERE id = ?", id))
 
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -45,31 +179,50 @@ func (db *DB) GetUser(id int64) (*User, error) {
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 
-	return &user, nil
+	return user, nil
 }
 
-// GetUserByAPIKey retrieves a user by API key
+// GetUserByAPIKey retrieves the user holding a valid API key, including a
+// rotated key until its grace period ends
 func (db *DB) GetUserByAPIKey(apiKey string) (*User, error) {
-	var user User
+	user, key, err := db.LookupAPIKey(apiKey)
+	if user == nil || err != nil || !key.Valid(time.Now()) {
+		return nil, err
+	}
+	return user, nil
+}
+
+// GetUserByName retrieves a user by name
+func (db *DB) GetUserByName(name string) (*User, error) {
+	user, err := scanUser(db.QueryRow("SELECT "+userColumns+" FROM users WHERE name = ?", name))
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user by name: %w", err)
+	}
 
-	err := db.QueryRow(
-		"SELECT id, api_key, name, created_at, updated_at FROM users WHERE api_key = ?",
-		apiKey,
-	).Scan(&user.ID, &user.APIKey, &user.Name, &user.CreatedAt, &user.UpdatedAt)
+	return user, nil
+}
+
+// GetUserByExternalID retrieves a user by the ID assigned by an external identity source
+func (db *DB) GetUserByExternalID(externalID string) (*User, error) {
+	user, err := scanUser(db.QueryRow("SELECT "+userColumns+" FROM users WHERE external_id = ?", externalID))
 
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user by API key: %w", err)
+		return nil, fmt.Errorf("failed to get user by external ID: %w", err)
 	}
 
-	return &user, nil
+	return user, nil
 }
 
 // ListUsers retrieves all users
 func (db *DB) ListUsers() ([]*User, error) {
-	rows, err := db.Query("SELECT id, api_key, name, created_at, updated_at FROM users")
+	rows, err := db.Query("SELECT " + userColumns + " FROM users")
 	if err != nil {
 		return nil, fmt.Errorf("failed to list users: %w", err)
 	}
@@ -77,33 +230,84 @@ func (db *DB) ListUsers() ([]*User, error) {
 
 	var users []*User
 	for rows.Next() {
-		var user User
-
-		if err := rows.Scan(&user.ID, &user.APIKey, &user.Name, &user.CreatedAt, &user.UpdatedAt); err != nil {
+		user, err := scanUser(rows)
+		if err != nil {
 			return nil, fmt.Errorf("failed to scan user: %w", err)
 		}
 
-		users = append(users, &user)
+		users = append(users, user)
 	}
 
 	return users, nil
 }
 
-// UpdateUser updates a user
+// UpdateUser updates a user, and its primary key when the API key changed
 func (db *DB) UpdateUser(user *User) error {
-	_, err := db.Exec(
-		"UPDATE users SET api_key = ?, name = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
-		user.APIKey, user.Name, user.ID,
-	)
+	metadata, labels, err := encodeUserFields(user)
+	if err != nil {
+		return err
+	}
+	allowedModels, err := encodeModelList(user.AllowedModels)
 	if err != nil {
-		return fmt.Errorf("failed to update user: %w", err)
+		return err
 	}
 
-	return nil
+	return db.Transaction(func(tx *DB) error {
+		_, err := tx.Exec(
+			"UPDATE users SET name = ?, enabled = ?, external_id = ?, metadata = ?, labels = ?, allowed_models = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+			user.Name, user.Enabled, nullIfEmpty(user.ExternalID), metadata, labels, allowedModels, user.ID,
+		)
+		if cols := uniqueColumns(err); cols != nil {
+			return userDuplicateError(user, cols)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update user: %w", err)
+		}
+
+		// A new API key replaces the primary key's value, keeping its ID
+		_, err = tx.Exec(
+			"UPDATE api_keys SET key = ?, updated_at = CURRENT_TIMESTAMP WHERE user_id = ? AND is_primary AND key != ?",
+			user.APIKey, user.ID, user.APIKey,
+		)
+		if uniqueColumns(err) != nil {
+			return duplicateError("API key")
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update API key: %w", err)
+		}
+		return nil
+	})
+}
+
+// userDuplicateError describes which unique user field was duplicated
+func userDuplicateError(user *User, cols []string) error {
+	for _, col := range cols {
+		switch col {
+		case "users.name":
+			return duplicateError(fmt.Sprintf("user name %q", user.Name))
+		case "users.external_id":
+			return duplicateError(fmt.Sprintf("external ID %q", user.ExternalID))
+		}
+	}
+	// Never echo the key itself back
+	return duplicateError("API key")
 }
 
-// DeleteUser deletes a user by ID
+// DeleteUser deletes a user by ID, revoking its additional and rotated keys
+// and removing its quota
 func (db *DB) DeleteUser(id int64) error {
+	if _, err := db.Exec("DELETE FROM user_quotas WHERE user_id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete user quota: %w", err)
+	}
+	if _, err := db.Exec("DELETE FROM user_group_members WHERE user_id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete group memberships: %w", err)
+	}
+	if _, err := db.Exec("DELETE FROM api_keys WHERE user_id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete API keys: %w", err)
+	}
+	if _, err := db.Exec("DELETE FROM api_key_rotations WHERE user_id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete key rotations: %w", err)
+	}
 	_, err := db.Exec("DELETE FROM users WHERE id = ?", id)
 	if err != nil {
 		return fmt.Errorf("failed to delete user: %w", err)
@@ -1,7 +1,9 @@
 package database
 
 import (
+	"errors"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -50,3 +52,39 @@ func TestUserCRUD(t *testing.T) {
 		t.Errorf("Expected 1 user, got %d", len(users))
 	}
 }
+
+func TestUserDuplicates(t *testing.T) {
+	dbPath := "/tmp/test_user_duplicates.db"
+	defer os.Remove(dbPath)
+
+	db, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.CreateUser(&User{APIKey: "key-1", Name: "alice"}); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	err = db.CreateUser(&User{APIKey: "key-1", Name: "bob"})
+	if !errors.Is(err, ErrDuplicate) {
+		t.Errorf("Expected ErrDuplicate for duplicate API key, got %v", err)
+	}
+	if err != nil && strings.Contains(err.Error(), "key-1") {
+		t.Errorf("Duplicate error must not echo the API key: %v", err)
+	}
+
+	err = db.CreateUser(&User{APIKey: "key-2", Name: "alice"})
+	if !errors.Is(err, ErrDuplicate) {
+		t.Errorf("Expected ErrDuplicate for duplicate name, got %v", err)
+	}
+
+	// Unnamed users are exempt from the name constraint
+	if err := db.CreateUser(&User{APIKey: "key-3"}); err != nil {
+		t.Errorf("Failed to create unnamed user: %v", err)
+	}
+	if err := db.CreateUser(&User{APIKey: "key-4"}); err != nil {
+		t.Errorf("Failed to create second unnamed user: %v", err)
+	}
+}
@@ -2,12 +2,36 @@ package health
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"slices"
+	"strconv"
 	"sync"
 	"time"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/X0Ken/openai-gateway/pkg/store"
+	"github.com/X0Ken/openai-gateway/pkg/workerpool"
 )
 
+// checkConcurrency bounds the number of channels probed in parallel
+const checkConcurrency = 8
+
+// DefaultFailureThreshold is the number of consecutive failures after which
+// a channel is marked unhealthy
+const DefaultFailureThreshold = 3
+
+// Prober checks a channel's endpoint, returning an error if it failed. It
+// returns ErrSkipped for channels it cannot check.
+type Prober func(ctx context.Context, ch *database.Channel) error
+
+// ErrSkipped is returned by a Prober for a channel it cannot check; the
+// channel keeps its status
+var ErrSkipped = errors.New("channel cannot be probed")
+
 // Status represents the health status of a channel
 type Status string
 
@@ -28,79 +52,153 @@ type ChannelHealth struct {
 
 // Checker manages health checks for channels
 type Checker struct {
-	mu       sync.RWMutex
-	statuses map[int64]*ChannelHealth
-	interval time.Duration
-	timeout  time.Duration
-	stopCh   chan struct{}
+	mu        sync.RWMutex
+	statuses  map[int64]*ChannelHealth
+	interval  time.Duration
+	timeout   time.Duration
+	threshold int
+	state     store.State
+	db        *database.DB
+	probe     Prober
 }
 
 // NewChecker creates a new health checker
 func NewChecker(interval, timeout time.Duration) *Checker {
 	return &Checker{
-		statuses: make(map[int64]*ChannelHealth),
-		interval: interval,
-		timeout:  timeout,
-		stopCh:   make(chan struct{}),
+		statuses:  make(map[int64]*ChannelHealth),
+		interval:  interval,
+		timeout:   timeout,
+		threshold: DefaultFailureThreshold,
 	}
 }
 
-// Start begins the health check loop
-func (c *Checker) Start() {
-	go c.loop()
+// SetFailureThreshold sets the number of consecutive failures after which a
+// channel is marked unhealthy
+func (c *Checker) SetFailureThreshold(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.threshold = n
 }
 
-// Stop stops the health check loop
-func (c *Checker) Stop() {
-	close(c.stopCh)
+// SetTiming changes the check interval and the timeout of each probe, such
+// as after a configuration reload
+func (c *Checker) SetTiming(interval, timeout time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.interval = interval
+	c.timeout = timeout
 }
 
-// loop runs the health check loop
-func (c *Checker) loop() {
-	ticker := time.NewTicker(c.interval)
-	defer ticker.Stop()
+// SetProber enables active checks: CheckAll probes every enabled channel in
+// db, and statuses are saved to db so they survive restarts. Saved statuses
+// are loaded right away.
+func (c *Checker) SetProber(db *database.DB, probe Prober) error {
+	saved, err := db.ListChannelHealth()
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	for {
-		select {
-		case <-ticker.C:
-			c.checkAll()
-		case <-c.stopCh:
-			return
+	c.db = db
+	c.probe = probe
+	for _, h := range saved {
+		c.statuses[h.ChannelID] = &ChannelHealth{
+			ChannelID:           h.ChannelID,
+			Status:              Status(h.Status),
+			LastChecked:         h.LastChecked,
+			LastError:           h.LastError,
+			ConsecutiveFailures: h.ConsecutiveFailures,
 		}
 	}
+	return nil
 }
 
-// checkAll performs health checks on all registered channels
-func (c *Checker) checkAll() {
+// SetStateStore shares health state through a store so that every replica
+// sees failures detected by the others
+func (c *Checker) SetStateStore(state store.State) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.state = state
+}
+
+// CheckAll probes every enabled channel. It is meant to run every check
+// interval. Without a prober only passive detection applies, and it does
+// nothing.
+func (c *Checker) CheckAll(ctx context.Context) error {
 	c.mu.RLock()
-	channelIDs := make([]int64, 0, len(c.statuses))
-	for id := range c.statuses {
-		channelIDs = append(channelIDs, id)
-	}
+	db, probe, timeout := c.db, c.probe, c.timeout
 	c.mu.RUnlock()
+	if probe == nil {
+		return nil
+	}
 
-	for _, id := range channelIDs {
-		c.checkChannel(id)
+	channels, err := db.ListEnabledChannels()
+	if err != nil {
+		return err
 	}
-}
 
-// checkChannel performs a health check on a single channel
-func (c *Checker) checkChannel(channelID int64) {
-	// This would normally check the actual channel endpoint
-	// For now, we'll just update the timestamp
+	// Track exactly the enabled channels
+	enabled := make(map[int64]bool, len(channels))
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	for _, ch := range channels {
+		enabled[ch.ID] = true
+		if _, exists := c.statuses[ch.ID]; !exists {
+			c.statuses[ch.ID] = &ChannelHealth{ChannelID: ch.ID, Status: StatusUnknown}
+		}
+	}
+	var dropped []int64
+	for id := range c.statuses {
+		if !enabled[id] {
+			delete(c.statuses, id)
+			dropped = append(dropped, id)
+		}
+	}
+	c.mu.Unlock()
+	for _, id := range dropped {
+		if err := db.DeleteChannelHealth(id); err != nil {
+			log.Printf("Failed to delete health of channel %d: %v", id, err)
+		}
+	}
 
-	if status, exists := c.statuses[channelID]; exists {
-		status.LastChecked = time.Now()
+	return workerpool.Run(ctx, checkConcurrency, channels, func(ctx context.Context, ch *database.Channel) error {
+		c.checkChannel(ctx, ch, probe, timeout)
+		return nil
+	})
+}
+
+// checkChannel probes a single channel and records the result
+func (c *Checker) checkChannel(ctx context.Context, ch *database.Channel, probe Prober, timeout time.Duration) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	err := probe(ctx, ch)
+	if errors.Is(err, ErrSkipped) {
+		return
+	}
+	if err != nil && ctx.Err() == context.Canceled {
+		// Shutting down; the channel was not at fault
+		return
 	}
+	c.UpdateStatus(ch.ID, err == nil, err)
 }
 
-// RegisterChannel registers a channel for health checking
+// RegisterChannel registers a channel for health checking. A channel
+// already registered keeps its status.
 func (c *Checker) RegisterChannel(channelID int64, baseURL string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	if _, exists := c.statuses[channelID]; exists {
+		return
+	}
 	c.statuses[channelID] = &ChannelHealth{
 		ChannelID:   channelID,
 		Status:      StatusUnknown,
@@ -108,30 +206,62 @@ func (c *Checker) RegisterChannel(channelID int64, baseURL string) {
 	}
 }
 
-// UnregisterChannel removes a channel from health checking
+// UnregisterChannel removes a channel from health checking, along with its
+// saved status
 func (c *Checker) UnregisterChannel(channelID int64) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
-
 	delete(c.statuses, channelID)
+	db := c.db
+	c.mu.Unlock()
+
+	if db != nil {
+		if err := db.DeleteChannelHealth(channelID); err != nil {
+			log.Printf("Failed to delete health of channel %d: %v", channelID, err)
+		}
+	}
 }
 
-// GetStatus returns the health status of a channel
+// GetStatus returns the health status of a channel, preferring the shared
+// state when a store is configured
 func (c *Checker) GetStatus(channelID int64) *ChannelHealth {
 	c.mu.RLock()
-	defer c.mu.RUnlock()
+	state := c.state
+	var local *ChannelHealth
+	if status, exists := c.statuses[channelID]; exists {
+		copied := *status
+		local = &copied
+	}
+	c.mu.RUnlock()
+
+	if state != nil {
+		data, err := state.Get(context.Background(), healthKey(channelID))
+		if err == nil && data != nil {
+			var shared ChannelHealth
+			if json.Unmarshal(data, &shared) == nil {
+				return &shared
+			}
+		}
+	}
 
-	return c.statuses[channelID]
+	return local
 }
 
-// GetAllStatuses returns the health status of all channels
+// GetAllStatuses returns the health status of all registered channels,
+// ordered by channel ID
 func (c *Checker) GetAllStatuses() []*ChannelHealth {
 	c.mu.RLock()
-	defer c.mu.RUnlock()
+	channelIDs := make([]int64, 0, len(c.statuses))
+	for id := range c.statuses {
+		channelIDs = append(channelIDs, id)
+	}
+	c.mu.RUnlock()
+	slices.Sort(channelIDs)
 
-	statuses := make([]*ChannelHealth, 0, len(c.statuses))
-	for _, status := range c.statuses {
-		statuses = append(statuses, status)
+	statuses := make([]*ChannelHealth, 0, len(channelIDs))
+	for _, id := range channelIDs {
+		if status := c.GetStatus(id); status != nil {
+			statuses = append(statuses, status)
+		}
 	}
 
 	return statuses
@@ -140,14 +270,15 @@ func (c *Checker) GetAllStatuses() []*ChannelHealth {
 // UpdateStatus updates the health status of a channel (passive detection)
 func (c *Checker) UpdateStatus(channelID int64, healthy bool, err error) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
 
 	status, exists := c.statuses[channelID]
 	if !exists {
+		c.mu.Unlock()
 		return
 	}
 
 	status.LastChecked = time.Now()
+	previous := status.Status
 
 	if healthy {
 		status.Status = StatusHealthy
@@ -155,13 +286,78 @@ func (c *Checker) UpdateStatus(channelID int64, healthy bool, err error) {
 		status.LastError = ""
 	} else {
 		status.ConsecutiveFailures++
-		if status.ConsecutiveFailures >= 3 {
+		if status.ConsecutiveFailures >= c.threshold {
 			status.Status = StatusUnhealthy
 		}
 		if err != nil {
 			status.LastError = err.Error()
 		}
 	}
+
+	snapshot := *status
+	db := c.db
+	c.mu.Unlock()
+
+	if snapshot.Status != previous {
+		switch snapshot.Status {
+		case StatusUnhealthy:
+			log.Printf("Channel %d marked unhealthy after %d consecutive failures: %s", channelID, snapshot.ConsecutiveFailures, snapshot.LastError)
+		case StatusHealthy:
+			if previous == StatusUnhealthy {
+				log.Printf("Channel %d is healthy again", channelID)
+			}
+		}
+	}
+
+	c.publish(snapshot)
+	if db != nil {
+		c.save(db, snapshot)
+	}
+}
+
+// Unhealthy reports whether a channel has been marked unhealthy
+func (c *Checker) Unhealthy(channelID int64) bool {
+	status := c.GetStatus(channelID)
+	return status != nil && status.Status == StatusUnhealthy
+}
+
+// save persists a channel's health
+func (c *Checker) save(db *database.DB, status ChannelHealth) {
+	err := db.SaveChannelHealth(&database.ChannelHealth{
+		ChannelID:           status.ChannelID,
+		Status:              string(status.Status),
+		ConsecutiveFailures: status.ConsecutiveFailures,
+		LastError:           status.LastError,
+		LastChecked:         status.LastChecked,
+	})
+	if err != nil {
+		log.Printf("Failed to save health of channel %d: %v", status.ChannelID, err)
+	}
+}
+
+// publish writes a channel's health to the shared state store, if any. It
+// expires after a few check intervals so a stopped replica's view fades out.
+func (c *Checker) publish(status ChannelHealth) {
+	c.mu.RLock()
+	state, interval := c.state, c.interval
+	c.mu.RUnlock()
+
+	if state == nil {
+		return
+	}
+
+	data, err := json.Marshal(status)
+	if err != nil {
+		return
+	}
+	if err := state.Set(context.Background(), healthKey(status.ChannelID), data, 3*interval); err != nil {
+		log.Printf("Failed to publish health of channel %d: %v", status.ChannelID, err)
+	}
+}
+
+// healthKey returns the shared state key of a channel's health
+func healthKey(channelID int64) string {
+	return "health:" + strconv.FormatInt(channelID, 10)
 }
 
 // CheckEndpoint performs an HTTP health check on an endpoint
@@ -0,0 +1,74 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+)
+
+func TestActiveChecksMarkChannelsUnhealthy(t *testing.T) {
+	dbPath := "/tmp/test_health.db"
+	defer os.Remove(dbPath)
+
+	db, err := database.New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	down := &database.Channel{Name: "down", BaseURL: "https://down.example.com", APIKey: "sk-a", Weight: 10, Enabled: true}
+	up := &database.Channel{Name: "up", BaseURL: "https://up.example.com", APIKey: "sk-b", Weight: 10, Enabled: true}
+	other := &database.Channel{Name: "other", Type: database.ChannelTypeAnthropic, BaseURL: "https://other.example.com", APIKey: "sk-c", Weight: 10, Enabled: true}
+	for _, ch := range []*database.Channel{down, up, other} {
+		db.CreateChannel(ch)
+	}
+
+	failing := map[int64]bool{down.ID: true}
+	probe := func(ctx context.Context, ch *database.Channel) error {
+		if ch.Type == database.ChannelTypeAnthropic {
+			return ErrSkipped
+		}
+		if failing[ch.ID] {
+			return errors.New("connection refused")
+		}
+		return nil
+	}
+
+	checker := NewChecker(time.Minute, time.Second)
+	checker.SetFailureThreshold(2)
+	if err := checker.SetProber(db, probe); err != nil {
+		t.Fatal(err)
+	}
+
+	checker.CheckAll(context.Background())
+	if checker.Unhealthy(down.ID) {
+		t.Error("Expected one failure to stay below the threshold")
+	}
+	checker.CheckAll(context.Background())
+	if !checker.Unhealthy(down.ID) || checker.Unhealthy(up.ID) {
+		t.Errorf("Expected only %s to be unhealthy", down.Name)
+	}
+	if status := checker.GetStatus(other.ID); status == nil || status.Status != StatusUnknown {
+		t.Errorf("Expected a skipped channel to stay unknown, got %+v", status)
+	}
+
+	// The status survives a restart
+	restarted := NewChecker(time.Minute, time.Second)
+	if err := restarted.SetProber(db, probe); err != nil {
+		t.Fatal(err)
+	}
+	if !restarted.Unhealthy(down.ID) {
+		t.Error("Expected the unhealthy status to be loaded")
+	}
+
+	// One success makes the channel healthy again
+	failing[down.ID] = false
+	restarted.CheckAll(context.Background())
+	if restarted.Unhealthy(down.ID) {
+		t.Error("Expected the channel to recover")
+	}
+}
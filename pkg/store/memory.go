@@ -0,0 +1,121 @@
+package store
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Memory is an in-process store for single-node deployments
+type Memory struct {
+	mu       sync.Mutex
+	counters map[string]*memoryCounter
+	values   map[string]*memoryValue
+	sets     map[string]map[string][]byte
+	now      func() time.Time
+}
+
+type memoryCounter struct {
+	value     int64
+	expiresAt time.Time
+}
+
+type memoryValue struct {
+	data      []byte
+	expiresAt time.Time
+}
+
+// NewMemory creates a new in-memory store
+func NewMemory() *Memory {
+	return &Memory{
+		counters: make(map[string]*memoryCounter),
+		values:   make(map[string]*memoryValue),
+		sets:     make(map[string]map[string][]byte),
+		now:      time.Now,
+	}
+}
+
+// Incr increments a fixed-window counter
+func (m *Memory) Incr(ctx context.Context, key string, window time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	counter, ok := m.counters[key]
+	if !ok || !now.Before(counter.expiresAt) {
+		counter = &memoryCounter{expiresAt: now.Add(window)}
+		m.counters[key] = counter
+	}
+	counter.value++
+
+	return counter.value, nil
+}
+
+// Get returns a stored value
+func (m *Memory) Get(ctx context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	value, ok := m.values[key]
+	if !ok {
+		return nil, nil
+	}
+	if !value.expiresAt.IsZero() && !m.now().Before(value.expiresAt) {
+		delete(m.values, key)
+		return nil, nil
+	}
+
+	return value.data, nil
+}
+
+// Set stores a value
+func (m *Memory) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry := &memoryValue{data: append([]byte(nil), value...)}
+	if ttl > 0 {
+		entry.expiresAt = m.now().Add(ttl)
+	}
+	m.values[key] = entry
+
+	return nil
+}
+
+// SetMember stores the value of a member of a set
+func (m *Memory) SetMember(ctx context.Context, set, member string, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	members, ok := m.sets[set]
+	if !ok {
+		members = make(map[string][]byte)
+		m.sets[set] = members
+	}
+	members[member] = append([]byte(nil), value...)
+
+	return nil
+}
+
+// ListMembers returns the members of a set
+func (m *Memory) ListMembers(ctx context.Context, set string) (map[string][]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	members := make(map[string][]byte, len(m.sets[set]))
+	for member, value := range m.sets[set] {
+		members[member] = value
+	}
+
+	return members, nil
+}
+
+// DeleteMember removes a member from a set
+func (m *Memory) DeleteMember(ctx context.Context, set, member string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sets[set], member)
+
+	return nil
+}
@@ -0,0 +1,374 @@
+package store
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// redisDialTimeout bounds connection attempts to Redis
+const redisDialTimeout = 5 * time.Second
+
+// redisPoolSize is how many connections to Redis are kept open. Commands of
+// concurrent requests run on separate connections, and wait for a free one
+// beyond this many.
+const redisPoolSize = 8
+
+// Redis is a store shared between gateway replicas. It speaks the Redis
+// protocol (RESP) over a small pool of connections. A connection that fails
+// is dropped and a new one is dialed for the next command needing it.
+type Redis struct {
+	addr     string
+	password string
+	db       int
+	// pool holds the idle connections, one entry per pool slot. A nil entry
+	// is a slot without a connection, dialed when it is taken.
+	pool chan *redisConn
+}
+
+// redisConn is one connection of the pool
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// errRedisNil is returned for RESP null replies
+var errRedisNil = errors.New("redis: nil")
+
+// NewRedis connects to a Redis server
+func NewRedis(addr, password string, db int) (*Redis, error) {
+	if addr == "" {
+		return nil, fmt.Errorf("redis address is required")
+	}
+
+	r := &Redis{addr: addr, password: password, db: db, pool: make(chan *redisConn, redisPoolSize)}
+
+	// Connect once up front so a bad address or password fails at start
+	conn, err := r.connect(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	r.pool <- conn
+	for i := 1; i < redisPoolSize; i++ {
+		r.pool <- nil
+	}
+
+	return r, nil
+}
+
+// Incr increments a fixed-window counter. The key is created with the window
+// as its expiry, and INCR keeps that expiry, so the window is anchored at the
+// first increment.
+func (r *Redis) Incr(ctx context.Context, key string, window time.Duration) (int64, error) {
+	ttl := strconv.FormatInt(window.Milliseconds(), 10)
+	if _, err := r.do(ctx, "SET", key, "0", "PX", ttl, "NX"); err != nil && !errors.Is(err, errRedisNil) {
+		return 0, err
+	}
+
+	reply, err := r.do(ctx, "INCR", key)
+	if err != nil {
+		return 0, err
+	}
+
+	n, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("redis: unexpected INCR reply %v", reply)
+	}
+	return n, nil
+}
+
+// Get returns a stored value
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, error) {
+	reply, err := r.do(ctx, "GET", key)
+	if errors.Is(err, errRedisNil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data, ok := reply.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("redis: unexpected GET reply %v", reply)
+	}
+	return data, nil
+}
+
+// Set stores a value
+func (r *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	args := []string{"SET", key, string(value)}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+
+	_, err := r.do(ctx, args...)
+	return err
+}
+
+// SetMember stores the value of a member of a set, kept as a hash field
+func (r *Redis) SetMember(ctx context.Context, set, member string, value []byte) error {
+	_, err := r.do(ctx, "HSET", set, member, string(value))
+	return err
+}
+
+// ListMembers returns the members of a set
+func (r *Redis) ListMembers(ctx context.Context, set string) (map[string][]byte, error) {
+	reply, err := r.do(ctx, "HGETALL", set)
+	if err != nil {
+		return nil, err
+	}
+
+	items, ok := reply.([]any)
+	if !ok || len(items)%2 != 0 {
+		return nil, fmt.Errorf("redis: unexpected HGETALL reply %v", reply)
+	}
+	members := make(map[string][]byte, len(items)/2)
+	for i := 0; i < len(items); i += 2 {
+		member, ok1 := items[i].([]byte)
+		value, ok2 := items[i+1].([]byte)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("redis: unexpected HGETALL reply %v", reply)
+		}
+		members[string(member)] = value
+	}
+	return members, nil
+}
+
+// getMember returns the value of a member of a set, or nil when it is missing
+func (r *Redis) getMember(ctx context.Context, set, member string) ([]byte, error) {
+	reply, err := r.do(ctx, "HGET", set, member)
+	if errors.Is(err, errRedisNil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data, ok := reply.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("redis: unexpected HGET reply %v", reply)
+	}
+	return data, nil
+}
+
+// DeleteMember removes a member from a set
+func (r *Redis) DeleteMember(ctx context.Context, set, member string) error {
+	_, err := r.do(ctx, "HDEL", set, member)
+	return err
+}
+
+// Close closes the pooled connections, waiting for those in use. Commands
+// after Close dial new connections.
+func (r *Redis) Close() error {
+	var errs []error
+	for i := 0; i < redisPoolSize; i++ {
+		conn := <-r.pool
+		if conn != nil {
+			errs = append(errs, conn.conn.Close())
+		}
+	}
+	for i := 0; i < redisPoolSize; i++ {
+		r.pool <- nil
+	}
+	return errors.Join(errs...)
+}
+
+// connect dials the server and authenticates
+func (r *Redis) connect(ctx context.Context) (*redisConn, error) {
+	dialer := net.Dialer{Timeout: redisDialTimeout}
+	nc, err := dialer.DialContext(ctx, "tcp", r.addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+	conn := &redisConn{conn: nc, reader: bufio.NewReader(nc)}
+
+	if r.password != "" {
+		if _, err := conn.roundTrip(ctx, []string{"AUTH", r.password}); err != nil {
+			nc.Close()
+			return nil, fmt.Errorf("failed to authenticate to redis: %w", err)
+		}
+	}
+	if r.db != 0 {
+		if _, err := conn.roundTrip(ctx, []string{"SELECT", strconv.Itoa(r.db)}); err != nil {
+			nc.Close()
+			return nil, fmt.Errorf("failed to select redis database: %w", err)
+		}
+	}
+
+	return conn, nil
+}
+
+// do sends a command on a pooled connection and returns its reply
+func (r *Redis) do(ctx context.Context, args ...string) (any, error) {
+	replies, err := r.send(ctx, args)
+	if replies == nil {
+		return nil, err
+	}
+	return replies[0], err
+}
+
+// multi runs commands in a MULTI/EXEC transaction, sent in one write, and
+// returns their replies. Either all of the commands run or none do, and no
+// other client sees a state between them.
+func (r *Redis) multi(ctx context.Context, cmds ...[]string) ([]any, error) {
+	pipeline := make([][]string, 0, len(cmds)+2)
+	pipeline = append(pipeline, []string{"MULTI"})
+	pipeline = append(pipeline, cmds...)
+	pipeline = append(pipeline, []string{"EXEC"})
+
+	replies, err := r.send(ctx, pipeline...)
+	if err != nil {
+		return nil, err
+	}
+	results, ok := replies[len(replies)-1].([]any)
+	if !ok || len(results) != len(cmds) {
+		return nil, fmt.Errorf("redis: unexpected EXEC reply %v", replies[len(replies)-1])
+	}
+	return results, nil
+}
+
+// send takes a connection from the pool, dialing it if needed, sends the
+// commands and returns it to the pool unless it failed
+func (r *Redis) send(ctx context.Context, cmds ...[]string) ([]any, error) {
+	var conn *redisConn
+	select {
+	case conn = <-r.pool:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	if conn == nil {
+		var err error
+		if conn, err = r.connect(ctx); err != nil {
+			r.pool <- nil
+			return nil, err
+		}
+	}
+
+	replies, err := conn.roundTrip(ctx, cmds...)
+	var serverErr redisError
+	if err != nil && !errors.Is(err, errRedisNil) && !errors.As(err, &serverErr) {
+		// The connection is in an unknown state after an I/O error
+		conn.conn.Close()
+		conn = nil
+	}
+	r.pool <- conn
+	return replies, err
+}
+
+// roundTrip writes commands in one write and reads a reply to each. Every
+// reply is read even when one is an error, and the first error is returned
+// along with the replies read.
+func (c *redisConn) roundTrip(ctx context.Context, cmds ...[]string) ([]any, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		c.conn.SetDeadline(deadline)
+	} else {
+		c.conn.SetDeadline(time.Time{})
+	}
+
+	var buf []byte
+	for _, args := range cmds {
+		buf = append(buf, '*')
+		buf = strconv.AppendInt(buf, int64(len(args)), 10)
+		buf = append(buf, '\r', '\n')
+		for _, arg := range args {
+			buf = append(buf, '$')
+			buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+			buf = append(buf, '\r', '\n')
+			buf = append(buf, arg...)
+			buf = append(buf, '\r', '\n')
+		}
+	}
+
+	if _, err := c.conn.Write(buf); err != nil {
+		return nil, fmt.Errorf("redis write failed: %w", err)
+	}
+
+	replies := make([]any, len(cmds))
+	var firstErr error
+	for i := range replies {
+		reply, err := readReply(c.reader)
+		var serverErr redisError
+		if err != nil && !errors.Is(err, errRedisNil) && !errors.As(err, &serverErr) {
+			return nil, err
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		replies[i] = reply
+	}
+	return replies, firstErr
+}
+
+// redisError is an error reply sent by the server
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// readReply reads a single RESP reply. Simple strings and bulk strings are
+// returned as []byte, integers as int64 and arrays as []any.
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("redis: malformed reply %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return []byte(body), nil
+	case '-':
+		return nil, redisError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed bulk length %q", body)
+		}
+		if n < 0 {
+			return nil, errRedisNil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed array length %q", body)
+		}
+		if n < 0 {
+			return nil, errRedisNil
+		}
+		// Every item is read even after an error item, such as a failed
+		// command in an EXEC reply, so the connection stays usable
+		items := make([]any, n)
+		var itemErr error
+		for i := range items {
+			item, err := readReply(r)
+			var serverErr redisError
+			if errors.As(err, &serverErr) {
+				itemErr = cmp.Or(itemErr, err)
+			} else if err != nil && !errors.Is(err, errRedisNil) {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, itemErr
+	default:
+		return nil, fmt.Errorf("redis: unknown reply type %q", kind)
+	}
+}
@@ -0,0 +1,120 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+)
+
+// redisMetricsKey prefixes the hash of routing metrics of each channel
+const redisMetricsKey = "metrics:channel:"
+
+// RedisMetrics stores the routing metrics of channels in Redis, so every
+// replica scores channels on the requests of the whole cluster. Each channel
+// keeps running totals, updated with atomic increments, from which the
+// averages are derived when read.
+type RedisMetrics struct {
+	r   *Redis
+	now func() time.Time
+}
+
+// NewRedisMetrics creates a metrics store on a Redis connection
+func NewRedisMetrics(r *Redis) *RedisMetrics {
+	return &RedisMetrics{r: r, now: time.Now}
+}
+
+// GetChannelMetrics retrieves the metrics of a channel, or nil when it has
+// served no requests
+func (m *RedisMetrics) GetChannelMetrics(channelID int64) (*database.ChannelMetrics, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisCommandTimeout)
+	defer cancel()
+
+	fields, err := m.r.ListMembers(ctx, redisMetricsKey+strconv.FormatInt(channelID, 10))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get channel metrics: %w", err)
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	var requests, successes, updatedAt int64
+	var latencySum float64
+	parseErr := errors.Join(
+		parseField(fields, "requests", &requests),
+		parseField(fields, "successes", &successes),
+		parseField(fields, "updated_at", &updatedAt),
+		parseField(fields, "latency_sum", &latencySum),
+	)
+	if parseErr != nil {
+		return nil, fmt.Errorf("invalid channel metrics: %w", parseErr)
+	}
+
+	metrics := &database.ChannelMetrics{
+		ChannelID:     channelID,
+		RequestCount:  requests,
+		SuccessCount:  successes,
+		LastUpdatedAt: time.UnixMilli(updatedAt).UTC(),
+	}
+	if requests > 0 {
+		metrics.LatencyAvg = latencySum / float64(requests)
+		metrics.ErrorRate = float64(requests-successes) / float64(requests)
+	}
+	return metrics, nil
+}
+
+// UpdateChannelMetrics records a request served by a channel. The counters
+// are updated in one transaction, so readers never see some of them updated.
+func (m *RedisMetrics) UpdateChannelMetrics(channelID int64, latency float64, success bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisCommandTimeout)
+	defer cancel()
+
+	key := redisMetricsKey + strconv.FormatInt(channelID, 10)
+	commands := [][]string{
+		{"HINCRBYFLOAT", key, "latency_sum", strconv.FormatFloat(latency, 'f', -1, 64)},
+		{"HINCRBY", key, "requests", "1"},
+		{"HSET", key, "updated_at", strconv.FormatInt(m.now().UnixMilli(), 10)},
+	}
+	if success {
+		commands = append(commands, []string{"HINCRBY", key, "successes", "1"})
+	}
+	if _, err := m.r.multi(ctx, commands...); err != nil {
+		return fmt.Errorf("failed to update channel metrics: %w", err)
+	}
+	return nil
+}
+
+// ResetChannelMetrics resets the metrics of a channel
+func (m *RedisMetrics) ResetChannelMetrics(channelID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisCommandTimeout)
+	defer cancel()
+
+	if _, err := m.r.do(ctx, "DEL", redisMetricsKey+strconv.FormatInt(channelID, 10)); err != nil {
+		return fmt.Errorf("failed to reset channel metrics: %w", err)
+	}
+	return nil
+}
+
+// parseField parses a numeric hash field into dst, leaving it zero when the
+// field is missing
+func parseField[T int64 | float64](fields map[string][]byte, name string, dst *T) error {
+	value, ok := fields[name]
+	if !ok {
+		return nil
+	}
+
+	var err error
+	switch p := any(dst).(type) {
+	case *int64:
+		*p, err = strconv.ParseInt(string(value), 10, 64)
+	case *float64:
+		*p, err = strconv.ParseFloat(string(value), 64)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,256 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+)
+
+// redisCommandTimeout bounds the Redis commands of the session and metrics
+// stores, whose interfaces take no context
+const redisCommandTimeout = 5 * time.Second
+
+// Keys of the Redis session store. Sessions are kept as JSON in a hash per
+// user, so routing reads only the sessions of the requesting user; the
+// index hash maps each session ID to its user.
+const (
+	redisSessionIDKey    = "sessions:next_id"
+	redisSessionIndexKey = "sessions"
+	redisUserSessionsKey = "sessions:user:"
+)
+
+// RedisSessions stores sticky sessions in Redis, so every replica routes a
+// user to the same channel
+type RedisSessions struct {
+	r   *Redis
+	now func() time.Time
+}
+
+// NewRedisSessions creates a session store on a Redis connection
+func NewRedisSessions(r *Redis) *RedisSessions {
+	return &RedisSessions{r: r, now: time.Now}
+}
+
+// CreateSession stores a new session with the next free ID
+func (s *RedisSessions) CreateSession(session *database.Session) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisCommandTimeout)
+	defer cancel()
+
+	reply, err := s.r.do(ctx, "INCR", redisSessionIDKey)
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	id, ok := reply.(int64)
+	if !ok {
+		return fmt.Errorf("redis: unexpected INCR reply %v", reply)
+	}
+
+	now := s.now().UTC()
+	created := *session
+	created.ID, created.LastUsedAt, created.CreatedAt = id, now, now
+	data, err := json.Marshal(&created)
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	field, userID := strconv.FormatInt(id, 10), strconv.FormatInt(session.UserID, 10)
+	if _, err := s.r.multi(ctx,
+		[]string{"HSET", redisUserSessionsKey + userID, field, string(data)},
+		[]string{"HSET", redisSessionIndexKey, field, userID},
+	); err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+
+	*session = created
+	return nil
+}
+
+// GetSession retrieves a session by ID
+func (s *RedisSessions) GetSession(id int64) (*database.Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisCommandTimeout)
+	defer cancel()
+
+	session, err := s.get(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+	return session, nil
+}
+
+// GetSessionByUserAndChannel retrieves a session by user and channel
+func (s *RedisSessions) GetSessionByUserAndChannel(userID, channelID int64) (*database.Session, error) {
+	return s.latest(userID, func(session *database.Session) bool { return session.ChannelID == channelID })
+}
+
+// GetSessionByUser retrieves the most recent session for a user
+func (s *RedisSessions) GetSessionByUser(userID int64) (*database.Session, error) {
+	return s.latest(userID, func(*database.Session) bool { return true })
+}
+
+// GetSessionByKey retrieves the most recent session for a session key of a
+// user. An empty key selects the sessions of the user's API key itself.
+func (s *RedisSessions) GetSessionByKey(userID int64, sessionKey string) (*database.Session, error) {
+	return s.latest(userID, func(session *database.Session) bool { return session.SessionKey == sessionKey })
+}
+
+// ListSessions retrieves all sessions
+func (s *RedisSessions) ListSessions() ([]*database.Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisCommandTimeout)
+	defer cancel()
+
+	index, err := s.r.ListMembers(ctx, redisSessionIndexKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	users := make(map[string]bool)
+	for _, userID := range index {
+		users[string(userID)] = true
+	}
+	var sessions []*database.Session
+	for userID := range users {
+		userSessions, err := s.userSessions(ctx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list sessions: %w", err)
+		}
+		sessions = append(sessions, userSessions...)
+	}
+	return sessions, nil
+}
+
+// UpdateSessionLastUsed updates the last used time of a session
+func (s *RedisSessions) UpdateSessionLastUsed(id int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisCommandTimeout)
+	defer cancel()
+
+	session, err := s.get(ctx, id)
+	if err == nil && session != nil {
+		session.LastUsedAt = s.now().UTC()
+		err = s.put(ctx, session)
+	}
+	if err == nil && session != nil {
+		// A session deleted since it was read must not be written back
+		var userID []byte
+		if userID, err = s.r.getMember(ctx, redisSessionIndexKey, strconv.FormatInt(id, 10)); err == nil && userID == nil {
+			err = s.r.DeleteMember(ctx, redisUserSessionsKey+strconv.FormatInt(session.UserID, 10), strconv.FormatInt(id, 10))
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update session last used: %w", err)
+	}
+	return nil
+}
+
+// DeleteSession deletes a session by ID
+func (s *RedisSessions) DeleteSession(id int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisCommandTimeout)
+	defer cancel()
+
+	if err := s.delete(ctx, id); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpiredSessions deletes sessions unused for longer than the idle
+// timeout
+func (s *RedisSessions) DeleteExpiredSessions(idleTimeoutMinutes int) error {
+	sessions, err := s.ListSessions()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisCommandTimeout)
+	defer cancel()
+
+	cutoff := s.now().Add(-time.Duration(idleTimeoutMinutes) * time.Minute)
+	for _, session := range sessions {
+		if session.LastUsedAt.Before(cutoff) {
+			if err := s.delete(ctx, session.ID); err != nil {
+				return fmt.Errorf("failed to delete expired sessions: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// latest returns the most recently used session of a user matching keep
+func (s *RedisSessions) latest(userID int64, keep func(*database.Session) bool) (*database.Session, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisCommandTimeout)
+	defer cancel()
+
+	sessions, err := s.userSessions(ctx, strconv.FormatInt(userID, 10))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	var latest *database.Session
+	for _, session := range sessions {
+		if keep(session) && (latest == nil || session.LastUsedAt.After(latest.LastUsedAt)) {
+			latest = session
+		}
+	}
+	return latest, nil
+}
+
+// userSessions returns the sessions stored in a user's hash
+func (s *RedisSessions) userSessions(ctx context.Context, userID string) ([]*database.Session, error) {
+	members, err := s.r.ListMembers(ctx, redisUserSessionsKey+userID)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]*database.Session, 0, len(members))
+	for _, data := range members {
+		var session database.Session
+		if err := json.Unmarshal(data, &session); err != nil {
+			return nil, fmt.Errorf("invalid session: %w", err)
+		}
+		sessions = append(sessions, &session)
+	}
+	return sessions, nil
+}
+
+// get returns a session by ID, or nil when it does not exist
+func (s *RedisSessions) get(ctx context.Context, id int64) (*database.Session, error) {
+	userID, err := s.r.getMember(ctx, redisSessionIndexKey, strconv.FormatInt(id, 10))
+	if err != nil || userID == nil {
+		return nil, err
+	}
+	data, err := s.r.getMember(ctx, redisUserSessionsKey+string(userID), strconv.FormatInt(id, 10))
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	var session database.Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("invalid session: %w", err)
+	}
+	return &session, nil
+}
+
+// put stores a session in its user's hash
+func (s *RedisSessions) put(ctx context.Context, session *database.Session) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return s.r.SetMember(ctx, redisUserSessionsKey+strconv.FormatInt(session.UserID, 10), strconv.FormatInt(session.ID, 10), data)
+}
+
+// delete removes a session and its index entry
+func (s *RedisSessions) delete(ctx context.Context, id int64) error {
+	field := strconv.FormatInt(id, 10)
+	userID, err := s.r.getMember(ctx, redisSessionIndexKey, field)
+	if err != nil || userID == nil {
+		return err
+	}
+	_, err = s.r.multi(ctx,
+		[]string{"HDEL", redisUserSessionsKey + string(userID), field},
+		[]string{"HDEL", redisSessionIndexKey, field},
+	)
+	return err
+}
@@ -0,0 +1,121 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+)
+
+// Backends for shared state
+const (
+	BackendLocal = "local"
+	BackendRedis = "redis"
+)
+
+// Sessions stores sticky user-channel sessions
+type Sessions interface {
+	CreateSession(session *database.Session) error
+	GetSession(id int64) (*database.Session, error)
+	GetSessionByUserAndChannel(userID, channelID int64) (*database.Session, error)
+	GetSessionByUser(userID int64) (*database.Session, error)
+	GetSessionByKey(userID int64, sessionKey string) (*database.Session, error)
+	ListSessions() ([]*database.Session, error)
+	UpdateSessionLastUsed(id int64) error
+	DeleteSession(id int64) error
+	DeleteExpiredSessions(idleTimeoutMinutes int) error
+}
+
+// Metrics stores the per-channel performance metrics used for routing
+type Metrics interface {
+	GetChannelMetrics(channelID int64) (*database.ChannelMetrics, error)
+	UpdateChannelMetrics(channelID int64, latency float64, success bool) error
+	ResetChannelMetrics(channelID int64) error
+}
+
+// RateLimits counts events in fixed windows
+type RateLimits interface {
+	// Incr increments the counter for key and returns its new value. The
+	// counter starts at zero again once window has elapsed since its first
+	// increment.
+	Incr(ctx context.Context, key string, window time.Duration) (int64, error)
+}
+
+// State holds short-lived shared values such as channel health
+type State interface {
+	// Get returns the value stored under key, or nil when it is missing or expired
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Set stores value under key; a zero ttl keeps it until overwritten
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// Members holds named sets of members with a value each, such as the
+// replicas of a cluster and their latest heartbeat
+type Members interface {
+	// SetMember stores value for member in set, replacing its previous value
+	SetMember(ctx context.Context, set, member string, value []byte) error
+	// ListMembers returns the value of every member of set
+	ListMembers(ctx context.Context, set string) (map[string][]byte, error)
+	// DeleteMember removes member from set
+	DeleteMember(ctx context.Context, set, member string) error
+}
+
+// Options selects and configures the shared state backend
+type Options struct {
+	Backend       string
+	RedisAddr     string
+	RedisPassword string
+	RedisDB       int
+}
+
+// Stores bundles the state stores used by the gateway. With the local
+// backend, sessions and metrics live in the database and the other state in
+// memory. With the redis backend, all of it lives in Redis so that it is
+// shared when several replicas run behind a load balancer.
+type Stores struct {
+	Sessions   Sessions
+	Metrics    Metrics
+	RateLimits RateLimits
+	State      State
+	Members    Members
+
+	close func() error
+}
+
+// New creates the stores for the configured backend
+func New(db *database.DB, opts Options) (*Stores, error) {
+	stores := &Stores{
+		Sessions: db,
+		Metrics:  db,
+		close:    func() error { return nil },
+	}
+
+	switch opts.Backend {
+	case "", BackendLocal:
+		mem := NewMemory()
+		stores.RateLimits = mem
+		stores.State = mem
+		stores.Members = mem
+	case BackendRedis:
+		redis, err := NewRedis(opts.RedisAddr, opts.RedisPassword, opts.RedisDB)
+		if err != nil {
+			return nil, err
+		}
+		stores.Sessions = NewRedisSessions(redis)
+		stores.Metrics = NewRedisMetrics(redis)
+		stores.RateLimits = redis
+		stores.State = redis
+		stores.Members = redis
+		stores.close = redis.Close
+	default:
+		return nil, fmt.Errorf("unknown store backend: %s", opts.Backend)
+	}
+
+	return stores, nil
+}
+
+// Close releases connections held by the stores
+func (s *Stores) Close() error {
+	return s.close()
+}
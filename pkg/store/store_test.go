@@ -0,0 +1,386 @@
+package store
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/X0Ken/openai-gateway/pkg/database"
+)
+
+func TestMemoryIncrWindow(t *testing.T) {
+	mem := NewMemory()
+	now := time.Now()
+	mem.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	for i := int64(1); i <= 3; i++ {
+		n, err := mem.Incr(ctx, "user:1", time.Minute)
+		if err != nil {
+			t.Fatalf("Incr failed: %v", err)
+		}
+		if n != i {
+			t.Errorf("Expected %d, got %d", i, n)
+		}
+	}
+
+	now = now.Add(time.Minute)
+	if n, _ := mem.Incr(ctx, "user:1", time.Minute); n != 1 {
+		t.Errorf("Expected counter to reset after window, got %d", n)
+	}
+}
+
+func TestMemoryStateTTL(t *testing.T) {
+	mem := NewMemory()
+	now := time.Now()
+	mem.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	mem.Set(ctx, "health:1", []byte("ok"), time.Second)
+
+	if v, _ := mem.Get(ctx, "health:1"); string(v) != "ok" {
+		t.Errorf("Expected ok, got %q", v)
+	}
+
+	now = now.Add(2 * time.Second)
+	if v, _ := mem.Get(ctx, "health:1"); v != nil {
+		t.Errorf("Expected expired value, got %q", v)
+	}
+}
+
+func TestRedis(t *testing.T) {
+	addr := startFakeRedis(t)
+
+	r, err := NewRedis(addr, "secret", 2)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer r.Close()
+
+	ctx := context.Background()
+	for i := int64(1); i <= 2; i++ {
+		n, err := r.Incr(ctx, "user:1", time.Minute)
+		if err != nil {
+			t.Fatalf("Incr failed: %v", err)
+		}
+		if n != i {
+			t.Errorf("Expected %d, got %d", i, n)
+		}
+	}
+
+	if v, err := r.Get(ctx, "missing"); err != nil || v != nil {
+		t.Errorf("Expected nil for missing key, got %q, %v", v, err)
+	}
+
+	if err := r.Set(ctx, "health:1", []byte(`{"status":"healthy"}`), time.Minute); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if v, _ := r.Get(ctx, "health:1"); string(v) != `{"status":"healthy"}` {
+		t.Errorf("Unexpected value %q", v)
+	}
+
+	r.SetMember(ctx, "cluster", "gw-1", []byte(`{"id":"gw-1"}`))
+	r.SetMember(ctx, "cluster", "gw-2", []byte(`{"id":"gw-2"}`))
+	r.DeleteMember(ctx, "cluster", "gw-2")
+	members, err := r.ListMembers(ctx, "cluster")
+	if err != nil {
+		t.Fatalf("ListMembers failed: %v", err)
+	}
+	if len(members) != 1 || string(members["gw-1"]) != `{"id":"gw-1"}` {
+		t.Errorf("Unexpected members %q", members)
+	}
+}
+
+func TestRedisConcurrent(t *testing.T) {
+	r, err := NewRedis(startFakeRedis(t), "", 0)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer r.Close()
+
+	// Concurrent commands share the pool without mixing up their replies
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < 4*redisPoolSize; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if _, err := r.Incr(ctx, "shared", time.Minute); err != nil {
+					t.Errorf("Incr failed: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if n, err := r.Incr(ctx, "shared", time.Minute); err != nil || n != 40*redisPoolSize+1 {
+		t.Errorf("Expected %d, got %d (%v)", 40*redisPoolSize+1, n, err)
+	}
+}
+
+func TestRedisMulti(t *testing.T) {
+	r, err := NewRedis(startFakeRedis(t), "", 0)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer r.Close()
+
+	ctx := context.Background()
+	replies, err := r.multi(ctx, []string{"HINCRBY", "h", "a", "2"}, []string{"HSET", "h", "b", "x"})
+	if err != nil || len(replies) != 2 || replies[0] != int64(2) {
+		t.Fatalf("Unexpected EXEC replies %v (%v)", replies, err)
+	}
+
+	// A failed command fails the transaction, and the connection stays
+	// usable with every reply read
+	if _, err := r.multi(ctx, []string{"BOGUS"}, []string{"HSET", "h", "c", "y"}); err == nil {
+		t.Error("Expected the failed command to be reported")
+	}
+	for i := 0; i < redisPoolSize; i++ {
+		if v, err := r.getMember(ctx, "h", "b"); err != nil || string(v) != "x" {
+			t.Fatalf("Expected the connection usable after a failed command, got %q (%v)", v, err)
+		}
+	}
+}
+
+func TestRedisSessions(t *testing.T) {
+	r, err := NewRedis(startFakeRedis(t), "", 0)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer r.Close()
+
+	sessions := NewRedisSessions(r)
+	now := time.Now()
+	sessions.now = func() time.Time { return now }
+
+	first := &database.Session{UserID: 1, ChannelID: 10}
+	second := &database.Session{UserID: 1, SessionKey: "end-user", ChannelID: 20}
+	other := &database.Session{UserID: 2, ChannelID: 10}
+	for _, s := range []*database.Session{first, second, other} {
+		if err := sessions.CreateSession(s); err != nil {
+			t.Fatalf("CreateSession failed: %v", err)
+		}
+		now = now.Add(time.Second)
+	}
+	if first.ID == 0 || second.ID == first.ID {
+		t.Errorf("Expected distinct IDs, got %d and %d", first.ID, second.ID)
+	}
+
+	if s, _ := sessions.GetSessionByUser(1); s == nil || s.ID != second.ID {
+		t.Errorf("Expected the most recent session of user 1, got %+v", s)
+	}
+	if s, _ := sessions.GetSessionByKey(1, ""); s == nil || s.ID != first.ID {
+		t.Errorf("Expected the key's own session, got %+v", s)
+	}
+	if s, _ := sessions.GetSessionByUserAndChannel(2, 10); s == nil || s.ID != other.ID {
+		t.Errorf("Expected the session of user 2 on channel 10, got %+v", s)
+	}
+	if s, _ := sessions.GetSession(second.ID); s == nil || s.SessionKey != "end-user" {
+		t.Errorf("Expected session %d, got %+v", second.ID, s)
+	}
+
+	// Using the first session keeps it from expiring with the others
+	now = now.Add(time.Hour)
+	if err := sessions.UpdateSessionLastUsed(first.ID); err != nil {
+		t.Fatalf("UpdateSessionLastUsed failed: %v", err)
+	}
+	if err := sessions.DeleteExpiredSessions(30); err != nil {
+		t.Fatalf("DeleteExpiredSessions failed: %v", err)
+	}
+	list, err := sessions.ListSessions()
+	if err != nil || len(list) != 1 || list[0].ID != first.ID {
+		t.Errorf("Expected only the used session left, got %+v (%v)", list, err)
+	}
+
+	sessions.DeleteSession(first.ID)
+	if s, err := sessions.GetSession(first.ID); s != nil || err != nil {
+		t.Errorf("Expected the session deleted, got %+v (%v)", s, err)
+	}
+}
+
+func TestRedisMetrics(t *testing.T) {
+	r, err := NewRedis(startFakeRedis(t), "", 0)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer r.Close()
+
+	metrics := NewRedisMetrics(r)
+	if m, err := metrics.GetChannelMetrics(1); m != nil || err != nil {
+		t.Errorf("Expected no metrics before any request, got %+v (%v)", m, err)
+	}
+
+	metrics.UpdateChannelMetrics(1, 0.5, true)
+	metrics.UpdateChannelMetrics(1, 1.5, false)
+	m, err := metrics.GetChannelMetrics(1)
+	if err != nil || m == nil {
+		t.Fatalf("GetChannelMetrics failed: %v", err)
+	}
+	if m.RequestCount != 2 || m.SuccessCount != 1 || m.LatencyAvg != 1 || m.ErrorRate != 0.5 {
+		t.Errorf("Unexpected metrics %+v", m)
+	}
+
+	metrics.ResetChannelMetrics(1)
+	if m, _ := metrics.GetChannelMetrics(1); m != nil {
+		t.Errorf("Expected metrics reset, got %+v", m)
+	}
+}
+
+func TestNewUnknownBackend(t *testing.T) {
+	if _, err := New(nil, Options{Backend: "etcd"}); err == nil {
+		t.Error("Expected error for unknown backend")
+	}
+}
+
+// startFakeRedis serves the handful of commands used by the Redis store
+func startFakeRedis(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	var mu sync.Mutex
+	data := map[string]string{}
+	hashes := map[string]map[string]string{}
+
+	// run executes a command; the caller holds mu
+	run := func(args []string) string {
+		var reply string
+		switch strings.ToUpper(args[0]) {
+		case "AUTH", "SELECT":
+			reply = "+OK\r\n"
+		case "SET":
+			_, exists := data[args[1]]
+			if exists && len(args) > 3 && strings.EqualFold(args[len(args)-1], "NX") {
+				reply = "$-1\r\n"
+			} else {
+				data[args[1]] = args[2]
+				reply = "+OK\r\n"
+			}
+		case "INCR":
+			n, _ := strconv.ParseInt(data[args[1]], 10, 64)
+			n++
+			data[args[1]] = strconv.FormatInt(n, 10)
+			reply = fmt.Sprintf(":%d\r\n", n)
+		case "GET":
+			if v, ok := data[args[1]]; ok {
+				reply = fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+			} else {
+				reply = "$-1\r\n"
+			}
+		case "HSET":
+			if hashes[args[1]] == nil {
+				hashes[args[1]] = map[string]string{}
+			}
+			hashes[args[1]][args[2]] = args[3]
+			reply = ":1\r\n"
+		case "HGET":
+			if v, ok := hashes[args[1]][args[2]]; ok {
+				reply = fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+			} else {
+				reply = "$-1\r\n"
+			}
+		case "HINCRBY", "HINCRBYFLOAT":
+			if hashes[args[1]] == nil {
+				hashes[args[1]] = map[string]string{}
+			}
+			current, _ := strconv.ParseFloat(hashes[args[1]][args[2]], 64)
+			by, _ := strconv.ParseFloat(args[3], 64)
+			v := strconv.FormatFloat(current+by, 'f', -1, 64)
+			hashes[args[1]][args[2]] = v
+			if strings.EqualFold(args[0], "HINCRBY") {
+				reply = fmt.Sprintf(":%s\r\n", v)
+			} else {
+				reply = fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+			}
+		case "DEL":
+			delete(data, args[1])
+			delete(hashes, args[1])
+			reply = ":1\r\n"
+		case "HDEL":
+			delete(hashes[args[1]], args[2])
+			reply = ":1\r\n"
+		case "HGETALL":
+			reply = fmt.Sprintf("*%d\r\n", 2*len(hashes[args[1]]))
+			for field, v := range hashes[args[1]] {
+				reply += fmt.Sprintf("$%d\r\n%s\r\n$%d\r\n%s\r\n", len(field), field, len(v), v)
+			}
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		return reply
+	}
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				var queued [][]string
+				inMulti := false
+				for {
+					args, err := readCommand(reader)
+					if err != nil {
+						return
+					}
+
+					var reply string
+					switch {
+					case strings.EqualFold(args[0], "MULTI"):
+						inMulti, queued = true, nil
+						reply = "+OK\r\n"
+					case strings.EqualFold(args[0], "EXEC"):
+						mu.Lock()
+						reply = fmt.Sprintf("*%d\r\n", len(queued))
+						for _, cmd := range queued {
+							reply += run(cmd)
+						}
+						mu.Unlock()
+						inMulti = false
+					case inMulti:
+						queued = append(queued, args)
+						reply = "+QUEUED\r\n"
+					default:
+						mu.Lock()
+						reply = run(args)
+						mu.Unlock()
+					}
+
+					conn.Write([]byte(reply))
+				}
+			}()
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+// readCommand reads a RESP array of bulk strings
+func readCommand(r *bufio.Reader) ([]string, error) {
+	reply, err := readReply(r)
+	if err != nil {
+		return nil, err
+	}
+	items, ok := reply.([]any)
+	if !ok || len(items) == 0 {
+		return nil, fmt.Errorf("expected command array")
+	}
+
+	args := make([]string, len(items))
+	for i, item := range items {
+		args[i] = string(item.([]byte))
+	}
+	return args, nil
+}
@@ -0,0 +1,62 @@
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Run calls fn for every item using at most limit concurrent goroutines and
+// waits for all started calls to return. Dispatch stops as soon as ctx is
+// cancelled; items that were never started report ctx.Err(). The returned
+// error joins every error produced by fn.
+func Run[T any](ctx context.Context, limit int, items []T, fn func(ctx context.Context, item T) error) error {
+	if limit <= 0 || limit > len(items) {
+		limit = len(items)
+	}
+	if limit == 0 {
+		return nil
+	}
+
+	var (
+		mu   sync.Mutex
+		errs []error
+		wg   sync.WaitGroup
+	)
+	record := func(err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	}
+
+	work := make(chan T)
+	for i := 0; i < limit; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range work {
+				if err := fn(ctx, item); err != nil {
+					record(err)
+				}
+			}
+		}()
+	}
+
+dispatch:
+	for _, item := range items {
+		if err := ctx.Err(); err != nil {
+			record(err)
+			break
+		}
+		select {
+		case work <- item:
+		case <-ctx.Done():
+			record(ctx.Err())
+			break dispatch
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
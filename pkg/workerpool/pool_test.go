@@ -0,0 +1,75 @@
+package workerpool
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunBoundsConcurrency(t *testing.T) {
+	items := make([]int, 50)
+	for i := range items {
+		items[i] = i
+	}
+
+	var active, peak, calls int32
+	err := Run(context.Background(), 4, items, func(ctx context.Context, item int) error {
+		n := atomic.AddInt32(&active, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&active, -1)
+		atomic.AddInt32(&calls, 1)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if calls != 50 {
+		t.Errorf("Expected 50 calls, got %d", calls)
+	}
+	if peak > 4 {
+		t.Errorf("Expected at most 4 concurrent workers, got %d", peak)
+	}
+}
+
+func TestRunJoinsErrors(t *testing.T) {
+	errOdd := errors.New("odd item")
+
+	err := Run(context.Background(), 2, []int{1, 2, 3}, func(ctx context.Context, item int) error {
+		if item%2 == 1 {
+			return errOdd
+		}
+		return nil
+	})
+
+	if !errors.Is(err, errOdd) {
+		t.Errorf("Expected joined error to contain errOdd, got %v", err)
+	}
+}
+
+func TestRunStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var calls int32
+	err := Run(ctx, 1, make([]int, 100), func(ctx context.Context, item int) error {
+		if atomic.AddInt32(&calls, 1) == 3 {
+			cancel()
+		}
+		return nil
+	})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if calls >= 100 {
+		t.Errorf("Expected dispatch to stop after cancellation, got %d calls", calls)
+	}
+}
@@ -0,0 +1,281 @@
+package integration
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/X0Ken/openai-gateway/internal/api"
+	"github.com/X0Ken/openai-gateway/internal/auth"
+	"github.com/X0Ken/openai-gateway/internal/channel"
+	"github.com/X0Ken/openai-gateway/internal/chaos"
+	"github.com/X0Ken/openai-gateway/internal/metrics"
+	"github.com/X0Ken/openai-gateway/internal/router"
+	"github.com/X0Ken/openai-gateway/pkg/database"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+const (
+	roleChunk    = `data: {"id":"c1","choices":[{"index":0,"delta":{"role":"assistant","content":""}}]}` + "\n\n"
+	contentChunk = `data: {"id":"c1","choices":[{"index":0,"delta":{"content":"Hello"}}]}` + "\n\n"
+	finishChunk  = `data: {"id":"c1","choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}` + "\n\n"
+	doneEvent    = "data: [DONE]\n\n"
+)
+
+// failoverGateway is a gateway serving one model from a primary and a
+// backup channel, with the test user pinned to the primary
+type failoverGateway struct {
+	url             string
+	apiKey          string
+	db              *database.DB
+	primary, backup *database.Channel
+}
+
+// setupFailoverGateway starts a gateway over HTTP in front of the two
+// backends. opts configures the channels' transports.
+func setupFailoverGateway(t *testing.T, primaryURL, backupURL string, opts channel.TransportOptions) *failoverGateway {
+	t.Helper()
+	dbPath := fmt.Sprintf("/tmp/test_integration_failover_%d.db", os.Getpid())
+	os.Remove(dbPath)
+	db, err := database.New(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		os.Remove(dbPath)
+	})
+
+	g := &failoverGateway{apiKey: "failover-key", db: db}
+	user := &database.User{APIKey: g.apiKey, Name: "Failover"}
+	if err := db.CreateUser(user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	model := &database.Model{Name: "gpt-4o"}
+	if err := db.CreateModel(model); err != nil {
+		t.Fatalf("Failed to create model: %v", err)
+	}
+
+	for _, ch := range []**database.Channel{&g.primary, &g.backup} {
+		*ch = &database.Channel{Weight: 10, Enabled: true, APIKey: "sk-test"}
+	}
+	g.primary.Name, g.primary.BaseURL = t.Name()+"-primary", primaryURL
+	g.backup.Name, g.backup.BaseURL = t.Name()+"-backup", backupURL
+	for _, ch := range []*database.Channel{g.primary, g.backup} {
+		if err := db.CreateChannel(ch); err != nil {
+			t.Fatalf("Failed to create channel: %v", err)
+		}
+		if err := db.AddModelChannel(&database.ModelChannel{ModelID: model.ID, ChannelID: ch.ID, BackendModelName: "gpt-4o", Weight: 10}); err != nil {
+			t.Fatalf("Failed to add model-channel mapping: %v", err)
+		}
+	}
+	if err := db.CreateSession(&database.Session{UserID: user.ID, ChannelID: g.primary.ID}); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	channelMgr := channel.NewManager(db)
+	channelMgr.SetTransportOptions(opts)
+	apiHandler := api.NewHandler(router.NewEngine(db), channelMgr, db)
+	apiHandler.RegisterRoutes(r.Group("/v1"), auth.NewMiddleware(db))
+
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	g.url = server.URL
+	return g
+}
+
+// stream sends a streamed chat completion and returns the status and the
+// data of every event received
+func (g *failoverGateway) stream(t *testing.T) (int, []string) {
+	t.Helper()
+	req, _ := http.NewRequest("POST", g.url+"/v1/chat/completions", strings.NewReader(`{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}],"stream":true}`))
+	req.Header.Set("Authorization", "Bearer "+g.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var events []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+			events = append(events, data)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("Client stream failed: %v", err)
+	}
+	return resp.StatusCode, events
+}
+
+// assertValidStream checks a client stream is well formed: JSON events
+// followed by exactly one [DONE] at the end
+func assertValidStream(t *testing.T, events []string) {
+	t.Helper()
+	if len(events) == 0 || events[len(events)-1] != "[DONE]" {
+		t.Fatalf("Expected the stream to end with [DONE], got %q", events)
+	}
+	for _, data := range events[:len(events)-1] {
+		if !json.Valid([]byte(data)) {
+			t.Errorf("Expected every event to be JSON, got %q", data)
+		}
+	}
+}
+
+// streamBackend serves the events as a stream. With die, the connection is
+// then closed without ending the response, as when a backend crashes.
+func streamBackend(t *testing.T, die bool, events ...string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range events {
+			w.Write([]byte(event))
+			w.(http.Flusher).Flush()
+		}
+		if die {
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err == nil {
+				conn.Close()
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// counters are the gateway metrics a failover changes
+type counters struct {
+	retries, primaryErrors, backupErrors, drops float64
+}
+
+// counters reads the metrics of the gateway's channels. Metrics are global,
+// so tests compare them before and after a request.
+func (g *failoverGateway) counters() counters {
+	return counters{
+		retries:       testutil.ToFloat64(metrics.StreamRetries.WithLabelValues(g.primary.Name)),
+		primaryErrors: testutil.ToFloat64(metrics.ErrorCounter.WithLabelValues("channel", g.primary.Name)),
+		backupErrors:  testutil.ToFloat64(metrics.ErrorCounter.WithLabelValues("channel", g.backup.Name)),
+		drops:         testutil.ToFloat64(metrics.ChaosFaults.WithLabelValues(g.primary.Name, metrics.ChaosDrop)),
+	}
+}
+
+// channelMetrics returns the request and success counts recorded for a channel
+func channelMetrics(t *testing.T, db *database.DB, ch *database.Channel) (requests, successes int64) {
+	t.Helper()
+	m, err := db.GetChannelMetrics(ch.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m == nil {
+		return 0, 0
+	}
+	return m.RequestCount, m.SuccessCount
+}
+
+// assertFailedOver checks the request failed on the primary, was retried
+// once on the backup, and the client got only the backup's stream
+func assertFailedOver(t *testing.T, g *failoverGateway, before counters, status int, events []string) {
+	t.Helper()
+	if status != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %q", status, events)
+	}
+	assertValidStream(t, events)
+	if len(events) != 4 || !strings.Contains(events[1], `"Hello"`) {
+		t.Errorf("Expected only the backup's role, content and finish events, got %q", events)
+	}
+
+	after := g.counters()
+	if got := after.retries - before.retries; got != 1 {
+		t.Errorf("Expected 1 stream retry recorded for the primary, got %v", got)
+	}
+	if got := after.primaryErrors - before.primaryErrors; got != 1 {
+		t.Errorf("Expected 1 error recorded for the primary, got %v", got)
+	}
+	if got := after.backupErrors - before.backupErrors; got != 0 {
+		t.Errorf("Expected no error recorded for the backup, got %v", got)
+	}
+	if requests, successes := channelMetrics(t, g.db, g.primary); requests != 1 || successes != 0 {
+		t.Errorf("Expected 1 failed request on the primary, got %d requests and %d successes", requests, successes)
+	}
+	if requests, successes := channelMetrics(t, g.db, g.backup); requests != 1 || successes != 1 {
+		t.Errorf("Expected 1 successful request on the backup, got %d requests and %d successes", requests, successes)
+	}
+}
+
+func TestStreamFailsOverOnServerError(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":{"message":"overloaded"}}`, http.StatusInternalServerError)
+	}))
+	defer primary.Close()
+	backup := streamBackend(t, false, roleChunk, contentChunk, finishChunk, doneEvent)
+
+	g := setupFailoverGateway(t, primary.URL, backup.URL, channel.DefaultTransportOptions())
+	before := g.counters()
+	status, events := g.stream(t)
+	assertFailedOver(t, g, before, status, events)
+}
+
+func TestStreamFailsOverWhenBackendDiesBeforeContent(t *testing.T) {
+	primary := streamBackend(t, true, roleChunk)
+	backup := streamBackend(t, false, roleChunk, contentChunk, finishChunk, doneEvent)
+
+	g := setupFailoverGateway(t, primary.URL, backup.URL, channel.DefaultTransportOptions())
+	before := g.counters()
+	status, events := g.stream(t)
+	assertFailedOver(t, g, before, status, events)
+}
+
+func TestStreamFailsOverOnInjectedDrop(t *testing.T) {
+	// A healthy primary whose streams are dropped by chaos testing
+	primary := streamBackend(t, false, roleChunk, contentChunk, finishChunk, doneEvent)
+	backup := streamBackend(t, false, roleChunk, contentChunk, finishChunk, doneEvent)
+
+	opts := channel.DefaultTransportOptions()
+	opts.Wrap = chaos.New([]chaos.Fault{{Channels: []string{"*-primary"}, DropRate: 1, DropAfterBytes: len(roleChunk)}}).Wrap
+	g := setupFailoverGateway(t, primary.URL, backup.URL, opts)
+	before := g.counters()
+	status, events := g.stream(t)
+	assertFailedOver(t, g, before, status, events)
+	if got := g.counters().drops - before.drops; got != 1 {
+		t.Errorf("Expected 1 injected drop recorded, got %v", got)
+	}
+}
+
+func TestStreamEndsWithErrorWhenBackendDiesAfterContent(t *testing.T) {
+	primary := streamBackend(t, true, roleChunk, contentChunk)
+	backup := streamBackend(t, false, roleChunk, contentChunk, finishChunk, doneEvent)
+
+	g := setupFailoverGateway(t, primary.URL, backup.URL, channel.DefaultTransportOptions())
+	before := g.counters()
+	status, events := g.stream(t)
+	if status != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %q", status, events)
+	}
+
+	// Content already reached the client, so the stream cannot be retried.
+	// It ends with an error event the client can tell apart.
+	assertValidStream(t, events)
+	if len(events) != 4 || !strings.Contains(events[1], `"Hello"`) || !strings.Contains(events[2], `"code":"stream_interrupted"`) {
+		t.Errorf("Expected the primary's content, an error event and [DONE], got %q", events)
+	}
+
+	after := g.counters()
+	if got := after.retries - before.retries; got != 0 {
+		t.Errorf("Expected no stream retry, got %v", got)
+	}
+	if got := after.primaryErrors - before.primaryErrors; got != 1 {
+		t.Errorf("Expected 1 error recorded for the primary, got %v", got)
+	}
+	if requests, _ := channelMetrics(t, g.db, g.backup); requests != 0 {
+		t.Errorf("Expected no request on the backup, got %d", requests)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/X0Ken/openai-gateway/internal/admin"
@@ -81,6 +82,7 @@ func setupTestServer(t *testing.T) (*gin.Engine, *database.DB, func()) {
 
 	adminHandler := admin.NewHandler(channelMgr, sessionMgr, db)
 	adminGroup := r.Group("/api")
+	adminGroup.Use(authMiddleware.RequireAdmin())
 	adminHandler.RegisterRoutes(adminGroup)
 
 	cleanup := func() {
@@ -197,3 +199,391 @@ func TestAuthentication(t *testing.T) {
 		t.Errorf("Expected status 401 with invalid auth, got %d", w.Code)
 	}
 }
+
+func TestCreateDuplicateChannel(t *testing.T) {
+	r, _, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	reqBody := channel.CreateRequest{
+		Name:    fmt.Sprintf("test-channel-%d", os.Getpid()),
+		BaseURL: "https://api.example.com",
+		APIKey:  "sk-new-key",
+		Enabled: true,
+	}
+
+	body, _ := json.Marshal(reqBody)
+	req := httptest.NewRequest("POST", "/api/channels", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestBulkCreateUsers(t *testing.T) {
+	r, db, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	body := `{"users":[{"name":"alice"},{"name":"bob","api_key":"bob-key"}]}`
+	req := httptest.NewRequest("POST", "/api/users/bulk", bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var response admin.BulkCreateUsersResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if response.Created != 2 {
+		t.Errorf("Expected 2 users created, got %d", response.Created)
+	}
+	if response.Users[0].APIKey == "" {
+		t.Error("Expected a generated API key for alice")
+	}
+	if response.Users[1].APIKey != "bob-key" {
+		t.Errorf("Expected provided API key to be kept, got %s", response.Users[1].APIKey)
+	}
+
+	// CSV upload; a duplicate name rejects the whole batch
+	csvBody := "name,api_key\ncarol,\nalice,\n"
+	req = httptest.NewRequest("POST", "/api/users/bulk", bytes.NewReader([]byte(csvBody)))
+	req.Header.Set("Content-Type", "text/csv")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409, got %d: %s", w.Code, w.Body.String())
+	}
+
+	users, _ := db.ListUsers()
+	for _, u := range users {
+		if u.Name == "carol" {
+			t.Error("Expected batch to be rolled back")
+		}
+	}
+}
+
+func TestUserLabels(t *testing.T) {
+	r, _, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	bodies := []string{
+		`{"api_key":"staging-key","name":"staging-bot","labels":{"env":"staging"},"metadata":{"owner":"qa"}}`,
+		`{"api_key":"prod-key","name":"prod-bot","labels":{"env":"prod"}}`,
+	}
+	for _, body := range bodies {
+		req := httptest.NewRequest("POST", "/api/users", bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/api/users?label=env=staging", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var users []database.User
+	if err := json.Unmarshal(w.Body.Bytes(), &users); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(users) != 1 || users[0].Name != "staging-bot" {
+		t.Fatalf("Expected only staging-bot, got %+v", users)
+	}
+	if string(users[0].Metadata) != `{"owner":"qa"}` {
+		t.Errorf("Unexpected metadata: %s", users[0].Metadata)
+	}
+
+	// Relabel the user; labels are replaced as a whole
+	body := `{"labels":{"env":"prod","tier":"gold"}}`
+	req = httptest.NewRequest("PUT", fmt.Sprintf("/api/users/%d", users[0].ID), bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/api/users?label=env=prod", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	json.Unmarshal(w.Body.Bytes(), &users)
+	if len(users) != 2 {
+		t.Errorf("Expected 2 prod users, got %d", len(users))
+	}
+}
+
+func TestResetChannelMetrics(t *testing.T) {
+	r, db, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	channels, _ := db.ListChannels()
+	id := channels[0].ID
+	db.UpdateChannelMetrics(id, 0.5, true)
+	db.UpdateChannelMetrics(id, 1.5, false)
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/api/channels/%d/metrics", id), nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var m database.ChannelMetrics
+	json.Unmarshal(w.Body.Bytes(), &m)
+	if m.RequestCount != 2 || m.SuccessCount != 1 {
+		t.Fatalf("Unexpected metrics: %+v", m)
+	}
+
+	req = httptest.NewRequest("POST", fmt.Sprintf("/api/channels/%d/metrics/reset", id), nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var entry database.AuditEntry
+	json.Unmarshal(w.Body.Bytes(), &entry)
+	var before, after database.ChannelMetrics
+	json.Unmarshal(entry.Before, &before)
+	json.Unmarshal(entry.After, &after)
+	if entry.Action != "reset_metrics" || before.RequestCount != 2 || after.RequestCount != 0 {
+		t.Errorf("Unexpected audit entry: %+v", entry)
+	}
+
+	req = httptest.NewRequest("GET", fmt.Sprintf("/api/audit?target_type=channel&target_id=%d", id), nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var entries []database.AuditEntry
+	json.Unmarshal(w.Body.Bytes(), &entries)
+	if len(entries) != 1 || entries[0].ID != entry.ID {
+		t.Errorf("Expected the reset in the audit log, got %+v", entries)
+	}
+
+	req = httptest.NewRequest("GET", "/api/channels/9999/metrics", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for unknown channel, got %d", w.Code)
+	}
+}
+
+func TestCompareChannels(t *testing.T) {
+	r, db, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	channels, _ := db.ListChannels()
+	db.UpdateChannelMetrics(channels[0].ID, 0.2, true)
+
+	req := httptest.NewRequest("GET", "/api/channels/compare?model=gpt-3.5-turbo", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Model    string                    `json:"model"`
+		Channels []admin.ChannelComparison `json:"channels"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(resp.Channels) != 1 || resp.Channels[0].ChannelID != channels[0].ID || resp.Channels[0].RequestCount != 1 {
+		t.Errorf("Unexpected comparison: %+v", resp)
+	}
+
+	req = httptest.NewRequest("GET", "/api/channels/compare?model=unknown", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for unknown model, got %d", w.Code)
+	}
+}
+
+func TestTestOnlyChannel(t *testing.T) {
+	r, db, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	var backendCalls int
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backendCalls++
+		if r.Header.Get("Authorization") != "Bearer test-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"chatcmpl-1","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":"pong"},"finish_reason":"stop"}]}`))
+	}))
+	defer mockBackend.Close()
+
+	channels, _ := db.ListChannels()
+	id := channels[0].ID
+	update, _ := json.Marshal(map[string]any{"base_url": mockBackend.URL, "test_only": true})
+	req := httptest.NewRequest("PUT", fmt.Sprintf("/api/channels/%d", id), bytes.NewReader(update))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// User traffic is never routed to a test-only channel
+	body := []byte(`{"model":"gpt-3.5-turbo","messages":[{"role":"user","content":"hi"}]}`)
+	req = httptest.NewRequest("POST", "/v1/chat/completions", bytes.NewReader(body))
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer test-api-key-%d", os.Getpid()))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 with only a test-only channel, got %d", w.Code)
+	}
+	if backendCalls != 0 {
+		t.Errorf("Expected no backend calls from user traffic, got %d", backendCalls)
+	}
+
+	// A manual test reaches it directly
+	req = httptest.NewRequest("POST", fmt.Sprintf("/api/channels/%d/test", id), nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var result admin.ChannelTestResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if result.StatusCode != http.StatusOK || result.Model != "gpt-3.5-turbo" || len(result.Response) == 0 {
+		t.Errorf("Unexpected test result: %+v", result)
+	}
+	if backendCalls != 1 {
+		t.Errorf("Expected one backend call, got %d", backendCalls)
+	}
+}
+
+func TestRoutingRules(t *testing.T) {
+	r, db, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	channels, _ := db.ListChannels()
+	channelID := channels[0].ID
+
+	create := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/routing-rules", bytes.NewReader([]byte(body)))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := create(fmt.Sprintf(`{"name":"long-context","priority":10,"model":"gpt-3.5-turbo","channel_id":%d,"conditions":{"min_prompt_tokens":8000}}`, channelID))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var rule database.RoutingRule
+	json.Unmarshal(w.Body.Bytes(), &rule)
+	if !rule.Enabled || rule.Conditions.MinPromptTokens != 8000 {
+		t.Errorf("Unexpected rule: %+v", rule)
+	}
+
+	invalid := []string{
+		`{"name":"missing-channel","channel_id":9999}`,
+		fmt.Sprintf(`{"name":"missing-model","model":"unknown","channel_id":%d}`, channelID),
+		fmt.Sprintf(`{"name":"inverted","channel_id":%d,"conditions":{"min_prompt_tokens":10,"max_prompt_tokens":5}}`, channelID),
+	}
+	for _, body := range invalid {
+		if w := create(body); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s, got %d", body, w.Code)
+		}
+	}
+	if w := create(fmt.Sprintf(`{"name":"long-context","channel_id":%d}`, channelID)); w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for a duplicate name, got %d", w.Code)
+	}
+
+	req := httptest.NewRequest("PUT", fmt.Sprintf("/api/routing-rules/%d", rule.ID), bytes.NewReader([]byte(`{"enabled":false}`)))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/api/routing-rules", nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var rules []database.RoutingRule
+	json.Unmarshal(w.Body.Bytes(), &rules)
+	if len(rules) != 1 || rules[0].Enabled || rules[0].Conditions.MinPromptTokens != 8000 {
+		t.Errorf("Expected one disabled rule with its conditions kept, got %+v", rules)
+	}
+
+	req = httptest.NewRequest("DELETE", fmt.Sprintf("/api/routing-rules/%d", rule.ID), nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", w.Code)
+	}
+}
+
+func TestAdminTokens(t *testing.T) {
+	r, _, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	send := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// The admin API is open until the first token is created
+	if w := send("GET", "/api/channels", "", ""); w.Code != http.StatusOK {
+		t.Fatalf("Expected open admin API, got %d", w.Code)
+	}
+
+	w := send("POST", "/api/admin-tokens", "", `{"name": "ops"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var token database.AdminToken
+	json.Unmarshal(w.Body.Bytes(), &token)
+	if token.Token == "" {
+		t.Fatal("Expected the token value in the create response")
+	}
+
+	if w := send("GET", "/api/channels", "", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a token, got %d", w.Code)
+	}
+	if w := send("GET", "/api/channels", "wrong", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 with a wrong token, got %d", w.Code)
+	}
+	if w := send("GET", "/api/channels", token.Token, ""); w.Code != http.StatusOK {
+		t.Errorf("Expected 200 with the token, got %d", w.Code)
+	}
+
+	w = send("GET", "/api/admin-tokens", token.Token, "")
+	if strings.Contains(w.Body.String(), token.Token) {
+		t.Error("Expected token values to be hidden when listing")
+	}
+
+	// Revoking the last token opens the admin API again
+	if w := send("DELETE", fmt.Sprintf("/api/admin-tokens/%d", token.ID), token.Token, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d", w.Code)
+	}
+	if w := send("GET", "/api/channels", "", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected open admin API after revoking the last token, got %d", w.Code)
+	}
+}